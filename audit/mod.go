@@ -0,0 +1,321 @@
+// Package audit provides an append-only log of security-relevant events, such as handshake
+// successes and failures, key changes, bans and administrative actions.
+//
+// Records may optionally be chained together with HMAC-SHA256, where each record authenticates
+// both itself and the record before it. Removing, reordering or modifying any record within a
+// chained log is then detectable by Verify given the logs key.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Kind string
+
+// Handshakes are recorded through Watch, bans through WatchBans, and key updates through
+// KeyUpdated. Administrative actions are recorded by callers through Record.
+const (
+	KindHandshakeSucceeded Kind = "handshake_succeeded"
+	KindHandshakeFailed    Kind = "handshake_failed"
+	KindKeyChanged         Kind = "key_changed"
+	KindPeerBanned         Kind = "peer_banned"
+	KindAdminAction        Kind = "admin_action"
+)
+
+var ErrTampered = errors.New("audit: log has been tampered with")
+
+// Event is a single record within an audit log.
+type Event struct {
+	Seq    uint64            `json:"seq"`
+	Time   time.Time         `json:"time"`
+	Kind   Kind              `json:"kind"`
+	Peer   string            `json:"peer,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// Prev is the hex-encoded MAC of the previous record, and MAC is the hex-encoded
+	// HMAC-SHA256 of this record. Both are empty should the log not be chained.
+	Prev string `json:"prev,omitempty"`
+	MAC  string `json:"mac,omitempty"`
+}
+
+type Log struct {
+	sync.Mutex
+
+	sinks []Sink
+	key   []byte
+
+	seq  uint64
+	prev string
+}
+
+// New instantiates an audit log which writes records to a set of sinks.
+func New(sinks ...Sink) *Log {
+	return &Log{sinks: sinks}
+}
+
+// WithHMAC chains records together using HMAC-SHA256 under a specified key.
+func (l *Log) WithHMAC(key []byte) *Log {
+	l.key = key
+	return l
+}
+
+// Resume verifies the records previously written to a log, and continues the log from its last
+// record such that the log remains verifiable across restarts.
+func (l *Log) Resume(r io.Reader) error {
+	last, err := Verify(r, l.key)
+	if err != nil {
+		return err
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if last != nil {
+		l.seq, l.prev = last.Seq+1, last.MAC
+	}
+
+	return nil
+}
+
+// Record appends an event to the log, and writes it to all sinks. Fields are optional.
+//
+// It returns the first error any sink failed to write the event with. The event is nonetheless
+// appended to the log should at least one sink have written it.
+func (l *Log) Record(kind Kind, peer string, fields map[string]string) error {
+	l.Lock()
+	defer l.Unlock()
+
+	event := Event{
+		Seq:    l.seq,
+		Time:   time.Now().UTC(),
+		Kind:   kind,
+		Peer:   peer,
+		Fields: fields,
+		Prev:   l.prev,
+	}
+
+	if l.key != nil {
+		mac, err := sign(l.key, event)
+		if err != nil {
+			return err
+		}
+
+		event.MAC = mac
+	}
+
+	record, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "audit: failed to encode event")
+	}
+
+	record = append(record, '\n')
+
+	var first error
+
+	written := 0
+
+	for _, sink := range l.sinks {
+		if err := sink.Write(record); err != nil {
+			if first == nil {
+				first = errors.Wrap(err, "audit: failed to write event to sink")
+			}
+
+			continue
+		}
+
+		written++
+	}
+
+	// Once a record is written to any sink, its sequence number and MAC are taken such that the
+	// sink remains verifiable. Sinks which failed to write the record are left with a gap.
+	if written > 0 || len(l.sinks) == 0 {
+		l.seq++
+		l.prev = event.MAC
+	}
+
+	return first
+}
+
+// Watch records whether or not peers successfully complete a protocol.
+func (l *Log) Watch(p *protocol.Protocol) *Log {
+	p.OnEstablished(func(peer *noise.Peer) {
+		if err := l.Record(KindHandshakeSucceeded, peerAddress(peer), peerFields(peer)); err != nil {
+			log.Error().Err(err).Str("peer", peerAddress(peer)).Msg("Failed to record a successful handshake to the audit log.")
+		}
+	})
+
+	p.OnFailed(func(peer *noise.Peer, err error) {
+		fields := peerFields(peer)
+		fields["error"] = err.Error()
+
+		if err := l.Record(KindHandshakeFailed, peerAddress(peer), fields); err != nil {
+			log.Error().Err(err).Str("peer", peerAddress(peer)).Msg("Failed to record a failed handshake to the audit log.")
+		}
+	})
+
+	return l
+}
+
+// WatchBans records every IP a node bans.
+func (l *Log) WatchBans(node *noise.Node) *Log {
+	node.OnBan(func(node *noise.Node, ip net.IP, until time.Time) error {
+		fields := make(map[string]string)
+
+		if !until.IsZero() {
+			fields["until"] = until.UTC().Format(time.RFC3339)
+		}
+
+		if err := l.Record(KindPeerBanned, ip.String(), fields); err != nil {
+			log.Error().Err(err).Str("ip", ip.String()).Msg("Failed to record a ban to the audit log.")
+		}
+
+		return nil
+	})
+
+	return l
+}
+
+// KeyUpdated records the keys of a session with a peer being rotated. It is meant to be registered
+// as a callback on the AEAD block, as in aead.New().OnKeyUpdate(log.KeyUpdated).
+func (l *Log) KeyUpdated(peer *noise.Peer, local bool) {
+	fields := peerFields(peer)
+
+	fields["requested_by"] = "peer"
+	if local {
+		fields["requested_by"] = "us"
+	}
+
+	if err := l.Record(KindKeyChanged, peerAddress(peer), fields); err != nil {
+		log.Error().Err(err).Str("peer", peerAddress(peer)).Msg("Failed to record a key update to the audit log.")
+	}
+}
+
+// Close closes all of the logs sinks.
+func (l *Log) Close() error {
+	l.Lock()
+	defer l.Unlock()
+
+	var first error
+
+	for _, sink := range l.sinks {
+		if err := sink.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// Verify reads all records from a log, and checks that they are numbered consecutively. Should
+// a key be provided, every records MAC and its chaining to the record before it is checked as
+// well. It returns the last record read, or nil should the log be empty.
+func Verify(r io.Reader, key []byte) (*Event, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+
+	var last *Event
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+
+		if len(line) == 0 {
+			continue
+		}
+
+		var event Event
+
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, errors.Wrap(ErrTampered, "failed to decode record")
+		}
+
+		if last == nil && event.Seq != 0 || last != nil && event.Seq != last.Seq+1 {
+			return nil, errors.Wrapf(ErrTampered, "record %d is out of sequence", event.Seq)
+		}
+
+		if key != nil {
+			prev := ""
+			if last != nil {
+				prev = last.MAC
+			}
+
+			if event.Prev != prev {
+				return nil, errors.Wrapf(ErrTampered, "record %d is not chained to the record before it", event.Seq)
+			}
+
+			mac := event.MAC
+			event.MAC = ""
+
+			expected, err := sign(key, event)
+			if err != nil {
+				return nil, err
+			}
+
+			if !hmac.Equal([]byte(mac), []byte(expected)) {
+				return nil, errors.Wrapf(ErrTampered, "record %d has an invalid mac", event.Seq)
+			}
+
+			event.MAC = mac
+		}
+
+		last = &event
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "audit: failed to read log")
+	}
+
+	return last, nil
+}
+
+func sign(key []byte, event Event) (string, error) {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return "", errors.Wrap(err, "audit: failed to encode event")
+	}
+
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(buf)
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func peerAddress(peer *noise.Peer) string {
+	return net.JoinHostPort(peer.RemoteIP().String(), strconv.FormatUint(uint64(peer.RemotePort()), 10))
+}
+
+func peerFields(peer *noise.Peer) map[string]string {
+	fields := make(map[string]string)
+
+	if id := protocol.PeerID(peer); id != nil {
+		fields["id"] = id.String()
+	}
+
+	// Sessions are recorded such that they may later be matched against what was bound to them.
+	session := protocol.LoadSession(peer)
+
+	if session.HandshakeHash != nil {
+		fields["handshake_hash"] = hex.EncodeToString(session.HandshakeHash)
+	}
+
+	for key, value := range map[string]string{"pattern": session.Pattern, "cipher": session.Cipher, "hash": session.Hash} {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+
+	return fields
+}
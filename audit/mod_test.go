@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"bytes"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+var key = []byte("audit key")
+
+func TestChainedLog(t *testing.T) {
+	var buf bytes.Buffer
+
+	audit := New(NewWriterSink(&buf)).WithHMAC(key)
+
+	assert.NoError(t, audit.Record(KindKeyChanged, "", map[string]string{"public_key": "aa"}))
+	assert.NoError(t, audit.Record(KindPeerBanned, "127.0.0.1:3000", nil))
+	assert.NoError(t, audit.Record(KindAdminAction, "", map[string]string{"action": "reload"}))
+
+	last, err := Verify(bytes.NewReader(buf.Bytes()), key)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, last.Seq)
+	assert.Equal(t, KindAdminAction, last.Kind)
+
+	_, err = Verify(bytes.NewReader(buf.Bytes()), []byte("wrong key"))
+	assert.True(t, errors.Cause(err) == ErrTampered)
+
+	lines := bytes.SplitAfter(buf.Bytes(), []byte("\n"))
+
+	// Modifying a record must be detected.
+	modified := bytes.Replace(buf.Bytes(), []byte("127.0.0.1:3000"), []byte("127.0.0.1:3001"), 1)
+
+	_, err = Verify(bytes.NewReader(modified), key)
+	assert.True(t, errors.Cause(err) == ErrTampered)
+
+	// Removing a record must be detected.
+	removed := append(append([]byte(nil), lines[0]...), lines[2]...)
+
+	_, err = Verify(bytes.NewReader(removed), key)
+	assert.True(t, errors.Cause(err) == ErrTampered)
+
+	// Resuming a log must continue its chain.
+	resumed := New(NewWriterSink(&buf)).WithHMAC(key)
+	assert.NoError(t, resumed.Resume(bytes.NewReader(buf.Bytes())))
+	assert.NoError(t, resumed.Record(KindAdminAction, "", map[string]string{"action": "restart"}))
+
+	last, err = Verify(bytes.NewReader(buf.Bytes()), key)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, last.Seq)
+}
+
+type failSink struct {
+	fail bool
+}
+
+func (s *failSink) Write(record []byte) error {
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+
+	return nil
+}
+
+func (s *failSink) Close() error { return nil }
+
+func TestPartialSinkFailure(t *testing.T) {
+	var buf bytes.Buffer
+
+	failing := &failSink{fail: true}
+	audit := New(failing, NewWriterSink(&buf)).WithHMAC(key)
+
+	// A record written to some sinks must still advance the log, such that no sequence number
+	// is ever reused within the sinks that did write it.
+	assert.Error(t, audit.Record(KindPeerBanned, "127.0.0.1:3000", nil))
+	assert.Error(t, audit.Record(KindPeerBanned, "127.0.0.1:3001", nil))
+
+	last, err := Verify(bytes.NewReader(buf.Bytes()), key)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, last.Seq)
+
+	// A record written to no sink must not advance the log.
+	audit = New(failing).WithHMAC(key)
+
+	assert.Error(t, audit.Record(KindPeerBanned, "127.0.0.1:3000", nil))
+	assert.EqualValues(t, 0, audit.seq)
+
+	failing.fail = false
+
+	assert.NoError(t, audit.Record(KindPeerBanned, "127.0.0.1:3000", nil))
+	assert.EqualValues(t, 1, audit.seq)
+}
+
+type failBlock struct{}
+
+func (failBlock) OnRegister(p *protocol.Protocol, node *noise.Node) {}
+
+func (failBlock) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	return protocol.DisconnectWith(noise.ErrHandshakeFailed)
+}
+
+func (failBlock) OnEnd(p *protocol.Protocol, peer *noise.Peer) error { return nil }
+
+type passBlock struct{}
+
+func (passBlock) OnRegister(p *protocol.Protocol, node *noise.Node) {}
+
+func (passBlock) OnBegin(p *protocol.Protocol, peer *noise.Peer) error { return nil }
+
+func (passBlock) OnEnd(p *protocol.Protocol, peer *noise.Peer) error { return nil }
+
+func TestWatch(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	node := func(block protocol.Block, audit *Log) *noise.Node {
+		params := noise.DefaultParams()
+		params.Transport = layer
+
+		node, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		go node.Listen()
+
+		proto := protocol.New().Register(block)
+		audit.Watch(proto)
+		proto.Enforce(node)
+
+		return node
+	}
+
+	var aliceBuf, bobBuf bytes.Buffer
+
+	aliceLog := New(NewWriterSink(&aliceBuf))
+	bobLog := New(NewWriterSink(&bobBuf))
+
+	alice := node(passBlock{}, aliceLog)
+	defer alice.Kill()
+
+	bob := node(failBlock{}, bobLog)
+	defer bob.Kill()
+
+	_, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+
+	aliceLog.Lock()
+	aliceRecords := aliceBuf.String()
+	aliceLog.Unlock()
+
+	bobLog.Lock()
+	bobRecords := bobBuf.String()
+	bobLog.Unlock()
+
+	assert.Contains(t, aliceRecords, string(KindHandshakeSucceeded))
+	assert.Contains(t, bobRecords, string(KindHandshakeFailed))
+	assert.Contains(t, bobRecords, noise.ErrHandshakeFailed.Error())
+}
+
+func TestWatchBans(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer node.Kill()
+
+	var buf bytes.Buffer
+
+	New(NewWriterSink(&buf)).WithHMAC(key).WatchBans(node)
+
+	node.Ban(net.ParseIP("10.0.0.1"), time.Hour)
+	node.Ban(net.ParseIP("10.0.0.2"), 0)
+
+	last, err := Verify(bytes.NewReader(buf.Bytes()), key)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, last.Seq)
+	assert.Equal(t, KindPeerBanned, last.Kind)
+	assert.Equal(t, "10.0.0.2", last.Peer)
+	assert.Empty(t, last.Fields)
+
+	assert.Contains(t, buf.String(), `"peer":"10.0.0.1"`)
+	assert.Contains(t, buf.String(), `"until"`)
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Sink persists audit records. Each record is a single line of JSON, terminated by a newline.
+// Sinks must only ever append records, and never modify or remove records already written.
+type Sink interface {
+	Write(record []byte) error
+	Close() error
+}
+
+var (
+	_ Sink = (*writerSink)(nil)
+	_ Sink = (*fileSink)(nil)
+)
+
+type writerSink struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// NewWriterSink returns a sink which writes records to an io.Writer, such as os.Stderr.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Write(record []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	_, err := s.w.Write(record)
+	return err
+}
+
+func (s *writerSink) Close() error {
+	if closer, ok := s.w.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+type fileSink struct {
+	sync.Mutex
+	file *os.File
+}
+
+// NewFileSink returns a sink which appends records to a file only accessible by its owner,
+// creating it should it not exist. Each record is flushed to disk before Write returns.
+func NewFileSink(path string) (Sink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "audit: failed to open log file %q", path)
+	}
+
+	return &fileSink{file: file}, nil
+}
+
+func (s *fileSink) Write(record []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, err := s.file.Write(record); err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,285 @@
+package autonat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const keyState = "autonat.state"
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrUnreachable    = errors.New("autonat: address is not reachable")
+	ErrNotEnoughPeers = errors.New("autonat: not enough peers to verify address with")
+)
+
+type block struct {
+	opcodeRequest  noise.Opcode
+	opcodeProbe    noise.Opcode
+	opcodeResponse noise.Opcode
+
+	timeoutDuration time.Duration
+
+	minConfirmations int
+	anyAddress       bool
+}
+
+// New returns a block which has peers dial us back on an address we claim to be reachable at,
+// such that we may verify the address is reachable before advertising it to other peers, such as
+// within a DHT. Every peer which completes the block may in turn ask us to dial it back.
+//
+// A peer dialing us back sends a probe carrying a random nonce over the new connection once it
+// completes our protocol, which proves to us that the address is reachable.
+//
+// By default, dialing a peer back and completing our protocol over the new connection times out
+// after 10 seconds, an address must be verified by at least 3 peers, and peers may only ask us to
+// dial back addresses on the same IP we observe them connecting from, such that we may not be
+// used to dial arbitrary hosts.
+func New() *block {
+	return &block{timeoutDuration: 10 * time.Second, minConfirmations: 3}
+}
+
+func (b *block) TimeoutAfter(timeoutDuration time.Duration) *block {
+	b.timeoutDuration = timeoutDuration
+	return b
+}
+
+// WithMinConfirmations sets how many peers must successfully dial us back for VerifyAddress to
+// consider an address reachable.
+func (b *block) WithMinConfirmations(min int) *block {
+	b.minConfirmations = min
+	return b
+}
+
+// WithoutIPCheck allows for peers to ask us to dial back addresses on IPs other than the one we
+// observe them connecting from. Be warned that our node may then be used to dial arbitrary hosts.
+func (b *block) WithoutIPCheck() *block {
+	b.anyAddress = true
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeRequest = noise.RegisterMessage(noise.NextAvailableOpcode(), (*DialBackRequest)(nil))
+	b.opcodeProbe = noise.RegisterMessage(noise.NextAvailableOpcode(), (*DialBackProbe)(nil))
+	b.opcodeResponse = noise.RegisterMessage(noise.NextAvailableOpcode(), (*DialBackResponse)(nil))
+
+	s := &state{block: b, node: node}
+	node.Set(keyState, s)
+
+	node.OnMessageReceived(b.opcodeRequest, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		node.Go(func(ctx context.Context) error {
+			s.dialBack(peer, message.(DialBackRequest))
+			return nil
+		})
+
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodeProbe, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		// Connections we are dialed back on are not asked to verify our addresses.
+		s.peers.Delete(peer)
+
+		s.resolve(message.(DialBackProbe).Nonce, nil)
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodeResponse, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		// Only a probe proves that an address is reachable, and so successful responses are not
+		// taken at face value.
+		if res := message.(DialBackResponse); res.Error != "" {
+			s.resolve(res.Nonce, errors.Wrap(ErrUnreachable, res.Error))
+		}
+
+		return nil
+	})
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	s := peer.Node().Get(keyState).(*state)
+	s.peers.Store(peer, struct{}{})
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		s.peers.Delete(peer)
+		return nil
+	})
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	s := peer.Node().Get(keyState).(*state)
+	s.peers.Delete(peer)
+
+	return nil
+}
+
+// Verify asks a peer to dial us back on a specified address, and returns an error wrapping
+// ErrUnreachable should the peer be unable to.
+func Verify(node *noise.Node, peer *noise.Peer, address string) error {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return errors.New("autonat: block is not registered to the nodes protocol")
+	}
+
+	return s.verify(peer, address)
+}
+
+// VerifyAddress asks all peers which completed the block to dial us back on a specified address,
+// and returns nil should enough of them succeed.
+func VerifyAddress(node *noise.Node, address string) error {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return errors.New("autonat: block is not registered to the nodes protocol")
+	}
+
+	var peers []*noise.Peer
+
+	s.peers.Range(func(key, value interface{}) bool {
+		peers = append(peers, key.(*noise.Peer))
+		return true
+	})
+
+	if len(peers) < s.block.minConfirmations {
+		return errors.Wrapf(ErrNotEnoughPeers, "have %d peers, but need %d", len(peers), s.block.minConfirmations)
+	}
+
+	results := make(chan error, len(peers))
+
+	for _, peer := range peers {
+		peer := peer
+
+		s.node.Go(func(ctx context.Context) error {
+			results <- s.verify(peer, address)
+			return nil
+		})
+	}
+
+	confirmations := 0
+
+	for range peers {
+		if err := <-results; err == nil {
+			confirmations++
+		}
+	}
+
+	if confirmations < s.block.minConfirmations {
+		return errors.Wrapf(ErrUnreachable, "only %d of %d peers could dial back %s", confirmations, len(peers), address)
+	}
+
+	return nil
+}
+
+type state struct {
+	block *block
+	node  *noise.Node
+
+	// peers holds all peers which completed the block.
+	peers sync.Map
+
+	// pending maps nonces to verifications awaiting a probe or response.
+	pending sync.Map
+
+	// dialing holds all peers we are dialing back, such that a peer may only have one dial back
+	// in flight at a time.
+	dialing sync.Map
+}
+
+func (s *state) verify(peer *noise.Peer, address string) error {
+	var buf [8]byte
+
+	if _, err := rand.Read(buf[:]); err != nil {
+		return errors.Wrap(err, "autonat: failed to generate nonce")
+	}
+
+	nonce := binary.LittleEndian.Uint64(buf[:])
+
+	result := make(chan error, 1)
+
+	s.pending.Store(nonce, result)
+	defer s.pending.Delete(nonce)
+
+	if err := peer.SendMessage(DialBackRequest{Nonce: nonce, Address: address}); err != nil {
+		return errors.Wrap(err, "autonat: failed to send dial-back request")
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-s.node.Clock().After(2 * s.block.timeoutDuration):
+		return errors.Wrap(ErrUnreachable, "timed out waiting for peer to dial us back")
+	}
+}
+
+func (s *state) resolve(nonce uint64, err error) {
+	if result, ok := s.pending.Load(nonce); ok {
+		select {
+		case result.(chan error) <- err:
+		default:
+		}
+	}
+}
+
+func (s *state) dialBack(peer *noise.Peer, req DialBackRequest) {
+	respond := func(err error) {
+		res := DialBackResponse{Nonce: req.Nonce}
+
+		if err != nil {
+			res.Error = err.Error()
+			log.Debug().Err(err).Str("address", req.Address).Msg("Failed to dial back peer.")
+		}
+
+		if err := peer.SendMessage(res); err != nil {
+			log.Warn().Err(err).Msg("Failed to send dial-back response to peer.")
+		}
+	}
+
+	if _, busy := s.dialing.LoadOrStore(peer, struct{}{}); busy {
+		respond(errors.New("a dial back is already in progress"))
+		return
+	}
+	defer s.dialing.Delete(peer)
+
+	host, _, err := net.SplitHostPort(req.Address)
+	if err != nil {
+		respond(errors.Wrap(err, "malformed address"))
+		return
+	}
+
+	if !s.block.anyAddress && !net.ParseIP(host).Equal(peer.RemoteIP()) {
+		respond(errors.Errorf("refusing to dial %s, as it is not on the IP the peer connected from", req.Address))
+		return
+	}
+
+	dialed, err := s.node.Dial(req.Address)
+	if err != nil {
+		respond(errors.Wrap(err, "failed to dial"))
+		return
+	}
+
+	defer func() {
+		s.peers.Delete(dialed)
+		dialed.Disconnect()
+	}()
+
+	select {
+	case err := <-protocol.EnqueueMessage(dialed, DialBackProbe{Nonce: req.Nonce}):
+		if err != nil {
+			respond(errors.Wrap(err, "failed to probe"))
+			return
+		}
+	case <-s.node.Clock().After(s.block.timeoutDuration):
+		respond(errors.New("timed out completing protocol"))
+		return
+	}
+
+	respond(nil)
+}
@@ -0,0 +1,92 @@
+package autonat
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func node(t *testing.T, layer transport.Layer, block *block) *noise.Node {
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	protocol.New().Register(block).Enforce(node)
+
+	go node.Listen()
+
+	return node
+}
+
+func TestVerifyAddress(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewTCP()
+
+	alice := node(t, layer, New().WithMinConfirmations(2).TimeoutAfter(1*time.Second))
+	defer alice.Kill()
+
+	// Not enough peers to verify any address with.
+	assert.True(t, errors.Cause(VerifyAddress(alice, alice.ExternalAddress())) == ErrNotEnoughPeers)
+
+	var peers []*noise.Peer
+
+	for i := 0; i < 2; i++ {
+		other := node(t, layer, New().TimeoutAfter(1*time.Second))
+		defer other.Kill()
+
+		peer, err := alice.Dial(other.ExternalAddress())
+		assert.NoError(t, err)
+		defer peer.Disconnect()
+
+		protocol.WaitUntilEstablished(peer)
+
+		peers = append(peers, peer)
+	}
+
+	// Wait for both peers to have completed the block on their end.
+	time.Sleep(100 * time.Millisecond)
+
+	// Our listening address is reachable.
+	assert.NoError(t, Verify(alice, peers[0], alice.ExternalAddress()))
+	assert.NoError(t, VerifyAddress(alice, alice.ExternalAddress()))
+
+	// Nobody is listening on port 1.
+	assert.True(t, errors.Cause(Verify(alice, peers[0], "127.0.0.1:1")) == ErrUnreachable)
+	assert.True(t, errors.Cause(VerifyAddress(alice, "127.0.0.1:1")) == ErrUnreachable)
+
+	// Peers refuse to dial addresses on IPs other than the one we connect from.
+	assert.True(t, errors.Cause(Verify(alice, peers[0], "127.0.0.2:1")) == ErrUnreachable)
+}
+
+func TestWithoutIPCheck(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewTCP()
+
+	alice := node(t, layer, New().TimeoutAfter(100*time.Millisecond))
+	defer alice.Kill()
+
+	bob := node(t, layer, New().TimeoutAfter(100*time.Millisecond).WithoutIPCheck())
+	defer bob.Kill()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	defer peer.Disconnect()
+
+	protocol.WaitUntilEstablished(peer)
+
+	// Bob attempts to dial the address, which fails rather than being refused outright.
+	err = Verify(alice, peer, "127.0.0.2:1")
+	assert.True(t, errors.Cause(err) == ErrUnreachable)
+	assert.NotContains(t, err.Error(), "refusing")
+}
@@ -0,0 +1,83 @@
+package autonat
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ noise.Message = (*DialBackRequest)(nil)
+	_ noise.Message = (*DialBackProbe)(nil)
+	_ noise.Message = (*DialBackResponse)(nil)
+)
+
+// DialBackRequest asks a peer to dial us back on an address we claim to be reachable at.
+type DialBackRequest struct {
+	Nonce   uint64
+	Address string
+}
+
+func (DialBackRequest) Read(reader payload.Reader) (noise.Message, error) {
+	var msg DialBackRequest
+	var err error
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read dial-back nonce")
+	}
+
+	if msg.Address, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read dial-back address")
+	}
+
+	return msg, nil
+}
+
+func (m DialBackRequest) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).WriteString(m.Address).Bytes()
+}
+
+// DialBackProbe is sent over the connection a peer dialed us back on, proving to us that the
+// address we claimed was in fact reachable.
+type DialBackProbe struct {
+	Nonce uint64
+}
+
+func (DialBackProbe) Read(reader payload.Reader) (noise.Message, error) {
+	nonce, err := reader.ReadUint64()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read dial-back nonce")
+	}
+
+	return DialBackProbe{Nonce: nonce}, nil
+}
+
+func (m DialBackProbe) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).Bytes()
+}
+
+// DialBackResponse reports the outcome of dialing back a peer. Error is empty should the dial
+// back have succeeded, in which case the peer should have already received our probe.
+type DialBackResponse struct {
+	Nonce uint64
+	Error string
+}
+
+func (DialBackResponse) Read(reader payload.Reader) (noise.Message, error) {
+	var msg DialBackResponse
+	var err error
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read dial-back nonce")
+	}
+
+	if msg.Error, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read dial-back error")
+	}
+
+	return msg, nil
+}
+
+func (m DialBackResponse) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).WriteString(m.Error).Bytes()
+}
@@ -0,0 +1,139 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"net"
+	"time"
+)
+
+// Bans are persisted under keyBans followed by the banned IP, with the time the ban lifts in
+// nanoseconds since the Unix epoch as their value. Indefinite bans lift at zero.
+const keyBans = "noise.bans."
+
+// Ban has our node refuse all connections from, and refuse to dial, a specified IP until a
+// duration elapses. A zero duration bans the IP indefinitely. Peers already connected from the IP
+// remain connected, and should be disconnected by the caller. Bans are persisted to the store set
+// through our nodes parameters, should one be set.
+func (n *Node) Ban(ip net.IP, duration time.Duration) {
+	var until time.Time
+
+	if duration > 0 {
+		until = n.clock.Now().Add(duration)
+	}
+
+	n.bans.Store(ip.String(), until)
+	n.persistBan(ip.String(), until)
+
+	if errs := n.onBanCallbacks.RunCallbacks(ip, until); len(errs) > 0 {
+		log.Error().Errs("errors", errs).Msg("Got errors running OnBan callbacks.")
+	}
+}
+
+// Unban lifts a ban placed on an IP.
+func (n *Node) Unban(ip net.IP) {
+	n.bans.Delete(ip.String())
+	n.forgetBan(ip.String())
+}
+
+// IsBanned returns whether or not an IP is presently banned by our node.
+func (n *Node) IsBanned(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	until, ok := n.bans.Load(ip.String())
+	if !ok {
+		return false
+	}
+
+	if until := until.(time.Time); !until.IsZero() && n.clock.Now().After(until) {
+		n.bans.Delete(ip.String())
+		n.forgetBan(ip.String())
+		return false
+	}
+
+	return true
+}
+
+// OnBan registers a callback for whenever our node bans an IP.
+func (n *Node) OnBan(c OnBanCallback) {
+	n.onBanCallbacks.RegisterCallback(func(params ...interface{}) error {
+		if len(params) != 2 {
+			panic(errors.Errorf("noise: OnBan received unexpected args %v", params))
+		}
+
+		return c(n, params[0].(net.IP), params[1].(time.Time))
+	})
+}
+
+// loadBans restores the bans persisted to our nodes store, and deletes the bans which have since
+// lifted.
+func (n *Node) loadBans() error {
+	if n.store == nil {
+		return nil
+	}
+
+	now := n.clock.Now()
+	lifted := n.store.Batch()
+
+	err := n.store.Iterate([]byte(keyBans), func(key, value []byte) error {
+		ip := string(key[len(keyBans):])
+
+		nanos, err := payload.NewReader(value).ReadUint64()
+		if err != nil {
+			return errors.Wrapf(err, "failed to read when the ban on %s lifts", ip)
+		}
+
+		var until time.Time
+
+		if nanos > 0 {
+			until = time.Unix(0, int64(nanos))
+		}
+
+		if !until.IsZero() && now.After(until) {
+			lifted.Delete(key)
+			return nil
+		}
+
+		n.bans.Store(ip, until)
+		return nil
+	})
+
+	if err != nil {
+		return errors.Wrap(err, "failed to load bans from store")
+	}
+
+	return errors.Wrap(lifted.Commit(), "failed to delete lifted bans from store")
+}
+
+func (n *Node) persistBan(ip string, until time.Time) {
+	if n.store == nil {
+		return
+	}
+
+	var nanos uint64
+
+	if !until.IsZero() {
+		nanos = uint64(until.UnixNano())
+	}
+
+	if err := n.store.Put(banKey(ip), payload.NewWriter(nil).WriteUint64(nanos).Bytes()); err != nil {
+		log.Warn().Err(err).Str("ip", ip).Msg("Failed to persist a ban to our nodes store.")
+	}
+}
+
+func (n *Node) forgetBan(ip string) {
+	if n.store == nil {
+		return
+	}
+
+	if err := n.store.Delete(banKey(ip)); err != nil {
+		log.Warn().Err(err).Str("ip", ip).Msg("Failed to delete a ban from our nodes store.")
+	}
+}
+
+func banKey(ip string) []byte {
+	return append([]byte(keyBans), ip...)
+}
@@ -0,0 +1,122 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/kv"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBan(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	refused := make(chan error, 1)
+
+	bob.OnListenerError(func(node *Node, err error) error {
+		refused <- err
+		return nil
+	})
+
+	go alice.Listen()
+	go bob.Listen()
+
+	localhost := net.ParseIP("127.0.0.1")
+
+	// Dialing a banned IP is refused.
+	alice.Ban(localhost, 0)
+	assert.True(t, alice.IsBanned(localhost))
+
+	_, err = alice.Dial(bob.ExternalAddress())
+	assert.True(t, errors.Is(err, ErrPeerBanned))
+
+	alice.Unban(localhost)
+	assert.False(t, alice.IsBanned(localhost))
+
+	// So is accepting connections from a banned IP.
+	bob.Ban(localhost, time.Minute)
+
+	_, err = alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	select {
+	case err := <-refused:
+		assert.True(t, errors.Is(err, ErrPeerBanned))
+
+		var refused RefusedError
+		if assert.True(t, errors.As(err, &refused)) {
+			assert.True(t, refused.IP.Equal(localhost))
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not refuse a connection from a banned IP")
+	}
+
+	// Bans expire.
+	bob.Ban(localhost, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	assert.False(t, bob.IsBanned(localhost))
+}
+
+func TestBanPersisted(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	store := kv.NewMemory()
+	fake := clock.NewFake(time.Now())
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+	params.Store = store
+	params.Clock = fake
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+
+	go alice.Listen()
+
+	forever, lifting, lifted := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3")
+
+	alice.Ban(forever, 0)
+	alice.Ban(lifting, time.Hour)
+	alice.Ban(lifted, time.Minute)
+	alice.Unban(lifted)
+
+	alice.Kill()
+
+	fake.Advance(2 * time.Hour)
+
+	// Bans outlive our node, save for bans which lifted in the meantime.
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+
+	go bob.Listen()
+	defer bob.Kill()
+
+	assert.True(t, bob.IsBanned(forever))
+	assert.False(t, bob.IsBanned(lifting))
+	assert.False(t, bob.IsBanned(lifted))
+
+	count := 0
+
+	assert.NoError(t, store.Iterate(nil, func(key, value []byte) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,29 @@
+package beacon
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// listen listens for datagrams on a UDP port of every interface, sharing the port with other
+// sockets on the same host should the platform support it.
+func listen(port int) (*net.UDPConn, error) {
+	config := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		var err error
+
+		if cerr := c.Control(func(fd uintptr) { err = reusePort(fd) }); cerr != nil {
+			return cerr
+		}
+
+		return err
+	}}
+
+	conn, err := config.ListenPacket(context.Background(), "udp4", ":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.(*net.UDPConn), nil
+}
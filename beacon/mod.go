@@ -0,0 +1,242 @@
+// Package beacon announces nodes to their neighbors over UDP broadcasts, and connects nodes to the
+// neighbors they hear announcements from, such that demos running on a LAN need not be configured
+// with the addresses of one another. Unlike mDNS, announcements are broadcast rather than
+// multicast, such that they reach neighbors on networks which block multicast traffic.
+//
+// Announcements are neither authenticated nor encrypted, and rely on the protocol enforced on
+// connections to authenticate neighbors. Beacons are meant for demos and development, and should
+// not be relied on to discover peers in production.
+package beacon
+
+import (
+	"bytes"
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/pkg/errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPort     = 35353
+	DefaultInterval = 5 * time.Second
+)
+
+// Beacon announces a node on a UDP port, and dials the neighbors it hears announcements from.
+type Beacon struct {
+	sync.Mutex
+
+	network  string
+	port     int
+	interval time.Duration
+
+	broadcast net.IP
+	dialing   bool
+
+	onDiscovered []func(node *noise.Node, address string, publicKey []byte)
+
+	// neighbors holds the peers dialed through the beacon by the public keys of the neighbors they
+	// were dialed for, such that neighbors are only dialed once at a time.
+	neighbors map[string]*noise.Peer
+}
+
+// New returns a beacon which announces our node as a member of a network, and only connects to
+// neighbors announcing themselves as members of the same network, such that demos sharing a LAN do
+// not connect to one another. By default, announcements are broadcast to 255.255.255.255 on port
+// 35353 every 5 seconds.
+func New(network string) *Beacon {
+	return &Beacon{
+		network:   network,
+		port:      DefaultPort,
+		interval:  DefaultInterval,
+		broadcast: net.IPv4bcast,
+		dialing:   true,
+		neighbors: make(map[string]*noise.Peer),
+	}
+}
+
+// WithPort sets the UDP port announcements are broadcast to and listened for on. Every node of a
+// network must use the same port. Several nodes on the same host may share the port, should the
+// platform support SO_REUSEPORT.
+func (b *Beacon) WithPort(port int) *Beacon {
+	b.port = port
+	return b
+}
+
+// WithInterval sets how often our node is announced.
+func (b *Beacon) WithInterval(interval time.Duration) *Beacon {
+	if interval <= 0 {
+		panic("beacon: interval must be positive")
+	}
+
+	b.interval = interval
+	return b
+}
+
+// WithBroadcastAddress sets the address announcements are broadcast to, such as the directed
+// broadcast address of a single subnet.
+func (b *Beacon) WithBroadcastAddress(ip net.IP) *Beacon {
+	b.broadcast = ip
+	return b
+}
+
+// WithoutDialing stops neighbors from being dialed, such that they are only passed to callbacks
+// registered through OnDiscovered.
+func (b *Beacon) WithoutDialing() *Beacon {
+	b.dialing = false
+	return b
+}
+
+// OnDiscovered registers a callback for whenever an announcement is heard from a neighbor of the
+// same network, with the address the neighbor may be connected to at.
+func (b *Beacon) OnDiscovered(fn func(node *noise.Node, address string, publicKey []byte)) *Beacon {
+	b.onDiscovered = append(b.onDiscovered, fn)
+	return b
+}
+
+// Start announces a node, and listens for announcements from its neighbors, until the node is
+// killed. The node must have keys, as neighbors are told apart by their public keys.
+//
+// Neighbors hearing announcements from one another would otherwise dial each other at once, and so
+// only the neighbor whose public key sorts first dials the other.
+func (b *Beacon) Start(node *noise.Node) error {
+	if node.Keys == nil {
+		return errors.New("beacon: node must have keys to be announced by")
+	}
+
+	conn, err := listen(b.port)
+	if err != nil {
+		return errors.Wrapf(err, "beacon: failed to listen for announcements on port %d", b.port)
+	}
+
+	node.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		conn.Close()
+
+		return nil
+	})
+
+	node.Go(func(ctx context.Context) error {
+		b.announce(ctx, node, conn)
+		return nil
+	})
+
+	node.Go(func(ctx context.Context) error {
+		b.listen(ctx, node, conn)
+		return nil
+	})
+
+	return nil
+}
+
+// announce broadcasts an announcement of our node every interval.
+func (b *Beacon) announce(ctx context.Context, node *noise.Node, conn *net.UDPConn) {
+	buf := Announcement{Network: b.network, Port: node.ExternalPort(), PublicKey: node.Keys.PublicKey()}.marshal()
+	addr := &net.UDPAddr{IP: b.broadcast, Port: b.port}
+
+	ticker := node.Clock().NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := conn.WriteToUDP(buf, addr); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("address", addr.String()).Msg("Failed to broadcast an announcement.")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// listen handles announcements heard from neighbors until the connection is closed.
+func (b *Beacon) listen(ctx context.Context, node *noise.Node, conn *net.UDPConn) {
+	buf := make([]byte, maxAnnouncementSize)
+
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warn().Err(err).Msg("Stopped listening for announcements.")
+			}
+
+			return
+		}
+
+		a, err := unmarshal(buf[:n])
+		if err != nil || a.Network != b.network || bytes.Equal(a.PublicKey, node.Keys.PublicKey()) {
+			continue
+		}
+
+		address := net.JoinHostPort(from.IP.String(), strconv.Itoa(int(a.Port)))
+
+		for _, fn := range b.onDiscovered {
+			fn(node, address, a.PublicKey)
+		}
+
+		if b.dialing && bytes.Compare(node.Keys.PublicKey(), a.PublicKey) < 0 {
+			b.dial(node, address, a.PublicKey)
+		}
+	}
+}
+
+// dial dials a neighbor, unless a peer dialed for it is still connected.
+func (b *Beacon) dial(node *noise.Node, address string, publicKey []byte) {
+	key := string(publicKey)
+
+	b.Lock()
+	if _, exists := b.neighbors[key]; exists {
+		b.Unlock()
+		return
+	}
+
+	b.neighbors[key] = nil
+	b.Unlock()
+
+	node.Go(func(ctx context.Context) error {
+		peer, err := node.Dial(address)
+		if err != nil {
+			log.Debug().Err(err).Str("address", address).Msg("Failed to dial a neighbor.")
+
+			b.Lock()
+			delete(b.neighbors, key)
+			b.Unlock()
+
+			return nil
+		}
+
+		b.Lock()
+		b.neighbors[key] = peer
+		b.Unlock()
+
+		peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+			b.Lock()
+			delete(b.neighbors, key)
+			b.Unlock()
+
+			return nil
+		})
+
+		return nil
+	})
+}
+
+// Neighbors returns the peers dialed through the beacon which are still connected.
+func (b *Beacon) Neighbors() []*noise.Peer {
+	b.Lock()
+	defer b.Unlock()
+
+	peers := make([]*noise.Peer, 0, len(b.neighbors))
+
+	for _, peer := range b.neighbors {
+		if peer != nil {
+			peers = append(peers, peer)
+		}
+	}
+
+	return peers
+}
@@ -0,0 +1,100 @@
+package beacon
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/identity/ed25519"
+	"github.com/perlin-network/noise/log"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAnnouncement(t *testing.T) {
+	a := Announcement{Network: "demo", Port: 3000, PublicKey: []byte("alice")}
+
+	decoded, err := unmarshal(a.marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, a, decoded)
+
+	_, err = unmarshal([]byte("hello world"))
+	assert.Error(t, err)
+
+	_, err = unmarshal(a.marshal()[:len(magic)+3])
+	assert.Error(t, err)
+}
+
+func TestBeacon(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	// Pick a UDP port which is free to share amongst our nodes.
+	probe, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+
+	port := probe.LocalAddr().(*net.UDPAddr).Port
+	assert.NoError(t, probe.Close())
+
+	var mu sync.Mutex
+	var discovered []string
+
+	start := func(network string) (*noise.Node, *Beacon) {
+		params := noise.DefaultParams()
+		params.Keys = ed25519.RandomKeys()
+
+		node, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		go node.Listen()
+
+		b := New(network).
+			WithPort(port).
+			WithInterval(50 * time.Millisecond).
+			WithBroadcastAddress(net.IPv4(127, 255, 255, 255)).
+			OnDiscovered(func(node *noise.Node, address string, publicKey []byte) {
+				mu.Lock()
+				discovered = append(discovered, network+" "+address)
+				mu.Unlock()
+			})
+
+		if err := b.Start(node); err != nil {
+			t.Skipf("cannot listen for broadcasts: %v", err)
+		}
+
+		return node, b
+	}
+
+	alice, aliceBeacon := start("demo")
+	defer alice.Kill()
+
+	bob, bobBeacon := start("demo")
+	defer bob.Kill()
+
+	carol, carolBeacon := start("other")
+	defer carol.Kill()
+
+	// Neighbors of the same network are connected to one another exactly once.
+	deadline := time.Now().Add(3 * time.Second)
+
+	for time.Now().Before(deadline) && len(aliceBeacon.Neighbors())+len(bobBeacon.Neighbors()) < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	assert.Equal(t, 1, len(aliceBeacon.Neighbors())+len(bobBeacon.Neighbors()))
+
+	// Neighbors of other networks are neither discovered nor connected to.
+	assert.Empty(t, carolBeacon.Neighbors())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.NotEmpty(t, discovered)
+
+	for _, entry := range discovered {
+		assert.NotEqual(t, "other", entry[:5])
+		assert.NotContains(t, entry, carol.ExternalAddress())
+	}
+}
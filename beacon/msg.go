@@ -0,0 +1,58 @@
+package beacon
+
+import (
+	"bytes"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
+
+// magic prefixes every announcement, such that stray datagrams sent to the port of a beacon are
+// told apart from announcements.
+var magic = []byte("noise-beacon/1")
+
+// maxAnnouncementSize is the size beyond which datagrams are not read in whole, and so may not be
+// announcements.
+const maxAnnouncementSize = 512
+
+// Announcement advertises that a node may be connected to at a port of the host it was broadcast
+// from.
+type Announcement struct {
+	Network   string
+	Port      uint16
+	PublicKey []byte
+}
+
+func (a Announcement) marshal() []byte {
+	writer := payload.NewWriter(append([]byte(nil), magic...))
+
+	writer.WriteString(a.Network)
+	writer.WriteUint16(a.Port)
+	writer.WriteBytes(a.PublicKey)
+
+	return writer.Bytes()
+}
+
+func unmarshal(buf []byte) (Announcement, error) {
+	if !bytes.HasPrefix(buf, magic) {
+		return Announcement{}, errors.New("beacon: datagram is not an announcement")
+	}
+
+	reader := payload.NewReader(buf[len(magic):])
+
+	var a Announcement
+	var err error
+
+	if a.Network, err = reader.ReadString(); err != nil {
+		return Announcement{}, errors.Wrap(err, "beacon: failed to read network")
+	}
+
+	if a.Port, err = reader.ReadUint16(); err != nil {
+		return Announcement{}, errors.Wrap(err, "beacon: failed to read port")
+	}
+
+	if a.PublicKey, err = reader.ReadBytes(); err != nil {
+		return Announcement{}, errors.Wrap(err, "beacon: failed to read public key")
+	}
+
+	return a, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package beacon
+
+// reusePort leaves a socket as is, as ports may not be shared on this platform, such that only a
+// single node per host may listen for announcements.
+func reusePort(fd uintptr) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package beacon
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// reusePort sets SO_REUSEADDR and SO_REUSEPORT on a socket, such that every socket sharing its port
+// receives the broadcasts sent to it.
+func reusePort(fd uintptr) error {
+	if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+		return errors.Wrap(err, "failed to set SO_REUSEADDR")
+	}
+
+	if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+		return errors.Wrap(err, "failed to set SO_REUSEPORT")
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package box seals messages to the static public key of a node, such that they may be routed to
+// the node through peers which may not read them, such as relays along a path through a DHT.
+package box
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/identity"
+	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+	"io"
+)
+
+const boxInfo = "noise sealed box"
+
+// Overhead is the number of bytes sealing a message adds to it.
+const Overhead = edwards25519.PublicKeySize + 16
+
+var ErrInvalidPublicKey = errors.New("box: recipient public key is not a valid ed25519 public key")
+
+// Seal seals a message to the static ed25519 public key of a recipient, under a key derived from a
+// fresh ephemeral keypair. Sealed messages are anonymous: the recipient learns nothing about who
+// sealed a message, and should have the sender sign the message within should it need to know.
+func Seal(recipient, data []byte) ([]byte, error) {
+	if !edwards25519.IsGroupElement(recipient) {
+		return nil, ErrInvalidPublicKey
+	}
+
+	ephemeralPublicKey, ephemeralPrivateKey, err := edwards25519.GenerateKey(nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "box: failed to generate ephemeral keypair")
+	}
+
+	suite, err := newSuite(edwards25519.SharedKey(ephemeralPrivateKey, recipient), ephemeralPublicKey, recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	// As every ephemeral keypair is used once, the nonce is left zeroed.
+	return suite.Seal(append([]byte(nil), ephemeralPublicKey...), make([]byte, suite.NonceSize()), data, nil), nil
+}
+
+// Open opens a message sealed to the public key of a keypair, which must be an ed25519 keypair. It
+// returns an error matching noise.ErrDecryptFailed should the message not have been sealed to the
+// keypair, or should it have been tampered with.
+func Open(keys identity.Keypair, sealed []byte) ([]byte, error) {
+	if keys == nil || len(keys.PrivateKey()) != edwards25519.PrivateKeySize {
+		return nil, errors.New("box: no ed25519 keys to open messages with")
+	}
+
+	if len(sealed) < Overhead {
+		return nil, errors.Wrap(noise.ErrDecryptFailed, "sealed message is too short")
+	}
+
+	ephemeralPublicKey := sealed[:edwards25519.PublicKeySize]
+
+	if !edwards25519.IsGroupElement(ephemeralPublicKey) {
+		return nil, errors.Wrap(noise.ErrDecryptFailed, "sealed message authentication failed")
+	}
+
+	suite, err := newSuite(edwards25519.SharedKey(keys.PrivateKey(), ephemeralPublicKey), ephemeralPublicKey, keys.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := suite.Open(nil, make([]byte, suite.NonceSize()), sealed[edwards25519.PublicKeySize:], nil)
+	if err != nil {
+		return nil, errors.Wrap(noise.ErrDecryptFailed, "sealed message authentication failed")
+	}
+
+	return data, nil
+}
+
+// newSuite derives the key a message is sealed under, salted with both the ephemeral and the
+// recipient public key such that a sealed message may not be re-targeted to another recipient.
+func newSuite(sharedKey, ephemeralPublicKey, recipient []byte) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	salt := append(append([]byte(nil), ephemeralPublicKey...), recipient...)
+
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedKey, salt, []byte(boxInfo)), key); err != nil {
+		return nil, errors.Wrap(err, "box: failed to derive key via HKDF")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "box: failed to create AES block cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,43 @@
+package box
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/identity/ed25519"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	alice, bob := ed25519.RandomKeys(), ed25519.RandomKeys()
+
+	sealed, err := Seal(bob.PublicKey(), []byte("hello"))
+	assert.NoError(t, err)
+	assert.Len(t, sealed, len("hello")+Overhead)
+
+	data, err := Open(bob, sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// Every message is sealed under a fresh ephemeral keypair.
+	again, err := Seal(bob.PublicKey(), []byte("hello"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+
+	// Only the recipient may open a sealed message.
+	_, err = Open(alice, sealed)
+	assert.True(t, errors.Is(err, noise.ErrDecryptFailed))
+
+	// Sealed messages which have been tampered with, or truncated, fail to be opened.
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+
+	_, err = Open(bob, tampered)
+	assert.True(t, errors.Is(err, noise.ErrDecryptFailed))
+
+	_, err = Open(bob, sealed[:Overhead-1])
+	assert.True(t, errors.Is(err, noise.ErrDecryptFailed))
+
+	_, err = Seal([]byte("not a public key"), []byte("hello"))
+	assert.Equal(t, ErrInvalidPublicKey, err)
+}
@@ -1,12 +1,25 @@
 package noise
 
-import "github.com/perlin-network/noise/payload"
+import (
+	"context"
+	"github.com/perlin-network/noise/payload"
+	"net"
+	"time"
+)
 
 type OnErrorCallback func(node *Node, err error) error
 type OnPeerErrorCallback func(node *Node, peer *Peer, err error) error
 type OnPeerDisconnectCallback func(node *Node, peer *Peer) error
 type OnPeerInitCallback func(node *Node, peer *Peer) error
 
+// OnPeerIdleCallback is consulted before an idle peer is disconnected. Returning true keeps the
+// peer connected.
+type OnPeerIdleCallback func(node *Node, peer *Peer) bool
+
+// OnBanCallback is called whenever an IP is banned. until is zero should the IP be banned
+// indefinitely.
+type OnBanCallback func(node *Node, ip net.IP, until time.Time) error
+
 type BeforeMessageSentCallback func(node *Node, peer *Peer, msg []byte) ([]byte, error)
 type BeforeMessageReceivedCallback func(node *Node, peer *Peer, msg []byte) ([]byte, error)
 
@@ -18,4 +31,9 @@ type AfterMessageEncodedCallback func(node *Node, peer *Peer, header, msg []byte
 type OnPeerDecodeHeaderCallback func(node *Node, peer *Peer, reader payload.Reader) error
 type OnPeerDecodeFooterCallback func(node *Node, peer *Peer, msg []byte, reader payload.Reader) error
 
+type OnPeerEncodeExtensionsCallback func(node *Node, peer *Peer, extensions Extensions, msg []byte) (Extensions, error)
+type OnPeerDecodeExtensionsCallback func(node *Node, peer *Peer, extensions Extensions) error
+
 type OnMessageReceivedCallback func(node *Node, opcode Opcode, peer *Peer, message Message) error
+type OnMessageReceivedContextCallback func(ctx context.Context, node *Node, opcode Opcode, peer *Peer, message Message) error
+type OnMessageHandlerTimeoutCallback func(node *Node, opcode Opcode, peer *Peer, timeout time.Duration) error
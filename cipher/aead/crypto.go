@@ -3,13 +3,24 @@ package aead
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/chacha20poly1305"
 	"golang.org/x/crypto/hkdf"
 	"hash"
+	"reflect"
+	"runtime"
+	"strings"
 )
 
-const sharedKeyLength = 32
+const (
+	sharedKeyLength = 32
+
+	networkInfo      = "noise network:"
+	confirmationInfo = "noise aead confirmation"
+)
 
 // deriveCipherSuite derives an AEAD cipher suite given an ephemeral shared key
 // typically produced from a handshake/key exchange protocol.
@@ -29,6 +40,40 @@ func (b *block) deriveCipherSuite(fn func() hash.Hash, ephemeralSharedKey []byte
 	return suite, sharedKey, nil
 }
 
+// networkContext returns the context keys are derived under for peers of a network. Nodes which are
+// not set to a network derive keys under no context.
+func networkContext(networkID string) []byte {
+	if networkID == "" {
+		return nil
+	}
+
+	return append([]byte(networkInfo), networkID...)
+}
+
+// deriveConfirmation derives the confirmation a peer sends in its ACK, which peers of the same
+// network sharing the same ephemeral shared key arrive at. It is a MAC over the role of the peer
+// within the session followed by the features advertised in the ACKs sent so far in
+// initiator/responder order, under a key derived from the shared key solely for confirming it.
+// The confirmations of both peers thus differ, neither reveals anything of the keys messages are
+// sealed under, and features stripped from an ACK on its way to a peer fail to be confirmed.
+func deriveConfirmation(fn func() hash.Hash, sharedKey []byte, initiator bool, advertised ...byte) ([]byte, error) {
+	key, err := deriveKey(fn, sharedKey, confirmationInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to derive confirmation key")
+	}
+
+	role := responderInfo
+	if initiator {
+		role = initiatorInfo
+	}
+
+	mac := hmac.New(fn, key)
+	mac.Write([]byte(role))
+	mac.Write(advertised)
+
+	return mac.Sum(nil), nil
+}
+
 // AEAD via. AES-256 GCM (Galois Counter Mode).
 func AES256_GCM(sharedKey []byte) (cipher.AEAD, error) {
 	block, _ := aes.NewCipher(sharedKey)
@@ -46,3 +91,37 @@ func ChaCha20_Poly1305(sharedKey []byte) (cipher.AEAD, error) {
 func XChaCha20_Poly1305(sharedKey []byte) (cipher.AEAD, error) {
 	return chacha20poly1305.NewX(sharedKey)
 }
+
+var (
+	// suiteNames and hashNames name the cipher suites and hashes provided off-the-shelf, as reported
+	// by `protocol.LoadSession()`.
+	suiteNames = map[uintptr]string{
+		pc(AES256_GCM):         "AES-256-GCM",
+		pc(ChaCha20_Poly1305):  "ChaCha20-Poly1305",
+		pc(XChaCha20_Poly1305): "XChaCha20-Poly1305",
+	}
+
+	hashNames = map[uintptr]string{
+		pc(sha256.New):    "SHA-256",
+		pc(sha512.New384): "SHA-384",
+		pc(sha512.New):    "SHA-512",
+	}
+)
+
+func pc(fn interface{}) uintptr {
+	return reflect.ValueOf(fn).Pointer()
+}
+
+// nameOf returns the name of a cipher suite or hash fn. Fns not provided off-the-shelf are named
+// after the function itself.
+func nameOf(fn interface{}, names map[uintptr]string) string {
+	if name, ok := names[pc(fn)]; ok {
+		return name
+	}
+
+	if f := runtime.FuncForPC(pc(fn)); f != nil {
+		return f.Name()[strings.LastIndex(f.Name(), "/")+1:]
+	}
+
+	return "unknown"
+}
@@ -1,7 +1,11 @@
 package aead
 
 import (
+	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/sha512"
+	"github.com/perlin-network/noise/payload"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"testing/quick"
@@ -22,3 +26,59 @@ func TestDeriveSharedKey(t *testing.T) {
 
 	assert.NoError(t, quick.Check(check, nil))
 }
+
+func TestDeriveConfirmation(t *testing.T) {
+	sharedKey := make([]byte, sharedKeyLength)
+
+	initiator, err := deriveConfirmation(sha256.New, sharedKey, true, features)
+	assert.NoError(t, err)
+
+	responder, err := deriveConfirmation(sha256.New, sharedKey, false, features, features)
+	assert.NoError(t, err)
+
+	// Confirmations of both sides differ, such that neither may be reflected back as the other.
+	assert.NotEqual(t, initiator, responder)
+
+	again, err := deriveConfirmation(sha256.New, sharedKey, true, features)
+	assert.NoError(t, err)
+	assert.Equal(t, initiator, again)
+
+	// Confirmations cover the features advertised by both sides, in initiator/responder order.
+	for _, advertised := range [][]byte{{0}, {features, 0}, {0, features}, {features, featureFlags}} {
+		other, err := deriveConfirmation(sha256.New, sharedKey, len(advertised) == 1, advertised...)
+		assert.NoError(t, err)
+		assert.NotEqual(t, initiator, other)
+		assert.NotEqual(t, responder, other)
+	}
+
+	// Confirmations are not derived under the shared key itself.
+	mac := hmac.New(sha256.New, sharedKey)
+	mac.Write([]byte(confirmationInfo))
+	assert.NotEqual(t, mac.Sum(nil), initiator)
+}
+
+func TestACK(t *testing.T) {
+	// Peers which predate confirmations send empty ACKs.
+	msg, err := ACK{}.Read(payload.NewReader(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ACK{}, msg)
+
+	ack := ACK{Features: features, Confirmation: []byte("confirmation")}
+
+	msg, err = ACK{}.Read(payload.NewReader(ack.Write()))
+	assert.NoError(t, err)
+	assert.Equal(t, ack, msg)
+}
+
+func TestNameOf(t *testing.T) {
+	assert.Equal(t, "AES-256-GCM", nameOf(AES256_GCM, suiteNames))
+	assert.Equal(t, "XChaCha20-Poly1305", nameOf(XChaCha20_Poly1305, suiteNames))
+	assert.Equal(t, "SHA-384", nameOf(sha512.New384, hashNames))
+
+	// Fns not provided off-the-shelf are named after themselves.
+	assert.Equal(t, "aead.customSuite", nameOf(customSuite, suiteNames))
+}
+
+func customSuite(sharedKey []byte) (cipher.AEAD, error) {
+	return AES256_GCM(sharedKey)
+}
@@ -2,34 +2,51 @@ package aead
 
 import (
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/sha256"
-	"encoding/binary"
 	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/fips"
 	"github.com/perlin-network/noise/log"
 	"github.com/perlin-network/noise/protocol"
 	"github.com/pkg/errors"
 	"hash"
-	"sync/atomic"
 	"time"
 )
 
-const keyAuthChannel = "aead.auth.ch"
+const (
+	keyAuthChannel = "aead.auth.ch"
+
+	DefaultMinTagSize = 16
+)
 
 var (
 	_ protocol.Block = (*block)(nil)
+
+	ErrNetworkMismatch = errors.New("aead: peer belongs to a different network")
 )
 
 type block struct {
-	opcodeACK noise.Opcode
+	opcodeACK       noise.Opcode
+	opcodeKeyUpdate noise.Opcode
 
 	ackTimeout time.Duration
+	minTagSize int
+
+	ratchetEvery    uint64
+	ratchetInterval time.Duration
+
+	plaintextInProcess bool
+
+	networkID string
+
+	onKeyUpdate []func(peer *noise.Peer, local bool)
 
 	hash    func() hash.Hash
 	suiteFn func(sharedKey []byte) (cipher.AEAD, error)
 }
 
 func New() *block {
-	return &block{hash: sha256.New, ackTimeout: 3 * time.Second, suiteFn: AES256_GCM}
+	return &block{hash: sha256.New, ackTimeout: 3 * time.Second, minTagSize: DefaultMinTagSize, suiteFn: AES256_GCM}
 }
 
 func (b *block) WithHash(hash func() hash.Hash) *block {
@@ -51,8 +68,81 @@ func (b *block) WithACKTimeout(ackTimeout time.Duration) *block {
 	return b
 }
 
+// WithMinTagSize sets the minimum number of bytes of overhead, which is the size of the authentication
+// tag, that the cipher suite must append to every message sealed. Cipher suites with truncated tags
+// are easier to forge messages against, and so peers are disconnected should the suite derived for
+// them fall short. By default, tags must be at least 16 bytes.
+func (b *block) WithMinTagSize(size int) *block {
+	b.minTagSize = size
+	return b
+}
+
+// WithRatchetEvery ratchets the key which seals messages sent to a peer after every specified number
+// of messages sent. Ratcheting derives a new key from the previous key, and erases the previous key,
+// such that messages sent beforehand may not be decrypted should keys of a long-lived session later
+// leak. Peers ratchet their keys in step with ours, regardless of how they themselves are configured.
+// Keys of sessions with peers which predate ratcheting are never ratcheted. By default, keys are
+// never ratcheted.
+func (b *block) WithRatchetEvery(messages uint64) *block {
+	b.ratchetEvery = messages
+	return b
+}
+
+// WithRatchetInterval ratchets the key which seals messages sent to a peer once a specified amount
+// of time has passed since it was last ratcheted. Keys are ratcheted as messages are sent, such that
+// idle sessions are ratcheted upon the next message sent. By default, keys are never ratcheted.
+func (b *block) WithRatchetInterval(interval time.Duration) *block {
+	b.ratchetInterval = interval
+	return b
+}
+
+// WithoutEncryptionInProcess skips encrypting messages sent to peers living within our process,
+// which are connected to through an in-process transport layer. The handshake and ACK are still
+// performed, such that peers remain authenticated. Every node within the process must opt in, as
+// peers would otherwise be unable to read each others messages. It has no effect in FIPS mode.
+func (b *block) WithoutEncryptionInProcess() *block {
+	b.plaintextInProcess = true
+	return b
+}
+
+// WithNetworkID sets the network our node belongs to, such as a mainnet or a testnet, or the name of
+// an application. The network is mixed into the keys derived for every peer, and peers confirm each
+// others keys before any messages are encrypted, such that peers of different networks are
+// disconnected right away instead of failing to decrypt each others messages. Peers which are not
+// set to a network are only compatible with one another.
+func (b *block) WithNetworkID(networkID string) *block {
+	b.networkID = networkID
+	return b
+}
+
+// OnKeyUpdate registers a callback which is called whenever the keys of a session with a peer are
+// rotated through UpdateKeys. local is set should our node have requested the key update, rather
+// than the peer.
+func (b *block) OnKeyUpdate(fn func(peer *noise.Peer, local bool)) *block {
+	b.onKeyUpdate = append(b.onKeyUpdate, fn)
+	return b
+}
+
 func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
 	b.opcodeACK = noise.RegisterMessage(noise.NextAvailableOpcode(), (*ACK)(nil))
+	b.opcodeKeyUpdate = noise.RegisterMessage(noise.NextAvailableOpcode(), (*KeyUpdate)(nil))
+
+	node.OnMessageReceived(b.opcodeKeyUpdate, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		c, ok := peer.Get(keyChains).(*chains)
+		if !ok || !c.ours.flags || !message.(KeyUpdate).Requested {
+			return nil
+		}
+
+		c.ours.Lock()
+		c.ours.pending = true
+		c.ours.Unlock()
+
+		peer.SendMessageAsync(KeyUpdate{})
+
+		b.keysUpdated(peer, false)
+
+		return nil
+	})
 }
 
 func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
@@ -62,52 +152,168 @@ func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
 		return errors.Wrap(protocol.DisconnectPeer, "session was established, but no ephemeral shared key found")
 	}
 
-	suite, sharedKey, err := b.deriveCipherSuite(b.hash, ephemeralSharedKey, nil)
+	if err := fips.CheckCipher(nameOf(b.suiteFn, suiteNames)); err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "refused to seal messages")
+	}
+
+	if err := fips.CheckHash(nameOf(b.hash, hashNames)); err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "refused to derive keys")
+	}
+
+	suite, sharedKey, err := b.deriveCipherSuite(b.hash, ephemeralSharedKey, networkContext(b.networkID))
 	if err != nil {
-		return errors.Wrap(errors.Wrap(protocol.DisconnectPeer, err.Error()), "failed to derive AEAD cipher suite given ephemeral shared key")
+		return errors.Wrap(protocol.DisconnectWith(err), "failed to derive AEAD cipher suite given ephemeral shared key")
+	}
+
+	if suite.Overhead() < b.minTagSize {
+		return errors.Wrapf(protocol.DisconnectWith(noise.ErrHandshakeFailed), "AEAD cipher suite has a %d byte tag when at least %d bytes are required", suite.Overhead(), b.minTagSize)
 	}
 
 	locker := peer.LockOnReceive(b.opcodeACK)
 	defer locker.Unlock()
 
-	err = peer.SendMessage(ACK{})
-	if err != nil {
-		return errors.Wrap(errors.Wrap(protocol.DisconnectPeer, err.Error()), "failed to send AEAD ACK")
+	// The initiator sends its ACK first, and the responder only replies once it has received it, such
+	// that the confirmation of the responder covers the features advertised by both peers.
+	var ack ACK
+
+	if peer.Dialed() {
+		if err := b.sendACK(peer, sharedKey, true, features); err != nil {
+			return err
+		}
+
+		if ack, err = b.receiveACK(peer, sharedKey, false, features); err != nil {
+			return err
+		}
+	} else {
+		if ack, err = b.receiveACK(peer, sharedKey, true); err != nil {
+			return err
+		}
+
+		if err := b.sendACK(peer, sharedKey, false, ack.Features, features); err != nil {
+			return err
+		}
 	}
 
-	select {
-	case <-time.After(b.ackTimeout):
-		return errors.Wrap(protocol.DisconnectPeer, "timed out waiting for AEAD ACK")
-	case <-peer.Receive(b.opcodeACK):
+	// Messages are always sealed in FIPS mode, as every node within our process is then in FIPS mode
+	// alike.
+	if b.plaintextInProcess && peer.InProcess() && !fips.Enabled() {
+		log.Debug().Msg("Peer lives within our process; skipping AEAD encryption.")
+
+		close(peer.LoadOrStore(keyAuthChannel, make(chan struct{})).(chan struct{}))
+		return nil
+	}
+
+	c, err := newChains(b, peer, sharedKey, ack.Features&features)
+	if err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "failed to derive keys of session")
 	}
 
-	var ourNonce uint64
-	var theirNonce uint64
+	peer.Set(keyChains, c)
 
 	peer.BeforeMessageReceived(func(node *noise.Node, peer *noise.Peer, msg []byte) (buf []byte, err error) {
-		theirNonceBuf := make([]byte, suite.NonceSize())
-		binary.LittleEndian.PutUint64(theirNonceBuf, atomic.AddUint64(&theirNonce, 1))
-
-		return suite.Open(msg[:0], theirNonceBuf, msg, nil)
+		return c.theirs.open(msg)
 	})
 
 	peer.BeforeMessageSent(func(node *noise.Node, peer *noise.Peer, msg []byte) (buf []byte, err error) {
-		ourNonceBuf := make([]byte, suite.NonceSize())
-		binary.LittleEndian.PutUint64(ourNonceBuf, atomic.AddUint64(&ourNonce, 1))
-
-		return suite.Seal(msg[:0], ourNonceBuf, msg, nil), nil
+		return c.ours.seal(msg)
 	})
 
+	protocol.SetSessionCipher(peer, nameOf(b.suiteFn, suiteNames), nameOf(b.hash, hashNames))
+
 	log.Debug().Hex("derived_shared_key", sharedKey).Msg("Derived HMAC, and successfully initialized session w/ AEAD cipher suite.")
 
 	close(peer.LoadOrStore(keyAuthChannel, make(chan struct{})).(chan struct{}))
 	return nil
 }
 
+// sendACK sends our ACK to a peer, confirming the features advertised in the ACKs sent so far in
+// initiator/responder order.
+func (b *block) sendACK(peer *noise.Peer, sharedKey []byte, initiator bool, advertised ...byte) error {
+	confirmation, err := deriveConfirmation(b.hash, sharedKey, initiator, advertised...)
+	if err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "failed to derive AEAD ACK")
+	}
+
+	if err := peer.SendMessage(ACK{Features: features, Confirmation: confirmation}); err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "failed to send AEAD ACK")
+	}
+
+	return nil
+}
+
+// receiveACK waits for the ACK of a peer, and checks that its confirmation covers the features
+// advertised in the ACKs sent before it followed by the features it advertises itself.
+func (b *block) receiveACK(peer *noise.Peer, sharedKey []byte, initiator bool, advertised ...byte) (ACK, error) {
+	var ack ACK
+
+	select {
+	case <-peer.Node().Clock().After(b.ackTimeout):
+		return ack, errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeTimeout), "timed out waiting for AEAD ACK")
+	case msg := <-peer.Receive(b.opcodeACK):
+		ack = msg.(ACK)
+	}
+
+	switch {
+	case len(ack.Confirmation) == 0 && b.networkID != "":
+		return ack, errors.Wrapf(protocol.DisconnectWith(ErrNetworkMismatch), "peer predates networks, and so does not belong to network %q", b.networkID)
+	case len(ack.Confirmation) == 0:
+		// Peers which predate confirmations send empty ACKs, and are only compatible with nodes
+		// which are not set to a network.
+		return ack, nil
+	}
+
+	expected, err := deriveConfirmation(b.hash, sharedKey, initiator, append(advertised, ack.Features)...)
+	if err != nil {
+		return ack, errors.Wrap(protocol.DisconnectWith(err), "failed to derive AEAD ACK")
+	}
+
+	if !hmac.Equal(ack.Confirmation, expected) {
+		return ack, errors.Wrapf(protocol.DisconnectWith(ErrNetworkMismatch), "peer derived different keys than we did under network %q, or the features it advertised were tampered with", b.networkID)
+	}
+
+	return ack, nil
+}
+
 func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
 	return nil
 }
 
+// UpdateKeys rotates the keys of a session with a peer without dropping the connection, as TLS 1.3
+// key updates do. The key which seals messages sent to the peer is ratcheted, and the peer is sent
+// a KeyUpdate message requesting it to ratchet the key which seals messages it sends to us in turn.
+//
+// Keys are switched in step on both sides: the last message sealed under a key is marked, and its
+// receiver ratchets the key it opens messages with right after opening it. Messages in flight while
+// keys are being switched are thus never opened with a stale key.
+func UpdateKeys(peer *noise.Peer) error {
+	c, ok := peer.Get(keyChains).(*chains)
+	if !ok {
+		return errors.New("aead: peer has not completed the block, or messages sent to it are not encrypted")
+	}
+
+	if !c.ours.flags {
+		return errors.New("aead: peer does not support key updates")
+	}
+
+	c.ours.Lock()
+	c.ours.pending = true
+	c.ours.Unlock()
+
+	if err := peer.SendMessage(KeyUpdate{Requested: true}); err != nil {
+		return errors.Wrap(err, "aead: failed to send key update")
+	}
+
+	c.ours.block.keysUpdated(peer, true)
+
+	return nil
+}
+
+func (b *block) keysUpdated(peer *noise.Peer, local bool) {
+	for _, fn := range b.onKeyUpdate {
+		fn(peer, local)
+	}
+}
+
 func WaitUntilAuthenticated(peer *noise.Peer) {
 	<-peer.LoadOrStore(keyAuthChannel, make(chan struct{})).(chan struct{})
 }
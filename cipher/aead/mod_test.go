@@ -1,9 +1,12 @@
 package aead
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/sha512"
 	"encoding/hex"
 	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/clock"
 	"github.com/perlin-network/noise/log"
 	"github.com/perlin-network/noise/protocol"
 	"github.com/perlin-network/noise/transport"
@@ -16,8 +19,12 @@ import (
 var transportLayer = transport.NewBuffered()
 
 func node(t *testing.T) *noise.Node {
+	return nodeWith(t, transportLayer)
+}
+
+func nodeWith(t *testing.T, layer transport.Layer) *noise.Node {
 	params := noise.DefaultParams()
-	params.Transport = transportLayer
+	params.Transport = layer
 
 	params.ReceiveMessageTimeout = 10 * time.Millisecond
 	params.SendMessageTimeout = 10 * time.Millisecond
@@ -132,4 +139,524 @@ func TestBlock_OnBeginSuccessful(t *testing.T) {
 
 	<-aliceReceiver.receiver
 	<-bobReceiver.receiver
+
+	session := protocol.LoadSession(peer)
+	assert.Equal(t, "AES-256-GCM", session.Cipher)
+	assert.Equal(t, "SHA-256", session.Hash)
+}
+
+func TestBlock_NetworkID(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	ephemeralSharedKey, err := hex.DecodeString("d8747263b4d54588c2c8f17862d827dee6d3893a02fb7a84800b001ad4f1cee8")
+	assert.NoError(t, err)
+
+	for _, network := range []string{"mainnet", "testnet", ""} {
+		alice, bob := node(t), node(t)
+
+		disconnected := make(chan struct{}, 2)
+
+		for _, node := range []*noise.Node{alice, bob} {
+			node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+				peer.Set(protocol.KeySharedKey, ephemeralSharedKey)
+				return nil
+			})
+
+			node.OnPeerDisconnected(func(node *noise.Node, peer *noise.Peer) error {
+				disconnected <- struct{}{}
+				return nil
+			})
+		}
+
+		aliceReceiver, bobReceiver := new(receiverBlock), new(receiverBlock)
+
+		protocol.New().Register(New().WithNetworkID("mainnet")).Register(aliceReceiver).Enforce(alice)
+		protocol.New().Register(New().WithNetworkID(network)).Register(bobReceiver).Enforce(bob)
+
+		peer, err := alice.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+
+		// Peers of different networks are disconnected as soon as they exchange ACKs.
+		if network == "mainnet" {
+			<-aliceReceiver.receiver
+			<-bobReceiver.receiver
+		} else {
+			select {
+			case <-disconnected:
+			case <-time.After(1 * time.Second):
+				t.Fatalf("peers of networks mainnet and %q were never disconnected", network)
+			}
+
+			assert.Len(t, aliceReceiver.receiver, 0)
+			assert.Len(t, bobReceiver.receiver, 0)
+		}
+
+		peer.Disconnect()
+		alice.Kill()
+		bob.Kill()
+	}
+}
+
+var _ protocol.Block = (*stripBlock)(nil)
+
+// stripBlock strips the features of the first ACK received off the wire once registered before a
+// block which seals messages, as callbacks before messages are received run in reverse order.
+type stripBlock struct {
+	opcodeACK noise.Opcode
+}
+
+func (b *stripBlock) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeACK, _ = noise.OpcodeFromMessage(ACK{})
+}
+
+func (b *stripBlock) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	stripped := false
+
+	peer.BeforeMessageReceived(func(node *noise.Node, peer *noise.Peer, msg []byte) ([]byte, error) {
+		if !stripped && len(msg) > 1 && noise.Opcode(msg[0]) == b.opcodeACK {
+			stripped = true
+
+			msg = append([]byte(nil), msg...)
+			msg[1] = 0
+		}
+		return msg, nil
+	})
+	return nil
+}
+
+func (b *stripBlock) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+func TestBlock_StrippedFeatures(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	ephemeralSharedKey, err := hex.DecodeString("d8747263b4d54588c2c8f17862d827dee6d3893a02fb7a84800b001ad4f1cee8")
+	assert.NoError(t, err)
+
+	// Features stripped from the ACK of either the dialer or the dialed peer fail to be confirmed,
+	// rather than having both directions of the session sealed under the same key.
+	for _, dialer := range []bool{true, false} {
+		alice, bob := node(t), node(t)
+
+		disconnected := make(chan struct{}, 2)
+
+		for _, node := range []*noise.Node{alice, bob} {
+			node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+				peer.Set(protocol.KeySharedKey, ephemeralSharedKey)
+				return nil
+			})
+
+			node.OnPeerDisconnected(func(node *noise.Node, peer *noise.Peer) error {
+				disconnected <- struct{}{}
+				return nil
+			})
+		}
+
+		aliceReceiver, bobReceiver := new(receiverBlock), new(receiverBlock)
+
+		if dialer {
+			protocol.New().Register(new(stripBlock)).Register(New()).Register(aliceReceiver).Enforce(alice)
+			protocol.New().Register(New()).Register(bobReceiver).Enforce(bob)
+		} else {
+			protocol.New().Register(New()).Register(aliceReceiver).Enforce(alice)
+			protocol.New().Register(new(stripBlock)).Register(New()).Register(bobReceiver).Enforce(bob)
+		}
+
+		peer, err := alice.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+
+		select {
+		case <-disconnected:
+		case <-time.After(1 * time.Second):
+			t.Fatalf("peers were never disconnected despite features being stripped (dialer: %t)", dialer)
+		}
+
+		assert.Len(t, aliceReceiver.receiver, 0)
+		assert.Len(t, bobReceiver.receiver, 0)
+
+		peer.Disconnect()
+		alice.Kill()
+		bob.Kill()
+	}
+}
+
+var _ protocol.Block = (*wireBlock)(nil)
+
+// wireBlock records the sizes of messages received off the wire once registered after a block
+// which seals messages, as callbacks before messages are received run in reverse order.
+type wireBlock struct {
+	sizes chan int
+}
+
+func (b *wireBlock) OnRegister(p *protocol.Protocol, node *noise.Node) {}
+
+func (b *wireBlock) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	peer.BeforeMessageReceived(func(node *noise.Node, peer *noise.Peer, msg []byte) ([]byte, error) {
+		select {
+		case b.sizes <- len(msg):
+		default:
+		}
+		return msg, nil
+	})
+	return nil
+}
+
+func (b *wireBlock) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+func TestBlock_WithoutEncryptionInProcess(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	ephemeralSharedKey, err := hex.DecodeString("d8747263b4d54588c2c8f17862d827dee6d3893a02fb7a84800b001ad4f1cee8")
+	assert.NoError(t, err)
+
+	for _, plaintext := range []bool{false, true} {
+		layer := transport.NewInProcess()
+		alice, bob := nodeWith(t, layer), nodeWith(t, layer)
+
+		for _, node := range []*noise.Node{alice, bob} {
+			node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+				peer.Set(protocol.KeySharedKey, ephemeralSharedKey)
+				return nil
+			})
+		}
+
+		aliceBlock, bobBlock := New(), New()
+		if plaintext {
+			aliceBlock.WithoutEncryptionInProcess()
+			bobBlock.WithoutEncryptionInProcess()
+		}
+
+		aliceReceiver, bobReceiver := new(receiverBlock), new(receiverBlock)
+		wire := &wireBlock{sizes: make(chan int, 16)}
+
+		protocol.New().Register(aliceBlock).Register(aliceReceiver).Enforce(alice)
+		protocol.New().Register(bobBlock).Register(wire).Register(bobReceiver).Enforce(bob)
+
+		peer, err := alice.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+
+		<-aliceReceiver.receiver
+		<-bobReceiver.receiver
+
+		assert.True(t, peer.InProcess())
+
+		for len(wire.sizes) > 0 {
+			<-wire.sizes
+		}
+
+		// Messages are only sealed, and thus carry an authentication tag, should encryption not be
+		// skipped.
+		assert.NoError(t, peer.SendMessage(msg{}))
+
+		select {
+		case size := <-wire.sizes:
+			assert.Equal(t, !plaintext, size >= 16)
+		case <-time.After(1 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+
+		peer.Disconnect()
+		alice.Kill()
+		bob.Kill()
+	}
+}
+
+func TestBlock_MinTagSize(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	ephemeralSharedKey, err := hex.DecodeString("d8747263b4d54588c2c8f17862d827dee6d3893a02fb7a84800b001ad4f1cee8")
+	assert.NoError(t, err)
+
+	truncated := func(sharedKey []byte) (cipher.AEAD, error) {
+		block, err := aes.NewCipher(sharedKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return cipher.NewGCMWithTagSize(block, 12)
+	}
+
+	for _, minTagSize := range []int{DefaultMinTagSize, 12} {
+		alice, bob := node(t), node(t)
+
+		for _, node := range []*noise.Node{alice, bob} {
+			node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+				peer.Set(protocol.KeySharedKey, ephemeralSharedKey)
+				return nil
+			})
+		}
+
+		aliceReceiver, bobReceiver := new(receiverBlock), new(receiverBlock)
+
+		protocol.New().Register(New().WithSuite(truncated).WithMinTagSize(minTagSize)).Register(aliceReceiver).Enforce(alice)
+		protocol.New().Register(New().WithSuite(truncated).WithMinTagSize(minTagSize)).Register(bobReceiver).Enforce(bob)
+
+		peer, err := alice.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+
+		// Suites with tags truncated below the minimum are refused.
+		select {
+		case <-aliceReceiver.receiver:
+			assert.Equal(t, 12, minTagSize)
+		case <-time.After(1 * time.Second):
+			assert.Equal(t, DefaultMinTagSize, minTagSize)
+		}
+
+		peer.Disconnect()
+		alice.Kill()
+		bob.Kill()
+	}
+}
+
+func TestBlock_Ratchet(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	ephemeralSharedKey, err := hex.DecodeString("d8747263b4d54588c2c8f17862d827dee6d3893a02fb7a84800b001ad4f1cee8")
+	assert.NoError(t, err)
+
+	for _, block := range []*block{New().WithRatchetEvery(3), New().WithRatchetInterval(1 * time.Nanosecond)} {
+		alice, bob := node(t), node(t)
+
+		for _, node := range []*noise.Node{alice, bob} {
+			node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+				peer.Set(protocol.KeySharedKey, ephemeralSharedKey)
+				return nil
+			})
+		}
+
+		aliceReceiver, bobReceiver := new(receiverBlock), new(receiverBlock)
+
+		// Bob ratchets in step with alice, despite not being configured to ratchet himself.
+		protocol.New().Register(block).Register(aliceReceiver).Enforce(alice)
+		protocol.New().Register(New()).Register(bobReceiver).Enforce(bob)
+
+		bobPeers := make(chan *noise.Peer, 1)
+
+		bob.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+			bobPeers <- peer
+			return nil
+		})
+
+		peer, err := alice.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+
+		<-aliceReceiver.receiver
+		<-bobReceiver.receiver
+
+		ours := peer.Get(keyChains).(*chains).ours
+		theirs := (<-bobPeers).Get(keyChains).(*chains).theirs
+
+		ours.Lock()
+		previous := ours.key
+		ours.Unlock()
+
+		received := make(chan struct{}, 10)
+
+		bob.OnMessageReceived(bobReceiver.opcodeMsg, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+			received <- struct{}{}
+			return nil
+		})
+
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, peer.SendMessage(msg{}))
+
+			select {
+			case <-received:
+			case <-time.After(1 * time.Second):
+				t.Fatal("bob failed to open a message after alice ratcheted her key")
+			}
+		}
+
+		ours.Lock()
+		theirs.Lock()
+
+		// Keys which were ratcheted away from are erased.
+		assert.Equal(t, make([]byte, len(previous)), previous)
+		assert.NotEqual(t, previous, ours.key)
+		assert.Equal(t, ours.key, theirs.key)
+
+		theirs.Unlock()
+		ours.Unlock()
+
+		peer.Disconnect()
+		alice.Kill()
+		bob.Kill()
+	}
+}
+
+func TestBlock_DirectionalKeys(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	ephemeralSharedKey, err := hex.DecodeString("d8747263b4d54588c2c8f17862d827dee6d3893a02fb7a84800b001ad4f1cee8")
+	assert.NoError(t, err)
+
+	alice, bob := node(t), node(t)
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	for _, node := range []*noise.Node{alice, bob} {
+		node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+			peer.Set(protocol.KeySharedKey, ephemeralSharedKey)
+			return nil
+		})
+	}
+
+	bobPeers := make(chan *noise.Peer, 1)
+
+	bob.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+		bobPeers <- peer
+		return nil
+	})
+
+	aliceReceiver, bobReceiver := new(receiverBlock), new(receiverBlock)
+
+	protocol.New().Register(New()).Register(aliceReceiver).Enforce(alice)
+	protocol.New().Register(New()).Register(bobReceiver).Enforce(bob)
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	defer peer.Disconnect()
+
+	<-aliceReceiver.receiver
+	<-bobReceiver.receiver
+
+	aliceChains := peer.Get(keyChains).(*chains)
+	bobChains := (<-bobPeers).Get(keyChains).(*chains)
+
+	// Messages sent each way are sealed under separate keys, which neither side seals under the
+	// shared key itself.
+	assert.NotEqual(t, aliceChains.ours.key, aliceChains.theirs.key)
+	assert.Equal(t, aliceChains.ours.key, bobChains.theirs.key)
+	assert.Equal(t, aliceChains.theirs.key, bobChains.ours.key)
+
+	assert.True(t, aliceChains.ours.flags)
+	assert.True(t, bobChains.ours.flags)
+}
+
+func TestChainWithoutFlags(t *testing.T) {
+	key, err := hex.DecodeString("d8747263b4d54588c2c8f17862d827dee6d3893a02fb7a84800b001ad4f1cee8")
+	assert.NoError(t, err)
+
+	b := New().WithRatchetEvery(1)
+
+	// Sessions with peers which predate features seal messages as they are, and are never ratcheted.
+	ours, err := newChain(b, clock.New(), key, false)
+	assert.NoError(t, err)
+
+	theirs, err := newChain(b, clock.New(), key, false)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		sealed, err := ours.seal([]byte("hello"))
+		assert.NoError(t, err)
+		assert.Len(t, sealed, len("hello")+ours.suite.Overhead())
+
+		opened, err := theirs.open(sealed)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("hello"), opened)
+	}
+
+	assert.Equal(t, key, ours.key)
+	assert.Equal(t, key, theirs.key)
+}
+
+func TestUpdateKeys(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	ephemeralSharedKey, err := hex.DecodeString("d8747263b4d54588c2c8f17862d827dee6d3893a02fb7a84800b001ad4f1cee8")
+	assert.NoError(t, err)
+
+	alice, bob := node(t), node(t)
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	for _, node := range []*noise.Node{alice, bob} {
+		node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+			peer.Set(protocol.KeySharedKey, ephemeralSharedKey)
+			return nil
+		})
+	}
+
+	bobPeers := make(chan *noise.Peer, 1)
+
+	bob.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+		bobPeers <- peer
+		return nil
+	})
+
+	aliceReceiver, bobReceiver := new(receiverBlock), new(receiverBlock)
+
+	aliceUpdates, bobUpdates := make(chan bool, 1), make(chan bool, 1)
+
+	protocol.New().Register(New().OnKeyUpdate(func(peer *noise.Peer, local bool) { aliceUpdates <- local })).Register(aliceReceiver).Enforce(alice)
+	protocol.New().Register(New().OnKeyUpdate(func(peer *noise.Peer, local bool) { bobUpdates <- local })).Register(bobReceiver).Enforce(bob)
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	defer peer.Disconnect()
+
+	<-aliceReceiver.receiver
+	<-bobReceiver.receiver
+
+	aliceChains := peer.Get(keyChains).(*chains)
+	bobChains := (<-bobPeers).Get(keyChains).(*chains)
+
+	key := func(c *chain) []byte {
+		c.Lock()
+		defer c.Unlock()
+
+		return append([]byte(nil), c.key...)
+	}
+
+	aliceKey, bobKey := key(aliceChains.ours), key(bobChains.ours)
+
+	// Once alice updates her keys, bob updates his in turn, and both open messages with the keys
+	// the other now seals messages with.
+	assert.NoError(t, UpdateKeys(peer))
+
+	for i := 0; i < 100 && string(key(bobChains.ours)) == string(bobKey); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i < 100 && string(key(aliceChains.theirs)) != string(key(bobChains.ours)); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.NotEqual(t, aliceKey, key(aliceChains.ours))
+	assert.NotEqual(t, bobKey, key(bobChains.ours))
+
+	assert.Equal(t, key(aliceChains.ours), key(bobChains.theirs))
+	assert.Equal(t, key(bobChains.ours), key(aliceChains.theirs))
+
+	// Both sides report the key update, and who requested it.
+	assert.True(t, <-aliceUpdates)
+	assert.False(t, <-bobUpdates)
+
+	// Both sides continue to open each others messages.
+	received := make(chan struct{}, 1)
+
+	bob.OnMessageReceived(bobReceiver.opcodeMsg, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		received <- struct{}{}
+		return nil
+	})
+
+	assert.NoError(t, peer.SendMessage(msg{}))
+
+	select {
+	case <-received:
+	case <-time.After(1 * time.Second):
+		t.Fatal("bob failed to open a message after keys were updated")
+	}
 }
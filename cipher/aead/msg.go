@@ -1,5 +1,84 @@
 package aead
 
-import "github.com/perlin-network/noise"
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
 
-type ACK struct{ noise.EmptyMessage }
+var (
+	_ noise.Message = (*ACK)(nil)
+	_ noise.Message = (*KeyUpdate)(nil)
+)
+
+// Features of a session which peers advertise to one another through their ACKs, and which are
+// only used should both peers support them. Peers which predate features send empty ACKs, and so
+// support none of them.
+const (
+	// featureFlags prefixes every message sealed with a byte of flags, which ratcheting and key
+	// updates rely on.
+	featureFlags byte = 1 << iota
+
+	// featureDirectionalKeys seals messages sent by the initiator and by the responder of a session
+	// under separate keys.
+	featureDirectionalKeys
+
+	features = featureFlags | featureDirectionalKeys
+)
+
+// ACK marks the point from which all messages are encrypted. It advertises the features of the
+// session its sender supports, and carries a confirmation derived from the shared key and the
+// network of its sender, such that peers of different networks are caught before any messages are
+// encrypted. Peers which predate features and confirmations send empty ACKs, and ignore the
+// contents of the ACKs they receive.
+type ACK struct {
+	Features     byte
+	Confirmation []byte
+}
+
+func (ACK) Read(reader payload.Reader) (noise.Message, error) {
+	if reader.Len() == 0 {
+		return ACK{}, nil
+	}
+
+	features, err := reader.ReadByte()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read features")
+	}
+
+	confirmation, err := reader.ReadBytes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read key confirmation")
+	}
+
+	return ACK{Features: features, Confirmation: confirmation}, nil
+}
+
+func (m ACK) Write() []byte {
+	return payload.NewWriter(nil).WriteByte(m.Features).WriteBytes(m.Confirmation).Bytes()
+}
+
+// KeyUpdate announces that the key which seals messages sent by its sender has been ratcheted, and
+// optionally requests the receiver to ratchet the key which seals messages it sends in turn.
+type KeyUpdate struct {
+	Requested bool
+}
+
+func (KeyUpdate) Read(reader payload.Reader) (noise.Message, error) {
+	requested, err := reader.ReadByte()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read whether a key update is requested")
+	}
+
+	return KeyUpdate{Requested: requested == 1}, nil
+}
+
+func (m KeyUpdate) Write() []byte {
+	var requested byte
+
+	if m.Requested {
+		requested = 1
+	}
+
+	return payload.NewWriter(nil).WriteByte(requested).Bytes()
+}
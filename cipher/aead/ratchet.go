@@ -0,0 +1,228 @@
+package aead
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/clock"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+	"hash"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	keyChains = "aead.chains"
+
+	ratchetInfo   = "noise aead ratchet"
+	initiatorInfo = "noise aead initiator"
+	responderInfo = "noise aead responder"
+)
+
+// Every message sealed is prefixed with a byte of flags before being sealed, should both peers
+// support featureFlags. flagRatchet marks the last message sealed under a key, such that the
+// receiver ratchets its key right after opening it.
+const (
+	flagRatchet byte = 1 << iota
+)
+
+// chains holds the chains of keys which seal messages sent to, and open messages received from, a
+// single peer.
+type chains struct {
+	ours, theirs *chain
+}
+
+// chain holds the key which seals, or opens, messages flowing in one direction with a peer. Once
+// ratcheted, the key of a chain is derived anew from its previous key, which is then erased, such
+// that messages sealed beforehand may not be opened should the key of the chain later leak.
+type chain struct {
+	sync.Mutex
+
+	block *block
+
+	key   []byte
+	suite cipher.AEAD
+	nonce uint64
+
+	// sealed is the number of messages sealed, and since is when the chain was last ratcheted
+	// according to clock.
+	sealed uint64
+	since  time.Time
+	clock  clock.Clock
+
+	// pending is set to have the chain ratcheted after the next message is sealed.
+	pending bool
+
+	// flags is set should messages be prefixed with flags, without which the chain is never
+	// ratcheted.
+	flags bool
+}
+
+// newChains derives the chains of a session with a peer. Should both peers support
+// featureDirectionalKeys, messages sent by the initiator and by the responder of the session are
+// sealed under separate keys derived from the shared key, such that no key and nonce is ever used
+// to seal two messages. Otherwise, both directions are sealed under the shared key itself.
+func newChains(b *block, peer *noise.Peer, sharedKey []byte, features byte) (*chains, error) {
+	ours, theirs := sharedKey, sharedKey
+
+	if features&featureDirectionalKeys != 0 {
+		initiator, err := deriveKey(b.hash, sharedKey, initiatorInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		responder, err := deriveKey(b.hash, sharedKey, responderInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		ours, theirs = initiator, responder
+		if !peer.Dialed() {
+			ours, theirs = responder, initiator
+		}
+	}
+
+	flags := features&featureFlags != 0
+
+	oursChain, err := newChain(b, peer.Node().Clock(), ours, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	theirsChain, err := newChain(b, peer.Node().Clock(), theirs, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chains{ours: oursChain, theirs: theirsChain}, nil
+}
+
+func newChain(b *block, clock clock.Clock, key []byte, flags bool) (*chain, error) {
+	suite, err := b.suiteFn(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to derive AEAD suite")
+	}
+
+	return &chain{block: b, key: append([]byte(nil), key...), suite: suite, since: clock.Now(), clock: clock, flags: flags}, nil
+}
+
+// deriveKey derives a key the length of a shared key from another key via HKDF under some info.
+func deriveKey(fn func() hash.Hash, key []byte, info string) ([]byte, error) {
+	derived := make([]byte, len(key))
+
+	if _, err := io.ReadFull(hkdf.New(fn, key, nil, []byte(info)), derived); err != nil {
+		return nil, errors.Wrap(err, "failed to derive key via HKDF")
+	}
+
+	return derived, nil
+}
+
+func (c *chain) nextNonce() []byte {
+	c.nonce++
+
+	buf := make([]byte, c.suite.NonceSize())
+	binary.LittleEndian.PutUint64(buf, c.nonce)
+
+	return buf
+}
+
+func (c *chain) ratchet() error {
+	key, err := deriveKey(c.block.hash, c.key, ratchetInfo)
+	if err != nil {
+		return errors.Wrap(err, "failed to ratchet key")
+	}
+
+	suite, err := c.block.suiteFn(key)
+	if err != nil {
+		return errors.Wrap(err, "failed to derive AEAD suite from ratcheted key")
+	}
+
+	for i := range c.key {
+		c.key[i] = 0
+	}
+
+	c.key, c.suite = key, suite
+	c.sealed, c.since, c.pending = 0, c.clock.Now(), false
+
+	return nil
+}
+
+// due reports whether the chain should be ratcheted after the next message is sealed.
+func (c *chain) due() bool {
+	if c.pending {
+		return true
+	}
+
+	if c.block.ratchetEvery > 0 && c.sealed+1 >= c.block.ratchetEvery {
+		return true
+	}
+
+	return c.block.ratchetInterval > 0 && c.clock.Since(c.since) >= c.block.ratchetInterval
+}
+
+func (c *chain) seal(msg []byte) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.flags {
+		return c.suite.Seal(msg[:0], c.nextNonce(), msg, nil), nil
+	}
+
+	var flags byte
+
+	due := c.due()
+	if due {
+		flags |= flagRatchet
+	}
+
+	plaintext := append([]byte{flags}, msg...)
+	buf := c.suite.Seal(plaintext[:0], c.nextNonce(), plaintext, nil)
+
+	c.sealed++
+
+	if due {
+		if err := c.ratchet(); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf, nil
+}
+
+// open opens a message, and ratchets the chain should the message be the last sealed under its
+// key. Messages too short to carry flags and a tag, messages which fail to be authenticated, and
+// messages with unknown flags are rejected with the same error.
+func (c *chain) open(msg []byte) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	nonce := c.nextNonce()
+
+	if !c.flags {
+		buf, err := c.suite.Open(msg[:0], nonce, msg, nil)
+		if err != nil {
+			return nil, errors.Wrap(noise.ErrDecryptFailed, "message authentication failed")
+		}
+
+		return buf, nil
+	}
+
+	if len(msg) < c.suite.Overhead()+1 {
+		return nil, errors.Wrap(noise.ErrDecryptFailed, "message authentication failed")
+	}
+
+	buf, err := c.suite.Open(msg[:0], nonce, msg, nil)
+	if err != nil || buf[0]&^flagRatchet != 0 {
+		return nil, errors.Wrap(noise.ErrDecryptFailed, "message authentication failed")
+	}
+
+	if buf[0]&flagRatchet != 0 {
+		if err := c.ratchet(); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf[1:], nil
+}
@@ -0,0 +1,331 @@
+// Package clock abstracts over the passing of time, such that timeouts, backoff, TTLs, and
+// schedulers may be tested against a fake clock which only moves when told to, rather than by
+// sleeping.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	_ Clock = (*system)(nil)
+	_ Clock = (*Fake)(nil)
+)
+
+// Clock tells the time, and notifies goroutines once durations elapse.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+
+	// After returns a channel which receives the time once a duration elapses.
+	After(d time.Duration) <-chan time.Time
+
+	// Sleep blocks until a duration elapses.
+	Sleep(d time.Duration)
+
+	// AfterFunc calls a function in its own goroutine once a duration elapses.
+	AfterFunc(d time.Duration, f func()) Timer
+
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer mirrors time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker mirrors time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// New returns the system clock.
+func New() Clock {
+	return system{}
+}
+
+type system struct{}
+
+func (system) Now() time.Time {
+	return time.Now()
+}
+
+func (system) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (system) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (system) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (system) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{timer: time.AfterFunc(d, f)}
+}
+
+func (system) NewTimer(d time.Duration) Timer {
+	return systemTimer{timer: time.NewTimer(d)}
+}
+
+func (system) NewTicker(d time.Duration) Ticker {
+	return systemTicker{ticker: time.NewTicker(d)}
+}
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t systemTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+func (t systemTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t systemTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// Fake is a clock which only moves once advanced. Timers and tickers fire, in the order they are
+// due, as the clock is advanced past them. Like those of package time, the channels of timers and
+// tickers are buffered by one, and ticks are dropped should a ticker not be read from in time.
+type Fake struct {
+	sync.Mutex
+	cond *sync.Cond
+
+	now     time.Time
+	waiters []*waiter
+}
+
+// NewFake returns a fake clock set to a given time.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.Mutex)
+
+	return f
+}
+
+type waiter struct {
+	clock *Fake
+
+	until  time.Time
+	period time.Duration
+	c      chan time.Time
+
+	// fn is called in place of a time being sent over c, should the waiter be made by AfterFunc.
+	fn func()
+}
+
+func (f *Fake) Now() time.Time {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	return fakeTimer{f.schedule(d, 0, fn)}
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return fakeTimer{f.schedule(d, 0, nil)}
+}
+
+// NewTicker panics should the period not be positive, as time.NewTicker does.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	return fakeTicker{f.schedule(d, d, nil)}
+}
+
+func (f *Fake) schedule(d, period time.Duration, fn func()) *waiter {
+	f.Lock()
+	defer f.Unlock()
+
+	w := &waiter{clock: f, until: f.now.Add(d), period: period, c: make(chan time.Time, 1), fn: fn}
+
+	// Timers which are due already fire immediately.
+	if d <= 0 && period == 0 {
+		w.fire(f.now)
+		return w
+	}
+
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+
+	return w
+}
+
+// Advance moves the clock forward by a duration, firing every timer and ticker due along the way.
+// Negative durations are ignored, as the clock may not move backwards.
+func (f *Fake) Advance(d time.Duration) {
+	if d < 0 {
+		return
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	target := f.now.Add(d)
+
+	for {
+		sort.SliceStable(f.waiters, func(i, j int) bool {
+			return f.waiters[i].until.Before(f.waiters[j].until)
+		})
+
+		if len(f.waiters) == 0 || f.waiters[0].until.After(target) {
+			break
+		}
+
+		w := f.waiters[0]
+
+		if w.until.After(f.now) {
+			f.now = w.until
+		}
+
+		w.fire(f.now)
+
+		if w.period > 0 {
+			w.until = w.until.Add(w.period)
+		} else {
+			f.remove(w)
+		}
+	}
+
+	f.now = target
+}
+
+// Set moves the clock forward to a time, firing every timer and ticker due along the way. Times
+// before the present time of the clock are ignored.
+func (f *Fake) Set(t time.Time) {
+	f.Advance(t.Sub(f.Now()))
+}
+
+// Waiters returns how many timers and tickers are waiting on the clock.
+func (f *Fake) Waiters() int {
+	f.Lock()
+	defer f.Unlock()
+
+	return len(f.waiters)
+}
+
+// BlockUntil blocks until at least a number of timers and tickers are waiting on the clock, such
+// that tests may wait for a goroutine to start waiting before advancing the clock past its
+// deadline.
+func (f *Fake) BlockUntil(waiters int) {
+	f.Lock()
+	defer f.Unlock()
+
+	for len(f.waiters) < waiters {
+		f.cond.Wait()
+	}
+}
+
+func (f *Fake) remove(w *waiter) bool {
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// fire drops the time should the channel of the waiter be full, as time.Ticker does.
+func (w *waiter) fire(now time.Time) {
+	if w.fn != nil {
+		go w.fn()
+		return
+	}
+
+	select {
+	case w.c <- now:
+	default:
+	}
+}
+
+type fakeTimer struct {
+	*waiter
+}
+
+func (t fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t fakeTimer) Stop() bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+
+	return t.clock.remove(t.waiter)
+}
+
+func (t fakeTimer) Reset(d time.Duration) bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+
+	active := t.clock.remove(t.waiter)
+
+	t.until = t.clock.now.Add(d)
+
+	if d <= 0 {
+		t.fire(t.clock.now)
+		return active
+	}
+
+	t.clock.waiters = append(t.clock.waiters, t.waiter)
+	t.clock.cond.Broadcast()
+
+	return active
+}
+
+type fakeTicker struct {
+	*waiter
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t fakeTicker) Stop() {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+
+	t.clock.remove(t.waiter)
+}
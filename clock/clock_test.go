@@ -0,0 +1,116 @@
+package clock
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFakeTimers(t *testing.T) {
+	start := time.Unix(0, 0)
+	fake := NewFake(start)
+
+	early, late := fake.NewTimer(time.Second), fake.NewTimer(time.Minute)
+	stopped := fake.NewTimer(time.Second)
+
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+	assert.Equal(t, 2, fake.Waiters())
+
+	fake.Advance(30 * time.Second)
+	assert.Equal(t, start.Add(30*time.Second), fake.Now())
+
+	// Timers fire at the time they were due, rather than at the time the clock was advanced to.
+	select {
+	case at := <-early.C():
+		assert.Equal(t, start.Add(time.Second), at)
+	default:
+		t.Fatal("timer did not fire once due")
+	}
+
+	select {
+	case <-late.C():
+		t.Fatal("timer fired before it was due")
+	case <-stopped.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	// Reset timers are due relative to the present time of the clock.
+	assert.True(t, late.Reset(time.Second))
+
+	fake.Advance(time.Second)
+	assert.Equal(t, start.Add(31*time.Second), <-late.C())
+
+	// Timers due already fire immediately, and the clock may not move backwards.
+	<-fake.After(0)
+
+	fake.Advance(-time.Hour)
+	fake.Set(start)
+	assert.Equal(t, start.Add(31*time.Second), fake.Now())
+	assert.Equal(t, 31*time.Second, fake.Since(start))
+}
+
+func TestFakeTicker(t *testing.T) {
+	fake := NewFake(time.Unix(0, 0))
+
+	ticker := fake.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	fake.Advance(time.Second)
+	<-ticker.C()
+
+	// Ticks are dropped should the ticker not be read from in time.
+	fake.Advance(10 * time.Second)
+	<-ticker.C()
+
+	select {
+	case <-ticker.C():
+		t.Fatal("ticker did not drop ticks it was not read from in time for")
+	default:
+	}
+
+	ticker.Stop()
+	assert.Zero(t, fake.Waiters())
+
+	assert.Panics(t, func() { fake.NewTicker(0) })
+}
+
+func TestFakeSleep(t *testing.T) {
+	fake := NewFake(time.Unix(0, 0))
+
+	woke := make(chan struct{})
+	called := make(chan struct{})
+
+	go func() {
+		fake.Sleep(time.Minute)
+		close(woke)
+	}()
+
+	fake.AfterFunc(time.Minute, func() { close(called) })
+
+	// Wait for the sleeping goroutine to start waiting before advancing past its deadline.
+	fake.BlockUntil(2)
+	fake.Advance(time.Minute)
+
+	<-woke
+	<-called
+}
+
+func TestSystem(t *testing.T) {
+	c := New()
+
+	start := c.Now()
+	c.Sleep(time.Millisecond)
+	assert.True(t, c.Since(start) >= time.Millisecond)
+
+	timer := c.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.False(t, timer.Stop())
+
+	ticker := c.NewTicker(time.Millisecond)
+	<-ticker.C()
+	ticker.Stop()
+
+	<-c.After(time.Millisecond)
+}
@@ -0,0 +1,57 @@
+package noise
+
+// DefaultCoalesceSize is how many bytes of messages held back are written to a peer at once by
+// default, should coalescing be enabled.
+const DefaultCoalesceSize = 65536
+
+// MessageClass decides how quick messages of an opcode are written out to peers.
+type MessageClass uint8
+
+const (
+	// ClassControl has messages written out to peers as soon as they are sent, alongside any
+	// messages held back before them. It is the class of every opcode by default.
+	ClassControl MessageClass = iota
+
+	// ClassBulk has messages held back for up to `params.CoalesceDelay`, such that many of them are
+	// written out to a peer at once, trading latency for throughput.
+	ClassBulk
+)
+
+// SetMessageClass sets the class of messages of a specified opcode. Messages of class ClassBulk are
+// only held back should `params.CoalesceDelay` be set.
+//
+// Messages are always written out in the order they were sent, such that a message of class
+// ClassControl flushes every message held back before it. Connections to peers have TCP_NODELAY set
+// should coalescing be enabled, such that messages are not held back any further by the kernel.
+func (n *Node) SetMessageClass(opcode Opcode, class MessageClass) {
+	n.messageClasses.Store(opcode, class)
+}
+
+// MessageClass returns the class of messages of a specified opcode.
+func (n *Node) MessageClass(opcode Opcode) MessageClass {
+	if class, exists := n.messageClasses.Load(opcode); exists {
+		return class.(MessageClass)
+	}
+
+	return ClassControl
+}
+
+// coalesces reports whether a message is of an opcode whose messages are held back.
+func (n *Node) coalesces(message Message) bool {
+	if n.coalesceDelay <= 0 {
+		return false
+	}
+
+	opcode, err := OpcodeFromMessage(message)
+	if err != nil {
+		return false
+	}
+
+	return n.MessageClass(opcode) == ClassBulk
+}
+
+// noDelayConn is implemented by connections whose TCP_NODELAY option may be set, such as
+// `*net.TCPConn`.
+type noDelayConn interface {
+	SetNoDelay(noDelay bool) error
+}
@@ -0,0 +1,145 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingLayer counts the writes made to connections it dials.
+type countingLayer struct {
+	*transport.Buffered
+	writes *uint64
+}
+
+type countingConn struct {
+	net.Conn
+	writes *uint64
+}
+
+func (l countingLayer) Dial(address string) (net.Conn, error) {
+	conn, err := l.Buffered.Dial(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return countingConn{Conn: conn, writes: l.writes}, nil
+}
+
+func (c countingConn) Write(buf []byte) (int, error) {
+	atomic.AddUint64(c.writes, 1)
+	return c.Conn.Write(buf)
+}
+
+func TestCoalescing(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	opcodeBulk := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+	opcodeControl := RegisterMessage(NextAvailableOpcode(), (*otherTestMsg)(nil))
+
+	var writes uint64
+
+	params := DefaultParams()
+	params.Transport = countingLayer{Buffered: transport.NewBuffered(), writes: &writes}
+	params.CoalesceDelay = 1 * time.Second
+	params.SendMessageTimeout = 3 * time.Second
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	assert.Equal(t, ClassControl, alice.MessageClass(opcodeBulk))
+	alice.SetMessageClass(opcodeBulk, ClassBulk)
+	assert.Equal(t, ClassBulk, alice.MessageClass(opcodeBulk))
+
+	go alice.Listen()
+	go bob.Listen()
+
+	var mu sync.Mutex
+	var received []string
+
+	record := func(node *Node, opcode Opcode, peer *Peer, message Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch message := message.(type) {
+		case testMsg:
+			received = append(received, message.Text)
+		case otherTestMsg:
+			received = append(received, "control "+message.Text)
+		}
+
+		return nil
+	}
+
+	bob.OnMessageReceived(opcodeBulk, record)
+	bob.OnMessageReceived(opcodeControl, record)
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	collect := func(n int) []string {
+		deadline := time.Now().Add(3 * time.Second)
+
+		for time.Now().Before(deadline) {
+			mu.Lock()
+			if len(received) >= n {
+				out := append([]string(nil), received...)
+				received = nil
+				mu.Unlock()
+				return out
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatalf("bob did not receive %d messages", n)
+		return nil
+	}
+
+	// Bulk messages are held back, and written at once once the delay elapses.
+	before := atomic.LoadUint64(&writes)
+
+	var results []<-chan error
+	for _, text := range []string{"1", "2", "3", "4"} {
+		results = append(results, peer.SendMessageAsync(testMsg{Text: text}))
+	}
+
+	for _, result := range results {
+		assert.NoError(t, <-result)
+	}
+
+	assert.Equal(t, before+1, atomic.LoadUint64(&writes))
+	assert.Equal(t, []string{"1", "2", "3", "4"}, collect(4))
+
+	// Control messages flush bulk messages held back before them, without waiting out the delay.
+	before = atomic.LoadUint64(&writes)
+
+	results = nil
+	for _, text := range []string{"5", "6"} {
+		results = append(results, peer.SendMessageAsync(testMsg{Text: text}))
+	}
+
+	start := time.Now()
+	assert.NoError(t, peer.SendMessage(otherTestMsg{testMsg{Text: "7"}}))
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	for _, result := range results {
+		assert.NoError(t, <-result)
+	}
+
+	assert.Equal(t, before+1, atomic.LoadUint64(&writes))
+	assert.Equal(t, []string{"5", "6", "control 7"}, collect(3))
+}
@@ -0,0 +1,329 @@
+// Package compress compresses messages sent between peers with DEFLATE under dictionaries shared by
+// both ends ahead of time. Small messages which share much of their shape, such as those of a single
+// protocol, compress far better under a dictionary trained on samples of them than they do on their
+// own.
+//
+// Peers exchange the IDs and hashes of the dictionaries they hold as they complete the block, and
+// only compress messages under dictionaries both ends hold identical copies of.
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	keySession = "compress.session"
+
+	DefaultMaxSize = 1048576
+)
+
+const (
+	// frameRaw prefixes messages sent as is.
+	frameRaw byte = iota
+
+	// frameDictionary prefixes messages compressed under a dictionary, followed by the index of the
+	// dictionary amongst those both peers hold.
+	frameDictionary
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrUnknownDictionary = errors.New("compress: message is compressed under a dictionary which was not negotiated")
+	ErrTooLarge          = errors.New("compress: message decompresses beyond the maximum size")
+)
+
+type dictionary struct {
+	id       string
+	data     []byte
+	hash     [sha256.Size]byte
+	messages []noise.Message
+
+	writers sync.Pool
+	readers sync.Pool
+}
+
+type block struct {
+	opcodeOffer     noise.Opcode
+	timeoutDuration time.Duration
+
+	level   int
+	maxSize int
+
+	dictionaries map[string]*dictionary
+}
+
+// New returns a block which compresses messages under the dictionaries registered via
+// WithDictionary that both ends of a connection hold. Messages without a dictionary are sent as is.
+//
+// The block must be registered before any block which encrypts messages, such that messages are
+// compressed before they are encrypted. By default, messages are compressed with
+// `flate.BestCompression`, as lesser levels do not search dictionaries for matches within small
+// messages. Messages decompressing beyond 1MB are dropped, and peers which do not offer their
+// dictionaries within 10 seconds are disconnected.
+func New() *block {
+	return &block{
+		timeoutDuration: 10 * time.Second,
+		level:           flate.BestCompression,
+		maxSize:         DefaultMaxSize,
+		dictionaries:    make(map[string]*dictionary),
+	}
+}
+
+func (b *block) TimeoutAfter(timeoutDuration time.Duration) *block {
+	b.timeoutDuration = timeoutDuration
+	return b
+}
+
+// WithLevel sets the DEFLATE compression level messages are compressed with.
+func (b *block) WithLevel(level int) *block {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		panic("compress: invalid compression level")
+	}
+
+	b.level = level
+	return b
+}
+
+// WithMaxSize sets the number of bytes beyond which messages received may not decompress to.
+func (b *block) WithMaxSize(size int) *block {
+	if size <= 0 {
+		panic("compress: max size must be positive")
+	}
+
+	b.maxSize = size
+	return b
+}
+
+// WithDictionary registers a dictionary under an ID naming the protocol it is trained for, and has
+// messages of the given types compressed under it. Dictionaries may be trained through Train.
+// Registering a dictionary under the ID of another replaces it.
+//
+// Only the last 32KB of a dictionary is made use of, as DEFLATE refers back at most 32KB.
+func (b *block) WithDictionary(id string, data []byte, messages ...noise.Message) *block {
+	if _, exists := b.dictionaries[id]; !exists && len(b.dictionaries) == math.MaxUint8 {
+		panic("compress: cannot register more than 255 dictionaries")
+	}
+
+	b.dictionaries[id] = &dictionary{id: id, data: data, hash: sha256.Sum256(data), messages: messages}
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeOffer = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Offer)(nil))
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	// Hold off on handling messages after their offer, until we are ready to decompress them.
+	locker := peer.LockOnReceive(b.opcodeOffer)
+	defer locker.Unlock()
+
+	var ours Offer
+
+	for _, d := range b.dictionaries {
+		ours.Dictionaries = append(ours.Dictionaries, Advertisement{ID: d.id, Hash: d.hash})
+	}
+
+	if err := peer.SendMessage(ours); err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "compress: failed to offer our dictionaries")
+	}
+
+	var theirs Offer
+
+	select {
+	case <-peer.Node().Clock().After(b.timeoutDuration):
+		return errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeTimeout), "compress: timed out waiting for peer to offer its dictionaries")
+	case msg := <-peer.Receive(b.opcodeOffer):
+		theirs = msg.(Offer)
+	}
+
+	s, err := b.negotiate(theirs)
+	if err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "compress: failed to negotiate dictionaries")
+	}
+
+	peer.Set(keySession, s)
+
+	peer.BeforeMessageReceived(func(node *noise.Node, peer *noise.Peer, msg []byte) ([]byte, error) {
+		return s.decompress(msg)
+	})
+
+	peer.BeforeMessageSent(func(node *noise.Node, peer *noise.Peer, msg []byte) ([]byte, error) {
+		return s.compress(msg)
+	})
+
+	log.Debug().Strs("dictionaries", s.ids()).Msg("Negotiated dictionaries to compress messages with.")
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// negotiate picks out the dictionaries both we and our peer hold identical copies of, indexed in
+// order of their IDs such that both ends index them alike.
+func (b *block) negotiate(theirs Offer) (*session, error) {
+	held := make(map[string][sha256.Size]byte, len(theirs.Dictionaries))
+
+	for _, d := range theirs.Dictionaries {
+		held[d.ID] = d.Hash
+	}
+
+	s := &session{block: b, opcodes: make(map[noise.Opcode]int)}
+
+	for _, d := range b.dictionaries {
+		if hash, exists := held[d.id]; exists && hash == d.hash {
+			s.dictionaries = append(s.dictionaries, d)
+		}
+	}
+
+	sort.Slice(s.dictionaries, func(i, j int) bool {
+		return s.dictionaries[i].id < s.dictionaries[j].id
+	})
+
+	for i, d := range s.dictionaries {
+		for _, message := range d.messages {
+			opcode, err := noise.OpcodeFromMessage(message)
+			if err != nil {
+				return nil, errors.Wrapf(err, "message compressed under dictionary %q is not registered", d.id)
+			}
+
+			s.opcodes[opcode] = i
+		}
+	}
+
+	return s, nil
+}
+
+// Negotiated returns the IDs of the dictionaries both we and a peer hold, in sorted order. It
+// returns nil should the peer not have completed the block.
+func Negotiated(peer *noise.Peer) []string {
+	s, ok := peer.Get(keySession).(*session)
+	if !ok {
+		return nil
+	}
+
+	return s.ids()
+}
+
+// session compresses messages sent to, and decompresses messages received from, a single peer.
+type session struct {
+	block *block
+
+	dictionaries []*dictionary
+	opcodes      map[noise.Opcode]int
+}
+
+func (s *session) ids() []string {
+	ids := make([]string, 0, len(s.dictionaries))
+
+	for _, d := range s.dictionaries {
+		ids = append(ids, d.id)
+	}
+
+	return ids
+}
+
+// compress compresses a message under the dictionary registered for its opcode. Messages are sent as
+// is should they have no dictionary, or should they not compress to any less bytes.
+func (s *session) compress(msg []byte) ([]byte, error) {
+	raw := append([]byte{frameRaw}, msg...)
+
+	if len(msg) == 0 {
+		return raw, nil
+	}
+
+	index, exists := s.opcodes[noise.Opcode(msg[0])]
+	if !exists {
+		return raw, nil
+	}
+
+	d := s.dictionaries[index]
+
+	var buf bytes.Buffer
+	buf.WriteByte(frameDictionary)
+	buf.WriteByte(byte(index))
+
+	w, ok := d.writers.Get().(*flate.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		var err error
+
+		if w, err = flate.NewWriterDict(&buf, s.block.level, d.data); err != nil {
+			return nil, errors.Wrap(err, "compress: failed to init compressor")
+		}
+	}
+
+	defer d.writers.Put(w)
+
+	if _, err := w.Write(msg); err != nil {
+		return nil, errors.Wrap(err, "compress: failed to compress message")
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "compress: failed to compress message")
+	}
+
+	if buf.Len() >= len(raw) {
+		return raw, nil
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *session) decompress(msg []byte) ([]byte, error) {
+	if len(msg) == 0 {
+		return nil, errors.New("compress: got an empty message")
+	}
+
+	switch msg[0] {
+	case frameRaw:
+		return msg[1:], nil
+	case frameDictionary:
+	default:
+		return nil, errors.Errorf("compress: got a message framed as %d, which is unknown", msg[0])
+	}
+
+	if len(msg) < 2 || int(msg[1]) >= len(s.dictionaries) {
+		return nil, ErrUnknownDictionary
+	}
+
+	d := s.dictionaries[msg[1]]
+	src := bytes.NewReader(msg[2:])
+
+	r, ok := d.readers.Get().(io.ReadCloser)
+	if ok {
+		if err := r.(flate.Resetter).Reset(src, d.data); err != nil {
+			return nil, errors.Wrap(err, "compress: failed to init decompressor")
+		}
+	} else {
+		r = flate.NewReaderDict(src, d.data)
+	}
+
+	defer d.readers.Put(r)
+
+	buf, err := ioutil.ReadAll(io.LimitReader(r, int64(s.block.maxSize)+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "compress: failed to decompress message")
+	}
+
+	if len(buf) > s.block.maxSize {
+		return nil, errors.Wrapf(ErrTooLarge, "message decompresses beyond %d bytes", s.block.maxSize)
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,186 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/cipher/aead"
+	"github.com/perlin-network/noise/handshake/ecdh"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var _ noise.Message = (*record)(nil)
+
+// record is a small message of a fixed shape, as protocols typically send.
+type record struct {
+	JSON string
+}
+
+func (record) Read(reader payload.Reader) (noise.Message, error) {
+	json, err := reader.ReadString()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read record")
+	}
+
+	return record{JSON: json}, nil
+}
+
+func (m record) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.JSON).Bytes()
+}
+
+func sample(i int) []byte {
+	return []byte(fmt.Sprintf(`{"type":"transaction","sender":"%08x","recipient":"%08x","amount":%d,"fee":1}`, i*7919, i*104729, i))
+}
+
+func samples(n int) [][]byte {
+	out := make([][]byte, n)
+	for i := range out {
+		out[i] = sample(i)
+	}
+
+	return out
+}
+
+func TestTrain(t *testing.T) {
+	dictionary := Train(samples(256), 256)
+
+	assert.True(t, len(dictionary) > 0 && len(dictionary) <= 256)
+	assert.Equal(t, dictionary, Train(samples(256), 256))
+
+	assert.True(t, bytes.Contains(dictionary, []byte(`"recipient":"`)))
+
+	assert.True(t, len(Train(samples(256), 1<<20)) <= MaxDictionarySize)
+
+	// Substrings occurring in a single sample only are left out.
+	assert.Empty(t, Train([][]byte{sample(1)}, 256))
+}
+
+func TestCompress(t *testing.T) {
+	opcode := noise.RegisterMessage(noise.NextAvailableOpcode(), (*record)(nil))
+
+	b := New().WithDictionary("transactions", Train(samples(256), 1024), (*record)(nil))
+
+	s, err := b.negotiate(Offer{Dictionaries: []Advertisement{{ID: "transactions", Hash: b.dictionaries["transactions"].hash}}})
+	assert.NoError(t, err)
+
+	msg := append([]byte{byte(opcode)}, record{JSON: string(sample(1000))}.Write()...)
+
+	compressed, err := s.compress(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, frameDictionary, compressed[0])
+
+	// Messages compress far better under a dictionary than they do on their own.
+	var plain bytes.Buffer
+
+	w, err := flate.NewWriter(&plain, flate.DefaultCompression)
+	assert.NoError(t, err)
+	_, err = w.Write(msg)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	assert.True(t, len(compressed) < len(msg)/2, "compressed %d bytes to %d bytes", len(msg), len(compressed))
+	assert.True(t, len(compressed) < plain.Len()/2, "compressed to %d bytes under the dictionary, and %d bytes without", len(compressed), plain.Len())
+
+	for i := 0; i < 3; i++ {
+		decompressed, err := s.decompress(compressed)
+		assert.NoError(t, err)
+		assert.Equal(t, msg, decompressed)
+	}
+
+	// Messages of other types are sent as is.
+	raw, err := s.compress([]byte{0xFF, 1, 2, 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{frameRaw, 0xFF, 1, 2, 3}, raw)
+
+	_, err = s.decompress([]byte{frameDictionary, 1})
+	assert.True(t, errors.Is(err, ErrUnknownDictionary))
+
+	b.WithMaxSize(len(msg) - 1)
+
+	_, err = s.decompress(compressed)
+	assert.True(t, errors.Is(err, ErrTooLarge))
+}
+
+func TestNegotiate(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	opcode := noise.RegisterMessage(noise.NextAvailableOpcode(), (*record)(nil))
+
+	dictionary := Train(samples(256), 1024)
+
+	dial := func(ours, theirs *block) (*noise.Node, *noise.Node, *noise.Peer, chan record) {
+		layer := transport.NewBuffered()
+
+		params := noise.DefaultParams()
+		params.Transport = layer
+
+		alice, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		bob, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		// Messages are compressed before they are encrypted.
+		protocol.New().Register(ecdh.New()).Register(ours).Register(aead.New()).Enforce(alice)
+		protocol.New().Register(ecdh.New()).Register(theirs).Register(aead.New()).Enforce(bob)
+
+		received := make(chan record, 16)
+
+		bob.OnMessageReceived(opcode, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+			received <- message.(record)
+			return nil
+		})
+
+		go alice.Listen()
+		go bob.Listen()
+
+		peer, err := alice.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+		assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+		return alice, bob, peer, received
+	}
+
+	check := func(peer *noise.Peer, received chan record) {
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, peer.SendMessage(record{JSON: string(sample(i))}))
+
+			select {
+			case msg := <-received:
+				assert.Equal(t, string(sample(i)), msg.JSON)
+			case <-time.After(3 * time.Second):
+				t.Fatal("did not receive the record sent")
+			}
+		}
+	}
+
+	alice, bob, peer, received := dial(
+		New().WithDictionary("transactions", dictionary, (*record)(nil)).WithDictionary("blocks", []byte("ours")),
+		New().WithDictionary("transactions", dictionary, (*record)(nil)).WithDictionary("blocks", []byte("theirs")),
+	)
+
+	// Dictionaries whose contents differ are not negotiated.
+	assert.Equal(t, []string{"transactions"}, Negotiated(peer))
+	check(peer, received)
+
+	alice.Kill()
+	bob.Kill()
+
+	// Peers without any dictionary in common still talk to one another.
+	alice, bob, peer, received = dial(New().WithDictionary("transactions", dictionary, (*record)(nil)), New())
+	defer alice.Kill()
+	defer bob.Kill()
+
+	assert.Empty(t, Negotiated(peer))
+	check(peer, received)
+}
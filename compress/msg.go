@@ -0,0 +1,67 @@
+package compress
+
+import (
+	"crypto/sha256"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"math"
+)
+
+var _ noise.Message = (*Offer)(nil)
+
+// Offer lists the dictionaries its sender holds, by their IDs alongside the SHA-256 hashes of their
+// contents.
+type Offer struct {
+	Dictionaries []Advertisement
+}
+
+// Advertisement advertises a dictionary held by the sender of an offer.
+type Advertisement struct {
+	ID   string
+	Hash [sha256.Size]byte
+}
+
+func (Offer) Read(reader payload.Reader) (noise.Message, error) {
+	count, err := reader.ReadByte()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read number of dictionaries")
+	}
+
+	offer := Offer{Dictionaries: make([]Advertisement, count)}
+
+	for i := range offer.Dictionaries {
+		id, err := reader.ReadString()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read dictionary id")
+		}
+
+		hash, err := reader.ReadBytes()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read dictionary hash")
+		}
+
+		if len(hash) != sha256.Size {
+			return nil, errors.Errorf("expected dictionary hash to be %d bytes, but got %d bytes", sha256.Size, len(hash))
+		}
+
+		offer.Dictionaries[i].ID = id
+		copy(offer.Dictionaries[i].Hash[:], hash)
+	}
+
+	return offer, nil
+}
+
+func (m Offer) Write() []byte {
+	if len(m.Dictionaries) > math.MaxUint8 {
+		panic("compress: cannot offer more than 255 dictionaries")
+	}
+
+	writer := payload.NewWriter(nil).WriteByte(byte(len(m.Dictionaries)))
+
+	for _, dictionary := range m.Dictionaries {
+		writer.WriteString(dictionary.ID).WriteBytes(dictionary.Hash[:])
+	}
+
+	return writer.Bytes()
+}
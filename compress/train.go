@@ -0,0 +1,163 @@
+package compress
+
+import (
+	"bytes"
+	"sort"
+)
+
+const (
+	// MaxDictionarySize is the number of bytes DEFLATE refers back at most, beyond which dictionaries
+	// are of no use.
+	MaxDictionarySize = 32768
+
+	// segmentSize is the length of the substrings of samples that Train counts the occurrences of.
+	segmentSize = 8
+)
+
+// Train trains a dictionary of at most size bytes out of samples of the messages it is to compress,
+// such as messages captured off of a running network.
+//
+// Short substrings which recur across the most samples are picked out first, and are stretched for
+// as long as most samples holding them hold the stretched substring too, such that bytes varying
+// from sample to sample are left out. Substrings picked out first are placed towards the end of the
+// dictionary, where DEFLATE refers back to them the quickest. Training is deterministic, such that
+// nodes training off of the same samples end up with identical dictionaries.
+func Train(samples [][]byte, size int) []byte {
+	if size > MaxDictionarySize {
+		size = MaxDictionarySize
+	}
+
+	counts := make(map[string]int)
+
+	for _, sample := range samples {
+		seen := make(map[string]struct{})
+
+		for i := 0; i+segmentSize <= len(sample); i++ {
+			segment := string(sample[i : i+segmentSize])
+			if _, exists := seen[segment]; exists {
+				continue
+			}
+
+			seen[segment] = struct{}{}
+			counts[segment]++
+		}
+	}
+
+	// Segments are worth picking out should they recur across at least a sixteenth of all samples.
+	threshold := len(samples) / 16
+	if threshold < 2 {
+		threshold = 2
+	}
+
+	segments := make([]string, 0, len(counts))
+
+	for segment, count := range counts {
+		if count >= threshold {
+			segments = append(segments, segment)
+		}
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		if counts[segments[i]] != counts[segments[j]] {
+			return counts[segments[i]] > counts[segments[j]]
+		}
+
+		return segments[i] < segments[j]
+	})
+
+	var picked [][]byte
+	var total int
+
+	for _, segment := range segments {
+		if total >= size {
+			break
+		}
+
+		if covered(picked, []byte(segment)) {
+			continue
+		}
+
+		run := stretch(samples, []byte(segment), counts[segment]*3/4)
+
+		picked = append(picked, run)
+		total += len(run)
+	}
+
+	dictionary := make([]byte, 0, total)
+
+	for i := len(picked) - 1; i >= 0; i-- {
+		dictionary = append(dictionary, picked[i]...)
+	}
+
+	if len(dictionary) > size {
+		dictionary = dictionary[len(dictionary)-size:]
+	}
+
+	return dictionary
+}
+
+// stretch extends a substring a byte at a time to its right and then to its left, for as long as
+// at least a number of samples hold the extended substring.
+func stretch(samples [][]byte, run []byte, threshold int) []byte {
+	for _, right := range []bool{true, false} {
+		for {
+			var tally [256]int
+
+			for _, sample := range samples {
+				var seen [256]bool
+
+				for offset := 0; ; {
+					i := bytes.Index(sample[offset:], run)
+					if i < 0 {
+						break
+					}
+
+					i += offset
+					offset = i + 1
+
+					j := i - 1
+					if right {
+						j = i + len(run)
+					}
+
+					if j < 0 || j >= len(sample) || seen[sample[j]] {
+						continue
+					}
+
+					seen[sample[j]] = true
+					tally[sample[j]]++
+				}
+			}
+
+			next := 0
+			for b := range tally {
+				if tally[b] > tally[next] {
+					next = b
+				}
+			}
+
+			if tally[next] < threshold || tally[next] == 0 {
+				break
+			}
+
+			if right {
+				run = append(run, byte(next))
+			} else {
+				run = append([]byte{byte(next)}, run...)
+			}
+		}
+	}
+
+	return run
+}
+
+// covered reports whether a substring is held by any run picked so far.
+func covered(picked [][]byte, segment []byte) bool {
+	for _, p := range picked {
+		if bytes.Contains(p, segment) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,347 @@
+// Package conformance describes the wire protocol spoken by nodes running the ECDH handshake and
+// AEAD blocks in a machine-readable spec, and serves a node against which implementations of Noise
+// written in other languages may verify that they are compatible byte for byte.
+//
+// The spec lays out how frames are delimited, how handshakes are signed and hashed, the labels keys
+// are derived under, and transcripts of sessions derived from fixed seeds, such that every value an
+// implementation derives may be checked in isolation before connecting to a live node.
+package conformance
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/cipher/aead"
+	"github.com/perlin-network/noise/handshake/ecdh"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+)
+
+// SpecVersion is the version of the spec, which is bumped whenever the wire protocol it describes
+// changes.
+const SpecVersion = 4
+
+// The labels keys are derived under, which must be kept in step with those of the ECDH and AEAD
+// blocks and of protocol.ExportKeyingMaterial.
+const (
+	LabelAddressBinding = "noise ecdh address binding"
+	LabelNetwork        = "noise network:"
+	LabelConfirmation   = "noise aead confirmation"
+	LabelRatchet        = "noise aead ratchet"
+	LabelInitiator      = "noise aead initiator"
+	LabelResponder      = "noise aead responder"
+	LabelExporter       = "noise exporter "
+)
+
+const (
+	sessionKeySize = 32
+
+	// flagRatchet marks the last message sealed under a key.
+	flagRatchet byte = 1
+
+	// featureFlags and featureDirectionalKeys are the features of a session advertised in ACKs.
+	featureFlags           byte = 1
+	featureDirectionalKeys byte = 2
+
+	// features are every feature advertised by a conformance server.
+	features = featureFlags | featureDirectionalKeys
+)
+
+// Opcodes are the opcodes of every message a conformance server may send or receive.
+type Opcodes struct {
+	Handshake      noise.Opcode `json:"handshake"`
+	ACK            noise.Opcode `json:"ack"`
+	KeyUpdate      noise.Opcode `json:"key_update"`
+	Echo           noise.Opcode `json:"echo"`
+	ExportRequest  noise.Opcode `json:"export_request"`
+	ExportResponse noise.Opcode `json:"export_response"`
+	Disconnect     noise.Opcode `json:"disconnect"`
+}
+
+// DefaultOpcodes are the opcodes of a conformance server which registers no messages but its own.
+// Opcodes are assigned in the order messages are registered, and so a server whose node registers
+// other messages beforehand reports different opcodes through `Spec()`.
+var DefaultOpcodes = Opcodes{
+	Handshake:      1,
+	ACK:            2,
+	KeyUpdate:      3,
+	Echo:           4,
+	ExportRequest:  5,
+	ExportResponse: 6,
+	Disconnect:     noise.OpcodeDisconnect,
+}
+
+// Spec is a machine-readable description of the wire protocol, meant to be serialized as JSON.
+type Spec struct {
+	Version int `json:"version"`
+
+	Frame     FrameSpec     `json:"frame"`
+	Opcodes   Opcodes       `json:"opcodes"`
+	Handshake HandshakeSpec `json:"handshake"`
+	Session   SessionSpec   `json:"session"`
+
+	Transcripts []Transcript `json:"transcripts"`
+}
+
+// FrameSpec describes how messages are delimited and laid out.
+type FrameSpec struct {
+	LengthPrefix string `json:"length_prefix"`
+	MaxSize      uint64 `json:"max_size"`
+	Heartbeat    string `json:"heartbeat"`
+	Layout       string `json:"layout"`
+	Integers     string `json:"integers"`
+	Bytes        string `json:"bytes"`
+}
+
+// HandshakeSpec describes the ECDH handshake.
+type HandshakeSpec struct {
+	Curve     string `json:"curve"`
+	Message   string `json:"message"`
+	Layout    string `json:"layout"`
+	Signature string `json:"signature"`
+	Endpoints string `json:"endpoints"`
+	SharedKey string `json:"shared_key"`
+	Hash      string `json:"hash"`
+	Binding   string `json:"binding"`
+}
+
+// SessionSpec describes how the keys of a session are derived, and how messages are sealed.
+type SessionSpec struct {
+	KDF          string `json:"kdf"`
+	Suite        string `json:"suite"`
+	KeySize      int    `json:"key_size"`
+	Key          string `json:"key"`
+	Keys         string `json:"keys"`
+	Confirmation string `json:"confirmation"`
+	ACK          string `json:"ack"`
+	Nonce        string `json:"nonce"`
+	Plaintext    string `json:"plaintext"`
+	Ratchet      string `json:"ratchet"`
+	Exporter     string `json:"exporter"`
+
+	Labels   map[string]string `json:"labels"`
+	Flags    map[string]byte   `json:"flags"`
+	Features map[string]byte   `json:"features"`
+}
+
+// DefaultSpec returns the spec of a conformance server which is set to no network, and registers no
+// messages but its own.
+func DefaultSpec() (Spec, error) {
+	return newSpec(DefaultOpcodes, "")
+}
+
+func newSpec(opcodes Opcodes, networkID string) (Spec, error) {
+	spec := Spec{
+		Version: SpecVersion,
+		Frame: FrameSpec{
+			LengthPrefix: "unsigned LEB128 varint of the length of the frame",
+			MaxSize:      noise.DefaultParams().MaxMessageSize,
+			Heartbeat:    "a frame of length zero, which carries no message",
+			Layout:       "[header][opcode: u8][contents][footer], with no header nor footer unless configured",
+			Integers:     "little-endian",
+			Bytes:        "[length: u32][bytes]",
+		},
+		Opcodes: opcodes,
+		Handshake: HandshakeSpec{
+			Curve:     "edwards25519, with a fresh ephemeral key pair per session",
+			Message:   ecdh.DefaultHandshakeMessage,
+			Layout:    "[public key: bytes][signature: bytes][endpoints: bytes], sent by both sides without waiting on one another. Endpoints are left out by sides which opt out of binding addresses, which both sides must do alike",
+			Signature: "ed25519 signature of the handshake message under the ephemeral key",
+			Endpoints: "our end of the connection followed by the end of our peer as we see them, each a 16-byte IP with IPv4 addresses mapped into IPv6 followed by a big-endian u16 port. The handshake fails should the endpoints of our peer not mirror ours",
+			SharedKey: "the encoding of the public key of the peer multiplied by the clamped ed25519 scalar of our ephemeral key",
+			Hash:      "sha256(message || min(ours, theirs) || max(ours, theirs)), over the contents of both handshake messages ordered bytewise",
+			Binding:   "hmac-sha256(key: sha256(address binding label || hash || min(local, remote) || max(local, remote)), message: shared key), over both endpoints we sent ordered bytewise, which replaces the shared key from here on should both sides bind addresses",
+		},
+		Session: SessionSpec{
+			KDF:          "hkdf-sha256",
+			Suite:        "aes-256-gcm",
+			KeySize:      sessionKeySize,
+			Key:          "hkdf(ikm: shared key, salt: none, info: network label || network id, or none should no network be set)",
+			Keys:         "messages sent by the dialer are sealed under hkdf(ikm: session key, salt: none, info: initiator label), and messages sent by the listener under hkdf(ikm: session key, salt: none, info: responder label), should both sides advertise directional keys",
+			Confirmation: "hmac-sha256(key: hkdf(ikm: session key, salt: none, info: confirmation label), message: initiator label || features of the dialer for the dialer, or responder label || features of the dialer || features of the listener for the listener)",
+			ACK:          "[features: u8][confirmation: bytes], sent unencrypted first by the dialer, and then by the listener once it has received the ACK of the dialer, after which every message is sealed. Features are only used should both sides advertise them. Each side checks the confirmation of the other side against the features advertised in both ACKs",
+			Nonce:        "a counter per direction starting at 1, encoded as a little-endian u64 padded with zeroes to 12 bytes, which is not reset by ratchets",
+			Plaintext:    "[flags: u8][opcode: u8][contents], or [opcode: u8][contents] should either side not advertise flags",
+			Ratchet:      "hkdf(ikm: key, salt: none, info: ratchet label), applied right after sealing, or opening, a message flagged ratchet",
+			Exporter:     "hkdf(ikm: shared key, salt: handshake hash, info: exporter label || label)",
+			Labels: map[string]string{
+				"address_binding": LabelAddressBinding,
+				"network":         LabelNetwork,
+				"confirmation":    LabelConfirmation,
+				"ratchet":         LabelRatchet,
+				"initiator":       LabelInitiator,
+				"responder":       LabelResponder,
+				"exporter":        LabelExporter,
+			},
+			Flags: map[string]byte{
+				"ratchet": flagRatchet,
+			},
+			Features: map[string]byte{
+				"flags":            featureFlags,
+				"directional_keys": featureDirectionalKeys,
+			},
+		},
+	}
+
+	// Transcripts under the network of the server, and under a network set explicitly, such that
+	// both ways keys may be derived are covered.
+	transcripts := []struct {
+		name             string
+		networkID        string
+		dialer, listener byte
+	}{
+		{name: "network of the server", networkID: networkID, dialer: 1, listener: 2},
+		{name: "explicit network", networkID: "conformance", dialer: 3, listener: 4},
+	}
+
+	for _, t := range transcripts {
+		transcript, err := newTranscript(opcodes, t.name, t.networkID, filled(t.dialer), filled(t.listener))
+		if err != nil {
+			return spec, err
+		}
+
+		spec.Transcripts = append(spec.Transcripts, transcript)
+	}
+
+	return spec, nil
+}
+
+func filled(b byte) []byte {
+	seed := make([]byte, 32)
+
+	for i := range seed {
+		seed[i] = b
+	}
+
+	return seed
+}
+
+var (
+	_ noise.Message = (*Echo)(nil)
+	_ noise.Message = (*ExportRequest)(nil)
+	_ noise.Message = (*ExportResponse)(nil)
+)
+
+// Echo is sent back as is by a conformance server.
+type Echo struct {
+	Payload []byte
+}
+
+func (Echo) Read(reader payload.Reader) (noise.Message, error) {
+	buf, err := reader.ReadBytes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read echo payload")
+	}
+
+	return Echo{Payload: buf}, nil
+}
+
+func (m Echo) Write() []byte {
+	return payload.NewWriter(nil).WriteBytes(m.Payload).Bytes()
+}
+
+// ExportRequest asks a conformance server for keying material exported from its session under a
+// label, which it responds to with an ExportResponse.
+type ExportRequest struct {
+	Label  string
+	Length uint32
+}
+
+func (ExportRequest) Read(reader payload.Reader) (noise.Message, error) {
+	label, err := reader.ReadString()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read export label")
+	}
+
+	length, err := reader.ReadUint32()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read export length")
+	}
+
+	return ExportRequest{Label: label, Length: length}, nil
+}
+
+func (m ExportRequest) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.Label).WriteUint32(m.Length).Bytes()
+}
+
+// ExportResponse carries the keying material requested by an ExportRequest. It is empty should
+// the material not have been exported.
+type ExportResponse struct {
+	Material []byte
+}
+
+func (ExportResponse) Read(reader payload.Reader) (noise.Message, error) {
+	material, err := reader.ReadBytes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read exported keying material")
+	}
+
+	return ExportResponse{Material: material}, nil
+}
+
+func (m ExportResponse) Write() []byte {
+	return payload.NewWriter(nil).WriteBytes(m.Material).Bytes()
+}
+
+// Server is a node which peers may connect to in order to verify their implementation of the wire
+// protocol against. It performs the ECDH handshake and AEAD blocks with every peer, echoes every
+// Echo message back, and responds to every ExportRequest.
+type Server struct {
+	node      *noise.Node
+	networkID string
+	opcodes   Opcodes
+}
+
+// NewServer has a node serve as a conformance server, set to a network should networkID not be
+// empty. The node must not enforce any other protocol.
+func NewServer(node *noise.Node, networkID string) *Server {
+	protocol.New().
+		Register(ecdh.New()).
+		Register(aead.New().WithNetworkID(networkID)).
+		Enforce(node)
+
+	s := &Server{node: node, networkID: networkID}
+
+	s.opcodes.Echo = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Echo)(nil))
+	s.opcodes.ExportRequest = noise.RegisterMessage(noise.NextAvailableOpcode(), (*ExportRequest)(nil))
+	s.opcodes.ExportResponse = noise.RegisterMessage(noise.NextAvailableOpcode(), (*ExportResponse)(nil))
+	s.opcodes.Disconnect = noise.OpcodeDisconnect
+
+	s.opcodes.Handshake, _ = noise.OpcodeFromMessage(ecdh.Handshake{})
+	s.opcodes.ACK, _ = noise.OpcodeFromMessage(aead.ACK{})
+	s.opcodes.KeyUpdate, _ = noise.OpcodeFromMessage(aead.KeyUpdate{})
+
+	node.OnMessageReceived(s.opcodes.Echo, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		peer.SendMessageAsync(message)
+		return nil
+	})
+
+	node.OnMessageReceived(s.opcodes.ExportRequest, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		req := message.(ExportRequest)
+
+		material, err := protocol.ExportKeyingMaterial(peer, req.Label, int(req.Length))
+		if err != nil {
+			material = nil
+		}
+
+		peer.SendMessageAsync(ExportResponse{Material: material})
+		return nil
+	})
+
+	return s
+}
+
+// Node returns the node serving as the conformance server.
+func (s *Server) Node() *noise.Node {
+	return s.node
+}
+
+// Opcodes returns the opcodes the server was registered with.
+func (s *Server) Opcodes() Opcodes {
+	return s.opcodes
+}
+
+// Spec returns the spec of the server, with the opcodes and the network it was registered with.
+func (s *Server) Spec() (Spec, error) {
+	return newSpec(s.opcodes, s.networkID)
+}
@@ -0,0 +1,258 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/cipher/aead"
+	"github.com/perlin-network/noise/handshake/ecdh"
+	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+var pipeAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+// tap records every byte written to, and read from, a connection.
+type tap struct {
+	net.Conn
+
+	sync.Mutex
+	written, read bytes.Buffer
+}
+
+func (t *tap) Write(buf []byte) (int, error) {
+	t.Lock()
+	t.written.Write(buf)
+	t.Unlock()
+
+	return t.Conn.Write(buf)
+}
+
+func (t *tap) Read(buf []byte) (int, error) {
+	n, err := t.Conn.Read(buf)
+
+	t.Lock()
+	t.read.Write(buf[:n])
+	t.Unlock()
+
+	return n, err
+}
+
+func (t *tap) LocalAddr() net.Addr {
+	return pipeAddr
+}
+
+func (t *tap) RemoteAddr() net.Addr {
+	return pipeAddr
+}
+
+// frames splits a stream into its frames, skipping heartbeats.
+func frames(t *testing.T, stream []byte) [][]byte {
+	var frames [][]byte
+
+	for len(stream) > 0 {
+		size, n := binary.Uvarint(stream)
+		assert.True(t, n > 0 && uint64(len(stream)-n) >= size, "stream is cut short")
+
+		if size > 0 {
+			frames = append(frames, stream[n:n+int(size)])
+		}
+
+		stream = stream[n+int(size):]
+	}
+
+	return frames
+}
+
+func unframe(t *testing.T, frame []byte) []byte {
+	split := frames(t, frame)
+	assert.Len(t, split, 1)
+
+	return split[0]
+}
+
+// sharedKeyOf derives the shared key a listener arrives at from the handshake of a dialer.
+func sharedKeyOf(t *testing.T, listenerSeed, dialerHandshake []byte) []byte {
+	_, private, err := edwards25519.GenerateKey(bytes.NewReader(listenerSeed))
+	assert.NoError(t, err)
+
+	public, err := payload.NewReader(unframe(t, dialerHandshake)[1:]).ReadBytes()
+	assert.NoError(t, err)
+
+	return edwards25519.SharedKey(private, public)
+}
+
+func receive(t *testing.T, peer *noise.Peer, opcode noise.Opcode) noise.Message {
+	select {
+	case msg := <-peer.Receive(opcode):
+		return msg
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for a message with opcode %d", opcode)
+		return nil
+	}
+}
+
+func TestServerFollowsSpec(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer node.Kill()
+
+	server := NewServer(node, "")
+	opcodes := server.Opcodes()
+
+	client, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer client.Kill()
+
+	protocol.New().Register(ecdh.New()).Register(aead.New()).Enforce(client)
+
+	local, remote := net.Pipe()
+	conn := &tap{Conn: local}
+
+	peer := client.DialConn(conn)
+	node.AcceptConn(&tap{Conn: remote})
+
+	aead.WaitUntilAuthenticated(peer)
+
+	assert.NoError(t, peer.SendMessage(Echo{Payload: []byte("hello")}))
+	assert.Equal(t, Echo{Payload: []byte("hello")}, receive(t, peer, opcodes.Echo))
+
+	assert.NoError(t, aead.UpdateKeys(peer))
+
+	assert.NoError(t, peer.SendMessage(Echo{Payload: []byte("hello after ratcheting")}))
+	assert.Equal(t, Echo{Payload: []byte("hello after ratcheting")}, receive(t, peer, opcodes.Echo))
+
+	assert.NoError(t, peer.SendMessage(ExportRequest{Label: "conformance", Length: 32}))
+	res := receive(t, peer, opcodes.ExportResponse).(ExportResponse)
+
+	sharedKey, hash := protocol.LoadSharedKey(peer), protocol.LoadHandshakeHash(peer)
+
+	material, err := export(sharedKey, hash, "conformance", 32)
+	assert.NoError(t, err)
+	assert.Equal(t, material, res.Material)
+
+	conn.Lock()
+	written, read := frames(t, conn.written.Bytes()), frames(t, conn.read.Bytes())
+	conn.Unlock()
+
+	if !assert.True(t, len(written) >= 6 && len(read) >= 2) {
+		return
+	}
+
+	// Both handshakes are laid out and hashed as specified.
+	for _, handshake := range [][]byte{written[0], read[0]} {
+		assert.EqualValues(t, opcodes.Handshake, handshake[0])
+
+		reader := payload.NewReader(handshake[1:])
+
+		_, err := reader.ReadBytes()
+		assert.NoError(t, err)
+
+		_, err = reader.ReadBytes()
+		assert.NoError(t, err)
+
+		endpoints, err := reader.ReadBytes()
+		assert.NoError(t, err)
+		assert.Len(t, endpoints, 2*(net.IPv6len+2))
+
+		assert.Zero(t, reader.Len())
+	}
+
+	assert.Equal(t, handshakeHash(ecdh.DefaultHandshakeMessage, written[0][1:], read[0][1:]), hash)
+
+	// Both ACKs advertise every feature, and carry the confirmation of the session key and of the
+	// features advertised by their side of the session.
+	session := sessionKey(sharedKey, "")
+
+	assert.Equal(t, append([]byte{byte(opcodes.ACK)}, ack(confirmation(session, LabelInitiator, features))...), written[1])
+	assert.Equal(t, append([]byte{byte(opcodes.ACK)}, ack(confirmation(session, LabelResponder, features, features))...), read[1])
+
+	key := derive(session, nil, []byte(LabelInitiator), sessionKeySize)
+
+	// Every message sent afterwards is sealed as specified, and keys are ratcheted in step.
+	expected := []struct {
+		message noise.Message
+		opcode  noise.Opcode
+		flags   byte
+	}{
+		{message: Echo{Payload: []byte("hello")}, opcode: opcodes.Echo},
+		{message: aead.KeyUpdate{Requested: true}, opcode: opcodes.KeyUpdate, flags: flagRatchet},
+		{message: Echo{Payload: []byte("hello after ratcheting")}, opcode: opcodes.Echo},
+		{message: ExportRequest{Label: "conformance", Length: 32}, opcode: opcodes.ExportRequest},
+	}
+
+	for i, e := range expected {
+		flags, contents, err := open(key, uint64(i+1), written[2+i])
+		if !assert.NoError(t, err, "message %d", i) {
+			return
+		}
+
+		assert.Equal(t, e.flags, flags)
+		assert.Equal(t, append([]byte{byte(e.opcode)}, e.message.Write()...), contents)
+
+		if flags&flagRatchet != 0 {
+			key = ratchet(key)
+		}
+	}
+}
+
+func TestSpec(t *testing.T) {
+	spec, err := DefaultSpec()
+	assert.NoError(t, err)
+
+	again, err := DefaultSpec()
+	assert.NoError(t, err)
+	assert.Equal(t, spec, again)
+
+	buf, err := json.MarshalIndent(spec, "", "  ")
+	assert.NoError(t, err)
+
+	var decoded Spec
+	assert.NoError(t, json.Unmarshal(buf, &decoded))
+	assert.Equal(t, spec, decoded)
+
+	// The spec shipped alongside this package must be kept up to date.
+	shipped, err := ioutil.ReadFile("spec.json")
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(buf), string(shipped), "spec.json is out of date; regenerate it through examples/conformance")
+
+	for _, transcript := range spec.Transcripts {
+		// Transcripts open with the handshake of both sides, and both sides derive the same key.
+		assert.Equal(t, transcript.SharedKey, Hex(sharedKeyOf(t, transcript.ListenerSeed, transcript.DialerHandshake)))
+
+		assert.Equal(t, transcript.DialerKey, Hex(derive(transcript.SessionKey, nil, []byte(LabelInitiator), sessionKeySize)))
+		assert.Equal(t, transcript.ListenerKey, Hex(derive(transcript.SessionKey, nil, []byte(LabelResponder), sessionKeySize)))
+		assert.NotEqual(t, transcript.DialerKey, transcript.ListenerKey)
+
+		key := transcript.DialerKey
+
+		for _, message := range transcript.Messages {
+			assert.Equal(t, key, message.Key)
+
+			flags, contents, err := open(message.Key, message.Nonce, unframe(t, message.Frame))
+			assert.NoError(t, err)
+			assert.Equal(t, message.Flags, flags)
+			assert.Equal(t, []byte(message.Contents), contents)
+
+			if flags&flagRatchet != 0 {
+				key = ratchet(key)
+			}
+		}
+	}
+}
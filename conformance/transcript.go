@@ -0,0 +1,359 @@
+package conformance
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/cipher/aead"
+	"github.com/perlin-network/noise/handshake/ecdh"
+	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"net"
+)
+
+// Hex is a byte slice which is serialized as a hex string, rather than as base64.
+type Hex []byte
+
+func (h Hex) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(h))
+}
+
+func (h *Hex) UnmarshalJSON(buf []byte) error {
+	var s string
+
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return err
+	}
+
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return errors.Wrap(err, "conformance: invalid hex string")
+	}
+
+	*h = decoded
+	return nil
+}
+
+// Transcript is every byte a dialer and a listener exchange establishing a session, alongside every
+// value both derive along the way, given the seeds of their ephemeral keys.
+type Transcript struct {
+	Name      string `json:"name"`
+	NetworkID string `json:"network_id,omitempty"`
+
+	// DialerAddress and ListenerAddress are the addresses the dialer and the listener see their ends
+	// of the connection at, which both bind into their shared key.
+	DialerAddress   string `json:"dialer_address"`
+	ListenerAddress string `json:"listener_address"`
+
+	// DialerSeed and ListenerSeed are the 32-byte seeds the ephemeral ed25519 keys of the dialer
+	// and of the listener are derived from.
+	DialerSeed   Hex `json:"dialer_seed"`
+	ListenerSeed Hex `json:"listener_seed"`
+
+	// DialerHandshake and ListenerHandshake are the handshake frames sent by the dialer and by the
+	// listener, including their length prefix.
+	DialerHandshake   Hex `json:"dialer_handshake"`
+	ListenerHandshake Hex `json:"listener_handshake"`
+
+	SharedKey     Hex `json:"shared_key"`
+	HandshakeHash Hex `json:"handshake_hash"`
+
+	// AddressBinding is the hash of the endpoints of the connection, and BoundKey is the shared key
+	// with the binding mixed in, which keys are derived from and exported under.
+	AddressBinding Hex `json:"address_binding"`
+	BoundKey       Hex `json:"bound_key"`
+
+	SessionKey Hex `json:"session_key"`
+
+	// DialerConfirmation and ListenerConfirmation are the confirmations the dialer and the listener
+	// send in their ACKs.
+	DialerConfirmation   Hex `json:"dialer_confirmation"`
+	ListenerConfirmation Hex `json:"listener_confirmation"`
+
+	// DialerKey and ListenerKey are the keys messages sent by the dialer and by the listener are
+	// sealed under, before keys are ratcheted.
+	DialerKey   Hex `json:"dialer_key"`
+	ListenerKey Hex `json:"listener_key"`
+
+	// DialerACK and ListenerACK are the ACK frames sent by the dialer and by the listener, which
+	// are not encrypted.
+	DialerACK   Hex `json:"dialer_ack"`
+	ListenerACK Hex `json:"listener_ack"`
+
+	// Messages are sealed by the dialer in order under its key, following its ACK.
+	Messages []Sealed `json:"messages"`
+
+	Exports []Export `json:"exports"`
+}
+
+// Sealed is a message sealed by the dialer of a transcript.
+type Sealed struct {
+	// Contents are the opcode and contents of the message before being sealed.
+	Contents Hex    `json:"contents"`
+	Flags    byte   `json:"flags"`
+	Nonce    uint64 `json:"nonce"`
+
+	// Key is the key the message was sealed under, which differs from the key of the dialer once
+	// keys are ratcheted.
+	Key Hex `json:"key"`
+
+	// Frame is the sealed message, including its length prefix.
+	Frame Hex `json:"frame"`
+}
+
+// Export is keying material exported from the session of a transcript under a label.
+type Export struct {
+	Label    string `json:"label"`
+	Length   int    `json:"length"`
+	Material Hex    `json:"material"`
+}
+
+// NewTranscript returns the transcript of a session between a dialer and a listener whose ephemeral
+// keys are derived from the given seeds. The dialer then sends an Echo message, a KeyUpdate message
+// requesting keys to be ratcheted, and another Echo message, such that the transcript covers
+// messages sealed both before and after a ratchet. Opcodes are those of DefaultOpcodes.
+func NewTranscript(name, networkID string, dialerSeed, listenerSeed []byte) (Transcript, error) {
+	return newTranscript(DefaultOpcodes, name, networkID, dialerSeed, listenerSeed)
+}
+
+// The addresses the dialer and the listener of every transcript are connected at.
+var (
+	transcriptDialer   = &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 3000}
+	transcriptListener = &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 4000}
+)
+
+func newTranscript(opcodes Opcodes, name, networkID string, dialerSeed, listenerSeed []byte) (Transcript, error) {
+	t := Transcript{
+		Name:            name,
+		NetworkID:       networkID,
+		DialerAddress:   transcriptDialer.String(),
+		ListenerAddress: transcriptListener.String(),
+		DialerSeed:      dialerSeed,
+		ListenerSeed:    listenerSeed,
+	}
+
+	dialerPublic, dialerPrivate, err := edwards25519.GenerateKey(bytes.NewReader(dialerSeed))
+	if err != nil {
+		return t, errors.Wrap(err, "conformance: failed to derive the ephemeral keys of the dialer")
+	}
+
+	listenerPublic, listenerPrivate, err := edwards25519.GenerateKey(bytes.NewReader(listenerSeed))
+	if err != nil {
+		return t, errors.Wrap(err, "conformance: failed to derive the ephemeral keys of the listener")
+	}
+
+	dialerEndpoint, listenerEndpoint := endpoint(transcriptDialer), endpoint(transcriptListener)
+
+	dialer := handshakeContents(dialerPublic, dialerPrivate, dialerEndpoint, listenerEndpoint)
+	listener := handshakeContents(listenerPublic, listenerPrivate, listenerEndpoint, dialerEndpoint)
+
+	t.DialerHandshake = frame(append([]byte{byte(opcodes.Handshake)}, dialer...))
+	t.ListenerHandshake = frame(append([]byte{byte(opcodes.Handshake)}, listener...))
+
+	t.SharedKey = edwards25519.SharedKey(dialerPrivate, listenerPublic)
+	t.HandshakeHash = handshakeHash(ecdh.DefaultHandshakeMessage, dialer, listener)
+	t.AddressBinding = addressBinding(t.HandshakeHash, dialerEndpoint, listenerEndpoint)
+	t.BoundKey = bind(t.SharedKey, t.AddressBinding)
+	t.SessionKey = sessionKey(t.BoundKey, networkID)
+	t.DialerConfirmation = confirmation(t.SessionKey, LabelInitiator, features)
+	t.ListenerConfirmation = confirmation(t.SessionKey, LabelResponder, features, features)
+
+	t.DialerKey = derive(t.SessionKey, nil, []byte(LabelInitiator), sessionKeySize)
+	t.ListenerKey = derive(t.SessionKey, nil, []byte(LabelResponder), sessionKeySize)
+
+	t.DialerACK = frame(append([]byte{byte(opcodes.ACK)}, ack(t.DialerConfirmation)...))
+	t.ListenerACK = frame(append([]byte{byte(opcodes.ACK)}, ack(t.ListenerConfirmation)...))
+
+	key := append([]byte(nil), t.DialerKey...)
+
+	messages := []struct {
+		opcode   noise.Opcode
+		contents []byte
+		flags    byte
+	}{
+		{opcode: opcodes.Echo, contents: Echo{Payload: []byte("hello")}.Write()},
+		{opcode: opcodes.KeyUpdate, contents: aead.KeyUpdate{Requested: true}.Write(), flags: flagRatchet},
+		{opcode: opcodes.Echo, contents: Echo{Payload: []byte("hello after ratcheting")}.Write()},
+	}
+
+	for i, m := range messages {
+		contents := append([]byte{byte(m.opcode)}, m.contents...)
+		nonce := uint64(i + 1)
+
+		sealed, err := seal(key, nonce, m.flags, contents)
+		if err != nil {
+			return t, err
+		}
+
+		t.Messages = append(t.Messages, Sealed{Contents: contents, Flags: m.flags, Nonce: nonce, Key: key, Frame: frame(sealed)})
+
+		if m.flags&flagRatchet != 0 {
+			key = ratchet(key)
+		}
+	}
+
+	for _, label := range []string{"conformance", "channel binding"} {
+		material, err := export(t.BoundKey, t.HandshakeHash, label, 32)
+		if err != nil {
+			return t, err
+		}
+
+		t.Exports = append(t.Exports, Export{Label: label, Length: 32, Material: material})
+	}
+
+	return t, nil
+}
+
+// handshakeContents returns the contents of a handshake message, without its opcode, sent by a side
+// seeing its end of the connection at local and the end of its peer at remote.
+func handshakeContents(public edwards25519.PublicKey, private edwards25519.PrivateKey, local, remote []byte) []byte {
+	signature := edwards25519.Sign(private, []byte(ecdh.DefaultHandshakeMessage))
+
+	return payload.NewWriter(nil).WriteBytes(public).WriteBytes(signature).WriteBytes(append(append([]byte(nil), local...), remote...)).Bytes()
+}
+
+// endpoint encodes the IP and port of an end of a connection.
+func endpoint(addr *net.TCPAddr) []byte {
+	buf := make([]byte, net.IPv6len+2)
+
+	copy(buf, addr.IP.To16())
+	binary.BigEndian.PutUint16(buf[net.IPv6len:], uint16(addr.Port))
+
+	return buf
+}
+
+func addressBinding(handshakeHash, a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(LabelAddressBinding))
+	hash.Write(handshakeHash)
+	hash.Write(a)
+	hash.Write(b)
+
+	return hash.Sum(nil)
+}
+
+func bind(sharedKey, binding []byte) []byte {
+	mac := hmac.New(sha256.New, binding)
+	mac.Write(sharedKey)
+
+	return mac.Sum(nil)
+}
+
+// frame prefixes a frame with its length as an unsigned variable-sized integer.
+func frame(contents []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(buf[:binary.PutUvarint(buf, uint64(len(contents)))], contents...)
+}
+
+func handshakeHash(message string, a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(message))
+	hash.Write(a)
+	hash.Write(b)
+
+	return hash.Sum(nil)
+}
+
+func sessionKey(sharedKey []byte, networkID string) []byte {
+	var info []byte
+
+	if networkID != "" {
+		info = append([]byte(LabelNetwork), networkID...)
+	}
+
+	return derive(sharedKey, nil, info, sessionKeySize)
+}
+
+// confirmation returns the confirmation sent by the side of a session given the label of its role,
+// and the features advertised in the ACKs sent up until its own in dialer/listener order.
+func confirmation(sessionKey []byte, role string, advertised ...byte) []byte {
+	mac := hmac.New(sha256.New, derive(sessionKey, nil, []byte(LabelConfirmation), sessionKeySize))
+	mac.Write([]byte(role))
+	mac.Write(advertised)
+
+	return mac.Sum(nil)
+}
+
+// ack returns the contents of an ACK advertising every feature, without its opcode.
+func ack(confirmation []byte) []byte {
+	return payload.NewWriter(nil).WriteByte(features).WriteBytes(confirmation).Bytes()
+}
+
+func ratchet(key []byte) []byte {
+	return derive(key, nil, []byte(LabelRatchet), len(key))
+}
+
+func export(sharedKey, handshakeHash []byte, label string, length int) ([]byte, error) {
+	if length <= 0 || length > 255*sha256.Size {
+		return nil, errors.Errorf("conformance: cannot export %d bytes of keying material", length)
+	}
+
+	return derive(sharedKey, handshakeHash, []byte(LabelExporter+label), length), nil
+}
+
+func derive(secret, salt, info []byte, length int) []byte {
+	buf := make([]byte, length)
+
+	// HKDF-SHA256 only fails to produce more than 255 hashes worth of bytes.
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), buf); err != nil {
+		panic(err)
+	}
+
+	return buf
+}
+
+func suite(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "conformance: invalid session key")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func nonceOf(suite cipher.AEAD, nonce uint64) []byte {
+	buf := make([]byte, suite.NonceSize())
+	binary.LittleEndian.PutUint64(buf, nonce)
+
+	return buf
+}
+
+func seal(key []byte, nonce uint64, flags byte, contents []byte) ([]byte, error) {
+	s, err := suite(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Seal(nil, nonceOf(s, nonce), append([]byte{flags}, contents...), nil), nil
+}
+
+func open(key []byte, nonce uint64, sealed []byte) (byte, []byte, error) {
+	s, err := suite(key)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	buf, err := s.Open(nil, nonceOf(s, nonce), sealed, nil)
+	if err != nil || len(buf) == 0 {
+		return 0, nil, errors.New("conformance: message authentication failed")
+	}
+
+	return buf[0], buf[1:], nil
+}
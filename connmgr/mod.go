@@ -0,0 +1,389 @@
+// Package connmgr bounds how many peers our node stays connected to, and prunes the least valuable
+// peers once our node is connected to too many.
+//
+// Protocols may tag peers with the classes they belong to, such as "validator", "mesh" or
+// "bootstrap", and budget every tag with a minimum and a maximum number of peers. Peers are never
+// pruned should doing so bring any of their tags below its minimum, and peers beyond the maximum of
+// any of their tags are pruned right away. Tags stick to the IDs of peers, such that peers which
+// reconnect keep their tags.
+package connmgr
+
+import (
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Manager tracks the peers of a node, and the tags of every peer.
+type Manager struct {
+	sync.Mutex
+
+	low, high int
+	grace     time.Duration
+
+	budgets map[string]budget
+
+	peers map[*noise.Peer]*entry
+
+	// sticky holds the tags of every peer by the hash of its ID.
+	sticky map[string]map[string]struct{}
+}
+
+type budget struct {
+	min, max int
+}
+
+type entry struct {
+	peer      *noise.Peer
+	connected time.Time
+
+	// key is the hash of the ID of the peer once it has one, after which its tags are those stuck
+	// to its ID. Until then, its tags are held in tags.
+	key  string
+	tags map[string]struct{}
+}
+
+// New returns a manager which, once our node is connected to more than high peers, prunes peers
+// until our node is connected to low peers. Should high not be positive, peers are only pruned
+// to enforce the maximums of tags. By default, peers connected within the last 30 seconds are not
+// pruned to bring our node down to low peers.
+func New(low, high int) *Manager {
+	if high > 0 && low > high {
+		panic("connmgr: low watermark must not exceed the high watermark")
+	}
+
+	return &Manager{
+		low:     low,
+		high:    high,
+		grace:   30 * time.Second,
+		budgets: make(map[string]budget),
+		peers:   make(map[*noise.Peer]*entry),
+		sticky:  make(map[string]map[string]struct{}),
+	}
+}
+
+// WithGracePeriod sets how long newly connected peers are exempt from being pruned to bring our
+// node down to its low watermark, such that peers have a chance to complete their handshakes and
+// be tagged. Peers beyond the maximum of a tag are pruned regardless.
+func (m *Manager) WithGracePeriod(grace time.Duration) *Manager {
+	m.grace = grace
+	return m
+}
+
+// WithTagBudget budgets how many peers with a tag our node stays connected to. Peers are not pruned
+// should doing so leave fewer than min peers with the tag, nor are they reaped for being idle, and
+// peers are pruned should more than max peers have the tag. A max that is not positive leaves the
+// tag unbounded.
+func (m *Manager) WithTagBudget(tag string, min, max int) *Manager {
+	if max > 0 && min > max {
+		panic("connmgr: minimum of a tag must not exceed its maximum")
+	}
+
+	m.Lock()
+	m.budgets[tag] = budget{min: min, max: max}
+	m.Unlock()
+
+	return m
+}
+
+// Watch tracks every peer which connects to, or is dialed by, a node from then on.
+func (m *Manager) Watch(node *noise.Node) *Manager {
+	node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+		m.Lock()
+		m.peers[peer] = &entry{peer: peer, connected: node.Clock().Now(), tags: make(map[string]struct{})}
+		m.Unlock()
+
+		peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+			m.Lock()
+			delete(m.peers, peer)
+			m.Unlock()
+
+			return nil
+		})
+
+		m.Trim()
+
+		return nil
+	})
+
+	// Peers spared by the grace period are pruned once it lapses, should our node still be connected
+	// to too many peers by then.
+	if m.grace > 0 {
+		node.Go(func(ctx context.Context) error {
+			ticker := node.Clock().NewTicker(m.grace)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C():
+				}
+
+				m.Trim()
+			}
+		})
+	}
+
+	node.OnPeerIdle(func(node *noise.Node, peer *noise.Peer) bool {
+		m.Lock()
+		defer m.Unlock()
+
+		e, exists := m.peers[peer]
+		return exists && m.protected(e, m.counts())
+	})
+
+	return m
+}
+
+// Tag tags a peer, and prunes peers should any of the tags exceed its maximum. Once the peer has an
+// ID, its tags stick to its ID.
+func (m *Manager) Tag(peer *noise.Peer, tags ...string) {
+	m.Lock()
+
+	e, exists := m.peers[peer]
+	if exists {
+		m.bind(e)
+		m.tag(e.key, e, tags)
+	}
+
+	m.Unlock()
+
+	if exists {
+		m.Trim()
+	}
+}
+
+// TagID tags the peer behind an ID, whether or not our node is connected to it, such that the peer
+// has the tags once it connects.
+func (m *Manager) TagID(id protocol.ID, tags ...string) {
+	m.Lock()
+	m.tag(string(id.Hash()), nil, tags)
+	m.Unlock()
+
+	m.Trim()
+}
+
+// Untag removes tags from a peer, and from its ID.
+func (m *Manager) Untag(peer *noise.Peer, tags ...string) {
+	m.Lock()
+	defer m.Unlock()
+
+	if e, exists := m.peers[peer]; exists {
+		m.bind(e)
+		m.untag(e.key, e, tags)
+	}
+}
+
+// UntagID removes tags from the peer behind an ID.
+func (m *Manager) UntagID(id protocol.ID, tags ...string) {
+	m.Lock()
+	m.untag(string(id.Hash()), nil, tags)
+	m.Unlock()
+}
+
+// Tags returns the tags of a peer.
+func (m *Manager) Tags(peer *noise.Peer) []string {
+	m.Lock()
+	defer m.Unlock()
+
+	e, exists := m.peers[peer]
+	if !exists {
+		return nil
+	}
+
+	var tags []string
+	for tag := range m.tagsOf(e) {
+		tags = append(tags, tag)
+	}
+
+	sort.Strings(tags)
+
+	return tags
+}
+
+// Count returns how many peers our node is connected to with a tag.
+func (m *Manager) Count(tag string) int {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.counts()[tag]
+}
+
+// Trim prunes peers should our node be connected to more peers than its high watermark, or should
+// any tag exceed its maximum. Peers are pruned in order of those beyond the maximum of a tag first,
+// then those with the fewest tags, then those most recently connected.
+func (m *Manager) Trim() {
+	var pruned []*noise.Peer
+
+	m.Lock()
+
+	counts := m.counts()
+	trimming := m.high > 0 && len(m.peers) > m.high
+
+	for {
+		var candidates []*entry
+
+		for _, e := range m.peers {
+			if m.protected(e, counts) {
+				continue
+			}
+
+			// Peers beyond the maximum of a tag are pruned regardless of our watermarks, and of
+			// having just connected.
+			if m.exceeds(e, counts) {
+				candidates = append(candidates, e)
+				continue
+			}
+
+			if trimming && len(m.peers) > m.low && e.peer.Node().Clock().Since(e.connected) >= m.grace {
+				candidates = append(candidates, e)
+			}
+		}
+
+		if len(candidates) == 0 {
+			break
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+
+			if x, y := m.exceeds(a, counts), m.exceeds(b, counts); x != y {
+				return x
+			}
+
+			if x, y := len(m.tagsOf(a)), len(m.tagsOf(b)); x != y {
+				return x < y
+			}
+
+			return a.connected.After(b.connected)
+		})
+
+		victim := candidates[0]
+
+		for tag := range m.tagsOf(victim) {
+			counts[tag]--
+		}
+
+		delete(m.peers, victim.peer)
+		pruned = append(pruned, victim.peer)
+	}
+
+	m.Unlock()
+
+	for _, peer := range pruned {
+		log.Debug().Str("address", peer.RemoteIP().String()).Msg("Pruned a peer to stay within our connection limits.")
+		peer.DisconnectWithReason(noise.ReasonTooManyPeers)
+	}
+}
+
+// bind moves the tags of a peer onto its ID, once the peer has an ID.
+func (m *Manager) bind(e *entry) {
+	if e.key != "" {
+		return
+	}
+
+	id := protocol.PeerID(e.peer)
+	if id == nil {
+		return
+	}
+
+	e.key = string(id.Hash())
+
+	for tag := range e.tags {
+		m.tag(e.key, nil, []string{tag})
+	}
+
+	e.tags = nil
+}
+
+// tag adds tags to those stuck to an ID, or to those of a peer should the ID be empty.
+func (m *Manager) tag(key string, e *entry, tags []string) {
+	if key == "" {
+		for _, tag := range tags {
+			e.tags[tag] = struct{}{}
+		}
+
+		return
+	}
+
+	sticky, exists := m.sticky[key]
+	if !exists {
+		sticky = make(map[string]struct{})
+		m.sticky[key] = sticky
+	}
+
+	for _, tag := range tags {
+		sticky[tag] = struct{}{}
+	}
+}
+
+// untag removes tags from those stuck to an ID, or from those of a peer should the ID be empty. IDs
+// left with no tags are forgotten.
+func (m *Manager) untag(key string, e *entry, tags []string) {
+	if key == "" {
+		for _, tag := range tags {
+			delete(e.tags, tag)
+		}
+
+		return
+	}
+
+	for _, tag := range tags {
+		delete(m.sticky[key], tag)
+	}
+
+	if len(m.sticky[key]) == 0 {
+		delete(m.sticky, key)
+	}
+}
+
+// tagsOf returns the tags of a peer.
+func (m *Manager) tagsOf(e *entry) map[string]struct{} {
+	m.bind(e)
+
+	if e.key == "" {
+		return e.tags
+	}
+
+	return m.sticky[e.key]
+}
+
+// counts returns how many peers have every tag.
+func (m *Manager) counts() map[string]int {
+	counts := make(map[string]int)
+
+	for _, e := range m.peers {
+		for tag := range m.tagsOf(e) {
+			counts[tag]++
+		}
+	}
+
+	return counts
+}
+
+// protected reports whether pruning a peer would bring any of its tags below its minimum.
+func (m *Manager) protected(e *entry, counts map[string]int) bool {
+	for tag := range m.tagsOf(e) {
+		if b, exists := m.budgets[tag]; exists && counts[tag] <= b.min {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exceeds reports whether any tag of a peer exceeds its maximum.
+func (m *Manager) exceeds(e *entry, counts map[string]int) bool {
+	for tag := range m.tagsOf(e) {
+		if b, exists := m.budgets[tag]; exists && b.max > 0 && counts[tag] > b.max {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,248 @@
+package connmgr
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/skademlia"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hub is a node watched by a manager which hands over the peers that connect to it.
+type hub struct {
+	*noise.Node
+
+	manager   *Manager
+	connected chan *noise.Peer
+
+	sync.Mutex
+	disconnected map[*noise.Peer]struct{}
+}
+
+// newNode returns a node which establishes S/Kademlia IDs with its peers should kademlia be true.
+func newNode(t *testing.T, layer transport.Layer, idleTimeout time.Duration, kademlia bool) *noise.Node {
+	params := noise.DefaultParams()
+	params.Transport = layer
+	params.IdleTimeout = idleTimeout
+
+	if kademlia {
+		params.Keys = skademlia.RandomKeys()
+	}
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	if kademlia {
+		protocol.New().Register(skademlia.New()).Enforce(node)
+	}
+
+	return node
+}
+
+func newHub(t *testing.T, layer transport.Layer, manager *Manager, idleTimeout time.Duration, kademlia bool) *hub {
+	node := newNode(t, layer, idleTimeout, kademlia)
+
+	h := &hub{Node: node, manager: manager.Watch(node), connected: make(chan *noise.Peer, 16), disconnected: make(map[*noise.Peer]struct{})}
+
+	node.OnPeerConnected(func(node *noise.Node, peer *noise.Peer) error {
+		h.connected <- peer
+		return nil
+	})
+
+	node.OnPeerDisconnected(func(node *noise.Node, peer *noise.Peer) error {
+		h.Lock()
+		h.disconnected[peer] = struct{}{}
+		h.Unlock()
+
+		return nil
+	})
+
+	go node.Listen()
+
+	return h
+}
+
+// accept dials the hub from a new node, and returns the peer of the new node as seen by the hub once
+// the manager tracks it.
+func (h *hub) accept(t *testing.T, layer transport.Layer, kademlia bool) (*noise.Node, *noise.Peer) {
+	node := newNode(t, layer, 0, kademlia)
+	return node, h.redial(t, node)
+}
+
+func (h *hub) redial(t *testing.T, node *noise.Node) *noise.Peer {
+	_, err := node.Dial(h.ExternalAddress())
+	assert.NoError(t, err)
+
+	var peer *noise.Peer
+
+	select {
+	case peer = <-h.connected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("hub did not accept peer")
+	}
+
+	for i := 0; i < 100; i++ {
+		h.manager.Lock()
+		_, tracked := h.manager.peers[peer]
+		h.manager.Unlock()
+
+		if tracked {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return peer
+}
+
+func (h *hub) waitUntilDisconnected(t *testing.T, peers ...*noise.Peer) {
+	for i := 0; i < 300; i++ {
+		h.Lock()
+		done := true
+
+		for _, peer := range peers {
+			if _, disconnected := h.disconnected[peer]; !disconnected {
+				done = false
+			}
+		}
+
+		h.Unlock()
+
+		if done {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("peers were not disconnected")
+}
+
+func (h *hub) isConnected(peer *noise.Peer) bool {
+	h.Lock()
+	defer h.Unlock()
+
+	_, disconnected := h.disconnected[peer]
+	return !disconnected
+}
+
+func TestTrim(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	manager := New(2, 3).WithGracePeriod(0).WithTagBudget("validator", 2, 0)
+
+	h := newHub(t, layer, manager, 200*time.Millisecond, false)
+	defer h.Kill()
+
+	var peers []*noise.Peer
+
+	for i := 0; i < 4; i++ {
+		node, peer := h.accept(t, layer, false)
+		defer node.Kill()
+
+		peers = append(peers, peer)
+
+		// The first peers to connect are validators, and so survive being pruned despite being
+		// the oldest.
+		if i < 2 {
+			manager.Tag(peer, "validator")
+		}
+	}
+
+	// Exceeding the high watermark prunes peers down to the low watermark.
+	h.waitUntilDisconnected(t, peers[2], peers[3])
+
+	assert.True(t, h.isConnected(peers[0]))
+	assert.True(t, h.isConnected(peers[1]))
+	assert.Equal(t, 2, manager.Count("validator"))
+	assert.Equal(t, []string{"validator"}, manager.Tags(peers[0]))
+
+	// Peers at the minimum of a tag are not reaped for being idle either.
+	time.Sleep(500 * time.Millisecond)
+
+	assert.True(t, h.isConnected(peers[0]))
+	assert.True(t, h.isConnected(peers[1]))
+
+	// Once untagged, they are. The last validator remains, as it is below the minimum.
+	manager.Untag(peers[0], "validator")
+
+	h.waitUntilDisconnected(t, peers[0])
+	assert.True(t, h.isConnected(peers[1]))
+}
+
+func TestTagMaximum(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	manager := New(0, 0).WithTagBudget("mesh", 0, 1)
+
+	h := newHub(t, layer, manager, 0, false)
+	defer h.Kill()
+
+	aliceNode, alice := h.accept(t, layer, false)
+	defer aliceNode.Kill()
+
+	bobNode, bob := h.accept(t, layer, false)
+	defer bobNode.Kill()
+
+	manager.Tag(alice, "mesh")
+	manager.Tag(bob, "mesh")
+
+	// The most recently connected peer beyond the maximum is pruned, regardless of the grace period.
+	h.waitUntilDisconnected(t, bob)
+
+	assert.True(t, h.isConnected(alice))
+	assert.Equal(t, 1, manager.Count("mesh"))
+}
+
+func TestStickyTags(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	manager := New(0, 0)
+
+	h := newHub(t, layer, manager, 0, true)
+	defer h.Kill()
+
+	aliceNode, alice := h.accept(t, layer, true)
+	defer aliceNode.Kill()
+
+	bobNode, bob := h.accept(t, layer, true)
+	defer bobNode.Kill()
+
+	// Peers may be tagged before they complete the handshake which establishes their ID.
+	manager.Tag(alice, "validator")
+
+	skademlia.WaitUntilAuthenticated(alice)
+	skademlia.WaitUntilAuthenticated(bob)
+
+	// Peers may be tagged by their ID without any reference to their connection.
+	manager.TagID(protocol.PeerID(bob), "bootstrap")
+
+	assert.Equal(t, []string{"validator"}, manager.Tags(alice))
+	assert.Equal(t, []string{"bootstrap"}, manager.Tags(bob))
+
+	// Tags stick to the ID of a peer should it reconnect.
+	alice.Disconnect()
+
+	alice = h.redial(t, aliceNode)
+	skademlia.WaitUntilAuthenticated(alice)
+
+	assert.Equal(t, []string{"validator"}, manager.Tags(alice))
+	assert.Equal(t, 1, manager.Count("validator"))
+
+	manager.UntagID(protocol.PeerID(alice), "validator")
+	assert.Empty(t, manager.Tags(alice))
+}
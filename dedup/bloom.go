@@ -0,0 +1,142 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"github.com/perlin-network/noise/clock"
+	"golang.org/x/crypto/blake2b"
+	"math"
+	"sync"
+	"time"
+)
+
+var _ Backend = (*Bloom)(nil)
+
+// Bloom is a probabilistic, fixed-memory backend comprised of two rotating bloom filters.
+//
+// Keys are inserted into the current generation, and looked up in both the current and
+// previous generation. Once the current generation holds its capacity of keys, or has been
+// alive for longer than the TTL, the previous generation is dropped and a fresh generation
+// takes its place.
+//
+// False positives may occur at approximately the configured rate; false negatives never
+// occur so long as a key was inserted within the last generation.
+type Bloom struct {
+	sync.Mutex
+
+	capacity int
+	ttl      time.Duration
+	clock    clock.Clock
+
+	numBits, numHashes uint64
+
+	current, previous *bloomFilter
+}
+
+type bloomFilter struct {
+	bits    []uint64
+	count   int
+	created time.Time
+}
+
+// NewBloom returns a new bloom filter backend sized to hold capacity keys per generation
+// with a specified false positive rate. A TTL of zero disables time-based rotation.
+func NewBloom(capacity int, falsePositiveRate float64, ttl time.Duration) *Bloom {
+	if capacity <= 0 {
+		panic("dedup: bloom capacity must be greater than zero")
+	}
+
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		panic("dedup: bloom false positive rate must be within (0, 1)")
+	}
+
+	numBits := uint64(math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	numHashes := uint64(math.Ceil(float64(numBits) / float64(capacity) * math.Ln2))
+
+	if numHashes < 1 {
+		numHashes = 1
+	}
+
+	b := &Bloom{
+		capacity:  capacity,
+		ttl:       ttl,
+		numBits:   numBits,
+		numHashes: numHashes,
+		clock:     clock.New(),
+	}
+
+	b.current, b.previous = b.newFilter(b.clock.Now()), b.newFilter(b.clock.Now())
+
+	return b
+}
+
+// WithClock sets the clock generations are rotated against. It defaults to the system clock.
+func (b *Bloom) WithClock(clock clock.Clock) *Bloom {
+	b.Lock()
+	defer b.Unlock()
+
+	b.clock = clock
+	b.current.created, b.previous.created = clock.Now(), clock.Now()
+
+	return b
+}
+
+func (b *Bloom) MarkSeen(key []byte) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	now := b.clock.Now()
+
+	if b.current.count >= b.capacity || (b.ttl > 0 && now.Sub(b.current.created) > b.ttl) {
+		b.previous, b.current = b.current, b.newFilter(now)
+	}
+
+	h1, h2 := b.hashes(key)
+
+	if b.current.test(h1, h2, b.numBits, b.numHashes) {
+		return true
+	}
+
+	seen := b.previous.test(h1, h2, b.numBits, b.numHashes)
+
+	b.current.add(h1, h2, b.numBits, b.numHashes)
+	b.current.count++
+
+	return seen
+}
+
+// Len returns the approximate number of keys tracked across both generations.
+func (b *Bloom) Len() int {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.current.count + b.previous.count
+}
+
+func (b *Bloom) newFilter(now time.Time) *bloomFilter {
+	return &bloomFilter{bits: make([]uint64, (b.numBits+63)/64), created: now}
+}
+
+// hashes derives two independent 64-bit hashes of a key for the purpose of double hashing.
+func (b *Bloom) hashes(key []byte) (uint64, uint64) {
+	digest := blake2b.Sum256(key)
+	return binary.LittleEndian.Uint64(digest[0:8]), binary.LittleEndian.Uint64(digest[8:16]) | 1
+}
+
+func (f *bloomFilter) add(h1, h2, numBits, numHashes uint64) {
+	for i := uint64(0); i < numHashes; i++ {
+		bit := (h1 + i*h2) % numBits
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *bloomFilter) test(h1, h2, numBits, numHashes uint64) bool {
+	for i := uint64(0); i < numHashes; i++ {
+		bit := (h1 + i*h2) % numBits
+
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,100 @@
+package dedup
+
+import (
+	"container/list"
+	"github.com/perlin-network/noise/clock"
+	"sync"
+	"time"
+)
+
+var _ Backend = (*LRU)(nil)
+
+// LRU is an exact backend which tracks at most a fixed number of keys, evicting the least
+// recently seen key once full. Keys may optionally expire after a specified TTL.
+type LRU struct {
+	sync.Mutex
+
+	size  int
+	ttl   time.Duration
+	clock clock.Clock
+
+	entries map[string]*list.Element
+	order   list.List
+}
+
+type lruEntry struct {
+	key  string
+	seen time.Time
+}
+
+// NewLRU returns a new LRU backend holding at most size keys. A TTL of zero disables
+// expiry of keys.
+func NewLRU(size int, ttl time.Duration) *LRU {
+	if size <= 0 {
+		panic("dedup: lru size must be greater than zero")
+	}
+
+	return &LRU{
+		size:    size,
+		ttl:     ttl,
+		clock:   clock.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+// WithClock sets the clock keys expire against. It defaults to the system clock.
+func (c *LRU) WithClock(clock clock.Clock) *LRU {
+	c.Lock()
+	defer c.Unlock()
+
+	c.clock = clock
+	return c
+}
+
+func (c *LRU) MarkSeen(key []byte) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.clock.Now()
+	c.expire(now)
+
+	if e, exists := c.entries[string(key)]; exists {
+		e.Value.(*lruEntry).seen = now
+		c.order.MoveToFront(e)
+
+		return true
+	}
+
+	c.entries[string(key)] = c.order.PushFront(&lruEntry{key: string(key), seen: now})
+
+	if c.order.Len() > c.size {
+		c.evict(c.order.Back())
+	}
+
+	return false
+}
+
+func (c *LRU) Len() int {
+	c.Lock()
+	defer c.Unlock()
+
+	c.expire(c.clock.Now())
+
+	return c.order.Len()
+}
+
+// expire evicts all keys that have outlived the backends TTL.
+func (c *LRU) expire(now time.Time) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	for e := c.order.Back(); e != nil && now.Sub(e.Value.(*lruEntry).seen) > c.ttl; e = c.order.Back() {
+		c.evict(e)
+	}
+}
+
+func (c *LRU) evict(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*lruEntry).key)
+}
@@ -0,0 +1,87 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"github.com/perlin-network/noise"
+	"github.com/pkg/errors"
+	"hash"
+	"sync"
+)
+
+// Backend represents a set of message hashes that have been seen before.
+type Backend interface {
+	// MarkSeen marks a key as seen, and returns whether or not the key has been
+	// seen before. It must be safe to call from multiple goroutines.
+	MarkSeen(key []byte) bool
+
+	// Len returns the number of keys presently tracked by the backend.
+	Len() int
+}
+
+// Filter deduplicates messages by hashing them, and tracking seen hashes in a backend.
+//
+// It is meant to be shared by gossip and application protocols such that each one does
+// not have to reimplement their own seen-set.
+type Filter struct {
+	backend  Backend
+	hashPool sync.Pool
+}
+
+// New returns a new message deduplication filter backed by an LRU cache holding at most
+// 65536 message hashes, whose messages are hashed using SHA-256.
+func New() *Filter {
+	return NewWithBackend(NewLRU(65536, 0))
+}
+
+// NewWithBackend returns a new message deduplication filter whose message hashes are
+// tracked by a specified backend.
+func NewWithBackend(backend Backend) *Filter {
+	if backend == nil {
+		panic("dedup: cannot have a nil backend")
+	}
+
+	f := &Filter{backend: backend}
+	f.WithHash(sha256.New)
+
+	return f
+}
+
+// WithHash sets the hash function used to hash messages before they are tracked.
+func (f *Filter) WithHash(fn func() hash.Hash) *Filter {
+	f.hashPool = sync.Pool{New: func() interface{} { return fn() }}
+
+	return f
+}
+
+// Seen marks a raw message as seen, and returns whether or not it has been seen before.
+func (f *Filter) Seen(msg []byte) bool {
+	return f.backend.MarkSeen(f.sum(msg))
+}
+
+// SeenMessage marks a message registered to Noise as seen, and returns whether or not
+// it has been seen before. The messages opcode is included in its hash.
+func (f *Filter) SeenMessage(msg noise.Message) (bool, error) {
+	opcode, err := noise.OpcodeFromMessage(msg)
+	if err != nil {
+		return false, errors.Wrap(err, "dedup: could not find opcode registered for message")
+	}
+
+	buf := opcode.Bytes()
+
+	return f.Seen(append(buf[:], msg.Write()...)), nil
+}
+
+// Len returns the number of message hashes presently tracked.
+func (f *Filter) Len() int {
+	return f.backend.Len()
+}
+
+func (f *Filter) sum(msg []byte) []byte {
+	h := f.hashPool.Get().(hash.Hash)
+	defer f.hashPool.Put(h)
+
+	h.Reset()
+	_, _ = h.Write(msg)
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,169 @@
+package dedup
+
+import (
+	"fmt"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/payload"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testMessage struct {
+	text string
+}
+
+func (testMessage) Read(reader payload.Reader) (noise.Message, error) {
+	text, err := reader.ReadString()
+	if err != nil {
+		return nil, err
+	}
+
+	return testMessage{text: text}, nil
+}
+
+func (m testMessage) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.text).Bytes()
+}
+
+func TestLRU(t *testing.T) {
+	t.Parallel()
+
+	lru := NewLRU(2, 0)
+
+	assert.False(t, lru.MarkSeen([]byte("a")))
+	assert.True(t, lru.MarkSeen([]byte("a")))
+	assert.False(t, lru.MarkSeen([]byte("b")))
+
+	// Inserting a third key should evict the least recently seen key 'a'.
+	assert.False(t, lru.MarkSeen([]byte("c")))
+	assert.Equal(t, 2, lru.Len())
+
+	assert.False(t, lru.MarkSeen([]byte("a")))
+	assert.True(t, lru.MarkSeen([]byte("c")))
+}
+
+func TestLRUExpiry(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Now())
+	lru := NewLRU(16, 10*time.Millisecond).WithClock(fake)
+
+	assert.False(t, lru.MarkSeen([]byte("a")))
+	assert.True(t, lru.MarkSeen([]byte("a")))
+
+	fake.Advance(20 * time.Millisecond)
+
+	assert.Equal(t, 0, lru.Len())
+	assert.False(t, lru.MarkSeen([]byte("a")))
+}
+
+func TestBloom(t *testing.T) {
+	t.Parallel()
+
+	bloom := NewBloom(1000, 0.001, 0)
+
+	unseen := 0
+
+	for i := 0; i < 1000; i++ {
+		if !bloom.MarkSeen([]byte(fmt.Sprintf("key %d", i))) {
+			unseen++
+		}
+	}
+
+	assert.True(t, unseen > 980, "only %d out of 1000 fresh keys were reported as unseen", unseen)
+
+	// Keys inserted within the last generation must never be reported as unseen.
+	for i := 0; i < 1000; i++ {
+		assert.True(t, bloom.MarkSeen([]byte(fmt.Sprintf("key %d", i))))
+	}
+
+	falsePositives := 0
+
+	for i := 0; i < 1000; i++ {
+		if bloom.MarkSeen([]byte(fmt.Sprintf("other %d", i))) {
+			falsePositives++
+		}
+	}
+
+	assert.True(t, falsePositives < 20, "got %d false positives", falsePositives)
+}
+
+func TestBloomRotation(t *testing.T) {
+	t.Parallel()
+
+	bloom := NewBloom(10, 0.01, 0)
+
+	assert.False(t, bloom.MarkSeen([]byte("a")))
+
+	// Keys survive one generation of rotation, but not two.
+	for i := 0; i < 10; i++ {
+		bloom.MarkSeen([]byte(fmt.Sprintf("first %d", i)))
+	}
+
+	assert.True(t, bloom.MarkSeen([]byte("a")))
+
+	for i := 0; i < 30; i++ {
+		bloom.MarkSeen([]byte(fmt.Sprintf("second %d", i)))
+	}
+
+	assert.False(t, bloom.MarkSeen([]byte("a")))
+}
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+
+	noise.RegisterMessage(noise.NextAvailableOpcode(), (*testMessage)(nil))
+
+	filter := New()
+
+	seen, err := filter.SeenMessage(testMessage{text: "hello"})
+	assert.NoError(t, err)
+	assert.False(t, seen)
+
+	seen, err = filter.SeenMessage(testMessage{text: "hello"})
+	assert.NoError(t, err)
+	assert.True(t, seen)
+
+	seen, err = filter.SeenMessage(testMessage{text: "world"})
+	assert.NoError(t, err)
+	assert.False(t, seen)
+
+	_, err = filter.SeenMessage(noise.EmptyMessage{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, filter.Len())
+}
+
+func TestFilterConcurrent(t *testing.T) {
+	t.Parallel()
+
+	filter := NewWithBackend(NewBloom(10000, 0.0001, 0))
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+
+	unseen := 0
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				if !filter.Seen([]byte(fmt.Sprintf("message %d", j))) {
+					mutex.Lock()
+					unseen++
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 100, unseen)
+}
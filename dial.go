@@ -0,0 +1,222 @@
+package noise
+
+import (
+	"context"
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDialStagger is how long DialCandidates waits on a dial attempt before starting the next
+// attempt in parallel, as recommended by RFC 8305.
+const DefaultDialStagger = 250 * time.Millisecond
+
+// Candidate is an address a peer may be reachable at, dialed through a transport layer. Should
+// Transport be nil, the address is dialed through our nodes own transport layer.
+type Candidate struct {
+	Address   string
+	Transport transport.Layer
+}
+
+// DialStats are statistics recorded on attempts to dial an address, used to order the candidates
+// provided to DialCandidates.
+type DialStats struct {
+	Successes, Failures uint64
+
+	// Latency is a moving average of how long successful attempts took to connect.
+	Latency time.Duration
+}
+
+type dialStats struct {
+	sync.Mutex
+	DialStats
+}
+
+func (s *dialStats) record(err error, latency time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	if err != nil {
+		s.Failures++
+		return
+	}
+
+	if s.Successes == 0 {
+		s.Latency = latency
+	} else {
+		s.Latency = (s.Latency*7 + latency) / 8
+	}
+
+	s.Successes++
+}
+
+// score returns the ratio of successful attempts to dial an address, smoothed such that addresses
+// never dialed before are ranked in between those that mostly succeed and those that mostly fail.
+func (s DialStats) score() float64 {
+	return float64(s.Successes+1) / float64(s.Successes+s.Failures+2)
+}
+
+// DialStatsOf returns statistics recorded on attempts to dial an address through DialCandidates.
+func (n *Node) DialStatsOf(address string) DialStats {
+	stats, exists := n.dialStats.Load(address)
+	if !exists {
+		return DialStats{}
+	}
+
+	stats.(*dialStats).Lock()
+	defer stats.(*dialStats).Unlock()
+
+	return stats.(*dialStats).DialStats
+}
+
+func (n *Node) recordDial(address string, err error, latency time.Duration) {
+	stats, _ := n.dialStats.LoadOrStore(address, new(dialStats))
+	stats.(*dialStats).record(err, latency)
+}
+
+// SetDialStagger sets how long DialCandidates waits on a dial attempt before starting the next
+// attempt in parallel. It defaults to DefaultDialStagger.
+func (n *Node) SetDialStagger(stagger time.Duration) {
+	atomic.StoreInt64(&n.dialStagger, int64(stagger))
+}
+
+// orderCandidates sorts candidates such that addresses dialed successfully more often, and then
+// more quickly, are dialed first. Candidates otherwise retain the order they were provided in.
+func (n *Node) orderCandidates(candidates []Candidate) []Candidate {
+	ordered := append([]Candidate(nil), candidates...)
+
+	stats := make(map[string]DialStats, len(ordered))
+	for _, candidate := range ordered {
+		stats[candidate.Address] = n.DialStatsOf(candidate.Address)
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := stats[ordered[i].Address], stats[ordered[j].Address]
+
+		if a.score() != b.score() {
+			return a.score() > b.score()
+		}
+
+		return a.Successes > 0 && b.Successes > 0 && a.Latency < b.Latency
+	})
+
+	return ordered
+}
+
+type dialResult struct {
+	candidate Candidate
+	conn      net.Conn
+	err       error
+}
+
+// DialCandidates has our node dial a peer reachable at several addresses, possibly through
+// several transport layers, following the Happy Eyeballs algorithm described in RFC 8305.
+//
+// Candidates are dialed in order of how reliably they were dialed before. Should an attempt not
+// complete within the dial stagger (refer to `SetDialStagger(stagger time.Duration)`), or fail,
+// the next candidate is dialed in parallel. The first connection established is kept, and all
+// other connections established afterwards are closed. Attempts that lose the race yet connect
+// are counted as successes.
+//
+// It returns an error should every candidate fail to be dialed, wrapping the first error.
+func (n *Node) DialCandidates(candidates ...Candidate) (*Peer, error) {
+	var eligible []Candidate
+	var first error
+
+	for _, candidate := range candidates {
+		if err := n.checkDial(candidate.Address); err != nil {
+			if first == nil {
+				first = err
+			}
+
+			continue
+		}
+
+		if candidate.Transport == nil {
+			candidate.Transport = n.transport
+		}
+
+		eligible = append(eligible, candidate)
+	}
+
+	if len(eligible) == 0 {
+		if first == nil {
+			first = errors.New("no candidates to dial were provided")
+		}
+
+		return nil, first
+	}
+
+	eligible = n.orderCandidates(eligible)
+
+	stagger := time.Duration(atomic.LoadInt64(&n.dialStagger))
+	results := make(chan dialResult, len(eligible))
+
+	dial := func(candidate Candidate) {
+		n.group.Go(func(ctx context.Context) error {
+			start := n.clock.Now()
+			conn, err := candidate.Transport.Dial(candidate.Address)
+
+			n.recordDial(candidate.Address, err, n.clock.Since(start))
+
+			results <- dialResult{candidate: candidate, conn: conn, err: err}
+			return nil
+		})
+	}
+
+	next, pending := 0, 0
+
+	for {
+		if next < len(eligible) {
+			dial(eligible[next])
+			next++
+			pending++
+		}
+
+		var timer clock.Timer
+		var staggered <-chan time.Time
+
+		if next < len(eligible) {
+			timer = n.clock.NewTimer(stagger)
+			staggered = timer.C()
+		}
+
+		select {
+		case res := <-results:
+			if timer != nil {
+				timer.Stop()
+			}
+
+			pending--
+
+			if res.err == nil {
+				// Close all connections established by attempts still in flight.
+				n.group.Go(func(ctx context.Context) error {
+					for i := 0; i < pending; i++ {
+						if res := <-results; res.err == nil {
+							res.conn.Close()
+						}
+					}
+
+					return nil
+				})
+
+				return n.DialConn(res.conn), nil
+			}
+
+			if first == nil {
+				first = errors.Wrapf(res.err, "failed to connect to peer %s", res.candidate.Address)
+			}
+
+			if pending == 0 && next == len(eligible) {
+				return nil, first
+			}
+		case <-staggered:
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+// stallingLayer dials addresses through an underlying layer, stalling for a fixed duration
+// should an address be marked as slow.
+type stallingLayer struct {
+	transport.Layer
+
+	slow  map[string]bool
+	delay time.Duration
+}
+
+func (l *stallingLayer) Dial(address string) (net.Conn, error) {
+	if l.slow[address] {
+		time.Sleep(l.delay)
+	}
+
+	return l.Layer.Dial(address)
+}
+
+func TestDialCandidates(t *testing.T) {
+	layer := transport.NewBuffered()
+
+	params := DefaultParams()
+	params.Transport = layer
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go alice.Listen()
+	go bob.Listen()
+
+	unreachable := "127.0.0.1:1"
+
+	// A candidate that fails has the next candidate dialed immediately.
+	peer, err := alice.DialCandidates(Candidate{Address: unreachable}, Candidate{Address: bob.ExternalAddress()})
+	assert.NoError(t, err)
+	peer.Disconnect()
+
+	assert.EqualValues(t, DialStats{Failures: 1}, alice.DialStatsOf(unreachable))
+	assert.EqualValues(t, 1, alice.DialStatsOf(bob.ExternalAddress()).Successes)
+
+	// A candidate that stalls has the next candidate dialed once the stagger elapses.
+	stalling := &stallingLayer{Layer: layer, slow: map[string]bool{"stalled": true}, delay: 3 * time.Second}
+
+	alice.SetDialStagger(10 * time.Millisecond)
+
+	start := time.Now()
+
+	peer, err = alice.DialCandidates(Candidate{Address: "stalled", Transport: stalling}, Candidate{Address: bob.ExternalAddress(), Transport: stalling})
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+	peer.Disconnect()
+
+	// Candidates dialed successfully before are ordered first.
+	ordered := alice.orderCandidates([]Candidate{{Address: unreachable}, {Address: "unknown"}, {Address: bob.ExternalAddress()}})
+	assert.Equal(t, []string{bob.ExternalAddress(), "unknown", unreachable}, []string{ordered[0].Address, ordered[1].Address, ordered[2].Address})
+
+	// Should every candidate fail, the first error is returned.
+	_, err = alice.DialCandidates(Candidate{Address: unreachable}, Candidate{Address: "127.0.0.1:2"})
+	assert.Error(t, err)
+
+	_, err = alice.DialCandidates(Candidate{Address: alice.ExternalAddress()})
+	assert.True(t, errors.Is(err, ErrDialSelf))
+
+	_, err = alice.DialCandidates()
+	assert.Error(t, err)
+}
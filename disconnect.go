@@ -0,0 +1,61 @@
+package noise
+
+import (
+	"fmt"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
+
+var _ Message = (*DisconnectMessage)(nil)
+
+// DisconnectReason is why a peer closed its connection to us, as announced by the peer right
+// before closing the connection.
+type DisconnectReason byte
+
+const (
+	ReasonUnknown DisconnectReason = iota
+	ReasonTooManyPeers
+	ReasonBanned
+	ReasonIncompatibleVersion
+	ReasonShuttingDown
+	ReasonIdle
+)
+
+func (r DisconnectReason) String() string {
+	switch r {
+	case ReasonUnknown:
+		return "unknown"
+	case ReasonTooManyPeers:
+		return "too many peers"
+	case ReasonBanned:
+		return "banned"
+	case ReasonIncompatibleVersion:
+		return "incompatible version"
+	case ReasonShuttingDown:
+		return "shutting down"
+	case ReasonIdle:
+		return "idle"
+	default:
+		return fmt.Sprintf("reason %d", byte(r))
+	}
+}
+
+// DisconnectMessage is the last message sent to a peer before closing the connection to it, and
+// announces why the connection is being closed. It is registered to OpcodeDisconnect, and should
+// be sent through DisconnectWithReason rather than be sent directly.
+type DisconnectMessage struct {
+	Reason DisconnectReason
+}
+
+func (DisconnectMessage) Read(reader payload.Reader) (Message, error) {
+	reason, err := reader.ReadByte()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read disconnect reason")
+	}
+
+	return DisconnectMessage{Reason: DisconnectReason(reason)}, nil
+}
+
+func (m DisconnectMessage) Write() []byte {
+	return payload.NewWriter(nil).WriteByte(byte(m.Reason)).Bytes()
+}
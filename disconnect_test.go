@@ -0,0 +1,127 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDisconnectWithReason(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	params := DefaultParams()
+	params.Transport = layer
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go alice.Listen()
+	go bob.Listen()
+
+	for _, halfClose := range []bool{false, true} {
+		accepted := make(chan *Peer, 1)
+
+		bob.OnPeerConnected(func(node *Node, peer *Peer) error {
+			select {
+			case accepted <- peer:
+			default:
+			}
+			return nil
+		})
+
+		peer, err := alice.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+
+		disconnected := make(chan struct{})
+
+		peer.OnDisconnect(func(node *Node, peer *Peer) error {
+			close(disconnected)
+			return nil
+		})
+
+		var remote *Peer
+
+		select {
+		case remote = <-accepted:
+		case <-time.After(3 * time.Second):
+			t.Fatal("bob never accepted alice")
+		}
+
+		_, announced := peer.RemoteDisconnectReason()
+		assert.False(t, announced)
+
+		// Reasons are announced even after the connection was half-closed.
+		if halfClose {
+			assert.NoError(t, remote.CloseWrite())
+		}
+
+		<-remote.DisconnectWithReason(ReasonShuttingDown)
+
+		select {
+		case <-disconnected:
+		case <-time.After(3 * time.Second):
+			t.Fatal("alice was never disconnected from bob")
+		}
+
+		reason, announced := peer.RemoteDisconnectReason()
+		assert.True(t, announced)
+		assert.Equal(t, ReasonShuttingDown, reason)
+	}
+
+	// Disconnect messages may not be sent directly.
+	assert.Error(t, newPeer(nil, nil).checkSend(DisconnectMessage{}))
+}
+
+func TestShutdownAnnouncesReason(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	disconnected := make(chan struct{})
+
+	peer.OnDisconnect(func(node *Node, peer *Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	for i := 0; i < 100 && len(bob.Peers()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	bob.Kill()
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("alice was never disconnected from bob")
+	}
+
+	reason, announced := peer.RemoteDisconnectReason()
+	assert.True(t, announced)
+	assert.Equal(t, ReasonShuttingDown, reason)
+}
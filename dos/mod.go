@@ -0,0 +1,329 @@
+// Package dos evaluates DoS heuristics against what every host our node is connected to sends us,
+// and logs, throttles, disconnects or bans hosts which trigger them.
+//
+// Heuristics are written as rules in a small language, such as rate thresholds, message size
+// patterns, and ratios of messages which fail to be decrypted, and may be replaced while our node
+// runs, such that operators may respond to novel attacks without changing any code. Metrics are
+// recorded per host IP rather than per connection, such that hosts may not evade rules by
+// reconnecting.
+package dos
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/pkg/errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Engine evaluates rules against the metrics recorded of every host.
+type Engine struct {
+	sync.Mutex
+
+	rules      []Rule
+	resolution time.Duration
+
+	hosts     map[string]*host
+	lastPrune time.Time
+
+	onTrigger []func(node *noise.Node, ip net.IP, rule Rule)
+}
+
+type host struct {
+	ip    net.IP
+	peers map[*noise.Peer]struct{}
+
+	windows map[Metric]*window
+
+	// cooldowns are when every rule, by its index, may be triggered again.
+	cooldowns map[int]time.Time
+
+	// pausedUntil is when messages from the host may be read again should it be throttled.
+	pausedUntil time.Time
+}
+
+// New returns an engine with no rules.
+func New() *Engine {
+	return &Engine{resolution: time.Second / numSlots, hosts: make(map[string]*host)}
+}
+
+// Load parses rules, and replaces the rules of the engine with them. The rules of the engine are
+// left as is should any rule fail to be parsed.
+func (e *Engine) Load(text string) error {
+	rules, err := Parse(text)
+	if err != nil {
+		return err
+	}
+
+	e.Set(rules)
+	return nil
+}
+
+// Set replaces the rules of the engine. Metrics recorded beforehand are kept, unless the rules are
+// evaluated over a different longest window than before.
+func (e *Engine) Set(rules []Rule) {
+	var longest time.Duration
+
+	for _, rule := range rules {
+		if w := rule.window(); w > longest {
+			longest = w
+		}
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	// Without any rules, metrics are kept as they were recorded.
+	resolution := e.resolution
+
+	if longest > 0 {
+		resolution = longest / numSlots
+		if resolution < time.Millisecond {
+			resolution = time.Millisecond
+		}
+	}
+
+	e.rules = append([]Rule(nil), rules...)
+
+	for _, h := range e.hosts {
+		h.cooldowns = make(map[int]time.Time)
+
+		if resolution != e.resolution {
+			h.windows = make(map[Metric]*window)
+		}
+	}
+
+	e.resolution = resolution
+}
+
+// Rules returns the rules of the engine.
+func (e *Engine) Rules() []Rule {
+	e.Lock()
+	defer e.Unlock()
+
+	return append([]Rule(nil), e.rules...)
+}
+
+// OnTrigger registers a callback which is called whenever a host triggers a rule, after the action
+// of the rule is taken.
+func (e *Engine) OnTrigger(fn func(node *noise.Node, ip net.IP, rule Rule)) *Engine {
+	e.Lock()
+	e.onTrigger = append(e.onTrigger, fn)
+	e.Unlock()
+
+	return e
+}
+
+// Watch records the metrics of every peer which connects to, or is dialed by, a node from then on.
+func (e *Engine) Watch(node *noise.Node) *Engine {
+	node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+		e.connected(node, peer)
+
+		peer.BeforeMessageReceived(func(node *noise.Node, peer *noise.Peer, msg []byte) ([]byte, error) {
+			e.wait(node, peer)
+			e.record(node, peer, map[Metric]float64{MetricMessages: 1, MetricBytes: float64(len(msg))})
+
+			return msg, nil
+		})
+
+		peer.OnConnError(func(node *noise.Node, peer *noise.Peer, err error) error {
+			values := map[Metric]float64{MetricErrors: 1}
+
+			// Messages which fail to be decrypted never make it to BeforeMessageReceived.
+			if errors.Is(err, noise.ErrDecryptFailed) {
+				values[MetricDecryptFailures] = 1
+				values[MetricMessages] = 1
+			}
+
+			e.record(node, peer, values)
+			return nil
+		})
+
+		peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+			e.disconnected(node, peer)
+			return nil
+		})
+
+		return nil
+	})
+
+	return e
+}
+
+func (e *Engine) connected(node *noise.Node, peer *noise.Peer) {
+	now := node.Clock().Now()
+
+	e.Lock()
+
+	e.prune(now)
+
+	key := peer.RemoteIP().String()
+
+	h, exists := e.hosts[key]
+	if !exists {
+		h = &host{
+			ip:        peer.RemoteIP(),
+			peers:     make(map[*noise.Peer]struct{}),
+			windows:   make(map[Metric]*window),
+			cooldowns: make(map[int]time.Time),
+		}
+
+		e.hosts[key] = h
+	}
+
+	h.peers[peer] = struct{}{}
+
+	e.Unlock()
+
+	e.record(node, peer, map[Metric]float64{MetricConnections: 1})
+}
+
+func (e *Engine) disconnected(node *noise.Node, peer *noise.Peer) {
+	e.Lock()
+	defer e.Unlock()
+
+	key := peer.RemoteIP().String()
+
+	if h, exists := e.hosts[key]; exists {
+		delete(h.peers, peer)
+	}
+}
+
+// prune forgets hosts which have no peers, and which have had nothing recorded within the longest
+// window of any rule. Hosts are pruned at most once every longest window.
+func (e *Engine) prune(now time.Time) {
+	span := e.resolution * numSlots
+
+	if now.Sub(e.lastPrune) < span {
+		return
+	}
+
+	e.lastPrune = now
+
+	for key, h := range e.hosts {
+		if len(h.peers) > 0 || now.Before(h.pausedUntil) {
+			continue
+		}
+
+		idle := true
+
+		for _, w := range h.windows {
+			if !w.idle(now) {
+				idle = false
+				break
+			}
+		}
+
+		if idle {
+			delete(e.hosts, key)
+		}
+	}
+}
+
+// wait blocks should the host of a peer be throttled, until the host is no longer throttled.
+func (e *Engine) wait(node *noise.Node, peer *noise.Peer) {
+	e.Lock()
+
+	var until time.Time
+
+	if h, exists := e.hosts[peer.RemoteIP().String()]; exists {
+		until = h.pausedUntil
+	}
+
+	e.Unlock()
+
+	if d := until.Sub(node.Clock().Now()); d > 0 {
+		<-node.Clock().After(d)
+	}
+}
+
+// record records values of metrics for the host of a peer, evaluates every rule against the host,
+// and takes the actions of the rules triggered.
+func (e *Engine) record(node *noise.Node, peer *noise.Peer, values map[Metric]float64) {
+	now := node.Clock().Now()
+
+	e.Lock()
+
+	h, exists := e.hosts[peer.RemoteIP().String()]
+	if !exists {
+		e.Unlock()
+		return
+	}
+
+	for metric, value := range values {
+		w, exists := h.windows[metric]
+		if !exists {
+			w = newWindow(e.resolution)
+			h.windows[metric] = w
+		}
+
+		w.add(now, value)
+	}
+
+	lookup := func(metric Metric, length time.Duration) stats {
+		if w, exists := h.windows[metric]; exists {
+			return w.stats(now, length)
+		}
+
+		return stats{}
+	}
+
+	var triggered []Rule
+
+	for i, rule := range e.rules {
+		if now.Before(h.cooldowns[i]) || !rule.condition.holds(lookup) {
+			continue
+		}
+
+		// A rule is not triggered again for a host until its action lapses, or until the metrics
+		// which triggered it have left its window.
+		h.cooldowns[i] = now.Add(longest(rule.Duration, rule.window()))
+
+		if rule.Action == ActionThrottle {
+			h.pausedUntil = now.Add(rule.Duration)
+		}
+
+		triggered = append(triggered, rule)
+	}
+
+	peers := make([]*noise.Peer, 0, len(h.peers))
+	for peer := range h.peers {
+		peers = append(peers, peer)
+	}
+
+	callbacks := e.onTrigger
+
+	e.Unlock()
+
+	for _, rule := range triggered {
+		e.act(node, h.ip, peers, rule)
+
+		for _, fn := range callbacks {
+			fn(node, h.ip, rule)
+		}
+	}
+}
+
+func (e *Engine) act(node *noise.Node, ip net.IP, peers []*noise.Peer, rule Rule) {
+	log.Warn().
+		Str("ip", ip.String()).
+		Str("action", string(rule.Action)).
+		Str("rule", rule.String()).
+		Msg("A host triggered a DoS heuristic.")
+
+	switch rule.Action {
+	case ActionBan:
+		node.Ban(ip, rule.Duration)
+
+		for _, peer := range peers {
+			peer.DisconnectWithReason(noise.ReasonBanned)
+		}
+	case ActionDisconnect:
+		// Hosts are not told why they were disconnected, such that they may not probe which rules
+		// they trigger.
+		for _, peer := range peers {
+			peer.DisconnectAsync()
+		}
+	}
+}
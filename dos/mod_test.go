@@ -0,0 +1,229 @@
+package dos
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+type testMsg struct {
+	text string
+}
+
+func (testMsg) Read(reader payload.Reader) (noise.Message, error) {
+	text, err := reader.ReadString()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read test message")
+	}
+
+	return testMsg{text: text}, nil
+}
+
+func (m testMsg) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.text).Bytes()
+}
+
+var opcodeTest = noise.RegisterMessage(noise.NextAvailableOpcode(), (*testMsg)(nil))
+
+// guarded returns a node watched by an engine, which receives every test message into a channel.
+func guarded(t *testing.T, layer transport.Layer, rules string) (*noise.Node, *Engine, <-chan time.Time) {
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	engine := New().Watch(node)
+	assert.NoError(t, engine.Load(rules))
+
+	received := make(chan time.Time, 64)
+
+	node.OnMessageReceived(opcodeTest, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		received <- time.Now()
+		return nil
+	})
+
+	go node.Listen()
+
+	return node, engine, received
+}
+
+func newClient(t *testing.T, layer transport.Layer) *noise.Node {
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	return node
+}
+
+// disconnections reports every peer of a node which disconnects.
+func disconnections(node *noise.Node) <-chan *noise.Peer {
+	disconnected := make(chan *noise.Peer, 16)
+
+	node.OnPeerDisconnected(func(node *noise.Node, peer *noise.Peer) error {
+		disconnected <- peer
+		return nil
+	})
+
+	return disconnected
+}
+
+func waitUntilDisconnected(t *testing.T, disconnected <-chan *noise.Peer, peers ...*noise.Peer) {
+	pending := make(map[*noise.Peer]struct{})
+	for _, peer := range peers {
+		pending[peer] = struct{}{}
+	}
+
+	for len(pending) > 0 {
+		select {
+		case peer := <-disconnected:
+			delete(pending, peer)
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for peers to be disconnected")
+		}
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	server, _, received := guarded(t, layer, "disconnect when count(messages, 10s) > 3")
+	defer server.Kill()
+
+	client := newClient(t, layer)
+	defer client.Kill()
+
+	disconnected := disconnections(client)
+
+	peer, err := client.Dial(server.ExternalAddress())
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, peer.SendMessage(testMsg{text: "hello"}))
+		<-received
+	}
+
+	assert.NoError(t, peer.SendMessage(testMsg{text: "one too many"}))
+	waitUntilDisconnected(t, disconnected, peer)
+
+	// The host is disconnected, but not banned.
+	assert.False(t, server.IsBanned(peer.RemoteIP()))
+}
+
+func TestBan(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	server, engine, _ := guarded(t, layer, "ban 1m when count(connections, 10s) >= 2")
+	defer server.Kill()
+
+	triggered := make(chan Rule, 1)
+
+	engine.OnTrigger(func(node *noise.Node, ip net.IP, rule Rule) {
+		triggered <- rule
+	})
+
+	client := newClient(t, layer)
+	defer client.Kill()
+
+	disconnected := disconnections(client)
+
+	first, err := client.Dial(server.ExternalAddress())
+	assert.NoError(t, err)
+
+	second, err := client.Dial(server.ExternalAddress())
+	assert.NoError(t, err)
+
+	select {
+	case rule := <-triggered:
+		assert.Equal(t, ActionBan, rule.Action)
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the rule to be triggered")
+	}
+
+	// Every peer of the host is disconnected once the host is banned.
+	waitUntilDisconnected(t, disconnected, first, second)
+
+	assert.True(t, server.IsBanned(first.RemoteIP()))
+}
+
+func TestThrottle(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	server, _, received := guarded(t, layer, "throttle 200ms when count(messages, 10s) >= 2")
+	defer server.Kill()
+
+	client := newClient(t, layer)
+	defer client.Kill()
+
+	peer, err := client.Dial(server.ExternalAddress())
+	assert.NoError(t, err)
+
+	var times []time.Time
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, peer.SendMessage(testMsg{text: "hello"}))
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case at := <-received:
+			times = append(times, at)
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for messages")
+		}
+	}
+
+	// The second message triggers the rule, which holds up reading the third message.
+	assert.True(t, times[2].Sub(times[1]) >= 150*time.Millisecond, "third message arrived after %s", times[2].Sub(times[1]))
+}
+
+func TestLoadAtRuntime(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	server, engine, received := guarded(t, layer, "log when count(messages, 1s) > 100")
+	defer server.Kill()
+
+	client := newClient(t, layer)
+	defer client.Kill()
+
+	disconnected := disconnections(client)
+
+	peer, err := client.Dial(server.ExternalAddress())
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, peer.SendMessage(testMsg{text: "hello"}))
+		<-received
+	}
+
+	// Invalid rules leave the rules of the engine as is.
+	assert.Error(t, engine.Load("disconnect when"))
+	assert.Equal(t, "log when count(messages, 1s) > 100", engine.Rules()[0].String())
+
+	// Metrics recorded before the rules were loaded are taken into account.
+	assert.NoError(t, engine.Load("disconnect when count(messages, 1s) > 3"))
+	assert.Len(t, engine.Rules(), 1)
+
+	assert.NoError(t, peer.SendMessage(testMsg{text: "one too many"}))
+	waitUntilDisconnected(t, disconnected, peer)
+}
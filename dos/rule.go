@@ -0,0 +1,461 @@
+package dos
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrSyntax = errors.New("dos: invalid rule")
+
+// Action is what is done to a host once a rule is triggered.
+type Action string
+
+const (
+	// ActionLog only logs that the rule was triggered, and calls callbacks registered through
+	// OnTrigger.
+	ActionLog Action = "log"
+
+	// ActionThrottle stops reading messages from every peer of the host for the duration of the
+	// rule.
+	ActionThrottle Action = "throttle"
+
+	// ActionDisconnect disconnects every peer of the host.
+	ActionDisconnect Action = "disconnect"
+
+	// ActionBan bans the host for the duration of the rule, or indefinitely should the rule have no
+	// duration, and disconnects every peer of the host.
+	ActionBan Action = "ban"
+)
+
+// Metric is something recorded about every host, which rules are evaluated against.
+type Metric string
+
+const (
+	// MetricMessages counts every message received, including messages which fail to be decrypted.
+	MetricMessages Metric = "messages"
+
+	// MetricBytes records the size of every message received, once decrypted.
+	MetricBytes Metric = "bytes"
+
+	// MetricDecryptFailures counts every message which fails to be decrypted.
+	MetricDecryptFailures Metric = "decrypt_failures"
+
+	// MetricErrors counts every error reported on a connection, including decrypt failures.
+	MetricErrors Metric = "errors"
+
+	// MetricConnections counts every connection established.
+	MetricConnections Metric = "connections"
+)
+
+var metrics = []Metric{MetricMessages, MetricBytes, MetricDecryptFailures, MetricErrors, MetricConnections}
+
+// Rule triggers an action once its condition holds for a host. Rules are written as
+//
+//	<action> [duration] when <condition>
+//
+// where a condition compares functions of metrics over windows of time against numbers, and may be
+// combined with "and", "or", and parentheses, such as
+//
+//	ban 10m when rate(messages, 1s) > 500
+//	throttle 5s when rate(bytes, 10s) > 1048576
+//	disconnect when max(bytes, 1m) > 60000 and count(messages, 1m) < 5
+//	ban 1h when ratio(decrypt_failures, messages, 1m) > 0.2 and count(messages, 1m) >= 10
+//
+// The functions available are count, sum, rate (sum per second), mean, max, and ratio, which
+// divides the sum of one metric by the sum of another.
+type Rule struct {
+	Action   Action
+	Duration time.Duration
+
+	condition condition
+	text      string
+}
+
+// String returns the rule as it was written.
+func (r Rule) String() string {
+	return r.text
+}
+
+// window returns the longest window the rule is evaluated over.
+func (r Rule) window() time.Duration {
+	return r.condition.window()
+}
+
+// Parse parses rules written one per line. Blank lines, and lines starting with '#', are skipped.
+func Parse(text string) ([]Rule, error) {
+	var rules []Rule
+
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule, err := ParseRule(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", i+1)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// ParseRule parses a single rule.
+func ParseRule(text string) (Rule, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	p := &parser{tokens: tokens}
+	rule := Rule{text: strings.TrimSpace(text)}
+
+	switch action := Action(p.next()); action {
+	case ActionLog, ActionThrottle, ActionDisconnect, ActionBan:
+		rule.Action = action
+	default:
+		return Rule{}, errors.Wrapf(ErrSyntax, "unknown action %q", action)
+	}
+
+	if p.peek() != "when" {
+		if rule.Duration, err = time.ParseDuration(p.next()); err != nil || rule.Duration <= 0 {
+			return Rule{}, errors.Wrap(ErrSyntax, "expected a positive duration or 'when' after the action")
+		}
+	}
+
+	if rule.Action == ActionThrottle && rule.Duration == 0 {
+		return Rule{}, errors.Wrap(ErrSyntax, "throttling requires a duration")
+	}
+
+	if err := p.expect("when"); err != nil {
+		return Rule{}, err
+	}
+
+	if rule.condition, err = p.or(); err != nil {
+		return Rule{}, err
+	}
+
+	if p.peek() != "" {
+		return Rule{}, errors.Wrapf(ErrSyntax, "unexpected %q", p.peek())
+	}
+
+	return rule, nil
+}
+
+func tokenize(text string) ([]string, error) {
+	var tokens []string
+
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("(),", r):
+			tokens = append(tokens, string(r))
+			i++
+		case strings.ContainsRune("<>=!", r):
+			j := i + 1
+			if j < len(runes) && runes[j] == '=' {
+				j++
+			}
+
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == '_') {
+				j++
+			}
+
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			return nil, errors.Wrapf(ErrSyntax, "unexpected character %q", r)
+		}
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []string
+}
+
+func (p *parser) peek() string {
+	if len(p.tokens) == 0 {
+		return ""
+	}
+
+	return p.tokens[0]
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+
+	if len(p.tokens) > 0 {
+		p.tokens = p.tokens[1:]
+	}
+
+	return token
+}
+
+func (p *parser) expect(token string) error {
+	if got := p.next(); got != token {
+		if got == "" {
+			got = "end of rule"
+		}
+
+		return errors.Wrapf(ErrSyntax, "expected %q, got %q", token, got)
+	}
+
+	return nil
+}
+
+// or parses conditions joined by "or", which binds looser than "and".
+func (p *parser) or() (condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "or" {
+		p.next()
+
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		left = either{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) and() (condition, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "and" {
+		p.next()
+
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+
+		left = both{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) comparison() (condition, error) {
+	if p.peek() == "(" {
+		p.next()
+
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		return c, p.expect(")")
+	}
+
+	f, err := p.function()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.next()
+
+	switch op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return nil, errors.Wrapf(ErrSyntax, "expected a comparison after %s, got %q", f, op)
+	}
+
+	threshold, err := strconv.ParseFloat(p.next(), 64)
+	if err != nil {
+		return nil, errors.Wrapf(ErrSyntax, "expected a number after %s %s", f, op)
+	}
+
+	return comparison{function: f, op: op, threshold: threshold}, nil
+}
+
+func (p *parser) function() (function, error) {
+	f := function{name: p.next()}
+
+	arity := 1
+
+	switch f.name {
+	case "count", "sum", "rate", "mean", "max":
+	case "ratio":
+		arity = 2
+	default:
+		return f, errors.Wrapf(ErrSyntax, "unknown function %q", f.name)
+	}
+
+	if err := p.expect("("); err != nil {
+		return f, err
+	}
+
+	for i := 0; i < arity; i++ {
+		m := Metric(p.next())
+		if !known(m) {
+			return f, errors.Wrapf(ErrSyntax, "unknown metric %q", m)
+		}
+
+		f.metrics = append(f.metrics, m)
+
+		if err := p.expect(","); err != nil {
+			return f, err
+		}
+	}
+
+	window, err := time.ParseDuration(p.next())
+	if err != nil || window <= 0 {
+		return f, errors.Wrapf(ErrSyntax, "expected a positive window in %s()", f.name)
+	}
+
+	f.window = window
+
+	return f, p.expect(")")
+}
+
+func known(m Metric) bool {
+	for _, metric := range metrics {
+		if m == metric {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stats are the statistics of a metric within a window.
+type stats struct {
+	count    uint64
+	sum, max float64
+}
+
+// lookup returns the statistics of a metric within a window.
+type lookup func(metric Metric, window time.Duration) stats
+
+type condition interface {
+	holds(lookup lookup) bool
+	window() time.Duration
+}
+
+type either struct{ left, right condition }
+
+func (c either) holds(lookup lookup) bool {
+	return c.left.holds(lookup) || c.right.holds(lookup)
+}
+
+func (c either) window() time.Duration {
+	return longest(c.left.window(), c.right.window())
+}
+
+type both struct{ left, right condition }
+
+func (c both) holds(lookup lookup) bool {
+	return c.left.holds(lookup) && c.right.holds(lookup)
+}
+
+func (c both) window() time.Duration {
+	return longest(c.left.window(), c.right.window())
+}
+
+type comparison struct {
+	function  function
+	op        string
+	threshold float64
+}
+
+func (c comparison) holds(lookup lookup) bool {
+	value := c.function.eval(lookup)
+
+	switch c.op {
+	case ">":
+		return value > c.threshold
+	case ">=":
+		return value >= c.threshold
+	case "<":
+		return value < c.threshold
+	case "<=":
+		return value <= c.threshold
+	case "==":
+		return value == c.threshold
+	default:
+		return value != c.threshold
+	}
+}
+
+func (c comparison) window() time.Duration {
+	return c.function.window
+}
+
+type function struct {
+	name    string
+	metrics []Metric
+	window  time.Duration
+}
+
+func (f function) String() string {
+	args := make([]string, 0, len(f.metrics)+1)
+
+	for _, m := range f.metrics {
+		args = append(args, string(m))
+	}
+
+	return fmt.Sprintf("%s(%s)", f.name, strings.Join(append(args, f.window.String()), ", "))
+}
+
+func (f function) eval(lookup lookup) float64 {
+	s := lookup(f.metrics[0], f.window)
+
+	switch f.name {
+	case "count":
+		return float64(s.count)
+	case "sum":
+		return s.sum
+	case "rate":
+		return s.sum / f.window.Seconds()
+	case "mean":
+		if s.count == 0 {
+			return 0
+		}
+
+		return s.sum / float64(s.count)
+	case "max":
+		return s.max
+	default:
+		total := lookup(f.metrics[1], f.window).sum
+		if total == 0 {
+			return 0
+		}
+
+		return s.sum / total
+	}
+}
+
+func longest(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,134 @@
+package dos
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	rules, err := Parse(`
+		# Floods of messages.
+		ban 10m when rate(messages, 1s) > 500
+
+		throttle 5s when rate(bytes, 10s) > 1048576
+		disconnect when max(bytes, 1m) > 60000 and count(messages, 1m) < 5
+		ban when ratio(decrypt_failures, messages, 1m) > 0.2 and (count(messages, 1m) >= 10 or sum(errors, 5m) > 100)
+		log when mean(bytes, 30s) <= 8
+	`)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 5)
+
+	assert.Equal(t, ActionBan, rules[0].Action)
+	assert.Equal(t, 10*time.Minute, rules[0].Duration)
+	assert.Equal(t, "ban 10m when rate(messages, 1s) > 500", rules[0].String())
+	assert.Equal(t, time.Second, rules[0].window())
+
+	assert.Equal(t, ActionThrottle, rules[1].Action)
+	assert.Equal(t, ActionDisconnect, rules[2].Action)
+	assert.Zero(t, rules[2].Duration)
+
+	assert.Equal(t, ActionBan, rules[3].Action)
+	assert.Zero(t, rules[3].Duration)
+	assert.Equal(t, 5*time.Minute, rules[3].window())
+
+	assert.Equal(t, ActionLog, rules[4].Action)
+}
+
+func TestParseErrors(t *testing.T) {
+	invalid := []string{
+		"",
+		"kick when count(messages, 1s) > 1",
+		"ban forever when count(messages, 1s) > 1",
+		"throttle when count(messages, 1s) > 1",
+		"ban 1m count(messages, 1s) > 1",
+		"ban 1m when",
+		"ban 1m when median(messages, 1s) > 1",
+		"ban 1m when count(packets, 1s) > 1",
+		"ban 1m when count(messages) > 1",
+		"ban 1m when count(messages, 0s) > 1",
+		"ban 1m when ratio(messages, 1s) > 1",
+		"ban 1m when count(messages, 1s) ~ 1",
+		"ban 1m when count(messages, 1s) > many",
+		"ban 1m when count(messages, 1s) > 1 and",
+		"ban 1m when (count(messages, 1s) > 1",
+		"ban 1m when count(messages, 1s) > 1 extra",
+	}
+
+	for _, rule := range invalid {
+		_, err := ParseRule(rule)
+		assert.True(t, errors.Is(err, ErrSyntax), "rule %q parsed: %v", rule, err)
+	}
+
+	// Errors in rules report the line they are on.
+	_, err := Parse("log when count(messages, 1s) > 1\nban sometimes when count(messages, 1s) > 1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestEvaluate(t *testing.T) {
+	recorded := map[Metric]stats{
+		MetricMessages:        {count: 20, sum: 20, max: 1},
+		MetricBytes:           {count: 16, sum: 1600, max: 400},
+		MetricDecryptFailures: {count: 4, sum: 4, max: 1},
+	}
+
+	lookup := func(metric Metric, window time.Duration) stats {
+		return recorded[metric]
+	}
+
+	tests := map[string]bool{
+		"log when count(messages, 1s) == 20":                                                     true,
+		"log when count(messages, 1s) != 20":                                                     false,
+		"log when rate(messages, 10s) >= 2":                                                      true,
+		"log when rate(messages, 10s) > 2":                                                       false,
+		"log when sum(bytes, 1s) > 1000":                                                         true,
+		"log when mean(bytes, 1s) == 100":                                                        true,
+		"log when max(bytes, 1s) < 400":                                                          false,
+		"log when ratio(decrypt_failures, messages, 1s) == 0.2":                                  true,
+		"log when ratio(messages, connections, 1s) > 0":                                          false,
+		"log when mean(connections, 1s) > 0":                                                     false,
+		"log when count(messages, 1s) > 100 or max(bytes, 1s) >= 400":                            true,
+		"log when count(messages, 1s) > 100 or max(bytes, 1s) > 400":                             false,
+		"log when count(messages, 1s) > 1 and count(messages, 1s) > 100":                         false,
+		"log when count(messages, 1s) > 100 and count(messages, 1s) > 1 or max(bytes, 1s) > 1":   true,
+		"log when count(messages, 1s) > 100 and (count(messages, 1s) > 1 or max(bytes, 1s) > 1)": false,
+	}
+
+	for text, expected := range tests {
+		rule, err := ParseRule(text)
+		if !assert.NoError(t, err, text) {
+			continue
+		}
+
+		assert.Equal(t, expected, rule.condition.holds(lookup), text)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	start := time.Unix(1000, 0)
+	w := newWindow(100 * time.Millisecond)
+
+	assert.True(t, w.idle(start))
+
+	for i := 0; i < 10; i++ {
+		w.add(start.Add(time.Duration(i)*100*time.Millisecond), float64(i))
+	}
+
+	now := start.Add(900 * time.Millisecond)
+
+	assert.Equal(t, stats{count: 10, sum: 45, max: 9}, w.stats(now, time.Second))
+	assert.Equal(t, stats{count: 2, sum: 17, max: 9}, w.stats(now, 200*time.Millisecond))
+
+	// Windows are rounded up to whole slots.
+	assert.Equal(t, stats{count: 2, sum: 17, max: 9}, w.stats(now, 150*time.Millisecond))
+
+	// Slots expire once a full ring of slots has passed.
+	later := start.Add(numSlots * 100 * time.Millisecond)
+	assert.Equal(t, stats{count: 9, sum: 45, max: 9}, w.stats(later, time.Hour))
+
+	assert.False(t, w.idle(later))
+	assert.True(t, w.idle(start.Add(time.Hour)))
+	assert.Equal(t, stats{}, w.stats(start.Add(time.Hour), time.Hour))
+}
@@ -0,0 +1,84 @@
+package dos
+
+import (
+	"math"
+	"time"
+)
+
+// numSlots is how many slots a window is split into. Windows shorter than the longest window any
+// rule is evaluated over are rounded up to a whole number of slots.
+const numSlots = 64
+
+// window records the statistics of a metric over the longest window any rule is evaluated over, in
+// a ring of slots each spanning an equal share of the window.
+type window struct {
+	resolution time.Duration
+	slots      [numSlots]slot
+}
+
+type slot struct {
+	index int64
+	stats
+}
+
+func newWindow(resolution time.Duration) *window {
+	w := &window{resolution: resolution}
+
+	for i := range w.slots {
+		w.slots[i].index = -1
+	}
+
+	return w
+}
+
+// add records a value at a point in time.
+func (w *window) add(now time.Time, value float64) {
+	index := now.UnixNano() / int64(w.resolution)
+	s := &w.slots[index%numSlots]
+
+	if s.index != index {
+		*s = slot{index: index}
+	}
+
+	s.count++
+	s.sum += value
+	s.max = math.Max(s.max, value)
+}
+
+// stats returns the statistics of the values recorded within a window of time ending now.
+func (w *window) stats(now time.Time, length time.Duration) stats {
+	var total stats
+
+	latest := now.UnixNano() / int64(w.resolution)
+
+	n := int64((length + w.resolution - 1) / w.resolution)
+	if n > numSlots {
+		n = numSlots
+	}
+
+	for index := latest - n + 1; index <= latest; index++ {
+		s := w.slots[((index%numSlots)+numSlots)%numSlots]
+		if s.index != index {
+			continue
+		}
+
+		total.count += s.count
+		total.sum += s.sum
+		total.max = math.Max(total.max, s.max)
+	}
+
+	return total
+}
+
+// idle reports whether no value was recorded within the window as of now.
+func (w *window) idle(now time.Time) bool {
+	latest := now.UnixNano() / int64(w.resolution)
+
+	for _, s := range w.slots {
+		if s.index > latest-numSlots {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,57 @@
+package noise
+
+import (
+	"github.com/pkg/errors"
+	"net"
+)
+
+// Errors returned by Noise, or reported to callbacks registered on nodes and peers, are
+// wrapped around the following errors with additional context. Callers may branch on
+// failure modes by matching against them using `errors.Is`.
+var (
+	ErrDialSelf        = errors.New("noise: node attempted to dial itself")
+	ErrMessageTooLarge = errors.New("noise: message exceeds max message size")
+	ErrUnknownOpcode   = errors.New("noise: unknown opcode")
+
+	ErrSendQueueFull  = errors.New("noise: send message queue is full and not being processed")
+	ErrSendTimeout    = errors.New("noise: timed out attempting to send a message")
+	ErrWriteClosed    = errors.New("noise: connection was half-closed; no more messages may be sent")
+	ErrReceiveTimeout = errors.New("noise: timed out waiting for a received message to be handled")
+
+	ErrKeepaliveTimeout = errors.New("noise: peer went silent for longer than the keepalive timeout")
+
+	ErrHandshakeTimeout = errors.New("noise: timed out performing handshake")
+	ErrHandshakeFailed  = errors.New("noise: handshake failed")
+	ErrDecryptFailed    = errors.New("noise: failed to decrypt message")
+
+	ErrHandlerPanicked = errors.New("noise: message handler panicked")
+	ErrHandlerTimeout  = errors.New("noise: message handler exceeded its timeout")
+
+	ErrPeerBanned = errors.New("noise: peer is banned")
+	ErrNodeKilled = errors.New("noise: node has been killed")
+
+	ErrOutOfFileDescriptors = errors.New("noise: out of file descriptors budgeted for sockets")
+)
+
+// RefusedError is reported to callbacks registered through OnListenerError should our node refuse
+// a connection before taking it on, such as should the IP the connection was accepted from be
+// banned. It matches the error describing why the connection was refused using `errors.Is`.
+type RefusedError struct {
+	IP net.IP
+
+	err error
+}
+
+func (e RefusedError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns why the connection was refused, such that callers using `errors.Cause` remain
+// compatible.
+func (e RefusedError) Cause() error {
+	return e.err
+}
+
+func (e RefusedError) Unwrap() error {
+	return e.err
+}
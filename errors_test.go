@@ -0,0 +1,65 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestErrorsAreMatchable(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	params.MaxMessageSize = 4
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go alice.Listen()
+	go bob.Listen()
+
+	_, err = alice.Dial(alice.ExternalAddress())
+	assert.True(t, errors.Is(err, ErrDialSelf))
+
+	_, err = MessageFromOpcode(Opcode(254))
+	assert.True(t, errors.Is(err, ErrUnknownOpcode))
+
+	reported := make(chan error, 1)
+
+	bob.OnPeerConnected(func(node *Node, peer *Peer) error {
+		peer.OnConnError(func(node *Node, peer *Peer, err error) error {
+			reported <- err
+			return nil
+		})
+
+		return nil
+	})
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	// Bob only accepts messages at most 4 bytes large, and disconnects from Alice midway through
+	// her sending the message.
+	_ = peer.SendMessage(testMsg{Text: "some really long text"})
+
+	select {
+	case err := <-reported:
+		assert.True(t, errors.Is(err, ErrMessageTooLarge))
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not report an error receiving a message that is too large")
+	}
+}
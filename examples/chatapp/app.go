@@ -0,0 +1,320 @@
+// Package chatapp is a complete chat application built on the public APIs of noise, meant as a
+// reference for how the blocks noise provides fit together.
+//
+// Nodes discover one another through S/Kademlia, starting from the addresses of a few peers they
+// bootstrap from. Messages posted to rooms are published through pubsub signed by the node posting
+// them, and so are relayed to every node of the network regardless of who it is connected to.
+// Direct messages are sealed to the public key of their recipient before they are published in the
+// same manner, such that only the recipient may read them.
+package chatapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/box"
+	"github.com/perlin-network/noise/cipher/aead"
+	"github.com/perlin-network/noise/handshake/ecdh"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/pubsub"
+	"github.com/perlin-network/noise/signature/eddsa"
+	"github.com/perlin-network/noise/skademlia"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	topicRooms  = "chatapp.rooms"
+	topicDirect = "chatapp.direct"
+
+	// MaxTextSize is the maximum number of bytes of text a single message may carry.
+	MaxTextSize = 1024
+
+	// maxPostSize bounds the size of posts and direct messages, leaving room for the room name and
+	// nickname alongside the text.
+	maxPostSize = MaxTextSize + 256
+)
+
+var ErrTooLarge = errors.New("chatapp: text is too large")
+
+// Event is a message received from another node, either posted to a room our node has joined, or
+// sent directly to our node.
+type Event struct {
+	// Room is the room the message was posted to, which is empty for direct messages.
+	Room string
+
+	// From is the public key of the node which sent the message. Nicknames are chosen freely by
+	// nodes, and so only From may be relied upon to tell who sent a message.
+	From     []byte
+	Nickname string
+	Text     string
+}
+
+// Direct reports whether the message was sent directly to our node.
+func (e Event) Direct() bool {
+	return e.Room == ""
+}
+
+// App is a chat application running on a single node.
+type App struct {
+	node     *noise.Node
+	keys     *skademlia.Keypair
+	nickname string
+
+	events chan Event
+
+	roomsMutex sync.RWMutex
+	rooms      map[string]struct{}
+}
+
+// New enforces the protocol of the chat application on a node, which must have been created with
+// S/Kademlia keys, and have not yet started listening for peers. Messages received are buffered up
+// to 256 events, beyond which they are dropped until events are read off of Events.
+func New(node *noise.Node, nickname string) *App {
+	keys, ok := node.Keys.(*skademlia.Keypair)
+	if !ok {
+		panic("chatapp: node must be created with S/Kademlia keys")
+	}
+
+	a := &App{
+		node:     node,
+		keys:     keys,
+		nickname: nickname,
+		events:   make(chan Event, 256),
+		rooms:    make(map[string]struct{}),
+	}
+
+	protocol.New().
+		Register(ecdh.New()).
+		Register(aead.New()).
+		Register(skademlia.New()).
+		Register(pubsub.New().
+			WithSigning(eddsa.New(), pubsub.Strict).
+			WithValidator(topicRooms, pubsub.MaxSize(maxPostSize)).
+			WithValidator(topicRooms, validatePost).
+			WithValidator(topicDirect, pubsub.MaxSize(maxPostSize+box.Overhead)).
+			Subscribe(topicRooms, a.receivePost).
+			Subscribe(topicDirect, a.receiveDirect)).
+		Enforce(node)
+
+	return a
+}
+
+// Node returns the node the application runs on.
+func (a *App) Node() *noise.Node {
+	return a.node
+}
+
+// PublicKey returns the public key other nodes send direct messages to our node under.
+func (a *App) PublicKey() []byte {
+	return a.keys.PublicKey()
+}
+
+// Events returns the messages received from other nodes.
+func (a *App) Events() <-chan Event {
+	return a.events
+}
+
+// Bootstrap connects to peers at a set of addresses, and looks up more peers through them. It
+// returns the IDs of the peers found, or the first error met dialing any of the addresses.
+func (a *App) Bootstrap(addresses ...string) ([]skademlia.ID, error) {
+	var errs []error
+
+	for _, address := range addresses {
+		peer, err := a.node.Dial(address)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "chatapp: failed to dial %s", address))
+			continue
+		}
+
+		if err := protocol.WaitUntilEstablished(peer); err != nil {
+			errs = append(errs, errors.Wrapf(err, "chatapp: failed to establish session with %s", address))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	return skademlia.FindNode(a.node, protocol.NodeID(a.node).(skademlia.ID), skademlia.BucketSize(), 8), nil
+}
+
+// Peers returns the IDs of the peers our node has established sessions with, sorted by address.
+func (a *App) Peers() []skademlia.ID {
+	var ids []skademlia.ID
+
+	a.node.ForEachPeer(func(peer *noise.Peer) bool {
+		if protocol.HasPeerID(peer) {
+			ids = append(ids, protocol.PeerID(peer).(skademlia.ID))
+		}
+
+		return true
+	})
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Address() < ids[j].Address()
+	})
+
+	return ids
+}
+
+// Join has messages posted to a room be received.
+func (a *App) Join(room string) {
+	a.roomsMutex.Lock()
+	a.rooms[room] = struct{}{}
+	a.roomsMutex.Unlock()
+}
+
+// Leave has messages posted to a room no longer be received.
+func (a *App) Leave(room string) {
+	a.roomsMutex.Lock()
+	delete(a.rooms, room)
+	a.roomsMutex.Unlock()
+}
+
+// Rooms returns the rooms our node has joined, in sorted order.
+func (a *App) Rooms() []string {
+	a.roomsMutex.RLock()
+	defer a.roomsMutex.RUnlock()
+
+	rooms := make([]string, 0, len(a.rooms))
+
+	for room := range a.rooms {
+		rooms = append(rooms, room)
+	}
+
+	sort.Strings(rooms)
+
+	return rooms
+}
+
+func (a *App) joined(room string) bool {
+	a.roomsMutex.RLock()
+	defer a.roomsMutex.RUnlock()
+
+	_, joined := a.rooms[room]
+	return joined
+}
+
+// Post posts a message to a room. Rooms need not be joined to be posted to.
+func (a *App) Post(room, text string) error {
+	if room == "" {
+		return errors.New("chatapp: a room must be given")
+	}
+
+	if len(text) > MaxTextSize {
+		return errors.Wrapf(ErrTooLarge, "got %d bytes of text", len(text))
+	}
+
+	return errors.Wrap(pubsub.Publish(a.node, topicRooms, Post{Room: room, Nickname: a.nickname, Text: text}.Write()), "chatapp: failed to publish post")
+}
+
+// Send sends a message directly to the node holding a public key, which need not be a peer of
+// our node. The message is sealed to the public key, such that the nodes relaying it may not read
+// it.
+func (a *App) Send(recipient []byte, text string) error {
+	if len(text) > MaxTextSize {
+		return errors.Wrapf(ErrTooLarge, "got %d bytes of text", len(text))
+	}
+
+	sealed, err := box.Seal(recipient, Direct{From: a.PublicKey(), Nickname: a.nickname, Text: text}.Write())
+	if err != nil {
+		return errors.Wrap(err, "chatapp: failed to seal direct message")
+	}
+
+	return errors.Wrap(pubsub.Publish(a.node, topicDirect, sealed), "chatapp: failed to publish direct message")
+}
+
+// Resolve returns the public key of a peer given a hex-encoded prefix of it, which must match
+// the public key of exactly one peer our node has established a session with. Full hex-encoded
+// public keys resolve whether or not they are of a peer.
+func (a *App) Resolve(prefix string) ([]byte, error) {
+	if key, err := hex.DecodeString(prefix); err == nil && len(key) == len(a.PublicKey()) {
+		return key, nil
+	}
+
+	var matches [][]byte
+
+	for _, id := range a.Peers() {
+		if key := id.PublicKey(); len(prefix) > 0 && strings.HasPrefix(hex.EncodeToString(key), prefix) {
+			matches = append(matches, key)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, errors.Errorf("chatapp: no peer has a public key starting with %q", prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, errors.Errorf("chatapp: %d peers have a public key starting with %q", len(matches), prefix)
+	}
+}
+
+func validatePost(ctx context.Context, peer *noise.Peer, msg pubsub.Gossip) pubsub.Result {
+	post, err := Post{}.Read(payload.NewReader(msg.Data))
+	if err != nil || post.(Post).Room == "" || len(post.(Post).Text) > MaxTextSize {
+		return pubsub.Reject
+	}
+
+	return pubsub.Accept
+}
+
+func (a *App) receivePost(node *noise.Node, peer *noise.Peer, msg pubsub.Gossip) error {
+	// Posts we publish are delivered to us as well.
+	if bytes.Equal(msg.From, a.PublicKey()) {
+		return nil
+	}
+
+	m, err := Post{}.Read(payload.NewReader(msg.Data))
+	if err != nil {
+		return nil
+	}
+
+	post := m.(Post)
+
+	if !a.joined(post.Room) {
+		return nil
+	}
+
+	a.emit(Event{Room: post.Room, From: msg.From, Nickname: post.Nickname, Text: post.Text})
+
+	return nil
+}
+
+func (a *App) receiveDirect(node *noise.Node, peer *noise.Peer, msg pubsub.Gossip) error {
+	// Direct messages sealed to other nodes may not be opened by us, and are only relayed.
+	data, err := box.Open(a.keys, msg.Data)
+	if err != nil {
+		return nil
+	}
+
+	m, err := Direct{}.Read(payload.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	direct := m.(Direct)
+
+	if !bytes.Equal(direct.From, msg.From) {
+		log.Warn().Hex("sender", direct.From).Hex("publisher", msg.From).Msg("Dropped a direct message published by a node other than its sender.")
+		return nil
+	}
+
+	a.emit(Event{From: msg.From, Nickname: direct.Nickname, Text: direct.Text})
+
+	return nil
+}
+
+func (a *App) emit(event Event) {
+	select {
+	case a.events <- event:
+	default:
+		log.Warn().Hex("from", event.From).Msg("Dropped a chat message, as events are not being read.")
+	}
+}
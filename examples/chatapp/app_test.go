@@ -0,0 +1,242 @@
+package chatapp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/skademlia"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newApp(t *testing.T, layer transport.Layer, nickname string) *App {
+	params := noise.DefaultParams()
+	params.Transport = layer
+	params.Keys = skademlia.RandomKeys()
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	app := New(node, nickname)
+
+	go node.Listen()
+
+	return app
+}
+
+func expect(t *testing.T, app *App, want Event) {
+	select {
+	case got := <-app.Events():
+		assert.Equal(t, want, got)
+	case <-time.After(3 * time.Second):
+		t.Fatalf("did not receive %+v", want)
+	}
+}
+
+func expectNone(t *testing.T, app *App) {
+	select {
+	case got := <-app.Events():
+		t.Fatalf("received %+v, which was not meant for us", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// network bootstraps three nodes, such that carol only learns of alice through bob.
+func network(t *testing.T) (alice, bob, carol *App) {
+	layer := transport.NewBuffered()
+
+	alice = newApp(t, layer, "alice")
+	bob = newApp(t, layer, "bob")
+	carol = newApp(t, layer, "carol")
+
+	_, err := bob.Bootstrap(alice.Node().ExternalAddress())
+	assert.NoError(t, err)
+
+	found, err := carol.Bootstrap(bob.Node().ExternalAddress())
+	assert.NoError(t, err)
+
+	var addresses []string
+
+	for _, id := range found {
+		addresses = append(addresses, id.Address())
+	}
+
+	assert.Contains(t, addresses, alice.Node().ExternalAddress())
+
+	return alice, bob, carol
+}
+
+func TestRooms(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	alice, bob, carol := network(t)
+	defer alice.Node().Kill()
+	defer bob.Node().Kill()
+	defer carol.Node().Kill()
+
+	alice.Join("general")
+	carol.Join("general")
+	carol.Join("random")
+
+	assert.Equal(t, []string{"general", "random"}, carol.Rooms())
+
+	// Posts reach every node which joined the room, whether or not it posted to the room itself.
+	assert.NoError(t, carol.Post("general", "hello"))
+	expect(t, alice, Event{Room: "general", From: carol.PublicKey(), Nickname: "carol", Text: "hello"})
+	expectNone(t, bob)
+	expectNone(t, carol)
+
+	assert.NoError(t, bob.Post("random", "anyone here?"))
+	expect(t, carol, Event{Room: "random", From: bob.PublicKey(), Nickname: "bob", Text: "anyone here?"})
+	expectNone(t, alice)
+
+	carol.Leave("general")
+
+	assert.NoError(t, alice.Post("general", "bye"))
+	expectNone(t, carol)
+
+	assert.True(t, errors.Is(alice.Post("general", strings.Repeat("a", MaxTextSize+1)), ErrTooLarge))
+	assert.Error(t, alice.Post("", "nowhere"))
+}
+
+func TestDirect(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	alice, bob, carol := network(t)
+	defer alice.Node().Kill()
+	defer bob.Node().Kill()
+	defer carol.Node().Kill()
+
+	// Direct messages are relayed by nodes which may not read them.
+	assert.NoError(t, alice.Send(carol.PublicKey(), "psst"))
+	expect(t, carol, Event{From: alice.PublicKey(), Nickname: "alice", Text: "psst"})
+	expectNone(t, bob)
+	expectNone(t, alice)
+
+	assert.True(t, errors.Is(alice.Send(carol.PublicKey(), strings.Repeat("a", MaxTextSize+1)), ErrTooLarge))
+	assert.Error(t, alice.Send([]byte("not a public key"), "psst"))
+
+	// Peers resolve by prefixes of their public keys.
+	key, err := bob.Resolve(hex.EncodeToString(alice.PublicKey())[:8])
+	assert.NoError(t, err)
+	assert.Equal(t, alice.PublicKey(), key)
+
+	key, err = bob.Resolve(hex.EncodeToString(carol.PublicKey()))
+	assert.NoError(t, err)
+	assert.Equal(t, carol.PublicKey(), key)
+
+	_, err = bob.Resolve("zz")
+	assert.Error(t, err)
+
+	_, err = bob.Resolve("")
+	assert.Error(t, err)
+}
+
+// output is written to by the CLI while being read by the test.
+type output struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	return o.buf.Write(p)
+}
+
+func (o *output) String() string {
+	o.Lock()
+	defer o.Unlock()
+
+	return o.buf.String()
+}
+
+func TestRun(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	alice, bob, carol := network(t)
+	defer alice.Node().Kill()
+	defer bob.Node().Kill()
+	defer carol.Node().Kill()
+
+	in, w := io.Pipe()
+	out := new(output)
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- Run(carol, in, out)
+	}()
+
+	eventually := func(line string) {
+		deadline := time.Now().Add(3 * time.Second)
+
+		for !strings.Contains(out.String(), line) {
+			if time.Now().After(deadline) {
+				t.Fatalf("CLI did not print %q, and printed:\n%s", line, out.String())
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	send := func(line string) {
+		_, err := io.WriteString(w, line+"\n")
+		assert.NoError(t, err)
+	}
+
+	send("hello?")
+	eventually("Join a room with /join <room> before posting.")
+
+	send("/join general")
+	eventually("Joined #general.")
+
+	alice.Join("general")
+
+	send("hi alice")
+	expect(t, alice, Event{Room: "general", From: carol.PublicKey(), Nickname: "carol", Text: "hi alice"})
+
+	assert.NoError(t, alice.Post("general", "hi carol"))
+	eventually(FormatEvent(Event{Room: "general", From: alice.PublicKey(), Nickname: "alice", Text: "hi carol"}))
+
+	send("/dm " + hex.EncodeToString(bob.PublicKey())[:8] + "   just between us")
+	expect(t, bob, Event{From: carol.PublicKey(), Nickname: "carol", Text: "just between us"})
+
+	assert.NoError(t, bob.Send(carol.PublicKey(), "noted"))
+	eventually("[dm] bob (" + hex.EncodeToString(bob.PublicKey())[:8] + "): noted")
+
+	send("/peers")
+	eventually(bob.Node().ExternalAddress())
+
+	send("/rooms")
+	eventually("Rooms: general")
+
+	send("/whoami")
+	eventually(hex.EncodeToString(carol.PublicKey()))
+
+	send("/leave general")
+	eventually("Left #general.")
+
+	send("/nope")
+	eventually("Unknown command /nope.")
+
+	assert.NoError(t, w.Close())
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("CLI did not return once its input was exhausted")
+	}
+}
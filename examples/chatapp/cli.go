@@ -0,0 +1,152 @@
+package chatapp
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+const help = `Commands:
+  /join <room>          join a room, and post to it by default
+  /leave <room>         leave a room
+  /rooms                list the rooms joined
+  /peers                list the peers connected to
+  /dm <key> <text>      send a direct message to a node by (a prefix of) its hex public key
+  /whoami               print the public key of our node
+  /help                 print this help
+Any other line is posted to the room last joined.`
+
+// shortKey abbreviates a public key for display.
+func shortKey(key []byte) string {
+	encoded := hex.EncodeToString(key)
+
+	if len(encoded) > 8 {
+		return encoded[:8]
+	}
+
+	return encoded
+}
+
+// FormatEvent formats a message received for display.
+func FormatEvent(event Event) string {
+	room := "dm"
+	if !event.Direct() {
+		room = "#" + event.Room
+	}
+
+	return fmt.Sprintf("[%s] %s (%s): %s", room, event.Nickname, shortKey(event.From), event.Text)
+}
+
+// Run reads commands line by line, and writes out their results alongside every message received
+// until the reader is exhausted.
+func Run(app *App, in io.Reader, out io.Writer) error {
+	var mutex sync.Mutex
+
+	printf := func(format string, args ...interface{}) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		fmt.Fprintf(out, format+"\n", args...)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case event := <-app.Events():
+				printf("%s", FormatEvent(event))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var current string
+
+	scanner := bufio.NewScanner(in)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "/") {
+			if current == "" {
+				printf("Join a room with /join <room> before posting.")
+				continue
+			}
+
+			if err := app.Post(current, line); err != nil {
+				printf("Failed to post: %v", err)
+			}
+
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		switch fields[0] {
+		case "/join":
+			if len(fields) != 2 {
+				printf("Usage: /join <room>")
+				continue
+			}
+
+			app.Join(fields[1])
+			current = fields[1]
+
+			printf("Joined #%s.", current)
+		case "/leave":
+			if len(fields) != 2 {
+				printf("Usage: /leave <room>")
+				continue
+			}
+
+			app.Leave(fields[1])
+
+			if current == fields[1] {
+				current = ""
+			}
+
+			printf("Left #%s.", fields[1])
+		case "/rooms":
+			printf("Rooms: %s", strings.Join(app.Rooms(), ", "))
+		case "/peers":
+			for _, id := range app.Peers() {
+				printf("%s %s", hex.EncodeToString(id.PublicKey()), id.Address())
+			}
+		case "/dm":
+			if len(fields) < 3 {
+				printf("Usage: /dm <key> <text>")
+				continue
+			}
+
+			recipient, err := app.Resolve(fields[1])
+			if err != nil {
+				printf("%v", err)
+				continue
+			}
+
+			text := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+			text = strings.TrimSpace(strings.TrimPrefix(text, fields[1]))
+
+			if err := app.Send(recipient, text); err != nil {
+				printf("Failed to send direct message: %v", err)
+			}
+		case "/whoami":
+			printf("%s %s", hex.EncodeToString(app.PublicKey()), app.Node().ExternalAddress())
+		case "/help":
+			printf("%s", help)
+		default:
+			printf("Unknown command %s. Type /help for a list of commands.", fields[0])
+		}
+	}
+
+	return scanner.Err()
+}
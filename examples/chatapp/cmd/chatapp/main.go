@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/examples/chatapp"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/skademlia"
+	"os"
+)
+
+func main() {
+	hostFlag := flag.String("h", "127.0.0.1", "host to listen for peers on")
+	portFlag := flag.Uint("p", 3000, "port to listen for peers on")
+	nickFlag := flag.String("n", "anonymous", "nickname to chat under")
+	flag.Parse()
+
+	params := noise.DefaultParams()
+	params.Keys = skademlia.RandomKeys()
+	params.Host = *hostFlag
+	params.Port = uint16(*portFlag)
+
+	node, err := noise.NewNode(params)
+	if err != nil {
+		panic(err)
+	}
+	defer node.Kill()
+
+	app := chatapp.New(node, *nickFlag)
+
+	go node.Listen()
+
+	log.Info().Msgf("Listening for peers on port %d.", node.ExternalPort())
+
+	if len(flag.Args()) > 0 {
+		peers, err := app.Bootstrap(flag.Args()...)
+		if err != nil {
+			panic(err)
+		}
+
+		log.Info().Msgf("Bootstrapped with peers: %+v", peers)
+	}
+
+	if err := chatapp.Run(app, os.Stdin, os.Stdout); err != nil {
+		panic(err)
+	}
+}
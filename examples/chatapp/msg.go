@@ -0,0 +1,75 @@
+package chatapp
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ noise.Message = (*Post)(nil)
+	_ noise.Message = (*Direct)(nil)
+)
+
+// Post is a message posted to a room, published to every peer of the network.
+type Post struct {
+	Room     string
+	Nickname string
+	Text     string
+}
+
+func (Post) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Post
+	var err error
+
+	if msg.Room, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read room")
+	}
+
+	if msg.Nickname, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read nickname")
+	}
+
+	if msg.Text, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read text")
+	}
+
+	return msg, nil
+}
+
+func (m Post) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.Room).WriteString(m.Nickname).WriteString(m.Text).Bytes()
+}
+
+// Direct is a message sent directly to a single peer, which is sealed to the public key of the peer
+// before it is published. From is the public key of the sender, which must match the public key the
+// sealed message is published under, such that peers may not pass off messages sealed by others as
+// their own.
+type Direct struct {
+	From     []byte
+	Nickname string
+	Text     string
+}
+
+func (Direct) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Direct
+	var err error
+
+	if msg.From, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read sender")
+	}
+
+	if msg.Nickname, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read nickname")
+	}
+
+	if msg.Text, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read text")
+	}
+
+	return msg, nil
+}
+
+func (m Direct) Write() []byte {
+	return payload.NewWriter(nil).WriteBytes(m.From).WriteString(m.Nickname).WriteString(m.Text).Bytes()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/conformance"
+	"github.com/perlin-network/noise/log"
+	"io/ioutil"
+)
+
+func main() {
+	hostFlag := flag.String("h", "127.0.0.1", "host to listen for peers on")
+	portFlag := flag.Uint("p", 3000, "port to listen for peers on")
+	networkFlag := flag.String("network", "", "network the server is set to")
+	specFlag := flag.String("spec", "", "path to write the spec of the server to, after which the server exits")
+	flag.Parse()
+
+	params := noise.DefaultParams()
+	params.Host = *hostFlag
+	params.Port = uint16(*portFlag)
+
+	node, err := noise.NewNode(params)
+	if err != nil {
+		panic(err)
+	}
+	defer node.Kill()
+
+	server := conformance.NewServer(node, *networkFlag)
+
+	spec, err := server.Spec()
+	if err != nil {
+		panic(err)
+	}
+
+	if *specFlag != "" {
+		buf, err := json.MarshalIndent(spec, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+
+		if err := ioutil.WriteFile(*specFlag, append(buf, '\n'), 0644); err != nil {
+			panic(err)
+		}
+
+		return
+	}
+
+	log.Info().Msgf("Serving conformance tests on %s.", node.ExternalAddress())
+
+	node.Listen()
+}
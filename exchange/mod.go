@@ -0,0 +1,448 @@
+// Package exchange trades content-addressed blocks between peers, in the spirit of Bitswap. Peers
+// share want-lists of the hashes of the blocks they are after, and are sent the blocks which they
+// want as soon as their peers hold them.
+//
+// Every peer is kept a ledger of the bytes exchanged with it, and peers which take far more than
+// they give are throttled until they reciprocate.
+package exchange
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/kv"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+const (
+	keyState  = "exchange.state"
+	keyLedger = "exchange.ledger"
+
+	DefaultAllowance = 1024 * 1024
+	DefaultDebtRatio = 2.0
+
+	// maxBatchSize caps how many bytes of blocks are sent in a single message, such that messages
+	// fit within the max message size of nodes. Larger blocks are sent on their own.
+	maxBatchSize = 256 * 1024
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrNotFound = errors.New("exchange: block not found")
+)
+
+// Key is the SHA-256 hash of the contents of a block, which blocks are addressed by.
+type Key [sha256.Size]byte
+
+// KeyOf returns the key a block is addressed by.
+func KeyOf(data []byte) Key {
+	return sha256.Sum256(data)
+}
+
+func (k Key) String() string {
+	return hex.EncodeToString(k[:])
+}
+
+type block struct {
+	opcodeWantList noise.Opcode
+	opcodeBlocks   noise.Opcode
+
+	store kv.Store
+
+	allowance uint64
+	debtRatio float64
+}
+
+// New returns a block which exchanges blocks with all peers that complete it, holding blocks in
+// memory.
+//
+// By default, every peer is sent 1 MiB worth of blocks before it is expected to reciprocate, and is
+// then sent at most twice as many bytes as it sent us.
+func New() *block {
+	return &block{
+		store:     kv.NewMemory(),
+		allowance: DefaultAllowance,
+		debtRatio: DefaultDebtRatio,
+	}
+}
+
+// WithStore sets the store blocks are held in, keyed by their key. Use kv.Prefixed to share a store
+// with other components.
+func (b *block) WithStore(store kv.Store) *block {
+	b.store = store
+	return b
+}
+
+// WithAllowance sets how many bytes worth of blocks every peer is sent before it is expected to
+// send us blocks in return.
+func (b *block) WithAllowance(bytes uint64) *block {
+	b.allowance = bytes
+	return b
+}
+
+// WithDebtRatio sets how many bytes a peer is sent for every byte of blocks it sent us, once it has
+// used up its allowance. Wants of peers in debt are held on to until they reciprocate.
+func (b *block) WithDebtRatio(ratio float64) *block {
+	if ratio < 0 {
+		panic("exchange: debt ratio must not be negative")
+	}
+
+	b.debtRatio = ratio
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeWantList = noise.RegisterMessage(noise.NextAvailableOpcode(), (*WantList)(nil))
+	b.opcodeBlocks = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Blocks)(nil))
+
+	s := &state{block: b, peers: make(map[*noise.Peer]struct{}), wants: make(map[Key]*want)}
+	node.Set(keyState, s)
+
+	node.OnMessageReceived(b.opcodeWantList, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		ledgerOf(peer).update(message.(WantList))
+		s.serve(peer)
+
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodeBlocks, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		s.receive(peer, message.(Blocks))
+		return nil
+	})
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	s := peer.Node().Get(keyState).(*state)
+	ledgerOf(peer)
+
+	s.Lock()
+	s.peers[peer] = struct{}{}
+	wants := make([]Key, 0, len(s.wants))
+	for key := range s.wants {
+		wants = append(wants, key)
+	}
+	s.Unlock()
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		s.Lock()
+		delete(s.peers, peer)
+		s.Unlock()
+
+		return nil
+	})
+
+	if len(wants) > 0 {
+		protocol.EnqueueMessage(peer, WantList{Want: wants})
+	}
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Put stores a block, and sends it to every peer which wants it. It returns the key of the block.
+func Put(node *noise.Node, data []byte) (Key, error) {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return Key{}, errors.New("exchange: block is not registered to the nodes protocol")
+	}
+
+	key := KeyOf(data)
+
+	if err := s.block.store.Put(key[:], data); err != nil {
+		return key, errors.Wrap(err, "exchange: failed to store block")
+	}
+
+	s.fulfill(key, data)
+	s.provide(key)
+
+	return key, nil
+}
+
+// Get returns a block held by our node. It returns ErrNotFound should our node not hold the block.
+func Get(node *noise.Node, key Key) ([]byte, error) {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return nil, errors.New("exchange: block is not registered to the nodes protocol")
+	}
+
+	return s.get(key)
+}
+
+// Fetch returns a block, asking our peers for it should our node not hold it. The block is added
+// to our want-list until a peer sends it, or until the context is done.
+func Fetch(ctx context.Context, node *noise.Node, key Key) ([]byte, error) {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return nil, errors.New("exchange: block is not registered to the nodes protocol")
+	}
+
+	data, err := s.get(key)
+	if !errors.Is(err, ErrNotFound) {
+		return data, err
+	}
+
+	s.Lock()
+	w, exists := s.wants[key]
+	if !exists {
+		w = &want{done: make(chan struct{})}
+		s.wants[key] = w
+	}
+	w.refs++
+	s.Unlock()
+
+	if !exists {
+		s.broadcast(WantList{Want: []Key{key}})
+
+		// The block may have been stored in between checking for it and wanting it.
+		if data, err := s.get(key); err == nil {
+			s.fulfill(key, data)
+		}
+	}
+
+	select {
+	case <-w.done:
+		return w.data, nil
+	case <-ctx.Done():
+	}
+
+	s.Lock()
+	w.refs--
+	cancel := w.refs == 0 && s.wants[key] == w
+	if cancel {
+		delete(s.wants, key)
+	}
+	s.Unlock()
+
+	if cancel {
+		s.broadcast(WantList{Cancel: []Key{key}})
+	}
+
+	return nil, errors.Wrapf(ctx.Err(), "exchange: gave up fetching block %s", key)
+}
+
+// Ledger records the bytes of blocks exchanged with a peer, and the blocks the peer wants from us.
+type Ledger struct {
+	Sent     uint64
+	Received uint64
+	Wants    []Key
+}
+
+// DebtRatio is the number of bytes sent to the peer for every byte received from it.
+func (l Ledger) DebtRatio() float64 {
+	return float64(l.Sent) / float64(l.Received+1)
+}
+
+// LedgerOf returns the ledger our node keeps for a peer.
+func LedgerOf(peer *noise.Peer) Ledger {
+	l := ledgerOf(peer)
+
+	l.Lock()
+	defer l.Unlock()
+
+	ledger := Ledger{Sent: l.sent, Received: l.received, Wants: make([]Key, 0, len(l.wants))}
+
+	for key := range l.wants {
+		ledger.Wants = append(ledger.Wants, key)
+	}
+
+	return ledger
+}
+
+type ledger struct {
+	sync.Mutex
+
+	sent     uint64
+	received uint64
+
+	wants map[Key]struct{}
+}
+
+func ledgerOf(peer *noise.Peer) *ledger {
+	return peer.LoadOrStore(keyLedger, &ledger{wants: make(map[Key]struct{})}).(*ledger)
+}
+
+func (l *ledger) update(msg WantList) {
+	l.Lock()
+	defer l.Unlock()
+
+	for _, key := range msg.Want {
+		l.wants[key] = struct{}{}
+	}
+
+	for _, key := range msg.Cancel {
+		delete(l.wants, key)
+	}
+}
+
+func (l *ledger) wanted(key Key) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	_, wanted := l.wants[key]
+	return wanted
+}
+
+// want is a block our node is fetching.
+type want struct {
+	refs int
+	data []byte
+	done chan struct{}
+}
+
+type state struct {
+	sync.Mutex
+
+	block *block
+
+	peers map[*noise.Peer]struct{}
+	wants map[Key]*want
+}
+
+func (s *state) get(key Key) ([]byte, error) {
+	data, err := s.block.store.Get(key[:])
+
+	if errors.Is(err, kv.ErrNotFound) {
+		return nil, errors.Wrapf(ErrNotFound, "block %s", key)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "exchange: failed to load block %s", key)
+	}
+
+	return data, nil
+}
+
+// receive stores the blocks a peer sent us which our node wants, and credits the peer for them.
+// Blocks our node did not want are dropped, such that peers may not buy credit with junk.
+func (s *state) receive(peer *noise.Peer, msg Blocks) {
+	l := ledgerOf(peer)
+
+	var received []Key
+
+	for _, data := range msg.Blocks {
+		key := KeyOf(data)
+
+		s.Lock()
+		_, wanted := s.wants[key]
+		s.Unlock()
+
+		if !wanted {
+			log.Debug().Str("key", key.String()).Msg("Dropped a block our node did not want.")
+			continue
+		}
+
+		if err := s.block.store.Put(key[:], data); err != nil {
+			log.Warn().Err(err).Str("key", key.String()).Msg("Failed to store a block received from a peer.")
+			continue
+		}
+
+		l.Lock()
+		l.received += uint64(len(data))
+		l.Unlock()
+
+		s.fulfill(key, data)
+		s.provide(key)
+
+		received = append(received, key)
+	}
+
+	if len(received) == 0 {
+		return
+	}
+
+	s.broadcast(WantList{Cancel: received})
+
+	// The peer may have been in debt, and having reciprocated, may now be sent what it wants.
+	s.serve(peer)
+}
+
+// fulfill hands a block to whoever is fetching it on our node.
+func (s *state) fulfill(key Key, data []byte) {
+	s.Lock()
+	defer s.Unlock()
+
+	if w, exists := s.wants[key]; exists {
+		delete(s.wants, key)
+
+		w.data = data
+		close(w.done)
+	}
+}
+
+// provide sends a block our node now holds to every peer which wants it.
+func (s *state) provide(key Key) {
+	for _, peer := range s.list() {
+		if ledgerOf(peer).wanted(key) {
+			s.serve(peer)
+		}
+	}
+}
+
+// serve sends a peer the blocks it wants which our node holds, for as long as the peer is not in
+// debt. Blocks the peer may not yet be sent stay on its want-list.
+func (s *state) serve(peer *noise.Peer) {
+	l := ledgerOf(peer)
+
+	var batches []Blocks
+	var batch Blocks
+	var size int
+
+	l.Lock()
+	for key := range l.wants {
+		data, err := s.get(key)
+		if err != nil {
+			continue
+		}
+
+		if l.sent+uint64(len(data)) > s.block.allowance+uint64(s.block.debtRatio*float64(l.received)) {
+			continue
+		}
+
+		if len(batch.Blocks) > 0 && size+len(data) > maxBatchSize {
+			batches = append(batches, batch)
+			batch, size = Blocks{}, 0
+		}
+
+		batch.Blocks = append(batch.Blocks, data)
+		size += len(data)
+
+		l.sent += uint64(len(data))
+		delete(l.wants, key)
+	}
+	l.Unlock()
+
+	if len(batch.Blocks) > 0 {
+		batches = append(batches, batch)
+	}
+
+	for _, batch := range batches {
+		peer.SendMessageAsync(batch)
+	}
+}
+
+func (s *state) broadcast(msg WantList) {
+	for _, peer := range s.list() {
+		peer.SendMessageAsync(msg)
+	}
+}
+
+func (s *state) list() []*noise.Peer {
+	s.Lock()
+	defer s.Unlock()
+
+	peers := make([]*noise.Peer, 0, len(s.peers))
+
+	for peer := range s.peers {
+		peers = append(peers, peer)
+	}
+
+	return peers
+}
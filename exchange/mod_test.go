@@ -0,0 +1,232 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/identity/ed25519"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newNode(t *testing.T, layer transport.Layer, block *block) (*noise.Node, chan *noise.Peer) {
+	params := noise.DefaultParams()
+	params.Transport = layer
+	params.Keys = ed25519.RandomKeys()
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	established := make(chan *noise.Peer, 8)
+
+	protocol.New().Register(block).OnEstablished(func(peer *noise.Peer) { established <- peer }).Enforce(node)
+
+	go node.Listen()
+
+	return node, established
+}
+
+func TestExchange(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	alice, _ := newNode(t, layer, New())
+	bob, _ := newNode(t, layer, New())
+	carol, _ := newNode(t, layer, New())
+
+	defer alice.Kill()
+	defer bob.Kill()
+	defer carol.Kill()
+
+	first := bytes.Repeat([]byte{'a'}, 300*1024)
+	second := []byte("second")
+
+	key, err := Put(alice, first)
+	assert.NoError(t, err)
+	assert.Equal(t, KeyOf(first), key)
+
+	_, err = Get(bob, key)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	peer, err := bob.Dial(alice.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Bob fetches a block alice holds.
+	data, err := Fetch(ctx, bob, key)
+	assert.NoError(t, err)
+	assert.Equal(t, first, data)
+
+	data, err = Get(bob, key)
+	assert.NoError(t, err)
+	assert.Equal(t, first, data)
+
+	assert.Equal(t, uint64(len(first)), LedgerOf(peer).Received)
+
+	// Carol connects to bob while wanting a block nobody holds yet, and is sent it once bob stores it.
+	fetched := make(chan []byte, 1)
+
+	go func() {
+		data, err := Fetch(ctx, carol, KeyOf(second))
+		assert.NoError(t, err)
+		fetched <- data
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	peer, err = carol.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	time.Sleep(50 * time.Millisecond)
+
+	_, err = Put(bob, second)
+	assert.NoError(t, err)
+
+	select {
+	case data := <-fetched:
+		assert.Equal(t, second, data)
+	case <-time.After(3 * time.Second):
+		t.Fatal("carol was never sent the block she wanted")
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	alice, established := newNode(t, layer, New().WithAllowance(1024).WithDebtRatio(1))
+	bob, _ := newNode(t, layer, New())
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	first := bytes.Repeat([]byte{'a'}, 1024)
+	second := bytes.Repeat([]byte{'b'}, 1024)
+	gift := bytes.Repeat([]byte{'c'}, 1024)
+
+	for _, data := range [][]byte{first, second} {
+		_, err := Put(alice, data)
+		assert.NoError(t, err)
+	}
+
+	peer, err := bob.Dial(alice.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	var bobOnAlice *noise.Peer
+
+	select {
+	case bobOnAlice = <-established:
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob never completed alices protocol")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Bob uses up his allowance with his first block.
+	_, err = Fetch(ctx, bob, KeyOf(first))
+	assert.NoError(t, err)
+
+	// Bob is then in debt, and may not fetch another block until he reciprocates.
+	fetched := make(chan []byte, 1)
+
+	go func() {
+		data, err := Fetch(ctx, bob, KeyOf(second))
+		assert.NoError(t, err)
+		fetched <- data
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	ledger := LedgerOf(bobOnAlice)
+	assert.Equal(t, uint64(len(first)), ledger.Sent)
+	assert.Equal(t, []Key{KeyOf(second)}, ledger.Wants)
+	assert.Len(t, fetched, 0)
+
+	// Bob gives alice a block she wants, and is sent the block he wanted in return.
+	go func() {
+		_, err := Fetch(ctx, alice, KeyOf(gift))
+		assert.NoError(t, err)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	_, err = Put(bob, gift)
+	assert.NoError(t, err)
+
+	select {
+	case data := <-fetched:
+		assert.Equal(t, second, data)
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob was never sent the block he wanted after reciprocating")
+	}
+
+	assert.Equal(t, uint64(len(gift)), LedgerOf(bobOnAlice).Received)
+}
+
+func TestCancel(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	alice, established := newNode(t, layer, New())
+	bob, _ := newNode(t, layer, New())
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	peer, err := bob.Dial(alice.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	bobOnAlice := <-established
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = Fetch(ctx, bob, KeyOf([]byte("missing")))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// Alice is told bob no longer wants the block.
+	for i := 0; i < 100 && len(LedgerOf(bobOnAlice).Wants) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Empty(t, LedgerOf(bobOnAlice).Wants)
+}
+
+func TestMessages(t *testing.T) {
+	want := WantList{Want: []Key{KeyOf([]byte("a")), KeyOf([]byte("b"))}, Cancel: []Key{KeyOf([]byte("c"))}}
+
+	msg, err := WantList{}.Read(payload.NewReader(want.Write()))
+	assert.NoError(t, err)
+	assert.Equal(t, want, msg)
+
+	blocks := Blocks{Blocks: [][]byte{[]byte("a"), []byte("bc")}}
+
+	msg, err = Blocks{}.Read(payload.NewReader(blocks.Write()))
+	assert.NoError(t, err)
+	assert.Equal(t, blocks, msg)
+
+	// Counts claiming more entries than there are bytes left are refused.
+	buf := want.Write()
+
+	_, err = WantList{}.Read(payload.NewReader(buf[:len(buf)-1]))
+	assert.Error(t, err)
+}
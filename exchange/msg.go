@@ -0,0 +1,114 @@
+package exchange
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"io"
+)
+
+var (
+	_ noise.Message = (*WantList)(nil)
+	_ noise.Message = (*Blocks)(nil)
+)
+
+// WantList updates the blocks a peer wants from us. Keys in Want are added to the want-list of the
+// peer, and keys in Cancel are removed from it.
+type WantList struct {
+	Want   []Key
+	Cancel []Key
+}
+
+func (WantList) Read(reader payload.Reader) (noise.Message, error) {
+	var msg WantList
+	var err error
+
+	if msg.Want, err = readKeys(reader); err != nil {
+		return nil, errors.Wrap(err, "failed to read wanted keys")
+	}
+
+	if msg.Cancel, err = readKeys(reader); err != nil {
+		return nil, errors.Wrap(err, "failed to read cancelled keys")
+	}
+
+	return msg, nil
+}
+
+func (m WantList) Write() []byte {
+	writer := payload.NewWriter(nil)
+
+	writeKeys(writer, m.Want)
+	writeKeys(writer, m.Cancel)
+
+	return writer.Bytes()
+}
+
+// Blocks carries blocks a peer wanted from us.
+type Blocks struct {
+	Blocks [][]byte
+}
+
+func (Blocks) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Blocks
+
+	count, err := reader.ReadUint32()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read number of blocks")
+	}
+
+	// Every block is prefixed with its length, so a count larger than the remaining bytes is
+	// malformed.
+	if int(count) > reader.Len()/4 {
+		return nil, errors.Errorf("claims to carry %d blocks with only %d bytes left", count, reader.Len())
+	}
+
+	for i := uint32(0); i < count; i++ {
+		data, err := reader.ReadBytes()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read block")
+		}
+
+		msg.Blocks = append(msg.Blocks, data)
+	}
+
+	return msg, nil
+}
+
+func (m Blocks) Write() []byte {
+	writer := payload.NewWriter(nil).WriteUint32(uint32(len(m.Blocks)))
+
+	for _, data := range m.Blocks {
+		writer.WriteBytes(data)
+	}
+
+	return writer.Bytes()
+}
+
+func readKeys(reader payload.Reader) ([]Key, error) {
+	count, err := reader.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if int(count) > reader.Len()/len(Key{}) {
+		return nil, errors.Errorf("claims to carry %d keys with only %d bytes left", count, reader.Len())
+	}
+
+	keys := make([]Key, count)
+
+	for i := range keys {
+		if _, err := io.ReadFull(reader, keys[i][:]); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+func writeKeys(writer payload.Writer, keys []Key) {
+	writer.WriteUint32(uint32(len(keys)))
+
+	for _, key := range keys {
+		writer.Write(key[:])
+	}
+}
@@ -0,0 +1,190 @@
+package noise
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// FrameExtensions marks frames as carrying an extension area ahead of their message, should it be
+// negotiated with a peer. Frames carrying extensions are encoded as follows:
+//
+//	uvarint  size of the frame, covering all fields below
+//	uvarint  size of the extension area
+//	[]       extensions, each a uvarint type, a uvarint length, and as many bytes of value
+//	[]       message
+//
+// Extensions are sent in the clear, ahead of the message after it is transformed by callbacks
+// registered through BeforeMessageSent, and so are neither encrypted nor authenticated alongside
+// it. Nor is the preamble which negotiates them bound into any handshake. Anyone on the path between
+// two peers may thus add, strip or alter the extensions of any frame, or keep peers from negotiating
+// extensions at all, and so extensions must be treated as untrusted hints.
+const FrameExtensions FrameFlags = 1 << 0
+
+// ExtensionType identifies the contents of an extension.
+type ExtensionType uint64
+
+const (
+	// ExtensionPadding pads frames out, and is always skipped by our node.
+	ExtensionPadding ExtensionType = iota + 1
+
+	// ExtensionTraceContext carries the trace context a message was sent under, such as a W3C
+	// traceparent header.
+	ExtensionTraceContext
+
+	// ExtensionPriority hints at how urgently a message is to be handled.
+	ExtensionPriority
+)
+
+var ErrMalformedExtensions = errors.New("noise: frame carries malformed extensions")
+
+// Extension is a typed value carried within the header of a frame.
+type Extension struct {
+	Type  ExtensionType
+	Value []byte
+}
+
+// Extensions are the extensions carried by a single frame.
+type Extensions []Extension
+
+// Get returns the value of the first extension of a type, and reports whether any is present.
+func (e Extensions) Get(typ ExtensionType) ([]byte, bool) {
+	for _, ext := range e {
+		if ext.Type == typ {
+			return ext.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+var (
+	extensionTypes = map[ExtensionType]struct{}{
+		ExtensionTraceContext: {},
+		ExtensionPriority:     {},
+	}
+
+	extensionTypesMutex sync.RWMutex
+)
+
+// RegisterExtension registers a type of extension which our node is to read from frames. Extensions
+// of types which are not registered are skipped over, such that peers may roll out new extensions
+// without breaking peers unaware of them. ExtensionTraceContext and ExtensionPriority are always
+// registered, and ExtensionPadding may not be registered.
+func RegisterExtension(typ ExtensionType) {
+	if typ == ExtensionPadding {
+		panic("noise: padding extensions are always skipped, and may not be registered")
+	}
+
+	extensionTypesMutex.Lock()
+	extensionTypes[typ] = struct{}{}
+	extensionTypesMutex.Unlock()
+}
+
+// encodeExtensions encodes the extension area of a frame.
+func encodeExtensions(extensions Extensions) []byte {
+	var size int
+
+	for _, ext := range extensions {
+		size += 2*binary.MaxVarintLen64 + len(ext.Value)
+	}
+
+	area := make([]byte, binary.MaxVarintLen64+size)
+	n := binary.MaxVarintLen64
+
+	for _, ext := range extensions {
+		n += binary.PutUvarint(area[n:], uint64(ext.Type))
+		n += binary.PutUvarint(area[n:], uint64(len(ext.Value)))
+		n += copy(area[n:], ext.Value)
+	}
+
+	// Prefix the extensions with their size, right before where they begin.
+	var prefix [binary.MaxVarintLen64]byte
+	prefixed := binary.PutUvarint(prefix[:], uint64(n-binary.MaxVarintLen64))
+
+	start := binary.MaxVarintLen64 - prefixed
+	copy(area[start:], prefix[:prefixed])
+
+	return area[start:n]
+}
+
+// decodeExtensions splits a frame into the extensions registered with our node that it carries, and
+// the message following them.
+func decodeExtensions(frame []byte) (Extensions, []byte, error) {
+	size, n := binary.Uvarint(frame)
+	if n <= 0 || size > uint64(len(frame)-n) {
+		return nil, nil, errors.Wrap(ErrMalformedExtensions, "extension area overruns the frame")
+	}
+
+	area, msg := frame[n:n+int(size)], frame[n+int(size):]
+
+	var extensions Extensions
+
+	extensionTypesMutex.RLock()
+	defer extensionTypesMutex.RUnlock()
+
+	for len(area) > 0 {
+		typ, n := binary.Uvarint(area)
+		if n <= 0 {
+			return nil, nil, errors.Wrap(ErrMalformedExtensions, "failed to read extension type")
+		}
+
+		area = area[n:]
+
+		length, n := binary.Uvarint(area)
+		if n <= 0 || length > uint64(len(area)-n) {
+			return nil, nil, errors.Wrapf(ErrMalformedExtensions, "extension of type %d overruns the extension area", typ)
+		}
+
+		value := area[n : n+int(length)]
+		area = area[n+int(length):]
+
+		if _, registered := extensionTypes[ExtensionType(typ)]; registered {
+			extensions = append(extensions, Extension{Type: ExtensionType(typ), Value: value})
+		}
+	}
+
+	return extensions, msg, nil
+}
+
+// OnEncodeExtensions registers a callback that is fed in the raw contents of a message to be sent,
+// alongside the extensions prior callbacks attached to it, which then outputs the extensions to be
+// carried within the header of the frame of the message. Extensions are only sent to peers which
+// negotiated FrameExtensions, and are otherwise left out.
+func (p *Peer) OnEncodeExtensions(c OnPeerEncodeExtensionsCallback) {
+	p.onEncodeExtensionsCallbacks.RegisterCallback(func(extensions interface{}, params ...interface{}) (interface{}, error) {
+		if len(params) != 2 {
+			panic(errors.Errorf("noise: OnEncodeExtensions received unexpected args %v", params))
+		}
+
+		return c(params[0].(*Node), p, extensions.(Extensions), params[1].([]byte))
+	})
+}
+
+// OnDecodeExtensions registers a callback that is fed in the registered extensions carried by the
+// frame of every message received from the peer, before the message is decoded. Returning an error
+// drops the message and disconnects the peer. Extensions are not authenticated, and so may have
+// been sent by anyone on the path between us and the peer, rather than by the peer itself.
+func (p *Peer) OnDecodeExtensions(c OnPeerDecodeExtensionsCallback) {
+	p.onDecodeExtensionsCallbacks.RegisterCallback(func(params ...interface{}) error {
+		if len(params) != 2 {
+			panic(errors.Errorf("noise: OnDecodeExtensions received unexpected args %v", params))
+		}
+
+		return c(params[0].(*Node), p, params[1].(Extensions))
+	})
+}
+
+// contextKeyExtensions is the key of the extensions of a message within the context handed to the
+// callbacks handling it.
+type contextKeyExtensions struct{}
+
+// ExtensionsFromContext returns the registered extensions carried by the frame of the message being
+// handled, given the context handed to callbacks registered through `OnMessageReceivedContext`.
+// Unlike the message, extensions are not authenticated, and so handlers must not trust them to have
+// been sent by the peer, nor to have been left untouched.
+func ExtensionsFromContext(ctx context.Context) Extensions {
+	extensions, _ := ctx.Value(contextKeyExtensions{}).(Extensions)
+	return extensions
+}
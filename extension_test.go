@@ -0,0 +1,122 @@
+package noise
+
+import (
+	"context"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestExtensions(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	const extensionCustom ExtensionType = 100
+	RegisterExtension(extensionCustom)
+
+	// Extensions which are not registered, alongside padding, are skipped over.
+	frame := append(encodeExtensions(Extensions{
+		{Type: ExtensionPadding, Value: make([]byte, 32)},
+		{Type: ExtensionTraceContext, Value: []byte("trace")},
+		{Type: 9999, Value: []byte("unknown")},
+		{Type: extensionCustom, Value: []byte("custom")},
+	}), "message"...)
+
+	extensions, msg, err := decodeExtensions(frame)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("message"), msg)
+	assert.Equal(t, Extensions{{Type: ExtensionTraceContext, Value: []byte("trace")}, {Type: extensionCustom, Value: []byte("custom")}}, extensions)
+
+	extensions, msg, err = decodeExtensions(append(encodeExtensions(nil), "message"...))
+	assert.NoError(t, err)
+	assert.Empty(t, extensions)
+	assert.Equal(t, []byte("message"), msg)
+
+	// Extensions which overrun the frame or the extension area are malformed.
+	_, _, err = decodeExtensions([]byte{10, 1})
+	assert.True(t, errors.Is(err, ErrMalformedExtensions))
+
+	_, _, err = decodeExtensions([]byte{2, byte(ExtensionPriority), 5})
+	assert.True(t, errors.Is(err, ErrMalformedExtensions))
+
+	// Extensions are sent to and read by peers which negotiated them.
+	resetOpcodes()
+	opcodeTest := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go bob.Listen()
+
+	received := make(chan Extensions, 16)
+
+	bob.OnMessageReceivedContext(opcodeTest, func(ctx context.Context, node *Node, opcode Opcode, peer *Peer, message Message) error {
+		received <- ExtensionsFromContext(ctx)
+		return nil
+	})
+
+	attach := func(node *Node, peer *Peer, extensions Extensions, msg []byte) (Extensions, error) {
+		return append(extensions, Extension{Type: ExtensionPriority, Value: []byte{7}}, Extension{Type: ExtensionPadding, Value: make([]byte, 16)}), nil
+	}
+
+	params.FramePreamble = true
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	peer.OnEncodeExtensions(attach)
+
+	// Messages sent before the frame format is confirmed to the peer carry no extensions.
+	var got Extensions
+
+	for i := 0; i < 50 && got == nil; i++ {
+		assert.NoError(t, peer.SendMessage(testMsg{Text: "hello"}))
+
+		select {
+		case got = <-received:
+		case <-time.After(3 * time.Second):
+			t.Fatal("bob never received the message")
+		}
+	}
+
+	assert.Equal(t, Extensions{{Type: ExtensionPriority, Value: []byte{7}}}, got)
+
+	value, exists := got.Get(ExtensionPriority)
+	assert.True(t, exists)
+	assert.Equal(t, []byte{7}, value)
+
+	_, exists = got.Get(ExtensionTraceContext)
+	assert.False(t, exists)
+
+	// Extensions are left out of the frames of peers which did not negotiate them.
+	params.FramePreamble = false
+
+	charlie, err := NewNode(params)
+	assert.NoError(t, err)
+	defer charlie.Kill()
+
+	peer, err = charlie.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	peer.OnEncodeExtensions(attach)
+
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "hello"}))
+
+	select {
+	case got = <-received:
+		assert.Nil(t, got)
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob never received the message")
+	}
+}
@@ -0,0 +1,55 @@
+package noise
+
+import (
+	"sync/atomic"
+)
+
+// fdBudget counts the sockets held open to peers against a budget, such that connections are
+// refused by our node before the kernel fails to accept or dial them for lack of file descriptors.
+type fdBudget struct {
+	limit    int64
+	headroom int64
+
+	open int64
+}
+
+// newFDBudget returns a budget of sockets, of which headroom sockets may only be used by dials. A
+// zero limit budgets three quarters of the file descriptors our process may open, leaving the rest
+// to files and listeners, and a negative limit budgets sockets without bound. A zero headroom holds
+// back a tenth of the budget.
+func newFDBudget(limit, headroom int) *fdBudget {
+	if limit == 0 {
+		limit = fileDescriptorLimit() / 4 * 3
+	}
+
+	if limit <= 0 {
+		return &fdBudget{}
+	}
+
+	if headroom == 0 {
+		headroom = limit / 10
+	}
+
+	return &fdBudget{limit: int64(limit), headroom: int64(headroom)}
+}
+
+func (b *fdBudget) add(delta int64) {
+	atomic.AddInt64(&b.open, delta)
+}
+
+// mayAccept reports whether a peer may be accepted without eating into the headroom held back for
+// dials.
+func (b *fdBudget) mayAccept() bool {
+	return b.limit == 0 || atomic.LoadInt64(&b.open) < b.limit-b.headroom
+}
+
+// mayDial reports whether a peer may be dialed within the budget.
+func (b *fdBudget) mayDial() bool {
+	return b.limit == 0 || atomic.LoadInt64(&b.open) < b.limit
+}
+
+// FileDescriptors returns how many sockets our node holds open to peers, and how many it may hold
+// open at once. A limit of zero denotes that sockets are not budgeted.
+func (n *Node) FileDescriptors() (open, limit int) {
+	return int(atomic.LoadInt64(&n.fds.open)), int(n.fds.limit)
+}
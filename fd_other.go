@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package noise
+
+// fileDescriptorLimit returns zero, as the file descriptors our process may open are unknown on
+// this platform.
+func fileDescriptorLimit() int {
+	return 0
+}
@@ -0,0 +1,80 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFileDescriptorBudget(t *testing.T) {
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+	params.FileDescriptors = -1
+
+	var nodes []*Node
+
+	for i := 0; i < 3; i++ {
+		node, err := NewNode(params)
+		assert.NoError(t, err)
+
+		go node.Listen()
+		defer node.Kill()
+
+		nodes = append(nodes, node)
+	}
+
+	bob, carol, dave := nodes[0], nodes[1], nodes[2]
+
+	// Alice may hold two sockets open, one of which is held back for her dials.
+	params.FileDescriptors, params.DialHeadroom = 2, 1
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+
+	go alice.Listen()
+	defer alice.Kill()
+
+	refused := make(chan error, 1)
+
+	alice.OnListenerError(func(node *Node, err error) error {
+		refused <- err
+		return nil
+	})
+
+	_, err = bob.Dial(alice.ExternalAddress())
+	assert.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+
+	open, limit := alice.FileDescriptors()
+	assert.Equal(t, 1, open)
+	assert.Equal(t, 2, limit)
+
+	// Peers dialing alice may not eat into the headroom held back for her dials.
+	_, err = carol.Dial(alice.ExternalAddress())
+	assert.NoError(t, err)
+
+	select {
+	case err := <-refused:
+		assert.True(t, errors.Is(err, ErrOutOfFileDescriptors))
+	case <-time.After(3 * time.Second):
+		t.Fatal("alice did not refuse carol")
+	}
+
+	peer, err := alice.Dial(dave.ExternalAddress())
+	assert.NoError(t, err)
+
+	_, err = alice.Dial(carol.ExternalAddress())
+	assert.True(t, errors.Is(err, ErrOutOfFileDescriptors))
+
+	// Sockets are returned to the budget once peers disconnect.
+	peer.Disconnect()
+
+	open, _ = alice.FileDescriptors()
+	assert.Equal(t, 1, open)
+
+	_, err = alice.Dial(carol.ExternalAddress())
+	assert.NoError(t, err)
+}
@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package noise
+
+import (
+	"math"
+	"syscall"
+)
+
+// fileDescriptorLimit returns the soft RLIMIT_NOFILE of our process, or zero should it be unknown
+// or unlimited.
+func fileDescriptorLimit() int {
+	var rlimit syscall.Rlimit
+
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0
+	}
+
+	if cur := uint64(rlimit.Cur); cur < math.MaxInt32 {
+		return int(cur)
+	}
+
+	return 0
+}
@@ -0,0 +1,9 @@
+//go:build fips
+// +build fips
+
+package fips
+
+// Builds with the fips build tag run in FIPS mode from the moment our process starts.
+func init() {
+	Enable()
+}
@@ -0,0 +1,64 @@
+// Package fips restricts the cryptography our node performs to algorithms approved under FIPS 140,
+// for deployments which must only ever use approved algorithms.
+//
+// Once FIPS mode is enabled, either at runtime through Enable or at build time through the fips
+// build tag, keys may only be exchanged over P-256 ECDH, messages may only be sealed with
+// AES-256-GCM, and keys may only be derived with SHA-256 or SHA-384. Blocks configured with any
+// other algorithm fail their handshakes with ErrNotApproved.
+package fips
+
+import (
+	"github.com/pkg/errors"
+	"sync/atomic"
+)
+
+var ErrNotApproved = errors.New("fips: algorithm is not approved")
+
+var enabled uint32
+
+var (
+	approvedCiphers = map[string]struct{}{"AES-256-GCM": {}}
+	approvedHashes  = map[string]struct{}{"SHA-256": {}, "SHA-384": {}}
+	approvedDHs     = map[string]struct{}{"P-256": {}}
+)
+
+// Enable enables FIPS mode for the rest of the lifetime of our process. It should be called before
+// any blocks are built, as blocks pick approved defaults once FIPS mode is enabled.
+func Enable() {
+	atomic.StoreUint32(&enabled, 1)
+}
+
+// Enabled reports whether FIPS mode is enabled.
+func Enabled() bool {
+	return atomic.LoadUint32(&enabled) == 1
+}
+
+// CheckCipher returns ErrNotApproved should FIPS mode be enabled, and an AEAD cipher suite named as
+// reported by `protocol.LoadSession()` not be approved.
+func CheckCipher(name string) error {
+	return check(approvedCiphers, "cipher suite", name)
+}
+
+// CheckHash returns ErrNotApproved should FIPS mode be enabled, and a hash named as reported by
+// `protocol.LoadSession()` not be approved.
+func CheckHash(name string) error {
+	return check(approvedHashes, "hash", name)
+}
+
+// CheckDH returns ErrNotApproved should FIPS mode be enabled, and a Diffie-Hellman function named as
+// registered with `ecdh.RegisterDH()` not be approved.
+func CheckDH(name string) error {
+	return check(approvedDHs, "Diffie-Hellman function", name)
+}
+
+func check(approved map[string]struct{}, kind, name string) error {
+	if !Enabled() {
+		return nil
+	}
+
+	if _, ok := approved[name]; !ok {
+		return errors.Wrapf(ErrNotApproved, "%s %q may not be used in FIPS mode", kind, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package fips_test
+
+import (
+	"crypto/sha512"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/cipher/aead"
+	"github.com/perlin-network/noise/fips"
+	"github.com/perlin-network/noise/handshake/ecdh"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// handshake has two nodes handshake with one another, and returns the session established by the
+// first node, or the reason its handshake failed.
+func handshake(t *testing.T, layer transport.Layer, newProtocol func() *protocol.Protocol) (protocol.Session, error) {
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go bob.Listen()
+
+	established, failed := make(chan *noise.Peer, 1), make(chan error, 1)
+
+	newProtocol().
+		OnEstablished(func(peer *noise.Peer) { established <- peer }).
+		OnFailed(func(peer *noise.Peer, err error) { failed <- err }).
+		Enforce(alice)
+
+	newProtocol().Enforce(bob)
+
+	_, err = alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	select {
+	case peer := <-established:
+		return protocol.LoadSession(peer), nil
+	case err := <-failed:
+		return protocol.Session{}, err
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for handshake")
+	}
+
+	return protocol.Session{}, nil
+}
+
+func TestFIPS(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	if !fips.Enabled() {
+		assert.NoError(t, fips.CheckDH("Ed25519"))
+		assert.NoError(t, fips.CheckCipher("ChaCha20-Poly1305"))
+
+		fips.Enable()
+	}
+
+	assert.True(t, fips.Enabled())
+
+	assert.NoError(t, fips.CheckDH("P-256"))
+	assert.NoError(t, fips.CheckCipher("AES-256-GCM"))
+	assert.NoError(t, fips.CheckHash("SHA-256"))
+	assert.NoError(t, fips.CheckHash("SHA-384"))
+
+	for _, err := range []error{
+		fips.CheckDH("Ed25519"),
+		fips.CheckDH("Curve448"),
+		fips.CheckCipher("XChaCha20-Poly1305"),
+		fips.CheckHash("SHA-512"),
+	} {
+		assert.True(t, errors.Is(err, fips.ErrNotApproved), "%v", err)
+	}
+
+	// Blocks built once FIPS mode is enabled default to approved algorithms, and seal messages sent to
+	// in-process peers regardless.
+	session, err := handshake(t, transport.NewInProcess(), func() *protocol.Protocol {
+		return protocol.New().Register(ecdh.New()).Register(aead.New().WithHash(sha512.New384).WithoutEncryptionInProcess())
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ECDH-P-256", session.Pattern)
+	assert.Equal(t, "AES-256-GCM", session.Cipher)
+	assert.Equal(t, "SHA-384", session.Hash)
+
+	// Blocks configured with algorithms which are not approved fail their handshakes.
+	for _, newProtocol := range []func() *protocol.Protocol{
+		func() *protocol.Protocol {
+			return protocol.New().Register(ecdh.New().WithDH(ecdh.Curve25519).TimeoutAfter(time.Second)).Register(aead.New())
+		},
+		func() *protocol.Protocol {
+			return protocol.New().Register(ecdh.New().TimeoutAfter(time.Second)).Register(aead.New().WithSuite(aead.ChaCha20_Poly1305).WithACKTimeout(time.Second))
+		},
+		func() *protocol.Protocol {
+			return protocol.New().Register(ecdh.New().TimeoutAfter(time.Second)).Register(aead.New().WithHash(sha512.New).WithACKTimeout(time.Second))
+		},
+	} {
+		_, err := handshake(t, transport.NewBuffered(), newProtocol)
+		assert.True(t, errors.Is(err, fips.ErrNotApproved), "%v", err)
+	}
+}
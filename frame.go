@@ -0,0 +1,173 @@
+package noise
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"sync"
+)
+
+// Every message is sent to a peer within a frame, which is the size of the message encoded as a
+// uvarint followed by the message itself. A frame of size zero is a standalone heartbeat.
+//
+// Peers may negotiate which version of the frame format, and which optional features of it, they
+// frame messages with. The peer which dialed the connection opens it with a preamble, and the peer
+// which accepted the connection answers with a preamble of its own that carries the version and
+// features negotiated, which the peer that dialed confirms with a third. A preamble is encoded as
+// follows, with all fields in big-endian order:
+//
+//	uvarint  magic, being 0x6e6f697365 ("noise" in ASCII)
+//	uint16   version
+//	uint16   flags
+//
+// The magic is read by nodes unaware of preambles as the size of a frame far beyond any maximum
+// message size, and so they refuse the connection, rather than misreading the frames that follow.
+//
+// Peers which do not open a connection with a preamble frame messages with version 1 of the frame
+// format, without any optional features, as nodes did before preambles were introduced.
+const (
+	// FrameVersion is the newest version of the frame format our node speaks.
+	FrameVersion uint16 = 1
+
+	frameMagic uint64 = 0x6e6f697365
+)
+
+var ErrFramingFailed = errors.New("noise: failed to negotiate a frame format with peer")
+
+// FrameFlags are optional features of the frame format which both peers must support to be used.
+type FrameFlags uint16
+
+// Framing is the version of the frame format, and the optional features of it, that messages are
+// framed with over a connection to a peer.
+type Framing struct {
+	Version uint16
+	Flags   FrameFlags
+}
+
+// legacyFraming is the frame format of peers which did not open their connection with a preamble.
+var legacyFraming = Framing{Version: 1}
+
+// Framing returns the frame format negotiated with the peer. Until the format is negotiated, or
+// should the connection not have been opened with a preamble, version 1 of the frame format
+// without any optional features is returned.
+func (p *Peer) Framing() Framing {
+	if f, ok := p.framing.Load().(Framing); ok {
+		return f
+	}
+
+	return legacyFraming
+}
+
+// encodePreamble encodes a preamble carrying a frame format.
+func encodePreamble(f Framing) []byte {
+	buf := make([]byte, binary.MaxVarintLen64+4)
+
+	n := binary.PutUvarint(buf, frameMagic)
+	binary.BigEndian.PutUint16(buf[n:], f.Version)
+	binary.BigEndian.PutUint16(buf[n+2:], uint16(f.Flags))
+
+	return buf[:n+4]
+}
+
+// readPreamble reads the remainder of a preamble, whose magic has already been read.
+func readPreamble(r io.Reader) (Framing, error) {
+	var buf [4]byte
+
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return Framing{}, errors.Wrap(err, "failed to read preamble")
+	}
+
+	return Framing{Version: binary.BigEndian.Uint16(buf[:2]), Flags: FrameFlags(binary.BigEndian.Uint16(buf[2:]))}, nil
+}
+
+// negotiateFraming picks the newest frame format both our node and a peer speak, given the preamble
+// a peer which dialed us opened its connection with.
+func (n *Node) negotiateFraming(theirs Framing) (Framing, error) {
+	if theirs.Version == 0 {
+		return Framing{}, errors.Wrap(ErrFramingFailed, "peer speaks no version of the frame format")
+	}
+
+	ours := Framing{Version: FrameVersion, Flags: n.frameFlags}
+
+	if theirs.Version < ours.Version {
+		ours.Version = theirs.Version
+	}
+
+	ours.Flags &= theirs.Flags
+
+	return ours, nil
+}
+
+// receivePreamble handles a preamble received from a peer. Preambles are exchanged three times over
+// a connection: the peer which dialed opens it with the frame formats it speaks, the peer which
+// accepted answers with the format negotiated, and the peer which dialed confirms it. Each peer
+// frames messages with the format negotiated only after having sent its own preamble, and reads
+// frames with it only after having read the preamble of the other, such that neither peer holds
+// off on sending messages while formats are negotiated.
+//
+// It returns the wait group the receive worker of the peer was signalled to stop with, should the
+// peer be disconnected while a preamble is queued to be sent.
+func (p *Peer) receivePreamble(first bool) (*sync.WaitGroup, error) {
+	theirs, err := readPreamble(p.readBuffer)
+	if err != nil {
+		return nil, err
+	}
+
+	p.preamblesRead++
+
+	var reply Framing
+
+	switch {
+	case p.dialed && p.preamblesRead == 1:
+		if !p.node.framePreamble {
+			return nil, errors.Wrap(ErrFramingFailed, "peer answered a preamble we never sent")
+		}
+
+		if theirs.Version == 0 || theirs.Version > FrameVersion || theirs.Flags&^p.node.frameFlags != 0 {
+			return nil, errors.Wrapf(ErrFramingFailed, "peer picked version %d with flags %#x, which we do not speak", theirs.Version, theirs.Flags)
+		}
+
+		p.framing.Store(theirs)
+		p.readFraming = theirs
+		reply = theirs
+	case !p.dialed && p.preamblesRead == 1:
+		if !first {
+			return nil, errors.Wrap(ErrFramingFailed, "peer sent a preamble after having sent messages")
+		}
+
+		if reply, err = p.node.negotiateFraming(theirs); err != nil {
+			return nil, err
+		}
+
+		p.framing.Store(reply)
+	case !p.dialed && p.preamblesRead == 2:
+		if theirs != p.Framing() {
+			return nil, errors.Wrapf(ErrFramingFailed, "peer confirmed version %d with flags %#x, which was not negotiated", theirs.Version, theirs.Flags)
+		}
+
+		p.readFraming = theirs
+		return nil, nil
+	default:
+		return nil, errors.Wrap(ErrFramingFailed, "peer sent more preambles than expected")
+	}
+
+	select {
+	case p.sendQueue <- sendHandle{payload: encodePreamble(reply), preamble: true, framing: reply}:
+	case wg := <-p.kill:
+		return wg, nil
+	}
+
+	return nil, nil
+}
+
+// openFraming opens a connection we dialed with a preamble carrying the frame formats our node
+// speaks, should our node negotiate frame formats.
+func (p *Peer) openFraming() {
+	if !p.dialed || !p.node.framePreamble {
+		return
+	}
+
+	if _, err := p.conn.Write(encodePreamble(Framing{Version: FrameVersion, Flags: p.node.frameFlags})); err != nil {
+		p.onConnErrorCallbacks.RunCallbacks(p.node, errors.Wrap(err, "failed to send preamble"))
+	}
+}
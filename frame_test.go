@@ -0,0 +1,100 @@
+package noise
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestFramePreamble(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	opcodeTest := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+
+	layer := transport.NewBuffered()
+
+	params := DefaultParams()
+	params.Transport = layer
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go bob.Listen()
+
+	received := make(chan *Peer, 1)
+
+	bob.OnMessageReceived(opcodeTest, func(node *Node, opcode Opcode, peer *Peer, message Message) error {
+		received <- peer
+		return nil
+	})
+
+	params.FramePreamble = true
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	go alice.Listen()
+
+	// Peers which open their connection with a preamble are answered, and neither peer holds off on
+	// sending messages while a frame format is negotiated.
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "hello"}))
+
+	select {
+	case accepted := <-received:
+		assert.Equal(t, Framing{Version: FrameVersion, Flags: FrameExtensions}, accepted.Framing())
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob never received the message")
+	}
+
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "world"}))
+	<-received
+
+	assert.Equal(t, Framing{Version: FrameVersion, Flags: FrameExtensions}, peer.Framing())
+
+	// Nodes unaware of preambles read the magic as the size of a frame beyond any maximum size.
+	size, err := binary.ReadUvarint(bytes.NewReader(encodePreamble(Framing{Version: FrameVersion})))
+	assert.NoError(t, err)
+	assert.True(t, size > 1<<32)
+
+	// Newer versions and unknown features are negotiated down to those both peers speak.
+	conn, err := layer.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write(encodePreamble(Framing{Version: 7, Flags: 0xffff}))
+	assert.NoError(t, err)
+
+	answer := make([]byte, len(encodePreamble(Framing{Version: FrameVersion, Flags: FrameExtensions})))
+	_, err = io.ReadFull(conn, answer)
+	assert.NoError(t, err)
+	assert.Equal(t, encodePreamble(Framing{Version: FrameVersion, Flags: FrameExtensions}), answer)
+
+	// Peers which confirm a format other than the one negotiated, or which speak no version, are
+	// disconnected.
+	_, err = conn.Write(encodePreamble(Framing{Version: 7, Flags: 0xffff}))
+	assert.NoError(t, err)
+
+	_, err = conn.Read(answer)
+	assert.Error(t, err)
+
+	conn, err = layer.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write(encodePreamble(Framing{}))
+	assert.NoError(t, err)
+
+	_, err = conn.Read(answer)
+	assert.Error(t, err)
+}
@@ -0,0 +1,113 @@
+package cert
+
+import (
+	"bytes"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/signature"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// MaxChainLength is the number of certificates a chain may hold at most, including the certificate
+// of the node key itself.
+const MaxChainLength = 8
+
+// signingContext separates signatures over certificates from signatures produced by the same keys
+// for any other purpose.
+const signingContext = "noise certificate:"
+
+var (
+	ErrNoCertificate        = errors.New("cert: peer presented no certificate")
+	ErrUntrustedCertificate = errors.New("cert: certificate chain is not issued by a trusted operator")
+	ErrExpiredCertificate   = errors.New("cert: certificate is not valid at this time")
+)
+
+// Certificate has an issuer vouch for the key of a subject for a window of time. Operators issue
+// certificates for the keys of their nodes off of the keys of their certificate authorities, and may
+// delegate issuing certificates to intermediate keys by issuing certificates to them marked as CA.
+type Certificate struct {
+	Subject []byte
+	Issuer  []byte
+
+	// CA marks whether the subject may issue certificates in turn.
+	CA bool
+
+	NotBefore, NotAfter time.Time
+
+	Signature []byte
+}
+
+// Issue issues a certificate vouching for the public key of a subject from the keys of an issuer,
+// valid within a window of time.
+func Issue(scheme signature.Scheme, issuerPublicKey, issuerPrivateKey, subject []byte, ca bool, notBefore, notAfter time.Time) (Certificate, error) {
+	c := Certificate{Subject: subject, Issuer: issuerPublicKey, CA: ca, NotBefore: notBefore, NotAfter: notAfter}
+
+	sig, err := scheme.Sign(issuerPrivateKey, c.signingPayload())
+	if err != nil {
+		return c, errors.Wrap(err, "cert: failed to sign certificate")
+	}
+
+	c.Signature = sig
+
+	return c, nil
+}
+
+// VerifyChain verifies a chain of certificates, starting at the certificate vouching for the key of
+// a node, in which every certificate is issued by the subject of the certificate after it, and the
+// last certificate is issued by one of the trusted roots. Every certificate must be valid at the
+// given time.
+func VerifyChain(scheme signature.Scheme, chain []Certificate, roots [][]byte, now time.Time) error {
+	if len(chain) == 0 {
+		return ErrNoCertificate
+	}
+
+	if len(chain) > MaxChainLength {
+		return errors.Wrapf(ErrUntrustedCertificate, "chain holds %d certificates, when at most %d are allowed", len(chain), MaxChainLength)
+	}
+
+	for i, c := range chain {
+		if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+			return errors.Wrapf(ErrExpiredCertificate, "certificate %d is valid from %s to %s", i, c.NotBefore, c.NotAfter)
+		}
+
+		if i > 0 && !c.CA {
+			return errors.Wrapf(ErrUntrustedCertificate, "certificate %d issued certificate %d, yet is not marked as CA", i, i-1)
+		}
+
+		if i+1 < len(chain) && !bytes.Equal(c.Issuer, chain[i+1].Subject) {
+			return errors.Wrapf(ErrUntrustedCertificate, "certificate %d is not issued by the subject of certificate %d", i, i+1)
+		}
+
+		if err := scheme.Verify(c.Issuer, c.signingPayload(), c.Signature); err != nil {
+			return errors.Wrapf(ErrUntrustedCertificate, "signature of certificate %d fails to be verified: %v", i, err)
+		}
+	}
+
+	issuer := chain[len(chain)-1].Issuer
+
+	for _, root := range roots {
+		if bytes.Equal(issuer, root) {
+			return nil
+		}
+	}
+
+	return errors.Wrap(ErrUntrustedCertificate, "chain is issued by a key which is not a trusted root")
+}
+
+func (c Certificate) signingPayload() []byte {
+	writer := payload.NewWriter([]byte(signingContext))
+
+	writer.WriteBytes(c.Subject)
+	writer.WriteBytes(c.Issuer)
+
+	if c.CA {
+		writer.WriteByte(1)
+	} else {
+		writer.WriteByte(0)
+	}
+
+	writer.WriteUint64(uint64(c.NotBefore.UnixNano()))
+	writer.WriteUint64(uint64(c.NotAfter.UnixNano()))
+
+	return writer.Bytes()
+}
@@ -0,0 +1,181 @@
+// Package cert requires peers to present certificate chains issued by the operators of a network,
+// such that permissioned networks may admit only nodes whose keys an operator vouched for, rather
+// than any node holding a key.
+//
+// Operators issue certificates for the keys of their nodes off of the keys of their certificate
+// authorities. Peers exchange their chains as they complete the block, alongside a signature by
+// their node key over keying material exported from the session established with one another,
+// proving that the chain is theirs.
+package cert
+
+import (
+	"bytes"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/signature"
+	"github.com/perlin-network/noise/signature/eddsa"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	keyChain = "cert.chain"
+
+	// exportLabel labels the keying material peers sign to prove that the chain they present is
+	// theirs.
+	exportLabel = "noise certificate"
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrInvalidProof = errors.New("cert: peer failed to prove it holds the key its certificate is issued to")
+)
+
+// Verifier is called on the chain of every peer once it is verified against our trusted roots, for
+// checks of its own such as against revoked keys. Peers are disconnected should it return an error.
+type Verifier func(peer *noise.Peer, chain []Certificate) error
+
+type block struct {
+	opcodeCredentials noise.Opcode
+	timeoutDuration   time.Duration
+
+	scheme signature.Scheme
+
+	chain []Certificate
+	roots [][]byte
+
+	verifier Verifier
+	optional bool
+}
+
+// New returns a block which presents a certificate chain to our peers, starting at a certificate
+// issued to the key of our node, and requires our peers to present chains issued by any of the
+// given roots in turn.
+//
+// The block must be registered after a block which establishes a shared key, such as ECDH. By
+// default, certificates are signed over Ed25519, and peers which do not present their chain within
+// 10 seconds are disconnected.
+func New(chain []Certificate, roots ...[]byte) *block {
+	return &block{
+		timeoutDuration: 10 * time.Second,
+		scheme:          eddsa.New(),
+		chain:           chain,
+		roots:           roots,
+	}
+}
+
+func (b *block) TimeoutAfter(timeoutDuration time.Duration) *block {
+	b.timeoutDuration = timeoutDuration
+	return b
+}
+
+// WithSignatureScheme sets the signature scheme certificates and proofs are signed over.
+func (b *block) WithSignatureScheme(scheme signature.Scheme) *block {
+	b.scheme = scheme
+	return b
+}
+
+// WithVerifier registers a verifier to be called on the chains of our peers, once they are verified.
+func (b *block) WithVerifier(verifier Verifier) *block {
+	b.verifier = verifier
+	return b
+}
+
+// Optional admits peers which present no certificate chain, for networks migrating towards
+// requiring certificates. Chains which are presented must still verify.
+func (b *block) Optional() *block {
+	b.optional = true
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeCredentials = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Credentials)(nil))
+
+	if len(b.chain) > 0 && !bytes.Equal(b.chain[0].Subject, node.Keys.PublicKey()) {
+		panic("cert: the first certificate of our chain must be issued to the public key of our node")
+	}
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	material, err := protocol.ExportKeyingMaterial(peer, exportLabel, 32)
+	if err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "cert: a shared key must be established before exchanging certificates")
+	}
+
+	ours := Credentials{Chain: b.chain}
+
+	if len(b.chain) > 0 {
+		if ours.Proof, err = b.scheme.Sign(peer.Node().Keys.PrivateKey(), material); err != nil {
+			return errors.Wrap(protocol.DisconnectWith(err), "cert: failed to sign proof of possession")
+		}
+	}
+
+	if err := peer.SendMessage(ours); err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "cert: failed to present our certificate chain")
+	}
+
+	var theirs Credentials
+
+	select {
+	case <-peer.Node().Clock().After(b.timeoutDuration):
+		return errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeTimeout), "cert: timed out waiting for peer to present its certificate chain")
+	case msg := <-peer.Receive(b.opcodeCredentials):
+		theirs = msg.(Credentials)
+	}
+
+	if len(theirs.Chain) == 0 && b.optional {
+		log.Debug().Msg("Peer presented no certificate chain, and was admitted as certificates are optional.")
+		return nil
+	}
+
+	if err := b.verify(peer, material, theirs); err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "cert: refused certificate chain of peer")
+	}
+
+	peer.Set(keyChain, theirs.Chain)
+
+	log.Debug().
+		Hex("issuer", theirs.Chain[len(theirs.Chain)-1].Issuer).
+		Int("length", len(theirs.Chain)).
+		Msg("Verified certificate chain of our peer.")
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+func (b *block) verify(peer *noise.Peer, material []byte, theirs Credentials) error {
+	if err := VerifyChain(b.scheme, theirs.Chain, b.roots, peer.Node().Clock().Now()); err != nil {
+		return err
+	}
+
+	subject := theirs.Chain[0].Subject
+
+	if err := b.scheme.Verify(subject, material, theirs.Proof); err != nil {
+		return errors.Wrap(ErrInvalidProof, err.Error())
+	}
+
+	// Peers which identified themselves to us beforehand must present a chain issued to the same key.
+	if protocol.HasPeerID(peer) && !bytes.Equal(protocol.PeerID(peer).PublicKey(), subject) {
+		return errors.Wrap(ErrInvalidProof, "certificate is issued to a key other than the one our peer identified itself with")
+	}
+
+	if b.verifier != nil {
+		if err := b.verifier(peer, theirs.Chain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Of returns the verified certificate chain a peer presented, or nil should the peer not have
+// presented one.
+func Of(peer *noise.Peer) []Certificate {
+	chain, _ := peer.Get(keyChain).([]Certificate)
+	return chain
+}
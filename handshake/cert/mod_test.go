@@ -0,0 +1,176 @@
+package cert
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/cipher/aead"
+	"github.com/perlin-network/noise/handshake/ecdh"
+	"github.com/perlin-network/noise/identity"
+	"github.com/perlin-network/noise/identity/ed25519"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/signature/eddsa"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var scheme = eddsa.New()
+
+// impostor claims the public key of another node, while only holding a private key of its own.
+type impostor struct {
+	identity.Keypair
+	publicKey []byte
+}
+
+func (k impostor) PublicKey() []byte {
+	return k.publicKey
+}
+
+// issue issues a certificate to a subject, valid for an hour either side of now.
+func issue(t *testing.T, issuer *ed25519.Keypair, subject []byte, ca bool) Certificate {
+	c, err := Issue(scheme, issuer.PublicKey(), issuer.PrivateKey(), subject, ca, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	return c
+}
+
+func TestVerifyChain(t *testing.T) {
+	root, intermediate, leaf := ed25519.RandomKeys(), ed25519.RandomKeys(), ed25519.RandomKeys()
+
+	chain := []Certificate{
+		issue(t, intermediate, leaf.PublicKey(), false),
+		issue(t, root, intermediate.PublicKey(), true),
+	}
+
+	now := time.Now()
+
+	assert.NoError(t, VerifyChain(scheme, chain, [][]byte{root.PublicKey()}, now))
+	assert.NoError(t, VerifyChain(scheme, chain[1:], [][]byte{root.PublicKey()}, now))
+
+	assert.True(t, errors.Is(VerifyChain(scheme, nil, [][]byte{root.PublicKey()}, now), ErrNoCertificate))
+	assert.True(t, errors.Is(VerifyChain(scheme, chain, [][]byte{intermediate.PublicKey()}, now), ErrUntrustedCertificate))
+	assert.True(t, errors.Is(VerifyChain(scheme, chain, [][]byte{root.PublicKey()}, now.Add(2*time.Hour)), ErrExpiredCertificate))
+
+	// Certificates not marked as CA may not issue certificates.
+	chain[1] = issue(t, root, intermediate.PublicKey(), false)
+	assert.True(t, errors.Is(VerifyChain(scheme, chain, [][]byte{root.PublicKey()}, now), ErrUntrustedCertificate))
+
+	// Certificates must be issued by the subject of the certificate after them.
+	chain[1] = issue(t, root, ed25519.RandomKeys().PublicKey(), true)
+	assert.True(t, errors.Is(VerifyChain(scheme, chain, [][]byte{root.PublicKey()}, now), ErrUntrustedCertificate))
+
+	// Certificates which are tampered with fail to verify.
+	tampered := issue(t, root, leaf.PublicKey(), false)
+	tampered.NotAfter = tampered.NotAfter.Add(time.Hour)
+	assert.True(t, errors.Is(VerifyChain(scheme, []Certificate{tampered}, [][]byte{root.PublicKey()}, now), ErrUntrustedCertificate))
+
+	// Chains survive being sent over the wire.
+	msg, err := Credentials{}.Read(payload.NewReader(Credentials{Chain: chain[:1], Proof: []byte("proof")}.Write()))
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyChain(scheme, msg.(Credentials).Chain, [][]byte{intermediate.PublicKey()}, now))
+}
+
+func TestHandshake(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	root := ed25519.RandomKeys()
+
+	// Blocks are made given the keys of their node, which they may replace.
+	dial := func(alice, bob func(keys *identity.Keypair) *block) (*noise.Peer, func()) {
+		layer := transport.NewBuffered()
+
+		var nodes []*noise.Node
+
+		for _, f := range []func(keys *identity.Keypair) *block{alice, bob} {
+			keys := identity.Keypair(ed25519.RandomKeys())
+			b := f(&keys)
+
+			params := noise.DefaultParams()
+			params.Transport = layer
+			params.Keys = keys
+
+			node, err := noise.NewNode(params)
+			assert.NoError(t, err)
+
+			protocol.New().Register(ecdh.New()).Register(aead.New()).Register(b.TimeoutAfter(3 * time.Second)).Enforce(node)
+
+			go node.Listen()
+
+			nodes = append(nodes, node)
+		}
+
+		peer, err := nodes[0].Dial(nodes[1].ExternalAddress())
+		assert.NoError(t, err)
+
+		return peer, func() {
+			nodes[0].Kill()
+			nodes[1].Kill()
+		}
+	}
+
+	certified := func(keys *identity.Keypair) *block {
+		return New([]Certificate{issue(t, root, (*keys).PublicKey(), false)}, root.PublicKey())
+	}
+
+	peer, kill := dial(certified, certified)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+	assert.Len(t, Of(peer), 1)
+	assert.Equal(t, root.PublicKey(), Of(peer)[0].Issuer)
+	kill()
+
+	// Verifiers are called on chains once they are verified.
+	refused := errors.New("refused")
+
+	peer, kill = dial(func(keys *identity.Keypair) *block {
+		return certified(keys).WithVerifier(func(peer *noise.Peer, chain []Certificate) error {
+			return refused
+		})
+	}, certified)
+	assert.True(t, errors.Is(protocol.WaitUntilEstablished(peer), refused))
+	kill()
+
+	// Peers which present no certificate are refused, unless certificates are optional.
+	uncertified := func(keys *identity.Keypair) *block {
+		return New(nil, root.PublicKey()).Optional()
+	}
+
+	peer, kill = dial(certified, uncertified)
+	assert.True(t, errors.Is(protocol.WaitUntilEstablished(peer), ErrNoCertificate))
+	kill()
+
+	peer, kill = dial(func(keys *identity.Keypair) *block { return certified(keys).Optional() }, uncertified)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+	assert.Nil(t, Of(peer))
+	kill()
+
+	// Peers whose certificates are issued by other operators, or which expired, are refused.
+	peer, kill = dial(certified, func(keys *identity.Keypair) *block {
+		return New([]Certificate{issue(t, ed25519.RandomKeys(), (*keys).PublicKey(), false)}, root.PublicKey())
+	})
+	assert.True(t, errors.Is(protocol.WaitUntilEstablished(peer), ErrUntrustedCertificate))
+	kill()
+
+	peer, kill = dial(certified, func(keys *identity.Keypair) *block {
+		c, err := Issue(scheme, root.PublicKey(), root.PrivateKey(), (*keys).PublicKey(), false, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+		assert.NoError(t, err)
+
+		return New([]Certificate{c}, root.PublicKey())
+	})
+	assert.True(t, errors.Is(protocol.WaitUntilEstablished(peer), ErrExpiredCertificate))
+	kill()
+
+	// Peers presenting chains issued to keys other than their own are refused.
+	victim := ed25519.RandomKeys()
+	stolen := issue(t, root, victim.PublicKey(), false)
+
+	peer, kill = dial(certified, func(keys *identity.Keypair) *block {
+		*keys = impostor{Keypair: *keys, publicKey: victim.PublicKey()}
+		return New([]Certificate{stolen}, root.PublicKey())
+	})
+	assert.True(t, errors.Is(protocol.WaitUntilEstablished(peer), ErrInvalidProof))
+	kill()
+}
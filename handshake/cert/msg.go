@@ -0,0 +1,95 @@
+package cert
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"time"
+)
+
+var _ noise.Message = (*Credentials)(nil)
+
+// Credentials holds the certificate chain a peer presents, alongside proof that the peer holds the
+// private key of the subject of the first certificate of the chain.
+type Credentials struct {
+	Chain []Certificate
+
+	// Proof is a signature over keying material exported from the session established with the
+	// peer, such that chains lifted off of one session may not be replayed over another.
+	Proof []byte
+}
+
+func (Credentials) Read(reader payload.Reader) (noise.Message, error) {
+	count, err := reader.ReadByte()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read number of certificates")
+	}
+
+	if count > MaxChainLength {
+		return nil, errors.Errorf("got %d certificates, when at most %d are allowed", count, MaxChainLength)
+	}
+
+	var msg Credentials
+
+	for i := 0; i < int(count); i++ {
+		var c Certificate
+
+		if c.Subject, err = reader.ReadBytes(); err != nil {
+			return nil, errors.Wrap(err, "failed to read subject of certificate")
+		}
+
+		if c.Issuer, err = reader.ReadBytes(); err != nil {
+			return nil, errors.Wrap(err, "failed to read issuer of certificate")
+		}
+
+		ca, err := reader.ReadByte()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read whether certificate is of a CA")
+		}
+
+		c.CA = ca == 1
+
+		notBefore, err := reader.ReadUint64()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read start of validity of certificate")
+		}
+
+		notAfter, err := reader.ReadUint64()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read end of validity of certificate")
+		}
+
+		c.NotBefore, c.NotAfter = time.Unix(0, int64(notBefore)), time.Unix(0, int64(notAfter))
+
+		if c.Signature, err = reader.ReadBytes(); err != nil {
+			return nil, errors.Wrap(err, "failed to read signature of certificate")
+		}
+
+		msg.Chain = append(msg.Chain, c)
+	}
+
+	if msg.Proof, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read proof of possession")
+	}
+
+	return msg, nil
+}
+
+func (m Credentials) Write() []byte {
+	writer := payload.NewWriter(nil).WriteByte(byte(len(m.Chain)))
+
+	for _, c := range m.Chain {
+		writer.WriteBytes(c.Subject).WriteBytes(c.Issuer)
+
+		if c.CA {
+			writer.WriteByte(1)
+		} else {
+			writer.WriteByte(0)
+		}
+
+		writer.WriteUint64(uint64(c.NotBefore.UnixNano())).WriteUint64(uint64(c.NotAfter.UnixNano()))
+		writer.WriteBytes(c.Signature)
+	}
+
+	return writer.WriteBytes(m.Proof).Bytes()
+}
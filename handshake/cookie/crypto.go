@@ -0,0 +1,67 @@
+package cookie
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+)
+
+const (
+	timestampSize = 8
+	cookieSize    = timestampSize + sha256.Size
+)
+
+// generateCookie produces a cookie bound to a remote address and the current time. A cookie
+// is comprised of an 8-byte UNIX timestamp followed by HMAC-SHA256(key, timestamp || address),
+// such that a responder may verify it without having kept any state for the initiator.
+//
+// The key is derived from our secret and the epoch the timestamp falls in, such that the key
+// cookies are signed with rotates every lifetime.
+func generateCookie(secret []byte, address string, lifetime time.Duration, now time.Time) []byte {
+	var timestamp [timestampSize]byte
+	binary.LittleEndian.PutUint64(timestamp[:], uint64(now.Unix()))
+
+	return append(timestamp[:], computeMAC(secret, lifetime, timestamp[:], address)...)
+}
+
+// verifyCookie checks that a cookie was generated by us for a given remote address, and that
+// it has not outlived its lifetime.
+func verifyCookie(secret []byte, address string, cookie []byte, lifetime time.Duration, now time.Time) bool {
+	if len(cookie) != cookieSize {
+		return false
+	}
+
+	issued := time.Unix(int64(binary.LittleEndian.Uint64(cookie[:timestampSize])), 0)
+
+	if issued.After(now.Add(time.Second)) || now.Sub(issued) > lifetime {
+		return false
+	}
+
+	return hmac.Equal(cookie[timestampSize:], computeMAC(secret, lifetime, cookie[:timestampSize], address))
+}
+
+func computeMAC(secret []byte, lifetime time.Duration, timestamp []byte, address string) []byte {
+	mac := hmac.New(sha256.New, epochKey(secret, lifetime, timestamp))
+	mac.Write(timestamp)
+	mac.Write([]byte(address))
+
+	return mac.Sum(nil)
+}
+
+// epochKey derives the key cookies issued at a timestamp are signed with, as HMAC-SHA256(secret,
+// epoch), where the epoch is the number of lifetimes elapsed since the UNIX epoch.
+func epochKey(secret []byte, lifetime time.Duration, timestamp []byte) []byte {
+	seconds := uint64(lifetime / time.Second)
+	if seconds == 0 {
+		seconds = 1
+	}
+
+	var epoch [8]byte
+	binary.LittleEndian.PutUint64(epoch[:], binary.LittleEndian.Uint64(timestamp)/seconds)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(epoch[:])
+
+	return mac.Sum(nil)
+}
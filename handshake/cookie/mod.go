@@ -0,0 +1,336 @@
+package cookie
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/internal/supervisor"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const secretSize = 32
+
+var (
+	_ transport.Layer = (*Layer)(nil)
+	_ net.Listener    = (*listener)(nil)
+
+	// hello is the first packet an initiator sends, which identifies and versions the exchange.
+	hello = []byte("NCK\x01")
+)
+
+// Layer wraps a transport layer with a stateless retry, similar to that of QUIC's Retry packets.
+//
+// A listening node replies to the first packet of every incoming connection with an HMAC cookie
+// bound to the address it observes the initiator at, and only hands the connection over to the
+// node once the initiator echoes the cookie back. Until then, no peer is allocated, no callbacks
+// are run, and no handshake takes place, such that initiators unable to receive packets at the
+// address they claim to send from cost the node no more than a single HMAC.
+//
+// Only the listening side issues cookies. Dialing through the layer transparently echoes back the
+// cookie issued by the remote node before the connection is handed to the node.
+type Layer struct {
+	transport.Layer
+
+	secret []byte
+
+	lifetime        time.Duration
+	timeoutDuration time.Duration
+
+	maxPending int
+
+	clock clock.Clock
+}
+
+// Wrap wraps a transport layer with a stateless retry, with sensible defaults.
+//
+// By default, cookies are valid for 30 seconds, initiators that do not complete the exchange in 10
+// seconds are disconnected, and at most 1024 incoming connections may be part way through the
+// exchange at any given time. A random 256-bit secret is generated for signing cookies.
+func Wrap(layer transport.Layer) *Layer {
+	secret := make([]byte, secretSize)
+
+	if _, err := rand.Read(secret); err != nil {
+		panic(errors.Wrap(err, "cookie: failed to generate secret"))
+	}
+
+	return &Layer{
+		Layer:           layer,
+		secret:          secret,
+		lifetime:        30 * time.Second,
+		timeoutDuration: 10 * time.Second,
+		maxPending:      1024,
+		clock:           clock.New(),
+	}
+}
+
+// WithSecret sets the secret cookie keys are derived from. Nodes sharing a listening address
+// behind a load balancer should share the same secret.
+func (l *Layer) WithSecret(secret []byte) *Layer {
+	if len(secret) == 0 {
+		panic("cookie: cannot have an empty secret")
+	}
+
+	l.secret = secret
+	return l
+}
+
+// WithLifetime sets how long an issued cookie remains valid for. The key cookies are signed with
+// is rotated every lifetime.
+func (l *Layer) WithLifetime(lifetime time.Duration) *Layer {
+	l.lifetime = lifetime
+	return l
+}
+
+// WithClock sets the clock cookies are issued and expire against. It defaults to the system clock.
+// Connection deadlines are always measured against the system clock.
+func (l *Layer) WithClock(clock clock.Clock) *Layer {
+	l.clock = clock
+	return l
+}
+
+// WithMaxPending sets how many incoming connections may be part way through the exchange at any
+// given time. Should another connection come in, the oldest connection part way through the
+// exchange is closed to make room for it, such that initiators holding connections open idly may
+// not lock out others.
+func (l *Layer) WithMaxPending(maxPending int) *Layer {
+	if maxPending <= 0 {
+		panic("cookie: max pending connections must be positive")
+	}
+
+	l.maxPending = maxPending
+	return l
+}
+
+func (l *Layer) TimeoutAfter(timeoutDuration time.Duration) *Layer {
+	l.timeoutDuration = timeoutDuration
+	return l
+}
+
+func (l *Layer) Listen(host string, port uint16) (net.Listener, error) {
+	inner, err := l.Layer.Listen(host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	lis := &listener{
+		Listener: inner,
+		layer:    l,
+		conns:    make(chan net.Conn),
+		group:    supervisor.New(nil),
+		done:     make(chan struct{}),
+	}
+
+	lis.group.Go(func(context.Context) error {
+		lis.run()
+		return nil
+	})
+
+	return lis, nil
+}
+
+// Dial dials a node, and echoes back the cookie it issues us.
+func (l *Layer) Dial(address string) (net.Conn, error) {
+	conn, err := l.Layer.Dial(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.echo(conn); err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "cookie: failed to complete retry with %s", address)
+	}
+
+	return conn, nil
+}
+
+func (l *Layer) echo(conn net.Conn) error {
+	_ = conn.SetDeadline(time.Now().Add(l.timeoutDuration))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := conn.Write(hello); err != nil {
+		return errors.Wrap(err, "failed to send hello")
+	}
+
+	cookie := make([]byte, cookieSize)
+
+	if _, err := io.ReadFull(conn, cookie); err != nil {
+		return errors.Wrap(err, "failed to read retry cookie")
+	}
+
+	if _, err := conn.Write(cookie); err != nil {
+		return errors.Wrap(err, "failed to echo retry cookie")
+	}
+
+	return nil
+}
+
+// retry issues a cookie to an incoming connection, and verifies that it is echoed back.
+func (l *Layer) retry(conn net.Conn) error {
+	_ = conn.SetDeadline(time.Now().Add(l.timeoutDuration))
+	defer conn.SetDeadline(time.Time{})
+
+	buf := make([]byte, cookieSize)
+
+	if _, err := io.ReadFull(conn, buf[:len(hello)]); err != nil {
+		return errors.Wrap(err, "failed to read hello")
+	}
+
+	if !bytes.Equal(buf[:len(hello)], hello) {
+		return errors.New("initiator sent an unknown hello")
+	}
+
+	address := conn.RemoteAddr().String()
+
+	if _, err := conn.Write(generateCookie(l.secret, address, l.lifetime, l.clock.Now())); err != nil {
+		return errors.Wrap(err, "failed to send retry cookie")
+	}
+
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return errors.Wrap(err, "failed to read echoed cookie")
+	}
+
+	if !verifyCookie(l.secret, address, buf, l.lifetime, l.clock.Now()) {
+		return errors.New("initiator echoed back an invalid or expired cookie")
+	}
+
+	return nil
+}
+
+type listener struct {
+	net.Listener
+
+	layer *Layer
+
+	conns chan net.Conn
+
+	// pending are the connections part way through the exchange, from oldest to newest.
+	pendingMutex sync.Mutex
+	pending      []net.Conn
+
+	// group tracks the goroutines accepting connections and taking them through the exchange, which
+	// Close waits on.
+	group *supervisor.Group
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func (l *listener) run() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.shutdown(err)
+			return
+		}
+
+		l.admit(conn)
+
+		l.group.Go(func(context.Context) error {
+			l.handle(conn)
+			return nil
+		})
+	}
+}
+
+// admit tracks a connection part way through the exchange. Should the maximum number of connections
+// already be part way through it, the oldest of them is closed to make room.
+func (l *listener) admit(conn net.Conn) {
+	var oldest net.Conn
+
+	l.pendingMutex.Lock()
+
+	if len(l.pending) >= l.layer.maxPending {
+		oldest = l.pending[0]
+		l.pending = l.pending[1:]
+	}
+
+	l.pending = append(l.pending, conn)
+
+	l.pendingMutex.Unlock()
+
+	if oldest != nil {
+		log.Debug().Str("address", oldest.RemoteAddr().String()).Msg("Evicted the oldest connection part way through retry.")
+		oldest.Close()
+	}
+}
+
+// release stops tracking a connection, and reports whether it was still tracked rather than evicted.
+func (l *listener) release(conn net.Conn) bool {
+	l.pendingMutex.Lock()
+	defer l.pendingMutex.Unlock()
+
+	for i, pending := range l.pending {
+		if pending == conn {
+			l.pending = append(l.pending[:i], l.pending[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *listener) handle(conn net.Conn) {
+	err := l.layer.retry(conn)
+
+	if !l.release(conn) {
+		conn.Close()
+		return
+	}
+
+	if err != nil {
+		log.Debug().Err(err).Str("address", conn.RemoteAddr().String()).Msg("Dropped connection that failed to complete retry.")
+		conn.Close()
+		return
+	}
+
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+// Close stops accepting connections, closes the connections part way through the exchange, and
+// waits for every goroutine of the listener to exit.
+func (l *listener) Close() error {
+	err := l.Listener.Close()
+	l.shutdown(errors.New("cookie: listener closed"))
+
+	l.pendingMutex.Lock()
+	pending := l.pending
+	l.pending = nil
+	l.pendingMutex.Unlock()
+
+	for _, conn := range pending {
+		conn.Close()
+	}
+
+	l.group.Cancel()
+	_ = l.group.Wait()
+
+	return err
+}
+
+func (l *listener) shutdown(err error) {
+	l.once.Do(func() {
+		l.err = err
+		close(l.done)
+	})
+}
@@ -0,0 +1,161 @@
+package cookie
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCookie(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := Wrap(transport.NewTCP()).TimeoutAfter(100 * time.Millisecond)
+
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	var peers uint32
+
+	bob.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+		atomic.AddUint32(&peers, 1)
+		return nil
+	})
+
+	go alice.Listen()
+	go bob.Listen()
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	// Initiators that never echo back their cookie are never handed over to the node.
+	conn, err := transport.NewTCP().Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	_, err = conn.Write(hello)
+	assert.NoError(t, err)
+
+	cookie := make([]byte, cookieSize)
+	_, err = io.ReadFull(conn, cookie)
+	assert.NoError(t, err)
+
+	// The connection is closed once the initiator times out.
+	_, err = io.ReadFull(conn, make([]byte, 1))
+	assert.Error(t, err)
+	conn.Close()
+
+	// Nor are initiators which echo back a cookie that was not issued to them.
+	conn, err = transport.NewTCP().Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	_, err = conn.Write(hello)
+	assert.NoError(t, err)
+	_, err = io.ReadFull(conn, make([]byte, cookieSize))
+	assert.NoError(t, err)
+	_, err = conn.Write(cookie)
+	assert.NoError(t, err)
+
+	_, err = io.ReadFull(conn, make([]byte, 1))
+	assert.Error(t, err)
+	conn.Close()
+
+	assert.Equal(t, uint32(0), atomic.LoadUint32(&peers))
+
+	// Dialing through the layer echoes back our cookie.
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	defer peer.Disconnect()
+
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, uint32(1), atomic.LoadUint32(&peers))
+}
+
+func TestMaxPending(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := noise.DefaultParams()
+	params.Transport = Wrap(transport.NewTCP()).WithMaxPending(1)
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	// Initiators holding connections open idly are evicted to make room for others.
+	idle, err := transport.NewTCP().Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	defer idle.Close()
+
+	_, err = idle.Write(hello)
+	assert.NoError(t, err)
+	_, err = io.ReadFull(idle, make([]byte, cookieSize))
+	assert.NoError(t, err)
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	defer peer.Disconnect()
+
+	_ = idle.SetReadDeadline(time.Now().Add(3 * time.Second))
+
+	// The idle connection is closed by bob, rather than timing out.
+	_, err = io.ReadFull(idle, make([]byte, 1))
+	assert.Error(t, err)
+
+	if err, ok := err.(net.Error); ok {
+		assert.False(t, err.Timeout())
+	}
+
+	assert.Panics(t, func() { Wrap(transport.NewTCP()).WithMaxPending(0) })
+}
+
+func TestVerifyCookie(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	lifetime := 30 * time.Second
+
+	cookie := generateCookie(secret, "127.0.0.1:3000", lifetime, now)
+
+	assert.True(t, verifyCookie(secret, "127.0.0.1:3000", cookie, lifetime, now))
+
+	// Cookies are bound to the address they were issued to.
+	assert.False(t, verifyCookie(secret, "127.0.0.1:3001", cookie, lifetime, now))
+
+	// Cookies are bound to the secret they were issued with.
+	assert.False(t, verifyCookie([]byte("other"), "127.0.0.1:3000", cookie, lifetime, now))
+
+	// Cookies expire.
+	assert.False(t, verifyCookie(secret, "127.0.0.1:3000", cookie, lifetime, now.Add(time.Minute)))
+
+	// Tampered or truncated cookies are rejected.
+	tampered := append([]byte{}, cookie...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	assert.False(t, verifyCookie(secret, "127.0.0.1:3000", tampered, lifetime, now))
+	assert.False(t, verifyCookie(secret, "127.0.0.1:3000", cookie[:len(cookie)-1], lifetime, now))
+	assert.False(t, verifyCookie(secret, "127.0.0.1:3000", nil, lifetime, now))
+
+	// Keys are rotated every lifetime.
+	later := now.Add(lifetime)
+	assert.NotEqual(t, epochKey(secret, lifetime, cookie[:timestampSize]), epochKey(secret, lifetime, generateCookie(secret, "", lifetime, later)[:timestampSize]))
+}
@@ -1,42 +1,75 @@
 package ecdh
 
 import (
-	"crypto/sha512"
-	"github.com/perlin-network/noise/internal/edwards25519"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"strconv"
 )
 
-func computeSharedKey(nodePrivateKey edwards25519.PrivateKey, remotePublicKey edwards25519.PublicKey) []byte {
-	var nodeSecretKeyBuf, remotePublicKeyBuf, sharedKeyBuf [32]byte
-	copy(nodeSecretKeyBuf[:], deriveSecretKey(nodePrivateKey))
-	copy(remotePublicKeyBuf[:], remotePublicKey[:])
+const addressBindingInfo = "noise ecdh address binding"
 
-	var sharedKeyElement, publicKeyElement edwards25519.ExtendedGroupElement
-	publicKeyElement.FromBytes(&remotePublicKeyBuf)
+// computeHandshakeHash hashes the transcript of a handshake. Both handshake messages are hashed in
+// lexicographic order, such that both peers compute the same hash regardless of who dialed who.
+func computeHandshakeHash(handshakeMessage string, ours, theirs Handshake) []byte {
+	a, b := ours.Write(), theirs.Write()
 
-	edwards25519.GeScalarMult(&sharedKeyElement, &nodeSecretKeyBuf, &publicKeyElement)
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
 
-	sharedKeyElement.ToBytes(&sharedKeyBuf)
+	hash := sha256.New()
+	hash.Write([]byte(handshakeMessage))
+	hash.Write(a)
+	hash.Write(b)
 
-	return sharedKeyBuf[:]
+	return hash.Sum(nil)
 }
 
-func deriveSecretKey(privateKey edwards25519.PrivateKey) []byte {
-	digest := sha512.Sum512(privateKey[:32])
-	digest[0] &= 248
-	digest[31] &= 127
-	digest[31] |= 64
+// computeAddressBinding hashes the IPs and ports of both ends of a connection, salted with the hash
+// of the handshake transcript such that bindings are unique to every session. Both ends are hashed
+// in lexicographic order, such that both peers compute the same binding should they see the same
+// addresses.
+func computeAddressBinding(handshakeHash []byte, localIP net.IP, localPort uint16, remoteIP net.IP, remotePort uint16) []byte {
+	a, b := endpoint(localIP, localPort), endpoint(remoteIP, remotePort)
+
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(addressBindingInfo))
+	hash.Write(handshakeHash)
+	hash.Write(a)
+	hash.Write(b)
 
-	return digest[:32]
+	return hash.Sum(nil)
 }
 
-func isEd25519GroupElement(buf []byte) bool {
-	if len(buf) != edwards25519.PublicKeySize {
-		return false
-	}
+// endpointSize is the size of an endpoint encoded through endpoint.
+const endpointSize = net.IPv6len + 2
+
+// endpoint encodes an IP and port into 18 bytes, with IPv4 addresses mapped into IPv6.
+func endpoint(ip net.IP, port uint16) []byte {
+	buf := make([]byte, endpointSize)
+
+	copy(buf, ip.To16())
+	binary.BigEndian.PutUint16(buf[net.IPv6len:], port)
+
+	return buf
+}
+
+// formatEndpoint formats an endpoint encoded through endpoint as a host and port.
+func formatEndpoint(buf []byte) string {
+	return net.JoinHostPort(net.IP(buf[:net.IPv6len]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(buf[net.IPv6len:]))))
+}
 
-	var buff [32]byte
-	copy(buff[:], buf)
+// bindSharedKey mixes an address binding into a shared key.
+func bindSharedKey(sharedKey, binding []byte) []byte {
+	mac := hmac.New(sha256.New, binding)
+	mac.Write(sharedKey)
 
-	var A edwards25519.ExtendedGroupElement
-	return A.FromBytes(&buff)
+	return mac.Sum(nil)
 }
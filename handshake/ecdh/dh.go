@@ -0,0 +1,260 @@
+package ecdh
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"crypto/subtle"
+	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/perlin-network/noise/internal/x448"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/curve25519"
+	"io"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknownDH   = errors.New("unknown Diffie-Hellman function")
+	ErrInvalidKey  = errors.New("invalid Diffie-Hellman public key")
+	ErrLowOrderKey = errors.New("Diffie-Hellman public key is of low order")
+)
+
+// DH is a Diffie-Hellman function over which peers establish a shared key.
+type DH interface {
+	// Name names the function, such as "Curve25519".
+	Name() string
+
+	// GenerateKey generates an ephemeral keypair.
+	GenerateKey(rand io.Reader) (publicKey, privateKey []byte, err error)
+
+	// SharedKey computes the shared key of our private key and the public key of our peer, and
+	// returns an error should the public key of our peer be malformed.
+	SharedKey(privateKey, publicKey []byte) ([]byte, error)
+}
+
+// signer is implemented by Diffie-Hellman functions whose ephemeral keys double as signing keys, such
+// that handshake messages are signed with them.
+type signer interface {
+	Sign(privateKey, message []byte) ([]byte, error)
+	Verify(publicKey, message, signature []byte) bool
+}
+
+var (
+	// Ed25519 performs ECDH over the Twisted-Edwards form of Curve25519, and signs handshake messages
+	// with EdDSA. It is the default.
+	Ed25519 DH = ed25519DH{}
+
+	// Curve25519 performs X25519 as specified by RFC 7748.
+	Curve25519 DH = curve25519DH{}
+
+	// Curve448 performs X448 as specified by RFC 7748, for a security margin of 224 bits.
+	Curve448 DH = curve448DH{}
+
+	// P256 performs ECDH over the NIST P-256 curve.
+	P256 DH = p256DH{}
+)
+
+var (
+	dhs     = make(map[string]DH)
+	dhsLock sync.RWMutex
+)
+
+func init() {
+	for _, dh := range []DH{Ed25519, Curve25519, Curve448, P256} {
+		RegisterDH(dh)
+	}
+}
+
+// RegisterDH registers a Diffie-Hellman function under its name, replacing any function registered
+// under the same name.
+func RegisterDH(dh DH) {
+	dhsLock.Lock()
+	dhs[dh.Name()] = dh
+	dhsLock.Unlock()
+}
+
+// LookupDH returns the Diffie-Hellman function registered under a name.
+func LookupDH(name string) (DH, error) {
+	dhsLock.RLock()
+	dh, exists := dhs[name]
+	dhsLock.RUnlock()
+
+	if !exists {
+		return nil, errors.Wrapf(ErrUnknownDH, "no function is registered under the name %q", name)
+	}
+
+	return dh, nil
+}
+
+// DHs returns the names of all registered Diffie-Hellman functions in sorted order.
+func DHs() []string {
+	dhsLock.RLock()
+	defer dhsLock.RUnlock()
+
+	names := make([]string, 0, len(dhs))
+	for name := range dhs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+type ed25519DH struct{}
+
+func (ed25519DH) Name() string {
+	return "Ed25519"
+}
+
+func (ed25519DH) GenerateKey(rand io.Reader) ([]byte, []byte, error) {
+	publicKey, privateKey, err := edwards25519.GenerateKey(rand)
+	return publicKey, privateKey, err
+}
+
+func (ed25519DH) SharedKey(privateKey, publicKey []byte) ([]byte, error) {
+	if len(privateKey) != edwards25519.PrivateKeySize {
+		return nil, errors.New("invalid Ed25519 private key")
+	}
+
+	if len(publicKey) != edwards25519.PublicKeySize || !edwards25519.IsGroupElement(publicKey) {
+		return nil, errors.Wrap(ErrInvalidKey, "public key is not an Ed25519 group element")
+	}
+
+	return edwards25519.SharedKey(privateKey, publicKey), nil
+}
+
+func (ed25519DH) Sign(privateKey, message []byte) ([]byte, error) {
+	return edwards25519.PrivateKey(privateKey).Sign(nil, message, crypto.Hash(0))
+}
+
+func (ed25519DH) Verify(publicKey, message, signature []byte) bool {
+	return len(publicKey) == edwards25519.PublicKeySize && edwards25519.Verify(publicKey, message, signature)
+}
+
+type curve25519DH struct{}
+
+func (curve25519DH) Name() string {
+	return "Curve25519"
+}
+
+func (curve25519DH) GenerateKey(rand io.Reader) ([]byte, []byte, error) {
+	var privateKey, publicKey [32]byte
+
+	if _, err := io.ReadFull(rand, privateKey[:]); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate Curve25519 private key")
+	}
+
+	curve25519.ScalarBaseMult(&publicKey, &privateKey)
+
+	return publicKey[:], privateKey[:], nil
+}
+
+func (curve25519DH) SharedKey(privateKey, publicKey []byte) ([]byte, error) {
+	if len(privateKey) != 32 {
+		return nil, errors.New("invalid Curve25519 private key")
+	}
+
+	if len(publicKey) != 32 {
+		return nil, errors.Wrapf(ErrInvalidKey, "expected a 32-byte Curve25519 public key, but got %d bytes", len(publicKey))
+	}
+
+	var dst, scalar, point [32]byte
+
+	copy(scalar[:], privateKey)
+	copy(point[:], publicKey)
+
+	curve25519.ScalarMult(&dst, &scalar, &point)
+
+	if isZero(dst[:]) {
+		return nil, ErrLowOrderKey
+	}
+
+	return dst[:], nil
+}
+
+type curve448DH struct{}
+
+func (curve448DH) Name() string {
+	return "Curve448"
+}
+
+func (curve448DH) GenerateKey(rand io.Reader) ([]byte, []byte, error) {
+	var privateKey, publicKey [x448.Size]byte
+
+	if _, err := io.ReadFull(rand, privateKey[:]); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate Curve448 private key")
+	}
+
+	x448.ScalarBaseMult(&publicKey, &privateKey)
+
+	return publicKey[:], privateKey[:], nil
+}
+
+func (curve448DH) SharedKey(privateKey, publicKey []byte) ([]byte, error) {
+	if len(privateKey) != x448.Size {
+		return nil, errors.New("invalid Curve448 private key")
+	}
+
+	if len(publicKey) != x448.Size {
+		return nil, errors.Wrapf(ErrInvalidKey, "expected a %d-byte Curve448 public key, but got %d bytes", x448.Size, len(publicKey))
+	}
+
+	var dst, scalar, point [x448.Size]byte
+
+	copy(scalar[:], privateKey)
+	copy(point[:], publicKey)
+
+	x448.ScalarMult(&dst, &scalar, &point)
+
+	if isZero(dst[:]) {
+		return nil, ErrLowOrderKey
+	}
+
+	return dst[:], nil
+}
+
+type p256DH struct{}
+
+func (p256DH) Name() string {
+	return "P-256"
+}
+
+func (p256DH) GenerateKey(rand io.Reader) ([]byte, []byte, error) {
+	privateKey, x, y, err := elliptic.GenerateKey(elliptic.P256(), rand)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate P-256 private key")
+	}
+
+	return elliptic.Marshal(elliptic.P256(), x, y), privateKey, nil
+}
+
+// SharedKey takes public keys in their uncompressed form, and returns the x-coordinate of the shared
+// point as specified by SEC 1.
+func (p256DH) SharedKey(privateKey, publicKey []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	size := (curve.Params().BitSize + 7) / 8
+
+	if len(privateKey) != size {
+		return nil, errors.New("invalid P-256 private key")
+	}
+
+	x, y := elliptic.Unmarshal(curve, publicKey)
+	if x == nil {
+		return nil, errors.Wrap(ErrInvalidKey, "public key is not an uncompressed point on P-256")
+	}
+
+	x, _ = curve.ScalarMult(x, y, privateKey)
+
+	shared := make([]byte, size)
+	buf := x.Bytes()
+	copy(shared[size-len(buf):], buf)
+
+	return shared, nil
+}
+
+// isZero reports in constant time whether a buffer is all zeroes, which is the output of Montgomery
+// curves given a public key of low order.
+func isZero(buf []byte) bool {
+	return subtle.ConstantTimeCompare(buf, make([]byte, len(buf))) == 1
+}
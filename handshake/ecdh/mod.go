@@ -1,19 +1,24 @@
 package ecdh
 
 import (
-	"crypto"
+	"bytes"
+	"crypto/rand"
 	"github.com/perlin-network/noise"
-	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/perlin-network/noise/fips"
 	"github.com/perlin-network/noise/log"
 	"github.com/perlin-network/noise/protocol"
 	"github.com/pkg/errors"
 	"time"
 )
 
-const DefaultHandshakeMessage = ".noise_handshake"
+const (
+	DefaultHandshakeMessage = ".noise_handshake"
+)
 
 var (
 	_ protocol.Block = (*block)(nil)
+
+	ErrAddressMismatch = errors.New("ecdh: peer sees different addresses for our connection than we do")
 )
 
 type block struct {
@@ -21,16 +26,34 @@ type block struct {
 	timeoutDuration time.Duration
 
 	handshakeMessage string
+
+	dh DH
+
+	// unbound is set should the addresses of both ends of a connection not be bound into the shared
+	// key established.
+	unbound bool
+
+	// lazy is set should peers accepted by our node be responded to only once their handshake
+	// request arrives, and publicKeySize and signatureSize are the sizes their requests must have.
+	lazy                         bool
+	publicKeySize, signatureSize int
 }
 
 // New returns an ECDH policy with sensible defaults.
 //
 // By default, should a peer not complete the handshake protocol in 10 seconds, they will be disconnected.
 // All handshake-related messages are appended with ECDSA signatures that are automatically verified.
+// Keys are exchanged over Ed25519 by default, or over P-256 should FIPS mode be enabled.
 func New() *block {
+	dh := Ed25519
+	if fips.Enabled() {
+		dh = P256
+	}
+
 	return &block{
 		timeoutDuration:  10 * time.Second,
 		handshakeMessage: DefaultHandshakeMessage,
+		dh:               dh,
 	}
 }
 
@@ -44,62 +67,261 @@ func (b *block) WithHandshakeMessage(handshakeMessage string) *block {
 	return b
 }
 
+// WithDH sets the Diffie-Hellman function keys are exchanged over. Both peers must use the same
+// function, or else their handshake fails. Functions which do not sign handshake messages, such as
+// `Curve25519`, `Curve448` and `P256`, leave our peers to be authenticated by other blocks.
+func (b *block) WithDH(dh DH) *block {
+	b.dh = dh
+	return b
+}
+
+// WithoutAddressBinding stops the IPs and ports of both ends of a connection from being mixed into
+// the shared key established. Addresses are bound by default, such that handshakes spliced across
+// different connections fail, though peers whose addresses differ as seen from either end, such as
+// peers behind a NAT, a proxy or a WebSocket gateway, then fail to handshake with
+// ErrAddressMismatch. Both peers must opt out alike.
+func (b *block) WithoutAddressBinding() *block {
+	b.unbound = true
+	return b
+}
+
+// WithLazyResponder defers all work on peers accepted by our node until their handshake request
+// arrives, rather than generating, signing and sending our ephemeral key as soon as the peer is
+// accepted. Requests whose key and signature are not of the sizes our function produces are then
+// refused before any key is generated or any signature is verified, such that connections which
+// never send anything, or which send garbage, cost accept-heavy servers next to nothing.
+//
+// Peers dialed by our node send their request right away as usual, and so lazy responders remain
+// compatible with every other peer. Peers accepted on both ends, such as peers connected through
+// some relays, must not both be lazy responders, or else neither sends its request first.
+func (b *block) WithLazyResponder() *block {
+	b.lazy = true
+	return b
+}
+
+// Pattern names the key exchange performed by the block, as reported by `protocol.LoadSession()`.
+func (b *block) Pattern() string {
+	return "ECDH-" + b.dh.Name()
+}
+
 func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
 	b.opcodeHandshake = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Handshake)(nil))
+
+	if b.lazy {
+		b.measure()
+	}
+}
+
+// measure learns the sizes of the keys and signatures our function produces, which the requests of
+// peers are checked against by lazy responders. Sizes which cannot be learned are left unchecked.
+func (b *block) measure() {
+	publicKey, privateKey, err := b.dh.GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+
+	b.publicKeySize = len(publicKey)
+
+	if sig, signs := b.dh.(signer); signs {
+		signature, err := sig.Sign(privateKey, []byte(b.handshakeMessage))
+		if err != nil {
+			b.publicKeySize = 0
+			return
+		}
+
+		b.signatureSize = len(signature)
+	}
 }
 
 func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	if err := fips.CheckDH(b.dh.Name()); err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "refused to exchange keys")
+	}
+
+	if b.lazy && !peer.Dialed() {
+		return b.respondLazily(peer)
+	}
+
 	// Send a handshake request with a generated ephemeral keypair.
-	ephemeralPublicKey, ephemeralPrivateKey, err := edwards25519.GenerateKey(nil)
+	req, ephemeralPrivateKey, err := b.request(peer)
 	if err != nil {
-		return errors.Wrap(errors.Wrap(protocol.DisconnectPeer, err.Error()), "failed to generate ephemeral keypair")
+		return err
 	}
 
-	req := Handshake{publicKey: ephemeralPublicKey}
-	req.signature, err = ephemeralPrivateKey.Sign(nil, []byte(b.handshakeMessage), crypto.Hash(0))
+	err = peer.SendMessage(req)
+	if err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "failed to send our ephemeral public key to our peer")
+	}
+
+	// Wait for handshake response.
+	res, err := b.receive(peer)
+	if err != nil {
+		return err
+	}
+
+	if err := b.verify(res); err != nil {
+		return err
+	}
+
+	return b.establish(peer, ephemeralPrivateKey, req, res)
+}
+
+// respondLazily waits for the handshake request of a peer accepted by our node before doing any
+// work, and only generates and sends our ephemeral keypair once the request is well-formed and
+// verified.
+func (b *block) respondLazily(peer *noise.Peer) error {
+	res, err := b.receive(peer)
+	if err != nil {
+		return err
+	}
+
+	_, signs := b.dh.(signer)
+
+	if b.publicKeySize > 0 && len(res.publicKey) != b.publicKeySize {
+		return errors.Wrapf(protocol.DisconnectWith(noise.ErrHandshakeFailed), "our peer sent a %d-byte ephemeral public key, while %s keys are %d bytes", len(res.publicKey), b.dh.Name(), b.publicKeySize)
+	}
+
+	if (signs && b.signatureSize > 0 && len(res.signature) != b.signatureSize) || (!signs && len(res.signature) > 0) {
+		return errors.Wrapf(protocol.DisconnectWith(noise.ErrHandshakeFailed), "our peer sent a %d-byte signature, which %s does not produce", len(res.signature), b.dh.Name())
+	}
+
+	if err := b.verify(res); err != nil {
+		return err
+	}
+
+	req, ephemeralPrivateKey, err := b.request(peer)
 	if err != nil {
-		return errors.Wrap(errors.Wrap(protocol.DisconnectPeer, err.Error()), "failed to sign handshake message using ECDSA")
+		return err
 	}
 
 	err = peer.SendMessage(req)
 	if err != nil {
-		return errors.Wrap(errors.Wrap(protocol.DisconnectPeer, err.Error()), "failed to send our ephemeral public key to our peer")
+		return errors.Wrap(protocol.DisconnectWith(err), "failed to send our ephemeral public key to our peer")
 	}
 
-	// Wait for handshake response.
-	var res Handshake
-	var ok bool
+	return b.establish(peer, ephemeralPrivateKey, req, res)
+}
+
+// request generates an ephemeral keypair, and a handshake request carrying its public key which is
+// signed should our function sign handshake messages. The request carries the addresses of both ends
+// of our connection should we bind addresses.
+func (b *block) request(peer *noise.Peer) (Handshake, []byte, error) {
+	ephemeralPublicKey, ephemeralPrivateKey, err := b.dh.GenerateKey(rand.Reader)
+	if err != nil {
+		return Handshake{}, nil, errors.Wrap(protocol.DisconnectWith(err), "failed to generate ephemeral keypair")
+	}
 
+	req := Handshake{publicKey: ephemeralPublicKey}
+
+	if !b.unbound {
+		req.endpoints = append(endpoint(peer.LocalIP(), peer.LocalPort()), endpoint(peer.RemoteIP(), peer.RemotePort())...)
+	}
+
+	if sig, signs := b.dh.(signer); signs {
+		req.signature, err = sig.Sign(ephemeralPrivateKey, []byte(b.handshakeMessage))
+		if err != nil {
+			return Handshake{}, nil, errors.Wrap(protocol.DisconnectWith(err), "failed to sign handshake message")
+		}
+	}
+
+	return req, ephemeralPrivateKey, nil
+}
+
+// receive waits for the handshake request of our peer.
+func (b *block) receive(peer *noise.Peer) (Handshake, error) {
 	select {
-	case <-time.After(b.timeoutDuration):
-		return errors.Wrap(protocol.DisconnectPeer, "timed out receiving handshake request")
+	case <-peer.Node().Clock().After(b.timeoutDuration):
+		return Handshake{}, errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeTimeout), "timed out receiving handshake request")
 	case msg := <-peer.Receive(b.opcodeHandshake):
-		res, ok = msg.(Handshake)
+		res, ok := msg.(Handshake)
 		if !ok {
-			return errors.Wrap(protocol.DisconnectPeer, "did not get a handshake response back")
+			return Handshake{}, errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeFailed), "did not get a handshake response back")
 		}
+
+		return res, nil
 	}
+}
 
-	peersPublicKey := edwards25519.PublicKey(res.publicKey)
+// verify checks the signature of the handshake request of our peer.
+func (b *block) verify(res Handshake) error {
+	sig, signs := b.dh.(signer)
 
-	if !isEd25519GroupElement(peersPublicKey) {
-		return errors.Wrap(protocol.DisconnectPeer, "failed to unmarshal our peers ephemeral public key")
+	// Peers which sign their handshake messages while we do not, or vice versa, exchange keys over a
+	// different function than we do.
+	if signs && !sig.Verify(res.publicKey, []byte(b.handshakeMessage), res.signature) {
+		return errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeFailed), "failed to verify signature in handshake request")
 	}
 
-	if !edwards25519.Verify(peersPublicKey, []byte(b.handshakeMessage), res.signature) {
-		return errors.Wrap(protocol.DisconnectPeer, "failed to verify signature in handshake request")
+	if !signs && len(res.signature) > 0 {
+		return errors.Wrapf(protocol.DisconnectWith(noise.ErrHandshakeFailed), "our peer signed its handshake request, and so does not exchange keys over %s", b.dh.Name())
 	}
 
-	ephemeralSharedKey := computeSharedKey(ephemeralPrivateKey, peersPublicKey)
-	protocol.SetSharedKey(peer, ephemeralSharedKey[:])
+	return nil
+}
+
+// establish computes the key shared with our peer, given our ephemeral private key, and our and our
+// peers handshake requests.
+func (b *block) establish(peer *noise.Peer, ephemeralPrivateKey []byte, req, res Handshake) error {
+	ephemeralSharedKey, err := b.dh.SharedKey(ephemeralPrivateKey, res.publicKey)
+	if err != nil {
+		return errors.Wrapf(protocol.DisconnectWith(noise.ErrHandshakeFailed), "failed to compute a shared key over %s with our peers ephemeral public key: %v", b.dh.Name(), err)
+	}
+
+	if err := b.checkEndpoints(req, res); err != nil {
+		return err
+	}
+
+	handshakeHash := computeHandshakeHash(b.handshakeMessage, req, res)
+
+	// Peers whose handshake was spliced across different connections see different addresses, and
+	// so end up with different shared keys, even should the endpoints they sent be tampered with.
+	if !b.unbound {
+		binding := computeAddressBinding(handshakeHash, peer.LocalIP(), peer.LocalPort(), peer.RemoteIP(), peer.RemotePort())
+		ephemeralSharedKey = bindSharedKey(ephemeralSharedKey, binding)
+	}
+
+	protocol.SetSharedKey(peer, ephemeralSharedKey)
+	protocol.SetHandshakeHash(peer, handshakeHash)
+	protocol.SetSessionPattern(peer, b.Pattern())
 
 	log.Debug().
-		Hex("ephemeral_shared_key", ephemeralSharedKey[:]).
+		Str("dh", b.dh.Name()).
+		Hex("ephemeral_shared_key", ephemeralSharedKey).
 		Msg("Successfully performed ECDH with our peer.")
 
 	return nil
 }
 
+// checkEndpoints checks that our peer binds addresses should we, and that it sees the same addresses
+// for our connection as we do.
+func (b *block) checkEndpoints(req, res Handshake) error {
+	if b.unbound {
+		if len(res.endpoints) > 0 {
+			return errors.Wrap(protocol.DisconnectWith(ErrAddressMismatch), "our peer binds addresses, while we do not")
+		}
+
+		return nil
+	}
+
+	if len(res.endpoints) == 0 {
+		return errors.Wrap(protocol.DisconnectWith(ErrAddressMismatch), "our peer does not bind addresses, while we do")
+	}
+
+	if len(res.endpoints) != 2*endpointSize {
+		return errors.Wrapf(protocol.DisconnectWith(noise.ErrHandshakeFailed), "our peer sent %d bytes of endpoints, while it should send %d", len(res.endpoints), 2*endpointSize)
+	}
+
+	// Our peer sees itself where we see the remote end of our connection, and vice versa.
+	ourLocal, ourRemote := req.endpoints[:endpointSize], req.endpoints[endpointSize:]
+	theirLocal, theirRemote := res.endpoints[:endpointSize], res.endpoints[endpointSize:]
+
+	if !bytes.Equal(theirLocal, ourRemote) || !bytes.Equal(theirRemote, ourLocal) {
+		return errors.Wrapf(protocol.DisconnectWith(ErrAddressMismatch), "our peer sees itself at %s and us at %s, while we see it at %s and ourselves at %s", formatEndpoint(theirLocal), formatEndpoint(theirRemote), formatEndpoint(ourRemote), formatEndpoint(ourLocal))
+	}
+
+	return nil
+}
+
 func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
 	return nil
 }
@@ -1,11 +1,15 @@
 package ecdh
 
 import (
+	"crypto/rand"
 	"github.com/perlin-network/noise"
 	"github.com/perlin-network/noise/log"
 	"github.com/perlin-network/noise/protocol"
 	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -58,11 +62,360 @@ func TestECDH(t *testing.T) {
 	p.Register(blockBob)
 	p.Enforce(bob)
 
-	_, err = alice.Dial(bob.ExternalAddress())
+	peer, err := alice.Dial(bob.ExternalAddress())
 	assert.NoError(t, err)
 
 	time.Sleep(100 * time.Millisecond)
 
 	assert.True(t, atomic.LoadUint32(&blockAlice.reachable) == 1)
 	assert.True(t, atomic.LoadUint32(&blockBob.reachable) == 1)
+
+	session := protocol.LoadSession(peer)
+	assert.Equal(t, "ECDH-Ed25519", session.Pattern)
+	assert.Len(t, session.HandshakeHash, 32)
+}
+
+type exportBlock struct {
+	material chan []byte
+}
+
+func (b *exportBlock) OnRegister(p *protocol.Protocol, node *noise.Node) {
+}
+
+func (b *exportBlock) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	material, err := protocol.ExportKeyingMaterial(peer, "test", 32)
+	if err != nil {
+		return err
+	}
+
+	b.material <- material
+	return nil
+}
+
+func (b *exportBlock) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+func TestExportKeyingMaterial(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	blockAlice, blockBob := &exportBlock{material: make(chan []byte, 2)}, &exportBlock{material: make(chan []byte, 2)}
+
+	protocol.New().Register(New()).Register(blockAlice).Enforce(alice)
+	protocol.New().Register(New()).Register(blockBob).Enforce(bob)
+
+	var materials [][]byte
+
+	// Both sides of a session export the same keying material, and every session exports keying
+	// material of its own.
+	for i := 0; i < 2; i++ {
+		_, err = alice.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+
+		select {
+		case a := <-blockAlice.material:
+			assert.Equal(t, a, <-blockBob.material)
+			materials = append(materials, a)
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for keying material to be exported")
+		}
+	}
+
+	assert.NotEqual(t, materials[0], materials[1])
+}
+
+// exchange has two nodes handshake with one another over a Diffie-Hellman function each, and returns
+// the keying material which both nodes export, should their handshakes succeed.
+func exchange(t *testing.T, a, b DH) ([]byte, []byte) {
+	return exchangeWith(t, transport.NewBuffered(), New().WithDH(a).TimeoutAfter(time.Second), New().WithDH(b).TimeoutAfter(time.Second))
+}
+
+func exchangeWith(t *testing.T, layer transport.Layer, a, b *block) ([]byte, []byte) {
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	blockAlice, blockBob := &exportBlock{material: make(chan []byte, 1)}, &exportBlock{material: make(chan []byte, 1)}
+
+	protocol.New().Register(a).Register(blockAlice).Enforce(alice)
+	protocol.New().Register(b).Register(blockBob).Enforce(bob)
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	var materials [2][]byte
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+
+	for i, block := range []*exportBlock{blockAlice, blockBob} {
+		select {
+		case materials[i] = <-block.material:
+		case <-time.After(time.Until(deadline)):
+		}
+	}
+
+	if materials[0] != nil {
+		assert.Equal(t, a.Pattern(), protocol.LoadSession(peer).Pattern)
+	}
+
+	return materials[0], materials[1]
+}
+
+func TestDH(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	for _, dh := range []DH{Ed25519, Curve25519, Curve448, P256} {
+		a, b := exchange(t, dh, dh)
+
+		assert.NotNil(t, a, dh.Name())
+		assert.Equal(t, a, b, dh.Name())
+
+		registered, err := LookupDH(dh.Name())
+		assert.NoError(t, err)
+		assert.Equal(t, dh, registered)
+	}
+
+	_, err := LookupDH("Curve41417")
+	assert.Equal(t, ErrUnknownDH, errors.Cause(err))
+
+	assert.Equal(t, []string{"Curve25519", "Curve448", "Ed25519", "P-256"}, DHs())
+}
+
+func TestDHMismatch(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	dhs := []DH{Ed25519, Curve25519, Curve448, P256}
+
+	// Both peers fail their handshakes, such that pairs need only be checked one way around.
+	for i := range dhs {
+		for j := i + 1; j < len(dhs); j++ {
+			a, b := exchange(t, dhs[i], dhs[j])
+
+			assert.Nil(t, a, "%s with %s", dhs[i].Name(), dhs[j].Name())
+			assert.Nil(t, b, "%s with %s", dhs[i].Name(), dhs[j].Name())
+		}
+	}
+}
+
+func TestSharedKey(t *testing.T) {
+	for _, dh := range []DH{Ed25519, Curve25519, Curve448, P256} {
+		alicePublicKey, alicePrivateKey, err := dh.GenerateKey(rand.Reader)
+		assert.NoError(t, err)
+
+		bobPublicKey, bobPrivateKey, err := dh.GenerateKey(rand.Reader)
+		assert.NoError(t, err)
+
+		a, err := dh.SharedKey(alicePrivateKey, bobPublicKey)
+		assert.NoError(t, err)
+
+		b, err := dh.SharedKey(bobPrivateKey, alicePublicKey)
+		assert.NoError(t, err)
+
+		assert.Equal(t, a, b, dh.Name())
+
+		// Public keys which are truncated, or which are not points on the curve, are rejected.
+		_, err = dh.SharedKey(alicePrivateKey, bobPublicKey[1:])
+		assert.Equal(t, ErrInvalidKey, errors.Cause(err), dh.Name())
+	}
+
+	_, err := P256.SharedKey(make([]byte, 32), append([]byte{4}, make([]byte, 64)...))
+	assert.Equal(t, ErrInvalidKey, errors.Cause(err))
+
+	// Public keys of low order yield a shared key of all zeroes, and are rejected.
+	_, lowOrder, err := Curve25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	_, err = Curve25519.SharedKey(lowOrder, make([]byte, 32))
+	assert.Equal(t, ErrLowOrderKey, err)
+
+	_, lowOrder, err = Curve448.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	_, err = Curve448.SharedKey(lowOrder, make([]byte, 56))
+	assert.Equal(t, ErrLowOrderKey, err)
+}
+
+// natLayer dials out from behind a NAT, such that peers that are dialed see a different address for
+// us than we do.
+type natLayer struct {
+	*transport.Buffered
+}
+
+type natConn struct {
+	net.Conn
+}
+
+func (l natLayer) Dial(address string) (net.Conn, error) {
+	conn, err := l.Buffered.Dial(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return natConn{Conn: conn}, nil
+}
+
+func (natConn) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(192, 168, 0, 2), Port: 40000}
+}
+
+// failure has two nodes handshake with one another, and returns the error the protocol of the
+// dialer fails with, should it fail.
+func failure(t *testing.T, layer transport.Layer, a, b *block) error {
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	failed := make(chan error, 1)
+
+	protocol.New().Register(a).OnFailed(func(peer *noise.Peer, err error) {
+		failed <- err
+	}).Enforce(alice)
+	protocol.New().Register(b).Enforce(bob)
+
+	_, err = alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	select {
+	case err := <-failed:
+		return err
+	case <-time.After(500 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestAddressBinding(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := natLayer{Buffered: transport.NewBuffered()}
+
+	// Peers which bind addresses, as they do by default, and see the same addresses for one another,
+	// derive the same keys.
+	a, b := exchangeWith(t, transport.NewBuffered(), New(), New())
+	assert.NotNil(t, a)
+	assert.Equal(t, a, b)
+
+	// Peers which bind addresses, yet see different addresses for one another, fail to handshake.
+	err := failure(t, layer, New(), New())
+	assert.True(t, errors.Is(err, ErrAddressMismatch), err)
+	assert.Contains(t, err.Error(), "192.168.0.2:40000")
+
+	// Peers behind a NAT which opt out of binding addresses derive the same keys.
+	a, b = exchangeWith(t, layer, New().WithoutAddressBinding(), New().WithoutAddressBinding())
+	assert.NotNil(t, a)
+	assert.Equal(t, a, b)
+
+	// Peers which do not opt out alike fail to handshake.
+	err = failure(t, transport.NewBuffered(), New(), New().WithoutAddressBinding())
+	assert.True(t, errors.Is(err, ErrAddressMismatch), err)
+
+	err = failure(t, transport.NewBuffered(), New().WithoutAddressBinding(), New())
+	assert.True(t, errors.Is(err, ErrAddressMismatch), err)
+
+	// Addresses are bound to the session alongside the transcript.
+	handshakeHash := make([]byte, 32)
+	assert.Equal(t, computeAddressBinding(handshakeHash, net.IPv4(10, 0, 0, 1), 3000, net.IPv4(10, 0, 0, 2), 4000), computeAddressBinding(handshakeHash, net.IPv4(10, 0, 0, 2), 4000, net.IPv4(10, 0, 0, 1), 3000))
+	assert.NotEqual(t, computeAddressBinding(handshakeHash, net.IPv4(10, 0, 0, 1), 3000, net.IPv4(10, 0, 0, 2), 4000), computeAddressBinding(handshakeHash, net.IPv4(10, 0, 0, 1), 3000, net.IPv4(10, 0, 0, 3), 4000))
+	assert.NotEqual(t, computeAddressBinding(handshakeHash, net.IPv4(10, 0, 0, 1), 3000, net.IPv4(10, 0, 0, 2), 4000), computeAddressBinding(make([]byte, 31), net.IPv4(10, 0, 0, 1), 3000, net.IPv4(10, 0, 0, 2), 4000))
+}
+
+// countingDH counts the ephemeral keys it generates.
+type countingDH struct {
+	ed25519DH
+	generated *int32
+}
+
+func (dh countingDH) GenerateKey(rand io.Reader) ([]byte, []byte, error) {
+	atomic.AddInt32(dh.generated, 1)
+	return dh.ed25519DH.GenerateKey(rand)
+}
+
+func TestLazyResponder(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	// Lazy responders handshake with peers which are and are not lazy responders themselves.
+	a, b := exchangeWith(t, transport.NewBuffered(), New().TimeoutAfter(time.Second), New().WithLazyResponder().TimeoutAfter(time.Second))
+	assert.NotNil(t, a)
+	assert.Equal(t, a, b)
+
+	a, b = exchangeWith(t, transport.NewBuffered(), New().WithLazyResponder().TimeoutAfter(time.Second), New().WithLazyResponder().TimeoutAfter(time.Second))
+	assert.NotNil(t, a)
+	assert.Equal(t, a, b)
+
+	for _, dh := range []DH{Curve25519, Curve448, P256} {
+		a, b := exchangeWith(t, transport.NewBuffered(), New().WithDH(dh).TimeoutAfter(time.Second), New().WithDH(dh).WithLazyResponder().TimeoutAfter(time.Second))
+		assert.NotNil(t, a, dh.Name())
+		assert.Equal(t, a, b, dh.Name())
+
+		a, b = exchangeWith(t, transport.NewBuffered(), New().WithDH(Ed25519).TimeoutAfter(time.Second), New().WithDH(dh).WithLazyResponder().TimeoutAfter(time.Second))
+		assert.Nil(t, a, dh.Name())
+		assert.Nil(t, b, dh.Name())
+	}
+
+	// Lazy responders do no work for peers which never send their handshake request.
+	var generated int32
+
+	layer := transport.NewBuffered()
+
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go bob.Listen()
+
+	protocol.New().Register(New().WithDH(countingDH{generated: &generated}).WithLazyResponder().TimeoutAfter(time.Second)).Enforce(bob)
+
+	before := atomic.LoadInt32(&generated)
+
+	conn, err := layer.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, before, atomic.LoadInt32(&generated))
 }
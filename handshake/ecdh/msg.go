@@ -11,6 +11,10 @@ var _ noise.Message = (*Handshake)(nil)
 type Handshake struct {
 	publicKey []byte
 	signature []byte
+
+	// endpoints holds the addresses of both ends of the connection as seen by the sender, should the
+	// sender bind addresses. It is omitted entirely otherwise.
+	endpoints []byte
 }
 
 func (Handshake) Read(reader payload.Reader) (noise.Message, error) {
@@ -24,9 +28,23 @@ func (Handshake) Read(reader payload.Reader) (noise.Message, error) {
 		return nil, errors.Wrap(err, "failed to read signature")
 	}
 
-	return Handshake{publicKey: publicKey, signature: signature}, nil
+	msg := Handshake{publicKey: publicKey, signature: signature}
+
+	if reader.Len() > 0 {
+		if msg.endpoints, err = reader.ReadBytes(); err != nil {
+			return nil, errors.Wrap(err, "failed to read endpoints")
+		}
+	}
+
+	return msg, nil
 }
 
 func (m Handshake) Write() []byte {
-	return payload.NewWriter(nil).WriteBytes(m.publicKey).WriteBytes(m.signature).Bytes()
+	writer := payload.NewWriter(nil).WriteBytes(m.publicKey).WriteBytes(m.signature)
+
+	if len(m.endpoints) > 0 {
+		writer.WriteBytes(m.endpoints)
+	}
+
+	return writer.Bytes()
 }
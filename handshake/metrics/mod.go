@@ -0,0 +1,250 @@
+// Package metrics counts how many handshakes succeed, and categorizes those which fail by their
+// cause, broken down by the subnet of the remote peer. It is meant for debugging why a fraction of
+// peers may not connect to our node, such as whether they predominantly time out, speak an
+// incompatible version, or are refused from a particular subnet.
+package metrics
+
+import (
+	"fmt"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/resource"
+	"github.com/perlin-network/noise/version"
+	"github.com/pkg/errors"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Cause is the category of why a handshake failed.
+type Cause string
+
+const (
+	// CauseTimeout is for peers which did not complete a step of the handshake in time.
+	CauseTimeout Cause = "timeout"
+
+	// CauseBadKey is for peers which presented keys, signatures or IDs which failed to be verified.
+	CauseBadKey Cause = "bad_key"
+
+	// CauseVersionMismatch is for peers which speak a version of the protocol incompatible with ours.
+	CauseVersionMismatch Cause = "version_mismatch"
+
+	// CauseDecrypt is for peers which sent messages that failed to be decrypted before completing
+	// the handshake.
+	CauseDecrypt Cause = "decrypt"
+
+	// CauseGated is for peers our node refused to handshake with, such as peers whose IPs are banned,
+	// peers which may not be afforded the file descriptors or memory to handshake with, or peers whose
+	// handshakes were shed to make room for newer handshakes.
+	CauseGated Cause = "gated"
+
+	// CauseOther is for handshakes which failed for any other reason.
+	CauseOther Cause = "other"
+)
+
+// Classify returns the cause of a handshake failing with an error.
+func Classify(err error) Cause {
+	switch {
+	case errors.Is(err, noise.ErrPeerBanned), errors.Is(err, noise.ErrOutOfFileDescriptors), errors.Is(err, resource.ErrLimitExceeded), errors.Is(err, protocol.ErrHandshakeShed):
+		return CauseGated
+	case errors.Is(err, version.ErrIncompatibleVersion):
+		return CauseVersionMismatch
+	case errors.Is(err, noise.ErrHandshakeTimeout):
+		return CauseTimeout
+	case errors.Is(err, noise.ErrDecryptFailed):
+		return CauseDecrypt
+	case errors.Is(err, noise.ErrHandshakeFailed):
+		return CauseBadKey
+	default:
+		return CauseOther
+	}
+}
+
+// Metrics counts the outcomes of handshakes per remote subnet.
+type Metrics struct {
+	sync.Mutex
+
+	v4Bits, v6Bits int
+	maxSubnets     int
+
+	// key is what the outcome of a handshake is stored under within a peer, such that it is only
+	// counted once.
+	key string
+
+	total   Counts
+	subnets map[string]*Counts
+}
+
+// Counts are the outcomes of handshakes.
+type Counts struct {
+	Succeeded uint64           `json:"succeeded"`
+	Failed    map[Cause]uint64 `json:"failed"`
+}
+
+// Snapshot is a copy of the counts of every subnet.
+type Snapshot struct {
+	Total   Counts            `json:"total"`
+	Subnets map[string]Counts `json:"subnets"`
+}
+
+// New returns metrics which break handshakes down per /24 for IPv4 peers and /64 for IPv6 peers,
+// for up to 4096 subnets.
+func New() *Metrics {
+	m := &Metrics{
+		v4Bits:     24,
+		v6Bits:     64,
+		maxSubnets: 4096,
+		total:      Counts{Failed: make(map[Cause]uint64)},
+		subnets:    make(map[string]*Counts),
+	}
+
+	m.key = fmt.Sprintf("handshake.metrics.%p", m)
+
+	return m
+}
+
+// WithPrefixes sets the prefix lengths IPv4 and IPv6 peers are grouped into subnets by.
+func (m *Metrics) WithPrefixes(v4Bits, v6Bits int) *Metrics {
+	if v4Bits < 0 || v4Bits > 32 || v6Bits < 0 || v6Bits > 128 {
+		panic("metrics: prefix lengths must be within [0, 32] for IPv4 and [0, 128] for IPv6")
+	}
+
+	m.v4Bits, m.v6Bits = v4Bits, v6Bits
+	return m
+}
+
+// WithMaxSubnets sets how many subnets are counted separately. Handshakes with peers from subnets
+// beyond the maximum are only counted towards the total, such that peers spread across many
+// subnets may not exhaust our nodes memory.
+func (m *Metrics) WithMaxSubnets(max int) *Metrics {
+	m.maxSubnets = max
+	return m
+}
+
+// Watch counts whether or not peers of a node complete a protocol, alongside the connections our
+// node refuses before handshaking, and messages which fail to be decrypted before a peer completes
+// the protocol.
+func (m *Metrics) Watch(node *noise.Node, p *protocol.Protocol) *Metrics {
+	p.OnEstablished(func(peer *noise.Peer) {
+		if m.once(peer) {
+			m.Record(peer.RemoteIP(), nil)
+		}
+	})
+
+	p.OnFailed(func(peer *noise.Peer, err error) {
+		if m.once(peer) {
+			m.Record(peer.RemoteIP(), err)
+		}
+	})
+
+	node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+		peer.OnConnError(func(node *noise.Node, peer *noise.Peer, err error) error {
+			// Once a peer completes the protocol, messages failing to be decrypted are no longer a
+			// matter of its handshake.
+			if errors.Is(err, noise.ErrDecryptFailed) && m.once(peer) {
+				m.Record(peer.RemoteIP(), err)
+			}
+
+			return nil
+		})
+
+		return nil
+	})
+
+	node.OnListenerError(func(node *noise.Node, err error) error {
+		var refused noise.RefusedError
+
+		if errors.As(err, &refused) {
+			m.Record(refused.IP, err)
+		}
+
+		return nil
+	})
+
+	return m
+}
+
+// once reports whether the outcome of the handshake with a peer has yet to be counted, and marks it
+// as counted.
+func (m *Metrics) once(peer *noise.Peer) bool {
+	return atomic.CompareAndSwapUint32(peer.LoadOrStore(m.key, new(uint32)).(*uint32), 0, 1)
+}
+
+// Record counts the outcome of a handshake with a peer at an IP, where a nil error counts as a
+// success. It is for handshakes performed outside of a watched protocol.
+func (m *Metrics) Record(ip net.IP, err error) {
+	m.Lock()
+	defer m.Unlock()
+
+	counts := []*Counts{&m.total}
+
+	if subnet := m.subnet(ip); subnet != "" {
+		c, exists := m.subnets[subnet]
+
+		if !exists && len(m.subnets) < m.maxSubnets {
+			c = &Counts{Failed: make(map[Cause]uint64)}
+			m.subnets[subnet] = c
+		}
+
+		if c != nil {
+			counts = append(counts, c)
+		}
+	}
+
+	for _, c := range counts {
+		if err == nil {
+			c.Succeeded++
+		} else {
+			c.Failed[Classify(err)]++
+		}
+	}
+}
+
+// subnet returns the subnet an IP is grouped into in CIDR notation, or an empty string should the
+// IP be invalid.
+func (m *Metrics) subnet(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(m.v4Bits, 32)), Mask: net.CIDRMask(m.v4Bits, 32)}).String()
+	}
+
+	if len(ip) == net.IPv6len {
+		return (&net.IPNet{IP: ip.Mask(net.CIDRMask(m.v6Bits, 128)), Mask: net.CIDRMask(m.v6Bits, 128)}).String()
+	}
+
+	return ""
+}
+
+// Snapshot returns a copy of the counts of every subnet, keyed by the subnets in CIDR notation.
+func (m *Metrics) Snapshot() Snapshot {
+	m.Lock()
+	defer m.Unlock()
+
+	snapshot := Snapshot{Total: m.total.copy(), Subnets: make(map[string]Counts, len(m.subnets))}
+
+	for subnet, c := range m.subnets {
+		snapshot.Subnets[subnet] = c.copy()
+	}
+
+	return snapshot
+}
+
+func (c Counts) copy() Counts {
+	failed := make(map[Cause]uint64, len(c.Failed))
+
+	for cause, count := range c.Failed {
+		failed[cause] = count
+	}
+
+	return Counts{Succeeded: c.Succeeded, Failed: failed}
+}
+
+// Failures returns how many handshakes failed, for any cause.
+func (c Counts) Failures() uint64 {
+	var total uint64
+
+	for _, count := range c.Failed {
+		total += count
+	}
+
+	return total
+}
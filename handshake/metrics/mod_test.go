@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/resource"
+	"github.com/perlin-network/noise/transport"
+	"github.com/perlin-network/noise/version"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	cases := map[error]Cause{
+		noise.ErrPeerBanned:             CauseGated,
+		noise.ErrOutOfFileDescriptors:   CauseGated,
+		resource.ErrLimitExceeded:       CauseGated,
+		noise.ErrHandshakeTimeout:       CauseTimeout,
+		noise.ErrHandshakeFailed:        CauseBadKey,
+		noise.ErrDecryptFailed:          CauseDecrypt,
+		errors.New("peer disconnected"): CauseOther,
+
+		version.IncompatibleVersionError{Ours: version.MustParse("1.0.0"), Theirs: version.MustParse("2.0.0")}: CauseVersionMismatch,
+	}
+
+	for err, cause := range cases {
+		assert.Equal(t, cause, Classify(errors.Wrap(protocol.DisconnectWith(err), "wrapped")), err.Error())
+	}
+}
+
+func TestRecord(t *testing.T) {
+	m := New().WithMaxSubnets(3)
+
+	m.Record(net.ParseIP("203.0.113.7"), nil)
+	m.Record(net.ParseIP("203.0.113.200"), noise.ErrHandshakeTimeout)
+	m.Record(net.ParseIP("198.51.100.1"), noise.ErrHandshakeFailed)
+	m.Record(net.ParseIP("2001:db8::1"), noise.ErrPeerBanned)
+	m.Record(net.ParseIP("2001:db8::2"), noise.ErrPeerBanned)
+
+	// Subnets beyond the maximum are only counted towards the total.
+	m.Record(net.ParseIP("192.0.2.1"), noise.ErrHandshakeTimeout)
+
+	snapshot := m.Snapshot()
+
+	assert.EqualValues(t, 1, snapshot.Total.Succeeded)
+	assert.EqualValues(t, 5, snapshot.Total.Failures())
+	assert.EqualValues(t, 2, snapshot.Total.Failed[CauseTimeout])
+
+	assert.Len(t, snapshot.Subnets, 3)
+	assert.Equal(t, Counts{Succeeded: 1, Failed: map[Cause]uint64{CauseTimeout: 1}}, snapshot.Subnets["203.0.113.0/24"])
+	assert.Equal(t, Counts{Failed: map[Cause]uint64{CauseBadKey: 1}}, snapshot.Subnets["198.51.100.0/24"])
+	assert.Equal(t, Counts{Failed: map[Cause]uint64{CauseGated: 2}}, snapshot.Subnets["2001:db8::/64"])
+
+	// Snapshots are copies.
+	snapshot.Subnets["203.0.113.0/24"].Failed[CauseTimeout] = 100
+	assert.EqualValues(t, 1, m.Snapshot().Subnets["203.0.113.0/24"].Failed[CauseTimeout])
+
+	m = New().WithPrefixes(16, 32)
+	m.Record(net.ParseIP("203.0.113.7"), nil)
+	m.Record(net.ParseIP("2001:db8:1::1"), nil)
+
+	assert.Contains(t, m.Snapshot().Subnets, "203.0.0.0/16")
+	assert.Contains(t, m.Snapshot().Subnets, "2001:db8::/32")
+}
+
+type failBlock struct{ err error }
+
+func (failBlock) OnRegister(p *protocol.Protocol, node *noise.Node) {}
+
+func (b failBlock) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	return protocol.DisconnectWith(b.err)
+}
+
+func (failBlock) OnEnd(p *protocol.Protocol, peer *noise.Peer) error { return nil }
+
+func TestWatch(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	node := func(m *Metrics, blocks ...protocol.Block) *noise.Node {
+		params := noise.DefaultParams()
+		params.Transport = layer
+
+		node, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		go node.Listen()
+
+		proto := protocol.New()
+
+		for _, block := range blocks {
+			proto.Register(block)
+		}
+
+		m.Watch(node, proto)
+		proto.Enforce(node)
+
+		return node
+	}
+
+	m := New()
+
+	alice := node(m, version.New(version.MustParse("1.0.0")))
+	defer alice.Kill()
+
+	bob := node(New(), version.New(version.MustParse("1.2.0")))
+	defer bob.Kill()
+
+	carol := node(New(), version.New(version.MustParse("2.0.0")))
+	defer carol.Kill()
+
+	daveMetrics := New()
+
+	dave := node(daveMetrics, version.New(version.MustParse("1.0.0")), failBlock{err: noise.ErrHandshakeFailed})
+	defer dave.Kill()
+
+	for _, other := range []*noise.Node{bob, carol, dave} {
+		_, err := alice.Dial(other.ExternalAddress())
+		assert.NoError(t, err)
+	}
+
+	// Connections refused by alice count as gated.
+	alice.Ban(net.ParseIP("127.0.0.1"), time.Minute)
+
+	_, err := bob.Dial(alice.ExternalAddress())
+	assert.NoError(t, err)
+
+	expected := Counts{Succeeded: 2, Failed: map[Cause]uint64{CauseVersionMismatch: 1, CauseGated: 1}}
+
+	deadline := time.Now().Add(3 * time.Second)
+
+	for time.Now().Before(deadline) && (!assert.ObjectsAreEqual(expected, m.Snapshot().Total) || daveMetrics.Snapshot().Total.Failures() == 0) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Dave fails the handshake only after alice completes her side of the protocol, so alice counts
+	// a success, whereas dave counts a bad key.
+	assert.Equal(t, expected, m.Snapshot().Subnets["127.0.0.0/24"])
+	assert.Equal(t, expected, m.Snapshot().Total)
+
+	assert.Equal(t, Counts{Failed: map[Cause]uint64{CauseBadKey: 1}}, daveMetrics.Snapshot().Total)
+}
@@ -0,0 +1,402 @@
+// Package health runs a background prober which periodically pings a random sample of the peers
+// our node is connected to, and aggregates whether they replied, and how long they took to, into
+// metrics describing the overall health of the network as observed from our node.
+package health
+
+import (
+	"bytes"
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const keyState = "health.state"
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrTimeout = errors.New("health: peer did not reply to ping in time")
+)
+
+type block struct {
+	opcodePing noise.Opcode
+	opcodePong noise.Opcode
+
+	interval        time.Duration
+	sampleSize      int
+	timeoutDuration time.Duration
+	window          int
+
+	onSweep []func(node *noise.Node, metrics Metrics)
+}
+
+// New returns a block which has our node ping a random sample of the peers which completed the
+// block every interval. Peers which do not reply with a pong in time are deemed unreachable, and
+// the outcomes of the latest probes are aggregated into metrics retrievable through `Health()`.
+//
+// Pings count as activity towards the idle timeout of a peer, as any other message does.
+//
+// By default, 8 peers are pinged every 30 seconds, peers which do not reply within 5 seconds are
+// deemed unreachable, and metrics are aggregated over the latest 256 probes.
+func New() *block {
+	return &block{
+		interval:        30 * time.Second,
+		sampleSize:      8,
+		timeoutDuration: 5 * time.Second,
+		window:          256,
+	}
+}
+
+// TimeoutAfter sets how long a peer is waited on to reply to a ping before it is deemed
+// unreachable.
+func (b *block) TimeoutAfter(timeoutDuration time.Duration) *block {
+	b.timeoutDuration = timeoutDuration
+	return b
+}
+
+// WithInterval sets how often peers are sampled and pinged. Should the interval not be positive,
+// peers are only pinged through `Sweep()` and `Probe()`.
+func (b *block) WithInterval(interval time.Duration) *block {
+	b.interval = interval
+	return b
+}
+
+// WithSampleSize sets how many random peers are pinged every interval.
+func (b *block) WithSampleSize(size int) *block {
+	if size <= 0 {
+		panic("health: sample size must be positive")
+	}
+
+	b.sampleSize = size
+	return b
+}
+
+// WithWindow sets how many of the latest probes metrics are aggregated over.
+func (b *block) WithWindow(window int) *block {
+	if window <= 0 {
+		panic("health: window must be positive")
+	}
+
+	b.window = window
+	return b
+}
+
+// OnSweep registers a callback which is called with the latest metrics every time a sample of
+// peers is done being pinged, such that metrics may be exported to a monitoring system.
+func (b *block) OnSweep(fn func(node *noise.Node, metrics Metrics)) *block {
+	b.onSweep = append(b.onSweep, fn)
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodePing = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Ping)(nil))
+	b.opcodePong = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Pong)(nil))
+
+	s := &state{
+		block:   b,
+		node:    node,
+		peers:   make(map[*noise.Peer]struct{}),
+		pending: make(map[uint64]pending),
+		samples: make([]sample, 0, b.window),
+	}
+
+	node.Set(keyState, s)
+
+	node.OnMessageReceived(b.opcodePing, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		peer.SendMessageAsync(Pong{Nonce: message.(Ping).Nonce})
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodePong, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		s.replied(peer, message.(Pong).Nonce)
+		return nil
+	})
+
+	if b.interval > 0 {
+		node.Go(func(ctx context.Context) error {
+			s.run(ctx)
+			return nil
+		})
+	}
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	s := peer.Node().Get(keyState).(*state)
+	s.add(peer)
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		s.remove(peer)
+		return nil
+	})
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Metrics describe the health of the network as observed from our node, aggregated over the latest
+// probes.
+type Metrics struct {
+	// Peers is how many peers our node may sample at the moment.
+	Peers int
+
+	// Probes is how many probes metrics are aggregated over, of which Reachable were replied to.
+	Probes    int
+	Reachable int
+
+	// Reachability is the fraction of probes which were replied to, or zero should no peer have been
+	// probed as of yet.
+	Reachability float64
+
+	// MedianRTT and P90RTT are the median and 90th percentile round-trip times of the probes which
+	// were replied to, or zero should none have been.
+	MedianRTT time.Duration
+	P90RTT    time.Duration
+}
+
+// Health returns the latest metrics of our node. It returns empty metrics should the block not be
+// registered to the protocol of our node.
+func Health(node *noise.Node) Metrics {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return Metrics{}
+	}
+
+	return s.metrics()
+}
+
+// Sweep pings a random sample of peers right away, blocking until every peer replies or times out,
+// and returns the metrics of our node afterwards.
+func Sweep(node *noise.Node) (Metrics, error) {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return Metrics{}, errors.New("health: block is not registered to the nodes protocol")
+	}
+
+	return s.sweep(context.Background()), nil
+}
+
+// Probe pings a single peer, and returns the round-trip time to it. It returns ErrTimeout should the
+// peer not reply in time. The outcome is taken into account by the metrics of our node.
+func Probe(node *noise.Node, peer *noise.Peer) (time.Duration, error) {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return 0, errors.New("health: block is not registered to the nodes protocol")
+	}
+
+	return s.probe(context.Background(), peer)
+}
+
+type state struct {
+	sync.Mutex
+
+	block *block
+	node  *noise.Node
+
+	peers   map[*noise.Peer]struct{}
+	pending map[uint64]pending
+
+	// samples is a ring of the outcomes of the latest probes, where next is the index of the oldest
+	// outcome once the ring is full.
+	samples []sample
+	next    int
+}
+
+type pending struct {
+	peer    *noise.Peer
+	replied chan struct{}
+}
+
+type sample struct {
+	reachable bool
+	rtt       time.Duration
+}
+
+func (s *state) add(peer *noise.Peer) {
+	s.Lock()
+	s.peers[peer] = struct{}{}
+	s.Unlock()
+}
+
+func (s *state) remove(peer *noise.Peer) {
+	s.Lock()
+	delete(s.peers, peer)
+	s.Unlock()
+}
+
+// run sweeps a sample of peers every interval until our node is killed.
+func (s *state) run(ctx context.Context) {
+	ticker := s.node.Clock().NewTicker(s.block.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		s.sweep(ctx)
+	}
+}
+
+func (s *state) sweep(ctx context.Context) Metrics {
+	var wg sync.WaitGroup
+
+	for _, peer := range s.sample() {
+		wg.Add(1)
+
+		go func(peer *noise.Peer) {
+			defer wg.Done()
+			_, _ = s.probe(ctx, peer)
+		}(peer)
+	}
+
+	wg.Wait()
+
+	metrics := s.metrics()
+
+	log.Debug().
+		Int("probes", metrics.Probes).
+		Float64("reachability", metrics.Reachability).
+		Dur("median_rtt", metrics.MedianRTT).
+		Msg("Probed the health of the network.")
+
+	for _, fn := range s.block.onSweep {
+		fn(s.node, metrics)
+	}
+
+	return metrics
+}
+
+// sample returns up to a sample size worth of random peers.
+func (s *state) sample() []*noise.Peer {
+	s.Lock()
+	defer s.Unlock()
+
+	peers := make([]*noise.Peer, 0, len(s.peers))
+	for peer := range s.peers {
+		peers = append(peers, peer)
+	}
+
+	// Peers are sorted before being shuffled, such that our node samples the same peers given the
+	// same source of randomness.
+	sort.Slice(peers, func(i, j int) bool {
+		if c := bytes.Compare(peers[i].RemoteIP(), peers[j].RemoteIP()); c != 0 {
+			return c < 0
+		}
+
+		return peers[i].RemotePort() < peers[j].RemotePort()
+	})
+
+	s.node.Random().Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+
+	if len(peers) > s.block.sampleSize {
+		peers = peers[:s.block.sampleSize]
+	}
+
+	return peers
+}
+
+func (s *state) probe(ctx context.Context, peer *noise.Peer) (time.Duration, error) {
+	clock := s.node.Clock()
+
+	nonce := s.node.Random().Uint64()
+	replied := make(chan struct{}, 1)
+
+	s.Lock()
+	s.pending[nonce] = pending{peer: peer, replied: replied}
+	s.Unlock()
+
+	defer func() {
+		s.Lock()
+		delete(s.pending, nonce)
+		s.Unlock()
+	}()
+
+	start := clock.Now()
+
+	if err := peer.SendMessage(Ping{Nonce: nonce}); err != nil {
+		s.record(sample{})
+		return 0, errors.Wrap(err, "health: failed to ping peer")
+	}
+
+	select {
+	case <-replied:
+		rtt := clock.Since(start)
+		s.record(sample{reachable: true, rtt: rtt})
+
+		return rtt, nil
+	case <-clock.After(s.block.timeoutDuration):
+		s.record(sample{})
+		return 0, errors.Wrapf(ErrTimeout, "no pong within %s", s.block.timeoutDuration)
+	case <-ctx.Done():
+		// Probes cut short by our node being killed say nothing about the network.
+		return 0, ctx.Err()
+	}
+}
+
+func (s *state) replied(peer *noise.Peer, nonce uint64) {
+	s.Lock()
+	defer s.Unlock()
+
+	// Pongs are only accepted from the peer which was pinged.
+	if p, ok := s.pending[nonce]; ok && p.peer == peer {
+		select {
+		case p.replied <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *state) record(sample sample) {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.samples) < s.block.window {
+		s.samples = append(s.samples, sample)
+		return
+	}
+
+	s.samples[s.next] = sample
+	s.next = (s.next + 1) % s.block.window
+}
+
+func (s *state) metrics() Metrics {
+	s.Lock()
+	defer s.Unlock()
+
+	m := Metrics{Peers: len(s.peers), Probes: len(s.samples)}
+
+	rtts := make([]time.Duration, 0, len(s.samples))
+
+	for _, sample := range s.samples {
+		if sample.reachable {
+			rtts = append(rtts, sample.rtt)
+		}
+	}
+
+	m.Reachable = len(rtts)
+
+	if m.Probes > 0 {
+		m.Reachability = float64(m.Reachable) / float64(m.Probes)
+	}
+
+	if len(rtts) > 0 {
+		sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+
+		m.MedianRTT = rtts[len(rtts)/2]
+		m.P90RTT = rtts[(len(rtts)*9)/10]
+	}
+
+	return m
+}
@@ -0,0 +1,166 @@
+package health
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newNode(t *testing.T, layer transport.Layer, blocks ...protocol.Block) *noise.Node {
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	// Pings sent to nodes which do not run the block are left unhandled until they time out.
+	params.ReceiveMessageTimeout = 100 * time.Millisecond
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	p := protocol.New()
+	for _, block := range blocks {
+		p.Register(block)
+	}
+	p.Enforce(node)
+
+	go node.Listen()
+
+	return node
+}
+
+func dial(t *testing.T, from, to *noise.Node) *noise.Peer {
+	peer, err := from.Dial(to.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	return peer
+}
+
+func TestProbe(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	alice := newNode(t, layer, New().WithInterval(0).TimeoutAfter(100*time.Millisecond))
+	defer alice.Kill()
+
+	bob := newNode(t, layer, New().WithInterval(0))
+	defer bob.Kill()
+
+	// Carol does not run the block, and so never replies to pings.
+	carol := newNode(t, layer)
+	defer carol.Kill()
+
+	rtt, err := Probe(alice, dial(t, alice, bob))
+	assert.NoError(t, err)
+	assert.True(t, rtt > 0)
+
+	_, err = Probe(alice, dial(t, alice, carol))
+	assert.True(t, errors.Is(err, ErrTimeout))
+
+	metrics := Health(alice)
+	assert.Equal(t, 2, metrics.Peers)
+	assert.Equal(t, 2, metrics.Probes)
+	assert.Equal(t, 1, metrics.Reachable)
+	assert.Equal(t, 0.5, metrics.Reachability)
+	assert.Equal(t, rtt, metrics.MedianRTT)
+	assert.Equal(t, rtt, metrics.P90RTT)
+}
+
+func TestSweep(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	swept := make(chan Metrics, 16)
+
+	alice := newNode(t, layer, New().
+		WithInterval(20*time.Millisecond).
+		WithSampleSize(2).
+		WithWindow(4).
+		OnSweep(func(node *noise.Node, metrics Metrics) {
+			select {
+			case swept <- metrics:
+			default:
+			}
+		}))
+	defer alice.Kill()
+
+	for i := 0; i < 3; i++ {
+		peer := newNode(t, layer, New().WithInterval(0))
+		defer peer.Kill()
+
+		dial(t, alice, peer)
+	}
+
+	deadline := time.After(3 * time.Second)
+
+	for {
+		var metrics Metrics
+
+		select {
+		case metrics = <-swept:
+		case <-deadline:
+			t.Fatal("timed out waiting for the window to fill up")
+		}
+
+		// Every sweep pings at most the sample size worth of peers, and metrics are aggregated over
+		// no more than the window.
+		assert.True(t, metrics.Probes <= 4)
+
+		if metrics.Probes < 4 {
+			continue
+		}
+
+		assert.Equal(t, 3, metrics.Peers)
+		assert.Equal(t, 4, metrics.Reachable)
+		assert.Equal(t, 1.0, metrics.Reachability)
+		assert.True(t, metrics.MedianRTT > 0 && metrics.MedianRTT <= metrics.P90RTT)
+
+		break
+	}
+}
+
+func TestPeersRemovedOnDisconnect(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	alice := newNode(t, layer, New().WithInterval(0))
+	defer alice.Kill()
+
+	bob := newNode(t, layer, New().WithInterval(0))
+	defer bob.Kill()
+
+	peer := dial(t, alice, bob)
+	assert.Equal(t, 1, Health(alice).Peers)
+
+	peer.Disconnect()
+
+	metrics, err := Sweep(alice)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, metrics.Peers)
+	assert.Equal(t, 0, metrics.Probes)
+	assert.Zero(t, metrics.Reachability)
+}
+
+func TestNotRegistered(t *testing.T) {
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer node.Kill()
+
+	assert.Equal(t, Metrics{}, Health(node))
+
+	_, err = Sweep(node)
+	assert.Error(t, err)
+}
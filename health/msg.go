@@ -0,0 +1,49 @@
+package health
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ noise.Message = (*Ping)(nil)
+	_ noise.Message = (*Pong)(nil)
+)
+
+// Ping asks a peer to reply with a Pong carrying the same nonce, such that whether the peer is
+// reachable, and the round-trip time to it, may be measured.
+type Ping struct {
+	Nonce uint64
+}
+
+func (Ping) Read(reader payload.Reader) (noise.Message, error) {
+	nonce, err := reader.ReadUint64()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read ping nonce")
+	}
+
+	return Ping{Nonce: nonce}, nil
+}
+
+func (m Ping) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).Bytes()
+}
+
+// Pong echoes the nonce of a ping back to the peer which sent it.
+type Pong struct {
+	Nonce uint64
+}
+
+func (Pong) Read(reader payload.Reader) (noise.Message, error) {
+	nonce, err := reader.ReadUint64()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read pong nonce")
+	}
+
+	return Pong{Nonce: nonce}, nil
+}
+
+func (m Pong) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).Bytes()
+}
@@ -0,0 +1,224 @@
+package identify
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const keyState = "identify.state"
+
+var (
+	_ protocol.Block = (*block)(nil)
+)
+
+type block struct {
+	opcodeIdentify noise.Opcode
+
+	timeoutDuration time.Duration
+
+	minObservations int
+	confidence      float64
+	observationTTL  time.Duration
+
+	advertise bool
+
+	onStatusChanged []func(node *noise.Node, status NATStatus, address string)
+}
+
+// New returns a block which has every pair of peers report the address they observe one another
+// at. Observations are aggregated with the latest observation of every distinct observer IP
+// counted once, such that no single host may sway our view of our own address.
+//
+// Once enough observers agree on our IP, our NAT status is determined, and should we be publicly
+// reachable or behind a port-preserving NAT, our node advertises the observed IP alongside our
+// external port as its external address.
+//
+// By default, peers that do not report our address within 10 seconds are disconnected, at least
+// 3 observers must have observed us within the last 30 minutes, and two thirds of them must agree
+// on our IP.
+func New() *block {
+	return &block{
+		timeoutDuration: 10 * time.Second,
+		minObservations: 3,
+		confidence:      2.0 / 3.0,
+		observationTTL:  30 * time.Minute,
+		advertise:       true,
+	}
+}
+
+func (b *block) TimeoutAfter(timeoutDuration time.Duration) *block {
+	b.timeoutDuration = timeoutDuration
+	return b
+}
+
+// WithMinObservations sets how many distinct observers must have observed our address before
+// our NAT status is determined.
+func (b *block) WithMinObservations(min int) *block {
+	b.minObservations = min
+	return b
+}
+
+// WithConfidence sets the fraction of observers in (0, 1] that must agree on our IP. Should they
+// not, our NAT is assumed to be symmetric.
+func (b *block) WithConfidence(confidence float64) *block {
+	if confidence <= 0 || confidence > 1 {
+		panic("identify: confidence must be in (0, 1]")
+	}
+
+	b.confidence = confidence
+	return b
+}
+
+// WithObservationTTL sets how long an observation is taken into account for.
+func (b *block) WithObservationTTL(ttl time.Duration) *block {
+	b.observationTTL = ttl
+	return b
+}
+
+// WithoutAdvertising stops our node from advertising the address it is observed at as its
+// external address.
+func (b *block) WithoutAdvertising() *block {
+	b.advertise = false
+	return b
+}
+
+// OnStatusChanged registers a callback which is called whenever our NAT status, or the address
+// we are determined to be reachable at, changes.
+func (b *block) OnStatusChanged(fn func(node *noise.Node, status NATStatus, address string)) *block {
+	b.onStatusChanged = append(b.onStatusChanged, fn)
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeIdentify = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Identify)(nil))
+
+	node.Set(keyState, &state{
+		block:        b,
+		node:         node,
+		observations: newObservations(b.observationTTL, b.minObservations, b.confidence),
+	})
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	s := peer.Node().Get(keyState).(*state)
+
+	observed := net.JoinHostPort(peer.RemoteIP().String(), strconv.FormatUint(uint64(peer.RemotePort()), 10))
+
+	locker := peer.LockOnReceive(b.opcodeIdentify)
+	defer locker.Unlock()
+
+	if err := peer.SendMessage(Identify{Observed: observed}); err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "identify: failed to report observed address")
+	}
+
+	select {
+	case <-peer.Node().Clock().After(b.timeoutDuration):
+		return errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeTimeout), "identify: timed out waiting for peer to report our address")
+	case msg := <-peer.Receive(b.opcodeIdentify):
+		s.observe(peer, msg.(Identify).Observed)
+	}
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Status returns our nodes NAT status, and the address our node is determined to be reachable
+// at alongside the fraction of observers which agree on it. The address is empty should our
+// status be unknown.
+func Status(node *noise.Node) (NATStatus, string, float64) {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return StatusUnknown, "", 0
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	return s.status, s.address, s.confidence
+}
+
+type state struct {
+	sync.Mutex
+
+	block *block
+	node  *noise.Node
+
+	observations *observations
+
+	status     NATStatus
+	address    string
+	confidence float64
+	advertised bool
+}
+
+func (s *state) observe(peer *noise.Peer, observed string) {
+	host, portStr, err := net.SplitHostPort(observed)
+	if err != nil {
+		log.Warn().Err(err).Str("observed", observed).Msg("Peer reported a malformed address.")
+		return
+	}
+
+	ip := net.ParseIP(host)
+	port, err := strconv.ParseUint(portStr, 10, 16)
+
+	if ip == nil || err != nil {
+		log.Warn().Str("observed", observed).Msg("Peer reported a malformed address.")
+		return
+	}
+
+	s.observations.add(peer.RemoteIP().String(), observation{
+		ip:        ip,
+		port:      uint16(port),
+		localIP:   peer.LocalIP(),
+		localPort: peer.LocalPort(),
+		at:        s.node.Clock().Now(),
+	})
+
+	s.reevaluate()
+}
+
+func (s *state) reevaluate() {
+	status, ip, confidence := s.observations.evaluate(s.node.Clock().Now(), s.node.InternalPort())
+
+	var address string
+	if ip != nil {
+		address = net.JoinHostPort(ip.String(), strconv.FormatUint(uint64(s.node.ExternalPort()), 10))
+	}
+
+	s.Lock()
+
+	changed := status != s.status || address != s.address
+	s.status, s.address, s.confidence = status, address, confidence
+
+	if s.block.advertise {
+		switch {
+		case status == StatusPublic || status == StatusBehindNAT:
+			s.node.SetExternalAddress(address)
+			s.advertised = true
+		case s.advertised:
+			s.node.SetExternalAddress("")
+			s.advertised = false
+		}
+	}
+
+	s.Unlock()
+
+	if !changed {
+		return
+	}
+
+	log.Info().Str("status", status.String()).Str("address", address).Float64("confidence", confidence).Msg("Determined NAT status from observed addresses.")
+
+	for _, fn := range s.block.onStatusChanged {
+		fn(s.node, status, address)
+	}
+}
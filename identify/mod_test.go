@@ -0,0 +1,160 @@
+package identify
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func obs(ip string, port uint16, localIP string, localPort uint16, at time.Time) observation {
+	return observation{ip: net.ParseIP(ip), port: port, localIP: net.ParseIP(localIP), localPort: localPort, at: at}
+}
+
+func TestObservations(t *testing.T) {
+	now := time.Now()
+
+	o := newObservations(time.Minute, 3, 2.0/3.0)
+
+	// Too few observers.
+	o.add("1.1.1.1", obs("8.8.8.8", 40000, "10.0.0.2", 40000, now))
+	o.add("2.2.2.2", obs("8.8.8.8", 40001, "10.0.0.2", 40001, now))
+
+	status, _, _ := o.evaluate(now, 3000)
+	assert.Equal(t, StatusUnknown, status)
+
+	// Observers agree on a translated IP, and the NAT preserves our ports.
+	o.add("3.3.3.3", obs("8.8.8.8", 3000, "10.0.0.2", 3000, now))
+
+	status, ip, confidence := o.evaluate(now, 3000)
+	assert.Equal(t, StatusBehindNAT, status)
+	assert.Equal(t, "8.8.8.8", ip.String())
+	assert.Equal(t, 1.0, confidence)
+
+	// The same observer is only ever counted once.
+	o.add("3.3.3.3", obs("9.9.9.9", 3000, "10.0.0.2", 3000, now))
+	o.add("3.3.3.3", obs("8.8.8.8", 3000, "10.0.0.2", 3000, now))
+
+	status, _, _ = o.evaluate(now, 3000)
+	assert.Equal(t, StatusBehindNAT, status)
+
+	// Ports of outgoing connections being remapped implies a symmetric NAT.
+	o.add("1.1.1.1", obs("8.8.8.8", 51234, "10.0.0.2", 40000, now))
+	o.add("2.2.2.2", obs("8.8.8.8", 52345, "10.0.0.2", 40001, now))
+
+	status, _, _ = o.evaluate(now, 3000)
+	assert.Equal(t, StatusSymmetric, status)
+
+	// So does observers disagreeing on our IP.
+	o = newObservations(time.Minute, 3, 2.0/3.0)
+	o.add("1.1.1.1", obs("8.8.8.8", 3000, "10.0.0.2", 3000, now))
+	o.add("2.2.2.2", obs("8.8.4.4", 3000, "10.0.0.2", 3000, now))
+	o.add("3.3.3.3", obs("8.8.2.2", 3000, "10.0.0.2", 3000, now))
+
+	status, _, confidence = o.evaluate(now, 3000)
+	assert.Equal(t, StatusSymmetric, status)
+	assert.InDelta(t, 1.0/3.0, confidence, 1e-9)
+
+	// No translation taking place implies we are public.
+	o = newObservations(time.Minute, 2, 2.0/3.0)
+	o.add("1.1.1.1", obs("8.8.8.8", 40000, "8.8.8.8", 40000, now))
+	o.add("2.2.2.2", obs("8.8.8.8", 3000, "8.8.8.8", 3000, now))
+
+	status, ip, _ = o.evaluate(now, 3000)
+	assert.Equal(t, StatusPublic, status)
+	assert.Equal(t, "8.8.8.8", ip.String())
+
+	// Observations expire.
+	status, _, _ = o.evaluate(now.Add(2*time.Minute), 3000)
+	assert.Equal(t, StatusUnknown, status)
+}
+
+func TestIdentify(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewTCP()
+
+	var nodes []*noise.Node
+	var blocks []*block
+
+	changed := make(chan NATStatus, 2)
+
+	for i := 0; i < 2; i++ {
+		params := noise.DefaultParams()
+		params.Transport = layer
+
+		node, err := noise.NewNode(params)
+		assert.NoError(t, err)
+		defer node.Kill()
+
+		block := New().WithMinObservations(1).OnStatusChanged(func(node *noise.Node, status NATStatus, address string) {
+			changed <- status
+		})
+
+		protocol.New().Register(block).Enforce(node)
+
+		go node.Listen()
+
+		nodes = append(nodes, node)
+		blocks = append(blocks, block)
+	}
+
+	status, _, _ := Status(nodes[0])
+	assert.Equal(t, StatusUnknown, status)
+
+	peer, err := nodes[0].Dial(nodes[1].ExternalAddress())
+	assert.NoError(t, err)
+	defer peer.Disconnect()
+
+	protocol.WaitUntilEstablished(peer)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case status := <-changed:
+			assert.Equal(t, StatusPublic, status)
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for nat status to be determined")
+		}
+	}
+
+	// Both nodes are observed on loopback with no address translation taking place.
+	for _, node := range nodes {
+		status, address, confidence := Status(node)
+
+		assert.Equal(t, StatusPublic, status)
+		assert.Equal(t, 1.0, confidence)
+		assert.Equal(t, node.ExternalAddress(), address)
+	}
+
+	// Peers that never report our address are disconnected.
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	silent, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer silent.Kill()
+
+	go silent.Listen()
+
+	blocks[0].TimeoutAfter(10 * time.Millisecond)
+
+	disconnected := make(chan struct{}, 1)
+	nodes[0].OnPeerDisconnected(func(node *noise.Node, peer *noise.Peer) error {
+		disconnected <- struct{}{}
+		return nil
+	})
+
+	_, err = nodes[0].Dial(silent.ExternalAddress())
+	assert.NoError(t, err)
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected silent peer to be disconnected")
+	}
+}
@@ -0,0 +1,27 @@
+package identify
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
+
+var _ noise.Message = (*Identify)(nil)
+
+// Identify reports the address a peer observed the recipient to be connecting from.
+type Identify struct {
+	Observed string
+}
+
+func (Identify) Read(reader payload.Reader) (noise.Message, error) {
+	observed, err := reader.ReadString()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read observed address")
+	}
+
+	return Identify{Observed: observed}, nil
+}
+
+func (m Identify) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.Observed).Bytes()
+}
@@ -0,0 +1,147 @@
+package identify
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// NATStatus describes how our node is reachable, as determined by the addresses our peers
+// observe us at.
+type NATStatus byte
+
+const (
+	// StatusUnknown is reported until enough peers have observed our address.
+	StatusUnknown NATStatus = iota
+
+	// StatusPublic is reported should peers observe us at the same IP our connections are bound
+	// to, such that no address translation takes place.
+	StatusPublic
+
+	// StatusBehindNAT is reported should peers agree on an IP that is not our own, while the NAT
+	// preserves the ports of our outgoing connections. Peers may reach us should our listening
+	// port be forwarded.
+	StatusBehindNAT
+
+	// StatusSymmetric is reported should peers disagree on our IP, or should the NAT map our
+	// outgoing connections to unpredictable ports, such that peers are unlikely to reach us
+	// without a relay.
+	StatusSymmetric
+)
+
+func (s NATStatus) String() string {
+	switch s {
+	case StatusPublic:
+		return "public"
+	case StatusBehindNAT:
+		return "behind-nat"
+	case StatusSymmetric:
+		return "symmetric"
+	default:
+		return "unknown"
+	}
+}
+
+// observation is the address a peer observed us at over a connection, alongside the address the
+// connection was bound to on our end.
+type observation struct {
+	ip   net.IP
+	port uint16
+
+	localIP   net.IP
+	localPort uint16
+
+	at time.Time
+}
+
+// observations aggregates the latest observation of every distinct observer.
+type observations struct {
+	sync.Mutex
+
+	byObserver map[string]observation
+
+	ttl        time.Duration
+	min        int
+	confidence float64
+}
+
+func newObservations(ttl time.Duration, min int, confidence float64) *observations {
+	return &observations{byObserver: make(map[string]observation), ttl: ttl, min: min, confidence: confidence}
+}
+
+func (o *observations) add(observer string, obs observation) {
+	o.Lock()
+	defer o.Unlock()
+
+	o.byObserver[observer] = obs
+}
+
+// evaluate prunes expired observations, and determines our NAT status alongside the IP most of
+// our observers agree on and the fraction of observers which agree on it. Observations made over
+// connections bound to our listening port are ignored when checking if the NAT preserves ports,
+// as they were dialed by peers rather than by us.
+func (o *observations) evaluate(now time.Time, listenPort uint16) (NATStatus, net.IP, float64) {
+	o.Lock()
+	defer o.Unlock()
+
+	for observer, obs := range o.byObserver {
+		if now.Sub(obs.at) > o.ttl {
+			delete(o.byObserver, observer)
+		}
+	}
+
+	total := len(o.byObserver)
+
+	if total == 0 || total < o.min {
+		return StatusUnknown, nil, 0
+	}
+
+	tally := make(map[string]int)
+
+	var top string
+	for _, obs := range o.byObserver {
+		ip := obs.ip.String()
+		tally[ip]++
+
+		if tally[ip] > tally[top] || (tally[ip] == tally[top] && ip < top) {
+			top = ip
+		}
+	}
+
+	ip := net.ParseIP(top)
+	confidence := float64(tally[top]) / float64(total)
+
+	if confidence < o.confidence {
+		return StatusSymmetric, ip, confidence
+	}
+
+	translated := false
+	outbound, preserved := 0, 0
+
+	for _, obs := range o.byObserver {
+		if !obs.ip.Equal(ip) {
+			continue
+		}
+
+		if !obs.localIP.Equal(ip) {
+			translated = true
+		}
+
+		if obs.localPort != listenPort {
+			outbound++
+
+			if obs.port == obs.localPort {
+				preserved++
+			}
+		}
+	}
+
+	switch {
+	case !translated:
+		return StatusPublic, ip, confidence
+	case preserved*2 < outbound:
+		return StatusSymmetric, ip, confidence
+	default:
+		return StatusBehindNAT, ip, confidence
+	}
+}
@@ -0,0 +1,139 @@
+package ed25519
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// HardenedKeyStart is the index of the first hardened child key. Only hardened child keys may be
+// derived from Ed25519 keys, and so every index is hardened upon derivation.
+const HardenedKeyStart uint32 = 0x80000000
+
+var masterKeySalt = []byte("ed25519 seed")
+
+// ExtendedKeys is an Ed25519 keypair paired with a chain code, from which child keypairs may be
+// deterministically derived following SLIP-0010 (the Ed25519 variant of BIP32).
+//
+// A single backed-up master seed may therefore be used to recover the keys of any number of nodes,
+// with each node being designated its own derivation path (for example, m/0'/1' for the second
+// node of the first network).
+type ExtendedKeys struct {
+	*Keypair
+	chainCode []byte
+}
+
+// MasterKeys derives master extended keys from a seed that is between 16 and 64 bytes long.
+func MasterKeys(seed []byte) (*ExtendedKeys, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, errors.Errorf("ed25519: hd seed must be between 16 and 64 bytes, but got %d bytes", len(seed))
+	}
+
+	mac := hmac.New(sha512.New, masterKeySalt)
+	_, _ = mac.Write(seed)
+
+	return extendedKeys(mac.Sum(nil))
+}
+
+// Child derives the hardened child extended keys at a specified index. Indices below
+// HardenedKeyStart are hardened automatically.
+func (k *ExtendedKeys) Child(index uint32) (*ExtendedKeys, error) {
+	if index < HardenedKeyStart {
+		index += HardenedKeyStart
+	}
+
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], index)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	_, _ = mac.Write([]byte{0x00})
+	_, _ = mac.Write(k.privateKey[:32])
+	_, _ = mac.Write(buf[:])
+
+	return extendedKeys(mac.Sum(nil))
+}
+
+// Derive derives the extended keys at a specified path relative to k, such as m/44'/0'.
+func (k *ExtendedKeys) Derive(path string) (*ExtendedKeys, error) {
+	indices, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := k
+
+	for _, index := range indices {
+		if keys, err = keys.Child(index); err != nil {
+			return nil, errors.Wrapf(err, "ed25519: failed to derive child key %d of path %q", index, path)
+		}
+	}
+
+	return keys, nil
+}
+
+// ChainCode returns the chain code of the extended keys.
+func (k *ExtendedKeys) ChainCode() []byte {
+	return k.chainCode
+}
+
+// DeriveKeys derives the keypair at a specified path, such as m/44'/0', from a master seed.
+func DeriveKeys(seed []byte, path string) (*Keypair, error) {
+	master, err := MasterKeys(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := master.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys.Keypair, nil
+}
+
+// ParsePath parses a derivation path, such as m/44'/0', into its child key indices. As only
+// hardened child keys may be derived, indices are hardened regardless of whether or not they are
+// suffixed with an apostrophe or a 'h'.
+func ParsePath(path string) ([]uint32, error) {
+	segments := strings.Split(strings.TrimSpace(path), "/")
+
+	if segments[0] != "m" {
+		return nil, errors.Errorf("ed25519: hd path %q must begin with m", path)
+	}
+
+	indices := make([]uint32, 0, len(segments)-1)
+
+	for _, segment := range segments[1:] {
+		segment = strings.TrimRight(segment, "'hH")
+
+		index, err := strconv.ParseUint(segment, 10, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ed25519: invalid segment %q in hd path %q", segment, path)
+		}
+
+		if uint32(index) >= HardenedKeyStart {
+			return nil, errors.Errorf("ed25519: index %d in hd path %q is out of range", index, path)
+		}
+
+		indices = append(indices, uint32(index)+HardenedKeyStart)
+	}
+
+	return indices, nil
+}
+
+func extendedKeys(digest []byte) (*ExtendedKeys, error) {
+	publicKey, privateKey, err := edwards25519.GenerateKey(bytes.NewReader(digest[:32]))
+	if err != nil {
+		return nil, errors.Wrap(err, "ed25519: failed to derive keypair")
+	}
+
+	return &ExtendedKeys{
+		Keypair:   &Keypair{privateKey: privateKey, publicKey: publicKey},
+		chainCode: digest[32:],
+	}, nil
+}
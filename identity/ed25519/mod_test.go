@@ -1,6 +1,7 @@
 package ed25519_test
 
 import (
+	"encoding/hex"
 	"github.com/perlin-network/noise/identity/ed25519"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -20,3 +21,43 @@ func TestEd25519(t *testing.T) {
 	assert.NotNil(t, mgr)
 	assert.EqualValues(t, mgr.PublicKey(), publicKey)
 }
+
+func TestHDDerivation(t *testing.T) {
+	t.Parallel()
+
+	// Test vector 1 for Ed25519 from SLIP-0010.
+	seed, err := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	assert.NoError(t, err)
+
+	master, err := ed25519.MasterKeys(seed)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7", hex.EncodeToString(master.PrivateKey()[:32]))
+	assert.Equal(t, "90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb", hex.EncodeToString(master.ChainCode()))
+	assert.Equal(t, "a4b2856bfec510abab89753fac1ac0e1112364e7d250545963f135f2a33188ed", hex.EncodeToString(master.PublicKey()))
+
+	child, err := master.Derive("m/0'")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3", hex.EncodeToString(child.PrivateKey()[:32]))
+	assert.Equal(t, "8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69", hex.EncodeToString(child.ChainCode()))
+
+	// Derivation is deterministic, and distinct paths yield distinct identities.
+	a, err := ed25519.DeriveKeys(seed, "m/0'/1'")
+	assert.NoError(t, err)
+
+	b, err := ed25519.DeriveKeys(seed, "m/0/1")
+	assert.NoError(t, err)
+
+	c, err := ed25519.DeriveKeys(seed, "m/0'/2'")
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, a.PrivateKey(), b.PrivateKey())
+	assert.NotEqual(t, a.PublicKey(), c.PublicKey())
+
+	_, err = ed25519.DeriveKeys(seed, "0'/1'")
+	assert.Error(t, err)
+
+	_, err = ed25519.DeriveKeys(seed[:8], "m/0'")
+	assert.Error(t, err)
+}
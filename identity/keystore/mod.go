@@ -0,0 +1,240 @@
+// Package keystore protects a nodes private key at rest by encrypting it under a passphrase.
+//
+// Keys are derived from passphrases using argon2id, and private keys are sealed using
+// XChaCha20-Poly1305 with the key derivation parameters authenticated as additional data.
+package keystore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	version = 1
+
+	saltSize = 16
+
+	// maxTime, maxMemory (in KiB) and maxThreads bound the work a key file may demand to be opened,
+	// such that a tampered key file may neither exhaust the memory of our node nor stall it.
+	maxTime    = 16
+	maxMemory  = 1024 * 1024
+	maxThreads = 64
+)
+
+var magic = []byte("noisekey")
+
+var (
+	ErrInvalidPassphrase = errors.New("keystore: invalid passphrase or corrupted key file")
+	ErrMalformedKeyFile  = errors.New("keystore: malformed key file")
+)
+
+// KDFParams are the argon2id parameters used to derive an encryption key from a passphrase.
+type KDFParams struct {
+	// Time is the number of passes made over memory.
+	Time uint32
+
+	// Memory is the amount of memory used in KiB.
+	Memory uint32
+
+	// Threads is the number of lanes used in parallel.
+	Threads uint8
+}
+
+// check asserts that the parameters do not exceed the work a key file may demand to be opened.
+func (p KDFParams) check() error {
+	if p.Time > maxTime {
+		return errors.Errorf("argon2id time of %d exceeds the maximum of %d", p.Time, maxTime)
+	}
+
+	if p.Memory > maxMemory {
+		return errors.Errorf("argon2id memory of %d KiB exceeds the maximum of %d KiB", p.Memory, maxMemory)
+	}
+
+	if p.Threads > maxThreads {
+		return errors.Errorf("argon2id threads of %d exceeds the maximum of %d", p.Threads, maxThreads)
+	}
+
+	return nil
+}
+
+// DefaultKDFParams returns the argon2id parameters recommended by RFC 9106 for
+// memory-constrained environments.
+func DefaultKDFParams() KDFParams {
+	return KDFParams{
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+	}
+}
+
+// Encrypt seals a private key under a passphrase using the default key derivation parameters.
+func Encrypt(privateKey, passphrase []byte) ([]byte, error) {
+	return EncryptWithParams(privateKey, passphrase, DefaultKDFParams())
+}
+
+// EncryptWithParams seals a private key under a passphrase using specified key derivation
+// parameters, which are stored alongside the sealed private key.
+func EncryptWithParams(privateKey, passphrase []byte, params KDFParams) ([]byte, error) {
+	if params.Time == 0 || params.Memory == 0 || params.Threads == 0 {
+		return nil, errors.New("keystore: argon2id time, memory and threads must be non-zero")
+	}
+
+	if err := params.check(); err != nil {
+		return nil, errors.Wrap(err, "keystore")
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, errors.Wrap(err, "keystore: failed to generate salt")
+	}
+
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "keystore: failed to generate nonce")
+	}
+
+	aead, err := chacha20poly1305.NewX(deriveKey(passphrase, salt, params))
+	if err != nil {
+		return nil, errors.Wrap(err, "keystore: failed to init aead")
+	}
+
+	writer := payload.NewWriter(append([]byte(nil), magic...)).
+		WriteByte(version).
+		WriteUint32(params.Time).
+		WriteUint32(params.Memory).
+		WriteByte(params.Threads).
+		WriteBytes(salt).
+		WriteBytes(nonce)
+
+	additional := writer.Bytes()
+
+	return writer.WriteBytes(aead.Seal(nil, nonce, privateKey, additional)).Bytes(), nil
+}
+
+// Decrypt opens a private key sealed by Encrypt using a passphrase.
+func Decrypt(buf, passphrase []byte) ([]byte, error) {
+	if !bytes.HasPrefix(buf, magic) {
+		return nil, ErrMalformedKeyFile
+	}
+
+	reader := payload.NewReader(buf[len(magic):])
+
+	v, err := reader.ReadByte()
+	if err != nil {
+		return nil, errors.Wrap(ErrMalformedKeyFile, "failed to read version")
+	}
+
+	if v != version {
+		return nil, errors.Wrapf(ErrMalformedKeyFile, "unsupported version %d", v)
+	}
+
+	var params KDFParams
+
+	if params.Time, err = reader.ReadUint32(); err != nil {
+		return nil, errors.Wrap(ErrMalformedKeyFile, "failed to read argon2id time")
+	}
+
+	if params.Memory, err = reader.ReadUint32(); err != nil {
+		return nil, errors.Wrap(ErrMalformedKeyFile, "failed to read argon2id memory")
+	}
+
+	if params.Threads, err = reader.ReadByte(); err != nil {
+		return nil, errors.Wrap(ErrMalformedKeyFile, "failed to read argon2id threads")
+	}
+
+	if params.Time == 0 || params.Memory == 0 || params.Threads == 0 {
+		return nil, errors.Wrap(ErrMalformedKeyFile, "argon2id time, memory and threads must be non-zero")
+	}
+
+	if err := params.check(); err != nil {
+		return nil, errors.Wrap(ErrMalformedKeyFile, err.Error())
+	}
+
+	salt, err := reader.ReadBytes()
+	if err != nil {
+		return nil, errors.Wrap(ErrMalformedKeyFile, "failed to read salt")
+	}
+
+	nonce, err := reader.ReadBytes()
+	if err != nil || len(nonce) != chacha20poly1305.NonceSizeX {
+		return nil, errors.Wrap(ErrMalformedKeyFile, "failed to read nonce")
+	}
+
+	additional := buf[:len(buf)-reader.Len()]
+
+	ciphertext, err := reader.ReadBytes()
+	if err != nil {
+		return nil, errors.Wrap(ErrMalformedKeyFile, "failed to read ciphertext")
+	}
+
+	aead, err := chacha20poly1305.NewX(deriveKey(passphrase, salt, params))
+	if err != nil {
+		return nil, errors.Wrap(err, "keystore: failed to init aead")
+	}
+
+	privateKey, err := aead.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, ErrInvalidPassphrase
+	}
+
+	return privateKey, nil
+}
+
+// Save seals a private key under a passphrase, and writes it to a file readable only by its owner.
+// The file is replaced atomically, such that an existing key file is never left half-written.
+func Save(path string, privateKey, passphrase []byte) error {
+	buf, err := Encrypt(privateKey, passphrase)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "keystore: failed to create temporary key file")
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "keystore: failed to restrict permissions of key file")
+	}
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "keystore: failed to write key file")
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "keystore: failed to flush key file")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "keystore: failed to close key file")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), path), "keystore: failed to replace key file")
+}
+
+// Load reads a private key sealed under a passphrase from a file.
+func Load(path string, passphrase []byte) ([]byte, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "keystore: failed to read key file")
+	}
+
+	return Decrypt(buf, passphrase)
+}
+
+func deriveKey(passphrase, salt []byte, params KDFParams) []byte {
+	return argon2.IDKey(passphrase, salt, params.Time, params.Memory, params.Threads, chacha20poly1305.KeySize)
+}
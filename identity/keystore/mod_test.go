@@ -0,0 +1,103 @@
+package keystore
+
+import (
+	"encoding/binary"
+	"github.com/perlin-network/noise/identity/ed25519"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testParams = KDFParams{Time: 1, Memory: 64, Threads: 1}
+
+func TestEncryptDecrypt(t *testing.T) {
+	keys := ed25519.RandomKeys()
+
+	buf, err := EncryptWithParams(keys.PrivateKey(), []byte("passphrase"), testParams)
+	assert.NoError(t, err)
+
+	privateKey, err := Decrypt(buf, []byte("passphrase"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, keys.PrivateKey(), privateKey)
+
+	_, err = Decrypt(buf, []byte("wrong passphrase"))
+	assert.True(t, errors.Cause(err) == ErrInvalidPassphrase)
+
+	// Tampering with the key derivation parameters must be detected.
+	tampered := append([]byte(nil), buf...)
+	tampered[len(magic)+1]++
+
+	_, err = Decrypt(tampered, []byte("passphrase"))
+	assert.True(t, errors.Cause(err) == ErrInvalidPassphrase)
+
+	_, err = Decrypt(buf[:len(buf)/2], []byte("passphrase"))
+	assert.True(t, errors.Cause(err) == ErrMalformedKeyFile)
+
+	_, err = Decrypt([]byte("garbage"), []byte("passphrase"))
+	assert.True(t, errors.Cause(err) == ErrMalformedKeyFile)
+}
+
+func TestDecryptTamperedHeader(t *testing.T) {
+	keys := ed25519.RandomKeys()
+
+	buf, err := EncryptWithParams(keys.PrivateKey(), []byte("passphrase"), testParams)
+	assert.NoError(t, err)
+
+	header := len(magic) + 1
+
+	tamper := func(f func(tampered []byte)) error {
+		tampered := append([]byte(nil), buf...)
+		f(tampered)
+
+		_, err := Decrypt(tampered, []byte("passphrase"))
+		return err
+	}
+
+	// Key files demanding excessive work to be opened must be rejected before any key is derived.
+	err = tamper(func(tampered []byte) { binary.LittleEndian.PutUint32(tampered[header:], maxTime+1) })
+	assert.True(t, errors.Cause(err) == ErrMalformedKeyFile)
+
+	err = tamper(func(tampered []byte) { binary.LittleEndian.PutUint32(tampered[header+4:], maxMemory+1) })
+	assert.True(t, errors.Cause(err) == ErrMalformedKeyFile)
+
+	err = tamper(func(tampered []byte) { tampered[header+8] = maxThreads + 1 })
+	assert.True(t, errors.Cause(err) == ErrMalformedKeyFile)
+
+	err = tamper(func(tampered []byte) { binary.LittleEndian.PutUint32(tampered[header+4:], 0) })
+	assert.True(t, errors.Cause(err) == ErrMalformedKeyFile)
+
+	err = tamper(func(tampered []byte) { tampered[len(magic)] = version + 1 })
+	assert.True(t, errors.Cause(err) == ErrMalformedKeyFile)
+
+	// Tampering with parameters within bounds must still be detected once the key file is opened.
+	err = tamper(func(tampered []byte) { tampered[header+8]++ })
+	assert.True(t, errors.Cause(err) == ErrInvalidPassphrase)
+
+	_, err = EncryptWithParams(keys.PrivateKey(), []byte("passphrase"), KDFParams{Time: 1, Memory: maxMemory + 1, Threads: 1})
+	assert.Error(t, err)
+}
+
+func TestSaveUnlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "node.key")
+	keys := ed25519.RandomKeys()
+
+	assert.NoError(t, Save(path, keys.PrivateKey(), []byte("passphrase")))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0600, info.Mode().Perm())
+
+	assert.NoError(t, os.Setenv(PassphraseEnv, "passphrase"))
+	defer os.Unsetenv(PassphraseEnv)
+
+	privateKey, err := Unlock(path)
+	assert.NoError(t, err)
+	assert.EqualValues(t, keys.PublicKey(), ed25519.LoadKeys(privateKey).PublicKey())
+}
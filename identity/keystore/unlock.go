@@ -0,0 +1,30 @@
+package keystore
+
+import (
+	"fmt"
+	"os"
+)
+
+// PassphraseEnv is the environment variable a passphrase is read from to unlock a key file
+// non-interactively, such as when a node is run by a process supervisor.
+const PassphraseEnv = "NOISE_KEY_PASSPHRASE"
+
+// Passphrase reads a passphrase from the environment variable PassphraseEnv should it be set.
+// Otherwise, the passphrase is interactively prompted for on the terminal attached to stdin.
+func Passphrase(prompt string) ([]byte, error) {
+	if passphrase, set := os.LookupEnv(PassphraseEnv); set {
+		return []byte(passphrase), nil
+	}
+
+	return readPassphrase(prompt)
+}
+
+// Unlock loads a private key from a key file, with its passphrase read using Passphrase.
+func Unlock(path string) ([]byte, error) {
+	passphrase, err := Passphrase(fmt.Sprintf("Enter passphrase for %s: ", path))
+	if err != nil {
+		return nil, err
+	}
+
+	return Load(path, passphrase)
+}
@@ -0,0 +1,10 @@
+//go:build js
+// +build js
+
+package keystore
+
+import "github.com/pkg/errors"
+
+func readPassphrase(prompt string) ([]byte, error) {
+	return nil, errors.New("keystore: interactive unlocking is unsupported within a browser; use Load with a passphrase instead")
+}
@@ -0,0 +1,29 @@
+//go:build !js
+// +build !js
+
+package keystore
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh/terminal"
+	"os"
+)
+
+func readPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+
+	if !terminal.IsTerminal(fd) {
+		return nil, errors.Errorf("keystore: stdin is not a terminal; set %s to unlock key files non-interactively", PassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	passphrase, err := terminal.ReadPassword(fd)
+	if err != nil {
+		return nil, errors.Wrap(err, "keystore: failed to read passphrase")
+	}
+
+	return passphrase, nil
+}
@@ -0,0 +1,231 @@
+package edwards25519
+
+import (
+	cryptorand "crypto/rand"
+	"crypto/sha512"
+)
+
+// order is the order l = 2^252 + 27742317777372353535851937790883648493 of the base point, in
+// little-endian form.
+var order = [32]byte{
+	0xed, 0xd3, 0xf5, 0x5c, 0x1a, 0x63, 0x12, 0x58, 0xd6, 0x9c, 0xf7, 0xa2, 0xde, 0xf9, 0xde, 0x14,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10,
+}
+
+// VerifyCofactored reports whether sig is a valid signature of message by publicKey under the
+// cofactored verification equation [8][s]B = [8]R + [8][k]A, which is the equation VerifyBatch
+// checks many signatures against at once. As per ZIP-215, which ed25519consensus implements, the
+// public key and R may be encoded non-canonically, yet s must be fully reduced.
+//
+// Verify checks the cofactorless equation instead, and so rejects signatures whose R or public key
+// is offset by a point of small order, which VerifyCofactored accepts. Batches are checked under
+// the cofactored equation, as offsets of small order may otherwise cancel each other out across
+// signatures of a batch, such that whether a signature is accepted would depend on which other
+// signatures it happened to be batched with.
+func VerifyCofactored(publicKey PublicKey, message, sig []byte) bool {
+	var e batchEntry
+	if !e.decode(publicKey, message, sig) {
+		return false
+	}
+
+	var one [32]byte
+	one[0] = 1
+
+	return verifyEntries([]batchEntry{e}, [][32]byte{one})
+}
+
+// VerifyBatch reports whether every signature sigs[i] is a valid signature of messages[i] by
+// publicKeys[i] under VerifyCofactored, by checking a random linear combination of all of their
+// verification equations at once. Should the batch not verify, at least one of its signatures is
+// invalid, and signatures are to be verified one by one with VerifyCofactored to find out which.
+//
+// The coefficients of the linear combination are 128-bit scalars drawn from crypto/rand, such that
+// a batch with an invalid signature verifies with a probability of at most 2^-128.
+func VerifyBatch(publicKeys []PublicKey, messages, sigs [][]byte) bool {
+	if len(publicKeys) != len(messages) || len(publicKeys) != len(sigs) {
+		return false
+	}
+
+	if len(sigs) == 0 {
+		return true
+	}
+
+	entries := make([]batchEntry, len(sigs))
+	for i := range entries {
+		if !entries[i].decode(publicKeys[i], messages[i], sigs[i]) {
+			return false
+		}
+	}
+
+	coefficients := make([][32]byte, len(entries))
+	for i := range coefficients {
+		if _, err := cryptorand.Read(coefficients[i][:16]); err != nil {
+			return false
+		}
+	}
+
+	return verifyEntries(entries, coefficients)
+}
+
+// batchEntry is a decoded signature, holding the negations of R and of the public key A alongside
+// the scalars s and k = SHA-512(R || A || M) mod l.
+type batchEntry struct {
+	negR, negA ExtendedGroupElement
+	s, k       [32]byte
+}
+
+func (e *batchEntry) decode(publicKey PublicKey, message, sig []byte) bool {
+	if len(publicKey) != PublicKeySize || len(sig) != SignatureSize {
+		return false
+	}
+
+	var s [32]byte
+	copy(s[:], sig[32:])
+	if !scIsCanonical(&s) {
+		return false
+	}
+
+	var publicKeyBytes, rBytes [32]byte
+	copy(publicKeyBytes[:], publicKey)
+	copy(rBytes[:], sig[:32])
+
+	if !e.negA.FromBytes(&publicKeyBytes) || !e.negR.FromBytes(&rBytes) {
+		return false
+	}
+
+	FeNeg(&e.negA.X, &e.negA.X)
+	FeNeg(&e.negA.T, &e.negA.T)
+	FeNeg(&e.negR.X, &e.negR.X)
+	FeNeg(&e.negR.T, &e.negR.T)
+
+	h := sha512.New()
+	h.Write(sig[:32])
+	h.Write(publicKey)
+	h.Write(message)
+	var digest [64]byte
+	h.Sum(digest[:0])
+
+	ScReduce(&e.k, &digest)
+	e.s = s
+
+	return true
+}
+
+// verifyEntries checks that [8]([sum z_i s_i]B - sum [z_i]R_i - sum [z_i k_i]A_i) is the identity,
+// given coefficients z_i.
+func verifyEntries(entries []batchEntry, coefficients [][32]byte) bool {
+	var zero, sum [32]byte
+
+	scalars := make([][32]byte, 0, 2*len(entries))
+	points := make([]*ExtendedGroupElement, 0, 2*len(entries))
+
+	for i := range entries {
+		e, z := &entries[i], &coefficients[i]
+
+		ScMulAdd(&sum, z, &e.s, &sum)
+
+		var zk [32]byte
+		ScMulAdd(&zk, z, &e.k, &zero)
+
+		scalars = append(scalars, *z, zk)
+		points = append(points, &e.negR, &e.negA)
+	}
+
+	var r ProjectiveGroupElement
+	multiScalarMultVartime(&r, &sum, scalars, points)
+
+	var t CompletedGroupElement
+	for i := 0; i < 3; i++ {
+		r.Double(&t)
+		t.ToProjective(&r)
+	}
+
+	var identity, check [32]byte
+	identity[0] = 1
+
+	r.ToBytes(&check)
+	return check == identity
+}
+
+// multiScalarMultVartime sets r = b*B + sum(scalars[i]*points[i]) in variable time, sharing the
+// doublings across all points as per Straus.
+func multiScalarMultVartime(r *ProjectiveGroupElement, b *[32]byte, scalars [][32]byte, points []*ExtendedGroupElement) {
+	var bSlide [256]int8
+	slides := make([][256]int8, len(points))
+	tables := make([][8]CachedGroupElement, len(points)) // P,3P,5P,7P,9P,11P,13P,15P
+
+	var t CompletedGroupElement
+	var u, P2 ExtendedGroupElement
+
+	slide(&bSlide, b)
+
+	for j, P := range points {
+		slide(&slides[j], &scalars[j])
+
+		P.ToCached(&tables[j][0])
+		P.Double(&t)
+		t.ToExtended(&P2)
+
+		for i := 0; i < 7; i++ {
+			geAdd(&t, &P2, &tables[j][i])
+			t.ToExtended(&u)
+			u.ToCached(&tables[j][i+1])
+		}
+	}
+
+	r.Zero()
+
+	i := 255
+	for ; i >= 0; i-- {
+		if bSlide[i] != 0 {
+			break
+		}
+
+		nonzero := false
+		for j := range slides {
+			if slides[j][i] != 0 {
+				nonzero = true
+				break
+			}
+		}
+
+		if nonzero {
+			break
+		}
+	}
+
+	for ; i >= 0; i-- {
+		r.Double(&t)
+
+		for j := range slides {
+			if s := slides[j][i]; s > 0 {
+				t.ToExtended(&u)
+				geAdd(&t, &u, &tables[j][s/2])
+			} else if s < 0 {
+				t.ToExtended(&u)
+				geSub(&t, &u, &tables[j][(-s)/2])
+			}
+		}
+
+		if bSlide[i] > 0 {
+			t.ToExtended(&u)
+			geMixedAdd(&t, &u, &bi[bSlide[i]/2])
+		} else if bSlide[i] < 0 {
+			t.ToExtended(&u)
+			geMixedSub(&t, &u, &bi[(-bSlide[i])/2])
+		}
+
+		t.ToProjective(r)
+	}
+}
+
+// scIsCanonical reports whether s is fully reduced modulo l.
+func scIsCanonical(s *[32]byte) bool {
+	for i := 31; i >= 0; i-- {
+		if s[i] != order[i] {
+			return s[i] < order[i]
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,38 @@
+package edwards25519
+
+import "crypto/sha512"
+
+// SharedKey computes a Diffie-Hellman shared key between an ed25519 private key and an ed25519
+// public key, by multiplying the public key by the secret scalar the private key is derived from.
+func SharedKey(privateKey PrivateKey, publicKey PublicKey) []byte {
+	digest := sha512.Sum512(privateKey[:32])
+	digest[0] &= 248
+	digest[31] &= 127
+	digest[31] |= 64
+
+	var secretKeyBuf, publicKeyBuf, sharedKeyBuf [32]byte
+	copy(secretKeyBuf[:], digest[:32])
+	copy(publicKeyBuf[:], publicKey)
+
+	var sharedKeyElement, publicKeyElement ExtendedGroupElement
+	publicKeyElement.FromBytes(&publicKeyBuf)
+
+	GeScalarMult(&sharedKeyElement, &secretKeyBuf, &publicKeyElement)
+
+	sharedKeyElement.ToBytes(&sharedKeyBuf)
+
+	return sharedKeyBuf[:]
+}
+
+// IsGroupElement reports whether buf encodes a point on the curve.
+func IsGroupElement(buf []byte) bool {
+	if len(buf) != PublicKeySize {
+		return false
+	}
+
+	var element ExtendedGroupElement
+	var elementBuf [32]byte
+	copy(elementBuf[:], buf)
+
+	return element.FromBytes(&elementBuf)
+}
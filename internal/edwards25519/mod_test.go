@@ -10,8 +10,10 @@ import (
 	"compress/gzip"
 	"crypto"
 	"crypto/rand"
+	"crypto/sha512"
 	"encoding/hex"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -180,3 +182,158 @@ func BenchmarkVerification(b *testing.B) {
 		Verify(pub, message, signature)
 	}
 }
+
+// signWithTorsion signs message under a nonce whose point R is offset by the point of order 2, as
+// only the cofactored verification equation accepts.
+func signWithTorsion(t *testing.T, private PrivateKey, message []byte) []byte {
+	digest := sha512.Sum512(private[:32])
+	digest[0] &= 248
+	digest[31] &= 63
+	digest[31] |= 64
+
+	var a, r [32]byte
+	copy(a[:], digest[:32])
+
+	var nonce [64]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		t.Fatal(err)
+	}
+	ScReduce(&r, &nonce)
+
+	// The point (0, -1) is of order 2.
+	torsionBytes := [32]byte{0xec}
+	for i := 1; i < 31; i++ {
+		torsionBytes[i] = 0xff
+	}
+	torsionBytes[31] = 0x7f
+
+	var R, torsion, offset ExtendedGroupElement
+	var cached CachedGroupElement
+	var sum CompletedGroupElement
+
+	GeScalarMultBase(&R, &r)
+	if !torsion.FromBytes(&torsionBytes) {
+		t.Fatal("failed to decode the point of order 2")
+	}
+	torsion.ToCached(&cached)
+	geAdd(&sum, &R, &cached)
+	sum.ToExtended(&offset)
+
+	var encodedR [32]byte
+	offset.ToBytes(&encodedR)
+
+	h := sha512.New()
+	h.Write(encodedR[:])
+	h.Write(private[32:])
+	h.Write(message)
+	var hram [64]byte
+	h.Sum(hram[:0])
+
+	var k, s [32]byte
+	ScReduce(&k, &hram)
+	ScMulAdd(&s, &k, &a, &r)
+
+	return append(encodedR[:], s[:]...)
+}
+
+func TestVerifyBatch(t *testing.T) {
+	var publicKeys []PublicKey
+	var messages, sigs [][]byte
+
+	for i := 0; i < 64; i++ {
+		public, private, _ := GenerateKey(rand.Reader)
+		message := []byte("test message " + strconv.Itoa(i))
+
+		publicKeys = append(publicKeys, public)
+		messages = append(messages, message)
+		sigs = append(sigs, Sign(private, message))
+
+		if !VerifyCofactored(public, message, sigs[i]) {
+			t.Fatalf("valid signature %d rejected", i)
+		}
+	}
+
+	if !VerifyBatch(publicKeys, messages, sigs) {
+		t.Fatalf("batch of valid signatures rejected")
+	}
+
+	if !VerifyBatch(nil, nil, nil) {
+		t.Errorf("empty batch rejected")
+	}
+
+	if VerifyBatch(publicKeys, messages[:1], sigs) {
+		t.Errorf("batch of mismatched lengths accepted")
+	}
+
+	for _, i := range []int{0, 31, 63} {
+		wrong := append([]byte(nil), messages[i]...)
+		wrong[0] ^= 1
+
+		tampered := append([][]byte(nil), messages...)
+		tampered[i] = wrong
+
+		if VerifyBatch(publicKeys, tampered, sigs) {
+			t.Errorf("batch with signature %d of a different message accepted", i)
+		}
+
+		if VerifyCofactored(publicKeys[i], wrong, sigs[i]) {
+			t.Errorf("signature %d of a different message accepted", i)
+		}
+	}
+
+	// Scalars s which are not fully reduced are rejected.
+	malleated := append([]byte(nil), sigs[0]...)
+	var s [32]byte
+	copy(s[:], malleated[32:])
+	var carry uint16
+	for i := range s {
+		sum := uint16(s[i]) + uint16(order[i]) + carry
+		s[i], carry = byte(sum), sum>>8
+	}
+	copy(malleated[32:], s[:])
+
+	if VerifyCofactored(publicKeys[0], messages[0], malleated) {
+		t.Errorf("signature with a scalar beyond the group order accepted")
+	}
+}
+
+func TestVerifyBatchTorsion(t *testing.T) {
+	public, private, _ := GenerateKey(rand.Reader)
+	message := []byte("test message")
+
+	first, second := signWithTorsion(t, private, message), signWithTorsion(t, private, message)
+
+	if Verify(public, message, first) {
+		t.Fatalf("cofactorless verification accepted a signature offset by a point of small order")
+	}
+
+	if !VerifyCofactored(public, message, first) {
+		t.Fatalf("cofactored verification rejected a signature offset by a point of small order")
+	}
+
+	// Both signatures verify alike whether alone, or batched together.
+	for i := 0; i < 16; i++ {
+		if !VerifyBatch([]PublicKey{public, public}, [][]byte{message, message}, [][]byte{first, second}) {
+			t.Fatalf("batch of signatures offset by points of small order rejected")
+		}
+	}
+}
+
+func BenchmarkVerifyBatch(b *testing.B) {
+	for _, size := range []int{1, 8, 64} {
+		publicKeys := make([]PublicKey, size)
+		messages, sigs := make([][]byte, size), make([][]byte, size)
+
+		for i := range sigs {
+			public, private, _ := GenerateKey(rand.Reader)
+			publicKeys[i], messages[i] = public, []byte("Hello, world!")
+			sigs[i] = Sign(private, messages[i])
+		}
+
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				VerifyBatch(publicKeys, messages, sigs)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Package jsconn exposes message-oriented browser sockets, such as WebSockets and WebRTC data
+// channels, as byte streams implementing net.Conn.
+package jsconn
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+var _ net.Conn = (*Conn)(nil)
+
+type Conn struct {
+	socket        js.Value
+	local, remote net.Addr
+
+	onMessage, onClose js.Func
+
+	mu           sync.Mutex
+	frames       [][]byte
+	readDeadline time.Time
+	notify       chan struct{}
+
+	readMu  sync.Mutex
+	pending []byte
+
+	once sync.Once
+	done chan struct{}
+}
+
+// New wraps a browser socket which exposes a send() and close() method, alongside onmessage and
+// onclose events. Messages received are read as a contiguous stream of bytes.
+func New(socket js.Value, local, remote net.Addr) *Conn {
+	c := &Conn{
+		socket: socket,
+		local:  local,
+		remote: remote,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	socket.Set("binaryType", "arraybuffer")
+
+	c.onMessage = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		data := js.Global().Get("Uint8Array").New(args[0].Get("data"))
+
+		buf := make([]byte, data.Get("length").Int())
+		js.CopyBytesToGo(buf, data)
+
+		// Callbacks from the browser must never block, and so messages are queued without bound.
+		c.mu.Lock()
+		c.frames = append(c.frames, buf)
+		c.mu.Unlock()
+
+		c.wake()
+
+		return nil
+	})
+
+	c.onClose = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		c.shutdown()
+		return nil
+	})
+
+	socket.Set("onmessage", c.onMessage)
+	socket.Set("onclose", c.onClose)
+
+	return c
+}
+
+// Done returns a channel which is closed once the socket is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for len(c.pending) == 0 {
+		c.mu.Lock()
+
+		if len(c.frames) > 0 {
+			c.pending, c.frames = c.frames[0], c.frames[1:]
+			c.mu.Unlock()
+
+			continue
+		}
+
+		deadline := c.readDeadline
+
+		c.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+
+		var closed, expired bool
+
+		select {
+		case <-c.notify:
+		case <-c.done:
+			closed = true
+		case <-timeout:
+			expired = true
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if expired {
+			return 0, errors.New("jsconn: read deadline exceeded")
+		}
+
+		if closed {
+			c.mu.Lock()
+			empty := len(c.frames) == 0
+			c.mu.Unlock()
+
+			if empty {
+				return 0, io.EOF
+			}
+		}
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+
+	return n, nil
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, errors.New("jsconn: connection closed")
+	default:
+	}
+
+	data := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(data, b)
+
+	c.socket.Call("send", data)
+
+	return len(b), nil
+}
+
+func (c *Conn) Close() error {
+	c.socket.Call("close")
+	c.shutdown()
+
+	return nil
+}
+
+func (c *Conn) shutdown() {
+	c.once.Do(func() {
+		close(c.done)
+
+		c.socket.Set("onmessage", js.Null())
+		c.socket.Set("onclose", js.Null())
+
+		c.onMessage.Release()
+		c.onClose.Release()
+	})
+}
+
+func (c *Conn) wake() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+
+	c.wake()
+
+	return nil
+}
+
+// SetWriteDeadline is a no-op, as writes to browser sockets are buffered and never block.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
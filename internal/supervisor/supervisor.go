@@ -0,0 +1,129 @@
+// Package supervisor tracks a set of goroutines sharing a context, in the manner of errgroup, such
+// that their owner may cancel all of them and wait for every one of them to exit.
+package supervisor
+
+import (
+	"context"
+	"sync"
+)
+
+// Group tracks goroutines sharing a context. The first goroutine to return an error cancels the
+// context, and its error is returned by Wait. Unlike a sync.WaitGroup, goroutines may be added to
+// a group while it is being waited on, such that goroutines spawned during shutdown are tracked.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	running int
+	err     error
+}
+
+// New returns a group whose context is derived from a parent context.
+func New(parent context.Context) *Group {
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	g := new(Group)
+	g.ctx, g.cancel = context.WithCancel(parent)
+	g.cond = sync.NewCond(&g.mu)
+
+	return g
+}
+
+// Context returns the context shared by the goroutines of the group. It is done once the group is
+// cancelled, or once a goroutine of the group returns an error.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs a function in a new goroutine tracked by the group.
+func (g *Group) Go(fn func(ctx context.Context) error) {
+	g.add()
+
+	go func() {
+		defer g.done()
+		g.fail(fn(g.ctx))
+	}()
+}
+
+// Run runs a function in the calling goroutine, tracked by the group as though it were spawned
+// through Go.
+func (g *Group) Run(fn func(ctx context.Context) error) error {
+	g.add()
+	defer g.done()
+
+	err := fn(g.ctx)
+	g.fail(err)
+
+	return err
+}
+
+// Cancel cancels the context of the group.
+func (g *Group) Cancel() {
+	g.cancel()
+}
+
+// Running returns how many goroutines of the group have yet to exit.
+func (g *Group) Running() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.running
+}
+
+// Err returns the first error returned by a goroutine of the group.
+func (g *Group) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.err
+}
+
+// Wait blocks until every goroutine of the group has exited, and returns the first error returned
+// by any of them.
+func (g *Group) Wait() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for g.running > 0 {
+		g.cond.Wait()
+	}
+
+	return g.err
+}
+
+func (g *Group) add() {
+	g.mu.Lock()
+	g.running++
+	g.mu.Unlock()
+}
+
+func (g *Group) done() {
+	g.mu.Lock()
+	g.running--
+
+	if g.running == 0 {
+		g.cond.Broadcast()
+	}
+
+	g.mu.Unlock()
+}
+
+func (g *Group) fail(err error) {
+	if err == nil {
+		return
+	}
+
+	g.mu.Lock()
+
+	if g.err == nil {
+		g.err = err
+	}
+
+	g.mu.Unlock()
+
+	g.cancel()
+}
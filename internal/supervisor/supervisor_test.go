@@ -0,0 +1,60 @@
+package supervisor
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWaitReturnsFirstError(t *testing.T) {
+	g := New(context.Background())
+
+	errFirst := errors.New("first")
+
+	g.Go(func(ctx context.Context) error {
+		return errFirst
+	})
+
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return errors.New("second")
+	})
+
+	assert.Equal(t, errFirst, g.Wait())
+	assert.Equal(t, errFirst, g.Err())
+	assert.Zero(t, g.Running())
+}
+
+func TestCancel(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	g := New(parent)
+
+	exited := make(chan struct{})
+
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+
+		// Goroutines spawned while the group is being waited on are waited on as well.
+		g.Go(func(ctx context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			close(exited)
+			return nil
+		})
+
+		return nil
+	})
+
+	assert.Equal(t, 1, g.Running())
+
+	cancel()
+
+	assert.NoError(t, g.Wait())
+
+	select {
+	case <-exited:
+	default:
+		t.Fatal("wait returned before every goroutine exited")
+	}
+}
@@ -0,0 +1,272 @@
+// Package x448 implements the X448 Diffie-Hellman function over Curve448 as specified by RFC 7748,
+// in constant time.
+//
+// Field elements are held in 16 limbs of 28 bits each, such that products of limbs and sums of those
+// products fit within 64 bits. The prime 2^448 - 2^224 - 1 has 2^448 be congruent to 2^224 + 1, such
+// that limbs beyond the 448th bit are folded back onto the 0th and 224th bit.
+package x448
+
+// Size is the size of scalars and points in bytes.
+const Size = 56
+
+const (
+	numLimbs = 16
+	limbBits = 28
+	limbMask = 1<<limbBits - 1
+
+	// a24 is (A - 2) / 4, where A = 156326 is the coefficient of the Montgomery form of Curve448.
+	a24 = 39081
+)
+
+// fieldElement is an element of GF(2^448 - 2^224 - 1), whose limbs are loosely reduced to at most
+// a couple of units beyond 28 bits.
+type fieldElement [numLimbs]uint64
+
+var (
+	// twoP is 2p in limbs, which is added before subtracting loosely reduced elements such that no
+	// limb underflows.
+	twoP = fieldElement{
+		0x1ffffffe, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe,
+		0x1ffffffc, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe,
+	}
+
+	// p is the prime in limbs.
+	p = fieldElement{
+		0xfffffff, 0xfffffff, 0xfffffff, 0xfffffff, 0xfffffff, 0xfffffff, 0xfffffff, 0xfffffff,
+		0xffffffe, 0xfffffff, 0xfffffff, 0xfffffff, 0xfffffff, 0xfffffff, 0xfffffff, 0xfffffff,
+	}
+
+	basePoint = [Size]byte{5}
+)
+
+// ScalarMult sets dst to the product scalar * point, where point is the u-coordinate of a point on
+// Curve448. Scalars are clamped as specified by RFC 7748.
+func ScalarMult(dst, scalar, point *[Size]byte) {
+	var k [Size]byte
+	copy(k[:], scalar[:])
+
+	k[0] &= 252
+	k[Size-1] |= 128
+
+	var x1, x2, z2, x3, z3 fieldElement
+
+	x1.setBytes(point[:])
+	x2[0] = 1
+	x3 = x1
+	z3[0] = 1
+
+	var swap uint64
+
+	var a, aa, b, bb, e, c, d, da, cb, t fieldElement
+
+	for i := 8*Size - 1; i >= 0; i-- {
+		bit := uint64(k[i/8]>>uint(i%8)) & 1
+
+		swap ^= bit
+		cswap(swap, &x2, &x3)
+		cswap(swap, &z2, &z3)
+		swap = bit
+
+		add(&a, &x2, &z2)
+		mul(&aa, &a, &a)
+		sub(&b, &x2, &z2)
+		mul(&bb, &b, &b)
+		sub(&e, &aa, &bb)
+		add(&c, &x3, &z3)
+		sub(&d, &x3, &z3)
+		mul(&da, &d, &a)
+		mul(&cb, &c, &b)
+
+		add(&t, &da, &cb)
+		mul(&x3, &t, &t)
+
+		sub(&t, &da, &cb)
+		mul(&t, &t, &t)
+		mul(&z3, &x1, &t)
+
+		mul(&x2, &aa, &bb)
+
+		mulSmall(&t, &e, a24)
+		add(&t, &aa, &t)
+		mul(&z2, &e, &t)
+	}
+
+	cswap(swap, &x2, &x3)
+	cswap(swap, &z2, &z3)
+
+	invert(&z2, &z2)
+	mul(&x2, &x2, &z2)
+
+	x2.bytes(dst)
+}
+
+// ScalarBaseMult sets dst to the product scalar * base, where base is the standard generator whose
+// u-coordinate is 5.
+func ScalarBaseMult(dst, scalar *[Size]byte) {
+	ScalarMult(dst, scalar, &basePoint)
+}
+
+// setBytes decodes a little-endian u-coordinate. Coordinates which are not reduced modulo p are
+// accepted, and reduced as they are operated on.
+func (z *fieldElement) setBytes(buf []byte) {
+	for i := 0; i < numLimbs; i++ {
+		offset := i * limbBits
+
+		var v uint64
+		for j := 0; j < 5 && offset/8+j < Size; j++ {
+			v |= uint64(buf[offset/8+j]) << uint(8*j)
+		}
+
+		z[i] = (v >> uint(offset%8)) & limbMask
+	}
+}
+
+// bytes encodes the fully reduced element as a little-endian u-coordinate.
+func (z *fieldElement) bytes(dst *[Size]byte) {
+	t := *z
+	freeze(&t)
+
+	for i := range dst {
+		dst[i] = 0
+	}
+
+	for i := 0; i < numLimbs; i++ {
+		offset := i * limbBits
+
+		for j := 0; j < 5 && offset/8+j < Size; j++ {
+			dst[offset/8+j] |= byte((t[i] << uint(offset%8)) >> uint(8*j))
+		}
+	}
+}
+
+// carry propagates carries between limbs, folding the carry beyond the 448th bit back onto the 0th
+// and 224th bit. Limbs are left loosely reduced.
+func carry(z *fieldElement) {
+	for pass := 0; pass < 2; pass++ {
+		for i := 0; i < numLimbs-1; i++ {
+			z[i+1] += z[i] >> limbBits
+			z[i] &= limbMask
+		}
+
+		top := z[numLimbs-1] >> limbBits
+		z[numLimbs-1] &= limbMask
+
+		z[0] += top
+		z[numLimbs/2] += top
+	}
+}
+
+// freeze fully reduces an element into its canonical form within [0, p).
+func freeze(z *fieldElement) {
+	carry(z)
+
+	// Limbs carried thrice more are all within 28 bits, such that the element is below 2^448, and
+	// so at most a single subtraction of p away from its canonical form.
+	for pass := 0; pass < 3; pass++ {
+		for i := 0; i < numLimbs-1; i++ {
+			z[i+1] += z[i] >> limbBits
+			z[i] &= limbMask
+		}
+
+		top := z[numLimbs-1] >> limbBits
+		z[numLimbs-1] &= limbMask
+
+		z[0] += top
+		z[numLimbs/2] += top
+	}
+
+	var t fieldElement
+	var borrow uint64
+
+	for i := 0; i < numLimbs; i++ {
+		v := z[i] - p[i] - borrow
+		borrow = v >> 63
+		t[i] = v & limbMask
+	}
+
+	// Keep z should subtracting p have underflowed, and t otherwise.
+	mask := borrow - 1
+
+	for i := 0; i < numLimbs; i++ {
+		z[i] = (t[i] & mask) | (z[i] &^ mask)
+	}
+}
+
+func add(z, a, b *fieldElement) {
+	for i := 0; i < numLimbs; i++ {
+		z[i] = a[i] + b[i]
+	}
+
+	carry(z)
+}
+
+func sub(z, a, b *fieldElement) {
+	for i := 0; i < numLimbs; i++ {
+		z[i] = a[i] + twoP[i] - b[i]
+	}
+
+	carry(z)
+}
+
+func mulSmall(z, a *fieldElement, s uint64) {
+	for i := 0; i < numLimbs; i++ {
+		z[i] = a[i] * s
+	}
+
+	carry(z)
+}
+
+func mul(z, a, b *fieldElement) {
+	var c [2 * numLimbs]uint64
+
+	for i := 0; i < numLimbs; i++ {
+		for j := 0; j < numLimbs; j++ {
+			c[i+j] += a[i] * b[j]
+		}
+	}
+
+	for i := 0; i < 2*numLimbs-1; i++ {
+		c[i+1] += c[i] >> limbBits
+		c[i] &= limbMask
+	}
+
+	// Fold limbs beyond the 448th bit, from the highest down, as 2^448 = 2^224 + 1 (mod p).
+	for i := 2*numLimbs - 1; i >= numLimbs; i-- {
+		c[i-numLimbs] += c[i]
+		c[i-numLimbs/2] += c[i]
+	}
+
+	copy(z[:], c[:numLimbs])
+	carry(z)
+}
+
+// invert sets z to a^(p-2), being the inverse of a should a not be zero, and zero otherwise. The
+// exponent p-2 = 2^448 - 2^224 - 3 is public, and so is walked bit by bit.
+func invert(z, a *fieldElement) {
+	var r fieldElement
+	r[0] = 1
+
+	x := *a
+
+	for i := 447; i >= 0; i-- {
+		mul(&r, &r, &r)
+
+		// p-2 has every bit set but its 224th and 1st bit.
+		if i != 224 && i != 1 {
+			mul(&r, &r, &x)
+		}
+	}
+
+	*z = r
+}
+
+// cswap swaps a and b should swap be 1, and leaves them be should swap be 0, in constant time.
+func cswap(swap uint64, a, b *fieldElement) {
+	mask := -swap
+
+	for i := 0; i < numLimbs; i++ {
+		t := mask & (a[i] ^ b[i])
+		a[i] ^= t
+		b[i] ^= t
+	}
+}
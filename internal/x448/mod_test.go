@@ -0,0 +1,179 @@
+package x448
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+	"testing/quick"
+)
+
+func decode(t *testing.T, s string) *[Size]byte {
+	buf, err := hex.DecodeString(s)
+	assert.NoError(t, err)
+
+	var out [Size]byte
+	copy(out[:], buf)
+
+	return &out
+}
+
+// TestVectors checks against the test vectors of section 5.2 of RFC 7748.
+func TestVectors(t *testing.T) {
+	vectors := []struct{ scalar, point, out string }{
+		{
+			"3d262fddf9ec8e88495266fea19a34d28882acef045104d0d1aae121700a779c984c24f8cdd78fbff44943eba368f54b29259a4f1c600ad3",
+			"06fce640fa3487bfda5f6cf2d5263f8aad88334cbd07437f020f08f9814dc031ddbdc38c19c6da2583fa5429db94ada18aa7a7fb4ef8a086",
+			"ce3e4ff95a60dc6697da1db1d85e6afbdf79b50a2412d7546d5f239fe14fbaadeb445fc66a01b0779d98223961111e21766282f73dd96b6f",
+		},
+		{
+			"203d494428b8399352665ddca42f9de8fef600908e0d461cb021f8c538345dd77c3e4806e25f46d3315c44e0a5b4371282dd2c8d5be3095f",
+			"0fbcc2f993cd56d3305b0b7d9e55d4c1a8fb5dbb52f8e9a1e9b6201b165d015894e56c4d3570bee52fe205e28a78b91cdfbde71ce8d157db",
+			"884a02576239ff7a2f2f63b2db6a9ff37047ac13568e1e30fe63c4a7ad1b3ee3a5700df34321d62077e63633c575c1c954514e99da7c179d",
+		},
+	}
+
+	for _, v := range vectors {
+		var out [Size]byte
+		ScalarMult(&out, decode(t, v.scalar), decode(t, v.point))
+
+		assert.Equal(t, v.out, hex.EncodeToString(out[:]))
+	}
+}
+
+func TestIterated(t *testing.T) {
+	k, u := basePoint, basePoint
+
+	iterate := func(n int) {
+		for i := 0; i < n; i++ {
+			var out [Size]byte
+			ScalarMult(&out, &k, &u)
+
+			u, k = k, out
+		}
+	}
+
+	iterate(1)
+	assert.Equal(t, "3f482c8a9f19b01e6c46ee9711d9dc14fd4bf67af30765c2ae2b846a4d23a8cd0db897086239492caf350b51f833868b9bc2b3bca9cf4113", hex.EncodeToString(k[:]))
+
+	iterate(999)
+	assert.Equal(t, "aa3b4749d55b9daf1e5b00288826c467274ce3ebbdd5c17b975e09d4af6c67cf10d087202db88286e2b79fceea3ec353ef54faa26e219f38", hex.EncodeToString(k[:]))
+}
+
+// TestDiffieHellman checks against the test vectors of section 6.2 of RFC 7748.
+func TestDiffieHellman(t *testing.T) {
+	alicePrivate := decode(t, "9a8f4925d1519f5775cf46b04b5800d4ee9ee8bae8bc5565d498c28dd9c9baf574a9419744897391006382a6f127ab1d9ac2d8c0a598726b")
+	bobPrivate := decode(t, "1c306a7ac2a0e2e0990b294470cba339e6453772b075811d8fad0d1d6927c120bb5ee8972b0d3e21374c9c921b09d1b0366f10b65173992d")
+
+	var alicePublic, bobPublic, aliceShared, bobShared [Size]byte
+
+	ScalarBaseMult(&alicePublic, alicePrivate)
+	ScalarBaseMult(&bobPublic, bobPrivate)
+
+	assert.Equal(t, "9b08f7cc31b7e3e67d22d5aea121074a273bd2b83de09c63faa73d2c22c5d9bbc836647241d953d40c5b12da88120d53177f80e532c41fa0", hex.EncodeToString(alicePublic[:]))
+	assert.Equal(t, "3eb7a829b0cd20f5bcfc0b599b6feccf6da4627107bdb0d4f345b43027d8b972fc3e34fb4232a13ca706dcb57aec3dae07bdc1c67bf33609", hex.EncodeToString(bobPublic[:]))
+
+	ScalarMult(&aliceShared, alicePrivate, &bobPublic)
+	ScalarMult(&bobShared, bobPrivate, &alicePublic)
+
+	assert.Equal(t, "07fff4181ac6cc95ec1c16a94a0f74d12da232ce40a77552281d282bb60c0b56fd2464c335543936521c24403085d59a449a5037514a879d", hex.EncodeToString(aliceShared[:]))
+	assert.Equal(t, aliceShared, bobShared)
+}
+
+// reference computes X448 with math/big, straight off of the pseudocode of RFC 7748.
+func reference(scalar, point *[Size]byte) [Size]byte {
+	p := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 448), new(big.Int).Lsh(big.NewInt(1), 224))
+	p.Sub(p, big.NewInt(1))
+
+	le := func(buf []byte) *big.Int {
+		be := make([]byte, len(buf))
+		for i := range buf {
+			be[len(buf)-1-i] = buf[i]
+		}
+
+		return new(big.Int).SetBytes(be)
+	}
+
+	k := *scalar
+	k[0] &= 252
+	k[Size-1] |= 128
+
+	x1 := new(big.Int).Mod(le(point[:]), p)
+	x2, z2 := big.NewInt(1), big.NewInt(0)
+	x3, z3 := new(big.Int).Set(x1), big.NewInt(1)
+
+	mod := func(x *big.Int) *big.Int { return x.Mod(x, p) }
+
+	kn := le(k[:])
+	swap := uint(0)
+
+	for i := 447; i >= 0; i-- {
+		bit := kn.Bit(i)
+
+		if swap^bit == 1 {
+			x2, x3 = x3, x2
+			z2, z3 = z3, z2
+		}
+
+		swap = bit
+
+		a := mod(new(big.Int).Add(x2, z2))
+		aa := mod(new(big.Int).Mul(a, a))
+		b := mod(new(big.Int).Sub(x2, z2))
+		bb := mod(new(big.Int).Mul(b, b))
+		e := mod(new(big.Int).Sub(aa, bb))
+		c := mod(new(big.Int).Add(x3, z3))
+		d := mod(new(big.Int).Sub(x3, z3))
+		da := mod(new(big.Int).Mul(d, a))
+		cb := mod(new(big.Int).Mul(c, b))
+
+		x3 = mod(new(big.Int).Exp(new(big.Int).Add(da, cb), big.NewInt(2), p))
+		z3 = mod(new(big.Int).Mul(x1, new(big.Int).Exp(new(big.Int).Sub(da, cb), big.NewInt(2), p)))
+		x2 = mod(new(big.Int).Mul(aa, bb))
+		z2 = mod(new(big.Int).Mul(e, new(big.Int).Add(aa, new(big.Int).Mul(big.NewInt(a24), e))))
+	}
+
+	if swap == 1 {
+		x2, z2 = x3, z3
+	}
+
+	x := mod(new(big.Int).Mul(x2, new(big.Int).Exp(z2, new(big.Int).Sub(p, big.NewInt(2)), p)))
+
+	var out [Size]byte
+
+	be := x.Bytes()
+	for i := range be {
+		out[i] = be[len(be)-1-i]
+	}
+
+	return out
+}
+
+func TestReference(t *testing.T) {
+	f := func(scalar, point [Size]byte) bool {
+		var out [Size]byte
+		ScalarMult(&out, &scalar, &point)
+
+		return out == reference(&scalar, &point)
+	}
+
+	assert.NoError(t, quick.Check(f, &quick.Config{MaxCount: 64}))
+
+	// Coordinates at and beyond p are reduced.
+	for _, s := range []string{
+		"fffffffffffffffffffffffffffffffffffffffffffffffffffffffeffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		"fefffffffffffffffffffffffffffffffffffffffffffffffffffffeffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+	} {
+		var scalar, out [Size]byte
+
+		_, err := rand.Read(scalar[:])
+		assert.NoError(t, err)
+
+		point := decode(t, s)
+		ScalarMult(&out, &scalar, point)
+
+		assert.Equal(t, reference(&scalar, point), out)
+	}
+}
@@ -0,0 +1,146 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/log"
+	"github.com/pkg/errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// keepalive keeps idle connections to a nodes peers alive, disconnects peers which have gone
+// silent, and reaps peers which have carried no messages other than heartbeats for too long.
+//
+// Any message sent to or received from a peer doubles as a heartbeat, such that busy connections
+// carry no heartbeats at all. Only once nothing has been sent to a peer for an interval is a
+// standalone heartbeat sent, which is a single zero-length frame. A single goroutine sweeps all
+// peers of a node, such that nodes with thousands of peers do not run a timer per peer.
+type keepalive struct {
+	sync.Mutex
+
+	clock clock.Clock
+
+	interval, timeout, idle time.Duration
+
+	peers  map[*Peer]struct{}
+	vetoes []OnPeerIdleCallback
+
+	stop chan struct{}
+}
+
+func newKeepalive(clock clock.Clock, interval, timeout, idle time.Duration) *keepalive {
+	return &keepalive{
+		clock:    clock,
+		interval: interval,
+		timeout:  timeout,
+		idle:     idle,
+		peers:    make(map[*Peer]struct{}),
+		stop:     make(chan struct{}),
+	}
+}
+
+func (k *keepalive) add(peer *Peer) {
+	now := k.clock.Now().UnixNano()
+
+	atomic.StoreInt64(&peer.lastSent, now)
+	atomic.StoreInt64(&peer.lastReceived, now)
+	atomic.StoreInt64(&peer.lastActive, now)
+
+	k.Lock()
+	k.peers[peer] = struct{}{}
+	k.Unlock()
+}
+
+func (k *keepalive) veto(c OnPeerIdleCallback) {
+	k.Lock()
+	k.vetoes = append(k.vetoes, c)
+	k.Unlock()
+}
+
+func (k *keepalive) run() {
+	// Peers are swept twice an interval, such that a heartbeat is sent no later than one and a half
+	// intervals after the last message sent, and four times an idle timeout.
+	period := k.interval / 2
+
+	if period <= 0 || (k.idle > 0 && k.idle/4 < period) {
+		period = k.idle / 4
+	}
+
+	ticker := k.clock.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-ticker.C():
+		}
+
+		k.sweep(k.clock.Now())
+	}
+}
+
+func (k *keepalive) sweep(now time.Time) {
+	k.Lock()
+
+	peers := make([]*Peer, 0, len(k.peers))
+
+	for peer := range k.peers {
+		if atomic.LoadUint32(&peer.killOnce) == 1 {
+			delete(k.peers, peer)
+			continue
+		}
+
+		peers = append(peers, peer)
+	}
+
+	vetoes := k.vetoes
+
+	k.Unlock()
+
+	for _, peer := range peers {
+		if k.timeout > 0 && now.Sub(time.Unix(0, atomic.LoadInt64(&peer.lastReceived))) >= k.timeout {
+			peer.onConnErrorCallbacks.RunCallbacks(peer.node, errors.Wrapf(ErrKeepaliveTimeout, "nothing received from peer for %s", k.timeout))
+			peer.DisconnectAsync()
+
+			continue
+		}
+
+		if k.idle > 0 && now.Sub(time.Unix(0, atomic.LoadInt64(&peer.lastActive))) >= k.idle {
+			if !k.keep(vetoes, peer) {
+				log.Debug().Str("address", peer.RemoteIP().String()).Msg("Disconnected a peer which was idle for too long.")
+
+				peer.DisconnectWithReason(ReasonIdle)
+				continue
+			}
+
+			atomic.StoreInt64(&peer.lastActive, now.UnixNano())
+		}
+
+		if k.interval <= 0 || now.Sub(time.Unix(0, atomic.LoadInt64(&peer.lastSent))) < k.interval {
+			continue
+		}
+
+		// A full send queue means messages are about to be sent anyway.
+		select {
+		case peer.sendQueue <- sendHandle{heartbeat: true}:
+		default:
+		}
+	}
+}
+
+// keep reports whether any callback vetoes disconnecting an idle peer.
+func (k *keepalive) keep(vetoes []OnPeerIdleCallback, peer *Peer) bool {
+	for _, veto := range vetoes {
+		if veto(peer.node, peer) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (k *keepalive) close() {
+	close(k.stop)
+}
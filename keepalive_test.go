@@ -0,0 +1,177 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeepaliveSweep(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	k := newKeepalive(fake, 1*time.Second, 0, 0)
+
+	busy, idle := newPeer(nil, nil), newPeer(nil, nil)
+
+	k.add(busy)
+	k.add(idle)
+
+	fake.Advance(2 * time.Second)
+	atomic.StoreInt64(&busy.lastSent, fake.Now().UnixNano())
+
+	// Only peers which nothing was sent to for an interval are sent a heartbeat.
+	k.sweep(fake.Now())
+
+	assert.Len(t, busy.sendQueue, 0)
+	assert.Len(t, idle.sendQueue, 1)
+	assert.True(t, (<-idle.sendQueue).heartbeat)
+
+	// Peers which were disconnected are forgotten.
+	atomic.StoreUint32(&idle.killOnce, 1)
+	k.sweep(fake.Now())
+
+	assert.Len(t, k.peers, 1)
+}
+
+func TestKeepalive(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	params := DefaultParams()
+	params.Transport = layer
+	params.KeepaliveInterval = 50 * time.Millisecond
+	params.KeepaliveTimeout = 300 * time.Millisecond
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	params.KeepaliveInterval = 0
+
+	carol, err := NewNode(params)
+	assert.NoError(t, err)
+	defer carol.Kill()
+
+	go alice.Listen()
+	go bob.Listen()
+	go carol.Listen()
+
+	errs := make(chan error, 16)
+
+	watch := func(peer *Peer) <-chan struct{} {
+		disconnected := make(chan struct{})
+
+		peer.OnConnError(func(node *Node, peer *Peer, err error) error {
+			errs <- err
+			return nil
+		})
+
+		peer.OnDisconnect(func(node *Node, peer *Peer) error {
+			close(disconnected)
+			return nil
+		})
+
+		return disconnected
+	}
+
+	bobPeer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	carolPeer, err := alice.Dial(carol.ExternalAddress())
+	assert.NoError(t, err)
+
+	bobDisconnected, carolDisconnected := watch(bobPeer), watch(carolPeer)
+
+	// Carol never sends heartbeats, and so is disconnected once she goes silent for too long.
+	select {
+	case <-carolDisconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("alice did not disconnect carol after she went silent")
+	}
+
+	assert.True(t, errors.Is(<-errs, ErrKeepaliveTimeout))
+
+	// Bob sends heartbeats while idle, and so stays connected.
+	select {
+	case <-bobDisconnected:
+		t.Fatal("alice disconnected bob, who kept sending heartbeats")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+	params.KeepaliveInterval = 50 * time.Millisecond
+	params.IdleTimeout = 300 * time.Millisecond
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	// Bob and carol send heartbeats to alice, yet never reap peers themselves.
+	params.IdleTimeout = 0
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	carol, err := NewNode(params)
+	assert.NoError(t, err)
+	defer carol.Kill()
+
+	go alice.Listen()
+	go bob.Listen()
+	go carol.Listen()
+
+	alice.OnPeerIdle(func(node *Node, peer *Peer) bool {
+		return peer.Has("keep")
+	})
+
+	watch := func(peer *Peer) <-chan struct{} {
+		disconnected := make(chan struct{})
+
+		peer.OnDisconnect(func(node *Node, peer *Peer) error {
+			close(disconnected)
+			return nil
+		})
+
+		return disconnected
+	}
+
+	bobPeer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	carolPeer, err := alice.Dial(carol.ExternalAddress())
+	assert.NoError(t, err)
+
+	carolPeer.Set("keep", true)
+
+	bobDisconnected, carolDisconnected := watch(bobPeer), watch(carolPeer)
+
+	// Heartbeats do not count as traffic, so bob is reaped once idle, unlike carol whom alice keeps.
+	select {
+	case <-bobDisconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("alice did not disconnect bob after he was idle for too long")
+	}
+
+	select {
+	case <-carolDisconnected:
+		t.Fatal("alice disconnected carol, whom she vetoed reaping")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
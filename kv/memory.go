@@ -0,0 +1,149 @@
+package kv
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+var _ Store = (*Memory)(nil)
+
+// Memory is a store which keeps all keys in memory, and so forgets them once our process exits.
+type Memory struct {
+	sync.RWMutex
+
+	entries map[string][]byte
+	closed  bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string][]byte)}
+}
+
+func (m *Memory) Get(key []byte) ([]byte, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	value, exists := m.entries[string(key)]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte(nil), value...), nil
+}
+
+func (m *Memory) Put(key, value []byte) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.entries[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *Memory) Delete(key []byte) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	delete(m.entries, string(key))
+	return nil
+}
+
+func (m *Memory) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	m.RLock()
+
+	if m.closed {
+		m.RUnlock()
+		return ErrClosed
+	}
+
+	keys := make([]string, 0, len(m.entries))
+
+	for key := range m.entries {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	values := make([][]byte, len(keys))
+
+	sort.Strings(keys)
+
+	for i, key := range keys {
+		values[i] = m.entries[key]
+	}
+
+	m.RUnlock()
+
+	for i, key := range keys {
+		if err := fn([]byte(key), values[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) Batch() Batch {
+	return &memoryBatch{store: m}
+}
+
+func (m *Memory) Close() error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.closed = true
+	m.entries = nil
+
+	return nil
+}
+
+type memoryBatch struct {
+	store *Memory
+	ops   []op
+}
+
+type op struct {
+	key, value []byte
+	delete     bool
+}
+
+func (b *memoryBatch) Put(key, value []byte) {
+	b.ops = append(b.ops, op{key: append([]byte(nil), key...), value: append([]byte(nil), value...)})
+}
+
+func (b *memoryBatch) Delete(key []byte) {
+	b.ops = append(b.ops, op{key: append([]byte(nil), key...), delete: true})
+}
+
+func (b *memoryBatch) Commit() error {
+	b.store.Lock()
+	defer b.store.Unlock()
+
+	if b.store.closed {
+		return ErrClosed
+	}
+
+	for _, op := range b.ops {
+		if op.delete {
+			delete(b.store.entries, string(op.key))
+		} else {
+			b.store.entries[string(op.key)] = op.value
+		}
+	}
+
+	b.ops = nil
+
+	return nil
+}
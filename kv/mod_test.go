@@ -0,0 +1,89 @@
+package kv
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func keys(t *testing.T, store Store, prefix string) []string {
+	var keys []string
+
+	assert.NoError(t, store.Iterate([]byte(prefix), func(key, value []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	}))
+
+	return keys
+}
+
+func TestMemory(t *testing.T) {
+	store := NewMemory()
+
+	_, err := store.Get([]byte("a"))
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	value := []byte("1")
+	assert.NoError(t, store.Put([]byte("a"), value))
+
+	// Stores do not retain values passed to them.
+	value[0] = '2'
+
+	buf, err := store.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(buf))
+
+	assert.NoError(t, store.Put([]byte("b/2"), nil))
+	assert.NoError(t, store.Put([]byte("b/1"), nil))
+	assert.NoError(t, store.Put([]byte("c"), nil))
+
+	// Keys are iterated in order.
+	assert.Equal(t, []string{"b/1", "b/2"}, keys(t, store, "b/"))
+	assert.Equal(t, []string{"a", "b/1", "b/2", "c"}, keys(t, store, ""))
+
+	// Iterating stops at the first error.
+	stop := errors.New("stop")
+	count := 0
+
+	assert.Equal(t, stop, store.Iterate(nil, func(key, value []byte) error {
+		count++
+		return stop
+	}))
+	assert.Equal(t, 1, count)
+
+	// Batches are only applied once committed.
+	batch := store.Batch()
+	batch.Delete([]byte("a"))
+	batch.Put([]byte("d"), []byte("4"))
+
+	assert.Equal(t, []string{"a", "b/1", "b/2", "c"}, keys(t, store, ""))
+	assert.NoError(t, batch.Commit())
+	assert.Equal(t, []string{"b/1", "b/2", "c", "d"}, keys(t, store, ""))
+
+	assert.NoError(t, store.Delete([]byte("a")))
+
+	assert.NoError(t, store.Close())
+	assert.True(t, errors.Is(store.Put([]byte("a"), nil), ErrClosed))
+}
+
+func TestPrefixed(t *testing.T) {
+	store := NewMemory()
+
+	alice, bob := Prefixed(store, "alice/"), Prefixed(store, "bob/")
+
+	assert.NoError(t, alice.Put([]byte("key"), []byte("alice")))
+	assert.NoError(t, bob.Put([]byte("key"), []byte("bob")))
+
+	buf, err := alice.Get([]byte("key"))
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", string(buf))
+
+	batch := bob.Batch()
+	batch.Put([]byte("other"), nil)
+	assert.NoError(t, batch.Commit())
+
+	// Views only see their own keys, without their prefix.
+	assert.Equal(t, []string{"key"}, keys(t, alice, ""))
+	assert.Equal(t, []string{"key", "other"}, keys(t, bob, ""))
+	assert.Equal(t, []string{"alice/key", "bob/key", "bob/other"}, keys(t, store, ""))
+}
@@ -0,0 +1,62 @@
+package kv
+
+var _ Store = (*prefixed)(nil)
+
+// Prefixed returns a view of a store under which every key is prefixed with a prefix, such that
+// several components may share one store without their keys colliding. Closing the view closes the
+// underlying store.
+func Prefixed(store Store, prefix string) Store {
+	return &prefixed{store: store, prefix: []byte(prefix)}
+}
+
+type prefixed struct {
+	store  Store
+	prefix []byte
+}
+
+func (p *prefixed) key(key []byte) []byte {
+	return append(append(make([]byte, 0, len(p.prefix)+len(key)), p.prefix...), key...)
+}
+
+func (p *prefixed) Get(key []byte) ([]byte, error) {
+	return p.store.Get(p.key(key))
+}
+
+func (p *prefixed) Put(key, value []byte) error {
+	return p.store.Put(p.key(key), value)
+}
+
+func (p *prefixed) Delete(key []byte) error {
+	return p.store.Delete(p.key(key))
+}
+
+func (p *prefixed) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return p.store.Iterate(p.key(prefix), func(key, value []byte) error {
+		return fn(key[len(p.prefix):], value)
+	})
+}
+
+func (p *prefixed) Batch() Batch {
+	return &prefixedBatch{view: p, batch: p.store.Batch()}
+}
+
+func (p *prefixed) Close() error {
+	return p.store.Close()
+}
+
+type prefixedBatch struct {
+	view  *prefixed
+	batch Batch
+}
+
+func (b *prefixedBatch) Put(key, value []byte) {
+	b.batch.Put(b.view.key(key), value)
+}
+
+func (b *prefixedBatch) Delete(key []byte) {
+	b.batch.Delete(b.view.key(key))
+}
+
+func (b *prefixedBatch) Commit() error {
+	return b.batch.Commit()
+}
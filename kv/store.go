@@ -0,0 +1,41 @@
+// Package kv defines the storage interface persistent components of Noise write their state
+// through, such that embedders may back them with a database of their own choosing.
+package kv
+
+import "github.com/pkg/errors"
+
+var (
+	ErrNotFound = errors.New("kv: key not found")
+	ErrClosed   = errors.New("kv: store is closed")
+)
+
+// Store is an ordered key-value store. Implementations must be safe to call from multiple
+// goroutines, and must not retain nor modify keys and values passed to them.
+type Store interface {
+	// Get returns the value of a key, or ErrNotFound should the key not exist.
+	Get(key []byte) ([]byte, error)
+
+	Put(key, value []byte) error
+
+	// Delete deletes a key. Deleting a key which does not exist is not an error.
+	Delete(key []byte) error
+
+	// Iterate calls fn with every key prefixed with a prefix in ascending order of keys, stopping
+	// at, and returning, the first error fn returns. Keys and values passed to fn may only be used
+	// until fn returns, and the store may not be written to from within fn.
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
+
+	// Batch returns a batch of writes which are applied to the store all at once upon being
+	// committed.
+	Batch() Batch
+
+	Close() error
+}
+
+// Batch is a set of writes applied to a store atomically. A batch may not be used once committed.
+type Batch interface {
+	Put(key, value []byte)
+	Delete(key []byte)
+
+	Commit() error
+}
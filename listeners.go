@@ -0,0 +1,91 @@
+package noise
+
+import (
+	"context"
+	"fmt"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// listener is a listener our node accepts peers on alongside the listener it was created with.
+type listener struct {
+	net.Listener
+
+	transport transport.Layer
+	address   string
+}
+
+type listeners struct {
+	sync.Mutex
+	list []*listener
+}
+
+// ListenOn has our node additionally listen for peers on a host and port through a transport layer,
+// and returns the address it listens on. Peers accepted on any listener share our nodes identity,
+// and are treated as though they were accepted by our nodes own listener. A zero port picks any
+// available port. Unlike the listener our node was created with, added listeners are neither
+// port-forwarded through our nodes NAT provider nor reachable at a distinct external port.
+func (n *Node) ListenOn(layer transport.Layer, host string, port uint16) (string, error) {
+	l, err := layer.Listen(host, port)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to start listening for peers through %s on port %d", layer, port)
+	}
+
+	added := &listener{
+		Listener:  l,
+		transport: layer,
+		address:   fmt.Sprintf("%s:%d", host, layer.Port(l.Addr())),
+	}
+
+	n.listeners.Lock()
+
+	if atomic.LoadUint32(&n.killOnce) == 1 {
+		n.listeners.Unlock()
+		l.Close()
+
+		return "", ErrNodeKilled
+	}
+
+	n.listeners.list = append(n.listeners.list, added)
+	n.listeners.Unlock()
+
+	n.group.Go(func(ctx context.Context) error {
+		return n.acceptFrom(ctx, added, added.transport)
+	})
+
+	return added.address, nil
+}
+
+// Addresses returns every address our node may be reached at, alongside the transport layer
+// which reaches it, starting with our nodes external address. Peers may dial the addresses through
+// DialCandidates.
+func (n *Node) Addresses() []Candidate {
+	addresses := []Candidate{{Address: n.ExternalAddress(), Transport: n.transport}}
+
+	n.listeners.Lock()
+	defer n.listeners.Unlock()
+
+	for _, l := range n.listeners.list {
+		addresses = append(addresses, Candidate{Address: l.address, Transport: l.transport})
+	}
+
+	return addresses
+}
+
+// closeListeners closes every added listener. Our node stops accepting peers on them once the
+// goroutines accepting peers on them exit.
+func (n *Node) closeListeners() {
+	n.listeners.Lock()
+
+	for _, l := range n.listeners.list {
+		if err := l.Close(); err != nil {
+			n.onListenerErrorCallbacks.RunCallbacks(err)
+		}
+	}
+
+	n.listeners.list = nil
+	n.listeners.Unlock()
+}
@@ -0,0 +1,63 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestListenOn(t *testing.T) {
+	primary, secondary := transport.NewBuffered(), transport.NewBuffered()
+
+	params := DefaultParams()
+	params.Transport = primary
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go alice.Listen()
+	go bob.Listen()
+
+	address, err := alice.ListenOn(secondary, "127.0.0.1", 0)
+	assert.NoError(t, err)
+
+	addresses := alice.Addresses()
+	assert.Len(t, addresses, 2)
+	assert.Equal(t, Candidate{Address: alice.ExternalAddress(), Transport: primary}, addresses[0])
+	assert.Equal(t, Candidate{Address: address, Transport: secondary}, addresses[1])
+
+	accepted := make(chan *Peer, 2)
+
+	alice.OnPeerConnected(func(node *Node, peer *Peer) error {
+		accepted <- peer
+		return nil
+	})
+
+	// Alice accepts peers on every address she advertises.
+	for _, candidate := range addresses {
+		peer, err := bob.DialCandidates(candidate)
+		assert.NoError(t, err)
+
+		select {
+		case <-accepted:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("alice did not accept bob on %s", candidate.Address)
+		}
+
+		peer.Disconnect()
+	}
+
+	// Added listeners are closed once alice is killed, and no more may be added.
+	alice.Kill()
+
+	assert.Len(t, alice.Addresses(), 1)
+
+	_, err = alice.ListenOn(secondary, "127.0.0.1", 0)
+	assert.True(t, errors.Is(err, ErrNodeKilled))
+}
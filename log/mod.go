@@ -6,7 +6,6 @@ import (
 	"os"
 
 	"github.com/rs/zerolog"
-	"golang.org/x/crypto/ssh/terminal"
 )
 
 var (
@@ -15,7 +14,7 @@ var (
 
 func init() {
 	// prettify if terminal is a console
-	if terminal.IsTerminal(int(os.Stdout.Fd())) {
+	if isTerminal(os.Stdout) {
 		logger = logger.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	}
 }
@@ -0,0 +1,14 @@
+//go:build !js
+// +build !js
+
+package log
+
+import (
+	"os"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func isTerminal(file *os.File) bool {
+	return terminal.IsTerminal(int(file.Fd()))
+}
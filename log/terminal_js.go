@@ -0,0 +1,11 @@
+//go:build js
+// +build js
+
+package log
+
+import "os"
+
+// isTerminal always returns false, as there is no terminal to prettify logs for within a browser.
+func isTerminal(file *os.File) bool {
+	return false
+}
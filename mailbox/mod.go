@@ -0,0 +1,546 @@
+// Package mailbox has peers hold messages for recipients who are offline, such that applications
+// may exchange messages asynchronously. Messages are sealed to the static public key of their
+// recipient, and so may not be read by the peers holding them.
+package mailbox
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/box"
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/perlin-network/noise/kv"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+const (
+	keyState = "mailbox.state"
+
+	challengeInfo = "noise mailbox retrieval"
+	challengeSize = 32
+
+	DefaultQuotaMessages = 256
+	DefaultQuotaBytes    = 1024 * 1024
+	DefaultTTL           = 24 * time.Hour
+
+	// maxBatchSize caps how many bytes of messages are delivered in a single batch, such that
+	// batches fit within the max message size of nodes.
+	maxBatchSize = 256 * 1024
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrRefused       = errors.New("mailbox: peer refused request")
+	ErrQuotaExceeded = errors.New("mailbox: quota of recipient exceeded")
+	ErrTimeout       = errors.New("mailbox: timed out waiting for peer to respond")
+)
+
+type block struct {
+	opcodeDeposit   noise.Opcode
+	opcodeReceipt   noise.Opcode
+	opcodeCollect   noise.Opcode
+	opcodeChallenge noise.Opcode
+	opcodeProof     noise.Opcode
+	opcodeMail      noise.Opcode
+
+	timeoutDuration time.Duration
+
+	hosting bool
+	store   kv.Store
+
+	quotaMessages int
+	quotaBytes    int
+	ttl           time.Duration
+}
+
+// New returns a block which deposits messages with, and retrieves messages from, peers which host
+// mailboxes. Our node does not host mailboxes for others unless WithHosting is set.
+//
+// By default, peers are waited on for 10 seconds. Hosted mailboxes are held in memory, and hold at
+// most 256 messages, or 1 MiB worth of messages, for each recipient, and messages expire 24 hours
+// after being deposited.
+func New() *block {
+	return &block{
+		timeoutDuration: 10 * time.Second,
+		store:           kv.NewMemory(),
+		quotaMessages:   DefaultQuotaMessages,
+		quotaBytes:      DefaultQuotaBytes,
+		ttl:             DefaultTTL,
+	}
+}
+
+func (b *block) TimeoutAfter(timeoutDuration time.Duration) *block {
+	b.timeoutDuration = timeoutDuration
+	return b
+}
+
+// WithHosting has our node hold messages deposited by peers for recipients, until the recipients
+// retrieve them.
+func (b *block) WithHosting() *block {
+	b.hosting = true
+	return b
+}
+
+// WithStore sets the store hosted mailboxes are held in, such that messages held for recipients
+// outlive our process. Use kv.Prefixed to share a store with other components.
+func (b *block) WithStore(store kv.Store) *block {
+	b.store = store
+	return b
+}
+
+// WithQuota sets how many messages, and how many bytes worth of sealed messages, our node holds for
+// any single recipient. Deposits beyond the quota are refused.
+func (b *block) WithQuota(messages, bytes int) *block {
+	b.quotaMessages, b.quotaBytes = messages, bytes
+	return b
+}
+
+// WithTTL sets how long our node holds a message before it expires.
+func (b *block) WithTTL(ttl time.Duration) *block {
+	b.ttl = ttl
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeDeposit = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Deposit)(nil))
+	b.opcodeReceipt = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Receipt)(nil))
+	b.opcodeCollect = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Collect)(nil))
+	b.opcodeChallenge = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Challenge)(nil))
+	b.opcodeProof = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Proof)(nil))
+	b.opcodeMail = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Mail)(nil))
+
+	s := &state{block: b, clock: node.Clock(), challenges: make(map[challengeKey]*challenge)}
+
+	if err := s.restore(); err != nil {
+		log.Warn().Err(err).Msg("Failed to restore the mailboxes held in our store.")
+	}
+
+	node.Set(keyState, s)
+
+	node.OnMessageReceived(b.opcodeDeposit, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		msg := message.(Deposit)
+		res := Receipt{Nonce: msg.Nonce}
+
+		if err := s.deposit(msg.Recipient, msg.Sealed); err != nil {
+			res.Error = err.Error()
+		}
+
+		peer.SendMessageAsync(res)
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodeCollect, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		msg := message.(Collect)
+
+		value, err := s.challenge(peer, msg)
+		if err != nil {
+			peer.SendMessageAsync(Mail{Nonce: msg.Nonce, Error: err.Error()})
+			return nil
+		}
+
+		peer.SendMessageAsync(Challenge{Nonce: msg.Nonce, Challenge: value})
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodeProof, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		peer.SendMessageAsync(s.deliver(peer, message.(Proof)))
+		return nil
+	})
+
+	for _, opcode := range []noise.Opcode{b.opcodeReceipt, b.opcodeChallenge, b.opcodeMail} {
+		node.OnMessageReceived(opcode, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+			s.resolve(message)
+			return nil
+		})
+	}
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Send seals data to the static ed25519 public key of a recipient, and deposits it with a peer
+// hosting mailboxes, such that the recipient may retrieve it from the peer later on. It returns an
+// error wrapping ErrRefused should the peer not accept the message, such as should the peer not
+// host mailboxes, or should the recipient have exceeded its quota.
+func Send(node *noise.Node, peer *noise.Peer, recipient, data []byte) error {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return errors.New("mailbox: block is not registered to the nodes protocol")
+	}
+
+	sealed, err := box.Seal(recipient, data)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+
+	res, err := s.request(peer, nonce, Deposit{Nonce: nonce, Recipient: recipient, Sealed: sealed})
+	if err != nil {
+		return err
+	}
+
+	if receipt := res.(Receipt); receipt.Error != "" {
+		return errors.Wrap(ErrRefused, receipt.Error)
+	}
+
+	return nil
+}
+
+// Retrieve proves to a peer hosting mailboxes that our node holds the private key of its mailbox,
+// and retrieves and opens every message the peer holds for our node. Messages are no longer held by
+// the peer once retrieved. Messages which fail to open are dropped.
+func Retrieve(node *noise.Node, peer *noise.Peer) ([][]byte, error) {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return nil, errors.New("mailbox: block is not registered to the nodes protocol")
+	}
+
+	if node.Keys == nil || len(node.Keys.PrivateKey()) != edwards25519.PrivateKeySize {
+		return nil, errors.New("mailbox: node has no ed25519 keys to retrieve messages with")
+	}
+
+	var messages [][]byte
+
+	for {
+		mail, err := s.retrieve(node, peer)
+		if err != nil {
+			return messages, err
+		}
+
+		for _, sealed := range mail.Sealed {
+			data, err := box.Open(node.Keys, sealed)
+			if err != nil {
+				log.Warn().Err(err).Msg("Dropped a message retrieved from a mailbox which failed to open.")
+				continue
+			}
+
+			messages = append(messages, data)
+		}
+
+		if mail.Remaining == 0 || len(mail.Sealed) == 0 {
+			return messages, nil
+		}
+	}
+}
+
+// Letters are held under the public key of their recipient followed by a big-endian sequence
+// number, such that the letters of a recipient are iterated in the order they were deposited. Their
+// value is when they expire in nanoseconds since the Unix epoch, followed by the sealed message.
+type letter struct {
+	key     []byte
+	sealed  []byte
+	expires time.Time
+}
+
+type challengeKey struct {
+	peer  *noise.Peer
+	nonce uint64
+}
+
+type challenge struct {
+	recipient []byte
+	value     []byte
+	expires   time.Time
+}
+
+type state struct {
+	block *block
+	clock clock.Clock
+
+	sync.Mutex
+
+	// sequence is the sequence number of the last letter deposited.
+	sequence uint64
+
+	// challenges holds the challenges our node issued to peers retrieving messages.
+	challenges map[challengeKey]*challenge
+
+	// pending maps nonces to requests awaiting a response.
+	pending sync.Map
+}
+
+func (s *state) deposit(recipient, sealed []byte) error {
+	if !s.block.hosting {
+		return errors.New("mailboxes are not hosted")
+	}
+
+	if !edwards25519.IsGroupElement(recipient) {
+		return box.ErrInvalidPublicKey
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	batch := s.block.store.Batch()
+
+	letters, err := s.letters(recipient, batch)
+	if err != nil {
+		return err
+	}
+
+	size := 0
+
+	for _, l := range letters {
+		size += len(l.sealed)
+	}
+
+	if len(letters)+1 > s.block.quotaMessages || size+len(sealed) > s.block.quotaBytes {
+		return errors.Wrapf(ErrQuotaExceeded, "holding %d messages worth %d bytes", len(letters), size)
+	}
+
+	s.sequence++
+
+	key := make([]byte, len(recipient)+8)
+	copy(key, recipient)
+	binary.BigEndian.PutUint64(key[len(recipient):], s.sequence)
+
+	value := make([]byte, 8+len(sealed))
+	binary.BigEndian.PutUint64(value, uint64(s.clock.Now().Add(s.block.ttl).UnixNano()))
+	copy(value[8:], sealed)
+
+	batch.Put(key, value)
+
+	return errors.Wrap(batch.Commit(), "failed to store message")
+}
+
+// challenge issues a challenge to a peer asking for the messages held for a recipient.
+func (s *state) challenge(peer *noise.Peer, msg Collect) ([]byte, error) {
+	if !s.block.hosting {
+		return nil, errors.New("mailboxes are not hosted")
+	}
+
+	if !edwards25519.IsGroupElement(msg.Recipient) {
+		return nil, box.ErrInvalidPublicKey
+	}
+
+	value := make([]byte, challengeSize)
+
+	if _, err := rand.Read(value); err != nil {
+		return nil, errors.Wrap(err, "failed to generate challenge")
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.clock.Now()
+
+	for key, c := range s.challenges {
+		if now.After(c.expires) {
+			delete(s.challenges, key)
+		}
+	}
+
+	s.challenges[challengeKey{peer: peer, nonce: msg.Nonce}] = &challenge{
+		recipient: msg.Recipient,
+		value:     value,
+		expires:   now.Add(s.block.timeoutDuration),
+	}
+
+	return value, nil
+}
+
+// deliver verifies the proof of a peer, and hands the peer a batch of the messages held for the
+// recipient it proved to be.
+func (s *state) deliver(peer *noise.Peer, proof Proof) Mail {
+	mail := Mail{Nonce: proof.Nonce}
+
+	s.Lock()
+	defer s.Unlock()
+
+	key := challengeKey{peer: peer, nonce: proof.Nonce}
+
+	c, exists := s.challenges[key]
+	delete(s.challenges, key)
+
+	if !exists || s.clock.Now().After(c.expires) {
+		mail.Error = "no challenge was issued, or it has expired"
+		return mail
+	}
+
+	if !edwards25519.Verify(c.recipient, signingPayload(c.recipient, c.value), proof.Signature) {
+		mail.Error = "signature over challenge is invalid"
+		return mail
+	}
+
+	batch := s.block.store.Batch()
+
+	letters, err := s.letters(c.recipient, batch)
+	if err != nil {
+		mail.Error = "failed to load mailbox"
+		return mail
+	}
+
+	size, n := 0, 0
+
+	for n < len(letters) && (n == 0 || size+len(letters[n].sealed) <= maxBatchSize) {
+		size += len(letters[n].sealed)
+		mail.Sealed = append(mail.Sealed, letters[n].sealed)
+		batch.Delete(letters[n].key)
+		n++
+	}
+
+	mail.Remaining = uint32(len(letters) - n)
+
+	if err := batch.Commit(); err != nil {
+		log.Warn().Err(err).Msg("Failed to delete delivered messages from our store.")
+		return Mail{Nonce: proof.Nonce, Error: "failed to load mailbox"}
+	}
+
+	return mail
+}
+
+// letters returns the letters held for a recipient in the order they were deposited, skipping the
+// letters which have expired and deleting them through a batch. It must be called with the state
+// locked.
+func (s *state) letters(recipient []byte, batch kv.Batch) ([]letter, error) {
+	now := s.clock.Now()
+
+	var letters []letter
+
+	err := s.block.store.Iterate(recipient, func(key, value []byte) error {
+		if len(key) != len(recipient)+8 || len(value) < 8 {
+			return errors.Errorf("letter %x is malformed", key)
+		}
+
+		l := letter{
+			key:     append([]byte(nil), key...),
+			sealed:  append([]byte(nil), value[8:]...),
+			expires: time.Unix(0, int64(binary.BigEndian.Uint64(value))),
+		}
+
+		if !now.Before(l.expires) {
+			batch.Delete(l.key)
+			return nil
+		}
+
+		letters = append(letters, l)
+		return nil
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load mailbox")
+	}
+
+	return letters, nil
+}
+
+// restore picks up the sequence numbers of letters from where the letters held in our store left
+// off, such that letters deposited from here on are ordered after them.
+func (s *state) restore() error {
+	return s.block.store.Iterate(nil, func(key, value []byte) error {
+		if len(key) < 8 {
+			return errors.Errorf("letter %x is malformed", key)
+		}
+
+		if sequence := binary.BigEndian.Uint64(key[len(key)-8:]); sequence > s.sequence {
+			s.sequence = sequence
+		}
+
+		return nil
+	})
+}
+
+// retrieve retrieves a single batch of messages held by a peer for our node.
+func (s *state) retrieve(node *noise.Node, peer *noise.Peer) (Mail, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return Mail{}, err
+	}
+
+	recipient := node.Keys.PublicKey()
+
+	res, err := s.request(peer, nonce, Collect{Nonce: nonce, Recipient: recipient})
+	if err != nil {
+		return Mail{}, err
+	}
+
+	if mail, refused := res.(Mail); refused {
+		return Mail{}, errors.Wrap(ErrRefused, mail.Error)
+	}
+
+	signature := edwards25519.Sign(node.Keys.PrivateKey(), signingPayload(recipient, res.(Challenge).Challenge))
+
+	res, err = s.request(peer, nonce, Proof{Nonce: nonce, Signature: signature})
+	if err != nil {
+		return Mail{}, err
+	}
+
+	mail, ok := res.(Mail)
+	if !ok {
+		return Mail{}, errors.Errorf("mailbox: peer responded to proof with %T", res)
+	}
+
+	if mail.Error != "" {
+		return Mail{}, errors.Wrap(ErrRefused, mail.Error)
+	}
+
+	return mail, nil
+}
+
+// request sends a request to a peer, and waits for the peer to respond with the same nonce.
+func (s *state) request(peer *noise.Peer, nonce uint64, req noise.Message) (noise.Message, error) {
+	result := make(chan noise.Message, 1)
+
+	s.pending.Store(nonce, result)
+	defer s.pending.Delete(nonce)
+
+	if err := peer.SendMessage(req); err != nil {
+		return nil, errors.Wrap(err, "mailbox: failed to send request")
+	}
+
+	select {
+	case res := <-result:
+		return res, nil
+	case <-s.clock.After(s.block.timeoutDuration):
+		return nil, ErrTimeout
+	}
+}
+
+func (s *state) resolve(res noise.Message) {
+	var nonce uint64
+
+	switch res := res.(type) {
+	case Receipt:
+		nonce = res.Nonce
+	case Challenge:
+		nonce = res.Nonce
+	case Mail:
+		nonce = res.Nonce
+	}
+
+	if result, ok := s.pending.Load(nonce); ok {
+		select {
+		case result.(chan noise.Message) <- res:
+		default:
+		}
+	}
+}
+
+func signingPayload(recipient, challenge []byte) []byte {
+	return append(append([]byte(challengeInfo), recipient...), challenge...)
+}
+
+func newNonce() (uint64, error) {
+	var buf [8]byte
+
+	if _, err := rand.Read(buf[:]); err != nil {
+		return 0, errors.Wrap(err, "mailbox: failed to generate nonce")
+	}
+
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
@@ -0,0 +1,171 @@
+package mailbox
+
+import (
+	"bytes"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/identity/ed25519"
+	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/perlin-network/noise/kv"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newNode(t *testing.T, layer transport.Layer, block *block) *noise.Node {
+	return newNodeWithClock(t, layer, block, nil)
+}
+
+func newNodeWithClock(t *testing.T, layer transport.Layer, block *block, clock clock.Clock) *noise.Node {
+	params := noise.DefaultParams()
+	params.Transport = layer
+	params.Keys = ed25519.RandomKeys()
+	params.Clock = clock
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	protocol.New().Register(block).Enforce(node)
+
+	go node.Listen()
+
+	return node
+}
+
+func connect(t *testing.T, from, to *noise.Node) *noise.Peer {
+	peer, err := from.Dial(to.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	return peer
+}
+
+func TestMailbox(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	alice := newNode(t, layer, New())
+	bob := newNode(t, layer, New().WithHosting().WithQuota(4, DefaultQuotaBytes))
+	carol := newNode(t, layer, New())
+
+	defer alice.Kill()
+	defer bob.Kill()
+	defer carol.Kill()
+
+	// Alice leaves messages for carol with bob while carol is offline.
+	toBob := connect(t, alice, bob)
+
+	large := bytes.Repeat([]byte{'x'}, 200*1024)
+
+	for _, data := range [][]byte{[]byte("hello"), large, large} {
+		assert.NoError(t, Send(alice, toBob, carol.Keys.PublicKey(), data))
+	}
+
+	// Peers which do not host mailboxes refuse deposits.
+	toAlice := connect(t, carol, alice)
+	assert.True(t, errors.Is(Send(carol, toAlice, bob.Keys.PublicKey(), []byte("hello")), ErrRefused))
+
+	// Alice may not retrieve carols messages, as she may not prove to hold carols keys.
+	messages, err := Retrieve(alice, toBob)
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+
+	// Carol comes online, and retrieves her messages over several batches.
+	toBob = connect(t, carol, bob)
+
+	messages, err = Retrieve(carol, toBob)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("hello"), large, large}, messages)
+
+	// Retrieved messages are no longer held.
+	messages, err = Retrieve(carol, toBob)
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+
+	// Deposits beyond the quota of a recipient are refused.
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, Send(carol, toBob, alice.Keys.PublicKey(), []byte("hello")))
+	}
+
+	err = Send(carol, toBob, alice.Keys.PublicKey(), []byte("hello"))
+	assert.True(t, errors.Is(err, ErrRefused))
+}
+
+func TestMailboxExpiry(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	fake := clock.NewFake(time.Now())
+
+	alice := newNode(t, layer, New())
+	bob := newNodeWithClock(t, layer, New().WithHosting().WithTTL(time.Hour), fake)
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	peer := connect(t, alice, bob)
+
+	assert.NoError(t, Send(alice, peer, alice.Keys.PublicKey(), []byte("hello")))
+
+	fake.Advance(2 * time.Hour)
+
+	messages, err := Retrieve(alice, peer)
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+}
+
+func TestProofRequired(t *testing.T) {
+	s := &state{block: New().WithHosting(), clock: clock.New(), challenges: make(map[challengeKey]*challenge)}
+
+	keys, forger := ed25519.RandomKeys(), ed25519.RandomKeys()
+	assert.NoError(t, s.deposit(keys.PublicKey(), []byte("sealed")))
+
+	value, err := s.challenge(nil, Collect{Nonce: 1, Recipient: keys.PublicKey()})
+	assert.NoError(t, err)
+
+	// Challenges signed by anyone but the recipient are refused, and may not be retried.
+	forged := Proof{Nonce: 1, Signature: edwards25519.Sign(forger.PrivateKey(), signingPayload(keys.PublicKey(), value))}
+	assert.NotEmpty(t, s.deliver(nil, forged).Error)
+
+	value, err = s.challenge(nil, Collect{Nonce: 2, Recipient: keys.PublicKey()})
+	assert.NoError(t, err)
+
+	mail := s.deliver(nil, Proof{Nonce: 2, Signature: edwards25519.Sign(keys.PrivateKey(), signingPayload(keys.PublicKey(), value))})
+	assert.Empty(t, mail.Error)
+	assert.Equal(t, [][]byte{[]byte("sealed")}, mail.Sealed)
+}
+
+func TestWithStore(t *testing.T) {
+	db := kv.NewMemory()
+	keys := ed25519.RandomKeys()
+
+	s := &state{block: New().WithHosting().WithStore(db), clock: clock.New(), challenges: make(map[challengeKey]*challenge)}
+	assert.NoError(t, s.deposit(keys.PublicKey(), []byte("first")))
+	assert.NoError(t, s.deposit(keys.PublicKey(), []byte("second")))
+
+	// Mailboxes outlive the state they were deposited through, and keep the order of their messages.
+	restored := &state{block: New().WithHosting().WithStore(db), clock: clock.New(), challenges: make(map[challengeKey]*challenge)}
+	assert.NoError(t, restored.restore())
+	assert.NoError(t, restored.deposit(keys.PublicKey(), []byte("third")))
+
+	value, err := restored.challenge(nil, Collect{Nonce: 1, Recipient: keys.PublicKey()})
+	assert.NoError(t, err)
+
+	mail := restored.deliver(nil, Proof{Nonce: 1, Signature: edwards25519.Sign(keys.PrivateKey(), signingPayload(keys.PublicKey(), value))})
+	assert.Empty(t, mail.Error)
+	assert.Equal(t, [][]byte{[]byte("first"), []byte("second"), []byte("third")}, mail.Sealed)
+
+	// Delivered messages are deleted from the store.
+	assert.NoError(t, db.Iterate(nil, func(key, value []byte) error {
+		t.Fatalf("message %x was still held after being delivered", key)
+		return nil
+	}))
+}
@@ -0,0 +1,206 @@
+package mailbox
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ noise.Message = (*Deposit)(nil)
+	_ noise.Message = (*Receipt)(nil)
+	_ noise.Message = (*Collect)(nil)
+	_ noise.Message = (*Challenge)(nil)
+	_ noise.Message = (*Proof)(nil)
+	_ noise.Message = (*Mail)(nil)
+)
+
+// Deposit asks a peer to hold a message sealed to a recipient until the recipient retrieves it.
+type Deposit struct {
+	Nonce     uint64
+	Recipient []byte
+	Sealed    []byte
+}
+
+func (Deposit) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Deposit
+	var err error
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read deposit nonce")
+	}
+
+	if msg.Recipient, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read deposit recipient")
+	}
+
+	if msg.Sealed, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read deposited message")
+	}
+
+	return msg, nil
+}
+
+func (m Deposit) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).WriteBytes(m.Recipient).WriteBytes(m.Sealed).Bytes()
+}
+
+// Receipt reports the outcome of a deposit. Error is empty should the message have been accepted.
+type Receipt struct {
+	Nonce uint64
+	Error string
+}
+
+func (Receipt) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Receipt
+	var err error
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read receipt nonce")
+	}
+
+	if msg.Error, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read receipt error")
+	}
+
+	return msg, nil
+}
+
+func (m Receipt) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).WriteString(m.Error).Bytes()
+}
+
+// Collect asks a peer for the messages it holds for a recipient. The peer answers with a
+// challenge, which must be signed by the recipient.
+type Collect struct {
+	Nonce     uint64
+	Recipient []byte
+}
+
+func (Collect) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Collect
+	var err error
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read collection nonce")
+	}
+
+	if msg.Recipient, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read collection recipient")
+	}
+
+	return msg, nil
+}
+
+func (m Collect) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).WriteBytes(m.Recipient).Bytes()
+}
+
+// Challenge is a random value a recipient must sign to prove it holds the private key of the
+// mailbox it asked to retrieve messages from.
+type Challenge struct {
+	Nonce     uint64
+	Challenge []byte
+}
+
+func (Challenge) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Challenge
+	var err error
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read challenge nonce")
+	}
+
+	if msg.Challenge, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read challenge")
+	}
+
+	return msg, nil
+}
+
+func (m Challenge) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).WriteBytes(m.Challenge).Bytes()
+}
+
+// Proof carries the signature of a recipient over a challenge.
+type Proof struct {
+	Nonce     uint64
+	Signature []byte
+}
+
+func (Proof) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Proof
+	var err error
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read proof nonce")
+	}
+
+	if msg.Signature, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read proof signature")
+	}
+
+	return msg, nil
+}
+
+func (m Proof) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).WriteBytes(m.Signature).Bytes()
+}
+
+// Mail carries a batch of sealed messages held for a recipient, and how many messages remain
+// held once the batch has been delivered. Error is set should retrieval have been refused.
+type Mail struct {
+	Nonce     uint64
+	Error     string
+	Sealed    [][]byte
+	Remaining uint32
+}
+
+func (Mail) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Mail
+	var err error
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read mail nonce")
+	}
+
+	if msg.Error, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read mail error")
+	}
+
+	count, err := reader.ReadUint32()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read number of messages in mail")
+	}
+
+	// Every message is prefixed with its length, so a count larger than the remaining bytes is
+	// malformed.
+	if int(count) > reader.Len()/4 {
+		return nil, errors.Errorf("mail claims to carry %d messages with only %d bytes left", count, reader.Len())
+	}
+
+	for i := uint32(0); i < count; i++ {
+		sealed, err := reader.ReadBytes()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read message in mail")
+		}
+
+		msg.Sealed = append(msg.Sealed, sealed)
+	}
+
+	if msg.Remaining, err = reader.ReadUint32(); err != nil {
+		return nil, errors.Wrap(err, "failed to read number of messages remaining")
+	}
+
+	return msg, nil
+}
+
+func (m Mail) Write() []byte {
+	writer := payload.NewWriter(nil).WriteUint64(m.Nonce).WriteString(m.Error).WriteUint32(uint32(len(m.Sealed)))
+
+	for _, sealed := range m.Sealed {
+		writer.WriteBytes(sealed)
+	}
+
+	return writer.WriteUint32(m.Remaining).Bytes()
+}
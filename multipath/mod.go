@@ -0,0 +1,310 @@
+// Package multipath maintains several connections, or paths, to the same peer, and schedules
+// messages across them such that critical peers remain reachable should any one path fail.
+package multipath
+
+import (
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	keyState = "multipath.state"
+	keyPath  = "multipath.path"
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrNoPaths = errors.New("multipath: no paths to peer")
+)
+
+// Policy decides which paths to a peer messages are sent through.
+type Policy int
+
+const (
+	// Failover sends messages through the oldest path to a peer, and only fails over to the next
+	// oldest path should sending a message fail.
+	Failover Policy = iota
+
+	// LowestLatency sends messages through the path to a peer with the lowest measured round-trip
+	// time, failing over to paths with higher round-trip times should sending a message fail.
+	LowestLatency
+
+	// Aggregate spreads messages across all paths to a peer round-robin, such that the bandwidth
+	// of all paths is aggregated. Messages sent through different paths may arrive out of order.
+	Aggregate
+)
+
+type block struct {
+	opcodeProbe      noise.Opcode
+	opcodeProbeReply noise.Opcode
+
+	policy        Policy
+	probeInterval time.Duration
+}
+
+// New returns a block which groups all peers that complete it by their ID, such that messages
+// may be sent to a peer through any one of several connections established to it. Should sending
+// a message through a path fail, the message is sent through the next path chosen by the policy.
+//
+// The block must be registered after a block which establishes peer IDs, such as S/Kademlia.
+//
+// By default, the failover policy is used, and the round-trip time of every path is measured
+// every 5 seconds.
+func New() *block {
+	return &block{policy: Failover, probeInterval: 5 * time.Second}
+}
+
+// WithPolicy sets the policy which decides which paths messages are sent through.
+func (b *block) WithPolicy(policy Policy) *block {
+	b.policy = policy
+	return b
+}
+
+// WithProbeInterval sets how often the round-trip time of every path is measured.
+func (b *block) WithProbeInterval(interval time.Duration) *block {
+	b.probeInterval = interval
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeProbe = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Probe)(nil))
+	b.opcodeProbeReply = noise.RegisterMessage(noise.NextAvailableOpcode(), (*ProbeReply)(nil))
+
+	node.Set(keyState, &state{block: b, groups: make(map[string]*group)})
+
+	node.OnMessageReceived(b.opcodeProbe, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		peer.SendMessageAsync(ProbeReply{Nonce: message.(Probe).Nonce})
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodeProbeReply, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		if path, ok := peer.Get(keyPath).(*path); ok {
+			path.replied(message.(ProbeReply).Nonce)
+		}
+
+		return nil
+	})
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	id := protocol.PeerID(peer)
+	if id == nil {
+		return errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeFailed), "multipath: peer has no ID; register a block which establishes peer IDs beforehand")
+	}
+
+	s := peer.Node().Get(keyState).(*state)
+
+	path := &path{peer: peer, stop: make(chan struct{})}
+	peer.Set(keyPath, path)
+
+	key := string(id.Hash())
+	s.add(key, path)
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		s.remove(key, path)
+		close(path.stop)
+
+		return nil
+	})
+
+	peer.Node().Go(func(ctx context.Context) error {
+		path.probe(ctx, b.probeInterval)
+		return nil
+	})
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Send sends a message to the peer with a specified ID through the paths chosen by the policy of
+// the block. It returns ErrNoPaths should our node have no paths to the peer, or the error with
+// which the message failed to be sent through the last path tried.
+func Send(node *noise.Node, id protocol.ID, message noise.Message) error {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return errors.New("multipath: block is not registered to the nodes protocol")
+	}
+
+	paths := s.schedule(string(id.Hash()))
+	if len(paths) == 0 {
+		return errors.Wrapf(ErrNoPaths, "no paths to %s", id)
+	}
+
+	var err error
+
+	for _, path := range paths {
+		if err = path.peer.SendMessage(message); err == nil {
+			return nil
+		}
+	}
+
+	return errors.Wrapf(err, "multipath: failed to send message through any of %d paths", len(paths))
+}
+
+// Paths returns all paths our node has to the peer with a specified ID, oldest first.
+func Paths(node *noise.Node, id protocol.ID) []*noise.Peer {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	g, exists := s.groups[string(id.Hash())]
+	if !exists {
+		return nil
+	}
+
+	peers := make([]*noise.Peer, 0, len(g.paths))
+	for _, path := range g.paths {
+		peers = append(peers, path.peer)
+	}
+
+	return peers
+}
+
+// RTT returns the latest measured round-trip time of a path. It returns zero should the path not
+// yet have been measured, or the peer not be a path.
+func RTT(peer *noise.Peer) time.Duration {
+	if path, ok := peer.Get(keyPath).(*path); ok {
+		return time.Duration(atomic.LoadInt64(&path.rtt))
+	}
+
+	return 0
+}
+
+type state struct {
+	sync.Mutex
+
+	block  *block
+	groups map[string]*group
+}
+
+// group holds all paths to a single peer, oldest first.
+type group struct {
+	paths []*path
+	next  uint64
+}
+
+func (s *state) add(key string, path *path) {
+	s.Lock()
+	defer s.Unlock()
+
+	g, exists := s.groups[key]
+	if !exists {
+		g = new(group)
+		s.groups[key] = g
+	}
+
+	g.paths = append(g.paths, path)
+}
+
+func (s *state) remove(key string, path *path) {
+	s.Lock()
+	defer s.Unlock()
+
+	g, exists := s.groups[key]
+	if !exists {
+		return
+	}
+
+	for i, p := range g.paths {
+		if p == path {
+			g.paths = append(g.paths[:i], g.paths[i+1:]...)
+			break
+		}
+	}
+
+	if len(g.paths) == 0 {
+		delete(s.groups, key)
+	}
+}
+
+// schedule returns all paths to a peer in the order messages should be attempted to be sent
+// through them under the policy of the block.
+func (s *state) schedule(key string) []*path {
+	s.Lock()
+	defer s.Unlock()
+
+	g, exists := s.groups[key]
+	if !exists {
+		return nil
+	}
+
+	paths := append([]*path(nil), g.paths...)
+
+	switch s.block.policy {
+	case LowestLatency:
+		// Paths not yet measured are tried last, though still in the order they were established.
+		sort.SliceStable(paths, func(i, j int) bool {
+			a, b := atomic.LoadInt64(&paths[i].rtt), atomic.LoadInt64(&paths[j].rtt)
+			return a > 0 && (b == 0 || a < b)
+		})
+	case Aggregate:
+		start := int(g.next % uint64(len(paths)))
+		g.next++
+
+		paths = append(paths[start:], paths[:start]...)
+	}
+
+	return paths
+}
+
+type path struct {
+	peer *noise.Peer
+
+	rtt int64 // time.Duration
+
+	mu     sync.Mutex
+	nonce  uint64
+	sentAt time.Time
+
+	stop chan struct{}
+}
+
+// probe periodically measures the round-trip time of a path until the path is closed.
+func (p *path) probe(ctx context.Context, interval time.Duration) {
+	ticker := p.peer.Node().Clock().NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.mu.Lock()
+		p.nonce = p.peer.Node().Random().Uint64()
+		p.sentAt = p.peer.Node().Clock().Now()
+		nonce := p.nonce
+		p.mu.Unlock()
+
+		p.peer.SendMessageAsync(Probe{Nonce: nonce})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stop:
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+func (p *path) replied(nonce uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if nonce != p.nonce || p.sentAt.IsZero() {
+		return
+	}
+
+	atomic.StoreInt64(&p.rtt, int64(p.peer.Node().Clock().Since(p.sentAt)))
+	p.sentAt = time.Time{}
+}
@@ -0,0 +1,234 @@
+package multipath
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/skademlia"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type testMsg struct {
+	text string
+}
+
+func (testMsg) Read(reader payload.Reader) (noise.Message, error) {
+	text, err := reader.ReadString()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read test message")
+	}
+
+	return testMsg{text: text}, nil
+}
+
+func (m testMsg) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.text).Bytes()
+}
+
+func newNode(t *testing.T, layer transport.Layer, policy Policy) *noise.Node {
+	params := noise.DefaultParams()
+	params.Keys = skademlia.NewKeys(1, 1)
+	params.Transport = layer
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	protocol.New().
+		Register(skademlia.New().WithC1(1).WithC2(1)).
+		Register(New().WithPolicy(policy).WithProbeInterval(10 * time.Millisecond)).
+		Enforce(node)
+
+	go node.Listen()
+
+	return node
+}
+
+// dial has alice establish a number of paths to bob.
+func dial(t *testing.T, alice, bob *noise.Node, count int) []*noise.Peer {
+	var paths []*noise.Peer
+
+	for i := 0; i < count; i++ {
+		peer, err := alice.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+		assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+		paths = append(paths, peer)
+	}
+
+	// Bob must have completed the protocol with alice over every path as well.
+	time.Sleep(50 * time.Millisecond)
+
+	return paths
+}
+
+func receive(t *testing.T, bob *noise.Node) <-chan *noise.Peer {
+	opcodeTest, err := noise.OpcodeFromMessage((*testMsg)(nil))
+	assert.NoError(t, err)
+
+	received := make(chan *noise.Peer, 16)
+
+	bob.OnMessageReceived(opcodeTest, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		received <- peer
+		return nil
+	})
+
+	return received
+}
+
+func await(t *testing.T, received <-chan *noise.Peer) *noise.Peer {
+	select {
+	case peer := <-received:
+		return peer
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not receive a message")
+	}
+
+	return nil
+}
+
+func TestFailover(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	noise.RegisterMessage(noise.NextAvailableOpcode(), (*testMsg)(nil))
+
+	layer := transport.NewBuffered()
+
+	alice, bob := newNode(t, layer, Failover), newNode(t, layer, Failover)
+	defer alice.Kill()
+	defer bob.Kill()
+
+	received := receive(t, bob)
+	paths := dial(t, alice, bob, 2)
+
+	id := protocol.NodeID(bob)
+
+	assert.Len(t, Paths(alice, id), 2)
+
+	// Messages are sent through the oldest path.
+	assert.NoError(t, Send(alice, id, testMsg{text: "first"}))
+	first := await(t, received)
+
+	assert.NoError(t, Send(alice, id, testMsg{text: "second"}))
+	assert.True(t, first == await(t, received))
+
+	// Once the oldest path is gone, messages are sent through the next path.
+	paths[0].Disconnect()
+	time.Sleep(50 * time.Millisecond)
+
+	remaining := Paths(alice, id)
+	assert.True(t, len(remaining) == 1 && remaining[0] == paths[1])
+
+	assert.NoError(t, Send(alice, id, testMsg{text: "third"}))
+	assert.True(t, first != await(t, received))
+
+	paths[1].Disconnect()
+	time.Sleep(50 * time.Millisecond)
+
+	assert.True(t, errors.Is(Send(alice, id, testMsg{text: "fourth"}), ErrNoPaths))
+}
+
+func TestAggregate(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	noise.RegisterMessage(noise.NextAvailableOpcode(), (*testMsg)(nil))
+
+	layer := transport.NewBuffered()
+
+	alice, bob := newNode(t, layer, Aggregate), newNode(t, layer, Aggregate)
+	defer alice.Kill()
+	defer bob.Kill()
+
+	received := receive(t, bob)
+	dial(t, alice, bob, 2)
+
+	id := protocol.NodeID(bob)
+
+	// Messages are spread across both paths.
+	seen := make(map[*noise.Peer]int)
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, Send(alice, id, testMsg{text: "hello"}))
+		seen[await(t, received)]++
+	}
+
+	assert.Len(t, seen, 2)
+
+	for _, count := range seen {
+		assert.Equal(t, 2, count)
+	}
+}
+
+func TestLowestLatency(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	alice, bob := newNode(t, layer, LowestLatency), newNode(t, layer, LowestLatency)
+	defer alice.Kill()
+	defer bob.Kill()
+
+	paths := dial(t, alice, bob, 2)
+
+	for _, path := range paths {
+		assert.True(t, RTT(path) > 0)
+	}
+
+	id := protocol.NodeID(bob)
+
+	scheduled := alice.Get(keyState).(*state).schedule(string(id.Hash()))
+	assert.Len(t, scheduled, 2)
+	assert.True(t, RTT(scheduled[0].peer) <= RTT(scheduled[1].peer))
+}
+
+func TestKillLeaksNothing(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	noise.RegisterMessage(noise.NextAvailableOpcode(), (*testMsg)(nil))
+
+	before := runtime.NumGoroutine()
+
+	layer := transport.NewBuffered()
+
+	alice, bob := newNode(t, layer, Failover), newNode(t, layer, Failover)
+	received := receive(t, bob)
+
+	// Messages queued up before the protocol completes are forwarded once it does, while every path
+	// is probed until our nodes are killed.
+	var results []<-chan error
+
+	for i := 0; i < 3; i++ {
+		peer, err := alice.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+
+		results = append(results, protocol.EnqueueMessage(peer, testMsg{text: "queued"}))
+	}
+
+	for _, result := range results {
+		assert.NoError(t, <-result)
+		await(t, received)
+	}
+
+	alice.Kill()
+	bob.Kill()
+
+	assert.NoError(t, alice.Wait())
+	assert.NoError(t, bob.Wait())
+
+	deadline := time.Now().Add(3 * time.Second)
+
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.True(t, runtime.NumGoroutine() <= before, "%d goroutine(s) leaked", runtime.NumGoroutine()-before)
+}
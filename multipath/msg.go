@@ -0,0 +1,49 @@
+package multipath
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ noise.Message = (*Probe)(nil)
+	_ noise.Message = (*ProbeReply)(nil)
+)
+
+// Probe asks a peer to reply over the same path, such that the round-trip time of the path may
+// be measured.
+type Probe struct {
+	Nonce uint64
+}
+
+func (Probe) Read(reader payload.Reader) (noise.Message, error) {
+	nonce, err := reader.ReadUint64()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read probe nonce")
+	}
+
+	return Probe{Nonce: nonce}, nil
+}
+
+func (m Probe) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).Bytes()
+}
+
+// ProbeReply echoes the nonce of a probe back over the path it was received on.
+type ProbeReply struct {
+	Nonce uint64
+}
+
+func (ProbeReply) Read(reader payload.Reader) (noise.Message, error) {
+	nonce, err := reader.ReadUint64()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read probe reply nonce")
+	}
+
+	return ProbeReply{Nonce: nonce}, nil
+}
+
+func (m ProbeReply) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).Bytes()
+}
@@ -0,0 +1,214 @@
+// Package mux serves several nodes, such as nodes of different networks or tenants, from a single
+// listener. Dialers prefix every connection with a token naming the node they wish to connect to,
+// which the listener routes the connection to, akin to ALPN in TLS.
+package mux
+
+import (
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/internal/supervisor"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxTokenSize is the maximum size of a token in bytes, such that its length fits in a byte.
+	MaxTokenSize = 255
+
+	DefaultTimeout = 10 * time.Second
+)
+
+var (
+	ErrUnknownToken = errors.New("mux: no node is registered for token")
+	ErrTokenTooLong = errors.New("mux: token may be at most 255 bytes")
+)
+
+// Mux accepts connections on a single listener, and routes each connection to the node registered
+// for the token the connection is prefixed with.
+type Mux struct {
+	layer    transport.Layer
+	listener net.Listener
+
+	timeoutDuration time.Duration
+
+	// group tracks the goroutines routing connections, which serve every node registered to the
+	// mux, and so are not tracked by any single node.
+	group *supervisor.Group
+
+	sync.RWMutex
+	nodes map[string]*noise.Node
+}
+
+// New returns a mux listening on a host and port through a transport layer. Nodes registered to
+// the mux should still be made to listen for peers through their own listeners, which the mux does
+// not replace, as a node may only be killed once it is listening. By default, dialers which do not send their
+// token within 10 seconds are disconnected.
+func New(layer transport.Layer, host string, port uint16) (*Mux, error) {
+	listener, err := layer.Listen(host, port)
+	if err != nil {
+		return nil, errors.Wrapf(err, "mux: failed to start listening on port %d", port)
+	}
+
+	return &Mux{
+		layer:           layer,
+		listener:        listener,
+		timeoutDuration: DefaultTimeout,
+		group:           supervisor.New(nil),
+		nodes:           make(map[string]*noise.Node),
+	}, nil
+}
+
+func (m *Mux) TimeoutAfter(timeoutDuration time.Duration) *Mux {
+	m.timeoutDuration = timeoutDuration
+	return m
+}
+
+// Addr returns the address the mux listens on.
+func (m *Mux) Addr() net.Addr {
+	return m.listener.Addr()
+}
+
+// Register routes connections prefixed with a token to a node, and has the node advertise the
+// address of the mux as its own.
+func (m *Mux) Register(token string, node *noise.Node) error {
+	if len(token) > MaxTokenSize {
+		return ErrTokenTooLong
+	}
+
+	m.Lock()
+	m.nodes[token] = node
+	m.Unlock()
+
+	node.SetExternalAddress(m.listener.Addr().String())
+
+	return nil
+}
+
+// Unregister stops routing connections prefixed with a token.
+func (m *Mux) Unregister(token string) {
+	m.Lock()
+	delete(m.nodes, token)
+	m.Unlock()
+}
+
+// Listen accepts connections until the mux is closed.
+func (m *Mux) Listen() {
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			log.Debug().Err(err).Msg("Mux stopped accepting connections.")
+			return
+		}
+
+		m.group.Go(func(ctx context.Context) error {
+			m.route(ctx, conn)
+			return nil
+		})
+	}
+}
+
+// Close stops the mux from accepting any more connections, and closes connections which have yet to
+// send their token. Connections already routed to nodes remain connected.
+func (m *Mux) Close() error {
+	err := m.listener.Close()
+
+	m.group.Cancel()
+	_ = m.group.Wait()
+
+	return err
+}
+
+func (m *Mux) route(ctx context.Context, conn net.Conn) {
+	type result struct {
+		token string
+		err   error
+	}
+
+	// Not all transports support deadlines, so the token is read in the background instead.
+	read := make(chan result, 1)
+
+	m.group.Go(func(context.Context) error {
+		token, err := readToken(conn)
+		read <- result{token: token, err: err}
+
+		return nil
+	})
+
+	var res result
+
+	select {
+	case res = <-read:
+	case <-time.After(m.timeoutDuration):
+		res.err = errors.New("mux: timed out waiting for token")
+	case <-ctx.Done():
+		res.err = errors.New("mux: closed while waiting for token")
+	}
+
+	if res.err != nil {
+		log.Debug().Err(res.err).Msg("Closed a connection which failed to send its token.")
+		_ = conn.Close()
+		return
+	}
+
+	m.RLock()
+	node, exists := m.nodes[res.token]
+	m.RUnlock()
+
+	if !exists {
+		log.Debug().Err(errors.Wrapf(ErrUnknownToken, "got token %q", res.token)).Msg("Closed a connection for an unknown node.")
+		_ = conn.Close()
+		return
+	}
+
+	if ip := m.layer.IP(conn.RemoteAddr()); node.IsBanned(ip) {
+		_ = conn.Close()
+		return
+	}
+
+	node.AcceptConn(conn)
+}
+
+// Dial dials an address a mux listens on through a transport layer, and has our node take on the
+// connection as a peer of the node registered to the mux for a token.
+func Dial(node *noise.Node, layer transport.Layer, address string, token string) (*noise.Peer, error) {
+	if len(token) > MaxTokenSize {
+		return nil, ErrTokenTooLong
+	}
+
+	if host, _, err := net.SplitHostPort(address); err == nil && node.IsBanned(net.ParseIP(host)) {
+		return nil, errors.Wrapf(noise.ErrPeerBanned, "refusing to dial %s", address)
+	}
+
+	conn, err := layer.Dial(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to peer %s", address)
+	}
+
+	if _, err := conn.Write(append([]byte{byte(len(token))}, token...)); err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "mux: failed to send token")
+	}
+
+	return node.DialConn(conn), nil
+}
+
+func readToken(conn net.Conn) (string, error) {
+	var size [1]byte
+
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return "", errors.Wrap(err, "mux: failed to read token size")
+	}
+
+	token := make([]byte, size[0])
+
+	if _, err := io.ReadFull(conn, token); err != nil {
+		return "", errors.Wrap(err, "mux: failed to read token")
+	}
+
+	return string(token), nil
+}
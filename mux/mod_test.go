@@ -0,0 +1,87 @@
+package mux
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMux(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	m, err := New(layer, params.Host, 0)
+	assert.NoError(t, err)
+
+	defer m.Close()
+	go m.Listen()
+
+	connected := make(map[string]chan struct{})
+
+	for _, token := range []string{"alice", "bob"} {
+		node, err := noise.NewNode(params)
+		assert.NoError(t, err)
+		defer node.Kill()
+		go node.Listen()
+
+		ch := make(chan struct{}, 1)
+		connected[token] = ch
+
+		node.OnPeerConnected(func(node *noise.Node, peer *noise.Peer) error {
+			ch <- struct{}{}
+			return nil
+		})
+
+		assert.NoError(t, m.Register(token, node))
+		assert.Equal(t, m.Addr().String(), node.ExternalAddress())
+	}
+
+	carol, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer carol.Kill()
+	go carol.Listen()
+
+	// Connections are routed to the node registered for the token they were dialed with.
+	for _, token := range []string{"bob", "alice"} {
+		_, err := Dial(carol, layer, m.Addr().String(), token)
+		assert.NoError(t, err)
+
+		select {
+		case <-connected[token]:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("%s was never routed a connection", token)
+		}
+	}
+
+	// Connections dialed with a token no node is registered for are closed.
+	peer, err := Dial(carol, layer, m.Addr().String(), "dave")
+	assert.NoError(t, err)
+
+	disconnected := make(chan struct{})
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the mux never closed a connection with an unknown token")
+	}
+
+	for _, ch := range connected {
+		assert.Len(t, ch, 0)
+	}
+
+	_, err = Dial(carol, layer, m.Addr().String(), string(make([]byte, MaxTokenSize+1)))
+	assert.Equal(t, ErrTokenTooLong, err)
+}
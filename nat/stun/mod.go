@@ -0,0 +1,341 @@
+// Package stun discovers the public address our node is reachable at, and classifies the NAT it is
+// behind, by querying STUN (RFC 5389) servers over UDP. Servers which support responding from an
+// alternate IP and port (RFC 5780) allow the filtering behavior of the NAT to be classified as
+// well, which decides whether hole punching is worth attempting with a peer.
+package stun
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/pkg/errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DefaultServers are queried should a client not be given any servers.
+var DefaultServers = []string{"stun.l.google.com:19302", "stun1.l.google.com:19302"}
+
+var ErrNoResponse = errors.New("stun: no server responded")
+
+// NATType is how a NAT maps and filters the UDP traffic of our node, following the classification
+// of RFC 3489.
+type NATType byte
+
+const (
+	// Unknown is reported should the NAT not have been classified.
+	Unknown NATType = iota
+
+	// Blocked is reported should UDP traffic not make it to any server.
+	Blocked
+
+	// Public is reported should servers observe us at the address our socket is bound to, such
+	// that no address translation takes place.
+	Public
+
+	// FullCone is reported should the NAT map every socket to the same public address regardless
+	// of who it sends to, and let anyone send to that address.
+	FullCone
+
+	// RestrictedCone is reported should the NAT map every socket to the same public address, yet
+	// only let through traffic from IPs the socket has sent to beforehand.
+	RestrictedCone
+
+	// PortRestrictedCone is reported should the NAT map every socket to the same public address,
+	// yet only let through traffic from the exact IPs and ports the socket has sent to beforehand.
+	// It is also reported should the servers queried not support classifying filtering behavior,
+	// as it is the most restrictive of the cone NATs.
+	PortRestrictedCone
+
+	// Symmetric is reported should the NAT map a socket to a different public address for every
+	// host it sends to, such that the address servers observe us at is of no use to peers.
+	Symmetric
+)
+
+func (t NATType) String() string {
+	switch t {
+	case Blocked:
+		return "blocked"
+	case Public:
+		return "public"
+	case FullCone:
+		return "full-cone"
+	case RestrictedCone:
+		return "restricted-cone"
+	case PortRestrictedCone:
+		return "port-restricted-cone"
+	case Symmetric:
+		return "symmetric"
+	default:
+		return "unknown"
+	}
+}
+
+// Cone reports whether a NAT maps every socket to the same public address regardless of who it
+// sends to, such that the address servers observe us at is the address peers may reach us at.
+func (t NATType) Cone() bool {
+	return t == FullCone || t == RestrictedCone || t == PortRestrictedCone
+}
+
+// CanHolePunch reports whether two peers behind NATs of the given types may reach one another by
+// sending to each others observed addresses at the same time. Symmetric NATs only punch through to
+// peers whose NATs let through traffic from any port, and neither of the two peers may be blocked.
+func CanHolePunch(ours, theirs NATType) bool {
+	switch {
+	case ours == Unknown || theirs == Unknown, ours == Blocked || theirs == Blocked:
+		return false
+	case ours == Symmetric:
+		return theirs == Public || theirs == FullCone || theirs == RestrictedCone
+	case theirs == Symmetric:
+		return ours == Public || ours == FullCone || ours == RestrictedCone
+	default:
+		return true
+	}
+}
+
+// Result is what a client learned about our node.
+type Result struct {
+	Type NATType
+
+	// Address is the address the first server to respond observed us at, and Local is the address
+	// our socket was bound to.
+	Address *net.UDPAddr
+	Local   *net.UDPAddr
+}
+
+// Client queries STUN servers.
+type Client struct {
+	servers []string
+
+	timeout time.Duration
+	retries int
+
+	localAddress string
+}
+
+// New returns a client which queries the given servers, or DefaultServers should none be given.
+//
+// By default, requests are retransmitted twice should a server not respond within 500
+// milliseconds, and requests are sent from a socket bound to an ephemeral port on every interface.
+func New(servers ...string) *Client {
+	if len(servers) == 0 {
+		servers = DefaultServers
+	}
+
+	return &Client{servers: servers, timeout: 500 * time.Millisecond, retries: 2}
+}
+
+// TimeoutAfter sets how long a server is waited on to respond to a single request.
+func (c *Client) TimeoutAfter(timeout time.Duration) *Client {
+	c.timeout = timeout
+	return c
+}
+
+// WithRetries sets how many times a request is retransmitted should a server not respond.
+func (c *Client) WithRetries(retries int) *Client {
+	c.retries = retries
+	return c
+}
+
+// WithLocalAddress sets the address the socket requests are sent from is bound to.
+func (c *Client) WithLocalAddress(address string) *Client {
+	c.localAddress = address
+	return c
+}
+
+// Discover learns the public address our node is reachable at, and classifies the NAT it is behind.
+//
+// The first server to respond is asked to respond from an alternate IP and port, and from an
+// alternate port, which classifies how the NAT filters traffic. Another server, or the alternate
+// address of the first server, is then queried from the same socket, which classifies how the NAT
+// maps traffic. Should UDP traffic not make it to any server, Blocked is reported alongside
+// ErrNoResponse.
+func (c *Client) Discover() (Result, error) {
+	conn, err := net.ListenPacket("udp", c.localAddress)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "stun: failed to bind socket")
+	}
+	defer conn.Close()
+
+	result := Result{Type: Unknown}
+	result.Local, _ = conn.LocalAddr().(*net.UDPAddr)
+
+	var (
+		server   *net.UDPAddr
+		response message
+		first    int
+	)
+
+	for i, address := range c.servers {
+		addr, err := net.ResolveUDPAddr("udp", address)
+		if err != nil {
+			log.Debug().Err(err).Str("server", address).Msg("Failed to resolve STUN server.")
+			continue
+		}
+
+		if response, err = c.roundTrip(conn, addr, 0); err == nil {
+			server, first = addr, i
+			break
+		}
+	}
+
+	if server == nil {
+		result.Type = Blocked
+		return result, ErrNoResponse
+	}
+
+	if result.Address, err = response.mappedAddress(); err != nil {
+		return result, err
+	}
+
+	other, classifiable := response.otherAddress()
+
+	if isLocal(result.Address, result.Local) {
+		result.Type = Public
+		return result, nil
+	}
+
+	// Filtering behavior may only be classified should the server respond from elsewhere.
+	filtering := PortRestrictedCone
+
+	if classifiable {
+		if _, err := c.roundTrip(conn, server, changeIP|changePort); err == nil {
+			filtering = FullCone
+		} else if _, err := c.roundTrip(conn, server, changePort); err == nil {
+			filtering = RestrictedCone
+		}
+	}
+
+	// Mapping behavior is classified by querying another host from the same socket.
+	var second *net.UDPAddr
+
+	for i, address := range c.servers {
+		if i == first {
+			continue
+		}
+
+		if addr, err := net.ResolveUDPAddr("udp", address); err == nil && !addr.IP.Equal(server.IP) {
+			second = addr
+			break
+		}
+	}
+
+	if second == nil && classifiable {
+		second = other
+	}
+
+	if second == nil {
+		// With a single server, the NAT may only be assumed to map endpoints independently.
+		result.Type = filtering
+		return result, nil
+	}
+
+	response, err = c.roundTrip(conn, second, 0)
+	if err != nil {
+		result.Type = filtering
+		return result, nil
+	}
+
+	mapped, err := response.mappedAddress()
+	if err != nil {
+		return result, err
+	}
+
+	if !mapped.IP.Equal(result.Address.IP) || mapped.Port != result.Address.Port {
+		result.Type = Symmetric
+	} else {
+		result.Type = filtering
+	}
+
+	return result, nil
+}
+
+// roundTrip sends a binding request to a server, and waits for the response carrying the same
+// transaction id from any address, as servers asked to change their IP or port respond from
+// elsewhere.
+func (c *Client) roundTrip(conn net.PacketConn, server *net.UDPAddr, change uint32) (message, error) {
+	id, err := newTransactionID()
+	if err != nil {
+		return message{}, err
+	}
+
+	req := bindingRequest(id, change).encode()
+	buf := make([]byte, 1500)
+
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if _, err := conn.WriteTo(req, server); err != nil {
+			return message{}, errors.Wrapf(err, "stun: failed to send binding request to %s", server)
+		}
+
+		deadline := time.Now().Add(c.timeout)
+
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return message{}, errors.Wrap(err, "stun: failed to set read deadline")
+		}
+
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+
+			res, err := decode(buf[:n])
+			if err != nil || res.id != id || res.typ != typeBindingResponse {
+				continue
+			}
+
+			return res, nil
+		}
+	}
+
+	return message{}, errors.Wrapf(ErrNoResponse, "stun: %s did not respond", server)
+}
+
+func isLocal(mapped, local *net.UDPAddr) bool {
+	if local == nil || mapped.Port != local.Port {
+		return false
+	}
+
+	if local.IP.Equal(mapped.IP) {
+		return true
+	}
+
+	// A socket bound to every interface is local to the mapped address should any interface hold
+	// the IP.
+	if !local.IP.IsUnspecified() {
+		return false
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(mapped.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Advertise sets the external address of our node to the public IP a result observed us at,
+// alongside the external port of our node, should our node be public or behind a cone NAT, and
+// returns the address advertised. Behind any other NAT, the external address of our node is left
+// as is, and an empty address is returned.
+//
+// The port our node listens on is assumed to be forwarded, or preserved by the NAT, as STUN only
+// observes the UDP port requests were sent from.
+func Advertise(node *noise.Node, result Result) string {
+	if result.Address == nil || !(result.Type == Public || result.Type.Cone()) {
+		return ""
+	}
+
+	address := net.JoinHostPort(result.Address.IP.String(), strconv.FormatUint(uint64(node.ExternalPort()), 10))
+	node.SetExternalAddress(address)
+
+	log.Info().Str("nat", result.Type.String()).Str("address", address).Msg("Advertising the address STUN servers observed us at.")
+
+	return address
+}
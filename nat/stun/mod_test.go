@@ -0,0 +1,253 @@
+package stun
+
+import (
+	"encoding/binary"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// server is a fake STUN server which reports a fixed mapped address, rather than the address
+// requests are observed from, such that a NAT may be simulated in front of the client.
+type server struct {
+	primary, changedIP, changedPort net.PacketConn
+
+	// mapped is the address reported to the client. Should it be nil, the address requests are
+	// observed from is reported.
+	mapped *net.UDPAddr
+
+	// classifiable has the server report its alternate address, and filtering is how a NAT in
+	// front of the client filters responses sent from the alternate IP and port of the server.
+	classifiable bool
+	filtering    NATType
+
+	silent bool
+}
+
+func listen(t *testing.T, ip string) net.PacketConn {
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(ip, "0"))
+	if err != nil {
+		t.Skipf("failed to bind udp socket on %s: %v", ip, err)
+	}
+
+	return conn
+}
+
+func newServer(t *testing.T, ip string, s *server) *server {
+	s.primary, s.changedIP, s.changedPort = listen(t, ip), listen(t, "127.0.0.3"), listen(t, ip)
+
+	go s.serve()
+
+	return s
+}
+
+func (s *server) address() string {
+	return s.primary.LocalAddr().String()
+}
+
+func (s *server) close() {
+	s.primary.Close()
+	s.changedIP.Close()
+	s.changedPort.Close()
+}
+
+func (s *server) serve() {
+	buf := make([]byte, 1500)
+
+	for {
+		n, from, err := s.primary.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		req, err := decode(buf[:n])
+		if err != nil || req.typ != typeBindingRequest || s.silent {
+			continue
+		}
+
+		var change uint32
+		if value, ok := req.get(attrChangeRequest); ok {
+			change = binary.BigEndian.Uint32(value)
+		}
+
+		respond := s.primary
+
+		switch {
+		case change&changeIP != 0:
+			if s.filtering != FullCone {
+				continue
+			}
+
+			respond = s.changedIP
+		case change&changePort != 0:
+			if s.filtering != FullCone && s.filtering != RestrictedCone {
+				continue
+			}
+
+			respond = s.changedPort
+		}
+
+		mapped := s.mapped
+		if mapped == nil {
+			mapped = from.(*net.UDPAddr)
+		}
+
+		res := message{typ: typeBindingResponse, id: req.id}
+		res.attrs = append(res.attrs, attribute{typ: attrXORMappedAddress, value: encodeAddress(mapped, true, req.id)})
+
+		if s.classifiable {
+			res.attrs = append(res.attrs, attribute{typ: attrOtherAddress, value: encodeAddress(s.changedIP.LocalAddr().(*net.UDPAddr), false, req.id)})
+		}
+
+		_, _ = respond.WriteTo(res.encode(), from)
+	}
+}
+
+func encodeAddress(addr *net.UDPAddr, xor bool, id transactionID) []byte {
+	family, ip := byte(0x01), addr.IP.To4()
+	if ip == nil {
+		family, ip = 0x02, addr.IP.To16()
+	}
+
+	value := make([]byte, 4+len(ip))
+	value[1] = family
+	copy(value[4:], ip)
+
+	port := uint16(addr.Port)
+
+	if xor {
+		var key [16]byte
+		binary.BigEndian.PutUint32(key[0:4], magicCookie)
+		copy(key[4:], id[:])
+
+		port ^= magicCookie >> 16
+
+		for i := range value[4:] {
+			value[4+i] ^= key[i]
+		}
+	}
+
+	binary.BigEndian.PutUint16(value[2:4], port)
+
+	return value
+}
+
+func client(servers ...*server) *Client {
+	addresses := make([]string, 0, len(servers))
+
+	for _, s := range servers {
+		addresses = append(addresses, s.address())
+	}
+
+	return New(addresses...).TimeoutAfter(100 * time.Millisecond).WithRetries(0).WithLocalAddress("127.0.0.1:0")
+}
+
+var translated = &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 40000}
+
+func TestAddressCodec(t *testing.T) {
+	id, err := newTransactionID()
+	assert.NoError(t, err)
+
+	for _, addr := range []*net.UDPAddr{translated, {IP: net.ParseIP("2001:db8::1"), Port: 3478}} {
+		for _, xor := range []bool{true, false} {
+			decoded, err := decodeAddress(encodeAddress(addr, xor, id), xor, id)
+			assert.NoError(t, err)
+			assert.True(t, addr.IP.Equal(decoded.IP))
+			assert.Equal(t, addr.Port, decoded.Port)
+		}
+	}
+
+	req := bindingRequest(id, changeIP|changePort)
+
+	decoded, err := decode(req.encode())
+	assert.NoError(t, err)
+	assert.Equal(t, req, decoded)
+
+	_, err = decode(req.encode()[:headerSize+2])
+	assert.Error(t, err)
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name     string
+		servers  []*server
+		expected NATType
+	}{
+		{name: "public", servers: []*server{{}}, expected: Public},
+		{name: "full cone", servers: []*server{{mapped: translated, classifiable: true, filtering: FullCone}}, expected: FullCone},
+		{name: "restricted cone", servers: []*server{{mapped: translated, classifiable: true, filtering: RestrictedCone}}, expected: RestrictedCone},
+		{name: "port restricted cone", servers: []*server{{mapped: translated, classifiable: true, filtering: PortRestrictedCone}}, expected: PortRestrictedCone},
+		{name: "unclassifiable", servers: []*server{{mapped: translated}}, expected: PortRestrictedCone},
+		{name: "symmetric", servers: []*server{
+			{mapped: translated},
+			{mapped: &net.UDPAddr{IP: translated.IP, Port: translated.Port + 1}},
+		}, expected: Symmetric},
+		{name: "first server silent", servers: []*server{{silent: true}, {mapped: translated}}, expected: PortRestrictedCone},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ips := []string{"127.0.0.1", "127.0.0.2"}
+
+			for i, s := range test.servers {
+				newServer(t, ips[i], s)
+				defer s.close()
+			}
+
+			result, err := client(test.servers...).Discover()
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, result.Type, "got %s", result.Type)
+
+			if test.expected != Public {
+				assert.True(t, translated.IP.Equal(result.Address.IP))
+			}
+		})
+	}
+}
+
+func TestDiscoverBlocked(t *testing.T) {
+	s := newServer(t, "127.0.0.1", &server{silent: true})
+	defer s.close()
+
+	result, err := client(s).Discover()
+	assert.True(t, errors.Is(err, ErrNoResponse))
+	assert.Equal(t, Blocked, result.Type)
+}
+
+func TestCanHolePunch(t *testing.T) {
+	assert.True(t, CanHolePunch(FullCone, PortRestrictedCone))
+	assert.True(t, CanHolePunch(PortRestrictedCone, PortRestrictedCone))
+	assert.True(t, CanHolePunch(Symmetric, RestrictedCone))
+	assert.False(t, CanHolePunch(Symmetric, PortRestrictedCone))
+	assert.False(t, CanHolePunch(PortRestrictedCone, Symmetric))
+	assert.False(t, CanHolePunch(Symmetric, Symmetric))
+	assert.False(t, CanHolePunch(Blocked, Public))
+	assert.False(t, CanHolePunch(Unknown, Public))
+}
+
+func TestAdvertise(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer node.Kill()
+
+	original := node.ExternalAddress()
+
+	assert.Empty(t, Advertise(node, Result{Type: Symmetric, Address: translated}))
+	assert.Equal(t, original, node.ExternalAddress())
+
+	address := Advertise(node, Result{Type: FullCone, Address: translated})
+	assert.Equal(t, net.JoinHostPort(translated.IP.String(), strconv.FormatUint(uint64(node.ExternalPort()), 10)), address)
+	assert.Equal(t, address, node.ExternalAddress())
+}
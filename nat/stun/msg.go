@@ -0,0 +1,212 @@
+package stun
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"net"
+)
+
+// magicCookie is fixed by RFC 5389, and sets STUN messages apart from those of RFC 3489.
+const magicCookie = 0x2112A442
+
+const headerSize = 20
+
+const (
+	typeBindingRequest  uint16 = 0x0001
+	typeBindingResponse uint16 = 0x0101
+)
+
+const (
+	attrMappedAddress    uint16 = 0x0001
+	attrChangeRequest    uint16 = 0x0003
+	attrChangedAddress   uint16 = 0x0005
+	attrXORMappedAddress uint16 = 0x0020
+	attrOtherAddress     uint16 = 0x802C
+)
+
+// Flags of a CHANGE-REQUEST attribute, which ask a server to respond from another IP or port.
+const (
+	changeIP   uint32 = 0x04
+	changePort uint32 = 0x02
+)
+
+var ErrMalformed = errors.New("stun: malformed message")
+
+type transactionID [12]byte
+
+func newTransactionID() (transactionID, error) {
+	var id transactionID
+
+	if _, err := rand.Read(id[:]); err != nil {
+		return id, errors.Wrap(err, "stun: failed to generate transaction id")
+	}
+
+	return id, nil
+}
+
+// message is a STUN message. Integers are big-endian, as STUN mandates.
+type message struct {
+	typ   uint16
+	id    transactionID
+	attrs []attribute
+}
+
+type attribute struct {
+	typ   uint16
+	value []byte
+}
+
+// bindingRequest returns a binding request, optionally asking the server to respond from another
+// IP or port.
+func bindingRequest(id transactionID, change uint32) message {
+	m := message{typ: typeBindingRequest, id: id}
+
+	if change != 0 {
+		value := make([]byte, 4)
+		binary.BigEndian.PutUint32(value, change)
+
+		m.attrs = append(m.attrs, attribute{typ: attrChangeRequest, value: value})
+	}
+
+	return m
+}
+
+func (m message) encode() []byte {
+	var body bytes.Buffer
+
+	for _, attr := range m.attrs {
+		var header [4]byte
+		binary.BigEndian.PutUint16(header[0:2], attr.typ)
+		binary.BigEndian.PutUint16(header[2:4], uint16(len(attr.value)))
+
+		body.Write(header[:])
+		body.Write(attr.value)
+
+		// Attributes are padded to a multiple of 4 bytes.
+		if pad := len(attr.value) % 4; pad != 0 {
+			body.Write(make([]byte, 4-pad))
+		}
+	}
+
+	buf := make([]byte, headerSize, headerSize+body.Len())
+	binary.BigEndian.PutUint16(buf[0:2], m.typ)
+	binary.BigEndian.PutUint16(buf[2:4], uint16(body.Len()))
+	binary.BigEndian.PutUint32(buf[4:8], magicCookie)
+	copy(buf[8:20], m.id[:])
+
+	return append(buf, body.Bytes()...)
+}
+
+func decode(buf []byte) (message, error) {
+	var m message
+
+	if len(buf) < headerSize || buf[0]&0xC0 != 0 || binary.BigEndian.Uint32(buf[4:8]) != magicCookie {
+		return m, ErrMalformed
+	}
+
+	m.typ = binary.BigEndian.Uint16(buf[0:2])
+	copy(m.id[:], buf[8:20])
+
+	size := int(binary.BigEndian.Uint16(buf[2:4]))
+	if size%4 != 0 || len(buf)-headerSize < size {
+		return m, ErrMalformed
+	}
+
+	body := buf[headerSize : headerSize+size]
+
+	for len(body) > 0 {
+		if len(body) < 4 {
+			return m, ErrMalformed
+		}
+
+		typ, length := binary.BigEndian.Uint16(body[0:2]), int(binary.BigEndian.Uint16(body[2:4]))
+		padded := (length + 3) &^ 3
+
+		if len(body)-4 < padded {
+			return m, ErrMalformed
+		}
+
+		m.attrs = append(m.attrs, attribute{typ: typ, value: body[4 : 4+length]})
+		body = body[4+padded:]
+	}
+
+	return m, nil
+}
+
+func (m message) get(typ uint16) ([]byte, bool) {
+	for _, attr := range m.attrs {
+		if attr.typ == typ {
+			return attr.value, true
+		}
+	}
+
+	return nil, false
+}
+
+// mappedAddress returns the address the server observed the request from, preferring the
+// XOR-MAPPED-ADDRESS attribute over the MAPPED-ADDRESS attribute of older servers.
+func (m message) mappedAddress() (*net.UDPAddr, error) {
+	if value, ok := m.get(attrXORMappedAddress); ok {
+		return decodeAddress(value, true, m.id)
+	}
+
+	if value, ok := m.get(attrMappedAddress); ok {
+		return decodeAddress(value, false, m.id)
+	}
+
+	return nil, errors.Wrap(ErrMalformed, "stun: response carries no mapped address")
+}
+
+// otherAddress returns the alternate address of the server, should it support responding from
+// another IP and port.
+func (m message) otherAddress() (*net.UDPAddr, bool) {
+	for _, typ := range []uint16{attrOtherAddress, attrChangedAddress} {
+		if value, ok := m.get(typ); ok {
+			if addr, err := decodeAddress(value, false, m.id); err == nil {
+				return addr, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func decodeAddress(value []byte, xor bool, id transactionID) (*net.UDPAddr, error) {
+	if len(value) < 4 {
+		return nil, ErrMalformed
+	}
+
+	var size int
+
+	switch value[1] {
+	case 0x01:
+		size = net.IPv4len
+	case 0x02:
+		size = net.IPv6len
+	default:
+		return nil, errors.Wrapf(ErrMalformed, "stun: unknown address family %d", value[1])
+	}
+
+	if len(value) != 4+size {
+		return nil, ErrMalformed
+	}
+
+	port := binary.BigEndian.Uint16(value[2:4])
+	ip := append(net.IP(nil), value[4:]...)
+
+	if xor {
+		var key [16]byte
+		binary.BigEndian.PutUint32(key[0:4], magicCookie)
+		copy(key[4:], id[:])
+
+		port ^= magicCookie >> 16
+
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+
+	return &net.UDPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -1,11 +1,17 @@
 package noise
 
 import (
+	"context"
 	"fmt"
 	"github.com/perlin-network/noise/callbacks"
+	"github.com/perlin-network/noise/clock"
 	"github.com/perlin-network/noise/identity"
+	"github.com/perlin-network/noise/internal/supervisor"
+	"github.com/perlin-network/noise/kv"
 	"github.com/perlin-network/noise/log"
 	"github.com/perlin-network/noise/nat"
+	"github.com/perlin-network/noise/random"
+	"github.com/perlin-network/noise/resource"
 	"github.com/perlin-network/noise/transport"
 	"github.com/pkg/errors"
 	"net"
@@ -24,6 +30,8 @@ type Node struct {
 	host                       string
 	internalPort, externalPort uint16
 
+	listeners listeners
+
 	maxMessageSize uint64
 
 	sendMessageTimeout    time.Duration
@@ -31,14 +39,65 @@ type Node struct {
 
 	sendWorkerBusyTimeout time.Duration
 
+	scheduler *sendScheduler
+	keepalive *keepalive
+
+	messageHandlerTimeout    time.Duration
+	disconnectOnHandlerPanic bool
+
+	// profiling holds which of pprof labels and execution trace regions callbacks handling messages
+	// run under. Refer to `LabelHandlers()` and `TraceHandlers()`.
+	profiling uint32
+
+	coalesceDelay time.Duration
+	coalesceSize  int
+
+	// framePreamble is set should peers our node dials be sent a preamble to negotiate frame formats
+	// with, and frameFlags holds the optional features of the frame format our node supports.
+	framePreamble bool
+	frameFlags    FrameFlags
+
 	onListenerErrorCallbacks *callbacks.SequentialCallbackManager
 	onPeerConnectedCallbacks *callbacks.SequentialCallbackManager
 	onPeerDialedCallbacks    *callbacks.SequentialCallbackManager
 	onPeerInitCallbacks      *callbacks.SequentialCallbackManager
+	onBanCallbacks           *callbacks.SequentialCallbackManager
+
+	onMessageReceivedCallbacks sync.Map // map[Opcode]*callbacks.SequentialCallbackManager
+	onMessageHandlerTimeout    *callbacks.SequentialCallbackManager
+
+	messageHandlerTimeouts     sync.Map // map[Opcode]time.Duration
+	messageHandlerTimeoutCount sync.Map // map[Opcode]*uint64
+
+	messageClasses sync.Map // map[Opcode]MessageClass
+
+	handlerShards int
+	shardKeys     sync.Map // map[Opcode]ShardKey
+	shardsOnce    sync.Once
+	shards        []chan func()
 
 	metadata sync.Map
 
-	kill     chan chan struct{}
+	bans  sync.Map // map[string]time.Time
+	store kv.Store
+
+	resources *resource.Manager
+	fds       *fdBudget
+	clock     clock.Clock
+	random    random.Source
+
+	stateSections sync.Map // map[string]stateSection
+
+	dialStats   sync.Map // map[string]*dialStats
+	dialStagger int64    // time.Duration
+
+	// advertised overrides the address reported by ExternalAddress should it be set.
+	advertised atomic.Value // string
+
+	// group tracks every goroutine spawned by our node, and peers holds every peer our node has
+	// yet to disconnect from, such that both may be stopped once our node is killed.
+	group    *supervisor.Group
+	peers    peerSet
 	killOnce uint32
 }
 
@@ -76,12 +135,50 @@ func NewNode(params parameters) (*Node, error) {
 
 		sendWorkerBusyTimeout: params.SendWorkerBusyTimeout,
 
+		messageHandlerTimeout:    params.MessageHandlerTimeout,
+		disconnectOnHandlerPanic: params.DisconnectOnHandlerPanic,
+
+		framePreamble: params.FramePreamble,
+		frameFlags:    FrameExtensions,
+
+		coalesceDelay: params.CoalesceDelay,
+		coalesceSize:  params.CoalesceSize,
+
+		handlerShards: params.HandlerShards,
+
 		onListenerErrorCallbacks: callbacks.NewSequentialCallbackManager(),
 		onPeerConnectedCallbacks: callbacks.NewSequentialCallbackManager(),
 		onPeerDialedCallbacks:    callbacks.NewSequentialCallbackManager(),
 		onPeerInitCallbacks:      callbacks.NewSequentialCallbackManager(),
+		onBanCallbacks:           callbacks.NewSequentialCallbackManager(),
+
+		onMessageHandlerTimeout: callbacks.NewSequentialCallbackManager(),
+
+		dialStagger: int64(DefaultDialStagger),
+
+		store:     params.Store,
+		resources: params.Resources,
+		fds:       newFDBudget(params.FileDescriptors, params.DialHeadroom),
+		clock:     params.Clock,
+		random:    params.Random,
+
+		group: supervisor.New(params.Context),
+	}
+
+	if node.resources == nil {
+		node.resources = resource.NewManager(resource.Limits{})
+	}
+
+	if node.clock == nil {
+		node.clock = clock.New()
+	}
+
+	if node.random == nil {
+		node.random = random.New()
+	}
 
-		kill: make(chan chan struct{}, 1),
+	if node.coalesceSize <= 0 {
+		node.coalesceSize = DefaultCoalesceSize
 	}
 
 	if params.ExternalPort > 0 {
@@ -94,6 +191,11 @@ func NewNode(params parameters) (*Node, error) {
 		node.Set(key, val)
 	}
 
+	if err := node.loadBans(); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
 	if node.nat != nil {
 		err = node.nat.AddMapping(node.transport.String(), node.internalPort, node.externalPort, 1*time.Hour)
 		if err != nil {
@@ -101,6 +203,29 @@ func NewNode(params parameters) (*Node, error) {
 		}
 	}
 
+	if params.MaxUploadRate > 0 {
+		node.scheduler = newSendScheduler(params.MaxUploadRate, node.clock)
+
+		node.group.Go(func(ctx context.Context) error {
+			node.scheduler.run()
+			return nil
+		})
+	}
+
+	if params.KeepaliveInterval > 0 || params.IdleTimeout > 0 {
+		node.keepalive = newKeepalive(node.clock, params.KeepaliveInterval, params.KeepaliveTimeout, params.IdleTimeout)
+
+		node.group.Go(func(ctx context.Context) error {
+			node.keepalive.run()
+			return nil
+		})
+	}
+
+	node.group.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return node.shutdown()
+	})
+
 	return &node, nil
 }
 
@@ -112,50 +237,138 @@ func (n *Node) ExternalPort() uint16 {
 	return n.externalPort
 }
 
-// Listen makes our node start listening for peers.
+// Listen makes our node start listening for peers, and blocks until our node is killed. Should our
+// nodes listener fail for reasons other than being temporarily unable to accept peers, such as
+// having run out of file descriptors, our node is killed, and the error is returned by Wait.
 func (n *Node) Listen() {
-	for {
-		select {
-		case signal := <-n.kill:
-			close(signal)
-			return
-		default:
-		}
+	_ = n.group.Run(func(ctx context.Context) error {
+		return n.acceptFrom(ctx, n.listener, n.transport)
+	})
+}
+
+// acceptFrom accepts peers on a listener until our node is killed, or until the listener fails.
+// Temporary errors are retried with an exponential backoff.
+func (n *Node) acceptFrom(ctx context.Context, l net.Listener, layer transport.Layer) error {
+	var backoff time.Duration
 
-		conn, err := n.listener.Accept()
+	for {
+		conn, err := l.Accept()
 
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
 			n.onListenerErrorCallbacks.RunCallbacks(err)
+
+			if !isTemporary(err) {
+				return errors.Wrapf(err, "failed to accept peers through %s", layer)
+			}
+
+			if backoff *= 2; backoff == 0 {
+				backoff = 5 * time.Millisecond
+			} else if backoff > time.Second {
+				backoff = time.Second
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-n.clock.After(backoff):
+			}
+
 			continue
 		}
 
-		peer := newPeer(n, conn)
-		peer.init()
+		backoff = 0
+		n.accept(layer, conn)
+	}
+}
 
-		if errs := n.onPeerConnectedCallbacks.RunCallbacks(peer); len(errs) > 0 {
-			log.Warn().Errs("errors", errs).Msg("Got errors running OnPeerConnected callbacks.")
-		}
+func isTemporary(err error) bool {
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
 
-		if errs := n.onPeerInitCallbacks.RunCallbacks(peer); len(errs) > 0 {
-			log.Warn().Errs("errors", errs).Msg("Got errors running OnPeerInit callbacks.")
-		}
+// accept takes on a connection accepted by one of our nodes listeners, should the IP it was
+// accepted from not be banned.
+func (n *Node) accept(layer transport.Layer, conn net.Conn) {
+	ip := layer.IP(conn.RemoteAddr())
 
+	if n.IsBanned(ip) {
+		conn.Close()
+		n.onListenerErrorCallbacks.RunCallbacks(RefusedError{IP: ip, err: errors.Wrapf(ErrPeerBanned, "refused connection from %s", ip)})
+		return
 	}
+
+	if !n.fds.mayAccept() {
+		conn.Close()
+		n.onListenerErrorCallbacks.RunCallbacks(RefusedError{IP: ip, err: errors.Wrapf(ErrOutOfFileDescriptors, "refused connection from %s", conn.RemoteAddr())})
+		return
+	}
+
+	n.AcceptConn(conn)
+}
+
+// AcceptConn has our node take on a connection established by a peer through means other than
+// our nodes transport layer, such as a connection negotiated through a relay. The peer is treated
+// as though it were accepted by our nodes listener.
+func (n *Node) AcceptConn(conn net.Conn) *Peer {
+	peer := newPeer(n, conn)
+	peer.init()
+
+	if errs := n.onPeerConnectedCallbacks.RunCallbacks(peer); len(errs) > 0 {
+		log.Warn().Errs("errors", errs).Msg("Got errors running OnPeerConnected callbacks.")
+	}
+
+	if errs := n.onPeerInitCallbacks.RunCallbacks(peer); len(errs) > 0 {
+		log.Warn().Errs("errors", errs).Msg("Got errors running OnPeerInit callbacks.")
+	}
+
+	return peer
 }
 
 // Dial has our node attempt to dial and establish a connection with a remote peer.
 func (n *Node) Dial(address string) (*Peer, error) {
-	if n.ExternalAddress() == address {
-		return nil, errors.New("noise: node attempted to dial itself")
+	if err := n.checkDial(address); err != nil {
+		return nil, err
 	}
 
 	conn, err := n.transport.Dial(address)
 
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to connect to peer %s", conn)
+		return nil, errors.Wrapf(err, "failed to connect to peer %s", address)
+	}
+
+	return n.DialConn(conn), nil
+}
+
+// checkDial returns an error should our node refuse to dial an address.
+func (n *Node) checkDial(address string) error {
+	if atomic.LoadUint32(&n.killOnce) == 1 {
+		return ErrNodeKilled
+	}
+
+	if n.ExternalAddress() == address {
+		return ErrDialSelf
+	}
+
+	if host, _, err := net.SplitHostPort(address); err == nil && n.IsBanned(net.ParseIP(host)) {
+		return errors.Wrapf(ErrPeerBanned, "refusing to dial %s", address)
+	}
+
+	if !n.fds.mayDial() {
+		return errors.Wrapf(ErrOutOfFileDescriptors, "refusing to dial %s", address)
 	}
 
+	return nil
+}
+
+// DialConn has our node take on a connection our node established to a peer through means
+// other than our nodes transport layer. The peer is treated as though it were dialed by our node.
+func (n *Node) DialConn(conn net.Conn) *Peer {
 	peer := newPeer(n, conn)
+	peer.dialed = true
 	peer.init()
 
 	if errs := n.onPeerDialedCallbacks.RunCallbacks(peer); len(errs) > 0 {
@@ -166,7 +379,7 @@ func (n *Node) Dial(address string) (*Peer, error) {
 		log.Error().Errs("errors", errs).Msg("Got errors running OnPeerInit callbacks.")
 	}
 
-	return peer, nil
+	return peer
 }
 
 // OnListenerError registers a callback for whenever our nodes listener fails to accept an incoming peer.
@@ -210,6 +423,16 @@ func (n *Node) OnPeerDisconnected(srcCallbacks ...OnPeerDisconnectCallback) {
 	})
 }
 
+// OnPeerIdle registers a callback consulted before a peer which has been idle for longer than the
+// idle timeout of our node is disconnected, such that protocols may keep peers they rely on, such
+// as peers within a routing table, connected. Should any callback return true, the peer is kept
+// connected, and is only consulted on again once it has been idle for another idle timeout.
+func (n *Node) OnPeerIdle(c OnPeerIdleCallback) {
+	if n.keepalive != nil {
+		n.keepalive.veto(c)
+	}
+}
+
 // OnPeerDialed registers a callback for whenever a peer has been successfully dialed.
 func (n *Node) OnPeerDialed(c OnPeerInitCallback) {
 	n.onPeerDialedCallbacks.RegisterCallback(func(params ...interface{}) error {
@@ -243,6 +466,137 @@ func (n *Node) OnPeerInit(srcCallbacks ...OnPeerInitCallback) {
 	n.onPeerInitCallbacks.RegisterCallback(targetCallbacks...)
 }
 
+// OnMessageReceived registers a callback for whenever any peer of our node sends us a message
+// with a specified opcode. Callbacks are run sequentially in the order messages are received
+// from each peer.
+//
+// Once a callback is registered for an opcode, messages with said opcode are no longer delivered
+// through `peer.Receive(opcode)`.
+//
+// Should a callback return an error, the error is reported to the peers `OnConnError` callbacks and
+// the callback remains registered for all peers. Only returning `callbacks.Deregister` deregisters it.
+//
+// Should a callback panic, the panic is recovered, logged, and reported to the peers `OnConnError`
+// callbacks. The peer is disconnected as well, unless `params.DisconnectOnHandlerPanic` is false.
+func (n *Node) OnMessageReceived(opcode Opcode, srcCallbacks ...OnMessageReceivedCallback) {
+	targetCallbacks := make([]OnMessageReceivedContextCallback, 0, len(srcCallbacks))
+
+	for _, c := range srcCallbacks {
+		c := c
+		targetCallbacks = append(targetCallbacks, func(ctx context.Context, node *Node, opcode Opcode, peer *Peer, message Message) error {
+			return c(node, opcode, peer, message)
+		})
+	}
+
+	n.OnMessageReceivedContext(opcode, targetCallbacks...)
+}
+
+// OnMessageReceivedContext registers a callback for whenever any peer of our node sends us a message
+// with a specified opcode, which is additionally provided a context.
+//
+// Should a timeout be set for the opcode, the context is cancelled once callbacks have been running
+// for longer than the timeout. Refer to `SetMessageHandlerTimeout(opcode Opcode, timeout time.Duration)`.
+//
+// Apart from being provided a context, callbacks registered here behave exactly like callbacks
+// registered through `OnMessageReceived`.
+func (n *Node) OnMessageReceivedContext(opcode Opcode, srcCallbacks ...OnMessageReceivedContextCallback) {
+	targetCallbacks := make([]callbacks.Callback, 0, len(srcCallbacks))
+
+	for _, c := range srcCallbacks {
+		c := c
+		targetCallbacks = append(targetCallbacks, func(params ...interface{}) error {
+			if len(params) != 3 {
+				panic(errors.Errorf("noise: OnMessageReceived received unexpected args %v", params))
+			}
+
+			peer := params[1].(*Peer)
+
+			// Callbacks are shared amongst all peers, so an error handling one peers message must not
+			// deregister the callback for every other peer.
+			if err := c(params[0].(context.Context), n, opcode, peer, params[2].(Message)); err != nil {
+				if err == callbacks.Deregister {
+					return err
+				}
+
+				peer.onConnErrorCallbacks.RunCallbacks(n, errors.Wrapf(err, "got an error running an OnMessageReceived callback for opcode %d", opcode))
+			}
+
+			return nil
+		})
+	}
+
+	manager, _ := n.onMessageReceivedCallbacks.LoadOrStore(opcode, callbacks.NewSequentialCallbackManager())
+	manager.(*callbacks.SequentialCallbackManager).RegisterCallback(targetCallbacks...)
+}
+
+// SetMessageHandlerTimeout sets how long callbacks handling messages of a specified opcode may run
+// for, overriding `params.MessageHandlerTimeout`. A timeout of zero disables the timeout.
+//
+// Once the timeout elapses, the callbacks context is cancelled, `OnMessageHandlerTimeout` callbacks
+// are run, and an error matching ErrHandlerTimeout is reported to the peers `OnConnError`
+// callbacks. The next message received from the peer is only dispatched once the slow callbacks
+// return, so callbacks should return promptly once their context is cancelled.
+func (n *Node) SetMessageHandlerTimeout(opcode Opcode, timeout time.Duration) {
+	n.messageHandlerTimeouts.Store(opcode, timeout)
+}
+
+// MessageHandlerTimeouts returns the number of times callbacks handling messages of a specified
+// opcode have exceeded their timeout.
+func (n *Node) MessageHandlerTimeouts(opcode Opcode) uint64 {
+	count, exists := n.messageHandlerTimeoutCount.Load(opcode)
+	if !exists {
+		return 0
+	}
+
+	return atomic.LoadUint64(count.(*uint64))
+}
+
+// OnMessageHandlerTimeout registers a callback for whenever callbacks handling a message received
+// from a peer exceed their timeout.
+func (n *Node) OnMessageHandlerTimeout(c OnMessageHandlerTimeoutCallback) {
+	n.onMessageHandlerTimeout.RegisterCallback(func(params ...interface{}) error {
+		if len(params) != 3 {
+			panic(errors.Errorf("noise: OnMessageHandlerTimeout received unexpected args %v", params))
+		}
+
+		return c(n, params[0].(Opcode), params[1].(*Peer), params[2].(time.Duration))
+	})
+}
+
+func (n *Node) messageHandlerTimeoutFor(opcode Opcode) time.Duration {
+	if timeout, exists := n.messageHandlerTimeouts.Load(opcode); exists {
+		return timeout.(time.Duration)
+	}
+
+	return n.messageHandlerTimeout
+}
+
+func (n *Node) reportMessageHandlerTimeout(opcode Opcode, peer *Peer, timeout time.Duration) {
+	count, _ := n.messageHandlerTimeoutCount.LoadOrStore(opcode, new(uint64))
+	atomic.AddUint64(count.(*uint64), 1)
+
+	log.Warn().
+		Uint8("opcode", uint8(opcode)).
+		Str("peer", peer.conn.RemoteAddr().String()).
+		Dur("timeout", timeout).
+		Msg("Message handler exceeded its timeout.")
+
+	if errs := n.onMessageHandlerTimeout.RunCallbacks(opcode, peer, timeout); len(errs) > 0 {
+		log.Warn().Errs("errors", errs).Msg("Got errors running OnMessageHandlerTimeout callbacks.")
+	}
+
+	peer.onConnErrorCallbacks.RunCallbacks(n, errors.Wrapf(ErrHandlerTimeout, "handler for opcode %d exceeded its timeout of %s", opcode, timeout))
+}
+
+func (n *Node) messageHandlers(opcode Opcode) *callbacks.SequentialCallbackManager {
+	manager, exists := n.onMessageReceivedCallbacks.Load(opcode)
+	if !exists {
+		return nil
+	}
+
+	return manager.(*callbacks.SequentialCallbackManager)
+}
+
 // Set sets a metadata entry given a key-value pair on our node.
 func (n *Node) Set(key string, val interface{}) {
 	n.metadata.Store(key, val)
@@ -271,34 +625,101 @@ func (n *Node) Delete(key string) {
 
 // Fence blocks the current goroutine until the node stops listening for peers.
 func (n *Node) Fence() {
-	<-n.kill
+	<-n.group.Context().Done()
 }
 
+// Kill stops our node, disconnecting all of its peers, and blocks until every goroutine our node
+// spawned has exited. Refer to `Wait()` for any fatal error our node stopped with.
 func (n *Node) Kill() {
-	if !atomic.CompareAndSwapUint32(&n.killOnce, 0, 1) {
-		return
-	}
+	n.group.Cancel()
+	_ = n.group.Wait()
+}
+
+// Wait blocks until our node is killed and every goroutine it spawned has exited. It returns the
+// first fatal error our node encountered, such as its listener failing, or a goroutine spawned
+// through `Go()` returning an error. Wait returns nil should our node have been killed without
+// error.
+func (n *Node) Wait() error {
+	return n.group.Wait()
+}
+
+// Go runs a function in a goroutine tracked by our node, such that `Kill()` and `Wait()` block until
+// it exits. The context provided to the function is done once our node is being killed. Should the
+// function return an error, our node is killed, and the error is returned by `Wait()`.
+func (n *Node) Go(fn func(ctx context.Context) error) {
+	n.group.Go(fn)
+}
 
-	signal := make(chan struct{})
-	n.kill <- signal
+// shutdown stops our node once the context of its goroutines is done.
+func (n *Node) shutdown() error {
+	atomic.StoreUint32(&n.killOnce, 1)
 
 	if err := n.listener.Close(); err != nil {
 		n.onListenerErrorCallbacks.RunCallbacks(err)
 	}
 
-	<-signal
-	close(n.kill)
+	n.closeListeners()
 
-	if n.nat != nil {
-		err := n.nat.DeleteMapping(n.transport.String(), n.internalPort, n.externalPort)
+	// Peers are told that our node is shutting down, such that they need not mistake our node
+	// having gone away for a fault.
+	var disconnected []<-chan struct{}
 
-		if err != nil {
-			panic(errors.Wrap(err, "nat: failed to remove port-forward"))
+	for _, peer := range n.peers.snapshot(true) {
+		disconnected = append(disconnected, peer.DisconnectWithReason(ReasonShuttingDown))
+	}
+
+	for _, signal := range disconnected {
+		<-signal
+	}
+
+	if n.scheduler != nil {
+		n.scheduler.close()
+	}
+
+	if n.keepalive != nil {
+		n.keepalive.close()
+	}
+
+	if n.nat != nil {
+		if err := n.nat.DeleteMapping(n.transport.String(), n.internalPort, n.externalPort); err != nil {
+			return errors.Wrap(err, "nat: failed to remove port-forward")
 		}
 	}
+
+	return nil
+}
+
+// Resources returns the manager which accounts for the memory our node reserves on behalf of its
+// peers.
+func (n *Node) Resources() *resource.Manager {
+	return n.resources
+}
+
+// Clock returns the clock our node measures time against. Protocols should measure their own
+// timeouts and TTLs against it, such that they may be tested against a fake clock.
+func (n *Node) Clock() clock.Clock {
+	return n.clock
+}
+
+// Random returns the source our node draws random decisions from. Protocols should draw decisions
+// which need not be unpredictable from it, such that simulations of them may be reproduced from a
+// seed.
+func (n *Node) Random() random.Source {
+	return n.random
+}
+
+// SetExternalAddress overrides the address our node reports it is reachable at, such as once it
+// has been discovered through the addresses our peers observe us at. Setting an empty address
+// restores the address derived from our nodes host, external port and NAT provider.
+func (n *Node) SetExternalAddress(address string) {
+	n.advertised.Store(address)
 }
 
 func (n *Node) ExternalAddress() string {
+	if address, ok := n.advertised.Load().(string); ok && address != "" {
+		return address
+	}
+
 	if n.nat != nil && nat.IsPrivateIP(net.ParseIP(n.host)) {
 		externalIP, err := n.nat.ExternalIP()
 		if err != nil {
@@ -1,10 +1,13 @@
 package noise
 
 import (
+	"context"
 	"fmt"
 	"github.com/perlin-network/noise/log"
 	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"runtime"
 	"sync"
 	"testing"
 	"testing/quick"
@@ -295,6 +298,91 @@ func TestNodeKill(t *testing.T) {
 	}
 }
 
+func TestNodeKillLeaksNothing(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	before := runtime.NumGoroutine()
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	peer.SendMessageAsync(&EmptyMessage{})
+
+	alice.Kill()
+	bob.Kill()
+
+	assert.NoError(t, alice.Wait())
+	assert.NoError(t, bob.Wait())
+
+	deadline := time.Now().Add(3 * time.Second)
+
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.True(t, runtime.NumGoroutine() <= before, "%d goroutine(s) leaked", runtime.NumGoroutine()-before)
+}
+
+func TestNodeWait(t *testing.T) {
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	node, err := NewNode(params)
+	assert.NoError(t, err)
+
+	errFatal := errors.New("fatal")
+
+	node.Go(func(ctx context.Context) error {
+		return errFatal
+	})
+
+	assert.Equal(t, errFatal, node.Wait())
+
+	_, err = node.Dial("127.0.0.1:3000")
+	assert.True(t, errors.Is(err, ErrNodeKilled))
+}
+
+func TestNodeContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+	params.Context = ctx
+
+	node, err := NewNode(params)
+	assert.NoError(t, err)
+
+	listened := make(chan struct{})
+
+	go func() {
+		node.Listen()
+		close(listened)
+	}()
+
+	cancel()
+
+	select {
+	case <-listened:
+	case <-time.After(3 * time.Second):
+		t.Fatal("cancelling the context of our node did not stop it from listening")
+	}
+
+	assert.NoError(t, node.Wait())
+}
+
 // counter is a concurrent safe map of counters
 type counter struct {
 	mu     sync.Mutex
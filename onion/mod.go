@@ -0,0 +1,382 @@
+// Package onion routes messages through a path of relays, with a layer of encryption sealed to each
+// hop, such that no single relay learns both who sent a message and who it is destined to.
+package onion
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/dedup"
+	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/random"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	keyState = "onion.state"
+
+	layerInfo = "noise onion layer"
+
+	DefaultTimeout = 10 * time.Second
+)
+
+// Every layer is prefixed with its kind once opened. A relay layer carries the address of the next
+// hop and the layer to forward to it, and a deliver layer carries the message itself.
+const (
+	kindRelay byte = iota
+	kindDeliver
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrEmptyPath = errors.New("onion: path must have at least one hop")
+)
+
+// Hop is a node along the path of an onion-routed message, identified by the address it may be
+// dialed at and its static public key.
+type Hop struct {
+	Address   string
+	PublicKey []byte
+}
+
+// Handler handles a message onion-routed to our node. The peer who sent, or relayed, the message is
+// deliberately not given.
+type Handler func(node *noise.Node, data []byte) error
+
+type block struct {
+	opcodeOnion noise.Opcode
+
+	timeoutDuration time.Duration
+
+	handlers []Handler
+}
+
+// New returns a block which relays onion-routed messages, and delivers messages onion-routed to our
+// node to its handlers. Layers are sealed to the static keys of our node, which must be ed25519
+// keys.
+//
+// Relays dial the next hop of a message should they not have dialed it already. By default, dialing
+// a hop and completing our protocol with it times out after 10 seconds.
+func New() *block {
+	return &block{timeoutDuration: DefaultTimeout}
+}
+
+func (b *block) TimeoutAfter(timeoutDuration time.Duration) *block {
+	b.timeoutDuration = timeoutDuration
+	return b
+}
+
+// OnMessage registers a handler for messages onion-routed to our node.
+func (b *block) OnMessage(handler Handler) *block {
+	b.handlers = append(b.handlers, handler)
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeOnion = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Onion)(nil))
+
+	s := &state{block: b, node: node, dialed: make(map[string]*noise.Peer), seen: dedup.New()}
+	node.Set(keyState, s)
+
+	node.OnMessageReceived(b.opcodeOnion, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		if _, ok := peer.Get(keyState).(*state); !ok {
+			return nil
+		}
+
+		node.Go(func(ctx context.Context) error {
+			s.receive(message.(Onion))
+			return nil
+		})
+
+		return nil
+	})
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	peer.Set(keyState, peer.Node().Get(keyState))
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Send onion-routes data along a path, whose last hop is the destination of the message. The
+// message is sealed in a layer for every hop, starting from the destination, and is sent to the
+// first hop. Every relay along the path only learns of the hop before and after it.
+func Send(node *noise.Node, path []Hop, data []byte) error {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return errors.New("onion: block is not registered to the nodes protocol")
+	}
+
+	if len(path) == 0 {
+		return ErrEmptyPath
+	}
+
+	msg, err := seal(path[len(path)-1], payload.NewWriter([]byte{kindDeliver}).WriteBytes(data).Bytes())
+	if err != nil {
+		return err
+	}
+
+	for i := len(path) - 2; i >= 0; i-- {
+		layer := payload.NewWriter([]byte{kindRelay}).
+			WriteString(path[i+1].Address).
+			WriteBytes(msg.Write()).
+			Bytes()
+
+		if msg, err = seal(path[i], layer); err != nil {
+			return err
+		}
+	}
+
+	return s.forward(path[0].Address, msg)
+}
+
+// Path picks a path of a number of relays chosen at random from candidates, followed by the
+// destination. Candidates which are the destination are never picked as relays.
+func Path(candidates []Hop, relays int, destination Hop) ([]Hop, error) {
+	return PathFrom(random.New(), candidates, relays, destination)
+}
+
+// PathFrom picks a path as Path does, drawing which relays to pick from a source of randomness, such
+// as that of our node.
+func PathFrom(source random.Source, candidates []Hop, relays int, destination Hop) ([]Hop, error) {
+	var pool []Hop
+
+	for _, hop := range candidates {
+		if hop.Address != destination.Address {
+			pool = append(pool, hop)
+		}
+	}
+
+	if len(pool) < relays {
+		return nil, errors.Errorf("onion: only %d candidates to pick %d relays from", len(pool), relays)
+	}
+
+	source.Shuffle(len(pool), func(i, j int) { pool[i], pool[j] = pool[j], pool[i] })
+
+	return append(pool[:relays:relays], destination), nil
+}
+
+type state struct {
+	sync.Mutex
+
+	block *block
+	node  *noise.Node
+
+	// dialed holds the peers our node dialed to relay messages to, by their addresses.
+	dialed map[string]*noise.Peer
+
+	// seen holds the ephemeral public keys of all layers we opened, such that layers replayed to
+	// our node are dropped.
+	seen *dedup.Filter
+}
+
+func (s *state) receive(msg Onion) {
+	if s.seen.Seen(msg.Ephemeral) {
+		return
+	}
+
+	layer, err := open(s.node, msg)
+	if err != nil {
+		log.Debug().Err(err).Msg("Dropped an onion-routed message which failed to be opened.")
+		return
+	}
+
+	reader := payload.NewReader(layer)
+
+	kind, err := reader.ReadByte()
+	if err != nil {
+		return
+	}
+
+	switch kind {
+	case kindDeliver:
+		data, err := reader.ReadBytes()
+		if err != nil {
+			return
+		}
+
+		for _, handler := range s.block.handlers {
+			if err := handler(s.node, data); err != nil {
+				log.Warn().Err(err).Msg("Got an error handling an onion-routed message.")
+			}
+		}
+	case kindRelay:
+		address, err := reader.ReadString()
+		if err != nil {
+			return
+		}
+
+		buf, err := reader.ReadBytes()
+		if err != nil {
+			return
+		}
+
+		inner, err := Onion{}.Read(payload.NewReader(buf))
+		if err != nil {
+			return
+		}
+
+		next := inner.(Onion)
+		next.Padding = nil
+
+		if next.Padding, err = pad(len(msg.Write()) - len(next.Write())); err != nil {
+			return
+		}
+
+		if err := s.forward(address, next); err != nil {
+			log.Debug().Err(err).Str("address", address).Msg("Failed to relay an onion-routed message.")
+		}
+	}
+}
+
+// forward sends a layer to a hop, dialing the hop should our node not have dialed it already.
+func (s *state) forward(address string, msg Onion) error {
+	peer, err := s.peer(address)
+	if err != nil {
+		return err
+	}
+
+	return peer.SendMessage(msg)
+}
+
+func (s *state) peer(address string) (*noise.Peer, error) {
+	s.Lock()
+	peer, exists := s.dialed[address]
+	s.Unlock()
+
+	if exists {
+		return peer, nil
+	}
+
+	peer, err := s.node.Dial(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "onion: failed to dial hop %s", address)
+	}
+
+	established := make(chan error, 1)
+
+	s.node.Go(func(ctx context.Context) error {
+		established <- protocol.WaitUntilEstablished(peer)
+		return nil
+	})
+
+	select {
+	case err := <-established:
+		if err != nil {
+			return nil, errors.Wrapf(err, "onion: failed to complete protocol with hop %s", address)
+		}
+	case <-s.node.Clock().After(s.block.timeoutDuration):
+		peer.Disconnect()
+		return nil, errors.Errorf("onion: timed out completing protocol with hop %s", address)
+	}
+
+	s.Lock()
+	if existing, exists := s.dialed[address]; exists {
+		s.Unlock()
+
+		peer.Disconnect()
+		return existing, nil
+	}
+
+	s.dialed[address] = peer
+	s.Unlock()
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		s.Lock()
+		if s.dialed[address] == peer {
+			delete(s.dialed, address)
+		}
+		s.Unlock()
+
+		return nil
+	})
+
+	return peer, nil
+}
+
+// seal seals a layer to a hop under a key derived from a fresh ephemeral shared key with the hop.
+// As every ephemeral shared key is used once, the nonce is left zeroed.
+func seal(hop Hop, layer []byte) (Onion, error) {
+	if !edwards25519.IsGroupElement(hop.PublicKey) {
+		return Onion{}, errors.Errorf("onion: public key of hop %s is not a valid ed25519 public key", hop.Address)
+	}
+
+	ephemeralPublicKey, ephemeralPrivateKey, err := edwards25519.GenerateKey(nil)
+	if err != nil {
+		return Onion{}, errors.Wrap(err, "onion: failed to generate ephemeral keypair")
+	}
+
+	suite, err := newSuite(edwards25519.SharedKey(ephemeralPrivateKey, hop.PublicKey))
+	if err != nil {
+		return Onion{}, err
+	}
+
+	sealed := suite.Seal(nil, make([]byte, suite.NonceSize()), layer, ephemeralPublicKey)
+
+	return Onion{Ephemeral: ephemeralPublicKey, Sealed: sealed}, nil
+}
+
+func open(node *noise.Node, msg Onion) ([]byte, error) {
+	if node.Keys == nil || len(node.Keys.PrivateKey()) != edwards25519.PrivateKeySize {
+		return nil, errors.New("onion: node has no ed25519 keys to open layers with")
+	}
+
+	if !edwards25519.IsGroupElement(msg.Ephemeral) {
+		return nil, errors.Wrap(noise.ErrDecryptFailed, "layer authentication failed")
+	}
+
+	suite, err := newSuite(edwards25519.SharedKey(node.Keys.PrivateKey(), msg.Ephemeral))
+	if err != nil {
+		return nil, err
+	}
+
+	layer, err := suite.Open(nil, make([]byte, suite.NonceSize()), msg.Sealed, msg.Ephemeral)
+	if err != nil {
+		return nil, errors.Wrap(noise.ErrDecryptFailed, "layer authentication failed")
+	}
+
+	return layer, nil
+}
+
+func newSuite(sharedKey []byte) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedKey, nil, []byte(layerInfo)), key); err != nil {
+		return nil, errors.Wrap(err, "onion: failed to derive key via HKDF")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "onion: failed to create AES block cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func pad(n int) ([]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	padding := make([]byte, n)
+
+	if _, err := rand.Read(padding); err != nil {
+		return nil, errors.Wrap(err, "onion: failed to generate padding")
+	}
+
+	return padding, nil
+}
@@ -0,0 +1,107 @@
+package onion
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/identity/ed25519"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/random"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newNode(t *testing.T, layer transport.Layer, block *block) *noise.Node {
+	params := noise.DefaultParams()
+	params.Transport = layer
+	params.Keys = ed25519.RandomKeys()
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	protocol.New().Register(block).Enforce(node)
+
+	go node.Listen()
+
+	return node
+}
+
+func hop(node *noise.Node) Hop {
+	return Hop{Address: node.ExternalAddress(), PublicKey: node.Keys.PublicKey()}
+}
+
+func TestSend(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	received := make(chan string, 16)
+
+	alice, bob, carol := newNode(t, layer, New()), newNode(t, layer, New()), newNode(t, layer, New())
+	dave := newNode(t, layer, New().OnMessage(func(node *noise.Node, data []byte) error {
+		received <- string(data)
+		return nil
+	}))
+
+	defer alice.Kill()
+	defer bob.Kill()
+	defer carol.Kill()
+	defer dave.Kill()
+
+	// Alice routes her message to dave through bob and carol, who dial the next hop on demand.
+	path, err := Path([]Hop{hop(bob), hop(carol), hop(dave)}, 2, hop(dave))
+	assert.NoError(t, err)
+	assert.Len(t, path, 3)
+	assert.Equal(t, hop(dave), path[2])
+
+	assert.NoError(t, Send(alice, path, []byte("hello")))
+
+	select {
+	case data := <-received:
+		assert.Equal(t, "hello", data)
+	case <-time.After(3 * time.Second):
+		t.Fatal("dave did not receive the message alice onion-routed to him")
+	}
+
+	// Messages are only delivered by the hop they are sealed to.
+	assert.NoError(t, Send(alice, []Hop{{Address: dave.ExternalAddress(), PublicKey: bob.Keys.PublicKey()}}, []byte("misrouted")))
+
+	// Layers replayed to a hop are dropped.
+	msg, err := seal(hop(dave), payload.NewWriter([]byte{kindDeliver}).WriteBytes([]byte("replayed")).Bytes())
+	assert.NoError(t, err)
+
+	s := alice.Get(keyState).(*state)
+
+	assert.NoError(t, s.forward(dave.ExternalAddress(), msg))
+	assert.NoError(t, s.forward(dave.ExternalAddress(), msg))
+
+	select {
+	case data := <-received:
+		assert.Equal(t, "replayed", data)
+	case <-time.After(3 * time.Second):
+		t.Fatal("dave did not receive the message alice sent him")
+	}
+
+	select {
+	case data := <-received:
+		t.Fatalf("dave received %q, which he should have dropped", data)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	_, err = Path([]Hop{hop(bob), hop(dave)}, 2, hop(dave))
+	assert.Error(t, err)
+
+	// Paths picked from sources seeded alike are alike.
+	candidates := []Hop{hop(alice), hop(bob), hop(carol)}
+
+	a, err := PathFrom(random.NewSeeded(1), candidates, 2, hop(dave))
+	assert.NoError(t, err)
+
+	b, err := PathFrom(random.NewSeeded(1), candidates, 2, hop(dave))
+	assert.NoError(t, err)
+	assert.Equal(t, a, b)
+	assert.Equal(t, ErrEmptyPath, Send(alice, nil, []byte("hello")))
+}
@@ -0,0 +1,43 @@
+package onion
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ noise.Message = (*Onion)(nil)
+)
+
+// Onion carries a layer of an onion-routed message, sealed to a single hop under a key derived
+// from an ephemeral public key. Relays pad the layers they forward with random bytes to the size of
+// the layer they received, such that the size of a layer does not reveal its position along a path.
+type Onion struct {
+	Ephemeral []byte
+	Sealed    []byte
+	Padding   []byte
+}
+
+func (Onion) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Onion
+	var err error
+
+	if msg.Ephemeral, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read ephemeral public key")
+	}
+
+	if msg.Sealed, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read sealed layer")
+	}
+
+	if msg.Padding, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read padding")
+	}
+
+	return msg, nil
+}
+
+func (m Onion) Write() []byte {
+	return payload.NewWriter(nil).WriteBytes(m.Ephemeral).WriteBytes(m.Sealed).WriteBytes(m.Padding).Bytes()
+}
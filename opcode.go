@@ -3,6 +3,7 @@ package noise
 import (
 	"fmt"
 	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
 	"github.com/pkg/errors"
 	"reflect"
 	"sync"
@@ -12,6 +13,10 @@ type Opcode byte
 
 const (
 	OpcodeNil Opcode = 0
+
+	// OpcodeDisconnect is reserved for DisconnectMessage, which announces why a peer is about to
+	// close its connection to us.
+	OpcodeDisconnect Opcode = 255
 )
 
 var (
@@ -28,12 +33,14 @@ func (o Opcode) Bytes() (buf [1]byte) {
 }
 
 // NextAvailableOpcode returns the next available unregistered message opcode
-// registered to Noise.
+// registered to Noise. Once every opcode up to OpcodeDisconnect is taken, the opcode
+// returned is OpcodeDisconnect, which RegisterMessage refuses.
 func NextAvailableOpcode() Opcode {
 	opcodesMutex.Lock()
 	defer opcodesMutex.Unlock()
 
-	return Opcode(len(opcodes))
+	// OpcodeDisconnect is always registered, yet is not counted against opcodes registered thus far.
+	return Opcode(len(opcodes) - 1)
 }
 
 // DebugOpcodes prints out all opcodes registered to Noise thus far.
@@ -43,8 +50,10 @@ func DebugOpcodes() {
 
 	log.Debug().Msg("Here are all opcodes registered so far.")
 
-	for i := 0; i < len(opcodes); i++ {
-		fmt.Printf("Opcode %d is registered to: %s\n", i, reflect.TypeOf(opcodes[Opcode(i)]).String())
+	for i := 0; i <= int(OpcodeDisconnect); i++ {
+		if typ, exists := opcodes[Opcode(i)]; exists {
+			fmt.Printf("Opcode %d is registered to: %s\n", i, reflect.TypeOf(typ).String())
+		}
 	}
 }
 
@@ -58,7 +67,7 @@ func MessageFromOpcode(opcode Opcode) (Message, error) {
 
 	typ, exists := opcodes[Opcode(opcode)]
 	if !exists {
-		return nil, errors.Errorf("there is no message type registered to opcode %d", opcode)
+		return nil, errors.Wrapf(ErrUnknownOpcode, "there is no message type registered to opcode %d", opcode)
 	}
 
 	message, ok := reflect.New(reflect.TypeOf(typ)).Elem().Interface().(Message)
@@ -90,6 +99,30 @@ func OpcodeFromMessage(msg Message) (Opcode, error) {
 	return opcode, nil
 }
 
+// SchemaFromOpcode returns the schema of the message type registered to an opcode, which messages
+// of said type should they be encoded through payload.Marshal are decoded with. Schemas may be
+// checked against those of older releases through `CompatibleWith()`, so that a message type is
+// known to be safe to evolve before nodes of different versions are rolled out side by side.
+//
+// It errors if the specified message opcode is not registered to Noise, or if the message type
+// registered to it is not a struct whose fields may be encoded through payload.Marshal.
+func SchemaFromOpcode(opcode Opcode) (payload.Schema, error) {
+	message, err := MessageFromOpcode(opcode)
+	if err != nil {
+		return payload.Schema{}, err
+	}
+
+	schema, err := payload.SchemaOf(message)
+	if err != nil {
+		return payload.Schema{}, errors.Wrapf(err, "message type associated to opcode %d has no schema", opcode)
+	}
+
+	return schema, nil
+}
+
+// RegisterMessage registers a message type to an opcode, and returns the opcode the message type is
+// registered to. Message types which are already registered keep their opcode. It panics should
+// the opcode be OpcodeDisconnect, which is reserved for DisconnectMessage.
 func RegisterMessage(o Opcode, m interface{}) Opcode {
 	typ := reflect.TypeOf(m).Elem()
 
@@ -100,6 +133,10 @@ func RegisterMessage(o Opcode, m interface{}) Opcode {
 		return opcode
 	}
 
+	if o == OpcodeDisconnect {
+		panic(errors.Errorf("noise: opcode %d is reserved for DisconnectMessage, and may not be registered to %v", o, typ))
+	}
+
 	opcodes[o] = reflect.New(typ).Elem().Interface().(Message)
 	messages[typ] = o
 
@@ -111,10 +148,12 @@ func resetOpcodes() {
 	defer opcodesMutex.Unlock()
 
 	opcodes = map[Opcode]Message{
-		OpcodeNil: reflect.New(reflect.TypeOf((*EmptyMessage)(nil)).Elem()).Elem().Interface().(Message),
+		OpcodeNil:        reflect.New(reflect.TypeOf((*EmptyMessage)(nil)).Elem()).Elem().Interface().(Message),
+		OpcodeDisconnect: reflect.New(reflect.TypeOf((*DisconnectMessage)(nil)).Elem()).Elem().Interface().(Message),
 	}
 
 	messages = map[reflect.Type]Opcode{
-		reflect.TypeOf((*EmptyMessage)(nil)).Elem(): OpcodeNil,
+		reflect.TypeOf((*EmptyMessage)(nil)).Elem():      OpcodeNil,
+		reflect.TypeOf((*DisconnectMessage)(nil)).Elem(): OpcodeDisconnect,
 	}
 }
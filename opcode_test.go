@@ -1,6 +1,7 @@
 package noise
 
 import (
+	"github.com/perlin-network/noise/payload"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -32,3 +33,53 @@ func TestNextAvailableOpcode(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, Opcode(1), o)
 }
+
+func TestRegisterMessageReservesDisconnect(t *testing.T) {
+	resetOpcodes()
+	defer resetOpcodes()
+
+	assert.Panics(t, func() {
+		RegisterMessage(OpcodeDisconnect, (*testMsg)(nil))
+	})
+
+	msg, err := MessageFromOpcode(OpcodeDisconnect)
+	assert.NoError(t, err)
+	assert.Equal(t, DisconnectMessage{}, msg)
+
+	// The message type of the reserved opcode may be registered again, and keeps its opcode.
+	assert.Equal(t, OpcodeDisconnect, RegisterMessage(OpcodeDisconnect, (*DisconnectMessage)(nil)))
+}
+
+type schemaMsg struct {
+	Text  string `payload:"1"`
+	Flags uint32 `payload:"2,optional"`
+
+	Unknown payload.Unknown
+}
+
+func (schemaMsg) Read(reader payload.Reader) (Message, error) {
+	var msg schemaMsg
+	return msg, reader.ReadStruct(&msg)
+}
+
+func (m schemaMsg) Write() []byte {
+	buf, _ := payload.Marshal(m)
+	return buf
+}
+
+func TestSchemaFromOpcode(t *testing.T) {
+	resetOpcodes()
+
+	opcode := RegisterMessage(NextAvailableOpcode(), (*schemaMsg)(nil))
+
+	schema, err := SchemaFromOpcode(opcode)
+	assert.NoError(t, err)
+	assert.Len(t, schema.Fields, 2)
+
+	_, err = SchemaFromOpcode(opcode + 1)
+	assert.Error(t, err)
+
+	msg, err := schemaMsg{}.Read(payload.NewReader(schemaMsg{Text: "hello", Flags: 1}.Write()))
+	assert.NoError(t, err)
+	assert.Equal(t, schemaMsg{Text: "hello", Flags: 1}, msg)
+}
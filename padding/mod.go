@@ -0,0 +1,131 @@
+// Package padding pads messages sent between peers out to sizes decided by a policy, such that
+// parties observing the traffic of a connection may not tell which messages are sent over it by the
+// sizes of their frames.
+//
+// Messages are padded within the payload of their frames, and so the block must be registered
+// before any block which encrypts messages, such that padding is encrypted alongside the messages it
+// pads out.
+package padding
+
+import (
+	"encoding/binary"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const keyPolicy = "padding.policy"
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrMalformed = errors.New("padding: message is padded out malformed")
+)
+
+type block struct {
+	opcodeAnnounce  noise.Opcode
+	timeoutDuration time.Duration
+
+	policy Policy
+}
+
+// New returns a block which pads every message sent through the protocol it is registered to as
+// per a policy, unless the policy is overridden for a single peer through SetPolicy. Peers which do
+// not announce that they pad messages within 10 seconds are disconnected.
+func New(policy Policy) *block {
+	if policy == nil {
+		panic("padding: a policy must be given")
+	}
+
+	return &block{timeoutDuration: 10 * time.Second, policy: policy}
+}
+
+func (b *block) TimeoutAfter(timeoutDuration time.Duration) *block {
+	b.timeoutDuration = timeoutDuration
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeAnnounce = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Announce)(nil))
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	// Hold off on handling messages after their announcement, until we are ready to strip them of
+	// their padding.
+	locker := peer.LockOnReceive(b.opcodeAnnounce)
+	defer locker.Unlock()
+
+	if err := peer.SendMessage(Announce{}); err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "padding: failed to announce that we pad messages")
+	}
+
+	// Messages sent after our announcement are padded.
+	peer.BeforeMessageSent(func(node *noise.Node, peer *noise.Peer, msg []byte) ([]byte, error) {
+		return pad(msg, b.policyOf(peer)), nil
+	})
+
+	select {
+	case <-peer.Node().Clock().After(b.timeoutDuration):
+		return errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeTimeout), "padding: timed out waiting for peer to announce that it pads messages")
+	case <-peer.Receive(b.opcodeAnnounce):
+	}
+
+	peer.BeforeMessageReceived(func(node *noise.Node, peer *noise.Peer, msg []byte) ([]byte, error) {
+		return unpad(msg)
+	})
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// SetPolicy overrides the policy messages sent to a single peer are padded out as per. It may be
+// called at any time, such as from within `OnPeerInit`.
+func SetPolicy(peer *noise.Peer, policy Policy) {
+	if policy == nil {
+		panic("padding: a policy must be given")
+	}
+
+	peer.Set(keyPolicy, policy)
+}
+
+func (b *block) policyOf(peer *noise.Peer) Policy {
+	if policy, ok := peer.Get(keyPolicy).(Policy); ok {
+		return policy
+	}
+
+	return b.policy
+}
+
+// pad prefixes a message with its size encoded as a uvarint, and pads it out with zeroes to the
+// size the policy decides for the prefixed message.
+func pad(msg []byte, policy Policy) []byte {
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(msg)))
+
+	size := n + len(msg)
+
+	padded := policy.Pad(size)
+	if padded < size {
+		padded = size
+	}
+
+	buf := make([]byte, padded)
+
+	copy(buf, prefix[:n])
+	copy(buf[n:], msg)
+
+	return buf
+}
+
+func unpad(msg []byte) ([]byte, error) {
+	size, n := binary.Uvarint(msg)
+	if n <= 0 || size > uint64(len(msg)-n) {
+		return nil, errors.Wrapf(ErrMalformed, "got a message of %d bytes", len(msg))
+	}
+
+	return msg[n : n+int(size)], nil
+}
@@ -0,0 +1,150 @@
+package padding
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/cipher/aead"
+	"github.com/perlin-network/noise/handshake/ecdh"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var _ noise.Message = (*text)(nil)
+
+type text struct {
+	Text string
+}
+
+func (text) Read(reader payload.Reader) (noise.Message, error) {
+	t, err := reader.ReadString()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read text")
+	}
+
+	return text{Text: t}, nil
+}
+
+func (m text) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.Text).Bytes()
+}
+
+func TestPolicies(t *testing.T) {
+	assert.Equal(t, 13, None.Pad(13))
+
+	buckets := Buckets(256, 64, 1024)
+
+	assert.Equal(t, 64, buckets.Pad(1))
+	assert.Equal(t, 64, buckets.Pad(64))
+	assert.Equal(t, 256, buckets.Pad(65))
+	assert.Equal(t, 1024, buckets.Pad(1000))
+	assert.Equal(t, 3072, buckets.Pad(2049))
+
+	assert.Panics(t, func() { Buckets() })
+	assert.Panics(t, func() { Buckets(0, 64) })
+
+	random := Random(16)
+
+	for i := 0; i < 64; i++ {
+		padded := random.Pad(100)
+		assert.True(t, padded >= 100 && padded <= 116, "padded 100 bytes out to %d bytes", padded)
+	}
+
+	assert.Equal(t, 100, Random(0).Pad(100))
+	assert.Panics(t, func() { Random(-1) })
+}
+
+func TestPad(t *testing.T) {
+	msg := []byte("hello world")
+
+	padded := pad(msg, Buckets(64))
+	assert.Len(t, padded, 64)
+
+	unpadded, err := unpad(padded)
+	assert.NoError(t, err)
+	assert.Equal(t, msg, unpadded)
+
+	// Messages which do not fit within any bucket are still sent in full.
+	large := make([]byte, 200)
+
+	unpadded, err = unpad(pad(large, Buckets(64)))
+	assert.NoError(t, err)
+	assert.Equal(t, large, unpadded)
+
+	unpadded, err = unpad(pad(nil, None))
+	assert.NoError(t, err)
+	assert.Empty(t, unpadded)
+
+	_, err = unpad([]byte{10, 1, 2})
+	assert.True(t, errors.Is(err, ErrMalformed))
+
+	_, err = unpad(nil)
+	assert.True(t, errors.Is(err, ErrMalformed))
+}
+
+func TestPadding(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	opcode := noise.RegisterMessage(noise.NextAvailableOpcode(), (*text)(nil))
+
+	dial := func(ours, theirs protocol.Block) (*noise.Node, *noise.Node, *noise.Peer, chan text) {
+		layer := transport.NewBuffered()
+
+		params := noise.DefaultParams()
+		params.Transport = layer
+
+		bob, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		alice, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		// Messages are padded before they are encrypted.
+		protocol.New().Register(ecdh.New()).Register(ours).Register(aead.New()).Enforce(alice)
+		protocol.New().Register(ecdh.New()).Register(theirs).Register(aead.New()).Enforce(bob)
+
+		received := make(chan text, 16)
+
+		bob.OnMessageReceived(opcode, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+			received <- message.(text)
+			return nil
+		})
+
+		go alice.Listen()
+		go bob.Listen()
+
+		peer, err := alice.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+		assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+		return alice, bob, peer, received
+	}
+
+	check := func(peer *noise.Peer, received chan text) {
+		for _, msg := range []string{"", "hello", string(make([]byte, 300))} {
+			assert.NoError(t, peer.SendMessage(text{Text: msg}))
+
+			select {
+			case got := <-received:
+				assert.Equal(t, msg, got.Text)
+			case <-time.After(3 * time.Second):
+				t.Fatal("did not receive the text sent")
+			}
+		}
+	}
+
+	alice, bob, peer, received := dial(New(Buckets(64, 256)), New(Random(32)))
+	defer alice.Kill()
+	defer bob.Kill()
+
+	check(peer, received)
+
+	// Policies may be overridden for a single peer.
+	SetPolicy(peer, Random(8))
+	check(peer, received)
+}
@@ -0,0 +1,19 @@
+package padding
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+)
+
+var _ noise.Message = (*Announce)(nil)
+
+// Announce announces that every message its sender sends afterwards is padded.
+type Announce struct{}
+
+func (Announce) Read(reader payload.Reader) (noise.Message, error) {
+	return Announce{}, nil
+}
+
+func (Announce) Write() []byte {
+	return nil
+}
@@ -0,0 +1,87 @@
+package padding
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+var (
+	_ Policy = none{}
+	_ Policy = buckets{}
+	_ Policy = random(0)
+)
+
+// Policy decides how many bytes a message is padded out to.
+type Policy interface {
+	// Pad returns the number of bytes a message of a given size is to be padded out to, which is at
+	// least the size of the message.
+	Pad(size int) int
+}
+
+// None pads no message.
+var None Policy = none{}
+
+type none struct{}
+
+func (none) Pad(size int) int {
+	return size
+}
+
+// Buckets pads messages out to the smallest of a set of sizes they fit within, such that messages
+// may only be told apart by which bucket they fall into. Messages larger than every bucket are
+// padded out to a multiple of the largest bucket.
+func Buckets(sizes ...int) Policy {
+	if len(sizes) == 0 {
+		panic("padding: at least one bucket must be given")
+	}
+
+	sorted := append([]int(nil), sizes...)
+	sort.Ints(sorted)
+
+	if sorted[0] <= 0 {
+		panic("padding: buckets must be positive")
+	}
+
+	return buckets(sorted)
+}
+
+type buckets []int
+
+func (b buckets) Pad(size int) int {
+	for _, bucket := range b {
+		if size <= bucket {
+			return bucket
+		}
+	}
+
+	largest := b[len(b)-1]
+
+	return (size + largest - 1) / largest * largest
+}
+
+// Random pads messages out by anywhere from zero to max bytes, drawn uniformly from crypto/rand.
+func Random(max int) Policy {
+	if max < 0 {
+		panic("padding: max random padding must not be negative")
+	}
+
+	return random(max)
+}
+
+type random int
+
+func (r random) Pad(size int) int {
+	if r == 0 {
+		return size
+	}
+
+	var buf [8]byte
+
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(errors.Wrap(err, "padding: failed to draw padding size"))
+	}
+
+	return size + int(binary.LittleEndian.Uint64(buf[:])%uint64(r+1))
+}
@@ -1,8 +1,13 @@
 package noise
 
 import (
+	"context"
+	"github.com/perlin-network/noise/clock"
 	"github.com/perlin-network/noise/identity"
+	"github.com/perlin-network/noise/kv"
 	"github.com/perlin-network/noise/nat"
+	"github.com/perlin-network/noise/random"
+	"github.com/perlin-network/noise/resource"
 	"github.com/perlin-network/noise/transport"
 	"time"
 )
@@ -23,6 +28,78 @@ type parameters struct {
 	ReceiveMessageTimeout time.Duration
 
 	SendWorkerBusyTimeout time.Duration
+
+	// MaxUploadRate caps the number of bytes per second our node may send to all of its
+	// peers combined. Bandwidth is fairly shared amongst peers. Zero disables the cap.
+	MaxUploadRate uint64
+
+	// KeepaliveInterval is how long a connection to a peer may go without our node sending anything
+	// over it, before a heartbeat is sent. Any message sent counts as a heartbeat. Zero disables
+	// heartbeats.
+	KeepaliveInterval time.Duration
+
+	// KeepaliveTimeout is how long a connection to a peer may go without our node receiving
+	// anything over it, before the peer is disconnected. It only applies should heartbeats be
+	// enabled, and zero disables it.
+	KeepaliveTimeout time.Duration
+
+	// IdleTimeout is how long a connection to a peer may go without any message being sent or
+	// received over it, heartbeats aside, before the peer is disconnected. Callbacks registered
+	// through OnPeerIdle may veto disconnecting the peer. Zero disables it.
+	IdleTimeout time.Duration
+
+	MessageHandlerTimeout    time.Duration
+	DisconnectOnHandlerPanic bool
+
+	// HandlerShards is how many goroutines handle messages of opcodes sharded through
+	// `node.ShardBy()`. Should it be zero, as many goroutines as there are CPUs are spawned.
+	HandlerShards int
+
+	// CoalesceDelay is how long messages of opcodes of class ClassBulk may be held back, such that
+	// many of them are written to a peer at once. Zero disables coalescing. Refer to
+	// `node.SetMessageClass()`.
+	CoalesceDelay time.Duration
+
+	// CoalesceSize is how many bytes of messages held back are written to a peer at once, without
+	// waiting out CoalesceDelay. Should it be zero, 64KB are written at once.
+	CoalesceSize int
+
+	// FramePreamble has peers our node dials be opened a connection to with a preamble, over which
+	// both peers negotiate the newest frame format they speak. Peers which dial our node with a
+	// preamble are answered regardless. Nodes which predate preambles refuse connections opened
+	// with one, and so it should only be set once every peer our node dials is aware of them.
+	FramePreamble bool
+
+	// Store persists the IPs our node bans, such that bans outlive our process. Should it be nil,
+	// bans are only held in memory.
+	Store kv.Store
+
+	// FileDescriptors is how many sockets our node may hold open to peers at once. Should it be
+	// zero, three quarters of the RLIMIT_NOFILE soft limit of our process are budgeted, and should
+	// it be negative, sockets are not budgeted.
+	FileDescriptors int
+
+	// DialHeadroom is how many sockets of the budget are held back for peers our node dials, such
+	// that peers connecting to us may not starve our node of the sockets it needs to dial. Should it
+	// be zero, a tenth of the budget is held back.
+	DialHeadroom int
+
+	// Resources accounts for the memory our node reserves on behalf of its peers, and caps it.
+	// Should it be nil, memory is accounted for yet not capped.
+	Resources *resource.Manager
+
+	// Context bounds the lifetime of our node. Once it is done, our node is killed. Should it be
+	// nil, our node lives until it is killed.
+	Context context.Context
+
+	// Clock is what timeouts, keepalives, bans, and upload rate limits are measured against.
+	// Should it be nil, the system clock is used.
+	Clock clock.Clock
+
+	// Random is what protocols draw decisions which need not be unpredictable from, such as which
+	// peers to sample or relay messages through. Should it be nil, the global source of math/rand is
+	// used. Keys and nonces are always drawn from crypto/rand.
+	Random random.Source
 }
 
 func DefaultParams() parameters {
@@ -36,5 +113,7 @@ func DefaultParams() parameters {
 		ReceiveMessageTimeout: 3 * time.Second,
 
 		SendWorkerBusyTimeout: 3 * time.Second,
+
+		DisconnectOnHandlerPanic: true,
 	}
 }
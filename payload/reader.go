@@ -9,8 +9,11 @@ import (
 
 var _ io.Reader = (*Reader)(nil)
 
+// Reader reads integers in little-endian order by default, which is the canonical order payloads
+// of messages are encoded in. Refer to `WithByteOrder()`.
 type Reader struct {
 	reader *bytes.Reader
+	order  binary.ByteOrder
 }
 
 func NewReader(payload []byte) Reader {
@@ -19,6 +22,21 @@ func NewReader(payload []byte) Reader {
 	}
 }
 
+// WithByteOrder returns a reader which reads integers off of the same payload in a specified byte
+// order, as written by a writer of the same order.
+func (r Reader) WithByteOrder(order binary.ByteOrder) Reader {
+	r.order = order
+	return r
+}
+
+func (r Reader) byteOrder() binary.ByteOrder {
+	if r.order == nil {
+		return binary.LittleEndian
+	}
+
+	return r.order
+}
+
 // Len returns the number of bytes that have not yet been read so far.
 func (r Reader) Len() int {
 	return r.reader.Len()
@@ -62,17 +80,17 @@ func (r Reader) ReadByte() (byte, error) {
 func (r Reader) ReadUint16() (uint16, error) {
 	var buf [2]byte
 	_, err := r.reader.Read(buf[:])
-	return binary.LittleEndian.Uint16(buf[:]), err
+	return r.byteOrder().Uint16(buf[:]), err
 }
 
 func (r Reader) ReadUint32() (uint32, error) {
 	var buf [4]byte
 	_, err := r.reader.Read(buf[:])
-	return binary.LittleEndian.Uint32(buf[:]), err
+	return r.byteOrder().Uint32(buf[:]), err
 }
 
 func (r Reader) ReadUint64() (uint64, error) {
 	var buf [8]byte
 	_, err := r.reader.Read(buf[:])
-	return binary.LittleEndian.Uint64(buf[:]), err
+	return r.byteOrder().Uint64(buf[:]), err
 }
@@ -73,3 +73,32 @@ func TestReader(t *testing.T) {
 	assert.Nil(t, err, "error read uint64")
 	assert.Equal(t, testUint64, actualUint64, "invalid bytes")
 }
+
+func TestByteOrder(t *testing.T) {
+	buf := NewWriter(nil).WithByteOrder(binary.BigEndian).WriteUint16(testUint16).WriteUint32(testUint32).WriteUint64(testUint64).WriteBytes(testBytes).Bytes()
+
+	assert.Equal(t, []byte{0, 10, 0, 0, 0, 11}, buf[:6])
+
+	reader := NewReader(buf).WithByteOrder(binary.BigEndian)
+
+	x16, err := reader.ReadUint16()
+	assert.NoError(t, err)
+	assert.Equal(t, testUint16, x16)
+
+	x32, err := reader.ReadUint32()
+	assert.NoError(t, err)
+	assert.Equal(t, testUint32, x32)
+
+	x64, err := reader.ReadUint64()
+	assert.NoError(t, err)
+	assert.Equal(t, testUint64, x64)
+
+	bytes, err := reader.ReadBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, testBytes, bytes)
+
+	// Integers are read in little-endian order by default.
+	x16, err = NewReader([]byte{10, 0}).ReadUint16()
+	assert.NoError(t, err)
+	assert.Equal(t, testUint16, x16)
+}
@@ -0,0 +1,530 @@
+package payload
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Field is a single tagged field of a struct encoded by Marshal. Fields are encoded as their tag as
+// an unsigned little-endian 16-bit integer, followed by the length of their value as an unsigned
+// little-endian 32-bit integer, followed by their value.
+type Field struct {
+	Tag   uint16
+	Value []byte
+}
+
+// Unknown holds the fields a struct was decoded with which it does not declare, such as fields
+// added by newer versions of a message. Should a struct declare a field of type Unknown, Unmarshal
+// preserves unknown fields in it, and Marshal encodes them back, such that a node may re-encode and
+// forward a message without dropping the fields of newer nodes.
+type Unknown []Field
+
+var unknownType = reflect.TypeOf(Unknown(nil))
+
+// Marshal encodes a struct, or a pointer to one, as a set of tagged fields prefixed with their
+// length as an unsigned little-endian 32-bit integer.
+//
+// Only fields tagged with `payload:"<tag>"` are encoded, where <tag> is a number unique to the
+// field within its struct which must never be reused by another field as the struct evolves.
+// Fields tagged `payload:"<tag>,optional"` may be missing from the messages of older nodes, and are
+// omitted should they be a zero value.
+//
+// Fields may be booleans, integers, strings, byte slices, or structs whose fields are tagged in
+// turn. Integers are encoded in little-endian order.
+func Marshal(v interface{}) ([]byte, error) {
+	val, err := structOf(v)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := encodeStruct(val)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriter(nil).WriteBytes(encodeFields(fields)).Bytes(), nil
+}
+
+// Unmarshal decodes a set of tagged fields encoded by Marshal into the struct pointed to by v.
+// Fields not declared by the struct are preserved in its Unknown field should it have one, and
+// are otherwise dropped. It errors should a field which is not optional be missing.
+func Unmarshal(buf []byte, v interface{}) error {
+	return NewReader(buf).ReadStruct(v)
+}
+
+// ReadStruct reads a set of tagged fields encoded by Marshal into the struct pointed to by v.
+// Refer to Unmarshal.
+func (r Reader) ReadStruct(v interface{}) error {
+	ptr := reflect.ValueOf(v)
+
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Struct {
+		return errors.Errorf("payload: can only unmarshal into a pointer to a struct, not %T", v)
+	}
+
+	buf, err := r.ReadBytes()
+	if err != nil {
+		return errors.Wrap(err, "payload: failed to read fields")
+	}
+
+	fields, err := decodeFields(buf)
+	if err != nil {
+		return err
+	}
+
+	return decodeStruct(ptr.Elem(), fields)
+}
+
+// FieldSchema describes a single tagged field of a struct.
+type FieldSchema struct {
+	Tag      uint16 `json:"tag"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Optional bool   `json:"optional,omitempty"`
+
+	// Fields describes the fields of a field which is a struct.
+	Fields []FieldSchema `json:"fields,omitempty"`
+}
+
+// Schema describes the tagged fields of a struct encoded by Marshal, ordered by their tags. Schemas
+// may be serialized as JSON, such that the schema of a message may be checked into a repository and
+// compared against the schemas of later releases.
+type Schema struct {
+	Name   string        `json:"name"`
+	Fields []FieldSchema `json:"fields"`
+}
+
+// SchemaOf returns the schema of a struct, or of a pointer to one. It errors should the struct
+// declare two fields with the same tag, or a field of a kind Marshal does not support.
+func SchemaOf(v interface{}) (Schema, error) {
+	typ := reflect.TypeOf(v)
+
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return Schema{}, errors.Errorf("payload: %T is not a struct", v)
+	}
+
+	p, err := planOf(typ)
+	if err != nil {
+		return Schema{}, err
+	}
+
+	return Schema{Name: typ.String(), Fields: p.schema()}, nil
+}
+
+// CompatibleWith returns an error should nodes decoding messages with this schema be unable to
+// coexist with nodes decoding messages with an older schema. Both schemas are compatible so long as:
+//
+// 1. fields sharing a tag are of the same kind,
+// 2. every field this schema requires is required by the older schema, and
+// 3. every field the older schema requires is still declared by this schema.
+//
+// In other words, fields may only be added or removed should they be optional.
+func (s Schema) CompatibleWith(older Schema) error {
+	return compatible(s.Fields, older.Fields, "")
+}
+
+func compatible(newer, older []FieldSchema, prefix string) error {
+	previous := make(map[uint16]FieldSchema, len(older))
+
+	for _, field := range older {
+		previous[field.Tag] = field
+	}
+
+	for _, field := range newer {
+		old, exists := previous[field.Tag]
+		delete(previous, field.Tag)
+
+		if !exists {
+			if !field.Optional {
+				return errors.Errorf("payload: added field %s%s (tag %d) must be optional", prefix, field.Name, field.Tag)
+			}
+
+			continue
+		}
+
+		if field.Kind != old.Kind {
+			return errors.Errorf("payload: field %s%s (tag %d) changed from %s to %s", prefix, field.Name, field.Tag, old.Kind, field.Kind)
+		}
+
+		if !field.Optional && old.Optional {
+			return errors.Errorf("payload: field %s%s (tag %d) may no longer be required, as older nodes may omit it", prefix, field.Name, field.Tag)
+		}
+
+		if field.Kind == "struct" {
+			if err := compatible(field.Fields, old.Fields, prefix+field.Name+"."); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, field := range older {
+		if _, removed := previous[field.Tag]; removed && !field.Optional {
+			return errors.Errorf("payload: removed field %s%s (tag %d) is required by older nodes", prefix, field.Name, field.Tag)
+		}
+	}
+
+	return nil
+}
+
+// plan is how the fields of a struct type are encoded and decoded.
+type plan struct {
+	fields []fieldPlan
+
+	// unknown is the index of the Unknown field of the struct, or -1 should it not declare one.
+	unknown int
+}
+
+type fieldPlan struct {
+	index    int
+	tag      uint16
+	name     string
+	optional bool
+	kind     string
+
+	// nested is the plan of a field which is a struct.
+	nested *plan
+}
+
+var plans sync.Map // map[reflect.Type]*plan
+
+func planOf(typ reflect.Type) (*plan, error) {
+	if cached, exists := plans.Load(typ); exists {
+		return cached.(*plan), nil
+	}
+
+	p := &plan{unknown: -1}
+	seen := make(map[uint16]string)
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		if field.Type == unknownType {
+			if field.PkgPath != "" {
+				return nil, errors.Errorf("payload: field %s.%s holding unknown fields must be exported", typ, field.Name)
+			}
+
+			p.unknown = i
+			continue
+		}
+
+		tag, ok := field.Tag.Lookup("payload")
+		if !ok || tag == "-" {
+			continue
+		}
+
+		if field.PkgPath != "" {
+			return nil, errors.Errorf("payload: tagged field %s.%s must be exported", typ, field.Name)
+		}
+
+		options := strings.Split(tag, ",")
+
+		number, err := strconv.ParseUint(options[0], 10, 16)
+		if err != nil {
+			return nil, errors.Errorf("payload: field %s.%s has an invalid tag %q", typ, field.Name, tag)
+		}
+
+		if other, taken := seen[uint16(number)]; taken {
+			return nil, errors.Errorf("payload: fields %s.%s and %s.%s share tag %d", typ, other, typ, field.Name, number)
+		}
+
+		seen[uint16(number)] = field.Name
+
+		fp := fieldPlan{index: i, tag: uint16(number), name: field.Name, kind: kindOf(field.Type)}
+
+		for _, option := range options[1:] {
+			switch option {
+			case "optional":
+				fp.optional = true
+			default:
+				return nil, errors.Errorf("payload: field %s.%s has an unknown tag option %q", typ, field.Name, option)
+			}
+		}
+
+		if fp.kind == "" {
+			return nil, errors.Errorf("payload: field %s.%s is of unsupported type %s", typ, field.Name, field.Type)
+		}
+
+		if fp.kind == "struct" {
+			if fp.nested, err = planOf(field.Type); err != nil {
+				return nil, err
+			}
+		}
+
+		p.fields = append(p.fields, fp)
+	}
+
+	sort.Slice(p.fields, func(i, j int) bool {
+		return p.fields[i].tag < p.fields[j].tag
+	})
+
+	cached, _ := plans.LoadOrStore(typ, p)
+
+	return cached.(*plan), nil
+}
+
+func (p *plan) schema() []FieldSchema {
+	schema := make([]FieldSchema, 0, len(p.fields))
+
+	for _, field := range p.fields {
+		s := FieldSchema{Tag: field.tag, Name: field.name, Kind: field.kind, Optional: field.optional}
+
+		if field.nested != nil {
+			s.Fields = field.nested.schema()
+		}
+
+		schema = append(schema, s)
+	}
+
+	return schema
+}
+
+func kindOf(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Bool, reflect.String, reflect.Struct,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return typ.Kind().String()
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return "bytes"
+		}
+	}
+
+	return ""
+}
+
+func structOf(v interface{}) (reflect.Value, error) {
+	val := reflect.ValueOf(v)
+
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+
+	if val.Kind() != reflect.Struct {
+		return reflect.Value{}, errors.Errorf("payload: can only marshal a struct, not %T", v)
+	}
+
+	return val, nil
+}
+
+func encodeStruct(val reflect.Value) ([]Field, error) {
+	p, err := planOf(val.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]Field, 0, len(p.fields))
+	known := make(map[uint16]struct{}, len(p.fields))
+
+	for _, fp := range p.fields {
+		known[fp.tag] = struct{}{}
+
+		field := val.Field(fp.index)
+
+		if fp.optional && field.IsZero() {
+			continue
+		}
+
+		value, err := encodeValue(field)
+		if err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, Field{Tag: fp.tag, Value: value})
+	}
+
+	if p.unknown >= 0 {
+		for _, field := range val.Field(p.unknown).Interface().(Unknown) {
+			if _, exists := known[field.Tag]; !exists {
+				fields = append(fields, field)
+			}
+		}
+
+		sort.SliceStable(fields, func(i, j int) bool {
+			return fields[i].Tag < fields[j].Tag
+		})
+	}
+
+	return fields, nil
+}
+
+func encodeValue(field reflect.Value) ([]byte, error) {
+	w := NewWriter(nil)
+
+	switch field.Kind() {
+	case reflect.Bool:
+		if field.Bool() {
+			w.WriteByte(1)
+		} else {
+			w.WriteByte(0)
+		}
+	case reflect.Int8:
+		w.WriteByte(byte(field.Int()))
+	case reflect.Int16:
+		w.WriteUint16(uint16(field.Int()))
+	case reflect.Int32:
+		w.WriteUint32(uint32(field.Int()))
+	case reflect.Int64:
+		w.WriteUint64(uint64(field.Int()))
+	case reflect.Uint8:
+		w.WriteByte(byte(field.Uint()))
+	case reflect.Uint16:
+		w.WriteUint16(uint16(field.Uint()))
+	case reflect.Uint32:
+		w.WriteUint32(uint32(field.Uint()))
+	case reflect.Uint64:
+		w.WriteUint64(field.Uint())
+	case reflect.String:
+		_, _ = w.Write([]byte(field.String()))
+	case reflect.Slice:
+		_, _ = w.Write(field.Bytes())
+	case reflect.Struct:
+		fields, err := encodeStruct(field)
+		if err != nil {
+			return nil, err
+		}
+
+		return encodeFields(fields), nil
+	}
+
+	return w.Bytes(), nil
+}
+
+func encodeFields(fields []Field) []byte {
+	w := NewWriter(nil)
+
+	for _, field := range fields {
+		w.WriteUint16(field.Tag)
+		w.WriteBytes(field.Value)
+	}
+
+	return w.Bytes()
+}
+
+func decodeFields(buf []byte) ([]Field, error) {
+	var fields []Field
+
+	seen := make(map[uint16]struct{})
+	r := NewReader(buf)
+
+	for r.Len() > 0 {
+		tag, err := r.ReadUint16()
+		if err != nil {
+			return nil, errors.Wrap(err, "payload: failed to read field tag")
+		}
+
+		value, err := r.ReadBytes()
+		if err != nil {
+			return nil, errors.Wrapf(err, "payload: failed to read field with tag %d", tag)
+		}
+
+		if _, duplicate := seen[tag]; duplicate {
+			return nil, errors.Errorf("payload: field with tag %d was encoded twice", tag)
+		}
+
+		seen[tag] = struct{}{}
+		fields = append(fields, Field{Tag: tag, Value: value})
+	}
+
+	return fields, nil
+}
+
+func decodeStruct(val reflect.Value, fields []Field) error {
+	p, err := planOf(val.Type())
+	if err != nil {
+		return err
+	}
+
+	values := make(map[uint16][]byte, len(fields))
+
+	for _, field := range fields {
+		values[field.Tag] = field.Value
+	}
+
+	for _, fp := range p.fields {
+		value, exists := values[fp.tag]
+		delete(values, fp.tag)
+
+		if !exists {
+			if !fp.optional {
+				return errors.Errorf("payload: missing required field %s (tag %d)", fp.name, fp.tag)
+			}
+
+			continue
+		}
+
+		if err := decodeValue(val.Field(fp.index), value); err != nil {
+			return errors.Wrapf(err, "payload: failed to decode field %s (tag %d)", fp.name, fp.tag)
+		}
+	}
+
+	if p.unknown >= 0 {
+		var unknown Unknown
+
+		for _, field := range fields {
+			if _, left := values[field.Tag]; left {
+				unknown = append(unknown, field)
+			}
+		}
+
+		val.Field(p.unknown).Set(reflect.ValueOf(unknown))
+	}
+
+	return nil
+}
+
+// widths are the number of bytes booleans and integers are encoded with.
+var widths = map[reflect.Kind]int{
+	reflect.Bool: 1, reflect.Int8: 1, reflect.Uint8: 1,
+	reflect.Int16: 2, reflect.Uint16: 2,
+	reflect.Int32: 4, reflect.Uint32: 4,
+	reflect.Int64: 8, reflect.Uint64: 8,
+}
+
+func decodeValue(field reflect.Value, value []byte) error {
+	if width := widths[field.Kind()]; width > 0 && len(value) != width {
+		return errors.Errorf("expected %d byte(s), got %d", width, len(value))
+	}
+
+	switch field.Kind() {
+	case reflect.Bool:
+		field.SetBool(value[0] != 0)
+	case reflect.Int8:
+		field.SetInt(int64(int8(value[0])))
+	case reflect.Int16:
+		field.SetInt(int64(int16(binary.LittleEndian.Uint16(value))))
+	case reflect.Int32:
+		field.SetInt(int64(int32(binary.LittleEndian.Uint32(value))))
+	case reflect.Int64:
+		field.SetInt(int64(binary.LittleEndian.Uint64(value)))
+	case reflect.Uint8:
+		field.SetUint(uint64(value[0]))
+	case reflect.Uint16:
+		field.SetUint(uint64(binary.LittleEndian.Uint16(value)))
+	case reflect.Uint32:
+		field.SetUint(uint64(binary.LittleEndian.Uint32(value)))
+	case reflect.Uint64:
+		field.SetUint(binary.LittleEndian.Uint64(value))
+	case reflect.String:
+		field.SetString(string(value))
+	case reflect.Slice:
+		field.SetBytes(append([]byte(nil), value...))
+	case reflect.Struct:
+		fields, err := decodeFields(value)
+		if err != nil {
+			return err
+		}
+
+		return decodeStruct(field, fields)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package payload
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type helloV1 struct {
+	ID      uint64 `payload:"1"`
+	Name    string `payload:"2"`
+	Address string `payload:"3,optional"`
+
+	Unknown Unknown
+}
+
+type helloV2 struct {
+	ID      uint64 `payload:"1"`
+	Name    string `payload:"2"`
+	Address string `payload:"3,optional"`
+
+	Flags   uint16 `payload:"4,optional"`
+	Key     []byte `payload:"5,optional"`
+	Version struct {
+		Major int8 `payload:"1"`
+		Minor int8 `payload:"2,optional"`
+	} `payload:"6,optional"`
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	var hello helloV2
+
+	hello.ID = 42
+	hello.Name = "alice"
+	hello.Key = []byte{1, 2, 3}
+	hello.Version.Major = -1
+	hello.Version.Minor = 3
+
+	buf, err := Marshal(&hello)
+	assert.NoError(t, err)
+
+	var decoded helloV2
+	assert.NoError(t, Unmarshal(buf, &decoded))
+	assert.Equal(t, hello, decoded)
+}
+
+func TestUnknownFieldsPreserved(t *testing.T) {
+	newer := helloV2{ID: 7, Name: "bob", Flags: 0xbeef}
+
+	buf, err := Marshal(newer)
+	assert.NoError(t, err)
+
+	// An older node decodes the message, and re-encodes it after changing a field it knows of.
+	var older helloV1
+	assert.NoError(t, Unmarshal(buf, &older))
+	assert.Len(t, older.Unknown, 1)
+
+	older.Address = "127.0.0.1:3000"
+
+	buf, err = Marshal(older)
+	assert.NoError(t, err)
+
+	var decoded helloV2
+	assert.NoError(t, Unmarshal(buf, &decoded))
+
+	assert.EqualValues(t, 0xbeef, decoded.Flags)
+	assert.Equal(t, "127.0.0.1:3000", decoded.Address)
+}
+
+func TestMissingRequiredField(t *testing.T) {
+	type partial struct {
+		ID uint64 `payload:"1"`
+	}
+
+	buf, err := Marshal(partial{ID: 1})
+	assert.NoError(t, err)
+
+	assert.Error(t, Unmarshal(buf, &helloV1{}))
+}
+
+func TestMalformedFields(t *testing.T) {
+	buf, err := Marshal(helloV1{ID: 1, Name: "carol"})
+	assert.NoError(t, err)
+
+	assert.Error(t, Unmarshal(buf[:len(buf)-1], &helloV1{}))
+
+	type narrow struct {
+		ID uint32 `payload:"1"`
+	}
+
+	assert.Error(t, Unmarshal(buf, &narrow{}))
+
+	type duplicate struct {
+		A uint8 `payload:"1"`
+		B uint8 `payload:"1"`
+	}
+
+	_, err = Marshal(duplicate{})
+	assert.Error(t, err)
+}
+
+func TestSchemaCompatibility(t *testing.T) {
+	v1, err := SchemaOf((*helloV1)(nil))
+	assert.NoError(t, err)
+
+	v2, err := SchemaOf(helloV2{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, v2.CompatibleWith(v1))
+	assert.NoError(t, v1.CompatibleWith(v2))
+
+	// Schemas survive being serialized as JSON.
+	buf, err := json.Marshal(v1)
+	assert.NoError(t, err)
+
+	var decoded Schema
+	assert.NoError(t, json.Unmarshal(buf, &decoded))
+	assert.NoError(t, v2.CompatibleWith(decoded))
+
+	type required struct {
+		ID      uint64 `payload:"1"`
+		Name    string `payload:"2"`
+		Address string `payload:"3"`
+	}
+
+	type retyped struct {
+		ID   uint32 `payload:"1"`
+		Name string `payload:"2"`
+	}
+
+	type removed struct {
+		ID uint64 `payload:"1"`
+	}
+
+	for _, v := range []interface{}{required{}, retyped{}, removed{}} {
+		schema, err := SchemaOf(v)
+		assert.NoError(t, err)
+		assert.Error(t, schema.CompatibleWith(v1), "%T should be incompatible", v)
+	}
+}
@@ -8,8 +8,11 @@ import (
 
 var _ io.Writer = (*Writer)(nil)
 
+// Writer writes integers in little-endian order by default, which is the canonical order payloads
+// of messages are encoded in. Refer to `WithByteOrder()`.
 type Writer struct {
 	buffer *bytes.Buffer
+	order  binary.ByteOrder
 }
 
 func NewWriter(buf []byte) Writer {
@@ -18,6 +21,22 @@ func NewWriter(buf []byte) Writer {
 	}
 }
 
+// WithByteOrder returns a writer which writes integers to the same buffer in a specified byte
+// order, such as for messages which mirror the wire format of an external protocol. Both ends must
+// read and write a message in the same order.
+func (b Writer) WithByteOrder(order binary.ByteOrder) Writer {
+	b.order = order
+	return b
+}
+
+func (b Writer) byteOrder() binary.ByteOrder {
+	if b.order == nil {
+		return binary.LittleEndian
+	}
+
+	return b.order
+}
+
 // Len returns the number of bytes written so far.
 func (b Writer) Len() int {
 	return b.buffer.Len()
@@ -52,7 +71,7 @@ func (b Writer) WriteByte(x byte) Writer {
 
 func (b Writer) WriteUint16(x uint16) Writer {
 	var buf [2]byte
-	binary.LittleEndian.PutUint16(buf[:], x)
+	b.byteOrder().PutUint16(buf[:], x)
 	_, _ = b.Write(buf[:])
 
 	return b
@@ -60,7 +79,7 @@ func (b Writer) WriteUint16(x uint16) Writer {
 
 func (b Writer) WriteUint32(x uint32) Writer {
 	var buf [4]byte
-	binary.LittleEndian.PutUint32(buf[:], x)
+	b.byteOrder().PutUint32(buf[:], x)
 	_, _ = b.Write(buf[:])
 
 	return b
@@ -68,7 +87,7 @@ func (b Writer) WriteUint32(x uint32) Writer {
 
 func (b Writer) WriteUint64(x uint64) Writer {
 	var buf [8]byte
-	binary.LittleEndian.PutUint64(buf[:], x)
+	b.byteOrder().PutUint64(buf[:], x)
 	_, _ = b.Write(buf[:])
 
 	return b
@@ -1,15 +1,18 @@
 package noise
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"github.com/perlin-network/noise/callbacks"
 	"github.com/perlin-network/noise/log"
 	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/resource"
+	"github.com/perlin-network/noise/transport"
 	"github.com/pkg/errors"
 	"io"
 	"net"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,6 +22,14 @@ import (
 type receiveHandle struct {
 	hub  chan Message
 	lock chan struct{}
+
+	// handled is signalled once a message delivered through hub has been handled, which the
+	// receive worker waits on should the peer be strictly ordered.
+	handled chan struct{}
+}
+
+func newReceiveHandle() receiveHandle {
+	return receiveHandle{hub: make(chan Message), lock: make(chan struct{}, 1), handled: make(chan struct{}, 1)}
 }
 
 func (r *receiveHandle) Unlock() {
@@ -28,14 +39,46 @@ func (r *receiveHandle) Unlock() {
 type sendHandle struct {
 	payload []byte
 	result  chan error
+
+	// fin marks the message which half-closes the connection, after which no messages are sent.
+	fin bool
+
+	// heartbeat marks a standalone heartbeat, which is written as a zero-length frame.
+	heartbeat bool
+
+	// preamble marks a preamble answering or confirming the frame format negotiated with a peer,
+	// which is written as is, and after which messages are framed as per framing.
+	preamble bool
+	framing  Framing
+
+	// final marks the message announcing why the connection is about to be closed, which is sent
+	// even after the connection was half-closed.
+	final bool
+
+	// bulk marks a message which may be held back, such that it is coalesced with the messages sent
+	// after it.
+	bulk bool
 }
 
 type Peer struct {
 	node *Node
 	conn net.Conn
 
-	onConnErrorCallbacks  *callbacks.SequentialCallbackManager
-	onDisconnectCallbacks *callbacks.SequentialCallbackManager
+	// dialed is set should the peer have been dialed by our node, rather than accepted.
+	dialed bool
+
+	readBuffer *readBuffer
+
+	// framing is the frame format negotiated with the peer. preamblesRead is the number of preambles
+	// read from the peer, and readFraming is the format frames read from the peer are framed with,
+	// both of which are only accessed by the receive worker of the peer.
+	framing       atomic.Value // Framing
+	preamblesRead int
+	readFraming   Framing
+
+	onConnErrorCallbacks        *callbacks.SequentialCallbackManager
+	onDisconnectCallbacks       *callbacks.SequentialCallbackManager
+	onRemoteCloseWriteCallbacks *callbacks.SequentialCallbackManager
 
 	onEncodeHeaderCallbacks *callbacks.ReduceCallbackManager
 	onEncodeFooterCallbacks *callbacks.ReduceCallbackManager
@@ -43,6 +86,9 @@ type Peer struct {
 	onDecodeHeaderCallbacks *callbacks.SequentialCallbackManager
 	onDecodeFooterCallbacks *callbacks.SequentialCallbackManager
 
+	onEncodeExtensionsCallbacks *callbacks.ReduceCallbackManager
+	onDecodeExtensionsCallbacks *callbacks.SequentialCallbackManager
+
 	beforeMessageSentCallbacks     *callbacks.ReduceCallbackManager
 	beforeMessageReceivedCallbacks *callbacks.ReduceCallbackManager
 
@@ -55,6 +101,25 @@ type Peer struct {
 	kill     chan *sync.WaitGroup
 	killOnce uint32
 
+	// writeClosed is set once CloseWrite is called, finSent once the marker half-closing the
+	// connection has been written, and remoteWriteClosed once the peer half-closed the connection.
+	writeClosed       uint32
+	finSent           uint32
+	remoteWriteClosed uint32
+
+	// lastSent and lastReceived are when anything was last sent to, or received from, the peer, and
+	// lastActive is when a message other than a heartbeat was last sent or received, in nanoseconds
+	// since the Unix epoch. They are only tracked should keepalives or idle timeouts be enabled.
+	lastSent, lastReceived, lastActive int64
+
+	// remoteReason is one more than the reason the peer announced for closing the connection, or zero
+	// should the peer not have announced any.
+	remoteReason uint32
+
+	// strictOrdering is set should messages from the peer be handled strictly in the order they were
+	// received across all opcodes.
+	strictOrdering uint32
+
 	metadata sync.Map
 }
 
@@ -63,8 +128,13 @@ func newPeer(node *Node, conn net.Conn) *Peer {
 		node: node,
 		conn: conn,
 
-		onConnErrorCallbacks:  callbacks.NewSequentialCallbackManager(),
-		onDisconnectCallbacks: callbacks.NewSequentialCallbackManager(),
+		readBuffer: newReadBuffer(conn),
+
+		readFraming: legacyFraming,
+
+		onConnErrorCallbacks:        callbacks.NewSequentialCallbackManager(),
+		onDisconnectCallbacks:       callbacks.NewSequentialCallbackManager(),
+		onRemoteCloseWriteCallbacks: callbacks.NewSequentialCallbackManager(),
 
 		onEncodeHeaderCallbacks: callbacks.NewReduceCallbackManager(),
 		onEncodeFooterCallbacks: callbacks.NewReduceCallbackManager(),
@@ -72,6 +142,9 @@ func newPeer(node *Node, conn net.Conn) *Peer {
 		onDecodeHeaderCallbacks: callbacks.NewSequentialCallbackManager(),
 		onDecodeFooterCallbacks: callbacks.NewSequentialCallbackManager(),
 
+		onEncodeExtensionsCallbacks: callbacks.NewReduceCallbackManager(),
+		onDecodeExtensionsCallbacks: callbacks.NewSequentialCallbackManager(),
+
 		beforeMessageReceivedCallbacks: callbacks.NewReduceCallbackManager().UnsafelySetReverse(),
 		beforeMessageSentCallbacks:     callbacks.NewReduceCallbackManager(),
 
@@ -85,23 +158,125 @@ func newPeer(node *Node, conn net.Conn) *Peer {
 }
 
 func (p *Peer) init() {
-	go p.spawnSendWorker()
-	go p.spawnReceiveWorker()
+	p.node.fds.add(1)
+
+	if p.node.keepalive != nil {
+		p.node.keepalive.add(p)
+	}
+
+	p.node.peers.add(p)
+
+	p.node.group.Go(func(ctx context.Context) error {
+		p.spawnSendWorker()
+		return nil
+	})
+
+	p.node.group.Go(func(ctx context.Context) error {
+		p.spawnReceiveWorker()
+		return nil
+	})
+
+	// Peers taken on while our node is being killed are not disconnected by it.
+	if atomic.LoadUint32(&p.node.killOnce) == 1 {
+		p.DisconnectAsync()
+	}
 }
 
 func (p *Peer) spawnSendWorker() {
+	// Messages held back to be coalesced, alongside their frames and when they are to be flushed.
+	var (
+		held   []sendHandle
+		frames []byte
+		flush  <-chan time.Time
+	)
+
+	if p.node.coalesceDelay > 0 {
+		if conn, ok := p.conn.(noDelayConn); ok {
+			if err := conn.SetNoDelay(true); err != nil {
+				log.Warn().Err(err).Msg("Failed to set TCP_NODELAY on a connection whose messages are coalesced.")
+			}
+		}
+	}
+
+	p.openFraming()
+
+	// framing is the format messages are framed with, which changes once our preamble answering or
+	// confirming the format negotiated with the peer is written.
+	framing := legacyFraming
+
 	for {
 		var cmd sendHandle
 
 		select {
 		case wg := <-p.kill:
+			for _, held := range held {
+				if held.result != nil {
+					held.result <- errors.New("peer disconnected before message could be sent")
+					close(held.result)
+				}
+			}
+
 			wg.Done()
 			return
+		case <-flush:
+			p.write(held, frames)
+			held, frames, flush = nil, nil, nil
+			continue
 		case cmd = <-p.sendQueue:
 		}
 
+		// Heartbeats are not messages, and so are written even after the connection was half-closed.
+		if cmd.heartbeat {
+			if len(held) > 0 {
+				p.write(held, frames)
+				held, frames, flush = nil, nil, nil
+			}
+
+			if _, err := p.conn.Write([]byte{0}); err == nil {
+				atomic.StoreInt64(&p.lastSent, p.node.clock.Now().UnixNano())
+			}
+			continue
+		}
+
+		if cmd.preamble {
+			if len(held) > 0 {
+				p.write(held, frames)
+				held, frames, flush = nil, nil, nil
+			}
+
+			if _, err := p.conn.Write(cmd.payload); err != nil {
+				p.onConnErrorCallbacks.RunCallbacks(p.node, errors.Wrap(err, "failed to send preamble"))
+			}
+
+			framing = cmd.framing
+			continue
+		}
+
+		if atomic.LoadUint32(&p.finSent) == 1 && !cmd.final {
+			if cmd.result != nil {
+				cmd.result <- ErrWriteClosed
+				close(cmd.result)
+			}
+			continue
+		}
+
 		payload := cmd.payload
 
+		var extensions []byte
+
+		if framing.Flags&FrameExtensions != 0 {
+			e, errs := p.onEncodeExtensionsCallbacks.RunCallbacks(Extensions(nil), p.node, payload)
+			if len(errs) > 0 {
+				if cmd.result != nil {
+					cmd.result <- errors.Wrap(errs[0], "got errors running OnEncodeExtensions callbacks")
+					close(cmd.result)
+				}
+				continue
+			}
+
+			extensions = encodeExtensions(e.(Extensions))
+		}
+
 		pp, errs := p.beforeMessageSentCallbacks.RunCallbacks(payload, p.node)
 		if len(errs) > 0 {
 			if cmd.result != nil {
@@ -119,32 +294,83 @@ func (p *Peer) spawnSendWorker() {
 		}
 		payload = pp.([]byte)
 
-		size := len(payload)
+		size := len(extensions) + len(payload)
 
 		// Prepend message length to packet.
-		buf := make([]byte, binary.MaxVarintLen64)
+		buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+size)
 		prepended := binary.PutUvarint(buf[:], uint64(size))
 
-		buf = append(buf[:prepended], payload[:]...)
+		buf = append(buf[:prepended], extensions...)
+		buf = append(buf, payload[:]...)
+
+		if p.node.scheduler != nil {
+			if wg := p.node.scheduler.acquire(p, len(buf)); wg != nil {
+				if cmd.result != nil {
+					cmd.result <- errors.New("peer disconnected before message could be sent")
+					close(cmd.result)
+				}
 
-		copied, err := io.Copy(p.conn, bytes.NewReader(buf))
+				for _, held := range held {
+					if held.result != nil {
+						held.result <- errors.New("peer disconnected before message could be sent")
+						close(held.result)
+					}
+				}
 
-		if copied != int64(size+prepended) {
-			if cmd.result != nil {
-				cmd.result <- errors.Errorf("only written %d bytes when expected to write %d bytes to peer", copied, size+prepended)
-				close(cmd.result)
+				wg.Done()
+				return
+			}
+		}
+
+		held = append(held, cmd)
+		frames = append(frames, buf...)
+
+		// Messages which are not coalesced flush every message held back before them, such that
+		// messages are written in the order they were sent.
+		if cmd.bulk && !cmd.fin && len(frames) < p.node.coalesceSize {
+			if flush == nil {
+				flush = p.node.clock.After(p.node.coalesceDelay)
 			}
 			continue
 		}
 
-		if err != nil {
+		p.write(held, frames)
+		held, frames, flush = nil, nil, nil
+	}
+}
+
+// write writes the frames of messages to the peer at once, and reports to the senders of the
+// messages whether they were sent.
+func (p *Peer) write(cmds []sendHandle, frames []byte) {
+	fail := func(err error) {
+		for _, cmd := range cmds {
 			if cmd.result != nil {
-				cmd.result <- errors.Wrap(err, "failed to send message to peer")
+				cmd.result <- err
 				close(cmd.result)
 			}
-			continue
 		}
+	}
+
+	copied, err := io.Copy(p.conn, bytes.NewReader(frames))
+
+	if copied != int64(len(frames)) {
+		fail(errors.Errorf("only written %d bytes when expected to write %d bytes to peer", copied, len(frames)))
+		return
+	}
 
+	if err != nil {
+		fail(errors.Wrap(err, "failed to send message to peer"))
+		return
+	}
+
+	if p.node.keepalive != nil {
+		now := p.node.clock.Now().UnixNano()
+
+		atomic.StoreInt64(&p.lastSent, now)
+		atomic.StoreInt64(&p.lastActive, now)
+	}
+
+	for _, cmd := range cmds {
 		if errs := p.afterMessageSentCallbacks.RunCallbacks(p.node); len(errs) > 0 {
 			if cmd.result != nil {
 				var err = errs[0]
@@ -161,6 +387,15 @@ func (p *Peer) spawnSendWorker() {
 			continue
 		}
 
+		if cmd.fin {
+			atomic.StoreUint32(&p.finSent, 1)
+
+			// Both sides have half-closed the connection, so there is nothing left to send or receive.
+			if atomic.LoadUint32(&p.remoteWriteClosed) == 1 {
+				p.DisconnectAsync()
+			}
+		}
+
 		if cmd.result != nil {
 			cmd.result <- nil
 			close(cmd.result)
@@ -169,9 +404,24 @@ func (p *Peer) spawnSendWorker() {
 }
 
 func (p *Peer) spawnReceiveWorker() {
-	reader := bufio.NewReader(p.conn)
+	reader := p.readBuffer
+
+	// reserved is the number of bytes reserved for the message last read, which are released
+	// once the message has been handled.
+	var reserved uint64
+
+	// first is set until the first frame has been read from the peer, which alone may be a preamble
+	// should the peer have dialed us.
+	first := true
+
+	defer func() {
+		p.node.resources.Release(p, resource.ProtocolMessages, reserved)
+	}()
 
 	for {
+		p.node.resources.Release(p, resource.ProtocolMessages, reserved)
+		reserved = 0
+
 		select {
 		case wg := <-p.kill:
 			wg.Done()
@@ -189,13 +439,50 @@ func (p *Peer) spawnReceiveWorker() {
 			continue
 		}
 
+		if size == frameMagic {
+			wg, err := p.receivePreamble(first)
+			if wg != nil {
+				wg.Done()
+				return
+			}
+
+			if err != nil {
+				p.dropMalformed(err)
+			}
+
+			first = false
+			continue
+		}
+
+		first = false
+
+		if p.node.keepalive != nil {
+			atomic.StoreInt64(&p.lastReceived, p.node.clock.Now().UnixNano())
+		}
+
+		// A zero-length frame is a standalone heartbeat, as every message is at least an opcode long.
+		if size == 0 {
+			continue
+		}
+
+		if p.node.keepalive != nil {
+			atomic.StoreInt64(&p.lastActive, p.node.clock.Now().UnixNano())
+		}
+
 		if size > p.node.maxMessageSize {
-			p.onConnErrorCallbacks.RunCallbacks(p.node, errors.Errorf("exceeded max message size; got size %d", size))
+			p.dropMalformed(errors.Wrapf(ErrMessageTooLarge, "got size %d when max is %d", size, p.node.maxMessageSize))
+			continue
+		}
+
+		if err := p.node.resources.Reserve(p, resource.ProtocolMessages, size); err != nil {
+			p.onConnErrorCallbacks.RunCallbacks(p.node, errors.Wrapf(err, "refused to read a message of %d bytes", size))
 
 			p.DisconnectAsync()
 			continue
 		}
 
+		reserved = size
+
 		buf := make([]byte, int(size))
 
 		seen, err := io.ReadFull(reader, buf)
@@ -213,36 +500,114 @@ func (p *Peer) spawnReceiveWorker() {
 			continue
 		}
 
+		var extensions Extensions
+
+		if p.readFraming.Flags&FrameExtensions != 0 {
+			if extensions, buf, err = decodeExtensions(buf); err != nil {
+				p.dropMalformed(err)
+				continue
+			}
+
+			if len(extensions) > 0 {
+				if errs := p.onDecodeExtensionsCallbacks.RunCallbacks(p.node, extensions); len(errs) > 0 {
+					p.dropMalformed(errors.Wrap(errs[0], "got errors running OnDecodeExtensions callbacks"))
+					continue
+				}
+			}
+		}
+
 		b, errs := p.beforeMessageReceivedCallbacks.RunCallbacks(buf, p.node)
 		if len(errs) > 0 {
-			log.Warn().Errs("errors", errs).Msg("Got errors running BeforeMessageReceived callbacks.")
-
-			p.DisconnectAsync()
+			p.dropMalformed(errors.Wrap(errs[0], "got errors running BeforeMessageReceived callbacks"))
 			continue
 		}
 		buf = b.([]byte)
 
+		p.readBuffer.observe(int(size))
+
 		opcode, msg, err := p.DecodeMessage(buf)
 
-		if opcode == OpcodeNil || err != nil {
-			p.onConnErrorCallbacks.RunCallbacks(p.node, errors.Wrap(err, "failed to decode message"))
+		if err != nil {
+			p.dropMalformed(errors.Wrap(err, "failed to decode message"))
+			continue
+		}
+
+		// The peer is about to close the connection, and has told us why.
+		if opcode == OpcodeDisconnect {
+			dm, ok := msg.(DisconnectMessage)
+			if !ok {
+				p.dropMalformed(errors.Errorf("got a message of type %T under the opcode reserved for disconnects", msg))
+				continue
+			}
+
+			reason := dm.Reason
+
+			atomic.StoreUint32(&p.remoteReason, uint32(reason)+1)
+
+			log.Debug().Str("address", p.conn.RemoteAddr().String()).Str("reason", reason.String()).Msg("Peer announced it is disconnecting from us.")
 
 			p.DisconnectAsync()
 			continue
 		}
 
-		c, _ := p.receiveQueues.LoadOrStore(opcode, receiveHandle{hub: make(chan Message), lock: make(chan struct{}, 1)})
-		recv := c.(receiveHandle)
+		if atomic.LoadUint32(&p.remoteWriteClosed) == 1 {
+			p.dropMalformed(errors.Errorf("got a message with opcode %d after the peer half-closed the connection", opcode))
+			continue
+		}
+
+		// An empty message marks that the peer half-closed the connection.
+		if opcode == OpcodeNil {
+			atomic.StoreUint32(&p.remoteWriteClosed, 1)
+
+			p.onRemoteCloseWriteCallbacks.RunCallbacks(p.node)
+
+			if atomic.LoadUint32(&p.finSent) == 1 {
+				p.DisconnectAsync()
+			}
 
-		select {
-		case recv.hub <- msg:
-			recv.lock <- struct{}{}
-			<-recv.lock
-		case <-time.After(p.node.receiveMessageTimeout):
-			p.DisconnectAsync()
 			continue
 		}
 
+		if handlers := p.node.messageHandlers(opcode); handlers != nil {
+			if shard := p.node.shard(opcode, p, msg); shard != nil {
+				select {
+				case shard <- func() { p.handleMessage(handlers, opcode, msg, extensions) }:
+				case <-p.node.group.Context().Done():
+				}
+			} else {
+				p.handleMessage(handlers, opcode, msg, extensions)
+			}
+		} else {
+			c, _ := p.receiveQueues.LoadOrStore(opcode, newReceiveHandle())
+			recv := c.(receiveHandle)
+
+			strict := atomic.LoadUint32(&p.strictOrdering) == 1
+
+			// Drop signals left over from messages handed off before the peer was strictly ordered.
+			select {
+			case <-recv.handled:
+			default:
+			}
+
+			select {
+			case recv.hub <- msg:
+				recv.lock <- struct{}{}
+				<-recv.lock
+			case <-p.node.clock.After(p.node.receiveMessageTimeout):
+				p.onConnErrorCallbacks.RunCallbacks(p.node, errors.Wrapf(ErrReceiveTimeout, "no handler received message with opcode %d", opcode))
+
+				p.DisconnectAsync()
+				continue
+			}
+
+			if strict {
+				if wg := p.waitUntilHandled(recv, opcode); wg != nil {
+					wg.Done()
+					return
+				}
+			}
+		}
+
 		if errs := p.afterMessageReceivedCallbacks.RunCallbacks(p.node); len(errs) > 0 {
 			log.Warn().Errs("errors", errs).Msg("Got errors running AfterMessageReceived callbacks.")
 
@@ -252,6 +617,105 @@ func (p *Peer) spawnReceiveWorker() {
 	}
 }
 
+// waitUntilHandled blocks until a message handed off through `Receive()` is marked as handled. Should
+// a timeout be set for the opcode, it is reported once exceeded, though the message is still waited
+// on such that messages are never handled out of order. Should the peer be disconnected while
+// waiting, it returns the wait group its receive worker was signalled to stop with.
+func (p *Peer) waitUntilHandled(recv receiveHandle, opcode Opcode) *sync.WaitGroup {
+	var timeout <-chan time.Time
+
+	if d := p.node.messageHandlerTimeoutFor(opcode); d > 0 {
+		timeout = p.node.clock.After(d)
+	}
+
+	for {
+		select {
+		case <-recv.handled:
+			return nil
+		case wg := <-p.kill:
+			return wg
+		case <-timeout:
+			p.node.reportMessageHandlerTimeout(opcode, p, p.node.messageHandlerTimeoutFor(opcode))
+			timeout = nil
+		}
+	}
+}
+
+// dropMalformed reports why a message received from the peer was rejected, and disconnects the
+// peer. Messages which are too large, fail to be authenticated, or fail to be decoded are all
+// dropped the same way: nothing is written back to the peer, and the connection is closed right
+// away. A peer thus may not tell apart why a message it sent was rejected, such that it may not
+// use our node as an oracle to probe which of its forged messages got past which check.
+//
+// The reason is only ever reported locally to callbacks registered through OnConnError.
+func (p *Peer) dropMalformed(err error) {
+	p.onConnErrorCallbacks.RunCallbacks(p.node, err)
+	p.DisconnectAsync()
+}
+
+// handleMessage runs all callbacks registered to handle messages of a given opcode. Should a timeout
+// be set for the opcode, it stops waiting on the callbacks once they have exceeded the timeout.
+func (p *Peer) handleMessage(handlers *callbacks.SequentialCallbackManager, opcode Opcode, msg Message, extensions Extensions) {
+	ctx := context.Background()
+
+	if len(extensions) > 0 {
+		ctx = context.WithValue(ctx, contextKeyExtensions{}, extensions)
+	}
+
+	timeout := p.node.messageHandlerTimeoutFor(opcode)
+
+	if timeout <= 0 {
+		p.runMessageHandlers(ctx, handlers, opcode, msg)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		p.runMessageHandlers(ctx, handlers, opcode, msg)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+		p.node.reportMessageHandlerTimeout(opcode, p, timeout)
+	}
+
+	// Wait for the slow callbacks to return so that callbacks never handle messages from the
+	// same peer concurrently, and so that no goroutine is left running detached.
+	<-done
+}
+
+// runMessageHandlers runs all callbacks registered to handle messages of a given opcode, isolating
+// our node from any panics that occur within them.
+func (p *Peer) runMessageHandlers(ctx context.Context, handlers *callbacks.SequentialCallbackManager, opcode Opcode, msg Message) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().
+				Interface("panic", r).
+				Uint8("opcode", uint8(opcode)).
+				Str("peer", p.conn.RemoteAddr().String()).
+				Bytes("stack", debug.Stack()).
+				Msg("Recovered from a panic in a message handler.")
+
+			p.onConnErrorCallbacks.RunCallbacks(p.node, errors.Wrapf(ErrHandlerPanicked, "handler for opcode %d panicked: %v", opcode, r))
+
+			if p.node.disconnectOnHandlerPanic {
+				p.DisconnectAsync()
+			}
+		}
+	}()
+
+	p.node.profileHandler(ctx, p, opcode, msg, func(ctx context.Context) {
+		handlers.RunCallbacks(ctx, p, msg)
+	})
+}
+
 // SendMessage sends a message whose type is registered with Noise to a specified peer. Calling
 // this function will block the current goroutine until the message is successfully sent. In
 // order to not block, refer to `SendMessageAsync(message Message) <-chan error`.
@@ -261,23 +725,27 @@ func (p *Peer) spawnReceiveWorker() {
 // It returns an error should it take too long to send a message, the message is not registered
 // with Noise, or there are message that are blocking the peers send worker.
 func (p *Peer) SendMessage(message Message) error {
+	if err := p.checkSend(message); err != nil {
+		return err
+	}
+
 	payload, err := p.EncodeMessage(message)
 	if err != nil {
 		return errors.Wrap(err, "failed to serialize message contents to be sent to a peer")
 	}
 
-	cmd := sendHandle{payload: payload, result: make(chan error, 1)}
+	cmd := sendHandle{payload: payload, result: make(chan error, 1), bulk: p.node.coalesces(message)}
 
 	select {
-	case <-time.After(p.node.sendWorkerBusyTimeout):
+	case <-p.node.clock.After(p.node.sendWorkerBusyTimeout):
 		close(cmd.result)
-		return errors.New("send message queue is full and not being processed")
+		return ErrSendQueueFull
 	case p.sendQueue <- cmd:
 	}
 
 	select {
-	case <-time.After(p.node.sendMessageTimeout):
-		return errors.New("timed out attempting to send a message")
+	case <-p.node.clock.After(p.node.sendMessageTimeout):
+		return ErrSendTimeout
 	case err = <-cmd.result:
 		return err
 	}
@@ -294,17 +762,22 @@ func (p *Peer) SendMessage(message Message) error {
 func (p *Peer) SendMessageAsync(message Message) <-chan error {
 	result := make(chan error, 1)
 
+	if err := p.checkSend(message); err != nil {
+		result <- err
+		return result
+	}
+
 	payload, err := p.EncodeMessage(message)
 	if err != nil {
 		result <- errors.Wrap(err, "failed to serialize message contents to be sent to a peer")
 		return result
 	}
 
-	cmd := sendHandle{payload: payload, result: result}
+	cmd := sendHandle{payload: payload, result: result, bulk: p.node.coalesces(message)}
 
 	select {
-	case <-time.After(p.node.sendWorkerBusyTimeout):
-		result <- errors.New("send message queue is full and not being processed")
+	case <-p.node.clock.After(p.node.sendWorkerBusyTimeout):
+		result <- ErrSendQueueFull
 		return result
 	case p.sendQueue <- cmd:
 	}
@@ -312,6 +785,61 @@ func (p *Peer) SendMessageAsync(message Message) <-chan error {
 	return result
 }
 
+func (p *Peer) checkSend(message Message) error {
+	if atomic.LoadUint32(&p.writeClosed) == 1 {
+		return ErrWriteClosed
+	}
+
+	if _, empty := message.(EmptyMessage); empty {
+		return errors.New("noise: empty messages are reserved for half-closing connections; call CloseWrite instead")
+	}
+
+	if _, disconnect := message.(DisconnectMessage); disconnect {
+		return errors.New("noise: disconnect messages are reserved for closing connections; call DisconnectWithReason instead")
+	}
+
+	return nil
+}
+
+// CloseWrite half-closes the connection to the peer, signalling that no more messages will be sent
+// to it while messages it sends continue to be received. Messages queued beforehand are still sent,
+// after which an empty message marking the half-close is sent. Messages sent afterwards fail with
+// ErrWriteClosed.
+//
+// Once both sides have half-closed the connection, the peer is disconnected. Calling CloseWrite more
+// than once does nothing.
+func (p *Peer) CloseWrite() error {
+	if !atomic.CompareAndSwapUint32(&p.writeClosed, 0, 1) {
+		return nil
+	}
+
+	payload, err := p.EncodeMessage(EmptyMessage{})
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize message half-closing the connection")
+	}
+
+	cmd := sendHandle{payload: payload, result: make(chan error, 1), fin: true}
+
+	select {
+	case <-p.node.clock.After(p.node.sendWorkerBusyTimeout):
+		return ErrSendQueueFull
+	case p.sendQueue <- cmd:
+	}
+
+	select {
+	case <-p.node.clock.After(p.node.sendMessageTimeout):
+		return ErrSendTimeout
+	case err = <-cmd.result:
+		return err
+	}
+}
+
+// RemoteWriteClosed reports whether the peer has half-closed the connection, such that it will not
+// send us any more messages.
+func (p *Peer) RemoteWriteClosed() bool {
+	return atomic.LoadUint32(&p.remoteWriteClosed) == 1
+}
+
 // BeforeMessageSent registers a callback to be called before a message
 // is sent to a specified peer.
 func (p *Peer) BeforeMessageSent(c BeforeMessageSentCallback) {
@@ -522,8 +1050,31 @@ func (p *Peer) OnDisconnect(srcCallbacks ...OnPeerDisconnectCallback) {
 	p.onDisconnectCallbacks.RegisterCallback(targetCallbacks...)
 }
 
+// OnRemoteCloseWrite registers a callback for whenever the peer half-closes the connection, such
+// that it will not send us any more messages.
+func (p *Peer) OnRemoteCloseWrite(srcCallbacks ...OnPeerDisconnectCallback) {
+	targetCallbacks := make([]callbacks.Callback, 0, len(srcCallbacks))
+
+	for _, c := range srcCallbacks {
+		c := c
+		targetCallbacks = append(targetCallbacks, func(params ...interface{}) error {
+			node, ok := params[0].(*Node)
+			if !ok {
+				panic("params[0] is not a Node")
+			}
+
+			return c(node, p)
+		})
+	}
+
+	p.onRemoteCloseWriteCallbacks.RegisterCallback(targetCallbacks...)
+}
+
+// Receive returns a channel through which messages of a specified opcode are delivered, so long as no
+// callbacks are registered to handle them. Should the peer be strictly ordered, every message
+// received must then be marked as handled through `Handled(opcode)`.
 func (p *Peer) Receive(o Opcode) <-chan Message {
-	c, _ := p.receiveQueues.LoadOrStore(o, receiveHandle{hub: make(chan Message), lock: make(chan struct{}, 1)})
+	c, _ := p.receiveQueues.LoadOrStore(o, newReceiveHandle())
 	return c.(receiveHandle).hub
 }
 
@@ -543,10 +1094,73 @@ func (p *Peer) Disconnect() {
 		p.onConnErrorCallbacks.RunCallbacks(p.node, errors.Wrapf(err, "got errors closing peer connection"))
 	}
 
+	p.node.fds.add(-1)
+
 	wg.Wait()
 	close(p.kill)
 
 	p.onDisconnectCallbacks.RunCallbacks(p.node)
+	p.node.peers.remove(p)
+}
+
+// DisconnectWithReason announces to the peer why we are closing the connection to it, and then
+// disconnects the peer without blocking the current goroutine. The announcement is sent after all
+// messages queued beforehand, even should the connection have been half-closed, and is given up on
+// should it not be sent in time.
+func (p *Peer) DisconnectWithReason(reason DisconnectReason) <-chan struct{} {
+	if atomic.LoadUint32(&p.killOnce) == 1 {
+		return p.DisconnectAsync()
+	}
+
+	payload, err := p.EncodeMessage(DisconnectMessage{Reason: reason})
+	if err != nil {
+		p.onConnErrorCallbacks.RunCallbacks(p.node, errors.Wrap(err, "failed to serialize disconnect reason"))
+		return p.DisconnectAsync()
+	}
+
+	signal := make(chan struct{})
+
+	p.node.group.Go(func(ctx context.Context) error {
+		defer close(signal)
+
+		cmd := sendHandle{payload: payload, result: make(chan error, 1), final: true}
+
+		select {
+		case <-p.node.clock.After(p.node.sendWorkerBusyTimeout):
+		case p.sendQueue <- cmd:
+			select {
+			case <-p.node.clock.After(p.node.sendMessageTimeout):
+			case <-cmd.result:
+			}
+		}
+
+		<-p.DisconnectAsync()
+		return nil
+	})
+
+	return signal
+}
+
+// RemoteDisconnectReason returns the reason the peer announced for closing its connection to us.
+// It reports false should the peer not have announced any reason.
+func (p *Peer) RemoteDisconnectReason() (DisconnectReason, bool) {
+	reason := atomic.LoadUint32(&p.remoteReason)
+	if reason == 0 {
+		return ReasonUnknown, false
+	}
+
+	return DisconnectReason(reason - 1), true
+}
+
+// Dialed reports whether the peer was dialed by our node, rather than accepted by our node.
+func (p *Peer) Dialed() bool {
+	return p.dialed
+}
+
+// Disconnected reports whether the peer is disconnected, or is being disconnected. It reports true
+// before callbacks registered through OnDisconnect are run.
+func (p *Peer) Disconnected() bool {
+	return atomic.LoadUint32(&p.killOnce) == 1
 }
 
 func (p *Peer) DisconnectAsync() <-chan struct{} {
@@ -568,14 +1182,18 @@ func (p *Peer) DisconnectAsync() <-chan struct{} {
 		p.onConnErrorCallbacks.RunCallbacks(p.node, errors.Wrapf(err, "got errors closing peer connection"))
 	}
 
-	go func() {
+	p.node.fds.add(-1)
+
+	p.node.group.Go(func(ctx context.Context) error {
 		wg.Wait()
 		close(p.kill)
 
 		p.onDisconnectCallbacks.RunCallbacks(p.node)
+		p.node.peers.remove(p)
 
 		close(signal)
-	}()
+		return nil
+	})
 
 	return signal
 }
@@ -596,6 +1214,12 @@ func (p *Peer) RemotePort() uint16 {
 	return p.node.transport.Port(p.conn.RemoteAddr())
 }
 
+// InProcess returns true should the peer live within our process, and be connected to through an
+// in-process transport layer.
+func (p *Peer) InProcess() bool {
+	return transport.IsInProcess(p.conn)
+}
+
 // Set sets a metadata entry given a key-value pair on our node.
 func (p *Peer) Set(key string, val interface{}) {
 	p.metadata.Store(key, val)
@@ -627,7 +1251,7 @@ func (p *Peer) Node() *Node {
 }
 
 func (p *Peer) LockOnReceive(opcode Opcode) receiveHandle {
-	c, _ := p.receiveQueues.LoadOrStore(opcode, receiveHandle{hub: make(chan Message), lock: make(chan struct{}, 1)})
+	c, _ := p.receiveQueues.LoadOrStore(opcode, newReceiveHandle())
 	recv := c.(receiveHandle)
 
 	recv.lock <- struct{}{}
@@ -635,6 +1259,46 @@ func (p *Peer) LockOnReceive(opcode Opcode) receiveHandle {
 	return recv
 }
 
+// SetStrictOrdering sets whether messages from the peer are handled strictly in the order they were
+// received, across all opcodes.
+//
+// Callbacks registered through `OnMessageReceived` are always run in the order messages are
+// received. Messages delivered through `Receive()` however are only handed off in order, such that
+// by default, the next message from the peer may be dispatched while the goroutine which received
+// the last one is still handling it. Once the peer is strictly ordered, the next message is only
+// dispatched once the last one received through `Receive()` is marked as handled through
+// `Handled(opcode)`, for the sake of protocols such as consensus protocols which require every
+// message from a peer to be handled in wire order.
+//
+// Blocks which receive messages through `Receive()` without marking them as handled, such as
+// handshakes, stall strictly ordered peers. Peers should thus only be strictly ordered once they
+// have completed the protocol, such as within `protocol.OnEstablished()`.
+func (p *Peer) SetStrictOrdering(strict bool) {
+	if strict {
+		atomic.StoreUint32(&p.strictOrdering, 1)
+	} else {
+		atomic.StoreUint32(&p.strictOrdering, 0)
+	}
+}
+
+// StrictOrdering reports whether messages from the peer are handled strictly in the order they were
+// received, across all opcodes.
+func (p *Peer) StrictOrdering() bool {
+	return atomic.LoadUint32(&p.strictOrdering) == 1
+}
+
+// Handled marks the last message of a specified opcode received through `Receive()` as handled,
+// such that the next message from a strictly ordered peer may be dispatched. It has no effect should
+// the peer not be strictly ordered.
+func (p *Peer) Handled(opcode Opcode) {
+	c, _ := p.receiveQueues.LoadOrStore(opcode, newReceiveHandle())
+
+	select {
+	case c.(receiveHandle).handled <- struct{}{}:
+	default:
+	}
+}
+
 func (p *Peer) SetNode(node *Node) {
 	p.node = node
 }
@@ -2,6 +2,7 @@ package noise
 
 import (
 	"bufio"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"github.com/perlin-network/noise/identity/ed25519"
@@ -15,6 +16,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type testMsg struct {
@@ -325,3 +327,517 @@ func peer(t *testing.T, layer transport.Layer, conn net.Conn, port uint16) *Peer
 
 	return p
 }
+
+func TestOnMessageReceivedPanicIsolation(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	opcodeTest := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go alice.Listen()
+	go bob.Listen()
+
+	received := make(chan string, 1)
+
+	bob.OnMessageReceived(opcodeTest, func(node *Node, opcode Opcode, peer *Peer, message Message) error {
+		if message.(testMsg).Text == "panic" {
+			panic("handler panicked")
+		}
+
+		received <- message.(testMsg).Text
+		return nil
+	})
+
+	reported := make(chan error, 1)
+	disconnected := make(chan struct{})
+
+	bob.OnPeerConnected(func(node *Node, peer *Peer) error {
+		peer.OnConnError(func(node *Node, peer *Peer, err error) error {
+			select {
+			case reported <- err:
+			default:
+			}
+			return nil
+		})
+
+		peer.OnDisconnect(func(node *Node, peer *Peer) error {
+			close(disconnected)
+			return nil
+		})
+
+		return nil
+	})
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "hello"}))
+	assert.Equal(t, "hello", <-received)
+
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "panic"}))
+
+	select {
+	case err := <-reported:
+		assert.True(t, errors.Is(err, ErrHandlerPanicked))
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not report that a handler panicked")
+	}
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not disconnect from alice after a handler panicked")
+	}
+}
+
+func TestOnMessageReceivedErrorKeepsHandler(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	opcodeTest := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	carol, err := NewNode(params)
+	assert.NoError(t, err)
+	defer carol.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go alice.Listen()
+	go carol.Listen()
+	go bob.Listen()
+
+	received := make(chan string, 3)
+	errFailed := errors.New("failed to handle message")
+
+	bob.OnMessageReceived(opcodeTest, func(node *Node, opcode Opcode, peer *Peer, message Message) error {
+		if message.(testMsg).Text == "fail" {
+			return errFailed
+		}
+
+		received <- message.(testMsg).Text
+		return nil
+	})
+
+	reported := make(chan error, 1)
+
+	bob.OnPeerConnected(func(node *Node, peer *Peer) error {
+		peer.OnConnError(func(node *Node, peer *Peer, err error) error {
+			select {
+			case reported <- err:
+			default:
+			}
+			return nil
+		})
+
+		return nil
+	})
+
+	fromAlice, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	fromCarol, err := carol.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	assert.NoError(t, fromAlice.SendMessage(testMsg{Text: "fail"}))
+
+	select {
+	case err := <-reported:
+		assert.True(t, errors.Is(err, errFailed))
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not report that a handler returned an error")
+	}
+
+	// The handler should remain registered for both the peer whose message failed and every other peer.
+	for _, peer := range []*Peer{fromCarol, fromAlice} {
+		assert.NoError(t, peer.SendMessage(testMsg{Text: "hello"}))
+
+		select {
+		case text := <-received:
+			assert.Equal(t, "hello", text)
+		case <-time.After(3 * time.Second):
+			t.Fatal("bob stopped handling messages after a handler returned an error")
+		}
+	}
+}
+
+func TestOnMessageReceivedTimeout(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	opcodeTest := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go alice.Listen()
+	go bob.Listen()
+
+	cancelled := make(chan struct{})
+	received := make(chan string, 1)
+
+	bob.SetMessageHandlerTimeout(opcodeTest, 10*time.Millisecond)
+	bob.OnMessageReceivedContext(opcodeTest, func(ctx context.Context, node *Node, opcode Opcode, peer *Peer, message Message) error {
+		if message.(testMsg).Text == "slow" {
+			<-ctx.Done()
+			close(cancelled)
+			return nil
+		}
+
+		select {
+		case <-cancelled:
+		default:
+			t.Error("bob handled a message while the slow handler was still running")
+		}
+
+		received <- message.(testMsg).Text
+		return nil
+	})
+
+	timedOut := make(chan Opcode, 1)
+	connErrs := make(chan error, 16)
+
+	bob.OnPeerInit(func(node *Node, peer *Peer) error {
+		peer.OnConnError(func(node *Node, peer *Peer, err error) error {
+			connErrs <- err
+			return nil
+		})
+
+		return nil
+	})
+
+	bob.OnMessageHandlerTimeout(func(node *Node, opcode Opcode, peer *Peer, timeout time.Duration) error {
+		timedOut <- opcode
+		return nil
+	})
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "slow"}))
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "fast"}))
+
+	select {
+	case opcode := <-timedOut:
+		assert.Equal(t, opcodeTest, opcode)
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not detect a slow message handler")
+	}
+
+	select {
+	case err := <-connErrs:
+		assert.True(t, errors.Is(err, ErrHandlerTimeout))
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not report the slow message handler to OnConnError")
+	}
+
+	<-cancelled
+
+	// The next message should only be handled once the slow handler has returned.
+	select {
+	case text := <-received:
+		assert.Equal(t, "fast", text)
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not handle the message following the slow one")
+	}
+
+	assert.EqualValues(t, 1, bob.MessageHandlerTimeouts(opcodeTest))
+}
+
+func TestMalformedMessagesRejectedUniformly(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	opcodeTest := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+
+	uvarint := func(x uint64) []byte {
+		buf := make([]byte, binary.MaxVarintLen64)
+		return buf[:binary.PutUvarint(buf, x)]
+	}
+
+	frame := func(buf []byte) []byte {
+		return append(uvarint(uint64(len(buf))), buf...)
+	}
+
+	cases := map[string]struct {
+		forged bool
+		frame  []byte
+	}{
+		"too large":      {frame: uvarint(DefaultParams().MaxMessageSize + 1)},
+		"unknown opcode": {frame: frame([]byte{byte(opcodeTest) + 1, 0})},
+		"forged":         {forged: true, frame: frame(append([]byte{byte(opcodeTest)}, testMsg{Text: "hello"}.Write()...))},
+	}
+
+	for name, c := range cases {
+		c := c
+		layer := transport.NewBuffered()
+
+		params := DefaultParams()
+		params.Transport = layer
+
+		bob, err := NewNode(params)
+		assert.NoError(t, err)
+
+		reported := make(chan error, 1)
+
+		bob.OnPeerInit(func(node *Node, peer *Peer) error {
+			if c.forged {
+				peer.BeforeMessageReceived(func(node *Node, peer *Peer, msg []byte) ([]byte, error) {
+					return nil, ErrDecryptFailed
+				})
+			}
+
+			peer.OnConnError(func(node *Node, peer *Peer, err error) error {
+				select {
+				case reported <- err:
+				default:
+				}
+				return nil
+			})
+
+			return nil
+		})
+
+		go bob.Listen()
+
+		conn, err := layer.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+
+		_, err = conn.Write(c.frame)
+		assert.NoError(t, err)
+
+		// Bob should write nothing back, and close the connection right away.
+		read := make(chan error, 1)
+
+		go func() {
+			n, err := conn.Read(make([]byte, 1))
+			assert.Equal(t, 0, n, name)
+
+			read <- err
+		}()
+
+		select {
+		case err := <-read:
+			assert.Equal(t, io.EOF, err, name)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("bob did not close the connection after a %s message", name)
+		}
+
+		select {
+		case err := <-reported:
+			assert.Error(t, err, name)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("bob did not report why the %s message was rejected", name)
+		}
+
+		assert.NoError(t, conn.Close())
+		bob.Kill()
+	}
+}
+
+func TestCloseWrite(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	opcodeTest := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go alice.Listen()
+	go bob.Listen()
+
+	closed := make(chan *Peer, 1)
+
+	bob.OnPeerInit(func(node *Node, peer *Peer) error {
+		peer.OnRemoteCloseWrite(func(node *Node, peer *Peer) error {
+			closed <- peer
+			return nil
+		})
+
+		return nil
+	})
+
+	received := make(chan string, 2)
+
+	alice.OnMessageReceived(opcodeTest, func(node *Node, opcode Opcode, peer *Peer, message Message) error {
+		received <- message.(testMsg).Text
+		return nil
+	})
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	disconnected := make(chan struct{})
+
+	peer.OnDisconnect(func(node *Node, peer *Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	assert.NoError(t, peer.CloseWrite())
+	assert.True(t, errors.Cause(peer.SendMessage(testMsg{Text: "hello"})) == ErrWriteClosed)
+
+	var fromBob *Peer
+
+	select {
+	case fromBob = <-closed:
+		assert.True(t, fromBob.RemoteWriteClosed())
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob was not notified that alice half-closed the connection")
+	}
+
+	// Bob may continue to send messages to alice after she half-closed the connection.
+	assert.NoError(t, fromBob.SendMessage(testMsg{Text: "reply"}))
+
+	select {
+	case text := <-received:
+		assert.Equal(t, "reply", text)
+	case <-time.After(3 * time.Second):
+		t.Fatal("alice did not receive bob's reply after half-closing the connection")
+	}
+
+	// Once both sides have half-closed the connection, it is closed.
+	assert.NoError(t, fromBob.CloseWrite())
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("alice was not disconnected after both sides half-closed the connection")
+	}
+}
+
+type otherTestMsg struct {
+	testMsg
+}
+
+func (otherTestMsg) Read(reader payload.Reader) (Message, error) {
+	msg, err := testMsg{}.Read(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return otherTestMsg{testMsg: msg.(testMsg)}, nil
+}
+
+func TestStrictOrdering(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	opcodeReceived := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+	opcodeHandled := RegisterMessage(NextAvailableOpcode(), (*otherTestMsg)(nil))
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go alice.Listen()
+	go bob.Listen()
+
+	var mu sync.Mutex
+	var handled []string
+
+	record := func(text string) {
+		mu.Lock()
+		handled = append(handled, text)
+		mu.Unlock()
+	}
+
+	done := make(chan struct{})
+
+	bob.OnPeerInit(func(node *Node, peer *Peer) error {
+		peer.SetStrictOrdering(true)
+		assert.True(t, peer.StrictOrdering())
+
+		go func() {
+			for i := 0; i < 2; i++ {
+				msg := <-peer.Receive(opcodeReceived)
+
+				// Handling a message received through Receive() slowly holds back messages
+				// of other opcodes sent after it.
+				time.Sleep(50 * time.Millisecond)
+				record(msg.(testMsg).Text)
+
+				peer.Handled(opcodeReceived)
+			}
+		}()
+
+		return nil
+	})
+
+	bob.OnMessageReceived(opcodeHandled, func(node *Node, opcode Opcode, peer *Peer, message Message) error {
+		record(message.(otherTestMsg).Text)
+
+		if message.(otherTestMsg).Text == "4" {
+			close(done)
+		}
+
+		return nil
+	})
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "1"}))
+	assert.NoError(t, peer.SendMessage(otherTestMsg{testMsg{Text: "2"}}))
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "3"}))
+	assert.NoError(t, peer.SendMessage(otherTestMsg{testMsg{Text: "4"}}))
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not handle all messages")
+	}
+
+	mu.Lock()
+	assert.Equal(t, []string{"1", "2", "3", "4"}, handled)
+	mu.Unlock()
+}
@@ -0,0 +1,83 @@
+package noise
+
+import (
+	"sort"
+	"sync"
+)
+
+// peerSet holds every peer our node has yet to disconnect from, alongside the order in which they
+// were connected to.
+type peerSet struct {
+	sync.RWMutex
+
+	peers map[*Peer]uint64
+	next  uint64
+}
+
+func (s *peerSet) add(peer *Peer) {
+	s.Lock()
+
+	if s.peers == nil {
+		s.peers = make(map[*Peer]uint64)
+	}
+
+	s.peers[peer] = s.next
+	s.next++
+
+	s.Unlock()
+}
+
+func (s *peerSet) remove(peer *Peer) {
+	s.Lock()
+	delete(s.peers, peer)
+	s.Unlock()
+}
+
+// snapshot returns the peers held in the order they were connected to. Peers being disconnected
+// are left out, unless disconnecting is set.
+func (s *peerSet) snapshot(disconnecting bool) []*Peer {
+	s.RLock()
+
+	peers := make([]*Peer, 0, len(s.peers))
+
+	for peer := range s.peers {
+		if disconnecting || !peer.Disconnected() {
+			peers = append(peers, peer)
+		}
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		return s.peers[peers[i]] < s.peers[peers[j]]
+	})
+
+	s.RUnlock()
+
+	return peers
+}
+
+// Peers returns a snapshot of the peers our node is connected to, in the order they were connected
+// to. Peers that have not yet completed the protocol of our node are included, while peers that
+// are being disconnected are not.
+//
+// The snapshot is taken all at once, such that it holds exactly the peers connected at a single
+// instant, and is not changed by peers connecting or disconnecting afterwards. Peers in the
+// snapshot may well be disconnected by the time they are looked at.
+func (n *Node) Peers() []*Peer {
+	return n.peers.snapshot(false)
+}
+
+// ForEachPeer calls fn on every peer within a snapshot of the peers our node is connected to, as
+// taken by `Peers()`, until fn returns false. Peers connected to while iterating are not visited,
+// and peers which disconnect while iterating are skipped should they not have been visited yet. fn
+// may itself connect to and disconnect peers.
+func (n *Node) ForEachPeer(fn func(peer *Peer) bool) {
+	for _, peer := range n.peers.snapshot(false) {
+		if peer.Disconnected() {
+			continue
+		}
+
+		if !fn(peer) {
+			return
+		}
+	}
+}
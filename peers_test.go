@@ -0,0 +1,146 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPeers(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	hub, err := NewNode(params)
+	assert.NoError(t, err)
+	defer hub.Kill()
+
+	go hub.Listen()
+
+	var dialed []*Peer
+
+	for i := 0; i < 4; i++ {
+		node, err := NewNode(params)
+		assert.NoError(t, err)
+		defer node.Kill()
+
+		go node.Listen()
+
+		peer, err := hub.Dial(node.ExternalAddress())
+		assert.NoError(t, err)
+
+		dialed = append(dialed, peer)
+	}
+
+	// Peers are listed in the order they were connected to.
+	assert.Equal(t, dialed, hub.Peers())
+
+	// Snapshots are left alone by peers disconnecting afterwards.
+	snapshot := hub.Peers()
+	dialed[0].Disconnect()
+
+	assert.Len(t, snapshot, 4)
+	assert.Equal(t, dialed[1:], hub.Peers())
+
+	// Peers disconnected while iterating are skipped, and peers connected to while iterating are not
+	// visited.
+	var visited []*Peer
+
+	late, err := NewNode(params)
+	assert.NoError(t, err)
+	defer late.Kill()
+
+	go late.Listen()
+
+	hub.ForEachPeer(func(peer *Peer) bool {
+		visited = append(visited, peer)
+
+		if peer == dialed[1] {
+			dialed[2].Disconnect()
+
+			_, err := hub.Dial(late.ExternalAddress())
+			assert.NoError(t, err)
+		}
+
+		return true
+	})
+
+	assert.Equal(t, []*Peer{dialed[1], dialed[3]}, visited)
+	assert.Len(t, hub.Peers(), 3)
+
+	// Iterating stops once false is returned.
+	visited = visited[:0]
+
+	hub.ForEachPeer(func(peer *Peer) bool {
+		visited = append(visited, peer)
+		return false
+	})
+
+	assert.Len(t, visited, 1)
+}
+
+func TestPeersChurn(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	hub, err := NewNode(params)
+	assert.NoError(t, err)
+	defer hub.Kill()
+
+	go hub.Listen()
+
+	node, err := NewNode(params)
+	assert.NoError(t, err)
+	defer node.Kill()
+
+	go node.Listen()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	stop := make(chan struct{})
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 20; i++ {
+			peer, err := hub.Dial(node.ExternalAddress())
+			if assert.NoError(t, err) {
+				peer.Disconnect()
+			}
+		}
+
+		close(stop)
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			hub.ForEachPeer(func(peer *Peer) bool {
+				assert.False(t, peer.Disconnected() && peer.Disconnected() != peer.Disconnected())
+				return true
+			})
+
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	wg.Wait()
+
+	assert.Len(t, hub.Peers(), 0)
+}
@@ -0,0 +1,387 @@
+// Package peerstore holds what our node knows of its peers by their public keys, such as the
+// addresses they may be reached at, the protocols they speak, and how well they behave, and notifies
+// watchers whenever any of it changes, such that protocols may react to changes without polling.
+package peerstore
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/kv"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// watchBuffer is how many updates may be queued up for a watcher, beyond which the oldest updates
+// queued up are dropped.
+const watchBuffer = 16
+
+// Kind is what changed about a peer.
+type Kind byte
+
+const (
+	AddressesChanged Kind = iota
+	ProtocolsChanged
+	ScoreChanged
+)
+
+func (k Kind) String() string {
+	switch k {
+	case AddressesChanged:
+		return "addresses"
+	case ProtocolsChanged:
+		return "protocols"
+	case ScoreChanged:
+		return "score"
+	default:
+		return "unknown"
+	}
+}
+
+// Record is what our node knows of a peer.
+type Record struct {
+	PublicKey []byte
+	Addresses []string
+	Protocols []string
+	Score     float64
+}
+
+// Update is sent to watchers of a peer whenever a record of the peer changes, holding the record as
+// of the change.
+type Update struct {
+	Kind   Kind
+	Record Record
+}
+
+// Store holds the records of peers by their public keys.
+type Store struct {
+	sync.Mutex
+
+	records  kv.Store
+	watchers map[string]map[chan Update]struct{}
+}
+
+// New returns an empty store, holding records in memory.
+func New() *Store {
+	return &Store{records: kv.NewMemory(), watchers: make(map[string]map[chan Update]struct{})}
+}
+
+// WithStore sets the store records are held in, keyed by the public keys of their peers, such that
+// records outlive our process. Use kv.Prefixed to share a store with other components.
+func (s *Store) WithStore(store kv.Store) *Store {
+	s.Lock()
+	defer s.Unlock()
+
+	s.records = store
+	return s
+}
+
+// Get returns the record of a peer. It reports false should the store hold none.
+func (s *Store) Get(publicKey []byte) (Record, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	r, err := s.load(publicKey)
+	if err != nil {
+		if !errors.Is(err, kv.ErrNotFound) {
+			log.Warn().Err(err).Hex("public_key", publicKey).Msg("Failed to load the record of a peer.")
+		}
+
+		return Record{}, false
+	}
+
+	return r, true
+}
+
+// Peers returns the public keys of every peer the store holds a record of, in sorted order.
+func (s *Store) Peers() [][]byte {
+	s.Lock()
+	defer s.Unlock()
+
+	var out [][]byte
+
+	err := s.records.Iterate(nil, func(key, value []byte) error {
+		out = append(out, append([]byte(nil), key...))
+		return nil
+	})
+
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to list the peers records are held of.")
+	}
+
+	return out
+}
+
+// AddAddresses adds addresses a peer may be reached at to its record.
+func (s *Store) AddAddresses(publicKey []byte, addresses ...string) {
+	s.update(publicKey, AddressesChanged, func(r *Record) bool {
+		merged, changed := union(r.Addresses, addresses)
+		r.Addresses = merged
+
+		return changed
+	})
+}
+
+// SetAddresses replaces the addresses a peer may be reached at.
+func (s *Store) SetAddresses(publicKey []byte, addresses ...string) {
+	s.update(publicKey, AddressesChanged, func(r *Record) bool {
+		set, _ := union(nil, addresses)
+		if equal(r.Addresses, set) {
+			return false
+		}
+
+		r.Addresses = set
+		return true
+	})
+}
+
+// SetProtocols replaces the protocols a peer speaks, such as the topics it subscribes to or the
+// services it provides.
+func (s *Store) SetProtocols(publicKey []byte, protocols ...string) {
+	s.update(publicKey, ProtocolsChanged, func(r *Record) bool {
+		set, _ := union(nil, protocols)
+		if equal(r.Protocols, set) {
+			return false
+		}
+
+		r.Protocols = set
+		return true
+	})
+}
+
+// SetScore sets how well a peer behaves, such as the score `pubsub.Score()` reports for it.
+func (s *Store) SetScore(publicKey []byte, score float64) {
+	s.update(publicKey, ScoreChanged, func(r *Record) bool {
+		if r.Score == score {
+			return false
+		}
+
+		r.Score = score
+		return true
+	})
+}
+
+// Watch returns a channel of updates to the record of a peer, alongside a function which stops
+// watching the peer and closes the channel. Updates are only sent should the record actually change.
+// Should a watcher fall behind by more than 16 updates, the oldest updates queued up for it are
+// dropped, though as every update holds the record in whole, the latest update is always current.
+func (s *Store) Watch(publicKey []byte) (<-chan Update, func()) {
+	ch := make(chan Update, watchBuffer)
+
+	s.Lock()
+
+	key := string(publicKey)
+	if s.watchers[key] == nil {
+		s.watchers[key] = make(map[chan Update]struct{})
+	}
+
+	s.watchers[key][ch] = struct{}{}
+
+	s.Unlock()
+
+	var once sync.Once
+
+	return ch, func() {
+		once.Do(func() {
+			s.Lock()
+			defer s.Unlock()
+
+			delete(s.watchers[key], ch)
+
+			if len(s.watchers[key]) == 0 {
+				delete(s.watchers, key)
+			}
+
+			close(ch)
+		})
+	}
+}
+
+// Track records the addresses of peers as they complete a protocol. Peers are recorded
+// under the public keys of their IDs, at the addresses they advertise through their IDs should they
+// do so, such as S/Kademlia IDs, or otherwise at the addresses they connected from.
+func (s *Store) Track(p *protocol.Protocol) *Store {
+	p.OnEstablished(func(peer *noise.Peer) {
+		id := protocol.PeerID(peer)
+		if id == nil {
+			return
+		}
+
+		address := net.JoinHostPort(peer.RemoteIP().String(), strconv.FormatUint(uint64(peer.RemotePort()), 10))
+
+		if advertised, ok := id.(interface{ Address() string }); ok {
+			address = advertised.Address()
+		}
+
+		s.AddAddresses(id.PublicKey(), address)
+	})
+
+	return s
+}
+
+// update applies a change to the record of a peer, creating the record should there be none, and
+// notifies watchers of the peer should the change report that the record changed.
+func (s *Store) update(publicKey []byte, kind Kind, change func(r *Record) bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	r, err := s.load(publicKey)
+
+	switch {
+	case errors.Is(err, kv.ErrNotFound):
+		r = Record{PublicKey: append([]byte(nil), publicKey...)}
+	case err != nil:
+		log.Warn().Err(err).Hex("public_key", publicKey).Msg("Failed to load the record of a peer.")
+		return
+	}
+
+	if !change(&r) {
+		return
+	}
+
+	if err := s.records.Put(publicKey, r.marshal()); err != nil {
+		log.Warn().Err(err).Hex("public_key", publicKey).Msg("Failed to store the record of a peer.")
+		return
+	}
+
+	update := Update{Kind: kind, Record: r.clone()}
+
+	for ch := range s.watchers[string(publicKey)] {
+		for {
+			select {
+			case ch <- update:
+			default:
+				// Drop the oldest update queued up, to make room for the latest.
+				select {
+				case <-ch:
+				default:
+				}
+
+				continue
+			}
+
+			break
+		}
+	}
+}
+
+// load reads the record of a peer from the store. It must be called with the store locked.
+func (s *Store) load(publicKey []byte) (Record, error) {
+	buf, err := s.records.Get(publicKey)
+	if err != nil {
+		return Record{}, err
+	}
+
+	r := Record{PublicKey: append([]byte(nil), publicKey...)}
+	reader := payload.NewReader(buf)
+
+	if r.Addresses, err = readStrings(reader); err != nil {
+		return Record{}, errors.Wrap(err, "failed to read addresses")
+	}
+
+	if r.Protocols, err = readStrings(reader); err != nil {
+		return Record{}, errors.Wrap(err, "failed to read protocols")
+	}
+
+	score, err := reader.ReadUint64()
+	if err != nil {
+		return Record{}, errors.Wrap(err, "failed to read score")
+	}
+
+	r.Score = math.Float64frombits(score)
+
+	return r, nil
+}
+
+// marshal encodes a record without its public key, which records are keyed by.
+func (r *Record) marshal() []byte {
+	writer := payload.NewWriter(nil)
+
+	for _, list := range [][]string{r.Addresses, r.Protocols} {
+		writer.WriteUint32(uint32(len(list)))
+
+		for _, item := range list {
+			writer.WriteString(item)
+		}
+	}
+
+	return writer.WriteUint64(math.Float64bits(r.Score)).Bytes()
+}
+
+func readStrings(reader payload.Reader) ([]string, error) {
+	count, err := reader.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if int(count) > reader.Len() {
+		return nil, errors.Errorf("got %d strings, but only %d bytes remain", count, reader.Len())
+	}
+
+	var out []string
+
+	for i := uint32(0); i < count; i++ {
+		item, err := reader.ReadString()
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, item)
+	}
+
+	return out, nil
+}
+
+func (r *Record) clone() Record {
+	return Record{
+		PublicKey: append([]byte(nil), r.PublicKey...),
+		Addresses: append([]string(nil), r.Addresses...),
+		Protocols: append([]string(nil), r.Protocols...),
+		Score:     r.Score,
+	}
+}
+
+// union merges strings into a sorted set, and reports whether any of them were not already held.
+func union(set []string, items []string) ([]string, bool) {
+	held := make(map[string]struct{}, len(set))
+
+	for _, item := range set {
+		held[item] = struct{}{}
+	}
+
+	out := append([]string(nil), set...)
+	changed := false
+
+	for _, item := range items {
+		if _, exists := held[item]; exists {
+			continue
+		}
+
+		held[item] = struct{}{}
+		out = append(out, item)
+		changed = true
+	}
+
+	sort.Strings(out)
+
+	return out, changed
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,148 @@
+package peerstore
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/kv"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/skademlia"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func next(t *testing.T, updates <-chan Update) Update {
+	select {
+	case update := <-updates:
+		return update
+	case <-time.After(3 * time.Second):
+		t.Fatal("got no update")
+		return Update{}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	s := New()
+	key := []byte("alice")
+
+	updates, stop := s.Watch(key)
+
+	s.AddAddresses(key, "127.0.0.1:3000")
+
+	update := next(t, updates)
+	assert.Equal(t, AddressesChanged, update.Kind)
+	assert.Equal(t, []string{"127.0.0.1:3000"}, update.Record.Addresses)
+
+	// Changes which leave a record as is are not sent to watchers.
+	s.AddAddresses(key, "127.0.0.1:3000")
+	s.SetProtocols(key, "pubsub", "mailbox")
+	s.SetProtocols(key, "mailbox", "pubsub")
+	s.SetScore(key, 1.5)
+	s.SetScore(key, 1.5)
+
+	update = next(t, updates)
+	assert.Equal(t, ProtocolsChanged, update.Kind)
+	assert.Equal(t, []string{"mailbox", "pubsub"}, update.Record.Protocols)
+
+	update = next(t, updates)
+	assert.Equal(t, ScoreChanged, update.Kind)
+	assert.Equal(t, Record{PublicKey: key, Addresses: []string{"127.0.0.1:3000"}, Protocols: []string{"mailbox", "pubsub"}, Score: 1.5}, update.Record)
+
+	select {
+	case update := <-updates:
+		t.Fatalf("got an unexpected update %v", update.Kind)
+	default:
+	}
+
+	// Watchers of other peers are not sent updates.
+	s.SetScore([]byte("bob"), 2)
+
+	record, exists := s.Get([]byte("bob"))
+	assert.True(t, exists)
+	assert.Equal(t, 2.0, record.Score)
+	assert.Equal(t, [][]byte{key, []byte("bob")}, s.Peers())
+
+	// Watchers which fall behind are left with the latest updates.
+	for i := 0; i < 2*watchBuffer; i++ {
+		s.SetScore(key, float64(i))
+	}
+
+	var last Update
+	for i := 0; i < watchBuffer; i++ {
+		last = next(t, updates)
+	}
+
+	assert.Equal(t, float64(2*watchBuffer-1), last.Record.Score)
+
+	stop()
+	stop()
+
+	_, open := <-updates
+	assert.False(t, open)
+}
+
+func TestWithStore(t *testing.T) {
+	db := kv.NewMemory()
+
+	s := New().WithStore(kv.Prefixed(db, "peers/"))
+	s.AddAddresses([]byte("alice"), "127.0.0.1:3000", "127.0.0.1:3001")
+	s.SetProtocols([]byte("bob"), "pubsub")
+	s.SetScore([]byte("bob"), -0.5)
+
+	// Records outlive the store they were written through.
+	restored := New().WithStore(kv.Prefixed(db, "peers/"))
+	assert.Equal(t, [][]byte{[]byte("alice"), []byte("bob")}, restored.Peers())
+
+	record, exists := restored.Get([]byte("alice"))
+	assert.True(t, exists)
+	assert.Equal(t, Record{PublicKey: []byte("alice"), Addresses: []string{"127.0.0.1:3000", "127.0.0.1:3001"}}, record)
+
+	record, exists = restored.Get([]byte("bob"))
+	assert.True(t, exists)
+	assert.Equal(t, Record{PublicKey: []byte("bob"), Protocols: []string{"pubsub"}, Score: -0.5}, record)
+}
+
+func TestTrack(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+	store := New()
+
+	newNode := func(p *protocol.Protocol) *noise.Node {
+		params := noise.DefaultParams()
+		params.Transport = layer
+		params.Keys = skademlia.RandomKeys()
+
+		node, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		p.Register(skademlia.New()).Enforce(node)
+
+		go node.Listen()
+
+		return node
+	}
+
+	p := protocol.New()
+	store.Track(p)
+
+	alice := newNode(p)
+	defer alice.Kill()
+
+	bob := newNode(protocol.New())
+	defer bob.Kill()
+
+	updates, stop := store.Watch(bob.Keys.PublicKey())
+	defer stop()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	// Peers are recorded at the addresses they advertise through their IDs.
+	update := next(t, updates)
+	assert.Equal(t, AddressesChanged, update.Kind)
+	assert.Equal(t, []string{bob.ExternalAddress()}, update.Record.Addresses)
+}
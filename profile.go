@@ -0,0 +1,127 @@
+package noise
+
+import (
+	"context"
+	"reflect"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	profileLabels uint32 = 1 << iota
+	profileRegions
+)
+
+// handlerLabels names the protocol and type of a message, for the profiles and execution traces of
+// the callbacks handling it.
+type handlerLabels struct {
+	protocol, message string
+	region            string
+}
+
+// handlerLabelsCache caches the labels of every message type, keyed by reflect.Type.
+var handlerLabelsCache sync.Map
+
+// handlerLabelsOf names the protocol of a message by the package its type is declared in, and the
+// message by the name of its type.
+func handlerLabelsOf(msg Message) handlerLabels {
+	typ := reflect.TypeOf(msg)
+
+	if labels, cached := handlerLabelsCache.Load(typ); cached {
+		return labels.(handlerLabels)
+	}
+
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	protocol := typ.PkgPath()
+	if i := strings.LastIndexByte(protocol, '/'); i >= 0 {
+		protocol = protocol[i+1:]
+	}
+
+	labels := handlerLabels{protocol: protocol, message: typ.Name(), region: "noise: handle " + protocol + "." + typ.Name()}
+	handlerLabelsCache.Store(reflect.TypeOf(msg), labels)
+
+	return labels
+}
+
+// LabelHandlers toggles whether callbacks handling messages run under pprof labels naming the
+// protocol, message type, opcode and peer of the message they handle. CPU and goroutine profiles of
+// busy nodes may then attribute time to specific protocols and peers, rather than to the function
+// our node dispatches messages through, for example through `go tool pprof -tagfocus`.
+//
+// Protocols are named by the last element of the package path their messages are declared in, such
+// as "stream" or "skademlia". Labels are carried by the context handed to callbacks registered
+// through `OnMessageReceivedContext`, and by goroutines those callbacks spawn. Labeling costs a few
+// allocations per message handled, and so is disabled by default.
+func (n *Node) LabelHandlers(enabled bool) {
+	n.toggleProfiling(profileLabels, enabled)
+}
+
+// TraceHandlers toggles whether callbacks handling messages run within execution trace regions,
+// named after the protocol and type of the message they handle, such that traces collected through
+// `runtime/trace` break handling time down by protocol. Regions are only recorded while a trace is
+// being collected.
+func (n *Node) TraceHandlers(enabled bool) {
+	n.toggleProfiling(profileRegions, enabled)
+}
+
+func (n *Node) toggleProfiling(flag uint32, enabled bool) {
+	for {
+		old := atomic.LoadUint32(&n.profiling)
+
+		updated := old &^ flag
+		if enabled {
+			updated |= flag
+		}
+
+		if atomic.CompareAndSwapUint32(&n.profiling, old, updated) {
+			return
+		}
+	}
+}
+
+// profileHandler runs fn, which handles a message from a peer, under the pprof labels and within
+// the execution trace region of the message, should either be enabled.
+func (n *Node) profileHandler(ctx context.Context, peer *Peer, opcode Opcode, msg Message, fn func(ctx context.Context)) {
+	flags := atomic.LoadUint32(&n.profiling)
+
+	if flags&profileRegions != 0 && !trace.IsEnabled() {
+		flags &^= profileRegions
+	}
+
+	if flags == 0 {
+		fn(ctx)
+		return
+	}
+
+	labels := handlerLabelsOf(msg)
+
+	if flags&profileRegions != 0 {
+		inner := fn
+
+		fn = func(ctx context.Context) {
+			trace.WithRegion(ctx, labels.region, func() {
+				inner(ctx)
+			})
+		}
+	}
+
+	if flags&profileLabels != 0 {
+		pprof.Do(ctx, pprof.Labels(
+			"noise.protocol", labels.protocol,
+			"noise.message", labels.message,
+			"noise.opcode", strconv.Itoa(int(opcode)),
+			"noise.peer", peer.conn.RemoteAddr().String(),
+		), fn)
+
+		return
+	}
+
+	fn(ctx)
+}
@@ -0,0 +1,96 @@
+package noise
+
+import (
+	"bytes"
+	"context"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLabelHandlers(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	opcodeTest := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go bob.Listen()
+
+	labels := make(chan map[string]string, 1)
+
+	bob.OnMessageReceivedContext(opcodeTest, func(ctx context.Context, node *Node, opcode Opcode, peer *Peer, message Message) error {
+		got := make(map[string]string)
+
+		pprof.ForLabels(ctx, func(key, value string) bool {
+			got[key] = value
+			return true
+		})
+
+		labels <- got
+		return nil
+	})
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	go alice.Listen()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	receive := func() map[string]string {
+		select {
+		case got := <-labels:
+			return got
+		case <-time.After(3 * time.Second):
+			t.Fatal("bob never handled the message")
+			return nil
+		}
+	}
+
+	// Handlers run without labels by default.
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "unlabeled"}))
+	assert.Empty(t, receive())
+
+	bob.LabelHandlers(true)
+
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "labeled"}))
+	assert.Equal(t, map[string]string{
+		"noise.protocol": "noise",
+		"noise.message":  "testMsg",
+		"noise.opcode":   strconv.Itoa(int(opcodeTest)),
+		"noise.peer":     peer.LocalIP().String() + ":" + strconv.Itoa(int(peer.LocalPort())),
+	}, receive())
+
+	// Handlers run within trace regions while a trace is collected.
+	bob.TraceHandlers(true)
+
+	var buf bytes.Buffer
+	assert.NoError(t, trace.Start(&buf))
+
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "traced"}))
+	assert.Len(t, receive(), 4)
+
+	trace.Stop()
+	assert.Contains(t, buf.String(), "noise: handle noise.testMsg")
+
+	bob.LabelHandlers(false)
+	bob.TraceHandlers(false)
+
+	assert.NoError(t, peer.SendMessage(testMsg{Text: "unlabeled"}))
+	assert.Empty(t, receive())
+}
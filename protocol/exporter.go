@@ -0,0 +1,40 @@
+package protocol
+
+import (
+	"crypto/sha256"
+	"github.com/perlin-network/noise"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+	"io"
+)
+
+const exporterLabelPrefix = "noise exporter "
+
+// ExportKeyingMaterial derives length bytes of keying material from the shared key established
+// with a peer, akin to TLS exporters (RFC 5705). Applications may bind higher-level authentication
+// tokens to the secure channel with a peer by having both sides export keying material under the
+// same label, and signing or comparing it: keying material exported over different sessions, or
+// under different labels, is unrelated.
+//
+// Keying material is derived through HKDF-SHA256 over the shared key, salted with the hash of the
+// handshake transcript should the handshake block have set one, and is never the same as the keys
+// which encrypt traffic with the peer.
+func ExportKeyingMaterial(peer *noise.Peer, label string, length int) ([]byte, error) {
+	sharedKey := LoadSharedKey(peer)
+	if sharedKey == nil {
+		return nil, errors.New("protocol: no shared key has been established with the peer")
+	}
+
+	if length <= 0 || length > 255*sha256.Size {
+		return nil, errors.Errorf("protocol: cannot export %d bytes of keying material", length)
+	}
+
+	deriver := hkdf.New(sha256.New, sharedKey, LoadHandshakeHash(peer), []byte(exporterLabelPrefix+label))
+
+	material := make([]byte, length)
+	if _, err := io.ReadFull(deriver, material); err != nil {
+		return nil, errors.Wrap(err, "protocol: failed to derive keying material")
+	}
+
+	return material, nil
+}
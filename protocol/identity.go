@@ -6,9 +6,10 @@ import (
 )
 
 const (
-	KeySharedKey = "identity.shared_key"
-	KeyID        = "node.id"
-	KeyPeerID    = "peer.id"
+	KeySharedKey     = "identity.shared_key"
+	KeyHandshakeHash = "identity.handshake_hash"
+	KeyID            = "node.id"
+	KeyPeerID        = "peer.id"
 )
 
 type ID interface {
@@ -55,6 +56,17 @@ func DeleteSharedKey(peer *noise.Peer) {
 	peer.Delete(KeySharedKey)
 }
 
+func LoadHandshakeHash(peer *noise.Peer) []byte {
+	hash, _ := peer.Get(KeyHandshakeHash).([]byte)
+	return hash
+}
+
+// SetHandshakeHash sets a hash of the transcript of the handshake which established the shared
+// key of a peer. Both sides of a handshake must set the same hash.
+func SetHandshakeHash(peer *noise.Peer, hash []byte) {
+	peer.Set(KeyHandshakeHash, hash)
+}
+
 func SetNodeID(node *noise.Node, id ID) {
 	node.Set(KeyID, id)
 }
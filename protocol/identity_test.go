@@ -78,3 +78,46 @@ func TestPeerID(t *testing.T) {
 	assert.Nil(t, PeerID(peer))
 	assert.Nil(t, Peer(node, dummyID{}))
 }
+
+func TestExportKeyingMaterial(t *testing.T) {
+	peer := &noise.Peer{}
+
+	_, err := ExportKeyingMaterial(peer, "test", 32)
+	assert.Error(t, err)
+
+	SetSharedKey(peer, []byte{1, 2, 3})
+
+	a, err := ExportKeyingMaterial(peer, "test", 32)
+	assert.NoError(t, err)
+	assert.Len(t, a, 32)
+
+	// Keying material is deterministic, yet differs across labels and handshake transcripts.
+	b, err := ExportKeyingMaterial(peer, "test", 32)
+	assert.NoError(t, err)
+	assert.Equal(t, a, b)
+
+	b, err = ExportKeyingMaterial(peer, "other", 32)
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, b)
+
+	SetHandshakeHash(peer, []byte{4, 5, 6})
+
+	b, err = ExportKeyingMaterial(peer, "test", 32)
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, b)
+
+	_, err = ExportKeyingMaterial(peer, "test", 0)
+	assert.Error(t, err)
+}
+
+func TestSession(t *testing.T) {
+	peer := &noise.Peer{}
+
+	assert.Equal(t, Session{}, LoadSession(peer))
+
+	SetHandshakeHash(peer, []byte("hash"))
+	SetSessionPattern(peer, "ECDH-Ed25519")
+	SetSessionCipher(peer, "AES-256-GCM", "SHA-256")
+
+	assert.Equal(t, Session{HandshakeHash: []byte("hash"), Pattern: "ECDH-Ed25519", Cipher: "AES-256-GCM", Hash: "SHA-256"}, LoadSession(peer))
+}
@@ -1,8 +1,10 @@
 package protocol
 
 import (
+	"context"
 	"github.com/perlin-network/noise"
 	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/resource"
 	"github.com/pkg/errors"
 	"sync"
 	"sync/atomic"
@@ -11,12 +13,60 @@ import (
 const (
 	KeyProtocolCurrentBlockIndex = "protocol.current_block_index"
 	KeyProtocolEnforceOnce       = "protocol.enforce_once"
+
+	// DefaultHandshakeReservation is the number of bytes reserved for every peer which has yet to
+	// complete the protocol.
+	DefaultHandshakeReservation = 16 * 1024
 )
 
 var (
 	DisconnectPeer = errors.New("peer disconnect requested")
 )
 
+type disconnectError struct {
+	err error
+}
+
+func (e disconnectError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns DisconnectPeer such that callers using `errors.Cause` remain compatible.
+func (e disconnectError) Cause() error {
+	return DisconnectPeer
+}
+
+func (e disconnectError) Unwrap() error {
+	return e.err
+}
+
+func (e disconnectError) Is(target error) bool {
+	return target == DisconnectPeer
+}
+
+// reasoned is implemented by errors which, once returned from a blocks `OnBegin` to disconnect a
+// peer, announce to the peer why it is being disconnected.
+type reasoned interface {
+	DisconnectReason() noise.DisconnectReason
+}
+
+// DisconnectWith marks an error as one which requests for a peer to be disconnected should it
+// be returned from a blocks `OnBegin`. The error returned matches both `DisconnectPeer` and
+// the original error when using `errors.Is`, and has `DisconnectPeer` as its `errors.Cause`.
+func DisconnectWith(err error) error {
+	if err == nil {
+		return DisconnectPeer
+	}
+
+	return disconnectError{err: err}
+}
+
+// Block is a single step of a protocol. OnRegister is called once as the protocol is enforced on a
+// node, and OnBegin is called for every peer once the blocks before it have completed.
+//
+// OnEnd is only called for the block a peer is in the midst of should the peer disconnect before
+// completing the protocol, and is never called for peers which complete it. Blocks which keep
+// state for a peer beyond OnBegin should thus clean it up through peer.OnDisconnect instead.
 type Block interface {
 	OnRegister(p *Protocol, node *noise.Node)
 	OnBegin(p *Protocol, peer *noise.Peer) error
@@ -26,10 +76,45 @@ type Block interface {
 type Protocol struct {
 	blocks       []Block
 	blocksSealed uint32
+
+	pendingQueueSize int
+
+	handshakeReservation uint64
+	handshakeCap         uint64
+
+	onEstablished []func(peer *noise.Peer)
+	onFailed      []func(peer *noise.Peer, err error)
 }
 
 func New() *Protocol {
-	return &Protocol{}
+	return &Protocol{pendingQueueSize: DefaultPendingQueueSize, handshakeReservation: DefaultHandshakeReservation}
+}
+
+// WithPendingQueueSize sets the maximum number of messages that may be queued up via
+// `EnqueueMessage` for a peer which has yet to complete the protocol.
+func (p *Protocol) WithPendingQueueSize(size int) *Protocol {
+	p.pendingQueueSize = size
+	return p
+}
+
+// WithHandshakeReservation sets the number of bytes reserved through our nodes resource manager for
+// every peer which has yet to complete the protocol. Peers for which the bytes may not be reserved
+// are disconnected before any block begins.
+func (p *Protocol) WithHandshakeReservation(size uint64) *Protocol {
+	p.handshakeReservation = size
+	return p
+}
+
+// WithHandshakeCap caps how many bytes may be reserved for all peers which have yet to complete the
+// protocol combined, on top of the limits of our nodes resource manager. Once the cap is reached,
+// the oldest handshakes in progress are shed to make room for new ones, such that peers which open
+// connections and let them sit half-open may not lock out other peers. Shed handshakes fail with
+// an error matching ErrHandshakeShed. A cap of zero leaves handshakes uncapped.
+//
+// Refer to `Handshakes()` for how many bytes are reserved for handshakes in progress.
+func (p *Protocol) WithHandshakeCap(size uint64) *Protocol {
+	p.handshakeCap = size
+	return p
 }
 
 // Register registers a block to this protocol sequentially.
@@ -43,6 +128,28 @@ func (p *Protocol) Register(blk Block) *Protocol {
 	return p
 }
 
+// OnEstablished registers a callback which is called once a peer completes all blocks of the
+// protocol.
+func (p *Protocol) OnEstablished(fn func(peer *noise.Peer)) *Protocol {
+	if atomic.LoadUint32(&p.blocksSealed) == 1 {
+		panic("OnEstablished() cannot be called after Enforce().")
+	}
+
+	p.onEstablished = append(p.onEstablished, fn)
+	return p
+}
+
+// OnFailed registers a callback which is called should a block of the protocol return an error
+// for a peer.
+func (p *Protocol) OnFailed(fn func(peer *noise.Peer, err error)) *Protocol {
+	if atomic.LoadUint32(&p.blocksSealed) == 1 {
+		panic("OnFailed() cannot be called after Enforce().")
+	}
+
+	p.onFailed = append(p.onFailed, fn)
+	return p
+}
+
 // Enforce enforces that all peers of a node follow the given protocol.
 func (p *Protocol) Enforce(node *noise.Node) {
 	atomic.StoreUint32(&p.blocksSealed, 1)
@@ -52,9 +159,55 @@ func (p *Protocol) Enforce(node *noise.Node) {
 			block.OnRegister(p, node)
 		}
 
+		tracked := node.LoadOrStore(KeyProtocolHandshakes, newHandshakes(p.handshakeCap)).(*handshakes)
+
 		node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
-			go func() {
+			queue := peer.LoadOrStore(KeyProtocolPendingQueue, newPendingQueue(p.pendingQueueSize)).(*pendingQueue)
+
+			node.Go(func(ctx context.Context) error {
+				if err := node.Resources().Reserve(peer, resource.ProtocolHandshake, p.handshakeReservation); err != nil {
+					err = errors.Wrap(err, "refused to handshake with peer")
+
+					queue.abort(abortWith(err))
+
+					for _, fn := range p.onFailed {
+						fn(peer, err)
+					}
+
+					peer.Disconnect()
+					return nil
+				}
+
+				entry, err := tracked.admit(peer, queue, p.handshakeReservation)
+				if err != nil {
+					node.Resources().Release(peer, resource.ProtocolHandshake, p.handshakeReservation)
+
+					err = errors.Wrap(err, "refused to handshake with peer")
+
+					queue.abort(abortWith(err))
+
+					for _, fn := range p.onFailed {
+						fn(peer, err)
+					}
+
+					peer.Disconnect()
+					return nil
+				}
+
+				var once sync.Once
+
+				release := func() {
+					once.Do(func() {
+						tracked.remove(entry)
+						node.Resources().Release(peer, resource.ProtocolHandshake, p.handshakeReservation)
+					})
+				}
+
 				peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+					release()
+
+					queue.abort(abortWith(errors.New("peer disconnected")))
+
 					blockIndex := peer.LoadOrStore(KeyProtocolCurrentBlockIndex, 0).(int)
 
 					if blockIndex >= len(p.blocks) {
@@ -68,25 +221,48 @@ func (p *Protocol) Enforce(node *noise.Node) {
 					blockIndex := peer.LoadOrStore(KeyProtocolCurrentBlockIndex, 0).(int)
 
 					if blockIndex >= len(p.blocks) {
-						return
+						release()
+						queue.flush(peer)
+
+						for _, fn := range p.onEstablished {
+							fn(peer)
+						}
+
+						return nil
 					}
 
 					err := p.blocks[blockIndex].OnBegin(p, peer)
 
+					if tracked.wasShed(entry) {
+						err = DisconnectWith(ErrHandshakeShed)
+					}
+
 					if err != nil {
-						switch errors.Cause(err) {
-						case DisconnectPeer:
-							peer.Disconnect()
-						default:
+						release()
+						queue.abort(abortWith(err))
+
+						for _, fn := range p.onFailed {
+							fn(peer, err)
+						}
+
+						if errors.Is(err, DisconnectPeer) {
+							var reason reasoned
+
+							if errors.As(err, &reason) {
+								<-peer.DisconnectWithReason(reason.DisconnectReason())
+							} else {
+								peer.Disconnect()
+							}
+						} else {
 							log.Warn().Err(err).Msg("Received an error following protocol.")
 						}
 
-						return
+						return nil
 					} else {
 						peer.Set(KeyProtocolCurrentBlockIndex, blockIndex+1)
 					}
 				}
-			}()
+			})
 
 			return nil
 		})
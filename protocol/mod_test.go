@@ -3,8 +3,12 @@ package protocol
 import (
 	"github.com/perlin-network/noise"
 	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/resource"
 	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -82,3 +86,318 @@ func TestProtocol(t *testing.T) {
 
 	assert.Equal(t, atomic.LoadUint32(&aliceDisconnected), uint32(1))
 }
+
+type sleepBlock struct {
+	duration time.Duration
+}
+
+func (b *sleepBlock) OnRegister(p *Protocol, node *noise.Node) {}
+
+func (b *sleepBlock) OnBegin(p *Protocol, peer *noise.Peer) error {
+	time.Sleep(b.duration)
+	return nil
+}
+
+func (b *sleepBlock) OnEnd(p *Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+type orderedMessage struct {
+	index uint32
+}
+
+func (orderedMessage) Read(reader payload.Reader) (noise.Message, error) {
+	index, err := reader.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	return orderedMessage{index: index}, nil
+}
+
+func (m orderedMessage) Write() []byte {
+	return payload.NewWriter(nil).WriteUint32(m.index).Bytes()
+}
+
+func TestEnqueueMessage(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	opcodeOrdered := noise.RegisterMessage(noise.NextAvailableOpcode(), (*orderedMessage)(nil))
+
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	New().WithPendingQueueSize(10).Register(&sleepBlock{duration: 50 * time.Millisecond}).Enforce(alice)
+	New().Register(&sleepBlock{duration: 50 * time.Millisecond}).Enforce(bob)
+
+	received := make(chan uint32, 10)
+
+	bob.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+		go func() {
+			for i := 0; i < 10; i++ {
+				received <- (<-peer.Receive(opcodeOrdered)).(orderedMessage).index
+			}
+		}()
+
+		return nil
+	})
+
+	go alice.Listen()
+	go bob.Listen()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	var results []<-chan error
+
+	for i := 0; i < 10; i++ {
+		results = append(results, EnqueueMessage(peer, orderedMessage{index: uint32(i)}))
+	}
+
+	// The queue is bounded.
+	assert.Equal(t, ErrPendingQueueFull, <-EnqueueMessage(peer, orderedMessage{index: 10}))
+
+	WaitUntilEstablished(peer)
+
+	for _, result := range results {
+		assert.NoError(t, <-result)
+	}
+
+	for i := 0; i < 10; i++ {
+		select {
+		case index := <-received:
+			assert.EqualValues(t, i, index)
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for queued messages to be flushed")
+		}
+	}
+}
+
+func TestEnqueueMessageAborted(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	New().Register(&sleepBlock{duration: 50 * time.Millisecond}).Register(&dummyBlock{earlyStop: true, blockCount: new(uint32)}).Enforce(alice)
+	New().Enforce(bob)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	err = <-EnqueueMessage(peer, noise.EmptyMessage{})
+	assert.Error(t, err)
+	assert.Equal(t, ErrPendingQueueAborted, errors.Cause(err))
+
+	// Waiting on a peer that failed the protocol does not block forever.
+	assert.True(t, errors.Is(WaitUntilEstablished(peer), ErrPendingQueueAborted))
+}
+
+type timeoutBlock struct{}
+
+func (b *timeoutBlock) OnRegister(p *Protocol, node *noise.Node) {}
+
+func (b *timeoutBlock) OnBegin(p *Protocol, peer *noise.Peer) error {
+	return errors.Wrap(DisconnectWith(noise.ErrHandshakeTimeout), "timed out")
+}
+
+func (b *timeoutBlock) OnEnd(p *Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+func TestPendingQueueAbortKeepsCause(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	New().Register(&timeoutBlock{}).Enforce(alice)
+	New().Enforce(bob)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	err = WaitUntilEstablished(peer)
+	assert.True(t, errors.Is(err, ErrPendingQueueAborted))
+	assert.True(t, errors.Is(err, noise.ErrHandshakeTimeout))
+
+	err = <-EnqueueMessage(peer, noise.EmptyMessage{})
+	assert.True(t, errors.Is(err, ErrPendingQueueAborted))
+	assert.True(t, errors.Is(err, noise.ErrHandshakeTimeout))
+	assert.Equal(t, ErrPendingQueueAborted, errors.Cause(err))
+}
+
+func TestHandshakeReservation(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	params.Resources = resource.NewManager(resource.Limits{System: DefaultHandshakeReservation})
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	New().Enforce(alice)
+	New().Register(&sleepBlock{duration: 100 * time.Millisecond}).Enforce(bob)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	failed := make(chan error, 1)
+
+	bob.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+		go func() {
+			if err := WaitUntilEstablished(peer); err != nil {
+				failed <- err
+			}
+		}()
+
+		return nil
+	})
+
+	// Bob may only reserve memory for one peer to handshake with at a time.
+	_, err = alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	select {
+	case err := <-failed:
+		assert.True(t, errors.Is(err, resource.ErrLimitExceeded))
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not refuse to handshake with alice")
+	}
+
+	// Memory reserved for handshakes is released once peers complete the protocol.
+	time.Sleep(200 * time.Millisecond)
+	assert.EqualValues(t, 0, bob.Resources().Usage().System)
+}
+
+func TestHandshakeCap(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	New().Enforce(alice)
+	New().WithHandshakeCap(2 * DefaultHandshakeReservation).Register(&sleepBlock{duration: 300 * time.Millisecond}).Enforce(bob)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	var mu sync.Mutex
+	var peers []*noise.Peer
+
+	bob.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+		mu.Lock()
+		peers = append(peers, peer)
+		mu.Unlock()
+
+		return nil
+	})
+
+	// Bob may only reserve memory for two peers to handshake with at once, and so sheds the oldest
+	// handshake once a third peer connects.
+	for i := 0; i < 3; i++ {
+		_, err = alice.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	mu.Lock()
+	oldest := peers[0]
+	mu.Unlock()
+
+	assert.True(t, errors.Is(WaitUntilEstablished(oldest), ErrHandshakeShed))
+	assert.Equal(t, HandshakeStats{InProgress: 2, Bytes: 2 * DefaultHandshakeReservation, Cap: 2 * DefaultHandshakeReservation, Shed: 1}, Handshakes(bob))
+
+	// Memory reserved for handshakes is released once peers complete the protocol.
+	mu.Lock()
+	for _, peer := range peers[1:] {
+		assert.NoError(t, WaitUntilEstablished(peer))
+	}
+	mu.Unlock()
+
+	assert.Equal(t, 0, Handshakes(bob).InProgress)
+	assert.EqualValues(t, 0, Handshakes(bob).Bytes)
+	assert.EqualValues(t, 0, bob.Resources().Usage().Protocols[resource.ProtocolHandshake])
+
+	// Handshakes which do not fit under the cap on their own are refused.
+	carol, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer carol.Kill()
+
+	New().WithHandshakeCap(DefaultHandshakeReservation / 2).Enforce(carol)
+
+	go carol.Listen()
+
+	_, err = alice.Dial(carol.ExternalAddress())
+	assert.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, 1, Handshakes(carol).Refused)
+}
+
+func TestDisconnectWith(t *testing.T) {
+	err := errors.Wrap(DisconnectWith(noise.ErrHandshakeTimeout), "timed out")
+
+	assert.True(t, errors.Is(err, DisconnectPeer))
+	assert.True(t, errors.Is(err, noise.ErrHandshakeTimeout))
+	assert.False(t, errors.Is(err, noise.ErrDecryptFailed))
+	assert.Equal(t, DisconnectPeer, errors.Cause(err))
+
+	assert.Equal(t, DisconnectPeer, DisconnectWith(nil))
+}
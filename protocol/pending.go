@@ -0,0 +1,202 @@
+package protocol
+
+import (
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+const (
+	KeyProtocolPendingQueue = "protocol.pending_queue"
+
+	DefaultPendingQueueSize = 128
+)
+
+var (
+	ErrPendingQueueFull    = errors.New("pending message queue is full")
+	ErrPendingQueueAborted = errors.New("peer did not complete the protocol")
+)
+
+type pendingMessage struct {
+	message noise.Message
+	result  chan error
+}
+
+// pendingQueue buffers messages that are to be sent to a peer which has yet to complete
+// all blocks within a protocol.
+type pendingQueue struct {
+	sync.Mutex
+
+	size    int
+	pending []pendingMessage
+
+	established bool
+	aborted     error
+
+	ready chan struct{}
+}
+
+// abortedError marks the reason a peer did not complete the protocol, such that callers may
+// match against both ErrPendingQueueAborted and the reason itself.
+type abortedError struct {
+	err error
+}
+
+func (e abortedError) Error() string {
+	return ErrPendingQueueAborted.Error() + ": " + e.err.Error()
+}
+
+// Cause returns ErrPendingQueueAborted such that callers using `errors.Cause` remain compatible.
+func (e abortedError) Cause() error {
+	return ErrPendingQueueAborted
+}
+
+func (e abortedError) Unwrap() error {
+	return e.err
+}
+
+func (e abortedError) Is(target error) bool {
+	return target == ErrPendingQueueAborted
+}
+
+// abortWith wraps the reason a peer did not complete the protocol.
+func abortWith(err error) error {
+	return abortedError{err: err}
+}
+
+func newPendingQueue(size int) *pendingQueue {
+	return &pendingQueue{size: size, ready: make(chan struct{})}
+}
+
+func (q *pendingQueue) enqueue(peer *noise.Peer, message noise.Message) <-chan error {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.established {
+		return peer.SendMessageAsync(message)
+	}
+
+	result := make(chan error, 1)
+
+	if q.aborted != nil {
+		result <- q.aborted
+		return result
+	}
+
+	if len(q.pending) >= q.size {
+		result <- ErrPendingQueueFull
+		return result
+	}
+
+	q.pending = append(q.pending, pendingMessage{message: message, result: result})
+
+	return result
+}
+
+// flush sends all pending messages in the order they were queued, and has all further
+// messages be sent directly to the peer.
+func (q *pendingQueue) flush(peer *noise.Peer) {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.established || q.aborted != nil {
+		return
+	}
+
+	for _, pending := range q.pending {
+		src, dst := peer.SendMessageAsync(pending.message), pending.result
+
+		peer.Node().Go(func(ctx context.Context) error {
+			forward(ctx, src, dst)
+			return nil
+		})
+	}
+
+	q.pending = nil
+	q.established = true
+
+	close(q.ready)
+}
+
+// abort fails all pending messages, and all messages queued afterwards with a given error.
+func (q *pendingQueue) abort(err error) {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.established || q.aborted != nil {
+		return
+	}
+
+	for _, pending := range q.pending {
+		pending.result <- err
+	}
+
+	q.pending = nil
+	q.aborted = err
+
+	close(q.ready)
+}
+
+// forward hands the result of sending a pending message to whoever queued it, or ErrNodeKilled
+// should our node be killed first.
+func forward(ctx context.Context, src <-chan error, dst chan error) {
+	select {
+	case err := <-src:
+		dst <- err
+	case <-ctx.Done():
+		dst <- noise.ErrNodeKilled
+	}
+}
+
+func loadPendingQueue(peer *noise.Peer) *pendingQueue {
+	t := peer.Get(KeyProtocolPendingQueue)
+
+	if t == nil {
+		return nil
+	}
+
+	if t, ok := t.(*pendingQueue); ok {
+		return t
+	}
+
+	return nil
+}
+
+// EnqueueMessage sends a message to a peer once the peer has completed every block of the protocol
+// enforced on its node, which is typically once a secure session has been established with the peer.
+//
+// Messages enqueued before then are buffered up to a bounded size, and are flushed in the order they
+// were enqueued. Messages enqueued afterwards are sent immediately, in a linearized order with respect
+// to the buffered messages.
+//
+// It returns an error should the buffer be full, or should the peer disconnect or fail prior to
+// completing the protocol.
+func EnqueueMessage(peer *noise.Peer, message noise.Message) <-chan error {
+	queue := loadPendingQueue(peer)
+
+	if queue == nil {
+		result := make(chan error, 1)
+		result <- errors.New("noise: no protocol has been enforced on the peers node")
+		return result
+	}
+
+	return queue.enqueue(peer, message)
+}
+
+// WaitUntilEstablished blocks the current goroutine until a peer has either completed every block
+// of the protocol enforced on its node, or has failed to. Should the peer have failed, or have
+// disconnected beforehand, an error matching ErrPendingQueueAborted is returned.
+func WaitUntilEstablished(peer *noise.Peer) error {
+	queue := loadPendingQueue(peer)
+	if queue == nil {
+		return nil
+	}
+
+	<-queue.ready
+
+	queue.Lock()
+	defer queue.Unlock()
+
+	return queue.aborted
+}
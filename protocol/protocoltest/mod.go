@@ -0,0 +1,389 @@
+// Package protocoltest drives two nodes through the protocol they enforce over a connection which
+// randomly delays, truncates, and duplicates the frames sent over it, and checks that both nodes
+// either converge on the same session or fail safely. It is meant for testing handshake and session
+// blocks, be they those provided by Noise or those built by applications.
+package protocoltest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// DefaultTimeout is how long a trial may run before it is deemed to have hung. It exceeds the
+// default timeouts of the handshake blocks provided by Noise.
+const DefaultTimeout = 15 * time.Second
+
+// DefaultFaults are the faults injected by trials which do not specify any.
+var DefaultFaults = Faults{Truncate: 0.05, Duplicate: 0.05, Delay: 5 * time.Millisecond}
+
+// Faults are the probabilities with which frames are tampered with before both nodes converge.
+// Once both nodes complete their protocol, frames are no longer tampered with.
+type Faults struct {
+	// Truncate is the probability a frame is cut short. The length prefix of a truncated frame is
+	// rewritten, such that the frame arrives whole yet is missing the tail of its contents.
+	Truncate float64
+
+	// Duplicate is the probability a frame is sent twice.
+	Duplicate float64
+
+	// Delay is the longest a frame is held back before being sent, such that the frames both nodes
+	// send interleave differently from trial to trial.
+	Delay time.Duration
+}
+
+// Outcome is how a trial ended.
+type Outcome int
+
+const (
+	// Converged is when both nodes completed their protocol, and derived the same session.
+	Converged Outcome = iota
+
+	// FailedSafely is when the protocol failed, and both nodes disconnected from one another.
+	FailedSafely
+
+	// Unsafe is when the nodes derived different sessions, or when either node hung.
+	Unsafe
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Converged:
+		return "converged"
+	case FailedSafely:
+		return "failed safely"
+	case Unsafe:
+		return "unsafe"
+	default:
+		return fmt.Sprintf("Outcome(%d)", int(o))
+	}
+}
+
+// Config describes the trials to run.
+type Config struct {
+	// Protocol returns the protocol enforced by a node. It is called once for each of the two
+	// nodes of every trial, and must not call Enforce().
+	Protocol func() *protocol.Protocol
+
+	// Node returns a node to run a trial with. By default, nodes are created with default
+	// parameters over a buffered transport layer.
+	Node func() (*noise.Node, error)
+
+	// Verify checks the session established between two nodes once both complete their protocol,
+	// in addition to the shared keys and handshake hashes both derived being compared. It is
+	// optional.
+	Verify func(dialer, listener *noise.Peer) error
+
+	// Faults are the faults to inject. A zero value injects none.
+	Faults Faults
+
+	// Timeout is how long a trial may run before it is deemed to have hung. It defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	// Seed is the seed of the first trial run by Check. Every following trial is run with the
+	// seed of the trial before it plus one.
+	Seed int64
+}
+
+// Result is the outcome of a single trial.
+type Result struct {
+	Seed    int64
+	Outcome Outcome
+
+	// Faults is how many frames were truncated or duplicated throughout the trial.
+	Faults int
+
+	// Err is why the trial did not converge, should it not have.
+	Err error
+}
+
+// Check runs a number of trials, and fails the test for every trial which did not end with both
+// nodes converging or failing safely. The seed of such trials are reported, such that they may be
+// reproduced through Run.
+func Check(t testing.TB, config Config, trials int) []Result {
+	t.Helper()
+
+	results := make([]Result, 0, trials)
+
+	for i := 0; i < trials; i++ {
+		result := Run(config, config.Seed+int64(i))
+
+		if result.Outcome == Unsafe {
+			t.Errorf("protocoltest: trial with seed %d was unsafe after %d fault(s): %v", result.Seed, result.Faults, result.Err)
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Run runs a single trial, with faults drawn from the given seed. As goroutines are scheduled
+// nondeterministically, a seed reproduces the faults injected yet not always the order in which
+// both nodes observe them.
+func Run(config Config, seed int64) Result {
+	result := Result{Seed: seed}
+
+	if config.Protocol == nil {
+		result.Outcome, result.Err = Unsafe, errors.New("protocoltest: no protocol to run trials of")
+		return result
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	if config.Node == nil {
+		config.Node = newNode
+	}
+
+	tr := &trial{events: make(chan event, 6)}
+
+	var nodes [2]*noise.Node
+
+	for side := range nodes {
+		node, err := config.Node()
+		if err != nil {
+			result.Outcome, result.Err = Unsafe, errors.Wrap(err, "protocoltest: failed to create node")
+			return result
+		}
+
+		go node.Listen()
+		defer node.Kill()
+
+		side := side
+
+		// Registered before the protocol is enforced, such that no disconnection may be missed.
+		node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+			peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+				tr.events <- event{side: side, kind: disconnected}
+				return nil
+			})
+
+			return nil
+		})
+
+		config.Protocol().
+			OnEstablished(func(peer *noise.Peer) {
+				tr.events <- event{side: side, kind: established}
+			}).
+			OnFailed(func(peer *noise.Peer, err error) {
+				tr.events <- event{side: side, kind: failed, err: err}
+			}).
+			Enforce(node)
+
+		nodes[side] = node
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	local, remote := net.Pipe()
+
+	dialer := nodes[0].DialConn(tr.wrap(local, config.Faults, rng.Int63()))
+	listener := nodes[1].AcceptConn(tr.wrap(remote, config.Faults, rng.Int63()))
+
+	defer listener.Disconnect()
+	defer dialer.Disconnect()
+
+	result.Outcome, result.Err = tr.await(config, dialer, listener)
+	result.Faults = int(atomic.LoadInt64(&tr.faults))
+
+	return result
+}
+
+func newNode() (*noise.Node, error) {
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	return noise.NewNode(params)
+}
+
+type eventKind int
+
+const (
+	established eventKind = iota
+	failed
+	disconnected
+)
+
+type event struct {
+	side int
+	kind eventKind
+	err  error
+}
+
+type trial struct {
+	events chan event
+
+	established, disconnected [2]bool
+	err                       error
+
+	// quiet is set once both nodes complete their protocol, after which faults are no longer
+	// injected.
+	quiet  uint32
+	faults int64
+}
+
+func (tr *trial) apply(e event) {
+	switch e.kind {
+	case established:
+		tr.established[e.side] = true
+	case failed:
+		if tr.err == nil {
+			tr.err = e.err
+		}
+	case disconnected:
+		tr.disconnected[e.side] = true
+	}
+}
+
+// await waits until both nodes either complete their protocol or disconnect from one another.
+func (tr *trial) await(config Config, dialer, listener *noise.Peer) (Outcome, error) {
+	timeout := time.After(config.Timeout)
+
+	for {
+		select {
+		case e := <-tr.events:
+			tr.apply(e)
+		case <-timeout:
+			return Unsafe, errors.Errorf("protocoltest: timed out after %s with established=%v and disconnected=%v", config.Timeout, tr.established, tr.disconnected)
+		}
+
+		if tr.established[0] && tr.established[1] {
+			atomic.StoreUint32(&tr.quiet, 1)
+
+			if err := verify(config, dialer, listener); err != nil {
+				// A session torn down while being verified has failed safely.
+				tr.drain()
+
+				if tr.disconnected[0] || tr.disconnected[1] {
+					return FailedSafely, err
+				}
+
+				return Unsafe, err
+			}
+
+			return Converged, nil
+		}
+
+		if tr.disconnected[0] && tr.disconnected[1] {
+			if tr.err == nil {
+				tr.err = errors.New("protocoltest: both nodes disconnected")
+			}
+
+			return FailedSafely, tr.err
+		}
+	}
+}
+
+func (tr *trial) drain() {
+	for {
+		select {
+		case e := <-tr.events:
+			tr.apply(e)
+		default:
+			return
+		}
+	}
+}
+
+func verify(config Config, dialer, listener *noise.Peer) error {
+	if !bytes.Equal(protocol.LoadSharedKey(dialer), protocol.LoadSharedKey(listener)) {
+		return errors.New("protocoltest: nodes derived different shared keys")
+	}
+
+	if !bytes.Equal(protocol.LoadHandshakeHash(dialer), protocol.LoadHandshakeHash(listener)) {
+		return errors.New("protocoltest: nodes derived different handshake hashes")
+	}
+
+	if config.Verify != nil {
+		return config.Verify(dialer, listener)
+	}
+
+	return nil
+}
+
+func (tr *trial) wrap(conn net.Conn, faults Faults, seed int64) net.Conn {
+	return &faultyConn{Conn: conn, trial: tr, faults: faults, rng: rand.New(rand.NewSource(seed))}
+}
+
+var pipeAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+// faultyConn tampers with the frames written to it. Peers write every frame whole in a single
+// write, and so frames need not be reassembled.
+type faultyConn struct {
+	net.Conn
+
+	trial  *trial
+	faults Faults
+
+	sync.Mutex
+	rng *rand.Rand
+}
+
+func (c *faultyConn) Write(buf []byte) (int, error) {
+	if atomic.LoadUint32(&c.trial.quiet) == 1 {
+		return c.Conn.Write(buf)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	// Draw every value up front, such that a seed injects the same faults regardless of the
+	// frames written.
+	delay := time.Duration(c.rng.Int63n(int64(c.faults.Delay) + 1))
+	truncate, duplicate, cut := c.rng.Float64() < c.faults.Truncate, c.rng.Float64() < c.faults.Duplicate, c.rng.Int()
+
+	time.Sleep(delay)
+
+	frame := buf
+	size, n := binary.Uvarint(buf)
+
+	// Heartbeats are left alone, as are writes which do not carry exactly one frame.
+	if n <= 0 || size == 0 || uint64(len(buf)-n) != size {
+		return c.Conn.Write(buf)
+	}
+
+	// Frames are never truncated down to nothing, as an empty frame is a heartbeat.
+	if truncate && size > 1 {
+		contents := buf[n : n+1+cut%int(size-1)]
+
+		frame = make([]byte, binary.MaxVarintLen64)
+		frame = append(frame[:binary.PutUvarint(frame, uint64(len(contents)))], contents...)
+
+		atomic.AddInt64(&c.trial.faults, 1)
+	}
+
+	if _, err := c.Conn.Write(frame); err != nil {
+		return 0, err
+	}
+
+	if duplicate {
+		atomic.AddInt64(&c.trial.faults, 1)
+
+		if _, err := c.Conn.Write(frame); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(buf), nil
+}
+
+// LocalAddr and RemoteAddr report TCP addresses, which every transport layer may parse.
+func (c *faultyConn) LocalAddr() net.Addr {
+	return pipeAddr
+}
+
+func (c *faultyConn) RemoteAddr() net.Addr {
+	return pipeAddr
+}
@@ -0,0 +1,96 @@
+package protocoltest
+
+import (
+	"crypto/rand"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/cipher/aead"
+	"github.com/perlin-network/noise/handshake/ecdh"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func session() *protocol.Protocol {
+	return protocol.New().Register(ecdh.New().TimeoutAfter(time.Second)).Register(aead.New().WithACKTimeout(time.Second))
+}
+
+func TestConverges(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	for _, result := range Check(t, Config{Protocol: session}, 5) {
+		assert.Equal(t, Converged, result.Outcome, "seed %d: %v", result.Seed, result.Err)
+		assert.Zero(t, result.Faults)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	config := Config{Protocol: session, Faults: Faults{Truncate: 0.2, Duplicate: 0.2, Delay: 2 * time.Millisecond}, Timeout: 5 * time.Second}
+
+	var faults int
+
+	for _, result := range Check(t, config, 10) {
+		faults += result.Faults
+	}
+
+	assert.NotZero(t, faults)
+}
+
+// keyless is a broken handshake block which has each node pick its own shared key.
+type keyless struct{}
+
+func (keyless) OnRegister(p *protocol.Protocol, node *noise.Node) {}
+
+func (keyless) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	key := make([]byte, 32)
+
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	protocol.SetSharedKey(peer, key)
+	return nil
+}
+
+func (keyless) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// stuck is a broken handshake block which never completes, nor disconnects its peer.
+type stuck struct{}
+
+func (stuck) OnRegister(p *protocol.Protocol, node *noise.Node) {}
+
+func (stuck) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	disconnected := make(chan struct{})
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	<-disconnected
+	return nil
+}
+
+func (stuck) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+func TestUnsafe(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	result := Run(Config{Protocol: func() *protocol.Protocol { return protocol.New().Register(keyless{}) }}, 0)
+	assert.Equal(t, Unsafe, result.Outcome)
+	assert.Error(t, result.Err)
+
+	result = Run(Config{Protocol: func() *protocol.Protocol { return protocol.New().Register(stuck{}) }, Timeout: 100 * time.Millisecond}, 0)
+	assert.Equal(t, Unsafe, result.Outcome)
+	assert.Error(t, result.Err)
+}
@@ -0,0 +1,51 @@
+package protocol
+
+import (
+	"github.com/perlin-network/noise"
+)
+
+const (
+	KeySessionPattern = "identity.session.pattern"
+	KeySessionCipher  = "identity.session.cipher"
+	KeySessionHash    = "identity.session.hash"
+)
+
+// Session describes the session established with a peer, such that applications may log or audit
+// it, or bind external authentication to the exact session.
+type Session struct {
+	// HandshakeHash is the hash of the transcript of the handshake which established the session.
+	// Both peers share the same hash, which is unique to the session, and so may serve as a
+	// channel binding value.
+	HandshakeHash []byte
+
+	// Pattern is the key exchange which established the session, such as "ECDH-Ed25519".
+	Pattern string
+
+	// Cipher is the AEAD cipher suite which encrypts messages within the session, and Hash is the
+	// hash keys of the session are derived with. Both are empty should the session not be encrypted.
+	Cipher string
+	Hash   string
+}
+
+// LoadSession returns what the blocks of our protocol set about the session established with a
+// peer. Fields no block has set are left empty.
+func LoadSession(peer *noise.Peer) Session {
+	pattern, _ := peer.Get(KeySessionPattern).(string)
+	cipher, _ := peer.Get(KeySessionCipher).(string)
+	hash, _ := peer.Get(KeySessionHash).(string)
+
+	return Session{HandshakeHash: LoadHandshakeHash(peer), Pattern: pattern, Cipher: cipher, Hash: hash}
+}
+
+// SetSessionPattern sets the name of the key exchange which established the session with a peer.
+// It is set by the handshake block alongside the handshake hash.
+func SetSessionPattern(peer *noise.Peer, pattern string) {
+	peer.Set(KeySessionPattern, pattern)
+}
+
+// SetSessionCipher sets the names of the cipher suite which encrypts messages within the session
+// with a peer, and of the hash keys of the session are derived with.
+func SetSessionCipher(peer *noise.Peer, cipher, hash string) {
+	peer.Set(KeySessionCipher, cipher)
+	peer.Set(KeySessionHash, hash)
+}
@@ -0,0 +1,140 @@
+package protocol
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/resource"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+const KeyProtocolHandshakes = "protocol.handshakes"
+
+var (
+	ErrHandshakeShed = errors.New("protocol: handshake was shed to make room for newer handshakes")
+)
+
+// HandshakeStats describes the handshakes our node has in progress, and how many bytes are reserved
+// for them altogether.
+type HandshakeStats struct {
+	// InProgress counts the peers which have yet to complete the protocol.
+	InProgress int `json:"in_progress"`
+
+	// Bytes is how many bytes are reserved for handshakes in progress, and Cap how many bytes may be
+	// reserved for them at most. A cap of zero leaves handshakes uncapped.
+	Bytes uint64 `json:"bytes"`
+	Cap   uint64 `json:"cap"`
+
+	// Shed counts the handshakes which were shed to make room for newer handshakes, and Refused the
+	// handshakes which could not be made room for.
+	Shed    uint64 `json:"shed"`
+	Refused uint64 `json:"refused"`
+}
+
+// handshakes tracks the handshakes a node has in progress, from oldest to newest, such that the
+// oldest may be shed once the bytes reserved for all of them would exceed a cap.
+type handshakes struct {
+	sync.Mutex
+
+	cap     uint64
+	bytes   uint64
+	pending []*handshake
+
+	shed, refused uint64
+}
+
+// handshake is a handshake in progress with a peer.
+type handshake struct {
+	peer  *noise.Peer
+	queue *pendingQueue
+	size  uint64
+
+	shed bool
+}
+
+func newHandshakes(cap uint64) *handshakes {
+	return &handshakes{cap: cap}
+}
+
+// admit tracks a new handshake with a peer. Should the bytes reserved for it exceed the cap, the
+// oldest handshakes are shed until it fits. It returns an error matching resource.ErrLimitExceeded
+// should the handshake not fit even once every other handshake is shed.
+func (h *handshakes) admit(peer *noise.Peer, queue *pendingQueue, size uint64) (*handshake, error) {
+	h.Lock()
+
+	if h.cap > 0 && size > h.cap {
+		h.refused++
+		h.Unlock()
+
+		return nil, errors.Wrapf(resource.ErrLimitExceeded, "handshakes may reserve at most %d bytes, yet %d bytes are to be reserved for every handshake", h.cap, size)
+	}
+
+	var shed []*handshake
+
+	for h.cap > 0 && h.bytes+size > h.cap {
+		oldest := h.pending[0]
+		h.pending = h.pending[1:]
+
+		h.bytes -= oldest.size
+		h.shed++
+
+		oldest.shed = true
+		shed = append(shed, oldest)
+	}
+
+	entry := &handshake{peer: peer, queue: queue, size: size}
+
+	h.pending = append(h.pending, entry)
+	h.bytes += size
+
+	h.Unlock()
+
+	// Handshakes are failed before their peers are disconnected, such that they are reported as shed
+	// rather than as disconnected.
+	for _, oldest := range shed {
+		oldest.queue.abort(abortWith(ErrHandshakeShed))
+		oldest.peer.DisconnectAsync()
+	}
+
+	return entry, nil
+}
+
+// remove stops tracking a handshake once it completes, fails, or its peer disconnects.
+func (h *handshakes) remove(entry *handshake) {
+	h.Lock()
+	defer h.Unlock()
+
+	for i, pending := range h.pending {
+		if pending == entry {
+			h.pending = append(h.pending[:i], h.pending[i+1:]...)
+			h.bytes -= entry.size
+
+			return
+		}
+	}
+}
+
+// wasShed reports whether a handshake was shed.
+func (h *handshakes) wasShed(entry *handshake) bool {
+	h.Lock()
+	defer h.Unlock()
+
+	return entry.shed
+}
+
+func (h *handshakes) stats() HandshakeStats {
+	h.Lock()
+	defer h.Unlock()
+
+	return HandshakeStats{InProgress: len(h.pending), Bytes: h.bytes, Cap: h.cap, Shed: h.shed, Refused: h.refused}
+}
+
+// Handshakes returns the handshakes a node has in progress, and how many bytes are reserved for
+// them altogether. It returns zero stats should no protocol be enforced on the node.
+func Handshakes(node *noise.Node) HandshakeStats {
+	h, ok := node.Get(KeyProtocolHandshakes).(*handshakes)
+	if !ok {
+		return HandshakeStats{}
+	}
+
+	return h.stats()
+}
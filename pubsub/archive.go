@@ -0,0 +1,198 @@
+package pubsub
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// keyArchives names the section of state our nodes archives are exported to.
+const keyArchives = "pubsub.archives"
+
+// WithArchive has our node archive the most recent messages accepted on a topic, such that peers
+// which subscribe late may fetch them through Fetch. At most size messages are archived, and should
+// ttl be positive, messages are only replayed for as long as ttl since they were archived.
+func (b *block) WithArchive(topic string, size int, ttl time.Duration) *block {
+	if size <= 0 {
+		panic("pubsub: archive size must be positive")
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.archives[topic] = archiveParams{size: size, ttl: ttl}
+	return b
+}
+
+// Fetch requests all peers of our node to replay the messages they archived for a topic. Messages
+// replayed are validated, and delivered to our subscribers should they not have been seen before.
+// They are not propagated any further.
+func Fetch(node *noise.Node, topic string) error {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return errors.New("pubsub: block is not registered to the nodes protocol")
+	}
+
+	for _, peer := range s.snapshot() {
+		peer.SendMessageAsync(FetchRequest{Topic: topic})
+	}
+
+	return nil
+}
+
+type archiveParams struct {
+	size int
+	ttl  time.Duration
+}
+
+// archive is a ring buffer of the most recent messages accepted on a topic.
+type archive struct {
+	sync.Mutex
+	archiveParams
+
+	clock   clock.Clock
+	entries []archived
+	next    int
+}
+
+type archived struct {
+	msg Gossip
+	at  time.Time
+}
+
+func newArchive(params archiveParams, clock clock.Clock) *archive {
+	return &archive{archiveParams: params, clock: clock}
+}
+
+func (a *archive) add(msg Gossip) {
+	a.addAt(msg, a.clock.Now())
+}
+
+// restore archives a message as though it were archived at a time.
+func (a *archive) restore(msg Gossip, at time.Time) {
+	a.addAt(msg, at)
+}
+
+func (a *archive) addAt(msg Gossip, at time.Time) {
+	a.Lock()
+	defer a.Unlock()
+
+	entry := archived{msg: msg, at: at}
+
+	if len(a.entries) < a.size {
+		a.entries = append(a.entries, entry)
+		return
+	}
+
+	a.entries[a.next] = entry
+	a.next = (a.next + 1) % a.size
+}
+
+// messages returns the archived messages which have not expired, from oldest to newest.
+func (a *archive) messages() []Gossip {
+	a.Lock()
+	defer a.Unlock()
+
+	msgs := make([]Gossip, 0, len(a.entries))
+
+	for i := range a.entries {
+		entry := a.entries[(a.next+i)%len(a.entries)]
+
+		if a.ttl > 0 && a.clock.Since(entry.at) > a.ttl {
+			continue
+		}
+
+		msgs = append(msgs, entry.msg)
+	}
+
+	return msgs
+}
+
+// exportArchives writes every message archived by our node alongside when it was archived, such that
+// archives may be restored through restoreArchives.
+func (s *state) exportArchives(node *noise.Node) ([]byte, error) {
+	topics := make([]string, 0, len(s.archives))
+
+	for topic := range s.archives {
+		topics = append(topics, topic)
+	}
+
+	sort.Strings(topics)
+
+	w := payload.NewWriter(nil).WriteUint32(uint32(len(topics)))
+
+	for _, topic := range topics {
+		a := s.archives[topic]
+
+		a.Lock()
+
+		w.WriteString(topic).WriteUint32(uint32(len(a.entries)))
+
+		for i := range a.entries {
+			entry := a.entries[(a.next+i)%len(a.entries)]
+			w.WriteBytes(entry.msg.Write()).WriteUint64(uint64(entry.at.UnixNano()))
+		}
+
+		a.Unlock()
+	}
+
+	return w.Bytes(), nil
+}
+
+// restoreArchives archives the messages exported by exportArchives anew, and marks them as seen.
+// Messages exported for topics our node no longer archives are skipped.
+func (s *state) restoreArchives(node *noise.Node, buf []byte) error {
+	reader := payload.NewReader(buf)
+
+	numTopics, err := reader.ReadUint32()
+	if err != nil {
+		return errors.Wrap(err, "pubsub: failed to read number of archived topics")
+	}
+
+	for i := uint32(0); i < numTopics; i++ {
+		topic, err := reader.ReadString()
+		if err != nil {
+			return errors.Wrap(err, "pubsub: failed to read archived topic")
+		}
+
+		numMessages, err := reader.ReadUint32()
+		if err != nil {
+			return errors.Wrapf(err, "pubsub: failed to read number of messages archived on topic %q", topic)
+		}
+
+		a := s.archives[topic]
+
+		for j := uint32(0); j < numMessages; j++ {
+			raw, err := reader.ReadBytes()
+			if err != nil {
+				return errors.Wrapf(err, "pubsub: failed to read message archived on topic %q", topic)
+			}
+
+			nanos, err := reader.ReadUint64()
+			if err != nil {
+				return errors.Wrapf(err, "pubsub: failed to read when a message on topic %q was archived", topic)
+			}
+
+			msg, err := Gossip{}.Read(payload.NewReader(raw))
+			if err != nil {
+				return errors.Wrapf(err, "pubsub: failed to decode message archived on topic %q", topic)
+			}
+
+			if a == nil {
+				continue
+			}
+
+			if _, err := s.seen.SeenMessage(msg); err != nil {
+				return errors.Wrap(err, "pubsub: failed to mark message as seen")
+			}
+
+			a.restore(msg.(Gossip), time.Unix(0, int64(nanos)))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package pubsub
+
+import (
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/signature"
+	"sync"
+	"time"
+)
+
+// WithBatchVerification has the signatures of messages received verified in batches of up to a
+// number of messages, rather than one by one, which takes less time per signature on nodes relaying
+// many messages at once. Messages are held for at most a delay for a batch to fill up before what
+// was collected so far is verified.
+//
+// The signature scheme set via WithSigning must implement `signature.BatchVerifier`. Peers which do
+// not opt in verify signatures one by one under the same rules as batches, so verifying in batches
+// only changes how quick signatures are verified, and peers need not opt in alike.
+func (b *block) WithBatchVerification(size int, delay time.Duration) *block {
+	if size <= 0 {
+		panic("pubsub: batch size must be positive")
+	}
+
+	b.batchSize, b.batchDelay = size, delay
+	return b
+}
+
+// batcher collects the envelopes of messages received, and verifies their signatures in batches.
+type batcher struct {
+	verifier signature.BatchVerifier
+	clock    clock.Clock
+
+	size  int
+	delay time.Duration
+
+	sync.Mutex
+	pending []pendingVerification
+	timer   clock.Timer
+}
+
+type pendingVerification struct {
+	msg    Gossip
+	result chan error
+}
+
+// verify queues the signature of a message to be verified in the next batch, and blocks until the
+// batch is verified. The batch is verified by whoever fills it up, or once the delay elapses since
+// the first message of the batch was queued.
+func (b *batcher) verify(msg Gossip) error {
+	result := make(chan error, 1)
+
+	b.Lock()
+	b.pending = append(b.pending, pendingVerification{msg: msg, result: result})
+
+	var full []pendingVerification
+
+	if len(b.pending) >= b.size {
+		full = b.take()
+	} else if len(b.pending) == 1 {
+		b.timer = b.clock.AfterFunc(b.delay, b.flush)
+	}
+	b.Unlock()
+
+	if full != nil {
+		b.run(full)
+	}
+
+	return <-result
+}
+
+// flush verifies the batch collected so far. Timers which fire just as their batch fills up flush
+// the batch after it early, which is harmless.
+func (b *batcher) flush() {
+	b.Lock()
+	batch := b.take()
+	b.Unlock()
+
+	b.run(batch)
+}
+
+// take empties out the batch collected so far. It must be called with the batcher locked.
+func (b *batcher) take() []pendingVerification {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	batch := b.pending
+	b.pending = nil
+
+	return batch
+}
+
+func (b *batcher) run(batch []pendingVerification) {
+	if len(batch) == 0 {
+		return
+	}
+
+	publicKeys := make([][]byte, len(batch))
+	payloads := make([][]byte, len(batch))
+	signatures := make([][]byte, len(batch))
+
+	for i, item := range batch {
+		publicKeys[i], payloads[i], signatures[i] = item.msg.From, item.msg.signingPayload(), item.msg.Signature
+	}
+
+	for i, err := range b.verifier.VerifyBatch(publicKeys, payloads, signatures) {
+		batch[i].result <- err
+	}
+}
@@ -0,0 +1,191 @@
+package pubsub
+
+import (
+	"bytes"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultFluffProbability = 0.1
+	DefaultStemEpoch        = 10 * time.Minute
+	DefaultEmbargo          = 30 * time.Second
+
+	// stemRelays is the number of peers picked every epoch to forward messages in their stem phase to.
+	stemRelays = 2
+)
+
+// WithStem has messages published to a topic propagated in two phases, akin to Dandelion++. In the
+// stem phase, a message is forwarded along a random path of peers, until a peer fluffs it. In the
+// fluff phase, the message is then propagated to all peers as any other message, such that peers
+// observing the fluff phase may not tell which peer published the message.
+func (b *block) WithStem(topic string) *block {
+	b.Lock()
+	defer b.Unlock()
+
+	b.stems[topic] = struct{}{}
+	return b
+}
+
+// WithFluffProbability sets the probability of our node fluffing all messages it receives in their
+// stem phase for an epoch, rather than forwarding them.
+func (b *block) WithFluffProbability(probability float64) *block {
+	b.fluffProbability = probability
+	return b
+}
+
+// WithStemEpoch sets how often our node decides anew whether to fluff messages in their stem phase,
+// and which peers to forward them to.
+func (b *block) WithStemEpoch(epoch time.Duration) *block {
+	b.stemEpoch = epoch
+	return b
+}
+
+// WithEmbargo sets how long our node waits to see a message it forwarded in its stem phase be
+// fluffed, before fluffing the message itself. It guards against peers which drop messages in
+// their stem phase.
+func (b *block) WithEmbargo(embargo time.Duration) *block {
+	b.embargo = embargo
+	return b
+}
+
+// dandelion holds the decisions our node made for the current epoch on how it forwards messages in
+// their stem phase.
+type dandelion struct {
+	sync.Mutex
+
+	start time.Time
+
+	fluff  bool
+	relays []*noise.Peer
+	routes map[*noise.Peer]*noise.Peer
+}
+
+// route returns the peer to forward a message in its stem phase, received from a peer, to. It
+// returns nil should our node fluff the message instead. Messages published by our node are given
+// a nil peer.
+func (s *state) route(from *noise.Peer) *noise.Peer {
+	d := s.dandelion
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.start.IsZero() || s.node.Clock().Since(d.start) >= s.block.stemEpoch || !s.connected(d.relays) {
+		s.epoch()
+	}
+
+	if d.fluff && from != nil {
+		return nil
+	}
+
+	if relay, exists := d.routes[from]; exists {
+		return relay
+	}
+
+	var candidates []*noise.Peer
+
+	for _, relay := range d.relays {
+		if relay != from {
+			candidates = append(candidates, relay)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	relay := candidates[s.node.Random().Intn(len(candidates))]
+	d.routes[from] = relay
+
+	return relay
+}
+
+// epoch begins a new epoch, deciding whether to fluff messages, and which peers to forward messages
+// to. It must be called with the lock of the dandelion held.
+func (s *state) epoch() {
+	d := s.dandelion
+
+	// Peers are sorted before being shuffled, such that our node picks the same relays given the same
+	// source of randomness.
+	peers := s.snapshot()
+	sortByAddress(peers)
+	s.node.Random().Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+
+	d.relays = d.relays[:0]
+
+	for _, peer := range peers {
+		if len(d.relays) == stemRelays {
+			break
+		}
+
+		if Score(peer) >= s.block.graylistThreshold {
+			d.relays = append(d.relays, peer)
+		}
+	}
+
+	d.start = s.node.Clock().Now()
+	d.fluff = s.node.Random().Float64() < s.block.fluffProbability
+	d.routes = make(map[*noise.Peer]*noise.Peer)
+}
+
+// connected reports whether all relays are still connected to our node.
+func (s *state) connected(relays []*noise.Peer) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, relay := range relays {
+		if _, exists := s.peers[relay]; !exists {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stem forwards a message in its stem phase, or fluffs it should our node be fluffing messages, or
+// have no peer to forward it to. Messages forwarded are fluffed by our node should they not have been
+// seen fluffed once the embargo ends.
+func (s *state) stem(from *noise.Peer, msg Gossip) {
+	relay := s.route(from)
+
+	if relay == nil {
+		s.fluff(from, msg)
+		return
+	}
+
+	relay.SendMessageAsync(Stem{Gossip: msg})
+
+	s.node.Clock().AfterFunc(s.block.embargo, func() {
+		if s.fluff(from, msg) {
+			log.Debug().Str("topic", msg.Topic).Msg("Fluffed a message whose embargo ended.")
+		}
+	})
+}
+
+// fluff delivers and propagates a message to all peers, should it not have been seen already. It
+// reports whether the message was fluffed. The message is propagated to the peer it was received
+// from as well, as the peer has only seen the message in its stem phase.
+func (s *state) fluff(from *noise.Peer, msg Gossip) bool {
+	if seen, err := s.seen.SeenMessage(msg); err != nil || seen {
+		return false
+	}
+
+	s.deliver(from, msg)
+	s.propagate(nil, msg)
+
+	return true
+}
+
+// sortByAddress sorts peers by their remote address.
+func sortByAddress(peers []*noise.Peer) {
+	sort.Slice(peers, func(i, j int) bool {
+		if c := bytes.Compare(peers[i].RemoteIP(), peers[j].RemoteIP()); c != 0 {
+			return c < 0
+		}
+
+		return peers[i].RemotePort() < peers[j].RemotePort()
+	})
+}
@@ -0,0 +1,381 @@
+package pubsub
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"sync"
+)
+
+const (
+	groupKeySize = 32
+
+	groupKeyInfo = "noise pubsub group key"
+)
+
+// The data of every message published to the topic of a group is prefixed with its kind.
+const (
+	kindGroupMessage byte = iota
+	kindGroupKeys
+)
+
+var (
+	ErrNotAdmin   = errors.New("pubsub: only the admin of a group may change its members")
+	ErrNoGroupKey = errors.New("pubsub: no key to encrypt messages to the group with")
+)
+
+// Group encrypts messages published to a topic under a key shared by its members, such that peers
+// outside of the group may relay messages published to the group, yet may not read them.
+//
+// The key of a group is chosen by its admin, and is rotated whenever the admin adds or removes a
+// member. Every new key is sealed to the static public key of each member, and is published to the
+// topic of the group signed by the admin.
+type Group struct {
+	topic string
+	admin []byte
+
+	sync.RWMutex
+
+	members map[string][]byte
+
+	// keys holds the key of the current epoch of the group, and of the epoch prior, such that
+	// messages published right before a key was rotated may still be read.
+	epoch uint64
+	keys  map[uint64][]byte
+}
+
+// NewGroup returns a group whose messages are published to a topic, and whose members are chosen by
+// the node with the public key admin.
+func NewGroup(topic string, admin []byte) *Group {
+	return &Group{
+		topic:   topic,
+		admin:   append([]byte(nil), admin...),
+		members: make(map[string][]byte),
+		keys:    make(map[uint64][]byte),
+	}
+}
+
+// WithGroup has our node read messages published to a group, and hand them decrypted to a handler.
+// Messages published to the group which our node may not read are relayed untouched. Groups require
+// our node to sign and verify messages via WithSigning, as keys are only accepted from the admin.
+func (b *block) WithGroup(group *Group, handler Handler) *block {
+	b.Lock()
+	b.groups = append(b.groups, group)
+	b.Unlock()
+
+	return b.Subscribe(group.topic, func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+		return group.receive(node, peer, msg, handler)
+	})
+}
+
+// Topic returns the topic messages published to the group are published to.
+func (g *Group) Topic() string {
+	return g.topic
+}
+
+// Add adds a member to the group by its public key, and rotates the key of the group. Only the admin
+// of the group may add members.
+func (g *Group) Add(node *noise.Node, member []byte) error {
+	if !edwards25519.IsGroupElement(member) {
+		return errors.New("pubsub: member public key is not a valid ed25519 public key")
+	}
+
+	return g.change(node, func() {
+		g.members[string(member)] = append([]byte(nil), member...)
+	})
+}
+
+// Remove removes a member from the group by its public key, and rotates the key of the group, such
+// that the member may not read messages published to the group from then on. Only the admin of the
+// group may remove members.
+func (g *Group) Remove(node *noise.Node, member []byte) error {
+	return g.change(node, func() {
+		delete(g.members, string(member))
+	})
+}
+
+// Publish encrypts data under the current key of the group, and publishes it to the topic of the
+// group. It returns ErrNoGroupKey should our node not have received a key for the group.
+func (g *Group) Publish(node *noise.Node, data []byte) error {
+	g.RLock()
+	epoch, key := g.epoch, g.keys[g.epoch]
+	g.RUnlock()
+
+	if key == nil {
+		return ErrNoGroupKey
+	}
+
+	suite, err := newGroupSuite(key)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, suite.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.Wrap(err, "pubsub: failed to generate nonce")
+	}
+
+	ciphertext := suite.Seal(nil, nonce, data, g.associatedData(epoch))
+
+	return Publish(node, g.topic, payload.NewWriter([]byte{kindGroupMessage}).
+		WriteUint64(epoch).
+		WriteBytes(nonce).
+		WriteBytes(ciphertext).
+		Bytes())
+}
+
+// change applies a change to the members of the group, rotates the key of the group, and publishes
+// the new key sealed to every member.
+func (g *Group) change(node *noise.Node, fn func()) error {
+	if node.Keys == nil || !bytes.Equal(node.Keys.PublicKey(), g.admin) {
+		return ErrNotAdmin
+	}
+
+	key := make([]byte, groupKeySize)
+
+	if _, err := rand.Read(key); err != nil {
+		return errors.Wrap(err, "pubsub: failed to generate group key")
+	}
+
+	ephemeralPublicKey, ephemeralPrivateKey, err := edwards25519.GenerateKey(nil)
+	if err != nil {
+		return errors.Wrap(err, "pubsub: failed to generate ephemeral keypair")
+	}
+
+	g.Lock()
+
+	fn()
+	g.install(g.epoch+1, key)
+
+	epoch := g.epoch
+
+	members := make([][]byte, 0, len(g.members))
+	for _, member := range g.members {
+		members = append(members, member)
+	}
+
+	g.Unlock()
+
+	w := payload.NewWriter([]byte{kindGroupKeys}).
+		WriteUint64(epoch).
+		WriteBytes(ephemeralPublicKey).
+		WriteUint32(uint32(len(members)))
+
+	for _, member := range members {
+		sealed, err := g.seal(epoch, edwards25519.SharedKey(ephemeralPrivateKey, member), key)
+		if err != nil {
+			return err
+		}
+
+		w.WriteBytes(member).WriteBytes(sealed)
+	}
+
+	return Publish(node, g.topic, w.Bytes())
+}
+
+func (g *Group) receive(node *noise.Node, peer *noise.Peer, msg Gossip, handler Handler) error {
+	reader := payload.NewReader(msg.Data)
+
+	kind, err := reader.ReadByte()
+	if err != nil {
+		return nil
+	}
+
+	switch kind {
+	case kindGroupKeys:
+		g.receiveKeys(node, msg, reader)
+	case kindGroupMessage:
+		data, ok := g.open(reader)
+		if !ok {
+			return nil
+		}
+
+		msg.Data = data
+
+		return handler(node, peer, msg)
+	}
+
+	return nil
+}
+
+// receiveKeys installs the key of a new epoch of the group sealed to our node, should the key have
+// been published by the admin of the group.
+func (g *Group) receiveKeys(node *noise.Node, msg Gossip, reader payload.Reader) {
+	if !msg.Signed() || !bytes.Equal(msg.From, g.admin) {
+		log.Debug().Str("topic", g.topic).Msg("Ignored group keys which were not published by the admin of the group.")
+		return
+	}
+
+	if node.Keys == nil || len(node.Keys.PrivateKey()) != edwards25519.PrivateKeySize {
+		return
+	}
+
+	epoch, err := reader.ReadUint64()
+	if err != nil {
+		return
+	}
+
+	g.RLock()
+	stale := epoch <= g.epoch
+	g.RUnlock()
+
+	if stale {
+		return
+	}
+
+	ephemeralPublicKey, err := reader.ReadBytes()
+	if err != nil || !edwards25519.IsGroupElement(ephemeralPublicKey) {
+		return
+	}
+
+	count, err := reader.ReadUint32()
+	if err != nil {
+		return
+	}
+
+	for i := uint32(0); i < count; i++ {
+		member, err := reader.ReadBytes()
+		if err != nil {
+			return
+		}
+
+		sealed, err := reader.ReadBytes()
+		if err != nil {
+			return
+		}
+
+		if !bytes.Equal(member, node.Keys.PublicKey()) {
+			continue
+		}
+
+		key, err := g.unseal(epoch, edwards25519.SharedKey(node.Keys.PrivateKey(), ephemeralPublicKey), sealed)
+		if err != nil {
+			log.Warn().Err(err).Str("topic", g.topic).Msg("Failed to open the group key sealed to our node.")
+			return
+		}
+
+		g.Lock()
+		if epoch > g.epoch {
+			g.install(epoch, key)
+		}
+		g.Unlock()
+
+		return
+	}
+
+	// Our node is no longer a member of the group, so the keys we hold are forgotten.
+	g.Lock()
+	if epoch > g.epoch {
+		g.epoch, g.keys = epoch, make(map[uint64][]byte)
+	}
+	g.Unlock()
+}
+
+// open decrypts a message published to the group. It reports false should our node not hold the key
+// of the epoch the message was published under, or should the message fail to be authenticated.
+func (g *Group) open(reader payload.Reader) ([]byte, bool) {
+	epoch, err := reader.ReadUint64()
+	if err != nil {
+		return nil, false
+	}
+
+	nonce, err := reader.ReadBytes()
+	if err != nil {
+		return nil, false
+	}
+
+	ciphertext, err := reader.ReadBytes()
+	if err != nil {
+		return nil, false
+	}
+
+	g.RLock()
+	key := g.keys[epoch]
+	g.RUnlock()
+
+	if key == nil {
+		return nil, false
+	}
+
+	suite, err := newGroupSuite(key)
+	if err != nil || len(nonce) != suite.NonceSize() {
+		return nil, false
+	}
+
+	data, err := suite.Open(nil, nonce, ciphertext, g.associatedData(epoch))
+	if err != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
+// install sets the key of a new epoch, keeping only the key of the epoch prior. It must be called
+// with the lock held.
+func (g *Group) install(epoch uint64, key []byte) {
+	prior, previous := g.epoch, g.keys[g.epoch]
+
+	g.epoch, g.keys = epoch, map[uint64][]byte{epoch: key}
+
+	if previous != nil {
+		g.keys[prior] = previous
+	}
+}
+
+func (g *Group) associatedData(epoch uint64) []byte {
+	return payload.NewWriter(nil).WriteString(g.topic).WriteUint64(epoch).Bytes()
+}
+
+// seal seals the key of an epoch to a member, under a key derived from an ephemeral shared key
+// with the member. As every ephemeral shared key is used once, the nonce is left zeroed.
+func (g *Group) seal(epoch uint64, sharedKey, key []byte) ([]byte, error) {
+	suite, err := g.sealingSuite(sharedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return suite.Seal(nil, make([]byte, suite.NonceSize()), key, g.associatedData(epoch)), nil
+}
+
+func (g *Group) unseal(epoch uint64, sharedKey, sealed []byte) ([]byte, error) {
+	suite, err := g.sealingSuite(sharedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := suite.Open(nil, make([]byte, suite.NonceSize()), sealed, g.associatedData(epoch))
+	if err != nil {
+		return nil, errors.Wrap(noise.ErrDecryptFailed, "group key authentication failed")
+	}
+
+	return key, nil
+}
+
+func (g *Group) sealingSuite(sharedKey []byte) (cipher.AEAD, error) {
+	key := make([]byte, groupKeySize)
+
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedKey, nil, []byte(groupKeyInfo)), key); err != nil {
+		return nil, errors.Wrap(err, "pubsub: failed to derive key via HKDF")
+	}
+
+	return newGroupSuite(key)
+}
+
+func newGroupSuite(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "pubsub: failed to create AES block cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
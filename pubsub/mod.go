@@ -0,0 +1,539 @@
+// Package pubsub propagates messages published to topics across all peers of a node, running
+// validators registered per topic before messages are delivered or propagated any further, such
+// that invalid messages are dropped at the first hop.
+package pubsub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/dedup"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/signature"
+	"github.com/pkg/errors"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	keyState = "pubsub.state"
+
+	DefaultValidateQueue   = 256
+	DefaultValidateTimeout = 1 * time.Second
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrRejected = errors.New("pubsub: message was rejected by a validator")
+)
+
+// Result is the verdict of a validator on a message.
+type Result int
+
+const (
+	// Accept delivers a message to subscribers, and propagates it to peers.
+	Accept Result = iota
+
+	// Reject drops a message which is invalid, such as one whose signature fails to be verified.
+	Reject
+
+	// Ignore drops a message which is not invalid, yet should not be propagated, such as one which
+	// is stale.
+	Ignore
+)
+
+// Validator decides whether a message published to a topic is delivered and propagated. The peer
+// is nil for messages published by our own node. Validators must return once the context is done.
+type Validator func(ctx context.Context, peer *noise.Peer, msg Gossip) Result
+
+// Handler handles a message published to a topic our node subscribed to. The peer is nil for
+// messages published by our own node.
+type Handler func(node *noise.Node, peer *noise.Peer, msg Gossip) error
+
+type block struct {
+	opcodeGossip noise.Opcode
+	opcodeFetch  noise.Opcode
+	opcodeReplay noise.Opcode
+	opcodeStem   noise.Opcode
+
+	validateQueue   int
+	validateTimeout time.Duration
+
+	graylistThreshold float64
+
+	banThreshold float64
+	banDuration  time.Duration
+
+	scheme       signature.Scheme
+	verification Verification
+
+	batchSize  int
+	batchDelay time.Duration
+
+	fluffProbability float64
+	stemEpoch        time.Duration
+	embargo          time.Duration
+
+	sync.RWMutex
+	validators  map[string][]Validator
+	subscribers map[string][]Handler
+	topicScores map[string]TopicScore
+	archives    map[string]archiveParams
+	groups      []*Group
+	stems       map[string]struct{}
+}
+
+// New returns a block which propagates messages published to topics to all peers that complete
+// it. Peers need not subscribe to a topic for messages published to it to pass through them.
+//
+// Messages received are run through the validators registered for their topic before being
+// delivered to subscribers, or propagated to any other peer. By default, at most 256 messages are
+// validated at once, with any more messages dropped until validators catch up, and validators are
+// given 1 second to decide on a message before it is dropped.
+//
+// Peers are scored per topic by the messages they deliver, and messages from peers whose score
+// falls below -10 are dropped without being validated.
+func New() *block {
+	return &block{
+		validateQueue:   DefaultValidateQueue,
+		validateTimeout: DefaultValidateTimeout,
+
+		graylistThreshold: DefaultGraylistThreshold,
+		banThreshold:      math.Inf(-1),
+
+		fluffProbability: DefaultFluffProbability,
+		stemEpoch:        DefaultStemEpoch,
+		embargo:          DefaultEmbargo,
+
+		validators:  make(map[string][]Validator),
+		subscribers: make(map[string][]Handler),
+		topicScores: make(map[string]TopicScore),
+		archives:    make(map[string]archiveParams),
+		stems:       make(map[string]struct{}),
+	}
+}
+
+// WithValidateQueue sets the maximum number of messages validated at once. Messages received while
+// the maximum number of messages are being validated are dropped.
+func (b *block) WithValidateQueue(size int) *block {
+	if size <= 0 {
+		panic("pubsub: validate queue size must be positive")
+	}
+
+	b.validateQueue = size
+	return b
+}
+
+// WithValidateTimeout sets how long validators are given to decide on a message before the message
+// is dropped.
+func (b *block) WithValidateTimeout(timeout time.Duration) *block {
+	b.validateTimeout = timeout
+	return b
+}
+
+// WithValidator registers a validator for messages published to a topic. All validators of a topic
+// must accept a message for it to be delivered and propagated.
+func (b *block) WithValidator(topic string, validator Validator) *block {
+	b.Lock()
+	defer b.Unlock()
+
+	b.validators[topic] = append(b.validators[topic], validator)
+	return b
+}
+
+// Subscribe registers a handler for messages published to a topic.
+func (b *block) Subscribe(topic string, handler Handler) *block {
+	b.Lock()
+	defer b.Unlock()
+
+	b.subscribers[topic] = append(b.subscribers[topic], handler)
+	return b
+}
+
+// MaxSize returns a validator rejecting messages whose data is larger than a number of bytes.
+func MaxSize(size int) Validator {
+	return func(ctx context.Context, peer *noise.Peer, msg Gossip) Result {
+		if len(msg.Data) > size {
+			return Reject
+		}
+
+		return Accept
+	}
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	if len(b.groups) > 0 && b.scheme == nil {
+		panic("pubsub: groups require messages to be signed and verified via WithSigning")
+	}
+
+	verifier, _ := b.scheme.(signature.BatchVerifier)
+
+	var batch *batcher
+
+	if b.batchSize > 0 {
+		if verifier == nil {
+			panic("pubsub: batch verification requires a signature scheme set via WithSigning which implements signature.BatchVerifier")
+		}
+
+		batch = &batcher{verifier: verifier, clock: node.Clock(), size: b.batchSize, delay: b.batchDelay}
+	}
+
+	b.opcodeGossip = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Gossip)(nil))
+	b.opcodeFetch = noise.RegisterMessage(noise.NextAvailableOpcode(), (*FetchRequest)(nil))
+	b.opcodeReplay = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Replay)(nil))
+	b.opcodeStem = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Stem)(nil))
+
+	s := &state{
+		block:    b,
+		node:     node,
+		peers:    make(map[*noise.Peer]struct{}),
+		seen:     dedup.New(),
+		queue:    make(chan struct{}, b.validateQueue),
+		batch:    batch,
+		verifier: verifier,
+
+		// Sequence numbers start from the current time, such that they keep increasing across
+		// restarts of our node.
+		seqno: uint64(time.Now().UnixNano()),
+
+		archives: make(map[string]*archive),
+
+		dandelion: new(dandelion),
+	}
+
+	b.RLock()
+	for topic, params := range b.archives {
+		s.archives[topic] = newArchive(params, node.Clock())
+	}
+	b.RUnlock()
+
+	node.Set(keyState, s)
+	node.RegisterState(keyArchives, s.exportArchives, s.restoreArchives)
+
+	node.OnMessageReceived(b.opcodeGossip, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		if _, ok := peer.Get(keyState).(*state); !ok {
+			return nil
+		}
+
+		s.receive(peer, message.(Gossip), viaGossip)
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodeFetch, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		if _, ok := peer.Get(keyState).(*state); !ok {
+			return nil
+		}
+
+		if archive, exists := s.archives[message.(FetchRequest).Topic]; exists {
+			for _, msg := range archive.messages() {
+				peer.SendMessageAsync(Replay{Gossip: msg})
+			}
+		}
+
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodeReplay, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		if _, ok := peer.Get(keyState).(*state); !ok {
+			return nil
+		}
+
+		s.receive(peer, message.(Replay).Gossip, viaReplay)
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodeStem, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		if _, ok := peer.Get(keyState).(*state); !ok {
+			return nil
+		}
+
+		s.receive(peer, message.(Stem).Gossip, viaStem)
+		return nil
+	})
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	s := peer.Node().Get(keyState).(*state)
+	peer.Set(keyState, s)
+	peer.Set(keyScore, newScore(b, peer.Node().Clock()))
+
+	s.Lock()
+	s.peers[peer] = struct{}{}
+	s.Unlock()
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		s.Lock()
+		delete(s.peers, peer)
+		s.Unlock()
+
+		return nil
+	})
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Publish publishes data to a topic. The message is run through the validators of the topic, and
+// once accepted, is delivered to our subscribers of the topic, and propagated to all our peers.
+// It returns ErrRejected should a validator not accept the message.
+//
+// Messages published to topics propagated through a stem phase are only delivered to our own
+// subscribers once they are fluffed.
+func Publish(node *noise.Node, topic string, data []byte) error {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return errors.New("pubsub: block is not registered to the nodes protocol")
+	}
+
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return errors.Wrap(err, "pubsub: failed to generate nonce")
+	}
+
+	msg := Gossip{Topic: topic, Nonce: binary.BigEndian.Uint64(nonce[:]), Data: data}
+
+	if s.block.scheme != nil {
+		var err error
+
+		if msg, err = s.sign(msg); err != nil {
+			return err
+		}
+	}
+
+	s.block.RLock()
+	_, stem := s.block.stems[topic]
+	s.block.RUnlock()
+
+	// Messages in their stem phase are tracked apart from fluffed messages, such that they are
+	// still fluffed once they return to us.
+	var tracked noise.Message = msg
+	if stem {
+		tracked = Stem{Gossip: msg}
+	}
+
+	if _, err := s.seen.SeenMessage(tracked); err != nil {
+		return errors.Wrap(err, "pubsub: failed to mark message as seen")
+	}
+
+	if result := s.validate(nil, msg); result != Accept {
+		return errors.Wrapf(ErrRejected, "message published to topic %q was not accepted", topic)
+	}
+
+	if stem {
+		s.stem(nil, msg)
+		return nil
+	}
+
+	s.deliver(nil, msg)
+	s.propagate(nil, msg)
+
+	return nil
+}
+
+// via is how a message was received from a peer.
+type via int
+
+const (
+	viaGossip via = iota
+	viaReplay
+	viaStem
+)
+
+type state struct {
+	// seqno is the sequence number of the last message we signed. It is accessed atomically, and
+	// is kept first for it to be 64-bit aligned.
+	seqno uint64
+
+	sync.Mutex
+
+	block *block
+	node  *noise.Node
+
+	peers map[*noise.Peer]struct{}
+	seen  *dedup.Filter
+
+	// queue holds a slot for every message being validated.
+	queue chan struct{}
+
+	// batch verifies signatures of messages received in batches, should batch verification be
+	// enabled.
+	batch *batcher
+
+	// verifier verifies signatures of messages received one by one under the same rules as batches,
+	// should the signature scheme be able to verify signatures in batches.
+	verifier signature.BatchVerifier
+
+	// archives holds the most recent messages accepted on topics our node archives.
+	archives map[string]*archive
+
+	dandelion *dandelion
+}
+
+// receive validates a message received from a peer, and delivers and propagates it once accepted.
+// Replayed messages are delivered, yet are neither propagated nor credited to the score of the
+// peer. Messages in their stem phase are forwarded, or fluffed.
+func (s *state) receive(peer *noise.Peer, msg Gossip, via via) {
+	score := peer.Get(keyScore).(*score)
+
+	if score.value() < s.block.graylistThreshold {
+		log.Debug().Str("topic", msg.Topic).Msg("Dropped a message from a graylisted peer.")
+		return
+	}
+
+	// A slot is taken before the message is marked as seen, such that copies of a message dropped
+	// for want of a slot may still be validated once they arrive from other peers.
+	select {
+	case s.queue <- struct{}{}:
+	default:
+		log.Debug().Str("topic", msg.Topic).Msg("Dropped a message, as too many messages are being validated.")
+		return
+	}
+
+	var tracked noise.Message = msg
+	if via == viaStem {
+		tracked = Stem{Gossip: msg}
+	}
+
+	seen, err := s.seen.SeenMessage(tracked)
+	if err != nil || seen {
+		<-s.queue
+		return
+	}
+
+	s.node.Go(func(ctx context.Context) error {
+		defer func() { <-s.queue }()
+
+		result := s.validate(peer, msg)
+
+		switch {
+		case result == Accept && via == viaGossip:
+			// Messages are deduplicated before being validated, so the peer is the first to have
+			// delivered the message to us.
+			score.delivered(msg.Topic)
+		case result == Reject:
+			score.rejected(msg.Topic)
+			s.penalize(peer, score)
+		}
+
+		if result != Accept {
+			log.Debug().Str("topic", msg.Topic).Int("result", int(result)).Msg("Dropped a message which was not accepted by a validator.")
+			return nil
+		}
+
+		switch via {
+		case viaStem:
+			s.stem(peer, msg)
+		case viaReplay:
+			s.deliver(peer, msg)
+		default:
+			s.deliver(peer, msg)
+			s.propagate(peer, msg)
+		}
+
+		return nil
+	})
+}
+
+// validate verifies the envelope of a message received should our node verify signatures, runs
+// all validators of the topic of the message, and returns the first verdict which does not accept
+// the message. Messages which validators fail to decide on in time are ignored.
+func (s *state) validate(peer *noise.Peer, msg Gossip) Result {
+	if peer != nil && s.block.scheme != nil {
+		if result := s.verify(msg); result != Accept {
+			return result
+		}
+	}
+
+	s.block.RLock()
+	validators := s.block.validators[msg.Topic]
+	s.block.RUnlock()
+
+	if len(validators) == 0 {
+		return Accept
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.block.validateTimeout)
+	defer cancel()
+
+	verdict := make(chan Result, 1)
+
+	s.node.Go(func(context.Context) error {
+		for _, validator := range validators {
+			if result := validator(ctx, peer, msg); result != Accept {
+				verdict <- result
+				return nil
+			}
+		}
+
+		verdict <- Accept
+		return nil
+	})
+
+	select {
+	case result := <-verdict:
+		return result
+	case <-ctx.Done():
+		return Ignore
+	}
+}
+
+func (s *state) deliver(peer *noise.Peer, msg Gossip) {
+	if archive, exists := s.archives[msg.Topic]; exists {
+		archive.add(msg)
+	}
+
+	s.block.RLock()
+	handlers := s.block.subscribers[msg.Topic]
+	s.block.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(s.node, peer, msg); err != nil {
+			log.Warn().Err(err).Str("topic", msg.Topic).Msg("Got an error handling a published message.")
+		}
+	}
+}
+
+// penalize disconnects a peer, and bans its IP from our node, should its score fall below the ban
+// threshold.
+func (s *state) penalize(peer *noise.Peer, score *score) {
+	if score.value() >= s.block.banThreshold {
+		return
+	}
+
+	log.Warn().Str("address", peer.RemoteIP().String()).Msg("Banned a peer whose score fell below the ban threshold.")
+
+	s.node.Ban(peer.RemoteIP(), s.block.banDuration)
+	peer.DisconnectWithReason(noise.ReasonBanned)
+}
+
+// propagate sends a message to all peers other than the one we received it from, skipping peers
+// which are graylisted.
+func (s *state) propagate(from *noise.Peer, msg Gossip) {
+	for _, peer := range s.snapshot() {
+		if peer == from || Score(peer) < s.block.graylistThreshold {
+			continue
+		}
+
+		peer.SendMessageAsync(msg)
+	}
+}
+
+func (s *state) snapshot() []*noise.Peer {
+	s.Lock()
+	defer s.Unlock()
+
+	peers := make([]*noise.Peer, 0, len(s.peers))
+
+	for peer := range s.peers {
+		peers = append(peers, peer)
+	}
+
+	return peers
+}
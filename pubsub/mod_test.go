@@ -0,0 +1,800 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/identity/ed25519"
+	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/signature"
+	"github.com/perlin-network/noise/signature/eddsa"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newNode(t *testing.T, layer transport.Layer, block *block) *noise.Node {
+	params := noise.DefaultParams()
+	params.Transport = layer
+	params.Keys = ed25519.RandomKeys()
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	protocol.New().Register(block).Enforce(node)
+
+	go node.Listen()
+
+	return node
+}
+
+func connect(t *testing.T, from, to *noise.Node) {
+	peer, err := from.Dial(to.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+}
+
+func TestValidators(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	received := make(chan string, 16)
+
+	alice := newNode(t, layer, New().WithValidator("chat", MaxSize(16)))
+	bob := newNode(t, layer, New().
+		WithValidateTimeout(50*time.Millisecond).
+		WithValidator("chat", func(ctx context.Context, peer *noise.Peer, msg Gossip) Result {
+			if string(msg.Data) == "bad" {
+				return Reject
+			}
+
+			return Accept
+		}).
+		WithValidator("slow", func(ctx context.Context, peer *noise.Peer, msg Gossip) Result {
+			<-ctx.Done()
+			return Accept
+		}))
+	carol := newNode(t, layer, New().
+		Subscribe("chat", func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+			received <- string(msg.Data)
+			return nil
+		}).
+		Subscribe("slow", func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+			received <- string(msg.Data)
+			return nil
+		}))
+
+	defer alice.Kill()
+	defer bob.Kill()
+	defer carol.Kill()
+
+	// Alice is only connected to carol through bob.
+	connect(t, alice, bob)
+	connect(t, bob, carol)
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Messages which our own validators do not accept are never published.
+	assert.True(t, errors.Is(Publish(alice, "chat", make([]byte, 17)), ErrRejected))
+
+	// Bob drops messages his validators reject, or fail to decide on in time.
+	assert.NoError(t, Publish(alice, "chat", []byte("bad")))
+	assert.NoError(t, Publish(alice, "slow", []byte("slow")))
+	assert.NoError(t, Publish(alice, "chat", []byte("good")))
+
+	select {
+	case data := <-received:
+		assert.Equal(t, "good", data)
+	case <-time.After(3 * time.Second):
+		t.Fatal("carol did not receive the message published by alice")
+	}
+
+	select {
+	case data := <-received:
+		t.Fatalf("carol received %q, which bob should have dropped", data)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	received := make(chan string, 16)
+
+	alice, bob := newNode(t, layer, New()), newNode(t, layer, New())
+	carol := newNode(t, layer, New().Subscribe("chat", func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+		received <- string(msg.Data)
+		return nil
+	}))
+
+	defer alice.Kill()
+	defer bob.Kill()
+	defer carol.Kill()
+
+	// Carol receives the message from both alice and bob, yet delivers it once.
+	connect(t, alice, bob)
+	connect(t, bob, carol)
+	connect(t, alice, carol)
+
+	time.Sleep(50 * time.Millisecond)
+
+	assert.NoError(t, Publish(alice, "chat", []byte("hello")))
+
+	select {
+	case data := <-received:
+		assert.Equal(t, "hello", data)
+	case <-time.After(3 * time.Second):
+		t.Fatal("carol did not receive the message published by alice")
+	}
+
+	select {
+	case <-received:
+		t.Fatal("carol delivered the same message twice")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestScoring(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	received := make(chan string, 16)
+	peers := make(chan *noise.Peer, 16)
+
+	alice := newNode(t, layer, New())
+	bob := newNode(t, layer, New().
+		WithValidator("chat", func(ctx context.Context, peer *noise.Peer, msg Gossip) Result {
+			peers <- peer
+
+			if string(msg.Data) == "bad" {
+				return Reject
+			}
+
+			return Accept
+		}).
+		Subscribe("chat", func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+			received <- string(msg.Data)
+			return nil
+		}))
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	connect(t, alice, bob)
+
+	time.Sleep(50 * time.Millisecond)
+
+	assert.NoError(t, Publish(alice, "chat", []byte("good")))
+
+	select {
+	case data := <-received:
+		assert.Equal(t, "good", data)
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not receive the message published by alice")
+	}
+
+	peer := <-peers
+	assert.True(t, Score(peer) > 0)
+
+	// Alice is graylisted by bob once enough of her messages are rejected.
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, Publish(alice, "chat", []byte("bad")))
+		<-peers
+	}
+
+	// Bob scores alice once his validators return.
+	time.Sleep(50 * time.Millisecond)
+
+	assert.True(t, Score(peer) < DefaultGraylistThreshold)
+
+	assert.NoError(t, Publish(alice, "chat", []byte("good")))
+
+	select {
+	case data := <-received:
+		t.Fatalf("bob received %q from alice, who should have been graylisted", data)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestBanThreshold(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	alice := newNode(t, layer, New())
+	bob := newNode(t, layer, New().
+		WithBanThreshold(-5, time.Minute).
+		WithValidator("chat", func(ctx context.Context, peer *noise.Peer, msg Gossip) Result {
+			return Reject
+		}))
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	time.Sleep(50 * time.Millisecond)
+
+	disconnected := make(chan struct{})
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	// Bob disconnects and bans alice once her score falls below his ban threshold.
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, Publish(alice, "chat", []byte("bad")))
+	}
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not disconnect alice after her score fell below the ban threshold")
+	}
+
+	assert.True(t, bob.IsBanned(peer.LocalIP()))
+}
+
+func TestSigning(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	received := make(chan Gossip, 16)
+
+	subscriber := func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+		received <- msg
+		return nil
+	}
+
+	alice := newNode(t, layer, New().WithSigning(eddsa.New(), Strict))
+	bob := newNode(t, layer, New().WithSigning(eddsa.New(), Permissive).Subscribe("bob", subscriber))
+	carol := newNode(t, layer, New().WithSigning(eddsa.New(), Strict).Subscribe("carol", subscriber))
+	dave := newNode(t, layer, New())
+
+	defer alice.Kill()
+	defer bob.Kill()
+	defer carol.Kill()
+	defer dave.Kill()
+
+	// Alice and dave are only connected to carol through bob.
+	connect(t, alice, bob)
+	connect(t, bob, carol)
+
+	peer, err := dave.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Carol verifies that messages relayed by bob were published by alice.
+	assert.NoError(t, Publish(alice, "carol", []byte("signed")))
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "signed", string(msg.Data))
+		assert.Equal(t, alice.Keys.PublicKey(), msg.From)
+	case <-time.After(3 * time.Second):
+		t.Fatal("carol did not receive the message signed by alice")
+	}
+
+	// Bob accepts messages which are not signed, yet carol rejects them.
+	assert.NoError(t, Publish(dave, "bob", []byte("unsigned")))
+	assert.NoError(t, Publish(dave, "carol", []byte("unsigned")))
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "bob", msg.Topic)
+		assert.False(t, msg.Signed())
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not receive the message which is not signed")
+	}
+
+	// Both reject messages whose signatures fail to be verified.
+	forged := Gossip{Topic: "bob", Nonce: 1, Data: []byte("forged"), From: alice.Keys.PublicKey(), Seqno: 1, Signature: make([]byte, 64)}
+	assert.NoError(t, peer.SendMessage(forged))
+
+	forged.Topic = "carol"
+	assert.NoError(t, peer.SendMessage(forged))
+
+	select {
+	case msg := <-received:
+		t.Fatalf("received %q on topic %q, which should have been rejected", msg.Data, msg.Topic)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestBatchVerification(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	received := make(chan Gossip, 64)
+
+	alice := newNode(t, layer, New().WithSigning(eddsa.New(), Strict))
+	bob := newNode(t, layer, New().WithSigning(eddsa.New(), Strict).WithBatchVerification(4, 20*time.Millisecond).Subscribe("bob", func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+		received <- msg
+		return nil
+	}))
+	dave := newNode(t, layer, New())
+
+	defer alice.Kill()
+	defer bob.Kill()
+	defer dave.Kill()
+
+	connect(t, alice, bob)
+
+	peer, err := dave.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Forged messages are singled out of the batches they are verified in, and batches which do not
+	// fill up are verified once the delay elapses.
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, Publish(alice, "bob", []byte{byte(i)}))
+
+		if i%3 == 0 {
+			forged := Gossip{Topic: "bob", Nonce: uint64(i), Data: []byte("forged"), From: alice.Keys.PublicKey(), Seqno: uint64(i), Signature: make([]byte, 64)}
+			assert.NoError(t, peer.SendMessage(forged))
+		}
+	}
+
+	seen := make(map[byte]struct{})
+
+	for len(seen) < 10 {
+		select {
+		case msg := <-received:
+			assert.Len(t, msg.Data, 1)
+			seen[msg.Data[0]] = struct{}{}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("bob only received %d of the messages signed by alice", len(seen))
+		}
+	}
+
+	select {
+	case msg := <-received:
+		t.Fatalf("received %q, which should have been rejected", msg.Data)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Schemes which cannot verify signatures in batches are refused.
+	assert.Panics(t, func() {
+		newNode(t, layer, New().WithSigning(nonBatchScheme{eddsa.New()}, Strict).WithBatchVerification(4, time.Millisecond))
+	})
+}
+
+type nonBatchScheme struct {
+	signature.Scheme
+}
+
+func TestTorsionSignatures(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	batched, unbatched := make(chan Gossip, 4), make(chan Gossip, 4)
+
+	bob := newNode(t, layer, New().WithSigning(eddsa.New(), Strict).WithBatchVerification(4, 20*time.Millisecond).Subscribe("torsion", func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+		batched <- msg
+		return nil
+	}))
+	carol := newNode(t, layer, New().WithSigning(eddsa.New(), Strict).Subscribe("torsion", func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+		unbatched <- msg
+		return nil
+	}))
+	dave := newNode(t, layer, New())
+
+	defer bob.Kill()
+	defer carol.Kill()
+	defer dave.Kill()
+
+	var peers []*noise.Peer
+
+	for _, node := range []*noise.Node{bob, carol} {
+		peer, err := dave.Dial(node.ExternalAddress())
+		assert.NoError(t, err)
+		assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+		peers = append(peers, peer)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	publicKey, privateKey, err := edwards25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	msg := Gossip{Topic: "torsion", Nonce: 1, Data: []byte("torsion"), From: publicKey, Seqno: 1}
+	msg.Signature = signWithTorsion(t, privateKey, msg.signingPayload())
+
+	assert.Error(t, eddsa.Verify(publicKey, msg.signingPayload(), msg.Signature))
+
+	// Signatures offset by a point of small order are accepted alike whether they are verified in
+	// batches or one by one, such that no peer penalizes another for relaying them.
+	for _, peer := range peers {
+		assert.NoError(t, peer.SendMessage(msg))
+	}
+
+	for _, received := range []chan Gossip{batched, unbatched} {
+		select {
+		case got := <-received:
+			assert.Equal(t, msg.Data, got.Data)
+		case <-time.After(3 * time.Second):
+			t.Fatal("a message signed with an offset of small order was rejected")
+		}
+	}
+}
+
+// signWithTorsion signs message under a nonce whose point R is offset by the point (0, -1) of order
+// 2, as only the cofactored verification equation accepts.
+func signWithTorsion(t *testing.T, private edwards25519.PrivateKey, message []byte) []byte {
+	digest := sha512.Sum512(private[:32])
+	digest[0] &= 248
+	digest[31] &= 63
+	digest[31] |= 64
+
+	var a, r [32]byte
+	copy(a[:], digest[:32])
+
+	var nonce [64]byte
+	_, err := rand.Read(nonce[:])
+	assert.NoError(t, err)
+	edwards25519.ScReduce(&r, &nonce)
+
+	// Adding (0, -1) to a point (x, y) yields (-x, -y).
+	var R edwards25519.ExtendedGroupElement
+	edwards25519.GeScalarMultBase(&R, &r)
+	edwards25519.FeNeg(&R.X, &R.X)
+	edwards25519.FeNeg(&R.Y, &R.Y)
+
+	var encodedR [32]byte
+	R.ToBytes(&encodedR)
+
+	h := sha512.New()
+	h.Write(encodedR[:])
+	h.Write(private[32:])
+	h.Write(message)
+	var hram [64]byte
+	h.Sum(hram[:0])
+
+	var k, s [32]byte
+	edwards25519.ScReduce(&k, &hram)
+	edwards25519.ScMulAdd(&s, &k, &a, &r)
+
+	return append(encodedR[:], s[:]...)
+}
+
+func TestArchive(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	received := make(chan string, 16)
+
+	subscriber := func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+		received <- string(msg.Data)
+		return nil
+	}
+
+	alice := newNode(t, layer, New())
+	bob := newNode(t, layer, New().WithArchive("chat", 2, 0).WithArchive("stale", 2, 50*time.Millisecond))
+	carol := newNode(t, layer, New().Subscribe("chat", subscriber).Subscribe("stale", subscriber))
+
+	defer alice.Kill()
+	defer bob.Kill()
+	defer carol.Kill()
+
+	connect(t, alice, bob)
+
+	time.Sleep(50 * time.Millisecond)
+
+	for _, data := range []string{"one", "two", "three"} {
+		assert.NoError(t, Publish(alice, "chat", []byte(data)))
+	}
+
+	assert.NoError(t, Publish(alice, "stale", []byte("stale")))
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Carol joins late, and fetches the most recent messages bob archived.
+	connect(t, carol, bob)
+
+	time.Sleep(50 * time.Millisecond)
+
+	assert.NoError(t, Fetch(carol, "chat"))
+	assert.NoError(t, Fetch(carol, "stale"))
+
+	// Replayed messages are validated concurrently, and may thus be delivered in any order.
+	var replayed []string
+
+	for i := 0; i < 2; i++ {
+		select {
+		case data := <-received:
+			replayed = append(replayed, data)
+		case <-time.After(3 * time.Second):
+			t.Fatal("carol did not receive the messages archived by bob")
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"two", "three"}, replayed)
+
+	select {
+	case data := <-received:
+		t.Fatalf("carol received %q, which bob should not have replayed", data)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestArchiveState(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	alice := newNode(t, layer, New())
+	bob := newNode(t, layer, New().WithArchive("chat", 2, 0))
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	connect(t, alice, bob)
+
+	time.Sleep(50 * time.Millisecond)
+
+	archive := bob.Get(keyState).(*state).archives["chat"]
+
+	// Each message is archived by bob before the next is published, such that they are archived in
+	// the order they were published.
+	for _, data := range []string{"one", "two", "three"} {
+		assert.NoError(t, Publish(alice, "chat", []byte(data)))
+
+		deadline := time.Now().Add(3 * time.Second)
+
+		for {
+			msgs := archive.messages()
+
+			if len(msgs) > 0 && string(msgs[len(msgs)-1].Data) == data {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("bob did not archive %q", data)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	snapshot, err := bob.ExportState()
+	assert.NoError(t, err)
+
+	// A node restored from bobs snapshot archives the messages bob archived.
+	params := noise.DefaultParams()
+	params.Transport = layer
+	params.Keys = bob.Keys
+
+	restored, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	protocol.New().Register(New().WithArchive("chat", 2, 0)).Enforce(restored)
+
+	go restored.Listen()
+	defer restored.Kill()
+
+	assert.NoError(t, restored.ImportState(snapshot))
+
+	var archived []string
+
+	for _, msg := range restored.Get(keyState).(*state).archives["chat"].messages() {
+		archived = append(archived, string(msg.Data))
+	}
+
+	assert.Equal(t, []string{"two", "three"}, archived)
+}
+
+func TestGroup(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	relayed := make(chan []byte, 16)
+	received := make(chan string, 16)
+
+	member := func(name string) Handler {
+		return func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+			received <- name + ": " + string(msg.Data)
+			return nil
+		}
+	}
+
+	keys := ed25519.RandomKeys()
+
+	params := noise.DefaultParams()
+	params.Transport = layer
+	params.Keys = keys
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	// Every node holds its own view of the group, and alice administers it.
+	group := NewGroup("group", keys.PublicKey())
+	protocol.New().Register(New().WithSigning(eddsa.New(), Strict).WithGroup(group, member("alice"))).Enforce(alice)
+
+	go alice.Listen()
+
+	bob := newNode(t, layer, New().WithSigning(eddsa.New(), Strict).Subscribe("group", func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+		relayed <- msg.Data
+		return nil
+	}))
+
+	carolGroup, daveGroup := NewGroup("group", keys.PublicKey()), NewGroup("group", keys.PublicKey())
+
+	carol := newNode(t, layer, New().WithSigning(eddsa.New(), Strict).WithGroup(carolGroup, member("carol")))
+	dave := newNode(t, layer, New().WithSigning(eddsa.New(), Strict).WithGroup(daveGroup, member("dave")))
+
+	defer alice.Kill()
+	defer bob.Kill()
+	defer carol.Kill()
+	defer dave.Kill()
+
+	// Carol and dave are only connected to alice through bob, who is not a member of the group.
+	connect(t, alice, bob)
+	connect(t, bob, carol)
+	connect(t, bob, dave)
+
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, ErrNotAdmin, carolGroup.Add(carol, dave.Keys.PublicKey()))
+
+	assert.NoError(t, group.Add(alice, carol.Keys.PublicKey()))
+	assert.NoError(t, group.Add(alice, dave.Keys.PublicKey()))
+
+	time.Sleep(100 * time.Millisecond)
+
+	for len(relayed) > 0 {
+		<-relayed
+	}
+
+	assert.NoError(t, group.Publish(alice, []byte("hello")))
+
+	var got []string
+
+	for i := 0; i < 3; i++ {
+		select {
+		case data := <-received:
+			got = append(got, data)
+		case <-time.After(3 * time.Second):
+			t.Fatal("members of the group did not receive the message published by alice")
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"alice: hello", "carol: hello", "dave: hello"}, got)
+
+	// Bob relays messages published to the group, yet may not read them.
+	select {
+	case data := <-relayed:
+		assert.False(t, bytes.Contains(data, []byte("hello")))
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not relay the message published by alice")
+	}
+
+	// Dave may no longer read messages published to the group once alice removes him.
+	assert.NoError(t, group.Remove(alice, dave.Keys.PublicKey()))
+
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, ErrNoGroupKey, daveGroup.Publish(dave, []byte("hello")))
+	assert.NoError(t, carolGroup.Publish(carol, []byte("secret")))
+
+	got = nil
+
+	for i := 0; i < 2; i++ {
+		select {
+		case data := <-received:
+			got = append(got, data)
+		case <-time.After(3 * time.Second):
+			t.Fatal("members of the group did not receive the message published by carol")
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"alice: secret", "carol: secret"}, got)
+
+	select {
+	case data := <-received:
+		t.Fatalf("received %q, which dave should not have been able to read", data)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestStem(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	received := make(chan string, 16)
+
+	subscriber := func(name string) Handler {
+		return func(node *noise.Node, peer *noise.Peer, msg Gossip) error {
+			received <- name + ": " + string(msg.Data)
+			return nil
+		}
+	}
+
+	alice := newNode(t, layer, New().WithStem("tx").Subscribe("tx", subscriber("alice")))
+	bob := newNode(t, layer, New().WithFluffProbability(0).WithEmbargo(100*time.Millisecond).Subscribe("tx", subscriber("bob")))
+	carol := newNode(t, layer, New().
+		WithFluffProbability(1).
+		WithValidator("tx", func(ctx context.Context, peer *noise.Peer, msg Gossip) Result {
+			if string(msg.Data) == "dropped" {
+				return Ignore
+			}
+
+			return Accept
+		}).
+		Subscribe("tx", subscriber("carol")))
+	dave := newNode(t, layer, New().Subscribe("tx", subscriber("dave")))
+
+	defer alice.Kill()
+	defer bob.Kill()
+	defer carol.Kill()
+	defer dave.Kill()
+
+	connect(t, alice, bob)
+	connect(t, bob, carol)
+	connect(t, carol, dave)
+
+	time.Sleep(50 * time.Millisecond)
+
+	collect := func(n int) []string {
+		var got []string
+
+		for i := 0; i < n; i++ {
+			select {
+			case data := <-received:
+				got = append(got, data)
+			case <-time.After(3 * time.Second):
+				t.Fatalf("only received %v", got)
+			}
+		}
+
+		return got
+	}
+
+	// Bob forwards alice's message to carol in its stem phase, who fluffs it to everyone.
+	assert.NoError(t, Publish(alice, "tx", []byte("hello")))
+	assert.ElementsMatch(t, []string{"alice: hello", "bob: hello", "carol: hello", "dave: hello"}, collect(4))
+
+	// Bob fluffs messages himself should he not see them fluffed before his embargo ends.
+	assert.NoError(t, Publish(alice, "tx", []byte("dropped")))
+	assert.ElementsMatch(t, []string{"alice: dropped", "bob: dropped"}, collect(2))
+
+	select {
+	case data := <-received:
+		t.Fatalf("received %q, which carol should have dropped", data)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,141 @@
+package pubsub
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ noise.Message = (*Gossip)(nil)
+	_ noise.Message = (*FetchRequest)(nil)
+	_ noise.Message = (*Replay)(nil)
+	_ noise.Message = (*Stem)(nil)
+)
+
+// Gossip carries a message published to a topic. Nonce is chosen at random by the publisher, such
+// that the same data published twice is propagated as two distinct messages.
+//
+// Messages published by nodes which sign their messages are enveloped with the public key of the
+// publisher, a sequence number which increases with every message the publisher publishes, and a
+// signature over the rest of the message.
+type Gossip struct {
+	Topic string
+	Nonce uint64
+	Data  []byte
+
+	From      []byte
+	Seqno     uint64
+	Signature []byte
+}
+
+func (Gossip) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Gossip
+	var err error
+
+	if msg.Topic, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read topic")
+	}
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read nonce")
+	}
+
+	if msg.Data, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read data")
+	}
+
+	if msg.From, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read publisher")
+	}
+
+	if msg.Seqno, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read sequence number")
+	}
+
+	if msg.Signature, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read signature")
+	}
+
+	return msg, nil
+}
+
+func (m Gossip) Write() []byte {
+	return payload.NewWriter(nil).
+		WriteString(m.Topic).
+		WriteUint64(m.Nonce).
+		WriteBytes(m.Data).
+		WriteBytes(m.From).
+		WriteUint64(m.Seqno).
+		WriteBytes(m.Signature).
+		Bytes()
+}
+
+// Signed reports whether the message carries an envelope.
+func (m Gossip) Signed() bool {
+	return len(m.From) > 0 || len(m.Signature) > 0
+}
+
+// signingPayload returns the contents of the message which its signature is over.
+func (m Gossip) signingPayload() []byte {
+	m.Signature = nil
+	return append([]byte(signingContext), m.Write()...)
+}
+
+// FetchRequest requests a peer to replay the messages it archived for a topic.
+type FetchRequest struct {
+	Topic string
+}
+
+func (FetchRequest) Read(reader payload.Reader) (noise.Message, error) {
+	var msg FetchRequest
+	var err error
+
+	if msg.Topic, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read topic")
+	}
+
+	return msg, nil
+}
+
+func (m FetchRequest) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.Topic).Bytes()
+}
+
+// Replay carries a message archived by a peer in response to a FetchRequest. Replayed messages are
+// delivered to subscribers, yet are not propagated.
+type Replay struct {
+	Gossip
+}
+
+func (Replay) Read(reader payload.Reader) (noise.Message, error) {
+	msg, err := Gossip{}.Read(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return Replay{Gossip: msg.(Gossip)}, nil
+}
+
+func (m Replay) Write() []byte {
+	return m.Gossip.Write()
+}
+
+// Stem carries a message in the stem phase of its propagation, which is forwarded along a single
+// path of peers before being propagated to all peers.
+type Stem struct {
+	Gossip
+}
+
+func (Stem) Read(reader payload.Reader) (noise.Message, error) {
+	msg, err := Gossip{}.Read(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return Stem{Gossip: msg.(Gossip)}, nil
+}
+
+func (m Stem) Write() []byte {
+	return m.Gossip.Write()
+}
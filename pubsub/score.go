@@ -0,0 +1,151 @@
+package pubsub
+
+import (
+	"github.com/perlin-network/noise/clock"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/perlin-network/noise"
+)
+
+const (
+	keyScore = "pubsub.score"
+
+	DefaultGraylistThreshold = -10
+)
+
+// DefaultTopicScore scores peers on topics which are not scored through WithTopicScore.
+var DefaultTopicScore = TopicScore{
+	FirstDeliveryWeight: 1,
+	FirstDeliveryCap:    100,
+	InvalidWeight:       1,
+	Decay:               0.99,
+}
+
+// TopicScore weighs the behaviour of peers on a topic into their score, akin to GossipSub v1.1.
+//
+// A peer is rewarded for every message it is the first to deliver to us, up to a cap, and is
+// penalized by the square of the number of messages it sent which validators rejected. Both
+// counters decay every second by a factor, such that peers recover from past behaviour over time.
+type TopicScore struct {
+	FirstDeliveryWeight float64
+	FirstDeliveryCap    float64
+
+	InvalidWeight float64
+
+	Decay float64
+}
+
+// WithTopicScore sets how the behaviour of peers on a topic weighs into their score.
+func (b *block) WithTopicScore(topic string, params TopicScore) *block {
+	b.Lock()
+	defer b.Unlock()
+
+	b.topicScores[topic] = params
+	return b
+}
+
+// WithGraylistThreshold sets the score below which messages from a peer are dropped without being
+// validated, and below which messages are no longer propagated to the peer.
+func (b *block) WithGraylistThreshold(threshold float64) *block {
+	b.graylistThreshold = threshold
+	return b
+}
+
+// WithBanThreshold sets the score below which a peer is disconnected, and its IP is banned by our
+// node for a duration. A zero duration bans the IP indefinitely. By default, peers are never banned.
+func (b *block) WithBanThreshold(threshold float64, duration time.Duration) *block {
+	b.banThreshold, b.banDuration = threshold, duration
+	return b
+}
+
+// Score returns the score of a peer across all topics. It returns zero should the peer not have
+// completed the block.
+func Score(peer *noise.Peer) float64 {
+	if s, ok := peer.Get(keyScore).(*score); ok {
+		return s.value()
+	}
+
+	return 0
+}
+
+// score holds the counters of a peer on every topic it sent us messages on.
+type score struct {
+	sync.Mutex
+
+	block  *block
+	clock  clock.Clock
+	topics map[string]*counters
+}
+
+type counters struct {
+	firstDeliveries float64
+	invalid         float64
+
+	updated time.Time
+}
+
+func newScore(b *block, clock clock.Clock) *score {
+	return &score{block: b, clock: clock, topics: make(map[string]*counters)}
+}
+
+func (s *score) params(topic string) TopicScore {
+	s.block.RLock()
+	defer s.block.RUnlock()
+
+	if params, exists := s.block.topicScores[topic]; exists {
+		return params
+	}
+
+	return DefaultTopicScore
+}
+
+// decayed returns the counters of a topic, decayed up until now. It must be called with the lock
+// held.
+func (s *score) decayed(topic string, now time.Time) *counters {
+	c, exists := s.topics[topic]
+	if !exists {
+		c = &counters{updated: now}
+		s.topics[topic] = c
+	}
+
+	factor := math.Pow(s.params(topic).Decay, now.Sub(c.updated).Seconds())
+
+	c.firstDeliveries *= factor
+	c.invalid *= factor
+	c.updated = now
+
+	return c
+}
+
+func (s *score) delivered(topic string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.decayed(topic, s.clock.Now()).firstDeliveries++
+}
+
+func (s *score) rejected(topic string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.decayed(topic, s.clock.Now()).invalid++
+}
+
+func (s *score) value() float64 {
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.clock.Now()
+	total := 0.0
+
+	for topic := range s.topics {
+		c, params := s.decayed(topic, now), s.params(topic)
+
+		total += math.Min(c.firstDeliveries, params.FirstDeliveryCap) * params.FirstDeliveryWeight
+		total -= c.invalid * c.invalid * params.InvalidWeight
+	}
+
+	return total
+}
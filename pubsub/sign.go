@@ -0,0 +1,87 @@
+package pubsub
+
+import (
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/signature"
+	"github.com/pkg/errors"
+	"sync/atomic"
+)
+
+// signingContext separates signatures over published messages from signatures produced by our
+// nodes keys for any other purpose.
+const signingContext = "noise pubsub:"
+
+// Verification decides which messages are accepted based on their envelopes.
+type Verification int
+
+const (
+	// Strict rejects messages which are not signed, or whose signatures fail to be verified.
+	Strict Verification = iota
+
+	// Permissive accepts messages which are not signed, yet rejects messages whose signatures fail
+	// to be verified.
+	Permissive
+)
+
+// WithSigning has messages our node publishes signed by the keys of our node under a signature
+// scheme, and has messages received verified under the same scheme. By default, messages are
+// neither signed nor verified.
+//
+// Schemes which implement `signature.BatchVerifier` have every signature verified under the rules
+// of their batches, whether or not batch verification is enabled.
+func (b *block) WithSigning(scheme signature.Scheme, verification Verification) *block {
+	b.scheme, b.verification = scheme, verification
+	return b
+}
+
+// sign envelopes a message with the public key of our node, our next sequence number, and a
+// signature over the message.
+func (s *state) sign(msg Gossip) (Gossip, error) {
+	keys := s.node.Keys
+	if keys == nil {
+		return msg, errors.New("pubsub: node has no keys to sign messages with")
+	}
+
+	msg.From = keys.PublicKey()
+	msg.Seqno = atomic.AddUint64(&s.seqno, 1)
+
+	signature, err := s.block.scheme.Sign(keys.PrivateKey(), msg.signingPayload())
+	if err != nil {
+		return msg, errors.Wrap(err, "pubsub: failed to sign message")
+	}
+
+	msg.Signature = signature
+
+	return msg, nil
+}
+
+// verify rejects messages whose envelopes fail to be verified, or which are not signed should
+// verification be strict.
+func (s *state) verify(msg Gossip) Result {
+	if !msg.Signed() {
+		if s.block.verification == Strict {
+			log.Debug().Str("topic", msg.Topic).Msg("Rejected a message which is not signed.")
+			return Reject
+		}
+
+		return Accept
+	}
+
+	var err error
+
+	switch {
+	case s.batch != nil:
+		err = s.batch.verify(msg)
+	case s.verifier != nil:
+		err = s.verifier.VerifyOne(msg.From, msg.signingPayload(), msg.Signature)
+	default:
+		err = s.block.scheme.Verify(msg.From, msg.signingPayload(), msg.Signature)
+	}
+
+	if err != nil {
+		log.Debug().Err(err).Str("topic", msg.Topic).Msg("Rejected a message whose signature failed to be verified.")
+		return Reject
+	}
+
+	return Accept
+}
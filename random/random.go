@@ -0,0 +1,120 @@
+// Package random abstracts over the source of randomness behind decisions which need not be
+// unpredictable, such as which peers to sample or relay through, such that simulations and tests may
+// be reproduced from a single seed.
+//
+// Keys, nonces, challenges and any other randomness security depends on are always drawn from
+// crypto/rand, and never from a Source.
+package random
+
+import (
+	"math/rand"
+	"sync"
+)
+
+var (
+	_ Source = (*system)(nil)
+	_ Source = (*Seeded)(nil)
+)
+
+// Source draws random numbers. Sources must be safe to use from multiple goroutines.
+type Source interface {
+	// Intn returns a number in [0, n). It panics should n not be positive.
+	Intn(n int) int
+
+	// Int63n returns a number in [0, n). It panics should n not be positive.
+	Int63n(n int64) int64
+
+	// Float64 returns a number in [0, 1).
+	Float64() float64
+
+	Uint64() uint64
+
+	// Shuffle shuffles n elements, swapping elements through swap.
+	Shuffle(n int, swap func(i, j int))
+}
+
+// New returns a source drawing from the randomly seeded global source of math/rand.
+func New() Source {
+	return system{}
+}
+
+type system struct{}
+
+func (system) Intn(n int) int {
+	return rand.Intn(n)
+}
+
+func (system) Int63n(n int64) int64 {
+	return rand.Int63n(n)
+}
+
+func (system) Float64() float64 {
+	return rand.Float64()
+}
+
+func (system) Uint64() uint64 {
+	return rand.Uint64()
+}
+
+func (system) Shuffle(n int, swap func(i, j int)) {
+	rand.Shuffle(n, swap)
+}
+
+// Seeded is a source which draws the same sequence of numbers given the same seed.
+//
+// Numbers drawn by different goroutines interleave in whichever order the goroutines happen to run
+// in, so runs are only reproduced in full should decisions be drawn in the same order, such as
+// under a fake clock.
+type Seeded struct {
+	sync.Mutex
+	rng *rand.Rand
+}
+
+// NewSeeded returns a source seeded with a given seed.
+func NewSeeded(seed int64) *Seeded {
+	return &Seeded{rng: rand.New(rand.NewSource(seed))}
+}
+
+// Fork returns a source seeded off of the next number drawn from s, such that every node of a
+// simulation may be given a source of its own, all derived from a single seed.
+func (s *Seeded) Fork() *Seeded {
+	s.Lock()
+	defer s.Unlock()
+
+	return NewSeeded(s.rng.Int63())
+}
+
+func (s *Seeded) Intn(n int) int {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.rng.Intn(n)
+}
+
+func (s *Seeded) Int63n(n int64) int64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.rng.Int63n(n)
+}
+
+func (s *Seeded) Float64() float64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.rng.Float64()
+}
+
+func (s *Seeded) Uint64() uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.rng.Uint64()
+}
+
+func (s *Seeded) Shuffle(n int, swap func(i, j int)) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.rng.Shuffle(n, swap)
+}
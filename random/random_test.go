@@ -0,0 +1,29 @@
+package random
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func draw(s Source) []uint64 {
+	out := []uint64{s.Uint64(), uint64(s.Intn(100)), uint64(s.Int63n(1 << 40)), uint64(s.Float64() * (1 << 53))}
+
+	perm := []uint64{0, 1, 2, 3, 4, 5, 6, 7}
+	s.Shuffle(len(perm), func(i, j int) { perm[i], perm[j] = perm[j], perm[i] })
+
+	return append(out, perm...)
+}
+
+func TestSeeded(t *testing.T) {
+	assert.Equal(t, draw(NewSeeded(42)), draw(NewSeeded(42)))
+	assert.NotEqual(t, draw(NewSeeded(42)), draw(NewSeeded(43)))
+
+	// Forks of sources seeded alike draw alike, yet differently from one another.
+	a, b := NewSeeded(42), NewSeeded(42)
+
+	first, second := a.Fork(), a.Fork()
+	assert.Equal(t, draw(first), draw(b.Fork()))
+	assert.NotEqual(t, draw(NewSeeded(42).Fork()), draw(second))
+
+	assert.NotEqual(t, draw(New()), draw(New()))
+}
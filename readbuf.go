@@ -0,0 +1,212 @@
+package noise
+
+import (
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	// MinReadBufferSize and MaxReadBufferSize bound how many bytes a peers read buffer may hold.
+	MinReadBufferSize = 512
+	MaxReadBufferSize = 65536
+
+	// initialReadBufferSize is how many bytes a peers read buffer holds before enough messages have
+	// been received off of the peer to size it by.
+	initialReadBufferSize = 4096
+
+	// readBufferWindow is how many of the latest messages received off of a peer its read buffer is
+	// sized by, and readBufferInterval how many messages are received before it is sized again.
+	readBufferWindow   = 64
+	readBufferInterval = 16
+)
+
+// ReadBufferStats describes how the read buffer of a peer is sized, and how often our node read
+// off of its connection.
+type ReadBufferStats struct {
+	// Size is how many bytes the read buffer holds.
+	Size int `json:"size"`
+
+	// P50 and P90 are the percentiles of the sizes of the latest messages received off of the peer,
+	// in bytes, which the read buffer is sized by.
+	P50 int `json:"p50"`
+	P90 int `json:"p90"`
+
+	// Reads counts the reads made off of the connection to the peer.
+	Reads uint64 `json:"reads"`
+
+	// Resizes counts how many times the read buffer was resized.
+	Resizes uint64 `json:"resizes"`
+}
+
+// readBuffer buffers reads off of the connection to a peer, like a `bufio.Reader`, though resizes
+// itself to fit the messages received off of the peer. Peers sending mostly small messages are read
+// through a small buffer, such that idle peers hold on to little memory, while peers sending bulk
+// messages are read through a large buffer, such that many messages are read at once.
+//
+// The buffer is sized to fit four messages at the 90th percentile of the latest messages received,
+// rounded up to a power of two. It is only resized should its size be off by at least a factor of
+// two, such that it does not flap between sizes.
+type readBuffer struct {
+	sync.Mutex
+
+	src  io.Reader
+	buf  []byte
+	r, w int
+	err  error
+
+	sizes    [readBufferWindow]int
+	observed int
+
+	reads, resizes uint64
+}
+
+func newReadBuffer(src io.Reader) *readBuffer {
+	return &readBuffer{src: src, buf: make([]byte, initialReadBufferSize)}
+}
+
+func (b *readBuffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if b.r == b.w {
+		if b.err != nil {
+			return 0, b.readErr()
+		}
+
+		// Reads at least as large as the buffer skip it, to not copy their bytes twice.
+		if len(p) >= len(b.buf) {
+			n, err := b.src.Read(p)
+			b.count()
+
+			return n, err
+		}
+
+		b.fill()
+
+		if b.r == b.w {
+			return 0, b.readErr()
+		}
+	}
+
+	n := copy(p, b.buf[b.r:b.w])
+	b.r += n
+
+	return n, nil
+}
+
+func (b *readBuffer) ReadByte() (byte, error) {
+	for b.r == b.w {
+		if b.err != nil {
+			return 0, b.readErr()
+		}
+
+		b.fill()
+	}
+
+	c := b.buf[b.r]
+	b.r++
+
+	return c, nil
+}
+
+// fill reads once off of the connection into the buffer.
+func (b *readBuffer) fill() {
+	if b.r > 0 {
+		copy(b.buf, b.buf[b.r:b.w])
+		b.w -= b.r
+		b.r = 0
+	}
+
+	n, err := b.src.Read(b.buf[b.w:])
+	b.count()
+
+	b.w += n
+	b.err = err
+}
+
+func (b *readBuffer) readErr() error {
+	err := b.err
+	b.err = nil
+
+	return err
+}
+
+func (b *readBuffer) count() {
+	b.Lock()
+	b.reads++
+	b.Unlock()
+}
+
+// observe records the size of a message received off of the peer, and resizes the buffer every
+// readBufferInterval messages should it be off by at least a factor of two.
+func (b *readBuffer) observe(size int) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.sizes[b.observed%readBufferWindow] = size
+	b.observed++
+
+	if b.observed%readBufferInterval != 0 {
+		return
+	}
+
+	target := fitReadBuffer(b.percentile(90))
+	if target < len(b.buf)*2 && target*2 > len(b.buf) {
+		return
+	}
+
+	// Bytes already buffered must fit in the resized buffer.
+	if b.w-b.r > target {
+		return
+	}
+
+	buf := make([]byte, target)
+	b.w = copy(buf, b.buf[b.r:b.w])
+	b.r = 0
+	b.buf = buf
+
+	b.resizes++
+}
+
+// percentile returns a percentile of the sizes of the latest messages observed.
+func (b *readBuffer) percentile(p int) int {
+	count := b.observed
+	if count > readBufferWindow {
+		count = readBufferWindow
+	}
+
+	if count == 0 {
+		return 0
+	}
+
+	sizes := append([]int(nil), b.sizes[:count]...)
+	sort.Ints(sizes)
+
+	return sizes[(count-1)*p/100]
+}
+
+func (b *readBuffer) stats() ReadBufferStats {
+	b.Lock()
+	defer b.Unlock()
+
+	return ReadBufferStats{Size: len(b.buf), P50: b.percentile(50), P90: b.percentile(90), Reads: b.reads, Resizes: b.resizes}
+}
+
+// fitReadBuffer returns the size of a buffer fitting four messages of a size, rounded up to a power
+// of two, bounded by MinReadBufferSize and MaxReadBufferSize.
+func fitReadBuffer(size int) int {
+	target := MinReadBufferSize
+
+	for target < 4*size && target < MaxReadBufferSize {
+		target *= 2
+	}
+
+	return target
+}
+
+// ReadBufferStats returns how the buffer messages from the peer are read through is sized.
+func (p *Peer) ReadBufferStats() ReadBufferStats {
+	return p.readBuffer.stats()
+}
@@ -0,0 +1,142 @@
+package noise
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+// frames returns messages of each size prefixed with their lengths, as written over the wire.
+func frames(sizes ...int) ([]byte, [][]byte) {
+	var buf bytes.Buffer
+	var messages [][]byte
+
+	for i, size := range sizes {
+		msg := bytes.Repeat([]byte{byte(i)}, size)
+		messages = append(messages, msg)
+
+		var prefix [binary.MaxVarintLen64]byte
+		buf.Write(prefix[:binary.PutUvarint(prefix[:], uint64(size))])
+		buf.Write(msg)
+	}
+
+	return buf.Bytes(), messages
+}
+
+func TestReadBuffer(t *testing.T) {
+	read := func(b *readBuffer, expected [][]byte) {
+		for _, msg := range expected {
+			size, err := binary.ReadUvarint(b)
+			assert.NoError(t, err)
+
+			buf := make([]byte, size)
+			_, err = io.ReadFull(b, buf)
+			assert.NoError(t, err)
+			assert.Equal(t, msg, buf)
+
+			b.observe(int(size))
+		}
+	}
+
+	repeat := func(size, n int) []int {
+		sizes := make([]int, n)
+		for i := range sizes {
+			sizes[i] = size
+		}
+
+		return sizes
+	}
+
+	// Peers sending small messages are read through a small buffer.
+	src, messages := frames(repeat(40, readBufferWindow)...)
+	b := newReadBuffer(bytes.NewReader(src))
+
+	read(b, messages)
+
+	stats := b.stats()
+	assert.Equal(t, MinReadBufferSize, stats.Size)
+	assert.Equal(t, 40, stats.P50)
+	assert.Equal(t, 40, stats.P90)
+	assert.EqualValues(t, 1, stats.Resizes)
+
+	// Peers sending bulk messages are read through a large buffer, with bytes buffered before it was
+	// resized left intact.
+	src, messages = frames(append(repeat(100, 8), repeat(20000, readBufferWindow)...)...)
+	b = newReadBuffer(bytes.NewReader(src))
+
+	read(b, messages)
+
+	stats = b.stats()
+	assert.Equal(t, MaxReadBufferSize, stats.Size)
+	assert.Equal(t, 20000, stats.P90)
+
+	// Buffers are sized to fit four messages at the 90th percentile, and are not resized should they
+	// only be off by less than a factor of two.
+	assert.Equal(t, MinReadBufferSize, fitReadBuffer(0))
+	assert.Equal(t, 4096, fitReadBuffer(1000))
+	assert.Equal(t, MaxReadBufferSize, fitReadBuffer(1<<20))
+
+	src, messages = frames(repeat(700, readBufferWindow)...)
+	b = newReadBuffer(bytes.NewReader(src))
+
+	read(b, messages)
+
+	assert.Equal(t, initialReadBufferSize, b.stats().Size)
+	assert.EqualValues(t, 0, b.stats().Resizes)
+}
+
+func TestReadBufferStats(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	opcodeTest := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go alice.Listen()
+	go bob.Listen()
+
+	received := make(chan *Peer, readBufferWindow)
+
+	bob.OnMessageReceived(opcodeTest, func(node *Node, opcode Opcode, peer *Peer, message Message) error {
+		received <- peer
+		return nil
+	})
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	for i := 0; i < readBufferWindow; i++ {
+		assert.NoError(t, peer.SendMessage(testMsg{Text: "hello"}))
+	}
+
+	var from *Peer
+
+	for i := 0; i < readBufferWindow; i++ {
+		select {
+		case from = <-received:
+		case <-time.After(3 * time.Second):
+			t.Fatal("bob did not receive every message")
+		}
+	}
+
+	stats := from.ReadBufferStats()
+	assert.Equal(t, MinReadBufferSize, stats.Size)
+	assert.True(t, stats.Reads > 0)
+	assert.True(t, stats.P90 < 32)
+}
@@ -0,0 +1,500 @@
+// Package rendezvous has peers register under application namespaces at rendezvous points, which
+// other peers query to discover them. It is a lighter-weight alternative to a DHT for small
+// networks, where a handful of well-known nodes may be relied on to introduce peers to one another.
+package rendezvous
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	keyState = "rendezvous.state"
+
+	DefaultTTL              = 2 * time.Hour
+	DefaultMaxTTL           = 72 * time.Hour
+	DefaultMaxRegistrations = 1000
+	DefaultPageSize         = 100
+
+	// maxNamespaceLength caps how long namespaces may be.
+	maxNamespaceLength = 255
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrRefused = errors.New("rendezvous: peer refused request")
+	ErrTimeout = errors.New("rendezvous: timed out waiting for peer to respond")
+)
+
+// Registration lists a peer under a namespace at an address until its TTL runs out. PublicKey is
+// the public key of the peer, should the peer have been identified through an ID by the rendezvous
+// point that handed out the registration.
+type Registration struct {
+	Namespace string
+	Address   string
+	PublicKey []byte
+	TTL       time.Duration
+}
+
+type block struct {
+	opcodeRegister         noise.Opcode
+	opcodeRegisterResponse noise.Opcode
+	opcodeUnregister       noise.Opcode
+	opcodeDiscover         noise.Opcode
+	opcodeDiscoverResponse noise.Opcode
+
+	timeoutDuration time.Duration
+
+	serving    bool
+	anyAddress bool
+
+	defaultTTL       time.Duration
+	maxTTL           time.Duration
+	maxRegistrations int
+}
+
+// New returns a block which registers with, and discovers peers through, rendezvous points. Our
+// node is not a rendezvous point for others unless WithServing is set.
+//
+// By default, peers are waited on for 10 seconds. Rendezvous points list registrations for 2 hours
+// unless asked otherwise, for at most 72 hours, and list at most 1000 registrations per namespace.
+// Peers may only register addresses on the same IP we observe them connecting from.
+func New() *block {
+	return &block{
+		timeoutDuration:  10 * time.Second,
+		defaultTTL:       DefaultTTL,
+		maxTTL:           DefaultMaxTTL,
+		maxRegistrations: DefaultMaxRegistrations,
+	}
+}
+
+func (b *block) TimeoutAfter(timeoutDuration time.Duration) *block {
+	b.timeoutDuration = timeoutDuration
+	return b
+}
+
+// WithServing has our node act as a rendezvous point, listing peers which register with it and
+// handing them out to peers which query it.
+func (b *block) WithServing() *block {
+	b.serving = true
+	return b
+}
+
+// WithTTL sets the TTL registrations are granted should they not ask for one, and the longest TTL
+// registrations may be granted.
+func (b *block) WithTTL(defaultTTL, maxTTL time.Duration) *block {
+	b.defaultTTL, b.maxTTL = defaultTTL, maxTTL
+	return b
+}
+
+// WithMaxRegistrations sets how many registrations are listed under any single namespace.
+// Registrations beyond the limit are refused.
+func (b *block) WithMaxRegistrations(max int) *block {
+	b.maxRegistrations = max
+	return b
+}
+
+// WithoutIPCheck allows for peers to register addresses on IPs other than the one we observe them
+// connecting from. Be warned that peers may then list arbitrary hosts.
+func (b *block) WithoutIPCheck() *block {
+	b.anyAddress = true
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeRegister = noise.RegisterMessage(noise.NextAvailableOpcode(), (*RegisterRequest)(nil))
+	b.opcodeRegisterResponse = noise.RegisterMessage(noise.NextAvailableOpcode(), (*RegisterResponse)(nil))
+	b.opcodeUnregister = noise.RegisterMessage(noise.NextAvailableOpcode(), (*UnregisterRequest)(nil))
+	b.opcodeDiscover = noise.RegisterMessage(noise.NextAvailableOpcode(), (*DiscoverRequest)(nil))
+	b.opcodeDiscoverResponse = noise.RegisterMessage(noise.NextAvailableOpcode(), (*DiscoverResponse)(nil))
+
+	s := &state{block: b, clock: node.Clock(), namespaces: make(map[string]map[string]*entry)}
+	node.Set(keyState, s)
+
+	node.OnMessageReceived(b.opcodeRegister, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		msg := message.(RegisterRequest)
+		res := RegisterResponse{Nonce: msg.Nonce}
+
+		ttl, err := s.register(peer, msg)
+		if err != nil {
+			res.Error = err.Error()
+		}
+
+		res.TTL = milliseconds(ttl)
+
+		peer.SendMessageAsync(res)
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodeUnregister, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		s.unregister(peer, message.(UnregisterRequest))
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodeDiscover, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		peer.SendMessageAsync(s.discover(message.(DiscoverRequest)))
+		return nil
+	})
+
+	for _, opcode := range []noise.Opcode{b.opcodeRegisterResponse, b.opcodeDiscoverResponse} {
+		node.OnMessageReceived(opcode, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+			s.resolve(message)
+			return nil
+		})
+	}
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Register lists our node under a namespace at an address with a rendezvous point, for a TTL. A
+// TTL of zero asks for the default TTL of the rendezvous point. It returns the TTL the rendezvous
+// point granted, after which our node must register again to keep being listed, or an error
+// wrapping ErrRefused should the rendezvous point not accept the registration.
+func Register(node *noise.Node, peer *noise.Peer, namespace, address string, ttl time.Duration) (time.Duration, error) {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return 0, errors.New("rendezvous: block is not registered to the nodes protocol")
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := s.request(peer, nonce, RegisterRequest{Nonce: nonce, Namespace: namespace, Address: address, TTL: milliseconds(ttl)})
+	if err != nil {
+		return 0, err
+	}
+
+	if res := res.(RegisterResponse); res.Error != "" {
+		return 0, errors.Wrap(ErrRefused, res.Error)
+	}
+
+	return time.Duration(res.(RegisterResponse).TTL) * time.Millisecond, nil
+}
+
+// Unregister asks a rendezvous point to no longer list our node under a namespace at an address.
+func Unregister(node *noise.Node, peer *noise.Peer, namespace, address string) error {
+	return peer.SendMessage(UnregisterRequest{Namespace: namespace, Address: address})
+}
+
+// Discover queries a rendezvous point for at most limit registrations under a namespace, or under
+// every namespace should the namespace be empty. A limit of zero asks for at most 100
+// registrations.
+//
+// The cookie returned is to be passed to the next call to Discover to retrieve the registrations
+// which follow, or which were made since. A nil cookie starts from the first registration.
+func Discover(node *noise.Node, peer *noise.Peer, namespace string, limit int, cookie []byte) ([]Registration, []byte, error) {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return nil, nil, errors.New("rendezvous: block is not registered to the nodes protocol")
+	}
+
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := s.request(peer, nonce, DiscoverRequest{Nonce: nonce, Namespace: namespace, Limit: uint32(limit), Cookie: cookie})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if res := res.(DiscoverResponse); res.Error != "" {
+		return nil, nil, errors.Wrap(ErrRefused, res.Error)
+	}
+
+	return res.(DiscoverResponse).Registrations, res.(DiscoverResponse).Cookie, nil
+}
+
+type entry struct {
+	registration Registration
+
+	// seq orders registrations by when they were made, which cookies page through.
+	seq     uint64
+	expires time.Time
+}
+
+type state struct {
+	block *block
+	clock clock.Clock
+
+	sync.Mutex
+
+	// namespaces maps namespaces to the registrations listed under them, keyed by address.
+	namespaces map[string]map[string]*entry
+	seq        uint64
+
+	// pending maps nonces to requests awaiting a response.
+	pending sync.Map
+}
+
+func (s *state) register(peer *noise.Peer, msg RegisterRequest) (time.Duration, error) {
+	if !s.block.serving {
+		return 0, errors.New("our node is not a rendezvous point")
+	}
+
+	if err := validateNamespace(msg.Namespace); err != nil {
+		return 0, err
+	}
+
+	if msg.Namespace == "" {
+		return 0, errors.New("namespace must not be empty")
+	}
+
+	host, _, err := net.SplitHostPort(msg.Address)
+	if err != nil {
+		return 0, errors.Wrap(err, "malformed address")
+	}
+
+	if !s.block.anyAddress && !net.ParseIP(host).Equal(peer.RemoteIP()) {
+		return 0, errors.Errorf("refusing to list %s, as it is not on the IP the peer connected from", msg.Address)
+	}
+
+	ttl := time.Duration(msg.TTL) * time.Millisecond
+
+	if ttl == 0 {
+		ttl = s.block.defaultTTL
+	}
+
+	if ttl > s.block.maxTTL {
+		ttl = s.block.maxTTL
+	}
+
+	registration := Registration{Namespace: msg.Namespace, Address: msg.Address}
+
+	if id := protocol.PeerID(peer); id != nil {
+		registration.PublicKey = id.PublicKey()
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.clock.Now()
+	entries := s.prune(msg.Namespace, now)
+
+	if _, exists := entries[msg.Address]; !exists && len(entries) >= s.block.maxRegistrations {
+		return 0, errors.Errorf("namespace %q already has the maximum of %d registrations", msg.Namespace, s.block.maxRegistrations)
+	}
+
+	if entries == nil {
+		entries = make(map[string]*entry)
+		s.namespaces[msg.Namespace] = entries
+	}
+
+	s.seq++
+	entries[msg.Address] = &entry{registration: registration, seq: s.seq, expires: now.Add(ttl)}
+
+	return ttl, nil
+}
+
+// unregister removes the registration of a peer. Peers may only remove registrations of addresses
+// they would have been allowed to register.
+func (s *state) unregister(peer *noise.Peer, msg UnregisterRequest) {
+	host, _, err := net.SplitHostPort(msg.Address)
+	if err != nil {
+		return
+	}
+
+	if !s.block.anyAddress && !net.ParseIP(host).Equal(peer.RemoteIP()) {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if entries, exists := s.namespaces[msg.Namespace]; exists {
+		delete(entries, msg.Address)
+
+		if len(entries) == 0 {
+			delete(s.namespaces, msg.Namespace)
+		}
+	}
+}
+
+func (s *state) discover(msg DiscoverRequest) DiscoverResponse {
+	res := DiscoverResponse{Nonce: msg.Nonce}
+
+	if !s.block.serving {
+		res.Error = "our node is not a rendezvous point"
+		return res
+	}
+
+	if err := validateNamespace(msg.Namespace); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	var after uint64
+
+	if len(msg.Cookie) > 0 {
+		if len(msg.Cookie) != 8 {
+			res.Error = "malformed cookie"
+			return res
+		}
+
+		after = binary.BigEndian.Uint64(msg.Cookie)
+	}
+
+	limit := int(msg.Limit)
+
+	if limit <= 0 || limit > DefaultPageSize {
+		limit = DefaultPageSize
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.clock.Now()
+
+	namespaces := []string{msg.Namespace}
+
+	if msg.Namespace == "" {
+		namespaces = namespaces[:0]
+
+		for namespace := range s.namespaces {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	var found []*entry
+
+	for _, namespace := range namespaces {
+		for _, e := range s.prune(namespace, now) {
+			if e.seq > after {
+				found = append(found, e)
+			}
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].seq < found[j].seq
+	})
+
+	if len(found) > limit {
+		found = found[:limit]
+	}
+
+	for _, e := range found {
+		r := e.registration
+		r.TTL = e.expires.Sub(now)
+
+		res.Registrations = append(res.Registrations, r)
+		after = e.seq
+	}
+
+	res.Cookie = make([]byte, 8)
+	binary.BigEndian.PutUint64(res.Cookie, after)
+
+	return res
+}
+
+// prune drops the expired registrations under a namespace, and returns those which remain. It must
+// be called with the state locked.
+func (s *state) prune(namespace string, now time.Time) map[string]*entry {
+	entries, exists := s.namespaces[namespace]
+	if !exists {
+		return nil
+	}
+
+	for address, e := range entries {
+		if !now.Before(e.expires) {
+			delete(entries, address)
+		}
+	}
+
+	if len(entries) == 0 {
+		delete(s.namespaces, namespace)
+		return nil
+	}
+
+	return entries
+}
+
+// request sends a request to a peer, and waits for the peer to respond with the same nonce.
+func (s *state) request(peer *noise.Peer, nonce uint64, req noise.Message) (noise.Message, error) {
+	result := make(chan noise.Message, 1)
+
+	s.pending.Store(nonce, result)
+	defer s.pending.Delete(nonce)
+
+	if err := peer.SendMessage(req); err != nil {
+		return nil, errors.Wrap(err, "rendezvous: failed to send request")
+	}
+
+	select {
+	case res := <-result:
+		return res, nil
+	case <-s.clock.After(s.block.timeoutDuration):
+		return nil, ErrTimeout
+	}
+}
+
+func (s *state) resolve(res noise.Message) {
+	var nonce uint64
+
+	switch res := res.(type) {
+	case RegisterResponse:
+		nonce = res.Nonce
+	case DiscoverResponse:
+		nonce = res.Nonce
+	}
+
+	if result, ok := s.pending.Load(nonce); ok {
+		select {
+		case result.(chan noise.Message) <- res:
+		default:
+		}
+	}
+}
+
+func validateNamespace(namespace string) error {
+	if len(namespace) > maxNamespaceLength {
+		return errors.Errorf("namespace is longer than %d bytes", maxNamespaceLength)
+	}
+
+	return nil
+}
+
+// milliseconds converts a duration to milliseconds, capped to fit within a uint32.
+func milliseconds(d time.Duration) uint32 {
+	if d <= 0 {
+		return 0
+	}
+
+	if ms := d / time.Millisecond; ms < math.MaxUint32 {
+		return uint32(ms)
+	}
+
+	return math.MaxUint32
+}
+
+func newNonce() (uint64, error) {
+	var buf [8]byte
+
+	if _, err := rand.Read(buf[:]); err != nil {
+		return 0, errors.Wrap(err, "rendezvous: failed to generate nonce")
+	}
+
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
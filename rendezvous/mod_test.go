@@ -0,0 +1,158 @@
+package rendezvous
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newNode(t *testing.T, layer transport.Layer, block *block) *noise.Node {
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	protocol.New().Register(block).Enforce(node)
+
+	go node.Listen()
+
+	return node
+}
+
+func connect(t *testing.T, from, to *noise.Node) *noise.Peer {
+	peer, err := from.Dial(to.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	return peer
+}
+
+func addresses(registrations []Registration) []string {
+	var addresses []string
+
+	for _, r := range registrations {
+		addresses = append(addresses, r.Address)
+	}
+
+	return addresses
+}
+
+func TestRendezvous(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	point := newNode(t, layer, New().WithServing().WithTTL(time.Minute, time.Hour))
+	defer point.Kill()
+
+	var nodes []*noise.Node
+	var peers []*noise.Peer
+
+	for i := 0; i < 3; i++ {
+		node := newNode(t, layer, New())
+		defer node.Kill()
+
+		nodes = append(nodes, node)
+		peers = append(peers, connect(t, node, point))
+	}
+
+	ttl, err := Register(nodes[0], peers[0], "chat", nodes[0].ExternalAddress(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, ttl)
+
+	ttl, err = Register(nodes[1], peers[1], "chat", nodes[1].ExternalAddress(), 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, ttl)
+
+	_, err = Register(nodes[2], peers[2], "files", nodes[2].ExternalAddress(), 0)
+	assert.NoError(t, err)
+
+	// Peers may not register addresses on IPs other than the one they connect from.
+	_, err = Register(nodes[2], peers[2], "chat", "203.0.113.7:3000", 0)
+	assert.True(t, errors.Is(err, ErrRefused))
+
+	// Registrations are paged through with cookies.
+	found, cookie, err := Discover(nodes[2], peers[2], "chat", 1, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{nodes[0].ExternalAddress()}, addresses(found))
+	assert.True(t, found[0].TTL > 0 && found[0].TTL <= time.Minute)
+
+	found, cookie, err = Discover(nodes[2], peers[2], "chat", 1, cookie)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{nodes[1].ExternalAddress()}, addresses(found))
+
+	found, cookie, err = Discover(nodes[2], peers[2], "chat", 1, cookie)
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+
+	// Cookies pick up registrations made since they were handed out.
+	_, err = Register(nodes[2], peers[2], "chat", nodes[2].ExternalAddress(), 0)
+	assert.NoError(t, err)
+
+	found, _, err = Discover(nodes[0], peers[0], "chat", 0, cookie)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{nodes[2].ExternalAddress()}, addresses(found))
+
+	// An empty namespace discovers registrations under every namespace.
+	found, _, err = Discover(nodes[0], peers[0], "", 0, nil)
+	assert.NoError(t, err)
+	assert.Len(t, found, 4)
+
+	assert.NoError(t, Unregister(nodes[0], peers[0], "chat", nodes[0].ExternalAddress()))
+	time.Sleep(50 * time.Millisecond)
+
+	found, _, err = Discover(nodes[1], peers[1], "chat", 0, nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{nodes[1].ExternalAddress(), nodes[2].ExternalAddress()}, addresses(found))
+
+	// Peers which are not rendezvous points refuse requests.
+	peer := connect(t, nodes[0], nodes[1])
+
+	_, err = Register(nodes[0], peer, "chat", nodes[0].ExternalAddress(), 0)
+	assert.True(t, errors.Is(err, ErrRefused))
+
+	_, _, err = Discover(nodes[0], peer, "chat", 0, nil)
+	assert.True(t, errors.Is(err, ErrRefused))
+}
+
+func TestRendezvousLimits(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	point := newNode(t, layer, New().WithServing().WithMaxRegistrations(1))
+	node := newNode(t, layer, New())
+
+	defer point.Kill()
+	defer node.Kill()
+
+	peer := connect(t, node, point)
+
+	_, err := Register(node, peer, "chat", node.ExternalAddress(), 50*time.Millisecond)
+	assert.NoError(t, err)
+
+	// Registrations beyond the limit of a namespace are refused, though renewals are not.
+	_, err = Register(node, peer, "chat", "127.0.0.1:1", 0)
+	assert.True(t, errors.Is(err, ErrRefused))
+
+	_, err = Register(node, peer, "chat", node.ExternalAddress(), 50*time.Millisecond)
+	assert.NoError(t, err)
+
+	// Registrations are no longer handed out once they expire.
+	time.Sleep(100 * time.Millisecond)
+
+	found, _, err := Discover(node, peer, "chat", 0, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+
+	_, _, err = Discover(node, peer, "chat", 0, []byte("bad"))
+	assert.True(t, errors.Is(err, ErrRefused))
+}
@@ -0,0 +1,219 @@
+package rendezvous
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const maxRegistrationsPerResponse = 1000
+
+var (
+	_ noise.Message = (*RegisterRequest)(nil)
+	_ noise.Message = (*RegisterResponse)(nil)
+	_ noise.Message = (*UnregisterRequest)(nil)
+	_ noise.Message = (*DiscoverRequest)(nil)
+	_ noise.Message = (*DiscoverResponse)(nil)
+)
+
+// RegisterRequest asks a rendezvous point to list our node under a namespace at an address for a
+// TTL, in milliseconds. A TTL of zero asks for the default TTL of the rendezvous point.
+type RegisterRequest struct {
+	Nonce     uint64
+	Namespace string
+	Address   string
+	TTL       uint32
+}
+
+func (RegisterRequest) Read(reader payload.Reader) (noise.Message, error) {
+	var msg RegisterRequest
+	var err error
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read registration nonce")
+	}
+
+	if msg.Namespace, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read registration namespace")
+	}
+
+	if msg.Address, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read registration address")
+	}
+
+	if msg.TTL, err = reader.ReadUint32(); err != nil {
+		return nil, errors.Wrap(err, "failed to read registration ttl")
+	}
+
+	return msg, nil
+}
+
+func (m RegisterRequest) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).WriteString(m.Namespace).WriteString(m.Address).WriteUint32(m.TTL).Bytes()
+}
+
+// RegisterResponse reports the outcome of a registration, and the TTL in milliseconds the
+// rendezvous point granted. Error is empty should the registration have been accepted.
+type RegisterResponse struct {
+	Nonce uint64
+	Error string
+	TTL   uint32
+}
+
+func (RegisterResponse) Read(reader payload.Reader) (noise.Message, error) {
+	var msg RegisterResponse
+	var err error
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read registration response nonce")
+	}
+
+	if msg.Error, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read registration response error")
+	}
+
+	if msg.TTL, err = reader.ReadUint32(); err != nil {
+		return nil, errors.Wrap(err, "failed to read granted ttl")
+	}
+
+	return msg, nil
+}
+
+func (m RegisterResponse) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).WriteString(m.Error).WriteUint32(m.TTL).Bytes()
+}
+
+// UnregisterRequest asks a rendezvous point to no longer list our node under a namespace at an
+// address.
+type UnregisterRequest struct {
+	Namespace string
+	Address   string
+}
+
+func (UnregisterRequest) Read(reader payload.Reader) (noise.Message, error) {
+	var msg UnregisterRequest
+	var err error
+
+	if msg.Namespace, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read namespace to unregister from")
+	}
+
+	if msg.Address, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read address to unregister")
+	}
+
+	return msg, nil
+}
+
+func (m UnregisterRequest) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.Namespace).WriteString(m.Address).Bytes()
+}
+
+// DiscoverRequest asks a rendezvous point for at most Limit registrations under a namespace,
+// following those already handed out up to Cookie. An empty namespace asks for registrations under
+// every namespace, and an empty cookie starts from the first registration.
+type DiscoverRequest struct {
+	Nonce     uint64
+	Namespace string
+	Limit     uint32
+	Cookie    []byte
+}
+
+func (DiscoverRequest) Read(reader payload.Reader) (noise.Message, error) {
+	var msg DiscoverRequest
+	var err error
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read discovery nonce")
+	}
+
+	if msg.Namespace, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read discovery namespace")
+	}
+
+	if msg.Limit, err = reader.ReadUint32(); err != nil {
+		return nil, errors.Wrap(err, "failed to read discovery limit")
+	}
+
+	if msg.Cookie, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read discovery cookie")
+	}
+
+	return msg, nil
+}
+
+func (m DiscoverRequest) Write() []byte {
+	return payload.NewWriter(nil).WriteUint64(m.Nonce).WriteString(m.Namespace).WriteUint32(m.Limit).WriteBytes(m.Cookie).Bytes()
+}
+
+// DiscoverResponse carries a page of registrations, and a cookie to fetch the page after it with.
+type DiscoverResponse struct {
+	Nonce         uint64
+	Error         string
+	Registrations []Registration
+	Cookie        []byte
+}
+
+func (DiscoverResponse) Read(reader payload.Reader) (noise.Message, error) {
+	var msg DiscoverResponse
+	var err error
+
+	if msg.Nonce, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read discovery response nonce")
+	}
+
+	if msg.Error, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read discovery response error")
+	}
+
+	count, err := reader.ReadUint32()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read number of registrations")
+	}
+
+	if count > maxRegistrationsPerResponse {
+		return nil, errors.Errorf("received too many registrations; got %d when at most we can only handle %d", count, maxRegistrationsPerResponse)
+	}
+
+	for i := uint32(0); i < count; i++ {
+		var r Registration
+
+		if r.Namespace, err = reader.ReadString(); err != nil {
+			return nil, errors.Wrap(err, "failed to read registration namespace")
+		}
+
+		if r.Address, err = reader.ReadString(); err != nil {
+			return nil, errors.Wrap(err, "failed to read registration address")
+		}
+
+		if r.PublicKey, err = reader.ReadBytes(); err != nil {
+			return nil, errors.Wrap(err, "failed to read registration public key")
+		}
+
+		ttl, err := reader.ReadUint32()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read registration ttl")
+		}
+
+		r.TTL = time.Duration(ttl) * time.Millisecond
+
+		msg.Registrations = append(msg.Registrations, r)
+	}
+
+	if msg.Cookie, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read discovery cookie")
+	}
+
+	return msg, nil
+}
+
+func (m DiscoverResponse) Write() []byte {
+	writer := payload.NewWriter(nil).WriteUint64(m.Nonce).WriteString(m.Error).WriteUint32(uint32(len(m.Registrations)))
+
+	for _, r := range m.Registrations {
+		writer.WriteString(r.Namespace).WriteString(r.Address).WriteBytes(r.PublicKey).WriteUint32(milliseconds(r.TTL))
+	}
+
+	return writer.WriteBytes(m.Cookie).Bytes()
+}
@@ -0,0 +1,69 @@
+package resolve
+
+import (
+	"context"
+	"github.com/perlin-network/noise/clock"
+	"sync"
+	"time"
+)
+
+// Cache caches the records resolved by a resolver for as long as their TTLs.
+type Cache struct {
+	resolver Resolver
+	clock    clock.Clock
+
+	sync.Mutex
+	entries map[string]cached
+}
+
+type cached struct {
+	record  Record
+	expires time.Time
+}
+
+// NewCache returns a cache of the records resolved by a resolver.
+func NewCache(resolver Resolver) *Cache {
+	return &Cache{resolver: resolver, clock: clock.New(), entries: make(map[string]cached)}
+}
+
+// WithClock sets the clock the TTLs of records are measured against.
+func (c *Cache) WithClock(clock clock.Clock) *Cache {
+	c.clock = clock
+	return c
+}
+
+func (c *Cache) Resolve(ctx context.Context, name string) (Record, error) {
+	c.Lock()
+	entry, exists := c.entries[name]
+	c.Unlock()
+
+	if exists && c.clock.Now().Before(entry.expires) {
+		return entry.record, nil
+	}
+
+	record, err := c.resolver.Resolve(ctx, name)
+	if err != nil {
+		return record, err
+	}
+
+	c.Lock()
+	if record.TTL > 0 {
+		c.entries[name] = cached{record: record, expires: c.clock.Now().Add(record.TTL)}
+	} else {
+		delete(c.entries, name)
+	}
+	c.Unlock()
+
+	return record, nil
+}
+
+// Invalidate drops the record cached for a name, such that it is resolved anew.
+func (c *Cache) Invalidate(name string) {
+	c.Lock()
+	delete(c.entries, name)
+	c.Unlock()
+
+	if resolver, ok := c.resolver.(invalidator); ok {
+		resolver.Invalidate(name)
+	}
+}
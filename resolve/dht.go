@@ -0,0 +1,61 @@
+package resolve
+
+import (
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/skademlia"
+	"github.com/pkg/errors"
+)
+
+// dhtPrefix is prepended to names to form the S/Kademlia service nodes register their names under.
+const dhtPrefix = "name/"
+
+// Register claims a name for our node in the DHT, by registering it as an S/Kademlia service. As
+// with any service, the claim expires after `skademlia.ServiceTTL`, and must be registered again
+// before then.
+func Register(node *noise.Node, name string) error {
+	return skademlia.RegisterService(node, dhtPrefix+name)
+}
+
+// DHT resolves names through claims registered in the DHT through Register.
+//
+// Claims are signed by the nodes which register them, such that they may not be forged, yet any node
+// may claim any name. Names which are claimed by more than one key resolve to ErrAmbiguous, and
+// networks in which nodes may not be trusted to claim only their own names should register a
+// verifier deciding which keys may hold which names.
+type DHT struct {
+	node     *noise.Node
+	verifier func(name string, publicKey []byte) error
+}
+
+// NewDHT returns a resolver looking up claims through the S/Kademlia block registered to our node.
+func NewDHT(node *noise.Node) *DHT {
+	return &DHT{node: node}
+}
+
+// WithVerifier registers a verifier called on every claim found, which drops claims it returns an
+// error for.
+func (r *DHT) WithVerifier(verifier func(name string, publicKey []byte) error) *DHT {
+	r.verifier = verifier
+	return r
+}
+
+func (r *DHT) Resolve(ctx context.Context, name string) (Record, error) {
+	var records []Record
+
+	for _, id := range skademlia.FindService(r.node, dhtPrefix+name) {
+		if r.verifier != nil {
+			if err := r.verifier(name, id.PublicKey()); err != nil {
+				continue
+			}
+		}
+
+		records = append(records, Record{Name: name, PublicKey: id.PublicKey(), Addresses: []string{id.Address()}, TTL: DefaultTTL})
+	}
+
+	if err := ctx.Err(); err != nil {
+		return Record{}, errors.Wrapf(err, "resolve: gave up looking up claims of %q", name)
+	}
+
+	return merge(name, records)
+}
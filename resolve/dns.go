@@ -0,0 +1,117 @@
+package resolve
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// dnsPrefix is prepended to names to look up the TXT records of, such that records for our nodes
+	// do not clash with any other TXT record of a name.
+	dnsPrefix = "_noise."
+
+	// dnsVersion marks TXT records which are meant for our nodes.
+	dnsVersion = "v=noise1"
+)
+
+// DNS resolves names through TXT records held under the name prefixed with `_noise.`, such as
+// `_noise.alice.example.org`, of the form:
+//
+//	v=noise1 pk=<hex-encoded public key> addr=<host:port> [addr=<host:port> ...]
+//
+// TXT records not starting with `v=noise1` are skipped. A name may have many records, such as one
+// for every address, as long as they all hold the same key.
+type DNS struct {
+	lookup func(ctx context.Context, name string) ([]string, error)
+	ttl    time.Duration
+}
+
+// NewDNS returns a resolver looking up TXT records through the resolver of the system. Records are
+// cached for 5 minutes, as the resolver of the system does not expose the TTLs of records.
+func NewDNS() *DNS {
+	return &DNS{lookup: net.DefaultResolver.LookupTXT, ttl: DefaultTTL}
+}
+
+// WithLookup sets the function TXT records are looked up through, such as that of a resolver
+// validating DNSSEC.
+func (r *DNS) WithLookup(lookup func(ctx context.Context, name string) ([]string, error)) *DNS {
+	r.lookup = lookup
+	return r
+}
+
+// WithTTL sets how long records resolved may be cached for.
+func (r *DNS) WithTTL(ttl time.Duration) *DNS {
+	r.ttl = ttl
+	return r
+}
+
+func (r *DNS) Resolve(ctx context.Context, name string) (Record, error) {
+	txts, err := r.lookup(ctx, dnsPrefix+name)
+	if err != nil {
+		if err, ok := err.(*net.DNSError); ok && err.IsNotFound {
+			return Record{}, errors.Wrapf(ErrNotFound, "%q has no TXT records", dnsPrefix+name)
+		}
+
+		return Record{}, errors.Wrapf(err, "resolve: failed to look up TXT records of %q", dnsPrefix+name)
+	}
+
+	var records []Record
+
+	for _, txt := range txts {
+		record, ok, err := parseTXT(name, txt)
+		if err != nil {
+			return Record{}, err
+		}
+
+		if ok {
+			record.TTL = r.ttl
+			records = append(records, record)
+		}
+	}
+
+	return merge(name, records)
+}
+
+// parseTXT parses a TXT record. It reports false should the record not be meant for our nodes.
+func parseTXT(name, txt string) (Record, bool, error) {
+	fields := strings.Fields(txt)
+
+	if len(fields) == 0 || fields[0] != dnsVersion {
+		return Record{}, false, nil
+	}
+
+	record := Record{Name: name}
+
+	for _, field := range fields[1:] {
+		i := strings.IndexByte(field, '=')
+		if i < 0 {
+			return Record{}, false, errors.Errorf("resolve: TXT record of %q holds a malformed field %q", name, field)
+		}
+
+		switch key, value := field[:i], field[i+1:]; key {
+		case "pk":
+			buf, err := hex.DecodeString(value)
+			if err != nil {
+				return Record{}, false, errors.Wrapf(err, "resolve: TXT record of %q holds a malformed public key", name)
+			}
+
+			record.PublicKey = buf
+		case "addr":
+			if _, _, err := net.SplitHostPort(value); err != nil {
+				return Record{}, false, errors.Wrapf(err, "resolve: TXT record of %q holds a malformed address", name)
+			}
+
+			record.Addresses = append(record.Addresses, value)
+		}
+	}
+
+	if len(record.PublicKey) == 0 {
+		return Record{}, false, errors.Errorf("resolve: TXT record of %q holds no public key", name)
+	}
+
+	return record, true, nil
+}
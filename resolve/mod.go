@@ -0,0 +1,188 @@
+// Package resolve resolves human-readable names, such as alice.example.org, to the static public
+// keys of the nodes behind them and the addresses they may be reached at, such that applications may
+// dial nodes by name.
+//
+// Names are resolved through pluggable resolvers, such as through DNS or through records held in the
+// DHT, and may be cached. Nodes dialed by name must prove that they hold the key their name resolves
+// to, such that a resolver handing out a stale or forged address fails to redirect our node to
+// anyone else.
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/handshake/cert"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// DefaultTTL is how long records are cached for, should their resolver not say otherwise.
+const DefaultTTL = 5 * time.Minute
+
+var (
+	ErrNotFound    = errors.New("resolve: name was not found")
+	ErrAmbiguous   = errors.New("resolve: name resolves to more than one key")
+	ErrKeyMismatch = errors.New("resolve: peer does not hold the key its name resolves to")
+)
+
+// Record maps a name to the static public key of the node behind it, and to the addresses the node
+// may be reached at.
+type Record struct {
+	Name      string
+	PublicKey []byte
+	Addresses []string
+
+	// TTL is how long the record may be cached for.
+	TTL time.Duration
+}
+
+// Resolver resolves names to records. Resolvers return ErrNotFound should they hold no record for
+// a name.
+type Resolver interface {
+	Resolve(ctx context.Context, name string) (Record, error)
+}
+
+// invalidator is implemented by resolvers which cache records, such that records which turn out to
+// be stale may be dropped.
+type invalidator interface {
+	Invalidate(name string)
+}
+
+type chain []Resolver
+
+// Chain returns a resolver which tries resolvers in order, until one of them finds a name.
+func Chain(resolvers ...Resolver) Resolver {
+	return chain(resolvers)
+}
+
+func (c chain) Resolve(ctx context.Context, name string) (Record, error) {
+	for _, resolver := range c {
+		record, err := resolver.Resolve(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		return record, err
+	}
+
+	return Record{}, errors.Wrapf(ErrNotFound, "no resolver found %q", name)
+}
+
+func (c chain) Invalidate(name string) {
+	for _, resolver := range c {
+		if resolver, ok := resolver.(invalidator); ok {
+			resolver.Invalidate(name)
+		}
+	}
+}
+
+// Dial resolves a name, and dials the addresses it resolves to in order until a node completes the
+// protocol of our node and proves that it holds the key the name resolves to.
+//
+// The key of a peer is the one it identified itself with through a block such as S/Kademlia, or the
+// subject of the certificate chain it presented through the `handshake/cert` block. Peers holding
+// any other key are disconnected, and should no peer hold the key, the record is invalidated should
+// the resolver cache records, and ErrKeyMismatch is returned.
+func Dial(ctx context.Context, node *noise.Node, resolver Resolver, name string) (*noise.Peer, error) {
+	record, err := resolver.Resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(record.Addresses) == 0 {
+		return nil, errors.Wrapf(ErrNotFound, "%q resolves to no address", name)
+	}
+
+	var errs []error
+
+	for _, address := range record.Addresses {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		peer, err := node.Dial(address)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to dial %s", address))
+			continue
+		}
+
+		if err := protocol.WaitUntilEstablished(peer); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to establish a session with %s", address))
+			continue
+		}
+
+		if !holds(peer, record.PublicKey) {
+			peer.Disconnect()
+
+			errs = append(errs, errors.Wrapf(ErrKeyMismatch, "peer at %s", address))
+			continue
+		}
+
+		return peer, nil
+	}
+
+	mismatched := false
+
+	for _, err := range errs {
+		if errors.Is(err, ErrKeyMismatch) {
+			mismatched = true
+		}
+	}
+
+	if resolver, ok := resolver.(invalidator); ok && mismatched {
+		resolver.Invalidate(name)
+	}
+
+	if mismatched {
+		return nil, errors.Wrapf(ErrKeyMismatch, "no peer %q resolves to holds key %x", name, record.PublicKey)
+	}
+
+	return nil, errors.Wrapf(errs[len(errs)-1], "failed to dial any of the %d addresses %q resolves to", len(record.Addresses), name)
+}
+
+// holds reports whether a peer identified itself with a key.
+func holds(peer *noise.Peer, key []byte) bool {
+	if protocol.HasPeerID(peer) {
+		if id := protocol.PeerID(peer); id != nil && bytes.Equal(id.PublicKey(), key) {
+			return true
+		}
+	}
+
+	if chain := cert.Of(peer); len(chain) > 0 && bytes.Equal(chain[0].Subject, key) {
+		return true
+	}
+
+	return false
+}
+
+// merge folds records resolved for a name into one, returning ErrAmbiguous should they map the name
+// to different keys.
+func merge(name string, records []Record) (Record, error) {
+	if len(records) == 0 {
+		return Record{}, errors.Wrapf(ErrNotFound, "%q", name)
+	}
+
+	merged := Record{Name: name, PublicKey: records[0].PublicKey, TTL: records[0].TTL}
+	seen := make(map[string]struct{})
+
+	for _, record := range records {
+		if !bytes.Equal(record.PublicKey, merged.PublicKey) {
+			return Record{}, errors.Wrapf(ErrAmbiguous, "%q resolves to both %x and %x", name, merged.PublicKey, record.PublicKey)
+		}
+
+		if record.TTL < merged.TTL {
+			merged.TTL = record.TTL
+		}
+
+		for _, address := range record.Addresses {
+			if _, exists := seen[address]; !exists {
+				seen[address] = struct{}{}
+				merged.Addresses = append(merged.Addresses, address)
+			}
+		}
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,169 @@
+package resolve
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/skademlia"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+// zone is a fake DNS zone of TXT records.
+type zone map[string][]string
+
+func (z zone) lookup(ctx context.Context, name string) ([]string, error) {
+	txts, exists := z[name]
+	if !exists {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	return txts, nil
+}
+
+// counting counts how many times names are resolved through a resolver.
+type counting struct {
+	Resolver
+	count int
+}
+
+func (c *counting) Resolve(ctx context.Context, name string) (Record, error) {
+	c.count++
+	return c.Resolver.Resolve(ctx, name)
+}
+
+func TestDNS(t *testing.T) {
+	key := make([]byte, 32)
+	key[0] = 1
+
+	other := make([]byte, 32)
+	other[0] = 2
+
+	pk := "pk=" + hex.EncodeToString(key)
+
+	r := NewDNS().WithLookup(zone{
+		"_noise.alice.example.org": {"v=spf1 -all", "v=noise1 " + pk + " addr=10.0.0.1:3000", "v=noise1 " + pk + " addr=10.0.0.2:3000 addr=10.0.0.1:3000"},
+		"_noise.bob.example.org":   {"v=noise1 " + pk + " addr=10.0.0.3:3000", "v=noise1 pk=" + hex.EncodeToString(other) + " addr=10.0.0.4:3000"},
+		"_noise.carol.example.org": {"v=noise1 pk=zz"},
+	}.lookup)
+
+	record, err := r.Resolve(context.Background(), "alice.example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, key, record.PublicKey)
+	assert.Equal(t, []string{"10.0.0.1:3000", "10.0.0.2:3000"}, record.Addresses)
+	assert.Equal(t, DefaultTTL, record.TTL)
+
+	_, err = r.Resolve(context.Background(), "bob.example.org")
+	assert.True(t, errors.Is(err, ErrAmbiguous))
+
+	_, err = r.Resolve(context.Background(), "carol.example.org")
+	assert.Error(t, err)
+
+	_, err = r.Resolve(context.Background(), "dave.example.org")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// Resolvers are tried in order, until one finds a name.
+	record, err = Chain(NewDNS().WithLookup(zone{}.lookup), r).Resolve(context.Background(), "alice.example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, key, record.PublicKey)
+
+	// Records are cached for as long as their TTLs.
+	fake := clock.NewFake(time.Now())
+
+	inner := &counting{Resolver: r}
+	cache := NewCache(inner).WithClock(fake)
+
+	for i := 0; i < 3; i++ {
+		_, err = cache.Resolve(context.Background(), "alice.example.org")
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, inner.count)
+
+	fake.Advance(DefaultTTL)
+
+	_, err = cache.Resolve(context.Background(), "alice.example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, inner.count)
+
+	cache.Invalidate("alice.example.org")
+
+	_, err = cache.Resolve(context.Background(), "alice.example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, inner.count)
+}
+
+func TestDial(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	newNode := func() *noise.Node {
+		params := noise.DefaultParams()
+		params.Transport = layer
+		params.Keys = skademlia.RandomKeys()
+
+		node, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		protocol.New().Register(skademlia.New()).Enforce(node)
+
+		go node.Listen()
+
+		return node
+	}
+
+	hub, alice, bob := newNode(), newNode(), newNode()
+	defer hub.Kill()
+	defer alice.Kill()
+	defer bob.Kill()
+
+	for _, node := range []*noise.Node{alice, bob} {
+		peer, err := node.Dial(hub.ExternalAddress())
+		assert.NoError(t, err)
+
+		skademlia.WaitUntilAuthenticated(peer)
+	}
+
+	for i := 0; i < 100 && len(skademlia.Table(hub).GetPeers()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err := Dial(context.Background(), alice, NewDHT(alice), "bob.example.org")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	assert.NoError(t, Register(bob, "bob.example.org"))
+
+	peer, err := Dial(context.Background(), alice, NewCache(NewDHT(alice)), "bob.example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, bob.Keys.PublicKey(), protocol.PeerID(peer).PublicKey())
+
+	// Claims rejected by a verifier are dropped.
+	_, err = NewDHT(alice).WithVerifier(func(name string, publicKey []byte) error {
+		return errors.New("not allowed")
+	}).Resolve(context.Background(), "bob.example.org")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// Nodes which do not hold the key a name resolves to are refused, and the record is dropped from
+	// the cache.
+	inner := &counting{Resolver: NewDNS().WithLookup(zone{
+		"_noise.carol.example.org": {fmt.Sprintf("v=noise1 pk=%x addr=%s", hub.Keys.PublicKey(), bob.ExternalAddress())},
+	}.lookup)}
+	cache := NewCache(inner)
+
+	_, err = Dial(context.Background(), alice, cache, "carol.example.org")
+	assert.True(t, errors.Is(err, ErrKeyMismatch))
+
+	_, err = cache.Resolve(context.Background(), "carol.example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, inner.count)
+}
@@ -0,0 +1,165 @@
+// Package resource accounts for the memory nodes reserve on behalf of their peers, such that nodes
+// refuse new work once limits are reached rather than running out of memory.
+package resource
+
+import (
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// Protocols memory is reserved for by Noise itself.
+const (
+	// ProtocolMessages covers messages read from peers and not yet handled.
+	ProtocolMessages = "noise.messages"
+
+	// ProtocolHandshake covers peers which have yet to complete the protocol enforced by our node.
+	ProtocolHandshake = "noise.handshake"
+
+	// ProtocolStream covers chunks of streams which have arrived, yet have not been read.
+	ProtocolStream = "stream"
+)
+
+var ErrLimitExceeded = errors.New("resource: memory limit exceeded")
+
+// Limits caps how many bytes may be reserved at once. Zero values leave a scope unlimited.
+type Limits struct {
+	// System caps the bytes reserved across all peers and protocols.
+	System uint64
+
+	// Peer caps the bytes reserved on behalf of any single peer.
+	Peer uint64
+
+	// Protocols caps the bytes reserved by a protocol across all peers.
+	Protocols map[string]uint64
+}
+
+// Usage is how many bytes are reserved at a point in time.
+type Usage struct {
+	System    uint64
+	Peers     map[interface{}]uint64
+	Protocols map[string]uint64
+}
+
+// Manager tracks the bytes reserved by protocols on behalf of peers, and refuses reservations which
+// would exceed its limits. A nil manager is unlimited, and tracks nothing.
+type Manager struct {
+	sync.Mutex
+
+	limits Limits
+
+	system    uint64
+	peers     map[interface{}]uint64
+	protocols map[string]uint64
+}
+
+func NewManager(limits Limits) *Manager {
+	return &Manager{
+		limits:    limits,
+		peers:     make(map[interface{}]uint64),
+		protocols: make(map[string]uint64),
+	}
+}
+
+// Reserve reserves bytes for a protocol on behalf of a peer, which may be any comparable value, or
+// nil should the bytes not be reserved on behalf of a peer. It returns an error matching
+// ErrLimitExceeded, and reserves nothing, should the reservation exceed any limit. Reservations
+// must be released through Release once the bytes are no longer held.
+func (m *Manager) Reserve(peer interface{}, protocol string, size uint64) error {
+	if m == nil || size == 0 {
+		return nil
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if limit := m.limits.System; limit > 0 && m.system+size > limit {
+		return errors.Wrapf(ErrLimitExceeded, "reserving %d bytes for %s would exceed the system limit of %d bytes", size, protocol, limit)
+	}
+
+	if limit := m.limits.Peer; peer != nil && limit > 0 && m.peers[peer]+size > limit {
+		return errors.Wrapf(ErrLimitExceeded, "reserving %d bytes for %s would exceed the per-peer limit of %d bytes", size, protocol, limit)
+	}
+
+	if limit := m.limits.Protocols[protocol]; limit > 0 && m.protocols[protocol]+size > limit {
+		return errors.Wrapf(ErrLimitExceeded, "reserving %d bytes would exceed the limit of %d bytes for %s", size, limit, protocol)
+	}
+
+	m.system += size
+	m.protocols[protocol] += size
+
+	if peer != nil {
+		m.peers[peer] += size
+	}
+
+	return nil
+}
+
+// Release releases bytes reserved through Reserve.
+func (m *Manager) Release(peer interface{}, protocol string, size uint64) {
+	if m == nil || size == 0 {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.system = sub(m.system, size)
+
+	if m.protocols[protocol] = sub(m.protocols[protocol], size); m.protocols[protocol] == 0 {
+		delete(m.protocols, protocol)
+	}
+
+	if peer == nil {
+		return
+	}
+
+	if m.peers[peer] = sub(m.peers[peer], size); m.peers[peer] == 0 {
+		delete(m.peers, peer)
+	}
+}
+
+// Usage returns how many bytes are presently reserved, in total, by every peer, and by every
+// protocol.
+func (m *Manager) Usage() Usage {
+	usage := Usage{Peers: make(map[interface{}]uint64), Protocols: make(map[string]uint64)}
+
+	if m == nil {
+		return usage
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	usage.System = m.system
+
+	for peer, size := range m.peers {
+		usage.Peers[peer] = size
+	}
+
+	for protocol, size := range m.protocols {
+		usage.Protocols[protocol] = size
+	}
+
+	return usage
+}
+
+// PeerUsage returns how many bytes are presently reserved on behalf of a peer.
+func (m *Manager) PeerUsage(peer interface{}) uint64 {
+	if m == nil {
+		return 0
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	return m.peers[peer]
+}
+
+// sub subtracts b from a, stopping at zero such that unbalanced releases may not underflow.
+func sub(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+
+	return a - b
+}
@@ -0,0 +1,43 @@
+package resource
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestManager(t *testing.T) {
+	m := NewManager(Limits{System: 100, Peer: 60, Protocols: map[string]uint64{"capped": 30}})
+
+	assert.NoError(t, m.Reserve("alice", ProtocolMessages, 50))
+	assert.NoError(t, m.Reserve("bob", ProtocolMessages, 40))
+
+	// Reservations exceeding the limit of a peer, protocol or the system are refused.
+	assert.True(t, errors.Is(m.Reserve("alice", ProtocolMessages, 20), ErrLimitExceeded))
+	assert.True(t, errors.Is(m.Reserve("carol", "capped", 31), ErrLimitExceeded))
+	assert.True(t, errors.Is(m.Reserve(nil, ProtocolMessages, 11), ErrLimitExceeded))
+
+	// Refused reservations reserve nothing.
+	usage := m.Usage()
+	assert.EqualValues(t, 90, usage.System)
+	assert.Equal(t, map[interface{}]uint64{"alice": 50, "bob": 40}, usage.Peers)
+	assert.Equal(t, map[string]uint64{ProtocolMessages: 90}, usage.Protocols)
+
+	assert.NoError(t, m.Reserve(nil, "capped", 10))
+
+	// Released bytes may be reserved again, and peers which reserve nothing are forgotten.
+	m.Release("alice", ProtocolMessages, 50)
+	assert.EqualValues(t, 0, m.PeerUsage("alice"))
+	assert.NoError(t, m.Reserve("carol", ProtocolStream, 50))
+
+	m.Release("bob", ProtocolMessages, 1000)
+	m.Release("carol", ProtocolStream, 50)
+	m.Release(nil, "capped", 10)
+
+	assert.Equal(t, Usage{Peers: map[interface{}]uint64{}, Protocols: map[string]uint64{}}, m.Usage())
+
+	// A nil manager is unlimited.
+	var unlimited *Manager
+	assert.NoError(t, unlimited.Reserve("alice", ProtocolMessages, 1<<40))
+	unlimited.Release("alice", ProtocolMessages, 1<<40)
+}
@@ -0,0 +1,122 @@
+package revoke
+
+import (
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/signature"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// signingContext separates signatures over revocation lists from signatures produced by the same
+// keys for any other purpose.
+const signingContext = "noise revocation:"
+
+// List is a list of node keys revoked by an issuer, such as the operator of a network. Issuers
+// publish a new list in full as they revoke more keys, under a serial number higher than that of
+// the list before it, and lists supersede all lists of the same issuer with lower serial numbers.
+type List struct {
+	Issuer []byte
+	Serial uint64
+	Issued time.Time
+
+	Keys [][]byte
+
+	Signature []byte
+}
+
+// Sign issues a list revoking keys from the keys of an issuer, under a serial number.
+func Sign(scheme signature.Scheme, issuerPublicKey, issuerPrivateKey []byte, serial uint64, issued time.Time, keys [][]byte) (List, error) {
+	l := List{Issuer: issuerPublicKey, Serial: serial, Issued: issued, Keys: keys}
+
+	sig, err := scheme.Sign(issuerPrivateKey, l.signingPayload())
+	if err != nil {
+		return l, errors.Wrap(err, "revoke: failed to sign revocation list")
+	}
+
+	l.Signature = sig
+
+	return l, nil
+}
+
+// Verify verifies the signature of a list by its issuer.
+func (l List) Verify(scheme signature.Scheme) error {
+	return scheme.Verify(l.Issuer, l.signingPayload(), l.Signature)
+}
+
+// Marshal encodes a list, such that it may be published or stored.
+func (l List) Marshal() []byte {
+	return payload.NewWriter(nil).WriteBytes(l.body()).WriteBytes(l.Signature).Bytes()
+}
+
+// Unmarshal decodes a list encoded through Marshal.
+func Unmarshal(buf []byte) (List, error) {
+	var l List
+
+	reader := payload.NewReader(buf)
+
+	body, err := reader.ReadBytes()
+	if err != nil {
+		return l, errors.Wrap(err, "revoke: failed to read revocation list")
+	}
+
+	if l.Signature, err = reader.ReadBytes(); err != nil {
+		return l, errors.Wrap(err, "revoke: failed to read signature of revocation list")
+	}
+
+	reader = payload.NewReader(body)
+
+	if l.Issuer, err = reader.ReadBytes(); err != nil {
+		return l, errors.Wrap(err, "revoke: failed to read issuer of revocation list")
+	}
+
+	if l.Serial, err = reader.ReadUint64(); err != nil {
+		return l, errors.Wrap(err, "revoke: failed to read serial number of revocation list")
+	}
+
+	issued, err := reader.ReadUint64()
+	if err != nil {
+		return l, errors.Wrap(err, "revoke: failed to read when revocation list was issued")
+	}
+
+	l.Issued = time.Unix(0, int64(issued))
+
+	count, err := reader.ReadUint32()
+	if err != nil {
+		return l, errors.Wrap(err, "revoke: failed to read number of keys revoked")
+	}
+
+	// Every key takes at least the four bytes prefixing its length.
+	if int(count) > reader.Len()/4 {
+		return l, errors.Errorf("revoke: revocation list claims to revoke %d keys, yet is too short to", count)
+	}
+
+	for i := 0; i < int(count); i++ {
+		key, err := reader.ReadBytes()
+		if err != nil {
+			return l, errors.Wrap(err, "revoke: failed to read key revoked")
+		}
+
+		l.Keys = append(l.Keys, key)
+	}
+
+	return l, nil
+}
+
+func (l List) body() []byte {
+	writer := payload.NewWriter(nil)
+
+	writer.WriteBytes(l.Issuer)
+	writer.WriteUint64(l.Serial)
+	writer.WriteUint64(uint64(l.Issued.UnixNano()))
+	writer.WriteUint32(uint32(len(l.Keys)))
+
+	for _, key := range l.Keys {
+		writer.WriteBytes(key)
+	}
+
+	return writer.Bytes()
+}
+
+func (l List) signingPayload() []byte {
+	return append([]byte(signingContext), l.body()...)
+}
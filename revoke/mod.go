@@ -0,0 +1,297 @@
+// Package revoke distributes lists of node keys revoked by the operators of a network, such that a
+// compromised key is refused by every node of the network within moments of being revoked.
+//
+// Operators sign lists of revoked keys with keys our nodes trust as issuers, and publish them over
+// pubsub. Nodes verify lists as they are gossiped, disconnect any peer whose key a list revokes, and
+// refuse peers with revoked keys from then on.
+package revoke
+
+import (
+	"bytes"
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/handshake/cert"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/pubsub"
+	"github.com/perlin-network/noise/signature"
+	"github.com/perlin-network/noise/signature/eddsa"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+const (
+	// Topic is the pubsub topic revocation lists are published to.
+	Topic = "noise.revocations"
+
+	// keyLists names the section of state revocation lists are exported to.
+	keyLists = "revoke.lists"
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrRevoked   = errors.New("revoke: key is revoked")
+	ErrUntrusted = errors.New("revoke: revocation list is not issued by a trusted issuer")
+	ErrStale     = errors.New("revoke: revocation list is superseded by one already applied")
+)
+
+type block struct {
+	scheme  signature.Scheme
+	issuers [][]byte
+
+	sync.RWMutex
+	lists   map[string]List
+	revoked map[string]struct{}
+	peers   map[*noise.Peer]struct{}
+}
+
+// New returns a block which refuses peers whose keys are revoked by lists signed by any of the given
+// issuers, and disconnects peers as lists revoking their keys are applied.
+//
+// The keys of a peer are those it identified itself with through blocks registered before this
+// block, such as S/Kademlia, alongside every key of the certificate chain it presented through the
+// `handshake/cert` block. Lists are signed over Ed25519 by default.
+func New(issuers ...[]byte) *block {
+	return &block{
+		scheme:  eddsa.New(),
+		issuers: issuers,
+		lists:   make(map[string]List),
+		revoked: make(map[string]struct{}),
+		peers:   make(map[*noise.Peer]struct{}),
+	}
+}
+
+// WithSignatureScheme sets the signature scheme lists are signed over.
+func (b *block) WithSignatureScheme(scheme signature.Scheme) *block {
+	b.scheme = scheme
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	node.RegisterState(keyLists, b.export, b.restore)
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.revokedLocked(keysOf(peer)...) {
+		return errors.Wrap(protocol.DisconnectWith(ErrRevoked), "revoke: refused peer whose key is revoked")
+	}
+
+	b.peers[peer] = struct{}{}
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		b.Lock()
+		delete(b.peers, peer)
+		b.Unlock()
+
+		return nil
+	})
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Apply applies a list, should it be signed by a trusted issuer and supersede the last list applied
+// of its issuer, and disconnects all peers whose keys it revokes. It returns ErrStale should the
+// list be superseded.
+func (b *block) Apply(l List) error {
+	trusted := false
+
+	for _, issuer := range b.issuers {
+		if bytes.Equal(issuer, l.Issuer) {
+			trusted = true
+			break
+		}
+	}
+
+	if !trusted {
+		return ErrUntrusted
+	}
+
+	if err := l.Verify(b.scheme); err != nil {
+		return errors.Wrap(ErrUntrusted, err.Error())
+	}
+
+	b.Lock()
+
+	if last, exists := b.lists[string(l.Issuer)]; exists && last.Serial >= l.Serial {
+		b.Unlock()
+		return errors.Wrapf(ErrStale, "got list %d, when list %d was applied already", l.Serial, last.Serial)
+	}
+
+	b.lists[string(l.Issuer)] = l
+
+	b.revoked = make(map[string]struct{})
+
+	for _, list := range b.lists {
+		for _, key := range list.Keys {
+			b.revoked[string(key)] = struct{}{}
+		}
+	}
+
+	var evicted []*noise.Peer
+
+	for peer := range b.peers {
+		if b.revokedLocked(keysOf(peer)...) {
+			evicted = append(evicted, peer)
+		}
+	}
+
+	b.Unlock()
+
+	for _, peer := range evicted {
+		peer.DisconnectWithReason(noise.ReasonBanned)
+	}
+
+	log.Info().
+		Hex("issuer", l.Issuer).
+		Uint64("serial", l.Serial).
+		Int("num_keys", len(l.Keys)).
+		Int("num_disconnected", len(evicted)).
+		Msg("Applied revocation list.")
+
+	return nil
+}
+
+// Revoked reports whether a key is revoked by any list applied.
+func (b *block) Revoked(key []byte) bool {
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.revokedLocked(key)
+}
+
+func (b *block) revokedLocked(keys ...[]byte) bool {
+	for _, key := range keys {
+		if _, revoked := b.revoked[string(key)]; revoked {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validator returns a validator to be registered for Topic, which applies lists as they are
+// gossiped. Lists which fail to be verified are rejected, and lists which are superseded are
+// ignored, such that they are not propagated any further.
+func (b *block) Validator() pubsub.Validator {
+	return func(ctx context.Context, peer *noise.Peer, msg pubsub.Gossip) pubsub.Result {
+		l, err := Unmarshal(msg.Data)
+		if err != nil {
+			return pubsub.Reject
+		}
+
+		if err := b.Apply(l); err != nil {
+			if errors.Is(err, ErrStale) {
+				return pubsub.Ignore
+			}
+
+			log.Warn().Err(err).Msg("Rejected a revocation list.")
+			return pubsub.Reject
+		}
+
+		return pubsub.Accept
+	}
+}
+
+// Senders returns a validator which rejects messages published by revoked keys, to be registered
+// for any topic whose messages are signed.
+func (b *block) Senders() pubsub.Validator {
+	return func(ctx context.Context, peer *noise.Peer, msg pubsub.Gossip) pubsub.Result {
+		if msg.Signed() && b.Revoked(msg.From) {
+			return pubsub.Reject
+		}
+
+		return pubsub.Accept
+	}
+}
+
+// Verifier returns a verifier for the `handshake/cert` block, which refuses certificate chains
+// holding any revoked key, such that revoking the key of an intermediate CA revokes every
+// certificate it issued.
+func (b *block) Verifier() cert.Verifier {
+	return func(peer *noise.Peer, chain []cert.Certificate) error {
+		for _, c := range chain {
+			if b.Revoked(c.Subject) || b.Revoked(c.Issuer) {
+				return ErrRevoked
+			}
+		}
+
+		return nil
+	}
+}
+
+// Publish publishes a list over pubsub to all nodes of the network, and applies it to our own node.
+// The pubsub block registered to our node must have the validator of the block registered for
+// Topic.
+func Publish(node *noise.Node, l List) error {
+	return pubsub.Publish(node, Topic, l.Marshal())
+}
+
+// export writes the last list applied of every issuer, such that lists applied are kept across
+// restarts of our node.
+func (b *block) export(node *noise.Node) ([]byte, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	writer := payload.NewWriter(nil).WriteUint32(uint32(len(b.lists)))
+
+	for _, l := range b.lists {
+		writer.WriteBytes(l.Marshal())
+	}
+
+	return writer.Bytes(), nil
+}
+
+// restore applies the lists exported by export anew. Lists which are superseded by those applied
+// since are skipped.
+func (b *block) restore(node *noise.Node, buf []byte) error {
+	reader := payload.NewReader(buf)
+
+	count, err := reader.ReadUint32()
+	if err != nil {
+		return errors.Wrap(err, "revoke: failed to read number of revocation lists")
+	}
+
+	for i := 0; i < int(count); i++ {
+		raw, err := reader.ReadBytes()
+		if err != nil {
+			return errors.Wrap(err, "revoke: failed to read revocation list")
+		}
+
+		l, err := Unmarshal(raw)
+		if err != nil {
+			return err
+		}
+
+		if err := b.Apply(l); err != nil && !errors.Is(err, ErrStale) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keysOf returns the keys a peer identified itself with.
+func keysOf(peer *noise.Peer) [][]byte {
+	var keys [][]byte
+
+	if protocol.HasPeerID(peer) {
+		if id := protocol.PeerID(peer); id != nil {
+			keys = append(keys, id.PublicKey())
+		}
+	}
+
+	for _, c := range cert.Of(peer) {
+		keys = append(keys, c.Subject, c.Issuer)
+	}
+
+	return keys
+}
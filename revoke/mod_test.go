@@ -0,0 +1,154 @@
+package revoke
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/cipher/aead"
+	"github.com/perlin-network/noise/handshake/cert"
+	"github.com/perlin-network/noise/handshake/ecdh"
+	"github.com/perlin-network/noise/identity/ed25519"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/pubsub"
+	"github.com/perlin-network/noise/signature/eddsa"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var scheme = eddsa.New()
+
+func TestList(t *testing.T) {
+	operator := ed25519.RandomKeys()
+	keys := [][]byte{ed25519.RandomKeys().PublicKey(), ed25519.RandomKeys().PublicKey()}
+
+	l, err := Sign(scheme, operator.PublicKey(), operator.PrivateKey(), 1, time.Now(), keys)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Verify(scheme))
+
+	decoded, err := Unmarshal(l.Marshal())
+	assert.NoError(t, err)
+	assert.NoError(t, decoded.Verify(scheme))
+	assert.Equal(t, keys, decoded.Keys)
+	assert.Equal(t, l.Serial, decoded.Serial)
+
+	// Lists which are tampered with fail to verify.
+	decoded.Keys = decoded.Keys[:1]
+	assert.Error(t, decoded.Verify(scheme))
+
+	_, err = Unmarshal(l.Marshal()[:len(l.Marshal())/2])
+	assert.Error(t, err)
+
+	b := New(operator.PublicKey())
+
+	assert.NoError(t, b.Apply(l))
+	assert.True(t, b.Revoked(keys[0]))
+	assert.True(t, errors.Is(b.Apply(l), ErrStale))
+
+	// Lists supersede those of the same issuer with lower serial numbers.
+	next, err := Sign(scheme, operator.PublicKey(), operator.PrivateKey(), 2, time.Now(), keys[1:])
+	assert.NoError(t, err)
+	assert.NoError(t, b.Apply(next))
+	assert.False(t, b.Revoked(keys[0]))
+	assert.True(t, b.Revoked(keys[1]))
+
+	// Lists of issuers which are not trusted are not applied.
+	stranger := ed25519.RandomKeys()
+
+	forged, err := Sign(scheme, stranger.PublicKey(), stranger.PrivateKey(), 3, time.Now(), keys[:1])
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(b.Apply(forged), ErrUntrusted))
+
+	forged.Issuer = operator.PublicKey()
+	assert.True(t, errors.Is(b.Apply(forged), ErrUntrusted))
+	assert.False(t, b.Revoked(keys[0]))
+
+	// Applied lists are kept across restarts.
+	restored := New(operator.PublicKey())
+
+	buf, err := b.export(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, restored.restore(nil, buf))
+	assert.True(t, restored.Revoked(keys[1]))
+}
+
+func TestRevoke(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	root, operator := ed25519.RandomKeys(), ed25519.RandomKeys()
+
+	newNode := func() (*noise.Node, *block) {
+		keys := ed25519.RandomKeys()
+
+		c, err := cert.Issue(scheme, root.PublicKey(), root.PrivateKey(), keys.PublicKey(), false, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+
+		params := noise.DefaultParams()
+		params.Transport = layer
+		params.Keys = keys
+
+		node, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		b := New(operator.PublicKey())
+
+		protocol.New().
+			Register(ecdh.New()).
+			Register(aead.New()).
+			Register(cert.New([]cert.Certificate{c}, root.PublicKey()).WithVerifier(b.Verifier())).
+			Register(b).
+			Register(pubsub.New().WithValidator(Topic, b.Validator())).
+			Enforce(node)
+
+		go node.Listen()
+
+		return node, b
+	}
+
+	alice, _ := newNode()
+	bob, revocations := newNode()
+	carol, _ := newNode()
+
+	defer alice.Kill()
+	defer bob.Kill()
+	defer carol.Kill()
+
+	var peers []*noise.Peer
+
+	for _, node := range []*noise.Node{alice, carol} {
+		peer, err := node.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+		assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+		peers = append(peers, peer)
+	}
+
+	// Alice publishes a list revoking the key of carol, which bob disconnects carol upon applying.
+	disconnected := make(chan struct{})
+
+	peers[1].OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	l, err := Sign(scheme, operator.PublicKey(), operator.PrivateKey(), 1, time.Now(), [][]byte{carol.Keys.PublicKey()})
+	assert.NoError(t, err)
+	assert.NoError(t, Publish(alice, l))
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not disconnect carol once the key of carol was revoked")
+	}
+
+	assert.True(t, revocations.Revoked(carol.Keys.PublicKey()))
+
+	// Carol is refused from then on.
+	peer, err := bob.Dial(carol.ExternalAddress())
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(protocol.WaitUntilEstablished(peer), ErrRevoked))
+}
@@ -0,0 +1,227 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/clock"
+	"math"
+	"sync"
+	"time"
+)
+
+const sendSchedulerMinQuantum = 512
+
+// sendScheduler fairly shares a nodes upload bandwidth cap across all of its peers through deficit
+// round robin (DRR) scheduling, such that a single high-volume peer is unable to monopolize the
+// nodes uplink.
+//
+// Before writing a message, a peers send worker requests for permission to write a number of bytes.
+// Whenever the nodes token bucket is not in debt, the next peer with a pending request is visited
+// in a round-robin order and credited a quantum of bytes. A peers request is granted once it has
+// accumulated enough credit to cover the size of the request.
+type sendScheduler struct {
+	sync.Mutex
+
+	clock clock.Clock
+
+	rate, burst float64
+
+	tokens float64
+	last   time.Time
+
+	active []*sendQueue
+	queues map[*Peer]*sendQueue
+
+	wake chan struct{}
+	stop chan struct{}
+}
+
+type sendQueue struct {
+	peer     *Peer
+	deficit  int
+	requests []*sendRequest
+}
+
+type sendRequest struct {
+	size    int
+	granted chan struct{}
+}
+
+// newSendScheduler returns a scheduler which caps the upload bandwidth of a node to a specified
+// number of bytes per second, with bursts of up to one seconds worth of bytes.
+func newSendScheduler(rate uint64, clock clock.Clock) *sendScheduler {
+	return &sendScheduler{
+		clock:  clock,
+		rate:   float64(rate),
+		burst:  float64(rate),
+		tokens: float64(rate),
+		last:   clock.Now(),
+		queues: make(map[*Peer]*sendQueue),
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+}
+
+// acquire blocks until a peer is granted permission to write a specified number of bytes. Should
+// the peer be disconnected while waiting, it returns the wait group its send worker was signalled
+// to stop with.
+func (s *sendScheduler) acquire(peer *Peer, size int) *sync.WaitGroup {
+	req := &sendRequest{size: size, granted: make(chan struct{})}
+
+	s.Lock()
+
+	queue, exists := s.queues[peer]
+	if !exists {
+		queue = &sendQueue{peer: peer}
+
+		s.queues[peer] = queue
+		s.active = append(s.active, queue)
+	}
+
+	queue.requests = append(queue.requests, req)
+
+	s.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-req.granted:
+		return nil
+	case wg := <-peer.kill:
+		s.cancel(peer, req)
+		return wg
+	}
+}
+
+// cancel withdraws a request that has not yet been granted.
+func (s *sendScheduler) cancel(peer *Peer, req *sendRequest) {
+	s.Lock()
+	defer s.Unlock()
+
+	queue, exists := s.queues[peer]
+	if !exists {
+		return
+	}
+
+	for i, pending := range queue.requests {
+		if pending == req {
+			queue.requests = append(queue.requests[:i], queue.requests[i+1:]...)
+			break
+		}
+	}
+
+	if len(queue.requests) > 0 {
+		return
+	}
+
+	delete(s.queues, peer)
+
+	for i, active := range s.active {
+		if active == queue {
+			s.active = append(s.active[:i], s.active[i+1:]...)
+			break
+		}
+	}
+}
+
+func (s *sendScheduler) run() {
+	for {
+		// Wait for tokens before visiting a peer, such that peers which were just granted a request
+		// have a chance to queue up their next request before the next peer is visited.
+		if !s.waitForTokens() {
+			return
+		}
+
+		s.Lock()
+
+		if len(s.active) == 0 {
+			s.Unlock()
+
+			select {
+			case <-s.wake:
+				continue
+			case <-s.stop:
+				return
+			}
+		}
+
+		quantum := s.quantum()
+
+		queue := s.active[0]
+		s.active = s.active[1:]
+
+		queue.deficit += quantum
+
+		for len(queue.requests) > 0 && queue.requests[0].size <= queue.deficit {
+			req := queue.requests[0]
+
+			queue.deficit -= req.size
+			queue.requests = queue.requests[1:]
+
+			s.tokens -= float64(req.size)
+			close(req.granted)
+		}
+
+		if len(queue.requests) > 0 {
+			s.active = append(s.active, queue)
+		} else {
+			delete(s.queues, queue.peer)
+		}
+
+		s.Unlock()
+	}
+}
+
+// quantum returns the number of bytes credited to a peer per visit, which is the size of the
+// smallest request presently pending. As each peer only ever has a single request pending at a
+// time, crediting any more would let peers sending large messages out-send peers sending small
+// messages.
+func (s *sendScheduler) quantum() int {
+	quantum := math.MaxInt32
+
+	for _, queue := range s.active {
+		if len(queue.requests) > 0 && queue.requests[0].size < quantum {
+			quantum = queue.requests[0].size
+		}
+	}
+
+	if quantum < sendSchedulerMinQuantum {
+		quantum = sendSchedulerMinQuantum
+	}
+
+	return quantum
+}
+
+// waitForTokens blocks until the token bucket is no longer in debt. Requests are granted so long
+// as the bucket is not in debt, which would leave the bucket in debt for requests larger than the
+// number of tokens left. It returns false should the scheduler be stopped while waiting.
+func (s *sendScheduler) waitForTokens() bool {
+	for {
+		s.Lock()
+
+		now := s.clock.Now()
+
+		s.tokens = math.Min(s.burst, s.tokens+now.Sub(s.last).Seconds()*s.rate)
+		s.last = now
+
+		if s.tokens > 0 {
+			s.Unlock()
+			return true
+		}
+
+		wait := time.Duration((1 - s.tokens) / s.rate * float64(time.Second))
+
+		s.Unlock()
+
+		select {
+		case <-s.clock.After(wait):
+		case <-s.stop:
+			return false
+		}
+	}
+}
+
+func (s *sendScheduler) close() {
+	close(s.stop)
+}
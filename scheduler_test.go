@@ -0,0 +1,126 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendSchedulerFairness(t *testing.T) {
+	scheduler := newSendScheduler(1<<20, clock.New())
+	go scheduler.run()
+	defer scheduler.close()
+
+	heavy, light := newPeer(nil, nil), newPeer(nil, nil)
+
+	// Drain the initial burst, such that both peers contend for bandwidth from the start.
+	assert.Nil(t, scheduler.acquire(newPeer(nil, nil), 1<<20))
+
+	var heavyBytes, lightBytes uint64
+	var wg sync.WaitGroup
+
+	stop := make(chan struct{})
+
+	write := func(peer *Peer, size int, counter *uint64) {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			if scheduler.acquire(peer, size) != nil {
+				return
+			}
+
+			atomic.AddUint64(counter, uint64(size))
+		}
+	}
+
+	wg.Add(2)
+
+	// The heavy peer sends messages 16 times larger than the light peer.
+	go write(heavy, 65536, &heavyBytes)
+	go write(light, 4096, &lightBytes)
+
+	time.Sleep(500 * time.Millisecond)
+	close(stop)
+
+	for _, peer := range []*Peer{heavy, light} {
+		var killed sync.WaitGroup
+		killed.Add(1)
+
+		go func(peer *Peer) { peer.kill <- &killed }(peer)
+
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-waitGroupDone(&killed):
+		}
+	}
+
+	wg.Wait()
+
+	h, l := atomic.LoadUint64(&heavyBytes), atomic.LoadUint64(&lightBytes)
+
+	assert.True(t, h+l <= 1<<20, "sent %d bytes when at most %d bytes should be sent", h+l, 1<<20)
+	assert.True(t, l*2 >= h && h*2 >= l, "bandwidth was not fairly shared; heavy peer sent %d bytes, light peer sent %d bytes", h, l)
+}
+
+func waitGroupDone(wg *sync.WaitGroup) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return done
+}
+
+func TestMaxUploadRate(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	opcodeTest := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+	params.MaxUploadRate = 4096
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go alice.Listen()
+	go bob.Listen()
+
+	bob.OnMessageReceived(opcodeTest, func(node *Node, opcode Opcode, peer *Peer, message Message) error {
+		return nil
+	})
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	text := string(make([]byte, 2048))
+	start := time.Now()
+
+	// The first 4096 bytes are sent as a burst, with the remaining 4096 bytes sent within
+	// approximately a second afterwards.
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, peer.SendMessage(testMsg{Text: text}))
+	}
+
+	assert.True(t, time.Since(start) > 500*time.Millisecond)
+}
@@ -0,0 +1,81 @@
+package noise
+
+import (
+	"context"
+	"hash/fnv"
+	"runtime"
+)
+
+// shardQueueSize is how many messages may be queued up for a single shard, before peers receive
+// loops block on handing it messages.
+const shardQueueSize = 64
+
+// ShardKey extracts the key a message received from a peer is handled under, such as the ID of the
+// account the message acts upon. Messages under the same key are handled one at a time in the order
+// they were received, while messages under different keys may be handled in parallel.
+type ShardKey func(peer *Peer, message Message) []byte
+
+// ShardBy has messages of a specified opcode handled on one of `params.HandlerShards` shards picked
+// by a key extracted from them, rather than by the receive loop of the peer which sent them. It
+// replaces locks callbacks would otherwise have to hold around state keyed the same way, such as
+// locks over accounts.
+//
+// Messages under the same key, whichever peers they were received from, are handled by the same
+// shard in the order they were received. Messages under different keys may be handled in parallel,
+// even should they be from the same peer, and so messages of a sharded opcode are no longer handled
+// in order with messages of other opcodes from the same peer. Should too many messages be queued up
+// for a shard, receiving messages from peers blocks until the shard catches up.
+//
+// Callbacks registered through `OnMessageReceived` handle sharded messages as before, with timeouts,
+// errors, and panics treated alike. A nil key has messages of the opcode handled by the receive loop
+// of their peer again.
+func (n *Node) ShardBy(opcode Opcode, key ShardKey) {
+	if key == nil {
+		n.shardKeys.Delete(opcode)
+		return
+	}
+
+	n.shardsOnce.Do(n.startShards)
+	n.shardKeys.Store(opcode, key)
+}
+
+// startShards spawns a goroutine per shard, which handles messages queued up for the shard until our
+// node is killed.
+func (n *Node) startShards() {
+	count := n.handlerShards
+	if count <= 0 {
+		count = runtime.NumCPU()
+	}
+
+	n.shards = make([]chan func(), count)
+
+	for i := range n.shards {
+		queue := make(chan func(), shardQueueSize)
+		n.shards[i] = queue
+
+		n.group.Go(func(ctx context.Context) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case handle := <-queue:
+					handle()
+				}
+			}
+		})
+	}
+}
+
+// shard returns the queue of the shard a message is to be handled on, or nil should its opcode not
+// be sharded.
+func (n *Node) shard(opcode Opcode, peer *Peer, message Message) chan<- func() {
+	key, exists := n.shardKeys.Load(opcode)
+	if !exists {
+		return nil
+	}
+
+	h := fnv.New64a()
+	h.Write(key.(ShardKey)(peer, message))
+
+	return n.shards[h.Sum64()%uint64(len(n.shards))]
+}
@@ -0,0 +1,141 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardBy(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	resetOpcodes()
+	opcodeTest := RegisterMessage(NextAvailableOpcode(), (*testMsg)(nil))
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+	params.HandlerShards = 16
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	go bob.Listen()
+
+	// Messages are keyed by the first letter of their text.
+	bob.ShardBy(opcodeTest, func(peer *Peer, message Message) []byte {
+		return []byte(message.(testMsg).Text[:1])
+	})
+
+	var mu sync.Mutex
+	var received []string
+
+	var running, overlapped int32
+
+	release := make(chan struct{})
+	done := make(chan struct{}, 16)
+
+	bob.OnMessageReceived(opcodeTest, func(node *Node, opcode Opcode, peer *Peer, message Message) error {
+		text := message.(testMsg).Text
+
+		switch text[0] {
+		case 'a':
+			// Messages under the same key are never handled at once.
+			if atomic.AddInt32(&running, 1) > 1 {
+				atomic.StoreInt32(&overlapped, 1)
+			}
+
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		case 'x':
+			<-release
+		case 'y':
+			close(release)
+		}
+
+		mu.Lock()
+		received = append(received, text)
+		mu.Unlock()
+
+		done <- struct{}{}
+		return nil
+	})
+
+	dial := func() *Peer {
+		node, err := NewNode(params)
+		assert.NoError(t, err)
+
+		go node.Listen()
+
+		peer, err := node.Dial(bob.ExternalAddress())
+		assert.NoError(t, err)
+
+		return peer
+	}
+
+	alice, carol := dial(), dial()
+	defer alice.Node().Kill()
+	defer carol.Node().Kill()
+
+	wait := func(n int) {
+		for i := 0; i < n; i++ {
+			select {
+			case <-done:
+			case <-time.After(3 * time.Second):
+				t.Fatalf("bob only handled %d of %d messages", i, n)
+			}
+		}
+	}
+
+	// Messages under the same key from different peers are handled one at a time, in order.
+	var wg sync.WaitGroup
+
+	for _, peer := range []*Peer{alice, carol} {
+		peer := peer
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for _, text := range []string{"a1", "a2", "a3", "a4"} {
+				assert.NoError(t, peer.SendMessage(testMsg{Text: text + peer.Node().ExternalAddress()}))
+			}
+		}()
+	}
+
+	wg.Wait()
+	wait(8)
+
+	assert.EqualValues(t, 0, atomic.LoadInt32(&overlapped))
+
+	mu.Lock()
+	for _, peer := range []*Peer{alice, carol} {
+		var order []string
+
+		for _, text := range received {
+			if text[2:] == peer.Node().ExternalAddress() {
+				order = append(order, text[:2])
+			}
+		}
+
+		assert.Equal(t, []string{"a1", "a2", "a3", "a4"}, order)
+	}
+	received = nil
+	mu.Unlock()
+
+	// Messages under different keys from the same peer are handled in parallel, such that a message
+	// blocked on another message sent after it does not stall it.
+	assert.NoError(t, alice.SendMessage(testMsg{Text: "x"}))
+	assert.NoError(t, alice.SendMessage(testMsg{Text: "y"}))
+
+	wait(2)
+
+	mu.Lock()
+	assert.Equal(t, []string{"y", "x"}, received)
+	mu.Unlock()
+}
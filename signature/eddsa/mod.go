@@ -6,7 +6,10 @@ import (
 	"github.com/pkg/errors"
 )
 
-var _ signature.Scheme = (*policy)(nil)
+var (
+	_ signature.Scheme        = (*policy)(nil)
+	_ signature.BatchVerifier = (*policy)(nil)
+)
 
 type policy struct{}
 
@@ -18,6 +21,14 @@ func (p policy) Verify(publicKeyBuf, messageBuf, signatureBuf []byte) error {
 	return Verify(publicKeyBuf, messageBuf, signatureBuf)
 }
 
+func (p policy) VerifyBatch(publicKeyBufs, messageBufs, signatureBufs [][]byte) []error {
+	return VerifyBatch(publicKeyBufs, messageBufs, signatureBufs)
+}
+
+func (p policy) VerifyOne(publicKeyBuf, messageBuf, signatureBuf []byte) error {
+	return VerifyCofactored(publicKeyBuf, messageBuf, signatureBuf)
+}
+
 func New() *policy {
 	return new(policy)
 }
@@ -41,3 +52,64 @@ func Verify(publicKeyBuf, messageBuf, signature []byte) error {
 		return errors.New("unable to verify signature")
 	}
 }
+
+// VerifyCofactored verifies a signature under the cofactored verification equation, as VerifyBatch
+// does, following the rules of ZIP-215 which ed25519consensus implements. Signatures produced by
+// Sign are verified alike by both Verify and VerifyCofactored, yet signatures crafted to be offset
+// by a point of small order are only verified by VerifyCofactored.
+func VerifyCofactored(publicKeyBuf, messageBuf, signature []byte) error {
+	if len(publicKeyBuf) != edwards25519.PublicKeySize {
+		return errors.Errorf("edwards25519: public key expected to be %d bytes, but is %d bytes", edwards25519.PublicKeySize, len(publicKeyBuf))
+	}
+
+	if edwards25519.VerifyCofactored(publicKeyBuf, messageBuf, signature) {
+		return nil
+	} else {
+		return errors.New("unable to verify signature")
+	}
+}
+
+// VerifyBatch verifies many signatures at once, returning an error for every signature which fails
+// to be verified. Should the batch fail to be verified as a whole, signatures are verified one by
+// one through VerifyCofactored to find out which of them are invalid.
+//
+// Signatures are verified under the cofactored verification equation, as opposed to Verify, such
+// that whether a signature is verified does not depend on which signatures it is batched with.
+func VerifyBatch(publicKeyBufs, messageBufs, signatureBufs [][]byte) []error {
+	errs := make([]error, len(signatureBufs))
+
+	if len(publicKeyBufs) != len(signatureBufs) || len(messageBufs) != len(signatureBufs) {
+		for i := range errs {
+			errs[i] = errors.Errorf("edwards25519: got %d public keys and %d messages for %d signatures", len(publicKeyBufs), len(messageBufs), len(signatureBufs))
+		}
+
+		return errs
+	}
+
+	publicKeys := make([]edwards25519.PublicKey, 0, len(signatureBufs))
+	messages := make([][]byte, 0, len(signatureBufs))
+	signatures := make([][]byte, 0, len(signatureBufs))
+	indices := make([]int, 0, len(signatureBufs))
+
+	for i := range signatureBufs {
+		if len(publicKeyBufs[i]) != edwards25519.PublicKeySize {
+			errs[i] = errors.Errorf("edwards25519: public key expected to be %d bytes, but is %d bytes", edwards25519.PublicKeySize, len(publicKeyBufs[i]))
+			continue
+		}
+
+		publicKeys = append(publicKeys, publicKeyBufs[i])
+		messages = append(messages, messageBufs[i])
+		signatures = append(signatures, signatureBufs[i])
+		indices = append(indices, i)
+	}
+
+	if edwards25519.VerifyBatch(publicKeys, messages, signatures) {
+		return errs
+	}
+
+	for j, i := range indices {
+		errs[i] = VerifyCofactored(publicKeys[j], messages[j], signatures[j])
+	}
+
+	return errs
+}
@@ -69,3 +69,46 @@ func TestSignAndVerify(t *testing.T) {
 		return true
 	}, nil)
 }
+
+func TestVerifyBatch(t *testing.T) {
+	scheme := New()
+
+	var publicKeys, messages, signatures [][]byte
+
+	for i := 0; i < 16; i++ {
+		publicKey, privateKey, err := edwards25519.GenerateKey(nil)
+		assert.NoError(t, err)
+
+		message := []byte{byte(i)}
+
+		signature, err := Sign(privateKey, message)
+		assert.NoError(t, err)
+
+		publicKeys = append(publicKeys, publicKey)
+		messages = append(messages, message)
+		signatures = append(signatures, signature)
+	}
+
+	for _, err := range scheme.VerifyBatch(publicKeys, messages, signatures) {
+		assert.NoError(t, err)
+	}
+
+	// Invalid signatures are singled out once the batch fails to be verified.
+	publicKeys[3] = []byte("this is a bad key")
+	messages[7] = []byte("this is a different message")
+
+	for i, err := range VerifyBatch(publicKeys, messages, signatures) {
+		if i == 3 || i == 7 {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		// Signatures are verified alike whether batched or not.
+		assert.Equal(t, err == nil, scheme.VerifyOne(publicKeys[i], messages[i], signatures[i]) == nil)
+	}
+
+	for _, err := range VerifyBatch(publicKeys[:1], messages, signatures) {
+		assert.Error(t, err)
+	}
+}
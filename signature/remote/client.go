@@ -0,0 +1,201 @@
+package remote
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/perlin-network/noise/identity"
+	"github.com/perlin-network/noise/signature"
+	"github.com/pkg/errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	_ signature.Scheme = (*Client)(nil)
+	_ identity.Keypair = (*Keypair)(nil)
+)
+
+// DefaultRequestTimeout is how long a client waits for a signer to respond to a request.
+const DefaultRequestTimeout = 10 * time.Second
+
+// Client requests signatures from a signer daemon over a unix socket, such that a nodes private
+// key may live within a separate, hardened process.
+//
+// A Client implements signature.Scheme, and hence may be provided to protocol blocks that sign
+// messages in place of a local signature scheme. The private key passed to Sign is ignored.
+type Client struct {
+	sync.Mutex
+
+	conn    net.Conn
+	path    string
+	timeout time.Duration
+	closed  bool
+
+	verifier signature.Scheme
+}
+
+// Dial connects to a signer listening on a unix socket located at path. Signatures are verified
+// locally by a signature scheme.
+//
+// Should the connection to the signer break, such as when the signer is restarted, the client
+// reconnects to the signer on its next request.
+func Dial(path string, verifier signature.Scheme) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "remote: failed to connect to signer at %q", path)
+	}
+
+	client := NewClient(conn, verifier)
+	client.path = path
+
+	return client, nil
+}
+
+// NewClient instantiates a client over an existing connection to a signer. The client is unable to
+// reconnect to the signer should the connection break.
+func NewClient(conn net.Conn, verifier signature.Scheme) *Client {
+	return &Client{conn: conn, timeout: DefaultRequestTimeout, verifier: verifier}
+}
+
+// WithRequestTimeout sets how long the client waits for the signer to respond to a request.
+func (c *Client) WithRequestTimeout(timeout time.Duration) *Client {
+	c.Lock()
+	c.timeout = timeout
+	c.Unlock()
+
+	return c
+}
+
+func (c *Client) request(kind byte, body []byte) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.closed {
+		return nil, errors.New("remote: client closed")
+	}
+
+	if c.conn != nil {
+		res, broken, err := c.roundTrip(kind, body)
+		if !broken {
+			return res, err
+		}
+
+		c.conn.Close()
+		c.conn = nil
+
+		if c.path == "" {
+			return nil, err
+		}
+	}
+
+	if c.path == "" {
+		return nil, errors.New("remote: connection to signer is closed")
+	}
+
+	conn, err := net.Dial("unix", c.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "remote: failed to reconnect to signer at %q", c.path)
+	}
+
+	c.conn = conn
+
+	res, broken, err := c.roundTrip(kind, body)
+	if broken {
+		c.conn.Close()
+		c.conn = nil
+	}
+
+	return res, err
+}
+
+// roundTrip sends a request to the signer and reads its response. It reports whether the connection
+// to the signer broke, in which case it may no longer be used.
+func (c *Client) roundTrip(kind byte, body []byte) ([]byte, bool, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, true, errors.Wrap(err, "remote: failed to set request deadline")
+	}
+
+	if err := writeFrame(c.conn, kind, body); err != nil {
+		return nil, true, errors.Wrap(err, "remote: failed to send request to signer")
+	}
+
+	status, res, err := readFrame(c.conn)
+	if err != nil {
+		return nil, true, errors.Wrap(err, "remote: failed to read response from signer")
+	}
+
+	if status != responseOK {
+		return nil, false, errors.Errorf("remote: signer responded with an error: %s", res)
+	}
+
+	return res, false, nil
+}
+
+// PublicKey requests for the public key the signer signs messages with.
+func (c *Client) PublicKey() ([]byte, error) {
+	return c.request(requestPublicKey, nil)
+}
+
+// Keys requests for the public key of the signer, and returns a keypair which may be used as a
+// nodes identity. The keypair holds no private key.
+//
+// Nodes using S/Kademlia should instead load the public key of the signer through
+// `skademlia.LoadPublicKey(publicKey, c1, c2)`.
+func (c *Client) Keys() (*Keypair, error) {
+	publicKey, err := c.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Keypair{publicKey: publicKey}, nil
+}
+
+// Sign requests for the signer to sign a message. The private key provided is ignored.
+func (c *Client) Sign(privateKey, messageBuf []byte) ([]byte, error) {
+	return c.request(requestSign, messageBuf)
+}
+
+// Verify verifies a signature locally using the clients signature scheme.
+func (c *Client) Verify(publicKeyBuf, messageBuf, signatureBuf []byte) error {
+	return c.verifier.Verify(publicKeyBuf, messageBuf, signatureBuf)
+}
+
+// Close disconnects from the signer. The client does not reconnect to the signer afterwards.
+func (c *Client) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.closed = true
+
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+
+	return err
+}
+
+// Keypair is the identity of a node whose private key is held by a remote signer.
+type Keypair struct {
+	publicKey []byte
+}
+
+func (p *Keypair) ID() []byte {
+	return p.publicKey
+}
+
+func (p *Keypair) PublicKey() []byte {
+	return p.publicKey
+}
+
+// PrivateKey returns nil, as the private key never leaves the remote signer.
+func (p *Keypair) PrivateKey() []byte {
+	return nil
+}
+
+func (p *Keypair) String() string {
+	return fmt.Sprintf("Remote(public: %s)", hex.EncodeToString(p.PublicKey()))
+}
@@ -0,0 +1,303 @@
+package remote
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/identity/ed25519"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/signature/eddsa"
+	"github.com/perlin-network/noise/skademlia"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoteSigner(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	dir, err := ioutil.TempDir("", "signer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "signer.sock")
+	keys := ed25519.RandomKeys()
+
+	server := NewServer(keys, eddsa.New())
+
+	served := make(chan error, 1)
+	go func() { served <- server.ListenAndServe(path) }()
+
+	var client *Client
+
+	for i := 0; i < 100; i++ {
+		if client, err = Dial(path, eddsa.New()); err == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.NoError(t, err)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0600, info.Mode().Perm())
+
+	// The socket is bound elsewhere and moved over to path, leaving nothing else behind.
+	entries, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	remoteKeys, err := client.Keys()
+	assert.NoError(t, err)
+	assert.EqualValues(t, keys.PublicKey(), remoteKeys.PublicKey())
+	assert.Nil(t, remoteKeys.PrivateKey())
+
+	message := []byte("handshake")
+
+	sig, err := client.Sign(remoteKeys.PrivateKey(), message)
+	assert.NoError(t, err)
+	assert.NoError(t, client.Verify(keys.PublicKey(), message, sig))
+	assert.Error(t, client.Verify(keys.PublicKey(), []byte("tampered"), sig))
+
+	// Requests fail once the signer is shut down.
+	assert.NoError(t, server.Close())
+	assert.NoError(t, <-served)
+
+	_, err = os.Lstat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = client.Sign(nil, message)
+	assert.Error(t, err)
+
+	assert.NoError(t, client.Close())
+}
+
+type testMsg struct {
+	text string
+}
+
+func (testMsg) Read(reader payload.Reader) (noise.Message, error) {
+	text, err := reader.ReadString()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read test message")
+	}
+
+	return testMsg{text: text}, nil
+}
+
+func (m testMsg) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.text).Bytes()
+}
+
+func serve(t *testing.T, server *Server, path string) <-chan error {
+	served := make(chan error, 1)
+	go func() { served <- server.ListenAndServe(path) }()
+
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return served
+}
+
+func TestListenAndServeKeepsNonSockets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "signer.sock")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("not a socket"), 0600))
+
+	assert.Error(t, NewServer(ed25519.RandomKeys(), eddsa.New()).ListenAndServe(path))
+
+	contents, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "not a socket", string(contents))
+}
+
+func TestRemoteSignerReconnect(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	dir, err := ioutil.TempDir("", "signer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "signer.sock")
+	keys := ed25519.RandomKeys()
+
+	server := NewServer(keys, eddsa.New())
+	served := serve(t, server, path)
+
+	client, err := Dial(path, eddsa.New())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Sign(nil, []byte("before"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, server.Close())
+	assert.NoError(t, <-served)
+
+	// The client reconnects once the signer is restarted.
+	server = NewServer(keys, eddsa.New())
+	served = serve(t, server, path)
+
+	sig, err := client.Sign(nil, []byte("after"))
+	assert.NoError(t, err)
+	assert.NoError(t, client.Verify(keys.PublicKey(), []byte("after"), sig))
+
+	assert.NoError(t, server.Close())
+	assert.NoError(t, <-served)
+}
+
+func TestRemoteSignerNodeIdentity(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	dir, err := ioutil.TempDir("", "signer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "signer.sock")
+	keys := skademlia.NewKeys(1, 1)
+
+	server := NewServer(keys, eddsa.New())
+	served := serve(t, server, path)
+
+	signer, err := Dial(path, eddsa.New())
+	assert.NoError(t, err)
+	defer signer.Close()
+
+	publicKey, err := signer.PublicKey()
+	assert.NoError(t, err)
+
+	opcodeTest := noise.RegisterMessage(noise.NextAvailableOpcode(), (*testMsg)(nil))
+
+	layer := transport.NewBuffered()
+
+	setup := func(keys *skademlia.Keypair, scheme *Client) *noise.Node {
+		params := noise.DefaultParams()
+		params.Keys = keys
+		params.Transport = layer
+
+		node, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		block := skademlia.New().WithC1(1).WithC2(1)
+
+		if scheme != nil {
+			block.WithSignatureScheme(scheme)
+		} else {
+			block.WithSignatureScheme(eddsa.New())
+		}
+
+		p := protocol.New()
+		p.Register(block)
+		p.Enforce(node)
+
+		go node.Listen()
+
+		return node
+	}
+
+	// Alice's private key is only ever held by the signer.
+	aliceKeys, err := skademlia.LoadPublicKey(publicKey, 1, 1)
+	assert.NoError(t, err)
+	assert.Nil(t, aliceKeys.PrivateKey())
+
+	alice := setup(aliceKeys, signer)
+	defer alice.Kill()
+
+	bob := setup(skademlia.NewKeys(1, 1), nil)
+	defer bob.Kill()
+
+	received := make(chan string, 1)
+
+	bob.OnMessageReceived(opcodeTest, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		assert.EqualValues(t, publicKey, protocol.PeerID(peer).PublicKey())
+		received <- message.(testMsg).text
+		return nil
+	})
+
+	authenticate := func() *noise.Peer {
+		peer, err := alice.Dial(bob.ExternalAddress())
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		authenticated := make(chan struct{})
+		go func() {
+			skademlia.WaitUntilAuthenticated(peer)
+			close(authenticated)
+		}()
+
+		select {
+		case <-authenticated:
+		case <-time.After(3 * time.Second):
+			t.Fatal("alice failed to authenticate with bob")
+		}
+
+		return peer
+	}
+
+	peer := authenticate()
+
+	// Bob verifies signatures made by the signer on alice's behalf.
+	assert.NoError(t, peer.SendMessage(testMsg{text: "signed remotely"}))
+
+	select {
+	case text := <-received:
+		assert.Equal(t, "signed remotely", text)
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not receive alice's message")
+	}
+
+	disconnected := make(chan struct{})
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	// Should the signer be unavailable, alice disconnects from bob rather than crash.
+	assert.NoError(t, server.Close())
+	assert.NoError(t, <-served)
+
+	assert.Error(t, peer.SendMessage(testMsg{text: "unsigned"}))
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("alice did not disconnect from bob after failing to sign a message")
+	}
+
+	// Once the signer is back, alice may connect to bob again.
+	server = NewServer(keys, eddsa.New())
+	served = serve(t, server, path)
+
+	peer = authenticate()
+
+	assert.NoError(t, peer.SendMessage(testMsg{text: "signed again"}))
+
+	select {
+	case text := <-received:
+		assert.Equal(t, "signed again", text)
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not receive alice's message after the signer restarted")
+	}
+
+	assert.NoError(t, server.Close())
+	assert.NoError(t, <-served)
+}
@@ -0,0 +1,41 @@
+package remote
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"net"
+	"os"
+)
+
+// verifyPeer checks through SO_PEERCRED that a client connected over a unix socket runs as the
+// same user as we do.
+func verifyPeer(conn net.Conn) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return errors.Wrap(err, "remote: failed to access client socket")
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return errors.Wrap(err, "remote: failed to access client socket")
+	}
+
+	if credErr != nil {
+		return errors.Wrap(credErr, "remote: failed to read client credentials")
+	}
+
+	if int(cred.Uid) != os.Getuid() {
+		return errors.Errorf("remote: client runs as uid %d, rather than uid %d", cred.Uid, os.Getuid())
+	}
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package remote
+
+import (
+	"context"
+	"github.com/perlin-network/noise/identity"
+	"github.com/perlin-network/noise/internal/supervisor"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/signature"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Server is a signer daemon which holds a nodes private key, and signs messages on behalf of
+// clients connected to it over a unix socket. It exposes no way to retrieve the private key.
+type Server struct {
+	keys   identity.Keypair
+	scheme signature.Scheme
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+
+	// group tracks the goroutines serving clients, which Close waits on.
+	group *supervisor.Group
+}
+
+// NewServer instantiates a signer which signs messages with a keypair under a signature scheme.
+func NewServer(keys identity.Keypair, scheme signature.Scheme) *Server {
+	return &Server{
+		keys:      keys,
+		scheme:    scheme,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		group:     supervisor.New(nil),
+	}
+}
+
+// ListenAndServe listens on a unix socket located at path only accessible by its owner, and
+// serves clients connected to it. A stale socket left at path is removed beforehand, though any
+// other kind of file at path is left untouched.
+func (s *Server) ListenAndServe(path string) error {
+	info, err := os.Lstat(path)
+
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return errors.Wrapf(err, "remote: failed to stat %q", path)
+	case info.Mode()&os.ModeSocket == 0:
+		return errors.Errorf("remote: refusing to remove %q as it is not a socket", path)
+	default:
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "remote: failed to remove stale socket %q", path)
+		}
+	}
+
+	// The socket is bound within a directory only accessible by us, and only moved over to path once
+	// its permissions are restricted, such that no other user may connect to it in between.
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".signer")
+	if err != nil {
+		return errors.Wrapf(err, "remote: failed to create private directory to bind socket %q in", path)
+	}
+	defer os.RemoveAll(dir)
+
+	bound := filepath.Join(dir, "signer.sock")
+
+	listener, err := net.Listen("unix", bound)
+	if err != nil {
+		return errors.Wrapf(err, "remote: failed to listen on socket %q", path)
+	}
+
+	// The socket is unlinked from path once the server is done with it, rather than from where it
+	// was bound.
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := os.Chmod(bound, 0600); err != nil {
+		listener.Close()
+		return errors.Wrapf(err, "remote: failed to restrict permissions of socket %q", path)
+	}
+
+	if err := os.Rename(bound, path); err != nil {
+		listener.Close()
+		return errors.Wrapf(err, "remote: failed to move socket to %q", path)
+	}
+
+	_ = os.Remove(dir)
+	defer os.Remove(path)
+
+	return s.Serve(listener)
+}
+
+// Serve accepts and serves clients from a listener until the server is closed. On platforms which
+// expose the credentials of clients connected over unix sockets, such as Linux, clients running as
+// any user other than the one the server runs as are refused.
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		listener.Close()
+
+		return errors.New("remote: server closed")
+	}
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, listener)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+
+			if closed {
+				return nil
+			}
+
+			return errors.Wrap(err, "remote: failed to accept client")
+		}
+
+		if err := verifyPeer(conn); err != nil {
+			log.Warn().Err(err).Msg("Remote signer refused a client.")
+			conn.Close()
+
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+
+		// Clients are tracked while the server is locked, such that Close may not miss them.
+		s.group.Go(func(context.Context) error {
+			s.serveConn(conn)
+			return nil
+		})
+
+		s.mu.Unlock()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+
+		conn.Close()
+	}()
+
+	for {
+		kind, body, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+
+		switch kind {
+		case requestPublicKey:
+			err = writeFrame(conn, responseOK, s.keys.PublicKey())
+		case requestSign:
+			var sig []byte
+
+			if sig, err = s.scheme.Sign(s.keys.PrivateKey(), body); err != nil {
+				log.Warn().Err(err).Msg("Remote signer failed to sign a message.")
+				err = writeFrame(conn, responseError, []byte(err.Error()))
+			} else {
+				err = writeFrame(conn, responseOK, sig)
+			}
+		default:
+			err = writeFrame(conn, responseError, []byte(errors.Errorf("unknown request kind %d", kind).Error()))
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Close stops accepting clients, disconnects all connected clients, and waits until all of
+// them are released.
+func (s *Server) Close() error {
+	s.mu.Lock()
+
+	s.closed = true
+
+	for listener := range s.listeners {
+		listener.Close()
+	}
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	s.mu.Unlock()
+
+	s.group.Cancel()
+	_ = s.group.Wait()
+
+	return nil
+}
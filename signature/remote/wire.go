@@ -0,0 +1,57 @@
+package remote
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// Request and response frames exchanged between a signer and its clients are each comprised of a
+// single byte denoting its kind, followed by a 4-byte big-endian length-prefixed body.
+const (
+	requestPublicKey byte = 0x01
+	requestSign      byte = 0x02
+
+	responseOK    byte = 0x00
+	responseError byte = 0x01
+)
+
+// MaxFrameSize is the largest body a request or response frame may carry.
+const MaxFrameSize = 1 << 20
+
+func writeFrame(w io.Writer, kind byte, body []byte) error {
+	if len(body) > MaxFrameSize {
+		return errors.Errorf("remote: frame of %d bytes exceeds the maximum of %d bytes", len(body), MaxFrameSize)
+	}
+
+	buf := make([]byte, 5+len(body))
+
+	buf[0] = kind
+	binary.BigEndian.PutUint32(buf[1:5], uint32(len(body)))
+	copy(buf[5:], body)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+
+	if size > MaxFrameSize {
+		return 0, nil, errors.Errorf("remote: frame of %d bytes exceeds the maximum of %d bytes", size, MaxFrameSize)
+	}
+
+	body := make([]byte, size)
+
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+
+	return header[0], body, nil
+}
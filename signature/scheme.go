@@ -4,3 +4,17 @@ type Scheme interface {
 	Sign(privateKey, messageBuf []byte) ([]byte, error)
 	Verify(publicKeyBuf, messageBuf, signatureBuf []byte) error
 }
+
+// BatchVerifier is implemented by schemes which verify many signatures at once faster than they
+// verify them one by one.
+type BatchVerifier interface {
+	// VerifyBatch verifies signatureBufs[i] of messageBufs[i] by publicKeyBufs[i], and returns an
+	// error for every signature which fails to be verified, or nil for those which are verified.
+	VerifyBatch(publicKeyBufs, messageBufs, signatureBufs [][]byte) []error
+
+	// VerifyOne verifies a single signature under the same rules as VerifyBatch, which may accept
+	// signatures that Verify rejects. Callers which verify some signatures in batches must verify
+	// the rest through VerifyOne, such that no signature is accepted on one path yet rejected on
+	// the other.
+	VerifyOne(publicKeyBuf, messageBuf, signatureBuf []byte) error
+}
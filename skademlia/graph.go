@@ -0,0 +1,142 @@
+package skademlia
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/protocol"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Graph is a snapshot of the routing table of a node, for visualizing the topology of a network.
+// Every edge is from our node to an ID within its table. Edges to peers our node is connected to
+// are weighed by their round-trip time.
+//
+// Graphs marshal to JSON as is, and to DOT through DOT.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	// ID is the hex-encoded hash of the S/Kademlia ID of the node.
+	ID      string `json:"id"`
+	Address string `json:"address"`
+
+	// Bucket is the index of the bucket within our table which the node is held in. It is the
+	// length of the prefix the hash of the node shares with that of ours.
+	Bucket int  `json:"bucket"`
+	Self   bool `json:"self"`
+}
+
+type GraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+
+	// Connected is set should our node presently be connected to the target.
+	Connected bool `json:"connected"`
+
+	// RTT is the round-trip time to the target in nanoseconds, or zero should it not be known.
+	RTT time.Duration `json:"rtt"`
+}
+
+// ExportGraph takes a snapshot of the routing table of our node. The round-trip time of every peer
+// our node is connected to is measured by rtt, such as multipath.RTT. Should rtt be nil, or return
+// zero, the latency recorded while dialing the peer is used instead, if any.
+func ExportGraph(node *noise.Node, rtt func(peer *noise.Peer) time.Duration) Graph {
+	t := Table(node)
+	self := protocol.NodeID(node).(ID)
+
+	graph := Graph{Nodes: []GraphNode{{ID: hex.EncodeToString(self.Hash()), Address: self.address, Bucket: t.bucketID(self.Hash()), Self: true}}}
+
+	for index, bucket := range t.buckets {
+		bucket.RLock()
+
+		for e := bucket.Front(); e != nil; e = e.Next() {
+			id := e.Value.(protocol.ID)
+
+			if bytes.Equal(id.Hash(), self.Hash()) {
+				continue
+			}
+
+			var address string
+
+			if id, ok := id.(ID); ok {
+				address = id.address
+			}
+
+			graph.Nodes = append(graph.Nodes, GraphNode{ID: hex.EncodeToString(id.Hash()), Address: address, Bucket: index})
+
+			edge := GraphEdge{Source: graph.Nodes[0].ID, Target: hex.EncodeToString(id.Hash())}
+
+			edge.Connected = protocol.Peer(node, id) != nil
+			edge.RTT = rttOf(node, id, rtt)
+
+			graph.Edges = append(graph.Edges, edge)
+		}
+
+		bucket.RUnlock()
+	}
+
+	sort.SliceStable(graph.Nodes[1:], func(i, j int) bool {
+		return graph.Nodes[i+1].Bucket > graph.Nodes[j+1].Bucket
+	})
+
+	return graph
+}
+
+// DOT renders a graph in the DOT language, such that it may be laid out with Graphviz. Nodes are
+// labelled with their address and the prefix of their ID. Edges to peers our node is not connected
+// to are dashed, and edges are labelled with their round-trip time.
+func (g Graph) DOT() string {
+	var buf bytes.Buffer
+
+	buf.WriteString("digraph skademlia {\n")
+
+	for _, n := range g.Nodes {
+		attrs := fmt.Sprintf("label=%q", fmt.Sprintf("%s\n%.8s (bucket %d)", n.Address, n.ID, n.Bucket))
+
+		if n.Self {
+			attrs += ", style=bold"
+		}
+
+		fmt.Fprintf(&buf, "\t%q [%s];\n", n.ID, attrs)
+	}
+
+	for _, e := range g.Edges {
+		var attrs []string
+
+		if e.RTT > 0 {
+			attrs = append(attrs, fmt.Sprintf("label=%q", e.RTT.Round(time.Microsecond).String()), fmt.Sprintf("weight=%d", weigh(e.RTT)))
+		}
+
+		if !e.Connected {
+			attrs = append(attrs, "style=dashed")
+		}
+
+		if len(attrs) > 0 {
+			fmt.Fprintf(&buf, "\t%q -> %q [%s];\n", e.Source, e.Target, strings.Join(attrs, ", "))
+		} else {
+			fmt.Fprintf(&buf, "\t%q -> %q;\n", e.Source, e.Target)
+		}
+	}
+
+	buf.WriteString("}\n")
+
+	return buf.String()
+}
+
+// weigh converts a round-trip time into a Graphviz edge weight, such that peers with lower
+// round-trip times are drawn closer to our node.
+func weigh(rtt time.Duration) int {
+	ms := int(rtt / time.Millisecond)
+
+	if ms >= 100 {
+		return 1
+	}
+
+	return 100 - ms
+}
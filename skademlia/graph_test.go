@@ -0,0 +1,78 @@
+package skademlia
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportGraph(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	hub := newServiceNode(t, layer)
+	defer hub.Kill()
+
+	var nodes []*noise.Node
+	var peers []*noise.Peer
+
+	for i := 0; i < 2; i++ {
+		node := newServiceNode(t, layer)
+		defer node.Kill()
+
+		peer, err := node.Dial(hub.ExternalAddress())
+		assert.NoError(t, err)
+
+		WaitUntilAuthenticated(peer)
+
+		nodes = append(nodes, node)
+		peers = append(peers, peer)
+	}
+
+	// The hub logs peers into its table once they complete its side of the protocol.
+	for i := 0; i < 100 && len(Table(hub).GetPeers()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	graph := ExportGraph(hub, func(peer *noise.Peer) time.Duration { return 5 * time.Millisecond })
+
+	assert.Len(t, graph.Nodes, 3)
+	assert.Len(t, graph.Edges, 2)
+
+	assert.True(t, graph.Nodes[0].Self)
+	assert.Equal(t, hex.EncodeToString(protocol.NodeID(hub).Hash()), graph.Nodes[0].ID)
+
+	for _, edge := range graph.Edges {
+		assert.Equal(t, graph.Nodes[0].ID, edge.Source)
+		assert.True(t, edge.Connected)
+		assert.Equal(t, 5*time.Millisecond, edge.RTT)
+	}
+
+	buf, err := json.Marshal(graph)
+	assert.NoError(t, err)
+
+	var decoded Graph
+	assert.NoError(t, json.Unmarshal(buf, &decoded))
+	assert.Equal(t, graph, decoded)
+
+	dot := graph.DOT()
+	assert.True(t, strings.HasPrefix(dot, "digraph skademlia {\n"))
+	assert.Contains(t, dot, nodes[0].ExternalAddress())
+	assert.Contains(t, dot, `label="5ms", weight=95`)
+
+	// Peers which disconnect are still within the table, yet have their edges dashed.
+	peers[0].Disconnect()
+	time.Sleep(100 * time.Millisecond)
+
+	graph = ExportGraph(hub, nil)
+	assert.Contains(t, graph.DOT(), "style=dashed")
+}
@@ -39,6 +39,11 @@ func (a ID) Hash() []byte {
 	return a.buf
 }
 
+// Address returns the address the node behind the ID advertised itself as reachable at.
+func (a ID) Address() string {
+	return a.address
+}
+
 func NewID(address string, publicKey, nonce []byte) ID {
 	hash := blake2b.Sum256(publicKey)
 
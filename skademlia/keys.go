@@ -73,6 +73,39 @@ func LoadKeys(privateKeyBuf []byte, c1, c2 int) (*Keypair, error) {
 	}, nil
 }
 
+// LoadPublicKey loads a S/Kademlia keypair holding only an Ed25519 public key, and validates it through
+// both a static and dynamic crypto puzzle parameterized by constants C1 and C2 respectively.
+//
+// It is intended for nodes whose private key is held elsewhere, such as by a remote signer. Such nodes
+// must sign messages with a signature scheme which does not require the private key, provided through
+// `skademlia.New().WithSignatureScheme(scheme)`.
+func LoadPublicKey(publicKeyBuf []byte, c1, c2 int) (*Keypair, error) {
+	if len(publicKeyBuf) != edwards25519.PublicKeySize {
+		return nil, errors.Errorf("skademlia: public key is not %d bytes", edwards25519.PublicKeySize)
+	}
+
+	id := blake2b.Sum256(publicKeyBuf)
+
+	if !checkHashedBytesPrefixLen(id[:], c1) {
+		return nil, errors.Errorf("skademlia: public key provided does not have a prefix of C1: %x", id)
+	}
+
+	nonce := generateNonce(id[:], c2)
+
+	if nonce == nil {
+		return nil, errors.New("skademlia: keypair has an invalid nonce")
+	}
+
+	return &Keypair{
+		publicKey: append(edwards25519.PublicKey(nil), publicKeyBuf...),
+
+		Nonce: nonce,
+
+		C1: c1,
+		C2: c2,
+	}, nil
+}
+
 // RandomKeys randomly generates a set of cryptographic keys by solving both a static and dynamic
 // crypto puzzle parameterized by constants C1 = 8, and C2 = 8 respectively.
 func RandomKeys() *Keypair {
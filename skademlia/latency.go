@@ -0,0 +1,102 @@
+package skademlia
+
+import (
+	"bytes"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/protocol"
+	"sort"
+	"time"
+)
+
+const keyLatencyBias = "kademlia.latency_bias"
+
+// latencyBias orders the candidates of a lookup such that peers with lower round-trip times are
+// queried first among candidates which share a bucket relative to the target.
+type latencyBias struct {
+	rtt func(peer *noise.Peer) time.Duration
+}
+
+// WithLatencyBias has lookups through `FindNode()` query the peers with the lowest round-trip
+// times first among candidates which share a bucket relative to the target, rather than those
+// closest to the target in XOR distance.
+//
+// Candidates which share a bucket relative to the target share the same length of prefix with the
+// target, and so querying any one of them brings a lookup equally many bits closer to the target.
+// Candidates in buckets closer to the target are still always queried first, and the peers a
+// lookup returns are still those closest to the target in XOR distance.
+//
+// The round-trip time of every peer our node is connected to is measured by rtt, such as
+// multipath.RTT. Should rtt be nil, or return zero, the latency recorded while dialing the peer is
+// used instead, if any. Peers whose round-trip times are not known are queried last within their
+// bucket.
+func (b *block) WithLatencyBias(rtt func(peer *noise.Peer) time.Duration) *block {
+	b.latencyBias = &latencyBias{rtt: rtt}
+	return b
+}
+
+// rttOf returns the round-trip time to the peer behind an ID, or zero should it not be known.
+func rttOf(node *noise.Node, id protocol.ID, rtt func(peer *noise.Peer) time.Duration) time.Duration {
+	var measured time.Duration
+
+	if rtt != nil {
+		if peer := protocol.Peer(node, id); peer != nil {
+			measured = rtt(peer)
+		}
+	}
+
+	if id, ok := id.(ID); ok && measured == 0 && id.address != "" {
+		measured = node.DialStatsOf(id.address).Latency
+	}
+
+	return measured
+}
+
+// orderCandidates orders the candidates of a lookup towards a target should our node bias lookups
+// by latency.
+func orderCandidates(node *noise.Node, target []byte, candidates []ID) {
+	bias, ok := node.Get(keyLatencyBias).(*latencyBias)
+	if !ok {
+		return
+	}
+
+	sortCandidates(target, candidates, func(id ID) time.Duration {
+		return rttOf(node, id, bias.rtt)
+	})
+}
+
+// sortCandidates orders candidates by the bucket they fall into relative to a target, closest
+// bucket first, and then by their round-trip times, and then by their XOR distance to the target.
+func sortCandidates(target []byte, candidates []ID, rtt func(id ID) time.Duration) {
+	if len(candidates) < 2 {
+		return
+	}
+
+	keys := make(map[string]candidateKey, len(candidates))
+
+	for _, id := range candidates {
+		distance := xor(id.Hash(), target)
+		keys[string(id.Hash())] = candidateKey{bucket: prefixLen(distance), rtt: rtt(id), distance: distance}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return keys[string(candidates[i].Hash())].less(keys[string(candidates[j].Hash())])
+	})
+}
+
+type candidateKey struct {
+	bucket   int
+	rtt      time.Duration
+	distance []byte
+}
+
+func (a candidateKey) less(b candidateKey) bool {
+	if a.bucket != b.bucket {
+		return a.bucket > b.bucket
+	}
+
+	if a.rtt != b.rtt {
+		return a.rtt > 0 && (b.rtt == 0 || a.rtt < b.rtt)
+	}
+
+	return bytes.Compare(a.distance, b.distance) == -1
+}
@@ -0,0 +1,199 @@
+package skademlia
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	mrand "math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func randomID(t *testing.T) ID {
+	publicKey := make([]byte, 32)
+
+	_, err := rand.Read(publicKey)
+	assert.NoError(t, err)
+
+	return NewID("", publicKey, nil)
+}
+
+func bucketsOf(target []byte, ids []ID) []int {
+	buckets := make([]int, 0, len(ids))
+
+	for _, id := range ids {
+		buckets = append(buckets, prefixLen(xor(id.Hash(), target)))
+	}
+
+	return buckets
+}
+
+func TestSortCandidates(t *testing.T) {
+	target := randomID(t).Hash()
+
+	var ids []ID
+	for i := 0; i < 64; i++ {
+		ids = append(ids, randomID(t))
+	}
+
+	rtts := make(map[string]time.Duration)
+	for i, id := range ids {
+		// Every fourth candidate has no known round-trip time.
+		if i%4 != 0 {
+			rtts[string(id.Hash())] = time.Duration(1+mrand.Intn(300)) * time.Millisecond
+		}
+	}
+
+	rtt := func(id ID) time.Duration { return rtts[string(id.Hash())] }
+
+	sortCandidates(target, ids, rtt)
+
+	for i := 1; i < len(ids); i++ {
+		a, b := prefixLen(xor(ids[i-1].Hash(), target)), prefixLen(xor(ids[i].Hash(), target))
+
+		// Buckets closer to the target always come first.
+		if !assert.True(t, a >= b) {
+			return
+		}
+
+		if a != b {
+			continue
+		}
+
+		// Within a bucket, lower round-trip times come first, and unknown round-trip times last.
+		x, y := rtt(ids[i-1]), rtt(ids[i])
+
+		switch {
+		case x == y:
+			assert.Equal(t, -1, bytes.Compare(xor(ids[i-1].Hash(), target), xor(ids[i].Hash(), target)))
+		case y == 0:
+		default:
+			assert.True(t, x > 0 && x < y)
+		}
+	}
+}
+
+// TestLatencyBiasLowersLookupLatency measures how long the first hop of a lookup takes, being the
+// highest round-trip time of the α peers it starts from, over many simulated routing tables.
+func TestLatencyBiasLowersLookupLatency(t *testing.T) {
+	const (
+		trials = 500
+		alpha  = 3
+	)
+
+	var unbiased, biased time.Duration
+
+	for trial := 0; trial < trials; trial++ {
+		target := randomID(t).Hash()
+
+		// A bucket worth of peers closest to the target, with round-trip times between 10ms and
+		// 300ms.
+		candidates := make([]ID, 0, BucketSize())
+		rtts := make(map[string]time.Duration)
+
+		for i := 0; i < BucketSize(); i++ {
+			id := randomID(t)
+
+			candidates = append(candidates, id)
+			rtts[string(id.Hash())] = time.Duration(10+mrand.Intn(291)) * time.Millisecond
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			return bytes.Compare(xor(candidates[i].Hash(), target), xor(candidates[j].Hash(), target)) == -1
+		})
+
+		closest := append([]ID(nil), candidates[:alpha]...)
+
+		sortCandidates(target, candidates, func(id ID) time.Duration { return rtts[string(id.Hash())] })
+		chosen := candidates[:alpha]
+
+		// Both starting points are equally close to the target bucket-wise, such that a lookup makes
+		// just as much progress towards the target per hop.
+		assert.Equal(t, bucketsOf(target, closest), bucketsOf(target, chosen))
+
+		unbiased += slowest(closest, rtts)
+		biased += slowest(chosen, rtts)
+	}
+
+	unbiased, biased = unbiased/trials, biased/trials
+
+	t.Logf("mean first hop latency over %d lookups: %s unbiased, %s biased by latency", trials, unbiased, biased)
+
+	assert.True(t, biased < unbiased)
+}
+
+func slowest(ids []ID, rtts map[string]time.Duration) time.Duration {
+	var max time.Duration
+
+	for _, id := range ids {
+		if rtt := rtts[string(id.Hash())]; rtt > max {
+			max = rtt
+		}
+	}
+
+	return max
+}
+
+func TestFindNodeWithLatencyBias(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	params := noise.DefaultParams()
+	params.Transport = layer
+	params.Keys = RandomKeys()
+
+	hub, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer hub.Kill()
+
+	probed := make(chan struct{}, 64)
+
+	protocol.New().Register(New().WithLatencyBias(func(peer *noise.Peer) time.Duration {
+		select {
+		case probed <- struct{}{}:
+		default:
+		}
+
+		return time.Duration(peer.RemotePort()) * time.Microsecond
+	})).Enforce(hub)
+
+	go hub.Listen()
+
+	for i := 0; i < 5; i++ {
+		node := newServiceNode(t, layer)
+		defer node.Kill()
+
+		peer, err := node.Dial(hub.ExternalAddress())
+		assert.NoError(t, err)
+
+		WaitUntilAuthenticated(peer)
+	}
+
+	for i := 0; i < 100 && len(Table(hub).GetPeers()) < 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	target := randomID(t)
+
+	var expected []string
+	for _, id := range FindClosestPeers(Table(hub), target.Hash(), BucketSize()) {
+		expected = append(expected, string(id.Hash()))
+	}
+
+	// Despite starting from a single peer, the lookup returns every peer closest to the target.
+	var found []string
+	for _, id := range FindNode(hub, target, 1, 1) {
+		found = append(found, string(id.Hash()))
+	}
+
+	assert.Len(t, expected, 5)
+	assert.Equal(t, expected, found)
+	assert.NotEmpty(t, probed)
+}
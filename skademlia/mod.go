@@ -1,7 +1,9 @@
 package skademlia
 
 import (
+	"context"
 	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/kv"
 	"github.com/perlin-network/noise/log"
 	"github.com/perlin-network/noise/payload"
 	"github.com/perlin-network/noise/protocol"
@@ -28,15 +30,34 @@ type block struct {
 	opcodeLookupRequest  noise.Opcode
 	opcodeLookupResponse noise.Opcode
 
+	opcodeStoreService        noise.Opcode
+	opcodeFindServiceRequest  noise.Opcode
+	opcodeFindServiceResponse noise.Opcode
+
 	scheme signature.Scheme
 
 	c1, c2 int
 
 	prefixDiffLen, prefixDiffMin int
+
+	latencyBias *latencyBias
+
+	prefetchLimit int
+	prefetchTTL   time.Duration
+
+	services kv.Store
 }
 
 func New() *block {
-	return &block{c1: DefaultC1, c2: DefaultC2, prefixDiffLen: DefaultPrefixDiffLen, prefixDiffMin: DefaultPrefixDiffMin}
+	return &block{
+		c1:            DefaultC1,
+		c2:            DefaultC2,
+		prefixDiffLen: DefaultPrefixDiffLen,
+		prefixDiffMin: DefaultPrefixDiffMin,
+		prefetchLimit: DefaultPrefetchLimit,
+		prefetchTTL:   DefaultPrefetchTTL,
+		services:      kv.NewMemory(),
+	}
 }
 
 func (b *block) WithC1(c1 int) *block {
@@ -69,6 +90,9 @@ func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
 	b.opcodeEvict = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Evict)(nil))
 	b.opcodeLookupRequest = noise.RegisterMessage(noise.NextAvailableOpcode(), (*LookupRequest)(nil))
 	b.opcodeLookupResponse = noise.RegisterMessage(noise.NextAvailableOpcode(), (*LookupResponse)(nil))
+	b.opcodeStoreService = noise.RegisterMessage(noise.NextAvailableOpcode(), (*StoreService)(nil))
+	b.opcodeFindServiceRequest = noise.RegisterMessage(noise.NextAvailableOpcode(), (*FindServiceRequest)(nil))
+	b.opcodeFindServiceResponse = noise.RegisterMessage(noise.NextAvailableOpcode(), (*FindServiceResponse)(nil))
 
 	if _, ok := node.Keys.(*Keypair); !ok {
 		panic("skademlia: node should set `params := noise.DefaultParams(); params.Keys = skademlia.NewKeys()`")
@@ -78,13 +102,46 @@ func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
 
 	protocol.SetNodeID(node, nodeID)
 	node.Set(keyKademliaTable, newTable(nodeID))
+	node.RegisterState(keyKademliaTable, exportTable, restoreTable)
+
+	if b.latencyBias != nil {
+		node.Set(keyLatencyBias, b.latencyBias)
+	}
+
+	node.Set(keyServices, &serviceStore{clock: node.Clock(), records: b.services})
+
+	prefetches := &prefetcher{limit: b.prefetchLimit, ttl: b.prefetchTTL, hints: make(map[string]*hint)}
+	node.Set(keyPrefetcher, prefetches)
+
+	// Peers within our table, and peers hinted through Prefetch, are kept connected, even while
+	// idle.
+	node.OnPeerIdle(func(node *noise.Node, peer *noise.Peer) bool {
+		id := protocol.PeerID(peer)
+		if id == nil {
+			return false
+		}
+
+		if _, exists := Table(node).Get(id); exists {
+			return true
+		}
+
+		return prefetches.warm(peer)
+	})
+}
+
+// Advertise sets the address our node advertises within its ID to peers it connects to from then
+// on, such as once the address has been verified to be reachable. The hash of our ID, and thus our
+// position within the DHT, remains the same.
+func Advertise(node *noise.Node, address string) {
+	id := protocol.NodeID(node).(ID)
+	protocol.SetNodeID(node, NewID(address, id.publicKey, id.nonce))
 }
 
 func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
 	// Send a ping.
 	err := peer.SendMessage(Ping{ID: protocol.NodeID(peer.Node()).(ID)})
 	if err != nil {
-		return errors.Wrap(errors.Wrap(protocol.DisconnectPeer, err.Error()), "failed to send ping")
+		return errors.Wrap(protocol.DisconnectWith(err), "failed to send ping")
 	}
 
 	// Receive a ping and set the peers id.
@@ -93,19 +150,29 @@ func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
 	select {
 	case msg := <-peer.Receive(b.opcodePing):
 		id = msg.(Ping)
-	case <-time.After(3 * time.Second):
-		return errors.Wrap(protocol.DisconnectPeer, "skademlia: timed out waiting for pong")
+	case <-peer.Node().Clock().After(3 * time.Second):
+		return errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeTimeout), "skademlia: timed out waiting for pong")
 	}
 
 	// Verify that the remote peer id is valid for the current node's c1 and c2 settings
 	if ok := VerifyPuzzle(id.PublicKey(), id.Hash(), id.nonce, b.c1, b.c2); !ok {
-		return errors.New("skademlia: peer connected with ID that fails to solve static/dynamic crpyo tpuzzle")
+		return errors.Wrap(noise.ErrHandshakeFailed, "skademlia: peer connected with ID that fails to solve static/dynamic crpyo tpuzzle")
 	}
 
 	// Register peer.
 	protocol.SetPeerID(peer, id.ID)
 	enforceSignatures(peer, b.scheme)
 
+	// Our node forgets the peer once it disconnects, unless the peer has since reconnected. The ID
+	// stays set on the peer, as messages may still be in the midst of being handled.
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		if protocol.Peer(node, id.ID) == peer {
+			node.Delete(protocol.KeyPeerID + string(id.Hash()))
+		}
+
+		return nil
+	})
+
 	// Log peer into S/Kademlia table, and have all messages update the S/Kademlia table.
 	_ = b.logPeerActivity(peer)
 
@@ -113,7 +180,18 @@ func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
 		return msg, b.logPeerActivity(peer)
 	})
 
-	go b.handleLookups(peer)
+	// Lookups are handled until the peer disconnects, or until our node is killed.
+	disconnected := make(chan struct{})
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	peer.Node().Go(func(ctx context.Context) error {
+		b.handleLookups(ctx, peer, disconnected)
+		return nil
+	})
 
 	close(peer.LoadOrStore(keyAuthChannel, make(chan struct{})).(chan struct{}))
 
@@ -133,7 +211,7 @@ func (b *block) logPeerActivity(peer *noise.Peer) error {
 		err := UpdateTable(peer.Node(), protocol.PeerID(peer))
 
 		if err != nil {
-			return errors.Wrap(errors.Wrap(protocol.DisconnectPeer, err.Error()),
+			return errors.Wrap(protocol.DisconnectWith(err),
 				"kademlia: failed to update table with peer ID")
 		}
 	}
@@ -147,8 +225,11 @@ func enforceSignatures(peer *noise.Peer, scheme signature.Scheme) {
 		peer.OnEncodeFooter(func(node *noise.Node, peer *noise.Peer, header, msg []byte) (i []byte, e error) {
 			signature, err := scheme.Sign(node.Keys.PrivateKey(), msg)
 
+			// Signing may fail should the scheme be backed by a remote signer which is unavailable. As
+			// no further messages could be signed, disconnect from the peer rather than crash our node.
 			if err != nil {
-				panic(errors.Wrap(err, "signature: failed to sign message"))
+				peer.DisconnectAsync()
+				return header, errors.Wrap(err, "signature: failed to sign message")
 			}
 
 			return payload.NewWriter(header).WriteBytes(signature).Bytes(), nil
@@ -173,9 +254,13 @@ func enforceSignatures(peer *noise.Peer, scheme signature.Scheme) {
 	}
 }
 
-func (b *block) handleLookups(peer *noise.Peer) {
+func (b *block) handleLookups(ctx context.Context, peer *noise.Peer, disconnected <-chan struct{}) {
 	for {
 		select {
+		case <-ctx.Done():
+			return
+		case <-disconnected:
+			return
 		case msg := <-peer.Receive(b.opcodeLookupRequest):
 			id := msg.(LookupRequest)
 
@@ -197,6 +282,29 @@ func (b *block) handleLookups(peer *noise.Peer) {
 					Interface("peer", protocol.PeerID(peer)).
 					Msg("Failed to send lookup response to peer.")
 			}
+		case msg := <-peer.Receive(b.opcodeStoreService):
+			record := msg.(StoreService).ServiceRecord
+
+			if err := record.verify(peer.Node().Clock().Now()); err != nil {
+				log.Warn().Err(err).Str("service", record.Name).Msg("Peer asked us to hold an invalid service record.")
+				continue
+			}
+
+			if !VerifyPuzzle(record.ID.PublicKey(), record.ID.Hash(), record.ID.nonce, b.c1, b.c2) {
+				log.Warn().Str("service", record.Name).Msg("Peer asked us to hold a service record of an ID which fails to solve the crypto puzzles.")
+				continue
+			}
+
+			services(peer.Node()).store(record)
+		case msg := <-peer.Receive(b.opcodeFindServiceRequest):
+			name := msg.(FindServiceRequest).Name
+
+			if err := peer.SendMessage(FindServiceResponse{Name: name, Records: services(peer.Node()).find(name)}); err != nil {
+				log.Warn().
+					AnErr("err", err).
+					Interface("peer", protocol.PeerID(peer)).
+					Msg("Failed to send service records to peer.")
+			}
 		}
 	}
 }
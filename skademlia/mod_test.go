@@ -1,7 +1,10 @@
 package skademlia
 
 import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/protocol"
 	"github.com/perlin-network/noise/signature/eddsa"
+	"github.com/perlin-network/noise/transport"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"testing/quick"
@@ -37,3 +40,25 @@ func TestNew(t *testing.T) {
 		return block.WithPrefixDiffMin(prefixDiffMin).prefixDiffMin == prefixDiffMin
 	}, nil))
 }
+
+func TestAdvertise(t *testing.T) {
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	go node.Listen()
+	defer node.Kill()
+
+	before := NewID(node.ExternalAddress(), []byte("public key"), []byte("nonce"))
+	protocol.SetNodeID(node, before)
+
+	Advertise(node, "203.0.113.7:3000")
+
+	after := protocol.NodeID(node).(ID)
+
+	assert.Equal(t, "203.0.113.7:3000", after.address)
+	assert.Equal(t, before.Hash(), after.Hash())
+	assert.Equal(t, before.nonce, after.nonce)
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/perlin-network/noise"
 	"github.com/perlin-network/noise/payload"
 	"github.com/pkg/errors"
+	"time"
 )
 
 const maxNumPeersToLookup = 64
@@ -13,6 +14,10 @@ var (
 	_ noise.Message = (*Evict)(nil)
 	_ noise.Message = (*LookupRequest)(nil)
 	_ noise.Message = (*LookupResponse)(nil)
+	_ noise.Message = (*ServiceRecord)(nil)
+	_ noise.Message = (*StoreService)(nil)
+	_ noise.Message = (*FindServiceRequest)(nil)
+	_ noise.Message = (*FindServiceResponse)(nil)
 )
 
 type Ping struct{ ID }
@@ -82,3 +87,131 @@ func (l LookupResponse) Write() []byte {
 
 	return writer.Bytes()
 }
+
+// ServiceRecord advertises that the node behind an ID provides a named service until it expires.
+// Records are signed by the node they advertise, such that they may be stored and handed out by any
+// peer without being forged.
+type ServiceRecord struct {
+	Name      string
+	ID        ID
+	Expires   time.Time
+	Signature []byte
+}
+
+func (r ServiceRecord) Read(reader payload.Reader) (noise.Message, error) {
+	var err error
+
+	if r.Name, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read service name")
+	}
+
+	id, err := ID{}.Read(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read service provider")
+	}
+
+	r.ID = id.(ID)
+
+	expires, err := reader.ReadUint64()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read service record expiry")
+	}
+
+	r.Expires = time.Unix(0, int64(expires))
+
+	if r.Signature, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read service record signature")
+	}
+
+	return r, nil
+}
+
+func (r ServiceRecord) Write() []byte {
+	return payload.NewWriter(r.signingPayload()).WriteBytes(r.Signature).Bytes()
+}
+
+// signingPayload is the service record without its signature, which the signature covers.
+func (r ServiceRecord) signingPayload() []byte {
+	writer := payload.NewWriter(nil).WriteString(r.Name)
+	writer.Write(r.ID.Write())
+
+	return writer.WriteUint64(uint64(r.Expires.UnixNano())).Bytes()
+}
+
+// StoreService asks a peer to hold a service record, and hand it out to peers looking for the
+// service.
+type StoreService struct{ ServiceRecord }
+
+func (m StoreService) Read(reader payload.Reader) (noise.Message, error) {
+	record, err := ServiceRecord{}.Read(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	m.ServiceRecord = record.(ServiceRecord)
+
+	return m, nil
+}
+
+type FindServiceRequest struct {
+	Name string
+}
+
+func (m FindServiceRequest) Read(reader payload.Reader) (noise.Message, error) {
+	var err error
+
+	if m.Name, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read service name")
+	}
+
+	return m, nil
+}
+
+func (m FindServiceRequest) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.Name).Bytes()
+}
+
+type FindServiceResponse struct {
+	Name    string
+	Records []ServiceRecord
+}
+
+func (m FindServiceResponse) Read(reader payload.Reader) (noise.Message, error) {
+	var err error
+
+	if m.Name, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read service name")
+	}
+
+	numRecords, err := reader.ReadUint32()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read number of service records")
+	}
+
+	if numRecords > maxServiceRecords {
+		return nil, errors.Errorf("received too many service records; got %d records when at most we can only handle %d records", numRecords, maxServiceRecords)
+	}
+
+	m.Records = make([]ServiceRecord, numRecords)
+
+	for i := range m.Records {
+		record, err := ServiceRecord{}.Read(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode service record")
+		}
+
+		m.Records[i] = record.(ServiceRecord)
+	}
+
+	return m, nil
+}
+
+func (m FindServiceResponse) Write() []byte {
+	writer := payload.NewWriter(nil).WriteString(m.Name).WriteUint32(uint32(len(m.Records)))
+
+	for _, record := range m.Records {
+		writer.Write(record.Write())
+	}
+
+	return writer.Bytes()
+}
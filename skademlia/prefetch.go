@@ -0,0 +1,153 @@
+package skademlia
+
+import (
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPrefetchLimit = 16
+	DefaultPrefetchTTL   = time.Minute
+
+	keyPrefetcher = "kademlia.prefetcher"
+)
+
+// prefetcher holds the peers applications hinted our node will need soon, by the hashes of their
+// IDs.
+type prefetcher struct {
+	sync.Mutex
+
+	limit int
+	ttl   time.Duration
+
+	hints map[string]*hint
+}
+
+type hint struct {
+	lapses time.Time
+
+	// peer is the peer our node dialed for the hint, up until it disconnects.
+	peer    *noise.Peer
+	dialing bool
+}
+
+// WithPrefetchLimits sets how many peers hinted through `Prefetch()` our node keeps warm
+// connections to at once, and for how long after being hinted.
+func (b *block) WithPrefetchLimits(limit int, ttl time.Duration) *block {
+	b.prefetchLimit, b.prefetchTTL = limit, ttl
+	return b
+}
+
+// Prefetch hints that our node will need to talk to peers soon, such that our node dials and
+// handshakes with them ahead of time, hiding the latency of doing so from whenever our node does
+// need them. Hinting a peer which our node is already connected to keeps it connected.
+//
+// Peers hinted are kept connected for the TTL of the block, even while idle, and hinting a peer
+// again extends its TTL. Hints beyond the limit of the block are ignored until earlier hints lapse.
+// Dials are subject to bans and the socket budget of our node, as any other dial is.
+func Prefetch(node *noise.Node, ids ...ID) {
+	p, ok := node.Get(keyPrefetcher).(*prefetcher)
+	if !ok {
+		return
+	}
+
+	self := protocol.NodeID(node)
+	now := node.Clock().Now()
+
+	var dials []ID
+
+	p.Lock()
+
+	for key, h := range p.hints {
+		if !now.Before(h.lapses) {
+			delete(p.hints, key)
+		}
+	}
+
+	for _, id := range ids {
+		if id.address == "" || (self != nil && self.Equals(id)) {
+			continue
+		}
+
+		h, exists := p.hints[string(id.Hash())]
+		if !exists {
+			if len(p.hints) >= p.limit {
+				continue
+			}
+
+			h = &hint{}
+			p.hints[string(id.Hash())] = h
+		}
+
+		h.lapses = now.Add(p.ttl)
+
+		if h.dialing || h.peer != nil || protocol.Peer(node, id) != nil {
+			continue
+		}
+
+		h.dialing = true
+		dials = append(dials, id)
+	}
+
+	p.Unlock()
+
+	for _, id := range dials {
+		id := id
+
+		node.Go(func(ctx context.Context) error {
+			p.dial(node, id)
+			return nil
+		})
+	}
+}
+
+func (p *prefetcher) dial(node *noise.Node, id ID) {
+	peer, err := node.Dial(id.address)
+
+	p.Lock()
+	defer p.Unlock()
+
+	h, exists := p.hints[string(id.Hash())]
+	if exists {
+		h.dialing = false
+	}
+
+	if err != nil {
+		log.Debug().Err(err).Str("address", id.address).Msg("Failed to prefetch a connection to a peer.")
+		return
+	}
+
+	if !exists {
+		return
+	}
+
+	h.peer = peer
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		p.Lock()
+		if h.peer == peer {
+			h.peer = nil
+		}
+		p.Unlock()
+
+		return nil
+	})
+}
+
+// warm reports whether a peer was hinted, and has yet to lapse.
+func (p *prefetcher) warm(peer *noise.Peer) bool {
+	id := protocol.PeerID(peer)
+	if id == nil {
+		return false
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	h, exists := p.hints[string(id.Hash())]
+	return exists && peer.Node().Clock().Now().Before(h.lapses)
+}
@@ -0,0 +1,86 @@
+package skademlia
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPrefetch(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	params := noise.DefaultParams()
+	params.Transport = layer
+	params.Keys = RandomKeys()
+	params.IdleTimeout = 200 * time.Millisecond
+
+	hub, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer hub.Kill()
+
+	protocol.New().Register(New().WithPrefetchLimits(2, time.Second)).Enforce(hub)
+
+	var ids []ID
+	var accepted int32
+
+	for i := 0; i < 3; i++ {
+		node := newServiceNode(t, layer)
+		defer node.Kill()
+
+		node.OnPeerConnected(func(node *noise.Node, peer *noise.Peer) error {
+			atomic.AddInt32(&accepted, 1)
+			return nil
+		})
+
+		ids = append(ids, protocol.NodeID(node).(ID))
+	}
+
+	connected := func(id ID) bool { return protocol.Peer(hub, id) != nil }
+
+	// Hints beyond the limit are ignored, and hinting peers again does not dial them again.
+	Prefetch(hub, ids...)
+	Prefetch(hub, ids...)
+
+	for i := 0; i < 100 && !(connected(ids[0]) && connected(ids[1])); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.True(t, connected(ids[0]))
+	assert.True(t, connected(ids[1]))
+	assert.False(t, connected(ids[2]))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&accepted))
+
+	// Hinted peers are kept connected while idle, even should they not be within our table, up until
+	// their hints lapse.
+	Table(hub).Delete(ids[0])
+	Table(hub).Delete(ids[1])
+
+	time.Sleep(500 * time.Millisecond)
+
+	assert.True(t, connected(ids[0]))
+	assert.True(t, connected(ids[1]))
+
+	for i := 0; i < 200 && (connected(ids[0]) || connected(ids[1])); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.False(t, connected(ids[0]))
+	assert.False(t, connected(ids[1]))
+
+	// Once earlier hints lapse, new hints are taken on.
+	Prefetch(hub, ids[2])
+
+	for i := 0; i < 100 && !connected(ids[2]); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.True(t, connected(ids[2]))
+}
@@ -2,6 +2,7 @@ package skademlia
 
 import (
 	"bytes"
+	"context"
 	"github.com/perlin-network/noise"
 	"github.com/perlin-network/noise/protocol"
 	"sort"
@@ -58,24 +59,15 @@ func BroadcastAsync(node *noise.Node, message noise.Message) {
 }
 
 func queryPeerByID(node *noise.Node, peerID, targetID ID, responses chan []ID) {
-	var err error
-
 	if peerID.Equals(protocol.NodeID(node)) {
 		responses <- []ID{}
 		return
 	}
 
-	peer := protocol.Peer(node, peerID)
-
-	if peer == nil {
-		peer, err = node.Dial(peerID.address)
-
-		if err != nil {
-			responses <- []ID{}
-			return
-		}
-
-		WaitUntilAuthenticated(peer)
+	peer, err := connect(node, peerID)
+	if err != nil {
+		responses <- []ID{}
+		return
 	}
 
 	opcodeLookupResponse, err := noise.OpcodeFromMessage((*LookupResponse)(nil))
@@ -94,7 +86,7 @@ func queryPeerByID(node *noise.Node, peerID, targetID ID, responses chan []ID) {
 	select {
 	case msg := <-peer.Receive(opcodeLookupResponse):
 		responses <- msg.(LookupResponse).peers
-	case <-time.After(3 * time.Second):
+	case <-node.Clock().After(3 * time.Second):
 		responses <- []ID{}
 	}
 }
@@ -104,14 +96,23 @@ type lookupBucket struct {
 	queue   []ID
 }
 
+// goQueryPeerByID runs queryPeerByID in a goroutine tracked by our node.
+func goQueryPeerByID(node *noise.Node, peerID, targetID ID, responses chan []ID) {
+	node.Go(func(ctx context.Context) error {
+		queryPeerByID(node, peerID, targetID, responses)
+		return nil
+	})
+}
+
 func (lookup *lookupBucket) performLookup(node *noise.Node, table *table, targetID ID, alpha int, visited *sync.Map) (results []ID) {
 	responses := make(chan []ID)
 
 	// Go through every peer in the entire queue and queue up what peers believe
 	// is closest to a target ID.
+	orderCandidates(node, targetID.Hash(), lookup.queue)
 
 	for ; lookup.pending < alpha && len(lookup.queue) > 0; lookup.pending++ {
-		go queryPeerByID(node, lookup.queue[0], targetID, responses)
+		goQueryPeerByID(node, lookup.queue[0], targetID, responses)
 
 		lookup.queue = lookup.queue[1:]
 	}
@@ -135,8 +136,10 @@ func (lookup *lookupBucket) performLookup(node *noise.Node, table *table, target
 		}
 
 		// Queue and request for #ALPHA closest peers to target ID from expanded results.
+		orderCandidates(node, targetID.Hash(), lookup.queue)
+
 		for ; lookup.pending < alpha && len(lookup.queue) > 0; lookup.pending++ {
-			go queryPeerByID(node, lookup.queue[0], targetID, responses)
+			goQueryPeerByID(node, lookup.queue[0], targetID, responses)
 			lookup.queue = lookup.queue[1:]
 		}
 
@@ -168,7 +171,9 @@ func FindNode(node *noise.Node, targetID ID, alpha int, numDisjointPaths int) (r
 
 	// Start searching for target from α peers closest to T by queuing
 	// them up and marking them as visited.
-	for i, peerID := range FindClosestPeers(table, targetID.Hash(), alpha) {
+	seeds, others := seedLookup(node, table, targetID, alpha)
+
+	for i, peerID := range seeds {
 		visited.Store(string(peerID.Hash()), struct{}{})
 
 		if len(lookups) < numDisjointPaths {
@@ -176,29 +181,51 @@ func FindNode(node *noise.Node, targetID ID, alpha int, numDisjointPaths int) (r
 		}
 
 		lookup := lookups[i%numDisjointPaths]
-		lookup.queue = append(lookup.queue, peerID.(ID))
+		lookup.queue = append(lookup.queue, peerID)
 
-		results = append(results, peerID.(ID))
+		results = append(results, peerID)
 	}
 
 	var wait sync.WaitGroup
 	var mutex sync.Mutex
 
 	for _, lookup := range lookups {
-		go func(lookup *lookupBucket) {
+		lookup := lookup
+
+		wait.Add(1)
+
+		node.Go(func(ctx context.Context) error {
+			defer wait.Done()
+
+			found := lookup.performLookup(node, table, targetID, alpha, visited)
+
 			mutex.Lock()
-			results = append(results, lookup.performLookup(node, table, targetID, alpha, visited)...)
+			results = append(results, found...)
 			mutex.Unlock()
 
-			wait.Done()
-		}(lookup)
-
-		wait.Add(1)
+			return nil
+		})
 	}
 
 	// Wait until all D parallel lookups have been completed.
 	wait.Wait()
 
+	// Peers closest to T which were passed over in favor of peers with lower
+	// round-trip times are still known to be close to T.
+	if len(others) > 0 {
+		found := make(map[string]struct{}, len(results))
+
+		for _, id := range results {
+			found[string(id.Hash())] = struct{}{}
+		}
+
+		for _, id := range others {
+			if _, exists := found[string(id.Hash())]; !exists {
+				results = append(results, id)
+			}
+		}
+	}
+
 	// Sort resulting peers by XOR distance.
 	sort.Slice(results, func(i, j int) bool {
 		return bytes.Compare(xor(results[i].Hash(), targetID.Hash()), xor(results[j].Hash(), targetID.Hash())) == -1
@@ -212,3 +239,26 @@ func FindNode(node *noise.Node, targetID ID, alpha int, numDisjointPaths int) (r
 
 	return
 }
+
+// seedLookup returns the α peers a lookup towards a target starts from. Should our node bias
+// lookups by latency, the α peers are chosen among a bucket worth of peers closest to the target,
+// and the peers passed over are returned as well.
+func seedLookup(node *noise.Node, table *table, targetID ID, alpha int) (seeds, others []ID) {
+	count := alpha
+
+	if _, biased := node.Get(keyLatencyBias).(*latencyBias); biased && count < BucketSize() {
+		count = BucketSize()
+	}
+
+	for _, peerID := range FindClosestPeers(table, targetID.Hash(), count) {
+		seeds = append(seeds, peerID.(ID))
+	}
+
+	orderCandidates(node, targetID.Hash(), seeds)
+
+	if len(seeds) > alpha {
+		seeds, others = seeds[:alpha], seeds[alpha:]
+	}
+
+	return seeds, others
+}
@@ -0,0 +1,303 @@
+package skademlia
+
+import (
+	"bytes"
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/perlin-network/noise/kv"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+	"sync"
+	"time"
+)
+
+const (
+	keyServices = "kademlia.services"
+
+	serviceInfo = "noise service "
+
+	// ServiceTTL is how long a service record registered through RegisterService is held by peers.
+	// Services must be registered again before then for nodes to keep being found.
+	ServiceTTL = 1 * time.Hour
+
+	// maxServiceRecords caps how many records are held, and handed out, for any single service.
+	maxServiceRecords = 64
+)
+
+var ErrNoServiceHolders = errors.New("skademlia: no peers were found to hold the service record")
+
+// WithServiceStore sets the store the service records peers ask our node to hold are kept in, such
+// that records outlive our process until they expire. Use kv.Prefixed to share a store with other
+// components.
+func (b *block) WithServiceStore(store kv.Store) *block {
+	b.services = store
+	return b
+}
+
+// RegisterService publishes a record signed by our node advertising that it provides a named
+// service, such as "chat/v1", to the peers closest to the name throughout the network. Records
+// expire after ServiceTTL.
+func RegisterService(node *noise.Node, name string) error {
+	keys, ok := node.Keys.(*Keypair)
+	if !ok {
+		return errors.New("skademlia: node should set `params := noise.DefaultParams(); params.Keys = skademlia.NewKeys()`")
+	}
+
+	record := ServiceRecord{
+		Name:    name,
+		ID:      protocol.NodeID(node).(ID),
+		Expires: node.Clock().Now().Add(ServiceTTL),
+	}
+
+	record.Signature = edwards25519.Sign(keys.privateKey, record.signingPayload())
+
+	services(node).store(record)
+
+	var stored int
+
+	for _, id := range FindNode(node, serviceID(name), BucketSize(), 8) {
+		peer, err := connect(node, id)
+		if err != nil {
+			continue
+		}
+
+		if err := peer.SendMessage(StoreService{ServiceRecord: record}); err == nil {
+			stored++
+		}
+	}
+
+	if stored == 0 {
+		return ErrNoServiceHolders
+	}
+
+	return nil
+}
+
+// FindService returns the IDs of the nodes which registered a named service, as held by our node
+// and by the peers closest to the name throughout the network.
+func FindService(node *noise.Node, name string) []ID {
+	opcodeFindServiceResponse, err := noise.OpcodeFromMessage((*FindServiceResponse)(nil))
+	if err != nil {
+		panic("skademlia: response opcode not registered")
+	}
+
+	records := services(node).find(name)
+
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+
+	for _, id := range FindNode(node, serviceID(name), BucketSize(), 8) {
+		id := id
+
+		wait.Add(1)
+
+		node.Go(func(ctx context.Context) error {
+			defer wait.Done()
+
+			peer, err := connect(node, id)
+			if err != nil {
+				return nil
+			}
+
+			if err := peer.SendMessage(FindServiceRequest{Name: name}); err != nil {
+				return nil
+			}
+
+			select {
+			case msg := <-peer.Receive(opcodeFindServiceResponse):
+				res := msg.(FindServiceResponse)
+
+				if res.Name != name {
+					return nil
+				}
+
+				mutex.Lock()
+				for _, record := range res.Records {
+					if record.Name == name && record.verify(node.Clock().Now()) == nil {
+						records = append(records, record)
+					}
+				}
+				mutex.Unlock()
+			case <-node.Clock().After(3 * time.Second):
+			}
+
+			return nil
+		})
+	}
+
+	wait.Wait()
+
+	var providers []ID
+
+	seen := make(map[string]struct{})
+
+	for _, record := range records {
+		if _, exists := seen[string(record.ID.Hash())]; exists {
+			continue
+		}
+
+		seen[string(record.ID.Hash())] = struct{}{}
+		providers = append(providers, record.ID)
+	}
+
+	return providers
+}
+
+// serviceID is the ID whose hash positions a service within the DHT. Records of a service are held
+// by the peers closest to it.
+func serviceID(name string) ID {
+	key := blake2b.Sum256([]byte(serviceInfo + name))
+	return NewID("", key[:], nil)
+}
+
+// connect returns the peer our node is connected to under an ID, dialing the peer should our node
+// not yet be connected to it.
+func connect(node *noise.Node, id ID) (*noise.Peer, error) {
+	if peer := protocol.Peer(node, id); peer != nil {
+		return peer, nil
+	}
+
+	peer, err := node.Dial(id.address)
+	if err != nil {
+		return nil, err
+	}
+
+	WaitUntilAuthenticated(peer)
+
+	return peer, nil
+}
+
+// verify checks that a record is signed by the node it advertises, and has yet to expire as of a
+// given time.
+func (r ServiceRecord) verify(now time.Time) error {
+	if !now.Before(r.Expires) {
+		return errors.New("skademlia: service record has expired")
+	}
+
+	if r.Expires.After(now.Add(ServiceTTL + time.Minute)) {
+		return errors.New("skademlia: service record expires too far into the future")
+	}
+
+	if len(r.ID.publicKey) != edwards25519.PublicKeySize {
+		return errors.New("skademlia: service record was advertised by an invalid ID")
+	}
+
+	if !edwards25519.Verify(r.ID.publicKey, r.signingPayload(), r.Signature) {
+		return errors.New("skademlia: service record signature is invalid")
+	}
+
+	return nil
+}
+
+// serviceStore holds the service records peers asked our node to hold. Records are kept under the
+// length-prefixed name of their service followed by the hash of the ID advertising them.
+type serviceStore struct {
+	sync.Mutex
+	clock   clock.Clock
+	records kv.Store
+}
+
+func services(node *noise.Node) *serviceStore {
+	return node.LoadOrStore(keyServices, &serviceStore{clock: node.Clock(), records: kv.NewMemory()}).(*serviceStore)
+}
+
+// store holds a record, replacing any record of the same service by the same node. Should the
+// service already have the maximum number of records held, the record expiring soonest is dropped.
+func (s *serviceStore) store(record ServiceRecord) {
+	s.Lock()
+	defer s.Unlock()
+
+	batch := s.records.Batch()
+
+	records, err := s.load(record.Name, batch)
+	if err != nil {
+		log.Warn().Err(err).Str("service", record.Name).Msg("Failed to load service records.")
+		return
+	}
+
+	for i := range records {
+		if bytes.Equal(records[i].ID.Hash(), record.ID.Hash()) {
+			if !record.Expires.After(records[i].Expires) {
+				record = records[i]
+			}
+
+			records = append(records[:i], records[i+1:]...)
+			break
+		}
+	}
+
+	if len(records) >= maxServiceRecords {
+		soonest := 0
+
+		for i := range records {
+			if records[i].Expires.Before(records[soonest].Expires) {
+				soonest = i
+			}
+		}
+
+		batch.Delete(serviceKey(records[soonest]))
+	}
+
+	batch.Put(serviceKey(record), record.Write())
+
+	if err := batch.Commit(); err != nil {
+		log.Warn().Err(err).Str("service", record.Name).Msg("Failed to store a service record.")
+	}
+}
+
+func (s *serviceStore) find(name string) []ServiceRecord {
+	s.Lock()
+	defer s.Unlock()
+
+	batch := s.records.Batch()
+
+	records, err := s.load(name, batch)
+	if err != nil {
+		log.Warn().Err(err).Str("service", name).Msg("Failed to load service records.")
+		return nil
+	}
+
+	if err := batch.Commit(); err != nil {
+		log.Warn().Err(err).Str("service", name).Msg("Failed to delete expired service records.")
+	}
+
+	return records
+}
+
+// load reads the records of a service, skipping the records which have expired and deleting them
+// through a batch. It must be called with the store locked.
+func (s *serviceStore) load(name string, batch kv.Batch) ([]ServiceRecord, error) {
+	now := s.clock.Now()
+
+	var records []ServiceRecord
+
+	err := s.records.Iterate(servicePrefix(name), func(key, value []byte) error {
+		msg, err := ServiceRecord{}.Read(payload.NewReader(value))
+		if err != nil {
+			return errors.Wrapf(err, "service record %x is malformed", key)
+		}
+
+		if record := msg.(ServiceRecord); now.Before(record.Expires) {
+			records = append(records, record)
+		} else {
+			batch.Delete(append([]byte(nil), key...))
+		}
+
+		return nil
+	})
+
+	return records, err
+}
+
+func servicePrefix(name string) []byte {
+	return payload.NewWriter(nil).WriteString(name).Bytes()
+}
+
+func serviceKey(record ServiceRecord) []byte {
+	return append(servicePrefix(record.Name), record.ID.Hash()...)
+}
@@ -0,0 +1,125 @@
+package skademlia
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/internal/edwards25519"
+	"github.com/perlin-network/noise/kv"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newServiceNode(t *testing.T, layer transport.Layer) *noise.Node {
+	params := noise.DefaultParams()
+	params.Transport = layer
+	params.Keys = RandomKeys()
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	protocol.New().Register(New()).Enforce(node)
+
+	go node.Listen()
+
+	return node
+}
+
+func TestService(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	hub := newServiceNode(t, layer)
+	defer hub.Kill()
+
+	var nodes []*noise.Node
+
+	for i := 0; i < 3; i++ {
+		node := newServiceNode(t, layer)
+		defer node.Kill()
+
+		peer, err := node.Dial(hub.ExternalAddress())
+		assert.NoError(t, err)
+
+		WaitUntilAuthenticated(peer)
+
+		nodes = append(nodes, node)
+	}
+
+	// The hub logs peers into its table once they complete its side of the protocol.
+	for i := 0; i < 100 && len(Table(hub).GetPeers()) < len(nodes); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Empty(t, FindService(nodes[2], "chat/v1"))
+
+	assert.NoError(t, RegisterService(nodes[0], "chat/v1"))
+	assert.NoError(t, RegisterService(nodes[1], "chat/v1"))
+	assert.NoError(t, RegisterService(nodes[1], "files/v1"))
+
+	providers := FindService(nodes[2], "chat/v1")
+	assert.Len(t, providers, 2)
+
+	for _, id := range providers {
+		assert.True(t, id.Equals(protocol.NodeID(nodes[0])) || id.Equals(protocol.NodeID(nodes[1])))
+	}
+
+	providers = FindService(nodes[2], "files/v1")
+	assert.Len(t, providers, 1)
+	assert.True(t, providers[0].Equals(protocol.NodeID(nodes[1])))
+}
+
+func TestServiceRecord(t *testing.T) {
+	keys := RandomKeys()
+
+	record := ServiceRecord{
+		Name:    "chat/v1",
+		ID:      NewID("127.0.0.1:3000", keys.PublicKey(), keys.Nonce),
+		Expires: time.Now().Add(ServiceTTL),
+	}
+
+	record.Signature = edwards25519.Sign(keys.privateKey, record.signingPayload())
+	assert.NoError(t, record.verify(time.Now()))
+
+	msg, err := ServiceRecord{}.Read(payload.NewReader(record.Write()))
+	assert.NoError(t, err)
+	assert.NoError(t, msg.(ServiceRecord).verify(time.Now()))
+	assert.Equal(t, record.Name, msg.(ServiceRecord).Name)
+	assert.True(t, record.ID.Equals(msg.(ServiceRecord).ID))
+
+	// Records may not be re-targeted to another service, nor kept alive past their expiry.
+	forged := record
+	forged.Name = "files/v1"
+	assert.Error(t, forged.verify(time.Now()))
+
+	forged = record
+	forged.Expires = record.Expires.Add(time.Minute)
+	assert.Error(t, forged.verify(time.Now()))
+
+	expired := record
+	expired.Expires = time.Now().Add(-time.Second)
+	expired.Signature = edwards25519.Sign(keys.privateKey, expired.signingPayload())
+	assert.Error(t, expired.verify(time.Now()))
+
+	store := &serviceStore{clock: clock.New(), records: kv.NewMemory()}
+	store.store(record)
+	store.store(record)
+	store.store(expired)
+
+	assert.Len(t, store.find("chat/v1"), 1)
+
+	// Records outlive the store they were held through, and are kept apart from other services.
+	restored := &serviceStore{clock: clock.New(), records: store.records}
+	found := restored.find("chat/v1")
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, record.Write(), found[0].Write())
+	}
+
+	assert.Empty(t, restored.find("chat"))
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"container/list"
 	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
 	"github.com/perlin-network/noise/protocol"
 	"github.com/pkg/errors"
 	"sort"
@@ -256,14 +257,14 @@ func UpdateTable(node *noise.Node, target protocol.ID) (err error) {
 			// and do not push the target id into the bucket. Else, evict the candidate peer and push the target id to the
 			// front of the bucket.
 			evictLastPeer := func() {
-				lastPeer.Disconnect()
+				<-lastPeer.DisconnectWithReason(noise.ReasonTooManyPeers)
 
 				bucket.Remove(last)
 				bucket.PushFront(target)
 			}
 
 			evictTargetPeer := func() {
-				targetPeer.Disconnect()
+				<-targetPeer.DisconnectWithReason(noise.ReasonTooManyPeers)
 
 				bucket.MoveToFront(last)
 			}
@@ -279,7 +280,7 @@ func UpdateTable(node *noise.Node, target protocol.ID) (err error) {
 			select {
 			case <-lastPeer.Receive(opcodeEvict):
 				evictTargetPeer()
-			case <-time.After(3 * time.Second):
+			case <-node.Clock().After(3 * time.Second):
 				evictLastPeer()
 			}
 		default:
@@ -289,3 +290,61 @@ func UpdateTable(node *noise.Node, target protocol.ID) (err error) {
 
 	return nil
 }
+
+// exportTable writes the IDs within our nodes table, such that a table may be restored through
+// restoreTable.
+func exportTable(node *noise.Node) ([]byte, error) {
+	t := Table(node)
+
+	var ids []protocol.ID
+
+	for _, bucket := range t.buckets {
+		bucket.RLock()
+
+		for e := bucket.Back(); e != nil; e = e.Prev() {
+			if id := e.Value.(protocol.ID); !id.Equals(t.self) {
+				ids = append(ids, id)
+			}
+		}
+
+		bucket.RUnlock()
+	}
+
+	w := payload.NewWriter(nil).WriteUint32(uint32(len(ids)))
+
+	for _, id := range ids {
+		w.WriteBytes(id.(ID).Write())
+	}
+
+	return w.Bytes(), nil
+}
+
+// restoreTable inserts the IDs exported by exportTable into our nodes table. Peers behind the IDs
+// are dialed once they are next queried. IDs which do not fit into their bucket are skipped.
+func restoreTable(node *noise.Node, buf []byte) error {
+	t := Table(node)
+	reader := payload.NewReader(buf)
+
+	count, err := reader.ReadUint32()
+	if err != nil {
+		return errors.Wrap(err, "skademlia: failed to read number of IDs in table")
+	}
+
+	for i := uint32(0); i < count; i++ {
+		raw, err := reader.ReadBytes()
+		if err != nil {
+			return errors.Wrap(err, "skademlia: failed to read ID in table")
+		}
+
+		id, err := ID{}.Read(payload.NewReader(raw))
+		if err != nil {
+			return err
+		}
+
+		if err := t.Update(id.(ID)); err != nil && err != ErrBucketFull {
+			return errors.Wrap(err, "skademlia: failed to restore ID into table")
+		}
+	}
+
+	return nil
+}
@@ -292,3 +292,40 @@ func TestTable(t *testing.T) {
 	assert.NotNil(t, table)
 	assert.EqualValues(t, id, table.self)
 }
+
+func TestTableState(t *testing.T) {
+	keys := NewKeys(ttc1, ttc2)
+
+	params := noise.DefaultParams()
+	params.Keys = keys
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	go alice.Listen()
+	defer alice.Kill()
+
+	protocol.New().Register(New()).Enforce(alice)
+
+	assert.NoError(t, Table(alice).Update(ttid2))
+	assert.NoError(t, Table(alice).Update(ttid3))
+
+	snapshot, err := alice.ExportState()
+	assert.NoError(t, err)
+
+	// A node restored from the snapshot holds the peers within alices table.
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	go bob.Listen()
+	defer bob.Kill()
+
+	protocol.New().Register(New()).Enforce(bob)
+
+	assert.NoError(t, bob.ImportState(snapshot))
+
+	peers := Table(bob).GetPeers()
+	sort.Strings(peers)
+
+	assert.EqualValues(t, []string{ttid2.address, ttid3.address}, peers)
+}
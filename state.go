@@ -0,0 +1,233 @@
+package noise
+
+import (
+	"bytes"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"sort"
+	"time"
+)
+
+// stateVersion is bumped whenever the layout of snapshots produced by ExportState changes.
+const stateVersion = 1
+
+var stateMagic = []byte("noisestate")
+
+var (
+	ErrMalformedState = errors.New("noise: malformed state snapshot")
+	ErrStateIdentity  = errors.New("noise: state snapshot belongs to a node with a different identity")
+)
+
+// State is a snapshot of the state of a node, as produced by ExportState.
+type State struct {
+	Version uint32
+
+	// PublicKey and PrivateKey are the keys of the node the snapshot was taken of, and are empty
+	// should the node not have had any keys.
+	PublicKey, PrivateKey []byte
+
+	// Bans maps banned IPs to when their bans lift. Indefinite bans lift at the zero time.
+	Bans map[string]time.Time
+
+	// Sections holds the state of every component registered through RegisterState, by name.
+	Sections map[string][]byte
+}
+
+type stateSection struct {
+	export  func(node *Node) ([]byte, error)
+	restore func(node *Node, buf []byte) error
+}
+
+// RegisterState registers a section of state held by a component of our node, such as the routing
+// table of a protocol block, to be included in snapshots produced by ExportState under a name, and
+// to be restored by ImportState. Registering a name anew replaces the section registered prior.
+func (n *Node) RegisterState(name string, export func(node *Node) ([]byte, error), restore func(node *Node, buf []byte) error) {
+	n.stateSections.Store(name, stateSection{export: export, restore: restore})
+}
+
+// ExportState produces a versioned snapshot of the state of our node: its keys, the IPs it bans,
+// and every section of state registered through RegisterState. Snapshots hold our nodes private
+// key, and so must be stored as carefully as the key itself.
+func (n *Node) ExportState() ([]byte, error) {
+	w := payload.NewWriter(append([]byte(nil), stateMagic...)).WriteUint32(stateVersion)
+
+	if n.Keys != nil {
+		w.WriteBytes(n.Keys.PublicKey()).WriteBytes(n.Keys.PrivateKey())
+	} else {
+		w.WriteBytes(nil).WriteBytes(nil)
+	}
+
+	now := n.clock.Now()
+
+	var ips []string
+	bans := make(map[string]time.Time)
+
+	n.bans.Range(func(key, value interface{}) bool {
+		if until := value.(time.Time); until.IsZero() || now.Before(until) {
+			ips = append(ips, key.(string))
+			bans[key.(string)] = until
+		}
+		return true
+	})
+
+	sort.Strings(ips)
+
+	w.WriteUint32(uint32(len(ips)))
+
+	for _, ip := range ips {
+		var nanos uint64
+
+		if until := bans[ip]; !until.IsZero() {
+			nanos = uint64(until.UnixNano())
+		}
+
+		w.WriteString(ip).WriteUint64(nanos)
+	}
+
+	var names []string
+	sections := make(map[string]stateSection)
+
+	n.stateSections.Range(func(key, value interface{}) bool {
+		names = append(names, key.(string))
+		sections[key.(string)] = value.(stateSection)
+		return true
+	})
+
+	sort.Strings(names)
+
+	w.WriteUint32(uint32(len(names)))
+
+	for _, name := range names {
+		buf, err := sections[name].export(n)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to export state section %q", name)
+		}
+
+		w.WriteString(name).WriteBytes(buf)
+	}
+
+	return w.Bytes(), nil
+}
+
+// ImportState restores a snapshot produced by ExportState onto our node. Bans which have not yet
+// lifted are placed anew, and every section of state registered through RegisterState is restored.
+// Sections our node has not registered are skipped.
+//
+// Keys are not restored, as our node may not construct keys of an identity scheme it does not
+// know of. To clone a node, have ReadState read the private key off of the snapshot, load it into
+// keys of the scheme the node uses, and create a node with them. ImportState errors with
+// ErrStateIdentity should the snapshot have been taken of a node with different keys to ours.
+func (n *Node) ImportState(buf []byte) error {
+	state, err := ReadState(buf)
+	if err != nil {
+		return err
+	}
+
+	if len(state.PublicKey) > 0 && (n.Keys == nil || !bytes.Equal(n.Keys.PublicKey(), state.PublicKey)) {
+		return ErrStateIdentity
+	}
+
+	now := n.clock.Now()
+
+	for ip, until := range state.Bans {
+		if !until.IsZero() && now.After(until) {
+			continue
+		}
+
+		n.bans.Store(ip, until)
+		n.persistBan(ip, until)
+	}
+
+	for name, buf := range state.Sections {
+		section, registered := n.stateSections.Load(name)
+		if !registered {
+			log.Debug().Str("section", name).Msg("Skipped restoring a section of state which our node has not registered.")
+			continue
+		}
+
+		if err := section.(stateSection).restore(n, buf); err != nil {
+			return errors.Wrapf(err, "failed to restore state section %q", name)
+		}
+	}
+
+	return nil
+}
+
+// ReadState reads a snapshot produced by ExportState without restoring it.
+func ReadState(buf []byte) (State, error) {
+	if !bytes.HasPrefix(buf, stateMagic) {
+		return State{}, errors.Wrap(ErrMalformedState, "missing magic")
+	}
+
+	reader := payload.NewReader(buf[len(stateMagic):])
+
+	var state State
+	var err error
+
+	if state.Version, err = reader.ReadUint32(); err != nil {
+		return State{}, errors.Wrap(ErrMalformedState, "failed to read version")
+	}
+
+	if state.Version != stateVersion {
+		return State{}, errors.Wrapf(ErrMalformedState, "unsupported version %d", state.Version)
+	}
+
+	if state.PublicKey, err = reader.ReadBytes(); err != nil {
+		return State{}, errors.Wrap(ErrMalformedState, "failed to read public key")
+	}
+
+	if state.PrivateKey, err = reader.ReadBytes(); err != nil {
+		return State{}, errors.Wrap(ErrMalformedState, "failed to read private key")
+	}
+
+	numBans, err := reader.ReadUint32()
+	if err != nil {
+		return State{}, errors.Wrap(ErrMalformedState, "failed to read number of bans")
+	}
+
+	state.Bans = make(map[string]time.Time)
+
+	for i := uint32(0); i < numBans; i++ {
+		ip, err := reader.ReadString()
+		if err != nil {
+			return State{}, errors.Wrap(ErrMalformedState, "failed to read banned IP")
+		}
+
+		nanos, err := reader.ReadUint64()
+		if err != nil {
+			return State{}, errors.Wrapf(ErrMalformedState, "failed to read when the ban on %s lifts", ip)
+		}
+
+		var until time.Time
+
+		if nanos > 0 {
+			until = time.Unix(0, int64(nanos))
+		}
+
+		state.Bans[ip] = until
+	}
+
+	numSections, err := reader.ReadUint32()
+	if err != nil {
+		return State{}, errors.Wrap(ErrMalformedState, "failed to read number of sections")
+	}
+
+	state.Sections = make(map[string][]byte)
+
+	for i := uint32(0); i < numSections; i++ {
+		name, err := reader.ReadString()
+		if err != nil {
+			return State{}, errors.Wrap(ErrMalformedState, "failed to read section name")
+		}
+
+		section, err := reader.ReadBytes()
+		if err != nil {
+			return State{}, errors.Wrapf(ErrMalformedState, "failed to read section %q", name)
+		}
+
+		state.Sections[name] = section
+	}
+
+	return state, nil
+}
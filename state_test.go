@@ -0,0 +1,84 @@
+package noise
+
+import (
+	"github.com/perlin-network/noise/identity/ed25519"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestState(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := DefaultParams()
+	params.Transport = transport.NewBuffered()
+	params.Keys = ed25519.RandomKeys()
+
+	alice, err := NewNode(params)
+	assert.NoError(t, err)
+
+	go alice.Listen()
+	defer alice.Kill()
+
+	alice.Ban(net.ParseIP("10.0.0.1"), 0)
+	alice.Ban(net.ParseIP("10.0.0.2"), time.Minute)
+
+	counter := []byte("42")
+
+	alice.RegisterState("counter", func(node *Node) ([]byte, error) {
+		return counter, nil
+	}, nil)
+
+	snapshot, err := alice.ExportState()
+	assert.NoError(t, err)
+
+	state, err := ReadState(snapshot)
+	assert.NoError(t, err)
+	assert.EqualValues(t, stateVersion, state.Version)
+	assert.Equal(t, params.Keys.PrivateKey(), state.PrivateKey)
+	assert.Len(t, state.Bans, 2)
+	assert.True(t, state.Bans["10.0.0.1"].IsZero())
+	assert.Equal(t, "42", string(state.Sections["counter"]))
+
+	// Nodes may be cloned by loading the keys held by a snapshot, and importing the snapshot.
+	params.Keys = ed25519.LoadKeys(state.PrivateKey)
+
+	bob, err := NewNode(params)
+	assert.NoError(t, err)
+
+	go bob.Listen()
+	defer bob.Kill()
+
+	var restored []byte
+
+	bob.RegisterState("counter", nil, func(node *Node, buf []byte) error {
+		restored = buf
+		return nil
+	})
+
+	assert.NoError(t, bob.ImportState(snapshot))
+	assert.True(t, bob.IsBanned(net.ParseIP("10.0.0.1")))
+	assert.True(t, bob.IsBanned(net.ParseIP("10.0.0.2")))
+	assert.Equal(t, "42", string(restored))
+
+	// Snapshots may not be imported onto nodes of a different identity.
+	params.Keys = ed25519.RandomKeys()
+
+	carol, err := NewNode(params)
+	assert.NoError(t, err)
+
+	go carol.Listen()
+	defer carol.Kill()
+
+	assert.True(t, errors.Is(carol.ImportState(snapshot), ErrStateIdentity))
+	assert.False(t, carol.IsBanned(net.ParseIP("10.0.0.1")))
+
+	// Nor may malformed snapshots.
+	assert.True(t, errors.Is(bob.ImportState(snapshot[:len(snapshot)-1]), ErrMalformedState))
+	assert.True(t, errors.Is(bob.ImportState([]byte("garbage")), ErrMalformedState))
+}
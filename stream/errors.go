@@ -0,0 +1,196 @@
+package stream
+
+import (
+	"fmt"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"reflect"
+	"sync"
+)
+
+// maxErrorMessage is the number of bytes of the message of an error beyond which it is truncated
+// before being replied with, such that errors fit within a single chunk.
+const maxErrorMessage = 1024
+
+// Code classifies an error replied to a request, such that callers may tell failures apart without
+// parsing their messages.
+type Code uint32
+
+const (
+	// CodeUnknown classifies errors returned by handlers which are not of type Error.
+	CodeUnknown Code = iota
+	CodeInvalidArgument
+	CodeNotFound
+	CodePermissionDenied
+	CodeUnavailable
+	CodeInternal
+)
+
+func (c Code) String() string {
+	switch c {
+	case CodeUnknown:
+		return "unknown"
+	case CodeInvalidArgument:
+		return "invalid argument"
+	case CodeNotFound:
+		return "not found"
+	case CodePermissionDenied:
+		return "permission denied"
+	case CodeUnavailable:
+		return "unavailable"
+	case CodeInternal:
+		return "internal"
+	default:
+		return fmt.Sprintf("code %d", uint32(c))
+	}
+}
+
+// Error is an error a handler replies to a stream with, which is read by the sender of the stream
+// from its reply in place of the remainder of the reply.
+//
+// Errors match other errors of type Error under `errors.Is` should both share the same code, such
+// that sentinel errors may be declared as, for example, `&stream.Error{Code: stream.CodeNotFound}`.
+// Details which are errors themselves are unwrapped to, such that they may be matched against with
+// `errors.As`.
+type Error struct {
+	Code    Code
+	Message string
+
+	// Details is a message registered through RegisterDetails, carrying typed details of the error.
+	// Details read by a caller are nil should their type not be registered by the caller.
+	Details noise.Message
+}
+
+// Errorf returns an error under a code, with a message formatted as per fmt.Sprintf.
+func Errorf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// WithDetails attaches typed details to the error.
+func (e *Error) WithDetails(details noise.Message) *Error {
+	e.Details = details
+	return e
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("stream: %s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+func (e *Error) Unwrap() error {
+	err, _ := e.Details.(error)
+	return err
+}
+
+var (
+	details     = make(map[string]reflect.Type)
+	detailNames = make(map[reflect.Type]string)
+	detailsLock sync.RWMutex
+)
+
+// RegisterDetails registers a message type which errors may carry as their details, under a name
+// which both ends of a stream must register the type under. The name is sent along the details of
+// an error, such that the details are read back into a value of the same type by the caller.
+func RegisterDetails(name string, message noise.Message) {
+	if name == "" {
+		panic("stream: details must be registered under a name")
+	}
+
+	typ := reflect.TypeOf(message)
+
+	detailsLock.Lock()
+	details[name] = typ
+	detailNames[typ] = name
+	detailsLock.Unlock()
+}
+
+// encodeError encodes an error to be sent within the final chunk of a reply. Details whose type is
+// not registered are left out.
+func encodeError(e *Error) []byte {
+	message := e.Message
+	if len(message) > maxErrorMessage {
+		message = message[:maxErrorMessage]
+	}
+
+	writer := payload.NewWriter(nil).WriteUint32(uint32(e.Code)).WriteString(message)
+
+	var name string
+
+	if e.Details != nil {
+		detailsLock.RLock()
+		name = detailNames[reflect.TypeOf(e.Details)]
+		detailsLock.RUnlock()
+
+		if name == "" {
+			log.Warn().Str("type", reflect.TypeOf(e.Details).String()).Msg("Left out error details of a type which is not registered.")
+		}
+	}
+
+	writer.WriteString(name)
+
+	if name != "" {
+		writer.WriteBytes(e.Details.Write())
+	}
+
+	return writer.Bytes()
+}
+
+func decodeError(buf []byte) (*Error, error) {
+	reader := payload.NewReader(buf)
+
+	code, err := reader.ReadUint32()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read error code")
+	}
+
+	e := &Error{Code: Code(code)}
+
+	if e.Message, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read error message")
+	}
+
+	name, err := reader.ReadString()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read error details name")
+	}
+
+	if name == "" {
+		return e, nil
+	}
+
+	raw, err := reader.ReadBytes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read error details")
+	}
+
+	detailsLock.RLock()
+	typ, registered := details[name]
+	detailsLock.RUnlock()
+
+	if !registered {
+		return e, nil
+	}
+
+	if e.Details, err = reflect.Zero(typ).Interface().(noise.Message).Read(payload.NewReader(raw)); err != nil {
+		return nil, errors.Wrapf(err, "failed to read error details %q", name)
+	}
+
+	return e, nil
+}
+
+// toError maps an error returned by a handler to the error replied with. Errors of type Error are
+// replied with as is, and other errors are replied with under CodeUnknown.
+func toError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	return &Error{Code: CodeUnknown, Message: err.Error()}
+}
@@ -0,0 +1,826 @@
+// Package stream sends payloads larger than a single message to peers as a sequence of chunks,
+// and hands them to handlers through an io.Reader as chunks arrive, rather than buffering payloads
+// in their entirety.
+package stream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/resource"
+	"github.com/pkg/errors"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	keyBlock = "stream.block"
+	keyState = "stream.state"
+
+	DefaultChunkSize   = 64 * 1024
+	DefaultMaxBuffered = 4 * 1024 * 1024
+
+	DefaultRetryAfter = 1 * time.Second
+	DefaultMaxRetries = 3
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrReassemblyLimit = errors.New("stream: peer exceeded the reassembly memory limit")
+	ErrAborted         = errors.New("stream: sender aborted the stream")
+	ErrWriteClosed     = errors.New("stream: stream was half-closed; no more data may be written")
+	ErrBusy            = errors.New("stream: peer is handling too many streams from us at once")
+
+	errCanceled = errors.New("stream: request was canceled")
+)
+
+// BusyError is read from the reply to a stream which a peer refused, as it was handling too many
+// streams from us at once. It matches ErrBusy.
+type BusyError struct {
+	// RetryAfter is how long the peer asks us to wait before opening the stream anew.
+	RetryAfter time.Duration
+}
+
+func (e BusyError) Error() string {
+	return fmt.Sprintf("%s; retry after %s", ErrBusy, e.RetryAfter)
+}
+
+// Cause returns ErrBusy such that callers using `errors.Cause` may match against it.
+func (e BusyError) Cause() error {
+	return ErrBusy
+}
+
+func (e BusyError) Is(target error) bool {
+	return target == ErrBusy
+}
+
+// Handler reads a stream sent by a peer. The stream is discarded once the handler returns, and the
+// reply to the stream is closed should the handler not have closed it itself.
+type Handler func(node *noise.Node, peer *noise.Peer, r io.Reader) error
+
+type block struct {
+	opcodeChunk noise.Opcode
+
+	chunkSize   int
+	maxBuffered int
+
+	maxInFlight int
+	retryAfter  time.Duration
+	maxRetries  int
+
+	hedgeAfter      time.Duration
+	hedgePercentile float64
+	latencies       *latencies
+
+	replies *replyCache
+
+	handler   Handler
+	mapErrors func(err error) *Error
+}
+
+// New returns a block which streams payloads to peers in chunks. Every chunk is sent as a message
+// of its own, such that chunks are decrypted one by one as they arrive, and are read by a handler
+// registered through OnStream as they arrive.
+//
+// Chunks which have arrived yet have not been read are buffered, with the total size of chunks
+// buffered for all streams of a peer capped. Peers that exceed the cap are disconnected.
+//
+// By default, payloads are sent in chunks of 64 KiB, and 4 MiB may be buffered per peer. Chunks
+// must fit within the maximum message size of both nodes. Peers may have any number of streams
+// handled at once unless capped through WithMaxInFlight.
+func New() *block {
+	return &block{
+		chunkSize:   DefaultChunkSize,
+		maxBuffered: DefaultMaxBuffered,
+		retryAfter:  DefaultRetryAfter,
+		maxRetries:  DefaultMaxRetries,
+
+		hedgeAfter:      DefaultHedgeAfter,
+		hedgePercentile: DefaultHedgePercentile,
+		latencies:       new(latencies),
+
+		replies: newReplyCache(DefaultIdempotentCache),
+
+		mapErrors: toError,
+	}
+}
+
+// WithChunkSize sets the maximum number of bytes sent within a single chunk.
+func (b *block) WithChunkSize(size int) *block {
+	if size <= 0 {
+		panic("stream: chunk size must be positive")
+	}
+
+	b.chunkSize = size
+	return b
+}
+
+// WithMaxBuffered sets the maximum number of bytes that may be buffered for all streams of a peer
+// which have arrived, yet have not been read.
+func (b *block) WithMaxBuffered(size int) *block {
+	b.maxBuffered = size
+	return b
+}
+
+// WithMaxInFlight caps the number of streams from a single peer which may be handled at once, such
+// that heavy peers may not exhaust the handlers of our node. Streams opened beyond the cap are
+// refused, and the peer reads a BusyError from their reply. Zero lifts the cap.
+func (b *block) WithMaxInFlight(max int) *block {
+	b.maxInFlight = max
+	return b
+}
+
+// WithRetryAfter sets how long peers whose streams are refused are asked to wait before opening
+// them anew. By default, peers are asked to wait 1 second.
+func (b *block) WithRetryAfter(retryAfter time.Duration) *block {
+	b.retryAfter = retryAfter
+	return b
+}
+
+// WithMaxRetries sets how many times Request opens a stream anew after waiting as asked should
+// the peer refuse it for being busy. By default, requests are retried 3 times.
+func (b *block) WithMaxRetries(retries int) *block {
+	b.maxRetries = retries
+	return b
+}
+
+// WithHedgePercentile sets the percentile of latencies of recent requests after which hedged
+// requests are sent to the next peer. By default, requests are hedged after the 95th percentile.
+func (b *block) WithHedgePercentile(percentile float64) *block {
+	if percentile <= 0 || percentile > 1 {
+		panic("stream: hedge percentile must be within (0, 1]")
+	}
+
+	b.hedgePercentile = percentile
+	return b
+}
+
+// WithHedgeAfter sets how long hedged requests wait on a peer before being sent to the next peer
+// until enough requests have been made to measure a percentile of their latencies.
+func (b *block) WithHedgeAfter(delay time.Duration) *block {
+	b.hedgeAfter = delay
+	return b
+}
+
+// WithIdempotentCache sets the number of replies to requests cached by their idempotency keys, such
+// that retries of requests already replied to are replayed their reply instead of being handled
+// anew. By default, the replies to the 1024 most recent requests are cached.
+func (b *block) WithIdempotentCache(size int) *block {
+	b.replies = newReplyCache(size)
+	return b
+}
+
+// OnStream sets the handler which reads streams sent by peers. Without a handler, streams are
+// discarded as they arrive.
+func (b *block) OnStream(handler Handler) *block {
+	b.handler = handler
+	return b
+}
+
+// WithErrorMapper sets the function which maps errors returned by the handler to the errors replied
+// with, such as to classify errors of an application under codes of its own, or to keep the
+// messages of internal errors from being replied to peers. By default, errors of type Error are
+// replied with as is, and other errors are replied with their message under CodeUnknown.
+func (b *block) WithErrorMapper(mapErrors func(err error) *Error) *block {
+	b.mapErrors = mapErrors
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeChunk = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Chunk)(nil))
+
+	node.Set(keyBlock, b)
+
+	// Streams are received from the moment a peer connects, as the peer may complete the protocol
+	// and open streams to us before we have completed it ourselves.
+	node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+		s := newState(b, peer)
+		peer.Set(keyState, s)
+
+		peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+			s.close()
+			return nil
+		})
+
+		return nil
+	})
+
+	node.OnMessageReceived(b.opcodeChunk, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		s, ok := peer.Get(keyState).(*state)
+		if !ok {
+			return nil
+		}
+
+		if err := s.receive(message.(Chunk)); err != nil {
+			peer.DisconnectAsync()
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	s, ok := peer.Get(keyState).(*state)
+	if !ok {
+		return errors.New("stream: peer was not initialized by the block")
+	}
+
+	s.Lock()
+	s.established = true
+	s.Unlock()
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Send streams the contents of a reader to a peer until the reader is exhausted. Should reading
+// fail midway, the stream is aborted, and the handler of the peer reads ErrAborted. Any reply the
+// handler of the peer sends back is discarded.
+func Send(peer *noise.Peer, r io.Reader) error {
+	s, err := establishedState(peer)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	id := s.next
+	s.next++
+	s.Unlock()
+
+	buf := make([]byte, s.block.chunkSize)
+
+	for continued := false; ; continued = true {
+		n, err := io.ReadFull(r, buf)
+
+		switch err {
+		case nil:
+			if err := peer.SendMessage(Chunk{Stream: id, Data: buf[:n], Continued: continued}); err != nil {
+				return errors.Wrap(err, "stream: failed to send chunk")
+			}
+		case io.EOF, io.ErrUnexpectedEOF:
+			return errors.Wrap(peer.SendMessage(Chunk{Stream: id, Data: buf[:n], Final: true, Continued: continued}), "stream: failed to send final chunk")
+		default:
+			peer.SendMessageAsync(Chunk{Stream: id, Abort: true, Continued: continued})
+			return errors.Wrap(err, "stream: failed to read contents to stream")
+		}
+	}
+}
+
+// Open opens a stream to a peer over which data may be written, and over which the handler of the
+// peer may reply. Once all data is written, the stream is half-closed through CloseWrite, and the
+// reply of the peer may continue to be read until the peer closes the reply in turn. This suits
+// request/streaming-response patterns.
+func Open(peer *noise.Peer) (*Stream, error) {
+	return open(peer, nil)
+}
+
+// open opens a stream to a peer, whose first chunk carries an idempotency key should one be given.
+func open(peer *noise.Peer, key []byte) (*Stream, error) {
+	s, err := establishedState(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	id := s.next
+	s.next++
+
+	r := &reader{state: s}
+	s.replies[id] = r
+
+	return &Stream{r: r, w: &writer{block: s.block, peer: peer, id: id, key: key}}, nil
+}
+
+// Reply returns a writer over which the handler of a stream may reply to the peer which opened the
+// stream. The reader must be the one handed to the handler. Closing the writer half-closes the
+// reply, signalling to the peer that no more data will be written.
+func Reply(r io.Reader) (io.WriteCloser, error) {
+	stream, ok := r.(*reader)
+	if !ok || stream.reply == nil {
+		return nil, errors.New("stream: reader was not handed to a stream handler")
+	}
+
+	return stream.reply, nil
+}
+
+// Stream is a stream opened to a peer. Data written to it is sent to the peer, and data read from
+// it is the reply of the peer.
+type Stream struct {
+	r *reader
+	w *writer
+}
+
+// Read reads the reply of the peer. It returns io.EOF once the peer has closed its reply.
+func (s *Stream) Read(buf []byte) (int, error) {
+	return s.r.Read(buf)
+}
+
+// Write sends data to the peer in chunks. It fails with ErrWriteClosed once the stream is
+// half-closed.
+func (s *Stream) Write(buf []byte) (int, error) {
+	return s.w.Write(buf)
+}
+
+// CloseWrite half-closes the stream, signalling to the peer that no more data will be written,
+// while its reply may continue to be read.
+func (s *Stream) CloseWrite() error {
+	return s.w.Close()
+}
+
+// cancel gives up on a stream. The peer is sent an abort should the stream not have been
+// half-closed yet, and the remainder of the reply of the peer is dropped as it arrives.
+func (s *Stream) cancel() {
+	s.w.abort()
+
+	state := s.r.state
+
+	state.Lock()
+	defer state.Unlock()
+
+	if state.replies[s.w.id] == s.r {
+		delete(state.replies, s.w.id)
+	}
+
+	if s.r.err == nil {
+		s.r.err = errCanceled
+	}
+
+	state.discard(s.r)
+	state.cond.Broadcast()
+}
+
+var _ io.WriteCloser = (*writer)(nil)
+
+// writer sends data over a stream, or over the reply to a stream, in chunks.
+type writer struct {
+	sync.Mutex
+
+	block *block
+	peer  *noise.Peer
+
+	id     uint64
+	reply  bool
+	closed bool
+
+	// opened is set once the first chunk of the stream is sent, after which every chunk is marked
+	// continued.
+	opened bool
+
+	// key is sent along the first chunk of a stream, after which it is cleared.
+	key []byte
+
+	// record records the reply to a request with an idempotency key, such that the reply may be
+	// replayed should the request be retried. It is cleared should the reply grow too large.
+	record *bytes.Buffer
+}
+
+func (w *writer) Write(buf []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closed {
+		return 0, ErrWriteClosed
+	}
+
+	written := 0
+
+	for written < len(buf) {
+		n := len(buf) - written
+		if n > w.block.chunkSize {
+			n = w.block.chunkSize
+		}
+
+		if err := w.send(Chunk{Data: buf[written : written+n], Key: w.key}); err != nil {
+			return written, errors.Wrap(err, "stream: failed to send chunk")
+		}
+
+		if w.record != nil {
+			if w.record.Len()+n > w.block.maxBuffered {
+				w.record = nil
+			} else {
+				w.record.Write(buf[written : written+n])
+			}
+		}
+
+		w.key = nil
+		written += n
+	}
+
+	return written, nil
+}
+
+func (w *writer) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	w.closed = true
+
+	return errors.Wrap(w.send(Chunk{Final: true, Key: w.key}), "stream: failed to send final chunk")
+}
+
+// send sends a chunk of the stream. It must be called with the lock held.
+func (w *writer) send(chunk Chunk) error {
+	chunk.Stream, chunk.Reply, chunk.Continued = w.id, w.reply, w.opened
+	w.opened = true
+
+	return w.peer.SendMessage(chunk)
+}
+
+// abort aborts a stream which has not been half-closed yet, such that the handler of the peer reads
+// ErrAborted. Streams which were already half-closed are left as is.
+func (w *writer) abort() {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	w.closed = true
+
+	w.peer.SendMessageAsync(Chunk{Stream: w.id, Abort: true, Reply: w.reply, Continued: w.opened})
+}
+
+// fail closes the reply to a stream with an error in place of the remainder of the reply. Replies
+// which failed are not recorded, such that retries of the request are handled anew. Replies which
+// were already closed are left as is.
+func (w *writer) fail(e *Error) error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	w.closed, w.record = true, nil
+
+	return errors.Wrap(w.send(Chunk{Data: encodeError(e), Abort: true, Error: true, Key: w.key}), "stream: failed to send error")
+}
+
+// state holds all streams being received from a single peer.
+type state struct {
+	sync.Mutex
+	cond *sync.Cond
+
+	block *block
+	peer  *noise.Peer
+
+	buffered int
+	streams  map[uint64]*reader
+	closed   bool
+
+	// inFlight is the number of streams from the peer being handled.
+	inFlight int
+
+	// replies holds the replies to streams we opened to the peer.
+	replies map[uint64]*reader
+
+	next uint64
+
+	// established is set once the peer completes the block, after which streams may be opened to
+	// the peer.
+	established bool
+}
+
+// establishedState returns the state of a peer which has completed the block.
+func establishedState(peer *noise.Peer) (*state, error) {
+	s, ok := peer.Get(keyState).(*state)
+	if !ok {
+		return nil, errors.New("stream: peer has not completed the block")
+	}
+
+	s.Lock()
+	established := s.established
+	s.Unlock()
+
+	if !established {
+		return nil, errors.New("stream: peer has not completed the block")
+	}
+
+	return s, nil
+}
+
+func newState(b *block, peer *noise.Peer) *state {
+	s := &state{block: b, peer: peer, streams: make(map[uint64]*reader), replies: make(map[uint64]*reader)}
+	s.cond = sync.NewCond(&s.Mutex)
+
+	return s
+}
+
+func (s *state) receive(chunk Chunk) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	streams := s.streams
+	if chunk.Reply {
+		streams = s.replies
+	}
+
+	r, exists := streams[chunk.Stream]
+
+	if !exists {
+		// Replies to streams we did not open, or no longer read, are discarded.
+		if chunk.Abort || chunk.Reply {
+			return nil
+		}
+
+		r = &reader{state: s, discard: s.block.handler == nil}
+		r.reply = &writer{block: s.block, peer: s.peer, id: chunk.Stream, reply: true}
+
+		streams[chunk.Stream] = r
+
+		var cached []byte
+		var done, seen bool
+
+		if chunk.Key != nil && !r.discard {
+			cached, done, seen = s.block.replies.lookup(string(chunk.Key))
+		}
+
+		switch {
+		case chunk.Continued:
+			// The first chunk of the stream never arrived, and so the stream is refused rather than
+			// handled as though it were whole.
+			r.discard = true
+			s.spawn(func() {
+				if err := r.reply.fail(Errorf(CodeUnavailable, "the first chunk of stream %d was never received", chunk.Stream)); err != nil {
+					log.Warn().Err(err).Msg("Got an error refusing a stream.")
+				}
+			})
+		case done:
+			// The request was already replied to, so its reply is replayed.
+			r.discard, r.reply.closed = true, true
+			s.spawn(func() { s.replay(chunk.Stream, cached) })
+		case seen, !r.discard && s.block.maxInFlight > 0 && s.inFlight >= s.block.maxInFlight:
+			// Retries of requests still being handled, and streams beyond the cap, are refused.
+			r.discard, r.reply.closed = true, true
+			s.spawn(func() { s.refuse(chunk.Stream) })
+		default:
+			if !r.discard {
+				s.inFlight++
+			}
+
+			if chunk.Key != nil && !r.discard {
+				r.key = string(chunk.Key)
+				r.reply.record = new(bytes.Buffer)
+
+				s.block.replies.begin(r.key)
+			}
+
+			s.spawn(func() { s.handle(r) })
+		}
+	}
+
+	if chunk.Final || chunk.Abort {
+		delete(streams, chunk.Stream)
+	}
+
+	if r.discard {
+		return nil
+	}
+
+	if chunk.Abort && chunk.Error {
+		e, err := decodeError(chunk.Data)
+		if err != nil {
+			r.err = io.ErrUnexpectedEOF
+			s.cond.Broadcast()
+
+			return errors.Wrap(err, "stream: peer replied with a malformed error")
+		}
+
+		r.err = e
+		s.cond.Broadcast()
+
+		return nil
+	}
+
+	if s.buffered+len(chunk.Data) > s.block.maxBuffered {
+		r.err = ErrReassemblyLimit
+		s.cond.Broadcast()
+
+		return errors.Wrapf(ErrReassemblyLimit, "buffering %d more bytes would exceed the limit of %d bytes", len(chunk.Data), s.block.maxBuffered)
+	}
+
+	if len(chunk.Data) > 0 {
+		if err := s.peer.Node().Resources().Reserve(s.peer, resource.ProtocolStream, uint64(len(chunk.Data))); err != nil {
+			r.err = err
+			s.cond.Broadcast()
+
+			return err
+		}
+
+		r.chunks = append(r.chunks, chunk.Data)
+		s.buffered += len(chunk.Data)
+	}
+
+	if chunk.Final {
+		r.final = true
+	}
+
+	if chunk.Abort {
+		r.err = ErrAborted
+
+		if chunk.Busy {
+			r.err = BusyError{RetryAfter: chunk.RetryAfter}
+		}
+	}
+
+	s.cond.Broadcast()
+
+	return nil
+}
+
+// handle runs the handler of the block on a stream, and discards the remainder of the stream once
+// the handler returns. The reply to the stream is then closed, such that the sender of the stream
+// does not wait on a reply which will never come.
+// spawn runs fn in a goroutine tracked by the node of our peer.
+func (s *state) spawn(fn func()) {
+	s.peer.Node().Go(func(ctx context.Context) error {
+		fn()
+		return nil
+	})
+}
+
+func (s *state) handle(r *reader) {
+	var failure *Error
+
+	if s.block.handler != nil {
+		if err := s.block.handler(s.peer.Node(), s.peer, r); err != nil {
+			log.Warn().Err(err).Msg("Got an error handling a stream.")
+			failure = s.block.mapErrors(err)
+		}
+	}
+
+	s.Lock()
+
+	if !r.discard {
+		s.inFlight--
+	}
+
+	r.discard = true
+
+	s.discard(r)
+
+	closed := s.closed
+
+	s.Unlock()
+
+	if closed {
+		if r.key != "" {
+			s.block.replies.forget(r.key)
+		}
+
+		return
+	}
+
+	var err error
+
+	if failure != nil {
+		err = r.reply.fail(failure)
+	} else {
+		err = r.reply.Close()
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Msg("Got an error closing the reply to a stream.")
+	}
+
+	if r.key != "" {
+		r.reply.Lock()
+		record := r.reply.record
+		r.reply.Unlock()
+
+		if err != nil || record == nil {
+			s.block.replies.forget(r.key)
+		} else {
+			s.block.replies.complete(r.key, record.Bytes())
+		}
+	}
+}
+
+// replay replays the cached reply to a request which the peer retried.
+func (s *state) replay(id uint64, reply []byte) {
+	w := &writer{block: s.block, peer: s.peer, id: id, reply: true}
+
+	if _, err := w.Write(reply); err != nil {
+		log.Warn().Err(err).Msg("Got an error replaying the reply to a request.")
+		return
+	}
+
+	if err := w.Close(); err != nil {
+		log.Warn().Err(err).Msg("Got an error replaying the reply to a request.")
+	}
+}
+
+// refuse refuses a stream from the peer, as the peer has too many streams being handled at once.
+func (s *state) refuse(id uint64) {
+	if err := s.peer.SendMessage(Chunk{Stream: id, Reply: true, Abort: true, Busy: true, RetryAfter: s.block.retryAfter}); err != nil {
+		log.Warn().Err(err).Msg("Got an error refusing a stream.")
+	}
+}
+
+func (s *state) close() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.closed = true
+
+	for _, streams := range []map[uint64]*reader{s.streams, s.replies} {
+		for id, r := range streams {
+			if r.err == nil {
+				r.err = io.ErrUnexpectedEOF
+			}
+
+			s.discard(r)
+			delete(streams, id)
+		}
+	}
+
+	s.cond.Broadcast()
+}
+
+// discard drops the chunks of a stream which have not been read. It must be called with the lock
+// held.
+func (s *state) discard(r *reader) {
+	for _, chunk := range r.chunks {
+		s.unbuffer(len(chunk))
+	}
+
+	r.chunks = nil
+}
+
+// unbuffer releases bytes of chunks which have been read or dropped. It must be called with the
+// lock held.
+func (s *state) unbuffer(n int) {
+	s.buffered -= n
+	s.peer.Node().Resources().Release(s.peer, resource.ProtocolStream, uint64(n))
+}
+
+var _ io.Reader = (*reader)(nil)
+
+// reader yields the chunks of a stream as they arrive.
+type reader struct {
+	state *state
+
+	chunks [][]byte
+	final  bool
+	err    error
+
+	// discard is set once the stream no longer has a handler reading it.
+	discard bool
+
+	// reply is the writer over which the handler of a stream received replies to its sender.
+	reply *writer
+
+	// key is the idempotency key of a request received over the stream.
+	key string
+}
+
+func (r *reader) Read(buf []byte) (int, error) {
+	s := r.state
+
+	s.Lock()
+	defer s.Unlock()
+
+	for len(r.chunks) == 0 && !r.final && r.err == nil {
+		s.cond.Wait()
+	}
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(buf, r.chunks[0])
+
+	if n == len(r.chunks[0]) {
+		r.chunks = r.chunks[1:]
+	} else {
+		r.chunks[0] = r.chunks[0][n:]
+	}
+
+	s.unbuffer(n)
+
+	return n, nil
+}
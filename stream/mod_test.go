@@ -0,0 +1,642 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/resource"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type result struct {
+	buf []byte
+	err error
+}
+
+func setup(t *testing.T, receiver *block) (*noise.Node, *noise.Node, *noise.Peer) {
+	layer := transport.NewBuffered()
+
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	protocol.New().Register(New().WithChunkSize(4096)).Enforce(alice)
+	protocol.New().Register(receiver).Enforce(bob)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	// Bob must have completed the protocol with alice as well.
+	time.Sleep(50 * time.Millisecond)
+
+	return alice, bob, peer
+}
+
+func TestStream(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	results := make(chan result, 2)
+
+	alice, bob, peer := setup(t, New().OnStream(func(node *noise.Node, peer *noise.Peer, r io.Reader) error {
+		buf, err := ioutil.ReadAll(r)
+		results <- result{buf: buf, err: err}
+
+		return nil
+	}))
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	payload := make([]byte, 1024*1024+123)
+	_, err := rand.Read(payload)
+	assert.NoError(t, err)
+
+	// Payloads larger than the maximum message size are streamed in chunks.
+	assert.NoError(t, Send(peer, bytes.NewReader(payload)))
+
+	select {
+	case res := <-results:
+		assert.NoError(t, res.err)
+		assert.True(t, bytes.Equal(payload, res.buf))
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob never read the stream")
+	}
+
+	// Empty streams are handed to the handler as well.
+	assert.NoError(t, Send(peer, bytes.NewReader(nil)))
+
+	select {
+	case res := <-results:
+		assert.NoError(t, res.err)
+		assert.Empty(t, res.buf)
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob never read the empty stream")
+	}
+
+	// Streams which the sender fails to read midway are aborted.
+	assert.Error(t, Send(peer, io.MultiReader(bytes.NewReader(payload[:10000]), &failingReader{})))
+
+	select {
+	case res := <-results:
+		assert.True(t, errors.Cause(res.err) == ErrAborted)
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob never read the aborted stream")
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("failed to read")
+}
+
+func TestReassemblyLimit(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	block := make(chan struct{})
+
+	alice, bob, peer := setup(t, New().WithMaxBuffered(16*1024).OnStream(func(node *noise.Node, peer *noise.Peer, r io.Reader) error {
+		<-block
+		return nil
+	}))
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	// Killing bob waits on his handler, so the handler is unblocked first.
+	defer close(block)
+
+	disconnected := make(chan struct{})
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	// Bob buffers no more than 16 KiB for a handler that never reads, and disconnects alice should
+	// she send any more.
+	_ = Send(peer, bytes.NewReader(make([]byte, 64*1024)))
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not disconnect alice after she exceeded the reassembly limit")
+	}
+}
+
+func TestResourceLimit(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	params := noise.DefaultParams()
+	params.Transport = transport.NewBuffered()
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer alice.Kill()
+
+	params.Resources = resource.NewManager(resource.Limits{Protocols: map[string]uint64{resource.ProtocolStream: 16 * 1024}})
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+	defer bob.Kill()
+
+	block := make(chan struct{})
+	defer close(block)
+
+	results := make(chan result, 1)
+
+	var handled int32
+
+	protocol.New().Register(New().WithChunkSize(4096)).Enforce(alice)
+	protocol.New().Register(New().OnStream(func(node *noise.Node, peer *noise.Peer, r io.Reader) error {
+		// Only the first stream is read.
+		if atomic.AddInt32(&handled, 1) > 1 {
+			<-block
+			return nil
+		}
+
+		buf, err := ioutil.ReadAll(r)
+		results <- result{buf: buf, err: err}
+
+		return nil
+	})).Enforce(bob)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Memory reserved for chunks is released once they are read.
+	assert.NoError(t, Send(peer, bytes.NewReader(make([]byte, 64*1024))))
+
+	select {
+	case res := <-results:
+		assert.NoError(t, res.err)
+		assert.Len(t, res.buf, 64*1024)
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob never read the stream")
+	}
+
+	assert.EqualValues(t, 0, bob.Resources().Usage().Protocols[resource.ProtocolStream])
+
+	disconnected := make(chan struct{})
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	// Bob disconnects alice should her streams exceed the memory he may reserve for streams.
+	_ = Send(peer, bytes.NewReader(make([]byte, 64*1024)))
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob did not disconnect alice after she exceeded his memory limit")
+	}
+}
+
+func TestHalfClose(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	alice, bob, peer := setup(t, New().OnStream(func(node *noise.Node, peer *noise.Peer, r io.Reader) error {
+		buf, err := ioutil.ReadAll(r)
+		if err != nil || string(buf) == "no reply" {
+			return err
+		}
+
+		w, err := Reply(r)
+		if err != nil {
+			return err
+		}
+
+		// Bob only replies once alice has half-closed her stream.
+		for i := 0; i < 3; i++ {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+		}
+
+		return w.Close()
+	}))
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	s, err := Open(peer)
+	assert.NoError(t, err)
+
+	_, err = s.Write([]byte("hello"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.CloseWrite())
+
+	_, err = s.Write([]byte("hello"))
+	assert.True(t, errors.Cause(err) == ErrWriteClosed)
+
+	reply, err := ioutil.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Equal(t, "hellohellohello", string(reply))
+
+	// The reply to a stream is closed once the handler returns, should the handler not reply.
+	s, err = Open(peer)
+	assert.NoError(t, err)
+
+	_, err = s.Write([]byte("no reply"))
+	assert.NoError(t, err)
+	assert.NoError(t, s.CloseWrite())
+
+	reply, err = ioutil.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Empty(t, reply)
+}
+
+func TestMissingFirstChunk(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	var handled int32
+
+	alice, bob, peer := setup(t, New().OnStream(echo(&handled)))
+	defer alice.Kill()
+	defer bob.Kill()
+
+	s, err := Open(peer)
+	assert.NoError(t, err)
+
+	// Have the first chunk alice sends be marked as though an earlier chunk was lost.
+	s.w.opened = true
+
+	_, err = s.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, s.CloseWrite())
+
+	// Bob refuses the stream, rather than handling it as though it were whole.
+	_, err = ioutil.ReadAll(s)
+	assert.True(t, errors.Is(err, &Error{Code: CodeUnavailable}), err)
+	assert.EqualValues(t, 0, atomic.LoadInt32(&handled))
+}
+
+func TestMaxInFlight(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	release := make(chan struct{})
+
+	alice, bob, peer := setup(t, New().WithMaxInFlight(1).WithRetryAfter(50*time.Millisecond).OnStream(func(node *noise.Node, peer *noise.Peer, r io.Reader) error {
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		if string(buf) == "block" {
+			<-release
+			buf = []byte("done")
+		}
+
+		w, err := Reply(r)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(buf)
+		return err
+	}))
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	blocked, err := Open(peer)
+	assert.NoError(t, err)
+
+	_, err = blocked.Write([]byte("block"))
+	assert.NoError(t, err)
+	assert.NoError(t, blocked.CloseWrite())
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Bob refuses streams beyond the one he is handling for alice.
+	refused, err := Open(peer)
+	assert.NoError(t, err)
+
+	_, err = refused.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, refused.CloseWrite())
+
+	_, err = ioutil.ReadAll(refused)
+	assert.True(t, errors.Is(err, ErrBusy))
+
+	var busy BusyError
+	assert.True(t, errors.As(err, &busy))
+	assert.Equal(t, 50*time.Millisecond, busy.RetryAfter)
+
+	// Requests are retried after waiting as long as bob asks for.
+	go func() {
+		time.Sleep(75 * time.Millisecond)
+		close(release)
+	}()
+
+	reply, err := Request(peer, []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(reply))
+
+	reply, err = ioutil.ReadAll(blocked)
+	assert.NoError(t, err)
+	assert.Equal(t, "done", string(reply))
+}
+
+func echo(handled *int32) Handler {
+	return func(node *noise.Node, peer *noise.Peer, r io.Reader) error {
+		atomic.AddInt32(handled, 1)
+
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		w, err := Reply(r)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(buf)
+		return err
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	var handled int32
+
+	alice, bob, peer := setup(t, New().OnStream(echo(&handled)))
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	key, err := newKey()
+	assert.NoError(t, err)
+
+	// Retries of a request already replied to are replayed the reply instead of being handled anew.
+	for i := 0; i < 3; i++ {
+		reply, err := requestWithKey(peer, []byte("hello"), key)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(reply))
+	}
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&handled))
+
+	reply, err := Request(peer, []byte("world"))
+	assert.NoError(t, err)
+	assert.Equal(t, "world", string(reply))
+
+	assert.EqualValues(t, 2, atomic.LoadInt32(&handled))
+}
+
+func TestRequestHedged(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	var nodes []*noise.Node
+
+	for i := 0; i < 3; i++ {
+		node, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		defer node.Kill()
+		go node.Listen()
+
+		nodes = append(nodes, node)
+	}
+
+	alice, bob, carol := nodes[0], nodes[1], nodes[2]
+
+	release := make(chan struct{})
+	defer close(release)
+
+	var handled int32
+
+	protocol.New().Register(New().WithHedgeAfter(20 * time.Millisecond)).Enforce(alice)
+	protocol.New().Register(New().OnStream(func(node *noise.Node, peer *noise.Peer, r io.Reader) error {
+		<-release
+		return nil
+	})).Enforce(bob)
+	protocol.New().Register(New().OnStream(echo(&handled))).Enforce(carol)
+
+	var peers []*noise.Peer
+
+	for _, node := range []*noise.Node{bob, carol} {
+		peer, err := alice.Dial(node.ExternalAddress())
+		assert.NoError(t, err)
+		assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+		peers = append(peers, peer)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Bob never replies, so the request is hedged to carol, whose reply is returned.
+	start := time.Now()
+
+	reply, err := RequestHedged(peers, []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(reply))
+
+	assert.True(t, time.Since(start) < 1*time.Second)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&handled))
+
+	// The request to bob is canceled, and only the latency of carol replying is recorded.
+	s := peers[0].Get(keyState).(*state)
+
+	s.Lock()
+	assert.Empty(t, s.replies)
+	s.Unlock()
+
+	latencies := s.block.latencies
+
+	latencies.Lock()
+	assert.Len(t, latencies.samples, 1)
+	latencies.Unlock()
+}
+
+func TestPersistent(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	var handled int32
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	alice, bob, _ := setup(t, New().OnStream(func(node *noise.Node, peer *noise.Peer, r io.Reader) error {
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		// Slow requests are held up until released, such that their peer may disconnect first.
+		if string(buf) == "slow" && atomic.AddInt32(&handled, 1) == 1 {
+			started <- struct{}{}
+			<-release
+		}
+
+		w, err := Reply(r)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(buf)
+		return err
+	}))
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	p := Persist(alice, bob.ExternalAddress()).WithBackoff(10*time.Millisecond, 100*time.Millisecond).Start()
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reply, err := p.Request(ctx, []byte("hello"), RetryOnReconnect)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(reply))
+
+	// Requests interrupted by their peer disconnecting are sent again once it is reconnected to.
+	go func() {
+		<-started
+		p.Peer().Disconnect()
+		close(release)
+	}()
+
+	reply, err = p.Request(ctx, []byte("slow"), RetryOnReconnect)
+	assert.NoError(t, err)
+	assert.Equal(t, "slow", string(reply))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&handled))
+
+	// Requests which are not to be retried fail instead.
+	atomic.StoreInt32(&handled, 0)
+	release = make(chan struct{})
+
+	go func() {
+		<-started
+		p.Peer().Disconnect()
+		close(release)
+	}()
+
+	_, err = p.Request(ctx, []byte("slow"), FailOnDisconnect)
+	assert.True(t, errors.Is(err, ErrDisconnected))
+
+	// Closed persistent peers are not reconnected to.
+	p.Close()
+
+	_, err = p.Request(ctx, []byte("hello"), RetryOnReconnect)
+	assert.True(t, errors.Is(err, ErrClosed))
+}
+
+type missing struct {
+	Name string
+}
+
+func (missing) Read(reader payload.Reader) (noise.Message, error) {
+	name, err := reader.ReadString()
+	if err != nil {
+		return nil, err
+	}
+
+	return missing{Name: name}, nil
+}
+
+func (m missing) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.Name).Bytes()
+}
+
+func (m missing) Error() string {
+	return m.Name + " is missing"
+}
+
+func TestErrors(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	RegisterDetails("stream.missing", missing{})
+
+	alice, bob, peer := setup(t, New().OnStream(func(node *noise.Node, peer *noise.Peer, r io.Reader) error {
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		switch string(buf) {
+		case "missing":
+			return Errorf(CodeNotFound, "no such key").WithDetails(missing{Name: "key"})
+		case "wrapped":
+			return errors.Wrap(Errorf(CodePermissionDenied, "not allowed"), "failed to handle request")
+		default:
+			return errors.New("something went wrong")
+		}
+	}))
+
+	defer alice.Kill()
+	defer bob.Kill()
+
+	_, err := Request(peer, []byte("missing"))
+	assert.True(t, errors.Is(err, &Error{Code: CodeNotFound}))
+	assert.False(t, errors.Is(err, &Error{Code: CodeInternal}))
+
+	var e *Error
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, "no such key", e.Message)
+		assert.Equal(t, missing{Name: "key"}, e.Details)
+	}
+
+	var details missing
+	if assert.True(t, errors.As(err, &details)) {
+		assert.Equal(t, "key", details.Name)
+	}
+
+	_, err = Request(peer, []byte("wrapped"))
+	assert.True(t, errors.Is(err, &Error{Code: CodePermissionDenied}))
+
+	// Errors which are not of type Error are replied with under CodeUnknown.
+	_, err = Request(peer, []byte("other"))
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, CodeUnknown, e.Code)
+		assert.Equal(t, "something went wrong", e.Message)
+		assert.Nil(t, e.Details)
+	}
+}
@@ -0,0 +1,135 @@
+package stream
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"time"
+)
+
+var (
+	_ noise.Message = (*Chunk)(nil)
+)
+
+// Chunk carries a part of a stream. Every chunk is sent as a message of its own, such that it is
+// decrypted and handed to the reader of the stream as soon as it arrives.
+type Chunk struct {
+	Stream uint64
+	Data   []byte
+
+	// Final marks the last chunk of a stream, and Abort marks a stream the sender failed to
+	// send in its entirety.
+	Final, Abort bool
+
+	// Reply marks a chunk sent back over a stream opened by its receiver.
+	Reply bool
+
+	// Busy marks a stream refused by a peer handling too many streams at once, which may be opened
+	// anew after RetryAfter has passed.
+	Busy       bool
+	RetryAfter time.Duration
+
+	// Error marks an aborted reply whose data carries the error the handler of the stream failed
+	// with.
+	Error bool
+
+	// Key is the idempotency key of a request, carried by the first chunk of a stream opened to
+	// send the request.
+	Key []byte
+
+	// Continued marks every chunk of a stream but its first, such that peers may refuse streams
+	// whose first chunk they never received. Peers which predate it never mark chunks continued.
+	Continued bool
+}
+
+const (
+	flagFinal byte = 1 << iota
+	flagAbort
+	flagReply
+	flagBusy
+	flagKey
+	flagError
+	flagContinued
+)
+
+func (Chunk) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Chunk
+	var err error
+
+	if msg.Stream, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read stream id")
+	}
+
+	if msg.Data, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read chunk data")
+	}
+
+	flags, err := reader.ReadByte()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read chunk flags")
+	}
+
+	msg.Final, msg.Abort, msg.Reply, msg.Busy = flags&flagFinal != 0, flags&flagAbort != 0, flags&flagReply != 0, flags&flagBusy != 0
+	msg.Error, msg.Continued = flags&flagError != 0, flags&flagContinued != 0
+
+	if msg.Busy {
+		retryAfter, err := reader.ReadUint64()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read retry-after")
+		}
+
+		msg.RetryAfter = time.Duration(retryAfter) * time.Millisecond
+	}
+
+	if flags&flagKey != 0 {
+		if msg.Key, err = reader.ReadBytes(); err != nil {
+			return nil, errors.Wrap(err, "failed to read idempotency key")
+		}
+	}
+
+	return msg, nil
+}
+
+func (m Chunk) Write() []byte {
+	var flags byte
+
+	if m.Final {
+		flags |= flagFinal
+	}
+
+	if m.Abort {
+		flags |= flagAbort
+	}
+
+	if m.Reply {
+		flags |= flagReply
+	}
+
+	if m.Busy {
+		flags |= flagBusy
+	}
+
+	if m.Key != nil {
+		flags |= flagKey
+	}
+
+	if m.Error {
+		flags |= flagError
+	}
+
+	if m.Continued {
+		flags |= flagContinued
+	}
+
+	writer := payload.NewWriter(nil).WriteUint64(m.Stream).WriteBytes(m.Data).WriteByte(flags)
+
+	if m.Busy {
+		writer.WriteUint64(uint64(m.RetryAfter / time.Millisecond))
+	}
+
+	if m.Key != nil {
+		writer.WriteBytes(m.Key)
+	}
+
+	return writer.Bytes()
+}
@@ -0,0 +1,336 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+var (
+	ErrDisconnected = errors.New("stream: peer disconnected before replying to the request")
+	ErrClosed       = errors.New("stream: persistent peer was closed")
+	ErrPeerChanged  = errors.New("stream: persistent peer reconnected under a different ID")
+)
+
+// Policy decides what becomes of a request sent through a persistent peer should the peer disconnect
+// before replying to it.
+type Policy byte
+
+const (
+	// RetryOnReconnect has the request sent again once the peer is reconnected to. Retries carry the
+	// idempotency key of the request, such that a peer which already replied to the request replays
+	// its reply instead of handling the request anew.
+	RetryOnReconnect Policy = iota
+
+	// FailOnDisconnect has the request fail with ErrDisconnected, for requests which are not to be
+	// sent again, such as those which are only worth replying to right away.
+	FailOnDisconnect
+)
+
+// Persistent keeps a node connected to a peer at an address, redialing the peer whenever it
+// disconnects, such that requests may be sent to the peer without each caller having its own
+// reconnect loop.
+type Persistent struct {
+	sync.Mutex
+
+	node    *noise.Node
+	address string
+
+	minBackoff, maxBackoff time.Duration
+
+	// peer is the peer presently connected to, ready is closed once the peer is connected to, and
+	// gone is closed once the peer is forgotten about after it disconnects.
+	peer  *noise.Peer
+	ready chan struct{}
+	gone  chan struct{}
+
+	// id is the public key of the ID of the peer once it is first connected to, which the peer must
+	// hold every time it is reconnected to.
+	id []byte
+
+	closed bool
+	cancel context.CancelFunc
+}
+
+// Persist has a node stay connected to the peer at an address until Close is called, or the node is
+// killed. The peer is redialed with exponential backoff, starting at 100 milliseconds and going up
+// to 30 seconds, until it completes the protocol of the node again. The peer must have completed
+// the block.
+//
+// Should the peer have an ID once first connected to, it must hold the same ID every time it is
+// reconnected to, or else it is disconnected and redialed.
+func Persist(node *noise.Node, address string) *Persistent {
+	return &Persistent{
+		node:       node,
+		address:    address,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+		ready:      make(chan struct{}),
+	}
+}
+
+// WithBackoff sets how long to wait before redialing the peer, from the first attempt onwards,
+// doubling with every failed attempt up to a maximum.
+func (p *Persistent) WithBackoff(min, max time.Duration) *Persistent {
+	if min <= 0 || max < min {
+		panic("stream: backoff must be positive, and its maximum must not be below its minimum")
+	}
+
+	p.minBackoff, p.maxBackoff = min, max
+	return p
+}
+
+// Start dials the peer, and redials it whenever it disconnects, until Close is called.
+func (p *Persistent) Start() *Persistent {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p.Lock()
+	p.cancel = cancel
+	p.Unlock()
+
+	p.node.Go(func(nodeCtx context.Context) error {
+		select {
+		case <-nodeCtx.Done():
+			p.Close()
+		case <-ctx.Done():
+		}
+
+		return nil
+	})
+
+	p.node.Go(func(nodeCtx context.Context) error {
+		p.maintain(ctx)
+		return nil
+	})
+
+	return p
+}
+
+// Close stops redialing the peer, disconnects it, and fails every request waiting on it to be
+// reconnected to with ErrClosed.
+func (p *Persistent) Close() {
+	p.Lock()
+
+	if p.closed {
+		p.Unlock()
+		return
+	}
+
+	p.closed = true
+
+	if p.cancel != nil {
+		p.cancel()
+	}
+
+	peer := p.peer
+
+	select {
+	case <-p.ready:
+	default:
+		close(p.ready)
+	}
+
+	p.Unlock()
+
+	if peer != nil {
+		peer.Disconnect()
+	}
+}
+
+// Peer returns the peer should it presently be connected to, or nil otherwise.
+func (p *Persistent) Peer() *noise.Peer {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.peer
+}
+
+// maintain dials the peer whenever it is not connected to.
+func (p *Persistent) maintain(ctx context.Context) {
+	backoff := p.minBackoff
+
+	for {
+		peer, err := p.connect()
+
+		if err == nil {
+			backoff = p.minBackoff
+
+			gone := make(chan struct{})
+
+			p.Lock()
+
+			if p.closed {
+				p.Unlock()
+				peer.Disconnect()
+
+				return
+			}
+
+			p.peer, p.gone = peer, gone
+			close(p.ready)
+
+			p.Unlock()
+
+			var once sync.Once
+
+			reset := func() {
+				once.Do(func() {
+					p.Lock()
+
+					if !p.closed {
+						p.peer = nil
+						p.ready = make(chan struct{})
+					}
+
+					p.Unlock()
+
+					close(gone)
+				})
+			}
+
+			peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+				reset()
+				return nil
+			})
+
+			// Callbacks registered once the callbacks of a disconnected peer have been run are never
+			// run, and so the peer may have to be forgotten about here instead.
+			if peer.Disconnected() {
+				select {
+				case <-gone:
+				case <-p.node.Clock().After(p.minBackoff):
+					reset()
+				}
+			}
+
+			select {
+			case <-gone:
+			case <-ctx.Done():
+				return
+			}
+
+			log.Debug().Str("address", p.address).Msg("Persistent peer disconnected; redialing it.")
+
+			continue
+		}
+
+		log.Debug().Err(err).Str("address", p.address).Dur("backoff", backoff).Msg("Failed to connect to persistent peer.")
+
+		select {
+		case <-p.node.Clock().After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		if backoff *= 2; backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+	}
+}
+
+// connect dials the peer, and waits for it to complete the protocol of our node.
+func (p *Persistent) connect() (*noise.Peer, error) {
+	peer, err := p.node.Dial(p.address)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := protocol.WaitUntilEstablished(peer); err != nil {
+		peer.Disconnect()
+		return nil, err
+	}
+
+	if id := protocol.PeerID(peer); id != nil {
+		p.Lock()
+
+		if p.id == nil {
+			p.id = id.PublicKey()
+		}
+
+		same := bytes.Equal(p.id, id.PublicKey())
+
+		p.Unlock()
+
+		if !same {
+			peer.Disconnect()
+			return nil, errors.Wrapf(ErrPeerChanged, "peer at %s holds the ID %x", p.address, id.PublicKey())
+		}
+	}
+
+	return peer, nil
+}
+
+// await waits for the peer to be connected to.
+func (p *Persistent) await(ctx context.Context) (*noise.Peer, error) {
+	for {
+		p.Lock()
+		peer, ready, gone, closed := p.peer, p.ready, p.gone, p.closed
+		p.Unlock()
+
+		if closed {
+			return nil, ErrClosed
+		}
+
+		if peer == nil {
+			select {
+			case <-ready:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+
+			continue
+		}
+
+		if !peer.Disconnected() {
+			return peer, nil
+		}
+
+		// Wait for the peer to be forgotten about, and then for it to be reconnected to.
+		select {
+		case <-gone:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Request sends a request to the peer as per `Request()`, waiting for the peer to be connected to
+// should it not presently be. Should the peer disconnect before replying, the policy decides
+// whether the request is sent again once the peer is reconnected to, or whether the request fails
+// with ErrDisconnected. Requests give up once the context is done.
+func (p *Persistent) Request(ctx context.Context, request []byte, policy Policy) ([]byte, error) {
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		peer, err := p.await(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		reply, err := requestWithKey(peer, request, key)
+		if err == nil || !peer.Disconnected() {
+			return reply, err
+		}
+
+		if policy == FailOnDisconnect {
+			return nil, errors.Wrap(ErrDisconnected, err.Error())
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package stream
+
+import (
+	"context"
+	"crypto/rand"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/clock"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHedgeAfter      = 100 * time.Millisecond
+	DefaultHedgePercentile = 0.95
+	DefaultIdempotentCache = 1024
+
+	// minLatencySamples is the number of requests whose latencies must be measured before hedged
+	// requests are sent based on a percentile of latencies.
+	minLatencySamples = 16
+
+	// maxLatencySamples is the number of latencies of the most recent requests which are kept.
+	maxLatencySamples = 256
+
+	keySize = 16
+)
+
+// Request opens a stream to a peer, writes a request over it, half-closes it, and reads the reply
+// of the peer in its entirety. Should the peer refuse the stream for being busy, the request is
+// retried after waiting as long as the peer asks for, up to the number of retries configured.
+//
+// Every request carries a random idempotency key which retries of it share, such that a peer that
+// already replied to a request replays its reply instead of handling the request anew.
+func Request(peer *noise.Peer, request []byte) ([]byte, error) {
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return requestWithKey(peer, request, key)
+}
+
+// RequestHedged sends a request to the first of several peers, and should the peer not have replied
+// within the configured percentile of latencies of recent requests, sends the request to the next
+// peer as well. The first reply received is returned, and should a request fail, the request is sent
+// to the next peer right away. It returns the last error should the request fail for every peer.
+//
+// Once a reply is received, the requests still in flight to other peers are canceled, and only the
+// latency of the request which was replied to is recorded. Until enough requests have been made to
+// measure a percentile of their latencies, requests are hedged after 100 milliseconds by default.
+func RequestHedged(peers []*noise.Peer, request []byte) ([]byte, error) {
+	if len(peers) == 0 {
+		return nil, errors.New("stream: no peers to send the request to")
+	}
+
+	s, ok := peers[0].Get(keyState).(*state)
+	if !ok {
+		return nil, errors.New("stream: peer has not completed the block")
+	}
+
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+
+	type outcome struct {
+		reply   []byte
+		latency time.Duration
+		err     error
+	}
+
+	outcomes := make(chan outcome, len(peers))
+	next, pending := 0, 0
+
+	attempts := make([]*attempt, 0, len(peers))
+
+	defer func() {
+		for _, a := range attempts {
+			a.cancel()
+		}
+	}()
+
+	launch := func() {
+		peer, a := peers[next], new(attempt)
+		next, pending = next+1, pending+1
+
+		attempts = append(attempts, a)
+
+		peer.Node().Go(func(ctx context.Context) error {
+			reply, latency, err := send(peer, request, key, a)
+			outcomes <- outcome{reply: reply, latency: latency, err: err}
+
+			return nil
+		})
+	}
+
+	launch()
+
+	for pending > 0 {
+		var timer clock.Timer
+		var hedge <-chan time.Time
+
+		if next < len(peers) {
+			timer = peers[0].Node().Clock().NewTimer(s.block.hedgeDelay())
+			hedge = timer.C()
+		}
+
+		select {
+		case o := <-outcomes:
+			pending--
+
+			if o.err == nil {
+				s.block.latencies.record(o.latency)
+				return o.reply, nil
+			}
+
+			err = o.err
+
+			if next < len(peers) {
+				launch()
+			}
+		case <-hedge:
+			launch()
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+
+	return nil, errors.Wrapf(err, "stream: request failed for all %d peers", len(peers))
+}
+
+// requestWithKey sends a request to a peer, and records its latency should the peer reply.
+func requestWithKey(peer *noise.Peer, request []byte, key []byte) ([]byte, error) {
+	reply, latency, err := send(peer, request, key, nil)
+	if err == nil {
+		peer.Get(keyState).(*state).block.latencies.record(latency)
+	}
+
+	return reply, err
+}
+
+// send sends a request to a peer, retrying it should the peer be busy, and returns the reply of the
+// peer alongside how long the peer took to reply. Should an attempt be given, the request is given
+// up on once the attempt is canceled.
+func send(peer *noise.Peer, request []byte, key []byte, a *attempt) ([]byte, time.Duration, error) {
+	s, err := establishedState(peer)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for retries := 0; ; retries++ {
+		start := peer.Node().Clock().Now()
+
+		reply, err := requestOnce(peer, request, key, a)
+		if err == nil {
+			return reply, peer.Node().Clock().Since(start), nil
+		}
+
+		var busy BusyError
+		if !errors.As(err, &busy) || retries >= s.block.maxRetries || a.canceled() {
+			return nil, 0, err
+		}
+
+		peer.Node().Clock().Sleep(busy.RetryAfter)
+	}
+}
+
+func requestOnce(peer *noise.Peer, request []byte, key []byte, a *attempt) ([]byte, error) {
+	stream, err := open(peer, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !a.track(stream) {
+		return nil, errCanceled
+	}
+
+	if _, err := stream.Write(request); err != nil {
+		return nil, err
+	}
+
+	if err := stream.CloseWrite(); err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(stream)
+}
+
+// attempt is a request sent to one of the peers of a hedged request, which is canceled should
+// another peer reply first. A nil attempt is never canceled.
+type attempt struct {
+	sync.Mutex
+
+	stream *Stream
+	done   bool
+}
+
+// track has a stream the request is sent over be canceled along with the attempt. It cancels the
+// stream right away, and returns false, should the attempt already have been canceled.
+func (a *attempt) track(stream *Stream) bool {
+	if a == nil {
+		return true
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	if a.done {
+		stream.cancel()
+		return false
+	}
+
+	a.stream = stream
+
+	return true
+}
+
+func (a *attempt) cancel() {
+	a.Lock()
+	defer a.Unlock()
+
+	a.done = true
+
+	if a.stream != nil {
+		a.stream.cancel()
+	}
+}
+
+func (a *attempt) canceled() bool {
+	if a == nil {
+		return false
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	return a.done
+}
+
+func newKey() ([]byte, error) {
+	key := make([]byte, keySize)
+
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrap(err, "stream: failed to generate idempotency key")
+	}
+
+	return key, nil
+}
+
+func (b *block) hedgeDelay() time.Duration {
+	if delay, ok := b.latencies.percentile(b.hedgePercentile); ok {
+		return delay
+	}
+
+	return b.hedgeAfter
+}
+
+// latencies holds the latencies of the most recent requests.
+type latencies struct {
+	sync.Mutex
+
+	samples []time.Duration
+	next    int
+}
+
+func (l *latencies) record(latency time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	if len(l.samples) < maxLatencySamples {
+		l.samples = append(l.samples, latency)
+		return
+	}
+
+	l.samples[l.next] = latency
+	l.next = (l.next + 1) % maxLatencySamples
+}
+
+func (l *latencies) percentile(p float64) (time.Duration, bool) {
+	l.Lock()
+	samples := append([]time.Duration(nil), l.samples...)
+	l.Unlock()
+
+	if len(samples) < minLatencySamples {
+		return 0, false
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	i := int(p * float64(len(samples)))
+	if i >= len(samples) {
+		i = len(samples) - 1
+	}
+
+	return samples[i], true
+}
+
+// replyCache holds the replies to requests by their idempotency keys, such that retries of requests
+// already replied to are replayed their reply instead of being handled anew.
+type replyCache struct {
+	sync.Mutex
+
+	max     int
+	entries map[string]*cachedReply
+	order   []string
+}
+
+type cachedReply struct {
+	done  bool
+	reply []byte
+}
+
+func newReplyCache(max int) *replyCache {
+	return &replyCache{max: max, entries: make(map[string]*cachedReply)}
+}
+
+// lookup returns the cached reply to a request, whether the request was replied to, and whether
+// the request is being handled or was replied to.
+func (c *replyCache) lookup(key string) ([]byte, bool, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil, false, false
+	}
+
+	return entry.reply, entry.done, true
+}
+
+// begin marks a request as being handled.
+func (c *replyCache) begin(key string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.entries[key] = &cachedReply{}
+}
+
+// complete caches the reply to a request, evicting the oldest cached replies should the cache be
+// full.
+func (c *replyCache) complete(key string, reply []byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return
+	}
+
+	entry.done, entry.reply = true, reply
+	c.order = append(c.order, key)
+
+	for len(c.order) > c.max {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// forget forgets a request which failed to be replied to, such that it may be handled anew.
+func (c *replyCache) forget(key string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if entry, exists := c.entries[key]; exists && !entry.done {
+		delete(c.entries, key)
+	}
+}
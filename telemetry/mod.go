@@ -0,0 +1,240 @@
+// Package telemetry aggregates peer-level telemetry, such as the round-trip time to every peer, into
+// metrics which carry no IPs nor IDs, such that nodes may be monitored without exporting who they
+// are connected to.
+//
+// Aggregates may optionally be made differentially private, where every aggregate is noised with
+// the Laplace mechanism such that whether or not any single peer contributed to an export, and the
+// values it contributed, may not be told apart from the export alone.
+package telemetry
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/perlin-network/noise"
+	"github.com/pkg/errors"
+	"math"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknownMetric = errors.New("telemetry: metric is not registered")
+)
+
+// Aggregator holds the latest value every peer contributed to every metric, and aggregates them into
+// snapshots.
+type Aggregator struct {
+	sync.Mutex
+
+	metrics map[string]*metric
+
+	// epsilon is the privacy budget spent on every snapshot, or zero should snapshots not be noised.
+	epsilon  float64
+	minPeers int
+
+	// uniform returns a uniformly random number in (0, 1), which noise is drawn from.
+	uniform func() float64
+}
+
+type metric struct {
+	max     float64
+	buckets []float64
+
+	values map[*noise.Peer]float64
+}
+
+// New returns an aggregator which exports exact aggregates of the metrics registered to it.
+func New() *Aggregator {
+	return &Aggregator{metrics: make(map[string]*metric), uniform: uniform}
+}
+
+// WithMetric registers a metric whose values are clamped to [0, max], and which is exported as a
+// histogram alongside its count and mean should the upper bounds of any buckets be given. Values
+// above the upper bound of the last bucket are counted in an implicit bucket bounded by max.
+//
+// Clamping bounds how much any single peer may sway the sum of a metric, which is what noise is
+// scaled to should snapshots be differentially private.
+func (a *Aggregator) WithMetric(name string, max float64, buckets ...float64) *Aggregator {
+	if max <= 0 {
+		panic("telemetry: max must be positive")
+	}
+
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	if len(buckets) == 0 || buckets[len(buckets)-1] < max {
+		buckets = append(buckets, max)
+	}
+
+	a.Lock()
+	a.metrics[name] = &metric{max: max, buckets: buckets, values: make(map[*noise.Peer]float64)}
+	a.Unlock()
+
+	return a
+}
+
+// WithPrivacy has every snapshot be ε-differentially private with respect to adding or removing any
+// single peer, for a specified ε. The budget is split evenly across the count, sum and histogram of
+// every metric.
+//
+// The budget is spent anew on every snapshot, and so exporting many snapshots of the same values
+// weakens the guarantee in proportion to the number of snapshots exported.
+func (a *Aggregator) WithPrivacy(epsilon float64) *Aggregator {
+	if epsilon <= 0 {
+		panic("telemetry: epsilon must be positive")
+	}
+
+	a.epsilon = epsilon
+	return a
+}
+
+// WithMinPeers withholds a metric from snapshots should fewer than a specified number of peers
+// have contributed to it. Should snapshots be differentially private, the noised count is compared
+// against instead.
+func (a *Aggregator) WithMinPeers(min int) *Aggregator {
+	a.minPeers = min
+	return a
+}
+
+// Observe records the latest value of a metric for a peer, replacing any value the peer contributed
+// to the metric beforehand. Values of a peer are forgotten once the peer disconnects.
+func (a *Aggregator) Observe(peer *noise.Peer, name string, value float64) error {
+	a.Lock()
+	defer a.Unlock()
+
+	m, exists := a.metrics[name]
+	if !exists {
+		return errors.Wrapf(ErrUnknownMetric, "cannot observe %q", name)
+	}
+
+	if _, seen := m.values[peer]; !seen && !a.observed(peer) {
+		peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+			a.Forget(peer)
+			return nil
+		})
+	}
+
+	m.values[peer] = math.Min(math.Max(value, 0), m.max)
+
+	return nil
+}
+
+// observed reports whether a peer has contributed to any metric.
+func (a *Aggregator) observed(peer *noise.Peer) bool {
+	for _, m := range a.metrics {
+		if _, seen := m.values[peer]; seen {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Forget removes every value a peer contributed.
+func (a *Aggregator) Forget(peer *noise.Peer) {
+	a.Lock()
+	defer a.Unlock()
+
+	for _, m := range a.metrics {
+		delete(m.values, peer)
+	}
+}
+
+// Snapshot is what an aggregator exports. It carries no IPs nor IDs of any peer.
+type Snapshot struct {
+	// Private reports whether the snapshot is differentially private, and Epsilon is the budget
+	// spent on it.
+	Private bool    `json:"private"`
+	Epsilon float64 `json:"epsilon,omitempty"`
+
+	Metrics map[string]Metric `json:"metrics"`
+}
+
+// Metric is the aggregate of the values every peer contributed to a metric. Should its snapshot be
+// differentially private, every field is noised, and counts may not be whole.
+type Metric struct {
+	Count     float64  `json:"count"`
+	Mean      float64  `json:"mean"`
+	Histogram []Bucket `json:"histogram"`
+}
+
+// Bucket counts the values within (previous upper bound, UpperBound].
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      float64 `json:"count"`
+}
+
+// Snapshot aggregates the values every peer contributed to every metric.
+func (a *Aggregator) Snapshot() Snapshot {
+	a.Lock()
+	defer a.Unlock()
+
+	snapshot := Snapshot{Private: a.epsilon > 0, Epsilon: a.epsilon, Metrics: make(map[string]Metric, len(a.metrics))}
+
+	// The budget is split across three queries per metric, as any one peer may contribute to all.
+	var epsilon float64
+	if len(a.metrics) > 0 {
+		epsilon = a.epsilon / float64(3*len(a.metrics))
+	}
+
+	for name, m := range a.metrics {
+		count, sum := float64(len(m.values)), 0.0
+		histogram := make([]Bucket, len(m.buckets))
+
+		for i, bound := range m.buckets {
+			histogram[i].UpperBound = bound
+		}
+
+		for _, value := range m.values {
+			sum += value
+			histogram[sort.SearchFloat64s(m.buckets, value)].Count++
+		}
+
+		if snapshot.Private {
+			count = math.Max(count+a.laplace(1/epsilon), 0)
+			sum = math.Max(sum+a.laplace(m.max/epsilon), 0)
+
+			// Adding or removing a peer changes the count of a single bucket by one.
+			for i := range histogram {
+				histogram[i].Count = math.Max(histogram[i].Count+a.laplace(1/epsilon), 0)
+			}
+		}
+
+		if count < float64(a.minPeers) {
+			continue
+		}
+
+		aggregate := Metric{Count: count, Histogram: histogram}
+
+		if count >= 1 {
+			aggregate.Mean = math.Min(sum/count, m.max)
+		}
+
+		snapshot.Metrics[name] = aggregate
+	}
+
+	return snapshot
+}
+
+// laplace draws noise from the Laplace distribution centered at zero of a specified scale.
+func (a *Aggregator) laplace(scale float64) float64 {
+	u := a.uniform() - 0.5
+	return -scale * math.Copysign(1, u) * math.Log(1-2*math.Abs(u))
+}
+
+// uniform returns a uniformly random number in (0, 1) drawn from a cryptographically secure source,
+// such that noise may not be predicted and subtracted.
+func uniform() float64 {
+	var buf [8]byte
+
+	for {
+		if _, err := rand.Read(buf[:]); err != nil {
+			panic(errors.Wrap(err, "telemetry: failed to draw noise"))
+		}
+
+		// 53 random bits make for every float64 in [0, 1) with a uniform spacing.
+		if u := float64(binary.LittleEndian.Uint64(buf[:])>>11) / (1 << 53); u > 0 {
+			return u
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// connect has a node dial a number of other nodes, and returns the peers it dialed.
+func connect(t *testing.T, count int) (*noise.Node, []*noise.Peer, func()) {
+	layer := transport.NewBuffered()
+
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	kill := []func(){node.Kill}
+
+	var peers []*noise.Peer
+
+	for i := 0; i < count; i++ {
+		other, err := noise.NewNode(params)
+		assert.NoError(t, err)
+
+		go other.Listen()
+
+		kill = append(kill, other.Kill)
+
+		peer, err := node.Dial(other.ExternalAddress())
+		assert.NoError(t, err)
+
+		peers = append(peers, peer)
+	}
+
+	return node, peers, func() {
+		for _, fn := range kill {
+			fn()
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	_, peers, kill := connect(t, 4)
+	defer kill()
+
+	a := New().WithMetric("rtt_ms", 1000, 10, 100).WithMetric("uptime_s", 3600)
+
+	for i, rtt := range []float64{5, 50, 500, 5000} {
+		assert.NoError(t, a.Observe(peers[i], "rtt_ms", rtt))
+	}
+
+	// Only the latest value of every peer counts.
+	assert.NoError(t, a.Observe(peers[0], "rtt_ms", 1))
+	assert.True(t, errors.Is(a.Observe(peers[0], "bandwidth", 1), ErrUnknownMetric))
+
+	s := a.Snapshot()
+	assert.False(t, s.Private)
+
+	rtt := s.Metrics["rtt_ms"]
+	assert.Equal(t, 4.0, rtt.Count)
+
+	// Values are clamped to the max of the metric.
+	assert.Equal(t, (1+50+500+1000)/4.0, rtt.Mean)
+	assert.Equal(t, []Bucket{{UpperBound: 10, Count: 1}, {UpperBound: 100, Count: 1}, {UpperBound: 1000, Count: 2}}, rtt.Histogram)
+
+	assert.Equal(t, Metric{Histogram: []Bucket{{UpperBound: 3600}}}, s.Metrics["uptime_s"])
+
+	// Snapshots carry no IPs nor IDs of peers.
+	buf, err := json.Marshal(s)
+	assert.NoError(t, err)
+
+	for _, peer := range peers {
+		assert.False(t, strings.Contains(string(buf), peer.RemoteIP().String()))
+	}
+}
+
+func TestForgetOnDisconnect(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	_, peers, kill := connect(t, 2)
+	defer kill()
+
+	a := New().WithMetric("rtt_ms", 1000).WithMinPeers(2)
+
+	for _, peer := range peers {
+		assert.NoError(t, a.Observe(peer, "rtt_ms", 10))
+	}
+
+	assert.Equal(t, 2.0, a.Snapshot().Metrics["rtt_ms"].Count)
+
+	peers[0].Disconnect()
+
+	for i := 0; i < 100 && len(a.Snapshot().Metrics) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// With a single peer left, the metric is withheld.
+	assert.Empty(t, a.Snapshot().Metrics)
+}
+
+func TestPrivacy(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	_, peers, kill := connect(t, 10)
+	defer kill()
+
+	a := New().WithMetric("rtt_ms", 100, 50).WithPrivacy(1)
+
+	// Noise is drawn from a seeded source, such that the test is deterministic.
+	r := rand.New(rand.NewSource(1))
+	a.uniform = func() float64 {
+		for {
+			if u := r.Float64(); u > 0 {
+				return u
+			}
+		}
+	}
+
+	for i, peer := range peers {
+		assert.NoError(t, a.Observe(peer, "rtt_ms", float64(10*i)))
+	}
+
+	const trials = 2000
+
+	var count, mean, below float64
+	exact := true
+
+	for i := 0; i < trials; i++ {
+		s := a.Snapshot()
+		assert.True(t, s.Private)
+
+		m := s.Metrics["rtt_ms"]
+
+		if m.Count != 10 {
+			exact = false
+		}
+
+		count += m.Count
+		mean += m.Mean
+		below += m.Histogram[0].Count
+	}
+
+	count, mean, below = count/trials, mean/trials, below/trials
+
+	// Every snapshot is noised, yet noise averages out across snapshots.
+	assert.False(t, exact)
+	assert.True(t, math.Abs(count-10) < 1, "mean count %f", count)
+	assert.True(t, math.Abs(mean-45) < 10, "mean of means %f", mean)
+	assert.True(t, math.Abs(below-6) < 1, "mean count below 50ms %f", below)
+}
+
+func TestLaplace(t *testing.T) {
+	a := New()
+
+	r := rand.New(rand.NewSource(1))
+	a.uniform = func() float64 {
+		for {
+			if u := r.Float64(); u > 0 {
+				return u
+			}
+		}
+	}
+
+	const samples, scale = 100000, 2.0
+
+	var sum, abs float64
+
+	for i := 0; i < samples; i++ {
+		x := a.laplace(scale)
+		sum += x
+		abs += math.Abs(x)
+	}
+
+	// The Laplace distribution has a mean of zero, and a mean absolute deviation of its scale.
+	assert.True(t, math.Abs(sum/samples) < 0.05)
+	assert.True(t, math.Abs(abs/samples-scale) < 0.05)
+
+	u := uniform()
+	assert.True(t, u > 0 && u < 1)
+}
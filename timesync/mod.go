@@ -0,0 +1,188 @@
+// Package timesync has peers exchange timestamps with one another as they connect, and warns of, or
+// disconnects, peers whose clocks are skewed from ours beyond a bound.
+//
+// Checks such as those of the validity windows of certificates, or of timestamps applications carry
+// in their messages, compare times taken off of the clocks of different nodes, and silently
+// misbehave should those clocks disagree.
+package timesync
+
+import (
+	"fmt"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	keySample = "timesync.sample"
+
+	DefaultMaxSkew = 1 * time.Minute
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrClockSkew = errors.New("timesync: clock of peer is skewed from ours beyond the bound allowed")
+)
+
+// ClockSkewError is returned by the block should the clock of a peer be skewed from ours beyond the
+// bound allowed, while the block refuses such peers. It matches ErrClockSkew.
+type ClockSkewError struct {
+	Offset, MaxSkew time.Duration
+}
+
+func (e ClockSkewError) Error() string {
+	return fmt.Sprintf("%s; their clock is offset from ours by %s, when at most %s is allowed", ErrClockSkew, e.Offset, e.MaxSkew)
+}
+
+// Cause returns ErrClockSkew such that callers using `errors.Cause` may match against it.
+func (e ClockSkewError) Cause() error {
+	return ErrClockSkew
+}
+
+func (e ClockSkewError) Is(target error) bool {
+	return target == ErrClockSkew
+}
+
+// Sample is an estimate of how far the clock of a peer is offset from ours.
+type Sample struct {
+	// Offset is how far ahead the clock of the peer is of ours. It is negative should the clock of
+	// the peer be behind ours.
+	Offset time.Duration
+
+	// RTT is the round-trip time of the exchange the offset was estimated from. The offset is off by
+	// at most half of the round-trip time.
+	RTT time.Duration
+}
+
+type block struct {
+	opcodeProbe noise.Opcode
+	opcodeEcho  noise.Opcode
+
+	timeoutDuration time.Duration
+
+	maxSkew time.Duration
+	refuse  bool
+}
+
+// New returns a block which estimates how far the clock of every peer is offset from ours, and logs
+// a warning for peers whose clocks are skewed from ours by more than 1 minute. By default, peers
+// which do not complete the exchange within 10 seconds are disconnected.
+func New() *block {
+	return &block{timeoutDuration: 10 * time.Second, maxSkew: DefaultMaxSkew}
+}
+
+func (b *block) TimeoutAfter(timeoutDuration time.Duration) *block {
+	b.timeoutDuration = timeoutDuration
+	return b
+}
+
+// WithMaxSkew sets how far the clock of a peer may be offset from ours, either ahead or behind,
+// before it is deemed skewed.
+func (b *block) WithMaxSkew(maxSkew time.Duration) *block {
+	if maxSkew <= 0 {
+		panic("timesync: max skew must be positive")
+	}
+
+	b.maxSkew = maxSkew
+	return b
+}
+
+// Refuse has peers whose clocks are skewed disconnected with a ClockSkewError, rather than only
+// warned of.
+func (b *block) Refuse() *block {
+	b.refuse = true
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeProbe = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Probe)(nil))
+	b.opcodeEcho = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Echo)(nil))
+}
+
+// OnBegin has both peers probe one another at once, and answer the probe of the other with an echo,
+// akin to NTP. The offset is estimated as ((received - origin) + (transmitted - arrived)) / 2,
+// which cancels out the time the probe and echo spent in flight should their paths be symmetric.
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	clock := peer.Node().Clock()
+
+	origin := clock.Now()
+
+	if err := peer.SendMessage(Probe{Origin: origin}); err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "timesync: failed to probe peer")
+	}
+
+	var sample Sample
+	var echoed, answered bool
+
+	timeout := clock.After(b.timeoutDuration)
+
+	for !echoed || !answered {
+		select {
+		case <-timeout:
+			return errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeTimeout), "timesync: timed out exchanging timestamps with peer")
+		case msg := <-peer.Receive(b.opcodeProbe):
+			if answered {
+				continue
+			}
+
+			received := clock.Now()
+
+			if err := peer.SendMessage(Echo{Origin: msg.(Probe).Origin, Received: received, Transmitted: clock.Now()}); err != nil {
+				return errors.Wrap(protocol.DisconnectWith(err), "timesync: failed to answer probe of peer")
+			}
+
+			answered = true
+		case msg := <-peer.Receive(b.opcodeEcho):
+			echo := msg.(Echo)
+
+			if echoed || !echo.Origin.Equal(origin) {
+				continue
+			}
+
+			arrived := clock.Now()
+
+			sample.Offset = (echo.Received.Sub(origin) + echo.Transmitted.Sub(arrived)) / 2
+			sample.RTT = arrived.Sub(origin) - echo.Transmitted.Sub(echo.Received)
+
+			echoed = true
+		}
+	}
+
+	peer.Set(keySample, sample)
+
+	if skew := abs(sample.Offset); skew > b.maxSkew {
+		if b.refuse {
+			return protocol.DisconnectWith(ClockSkewError{Offset: sample.Offset, MaxSkew: b.maxSkew})
+		}
+
+		log.Warn().
+			Str("address", peer.RemoteIP().String()).
+			Dur("offset", sample.Offset).
+			Dur("max_skew", b.maxSkew).
+			Msg("Clock of peer is skewed from ours. Either clock may be wrong, and times compared across our nodes may be misjudged.")
+	}
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Of returns the estimate of how far the clock of a peer is offset from ours. It reports false
+// should the peer not have completed the block.
+func Of(peer *noise.Peer) (Sample, bool) {
+	s, ok := peer.Get(keySample).(Sample)
+	return s, ok
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+
+	return d
+}
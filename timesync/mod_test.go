@@ -0,0 +1,88 @@
+package timesync
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/clock"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// skewed is a clock offset from the system clock.
+type skewed struct {
+	clock.Clock
+	offset time.Duration
+}
+
+func (c skewed) Now() time.Time {
+	return c.Clock.Now().Add(c.offset)
+}
+
+func TestSkew(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	dial := func(offset time.Duration, alice, bob *block) (*noise.Peer, func()) {
+		layer := transport.NewBuffered()
+
+		var nodes []*noise.Node
+
+		for i, b := range []*block{alice, bob} {
+			params := noise.DefaultParams()
+			params.Transport = layer
+
+			if i == 1 {
+				params.Clock = skewed{Clock: clock.New(), offset: offset}
+			}
+
+			node, err := noise.NewNode(params)
+			assert.NoError(t, err)
+
+			protocol.New().Register(b).Enforce(node)
+
+			go node.Listen()
+
+			nodes = append(nodes, node)
+		}
+
+		peer, err := nodes[0].Dial(nodes[1].ExternalAddress())
+		assert.NoError(t, err)
+
+		return peer, func() {
+			nodes[0].Kill()
+			nodes[1].Kill()
+		}
+	}
+
+	peer, kill := dial(0, New().Refuse(), New().Refuse())
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	sample, ok := Of(peer)
+	assert.True(t, ok)
+	assert.True(t, abs(sample.Offset) < time.Second, "estimated an offset of %s between clocks in sync", sample.Offset)
+	assert.True(t, sample.RTT >= 0)
+	kill()
+
+	// Peers whose clocks are skewed are only warned of by default.
+	peer, kill = dial(5*time.Minute, New(), New())
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	sample, ok = Of(peer)
+	assert.True(t, ok)
+	assert.True(t, abs(sample.Offset-5*time.Minute) < time.Second, "estimated an offset of %s, rather than 5m", sample.Offset)
+	kill()
+
+	peer, kill = dial(-5*time.Minute, New().Refuse(), New())
+	err := protocol.WaitUntilEstablished(peer)
+	assert.True(t, errors.Is(err, ErrClockSkew))
+	kill()
+
+	// Skew within the bound allowed is tolerated.
+	peer, kill = dial(5*time.Minute, New().WithMaxSkew(10*time.Minute).Refuse(), New())
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+	kill()
+}
@@ -0,0 +1,82 @@
+package timesync
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"time"
+)
+
+var (
+	_ noise.Message = (*Probe)(nil)
+	_ noise.Message = (*Echo)(nil)
+)
+
+// Probe carries the time by the clock of a peer at which it was sent.
+type Probe struct {
+	Origin time.Time
+}
+
+func (Probe) Read(reader payload.Reader) (noise.Message, error) {
+	origin, err := readTime(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read origin timestamp")
+	}
+
+	return Probe{Origin: origin}, nil
+}
+
+func (m Probe) Write() []byte {
+	return writeTime(payload.NewWriter(nil), m.Origin).Bytes()
+}
+
+// Echo answers a probe with the times by the clock of a peer at which the probe was received, and
+// at which the echo was sent.
+type Echo struct {
+	Origin      time.Time
+	Received    time.Time
+	Transmitted time.Time
+}
+
+func (Echo) Read(reader payload.Reader) (noise.Message, error) {
+	origin, err := readTime(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read origin timestamp")
+	}
+
+	received, err := readTime(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read receive timestamp")
+	}
+
+	transmitted, err := readTime(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read transmit timestamp")
+	}
+
+	return Echo{Origin: origin, Received: received, Transmitted: transmitted}, nil
+}
+
+func (m Echo) Write() []byte {
+	writer := payload.NewWriter(nil)
+
+	writeTime(writer, m.Origin)
+	writeTime(writer, m.Received)
+	writeTime(writer, m.Transmitted)
+
+	return writer.Bytes()
+}
+
+// readTime reads a time encoded as the number of nanoseconds since the Unix epoch.
+func readTime(reader payload.Reader) (time.Time, error) {
+	ns, err := reader.ReadUint64()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, int64(ns)), nil
+}
+
+func writeTime(writer payload.Writer, t time.Time) payload.Writer {
+	return writer.WriteUint64(uint64(t.UnixNano()))
+}
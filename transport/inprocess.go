@@ -0,0 +1,350 @@
+package transport
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+var _ Layer = (*InProcess)(nil)
+
+// InProcess is a transport layer which connects nodes living within the same process through
+// in-memory pipes, such that co-located services may use the same API as they would with remote
+// peers at minimal overhead. Unlike Buffered, writes only block on the other end reading once
+// 1 MiB of written bytes are left unread.
+type InProcess struct {
+	sync.Mutex
+	listeners map[string]*pipeListener
+}
+
+// IsInProcess returns true should a connection have been established by an in-process transport
+// layer, such that bytes written to it never leave our process.
+func IsInProcess(conn net.Conn) bool {
+	_, ok := conn.(*pipeConn)
+	return ok
+}
+
+// NewInProcess returns a new in-process transport layer. Only nodes sharing the same layer may
+// connect to one another.
+func NewInProcess() *InProcess {
+	return &InProcess{listeners: make(map[string]*pipeListener)}
+}
+
+func (t *InProcess) String() string {
+	return "inproc"
+}
+
+func (t *InProcess) Listen(host string, port uint16) (net.Listener, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if net.ParseIP(host) == nil {
+		return nil, errors.Errorf("unable to parse host as IP: %s", host)
+	}
+
+	if port == 0 {
+		port = uint16(rand.Intn(50000) + 10000)
+	}
+
+	addr := &net.TCPAddr{IP: net.ParseIP(host), Port: int(port)}
+
+	if _, exists := t.listeners[addr.String()]; exists {
+		return nil, errors.Errorf("address %s is already in use", addr)
+	}
+
+	listener := &pipeListener{
+		layer: t,
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+
+	t.listeners[addr.String()] = listener
+
+	return listener, nil
+}
+
+func (t *InProcess) Dial(address string) (net.Conn, error) {
+	t.Lock()
+	listener, exists := t.listeners[address]
+	t.Unlock()
+
+	if !exists {
+		return nil, errors.Errorf("no listener setup for address %s", address)
+	}
+
+	// Dialed pipes are given an ephemeral port, as with any other transport.
+	local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: rand.Intn(50000) + 10000}
+
+	dialer, acceptor := newPipe(local, listener.addr)
+
+	select {
+	case listener.conns <- acceptor:
+		return dialer, nil
+	case <-listener.done:
+		return nil, errors.Errorf("listener at address %s is closed", address)
+	}
+}
+
+func (t *InProcess) IP(address net.Addr) net.IP {
+	return address.(*net.TCPAddr).IP
+}
+
+func (t *InProcess) Port(address net.Addr) uint16 {
+	return uint16(address.(*net.TCPAddr).Port)
+}
+
+type pipeListener struct {
+	layer *InProcess
+	addr  *net.TCPAddr
+
+	conns chan net.Conn
+
+	once sync.Once
+	done chan struct{}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errors.New("inproc: listener closed")
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+
+		l.layer.Lock()
+		delete(l.layer.listeners, l.addr.String())
+		l.layer.Unlock()
+	})
+
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return l.addr
+}
+
+// pipeBufferSize is the number of bytes written to one end of a pipe that may be buffered before
+// writes block on the other end reading.
+const pipeBufferSize = 1 << 20
+
+// pipeBuffer is a bounded buffer of bytes written by one end of a pipe, and read by the other.
+type pipeBuffer struct {
+	sync.Mutex
+
+	buf    []byte
+	closed bool
+
+	// changed is closed and replaced whenever bytes are read from or written to the buffer, the
+	// buffer is closed, or a deadline of a reader or writer waiting on the buffer changes.
+	changed chan struct{}
+}
+
+func newPipeBuffer() *pipeBuffer {
+	return &pipeBuffer{changed: make(chan struct{})}
+}
+
+// signal wakes up all readers and writers waiting on the buffer. The buffer must be locked.
+func (b *pipeBuffer) signal() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *pipeBuffer) wake() {
+	b.Lock()
+	b.signal()
+	b.Unlock()
+}
+
+func (b *pipeBuffer) close() {
+	b.Lock()
+	b.closed = true
+	b.signal()
+	b.Unlock()
+}
+
+// wait blocks until a buffer changes, or until a deadline elapses. It returns false should the
+// deadline have elapsed.
+func wait(changed <-chan struct{}, deadline time.Time) bool {
+	if deadline.IsZero() {
+		<-changed
+		return true
+	}
+
+	wait := time.Until(deadline)
+	if wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-changed:
+	case <-timer.C:
+	}
+
+	return true
+}
+
+var _ net.Conn = (*pipeConn)(nil)
+
+type pipeConn struct {
+	local, remote net.Addr
+
+	rx, tx *pipeBuffer
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+	closed        bool
+}
+
+func newPipe(dialer, acceptor net.Addr) (*pipeConn, *pipeConn) {
+	a, b := newPipeBuffer(), newPipeBuffer()
+
+	return &pipeConn{local: dialer, remote: acceptor, rx: a, tx: b},
+		&pipeConn{local: acceptor, remote: dialer, rx: b, tx: a}
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		closed, deadline := c.closed, c.readDeadline
+		c.mu.Unlock()
+
+		if closed {
+			return 0, io.ErrClosedPipe
+		}
+
+		c.rx.Lock()
+
+		if len(c.rx.buf) > 0 {
+			n := copy(b, c.rx.buf)
+			c.rx.buf = c.rx.buf[n:]
+			c.rx.signal()
+			c.rx.Unlock()
+
+			return n, nil
+		}
+
+		if c.rx.closed {
+			c.rx.Unlock()
+			return 0, io.EOF
+		}
+
+		changed := c.rx.changed
+		c.rx.Unlock()
+
+		if !wait(changed, deadline) {
+			return 0, timeoutError{}
+		}
+	}
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	written := 0
+
+	for len(b) > 0 {
+		c.mu.Lock()
+		closed, deadline := c.closed, c.writeDeadline
+		c.mu.Unlock()
+
+		if closed {
+			return written, io.ErrClosedPipe
+		}
+
+		c.tx.Lock()
+
+		if c.tx.closed {
+			c.tx.Unlock()
+			return written, io.ErrClosedPipe
+		}
+
+		if space := pipeBufferSize - len(c.tx.buf); space > 0 {
+			n := len(b)
+			if n > space {
+				n = space
+			}
+
+			c.tx.buf = append(c.tx.buf, b[:n]...)
+			c.tx.signal()
+			c.tx.Unlock()
+
+			written += n
+			b = b[n:]
+
+			continue
+		}
+
+		changed := c.tx.changed
+		c.tx.Unlock()
+
+		if !wait(changed, deadline) {
+			return written, timeoutError{}
+		}
+	}
+
+	return written, nil
+}
+
+func (c *pipeConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	c.rx.close()
+	c.tx.close()
+
+	return nil
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	return c.SetWriteDeadline(t)
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+
+	c.rx.wake()
+
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+
+	c.tx.wake()
+
+	return nil
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "inproc: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,151 @@
+package transport
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// fastOpenQueueLength is how many connections carrying data in their SYN a listener queues before
+// falling back to a regular handshake.
+const fastOpenQueueLength = 256
+
+// ErrUnsupportedOption is returned when listening or dialing with a socket option the platform does
+// not support.
+var ErrUnsupportedOption = errors.New("transport: socket option is not supported on this platform")
+
+// SocketOptions tune the TCP sockets a transport layer listens and dials through. Zero values leave
+// the defaults of Go and the operating system in place.
+type SocketOptions struct {
+	// ReusePort sets SO_REUSEPORT on listening sockets, such that several processes may listen on
+	// the same port, with the kernel balancing incoming connections amongst them.
+	ReusePort bool
+
+	// Nagle clears TCP_NODELAY, which Go sets by default, such that small writes are coalesced at
+	// the expense of latency.
+	Nagle bool
+
+	// KeepAlive is how often TCP keepalive probes are sent over idle connections. Zero leaves the
+	// default of Go in place, and a negative duration disables keepalive probes.
+	KeepAlive time.Duration
+
+	// ReadBufferSize and WriteBufferSize set SO_RCVBUF and SO_SNDBUF on every connection.
+	ReadBufferSize, WriteBufferSize int
+
+	// FastOpen has listeners accept, and dials send, data within the SYN of a connection through
+	// TCP Fast Open. It is only supported on Linux.
+	FastOpen bool
+}
+
+func (o SocketOptions) listen(address string) (net.Listener, error) {
+	config := net.ListenConfig{KeepAlive: o.KeepAlive, Control: o.control(true)}
+
+	listener, err := config.Listen(context.Background(), "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !o.Nagle && o.ReadBufferSize <= 0 && o.WriteBufferSize <= 0 {
+		return listener, nil
+	}
+
+	return &tunedListener{Listener: listener, options: o}, nil
+}
+
+func (o SocketOptions) dial(address string, timeout time.Duration) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: timeout, KeepAlive: o.KeepAlive, Control: o.control(false)}
+
+	conn, err := dialer.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.configure(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// configure applies the options which may be set on a connection once it is established.
+func (o SocketOptions) configure(conn net.Conn) error {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if o.Nagle {
+		if err := tcp.SetNoDelay(false); err != nil {
+			return errors.Wrap(err, "failed to clear TCP_NODELAY")
+		}
+	}
+
+	if o.ReadBufferSize > 0 {
+		if err := tcp.SetReadBuffer(o.ReadBufferSize); err != nil {
+			return errors.Wrap(err, "failed to set SO_RCVBUF")
+		}
+	}
+
+	if o.WriteBufferSize > 0 {
+		if err := tcp.SetWriteBuffer(o.WriteBufferSize); err != nil {
+			return errors.Wrap(err, "failed to set SO_SNDBUF")
+		}
+	}
+
+	return nil
+}
+
+// control returns a function which applies the options which must be set on a socket before it
+// listens or connects.
+func (o SocketOptions) control(listening bool) func(network, address string, c syscall.RawConn) error {
+	if !o.ReusePort && !o.FastOpen {
+		return nil
+	}
+
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+
+		if cerr := c.Control(func(fd uintptr) { err = setSocketOptions(fd, o, listening) }); cerr != nil {
+			return cerr
+		}
+
+		return err
+	}
+}
+
+// tunedListener applies socket options to every connection it accepts.
+type tunedListener struct {
+	net.Listener
+	options SocketOptions
+}
+
+func (l *tunedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.options.configure(conn); err != nil {
+		conn.Close()
+		return nil, configureError{err}
+	}
+
+	return conn, nil
+}
+
+// configureError is returned by Accept should a single connection fail to be configured, and is
+// temporary such that nodes carry on accepting connections.
+type configureError struct {
+	error
+}
+
+func (configureError) Temporary() bool {
+	return true
+}
+
+func (e configureError) Cause() error {
+	return e.error
+}
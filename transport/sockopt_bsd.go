@@ -0,0 +1,23 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package transport
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+func setSocketOptions(fd uintptr, o SocketOptions, listening bool) error {
+	if o.FastOpen {
+		return errors.Wrap(ErrUnsupportedOption, "TCP Fast Open")
+	}
+
+	if o.ReusePort && listening {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+			return errors.Wrap(err, "failed to set SO_REUSEPORT")
+		}
+	}
+
+	return nil
+}
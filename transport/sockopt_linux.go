@@ -0,0 +1,26 @@
+package transport
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+func setSocketOptions(fd uintptr, o SocketOptions, listening bool) error {
+	if o.ReusePort && listening {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+			return errors.Wrap(err, "failed to set SO_REUSEPORT")
+		}
+	}
+
+	if o.FastOpen {
+		if listening {
+			if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN, fastOpenQueueLength); err != nil {
+				return errors.Wrap(err, "failed to set TCP_FASTOPEN")
+			}
+		} else if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN_CONNECT, 1); err != nil {
+			return errors.Wrap(err, "failed to set TCP_FASTOPEN_CONNECT")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package transport
+
+import "github.com/pkg/errors"
+
+func setSocketOptions(fd uintptr, o SocketOptions, listening bool) error {
+	if o.FastOpen {
+		return errors.Wrap(ErrUnsupportedOption, "TCP Fast Open")
+	}
+
+	if o.ReusePort {
+		return errors.Wrap(ErrUnsupportedOption, "SO_REUSEPORT")
+	}
+
+	return nil
+}
@@ -9,7 +9,9 @@ import (
 
 var _ Layer = (*tcp)(nil)
 
-type tcp struct{}
+type tcp struct {
+	options SocketOptions
+}
 
 func (t tcp) String() string {
 	return "tcp"
@@ -20,7 +22,7 @@ func (t tcp) Listen(host string, port uint16) (net.Listener, error) {
 		return nil, errors.Errorf("unable to parse host as IP: %s", host)
 	}
 
-	listener, err := net.Listen("tcp", ":"+strconv.Itoa(int(port)))
+	listener, err := t.options.listen(":" + strconv.Itoa(int(port)))
 	if err != nil {
 		return nil, err
 	}
@@ -29,7 +31,7 @@ func (t tcp) Listen(host string, port uint16) (net.Listener, error) {
 }
 
 func (t tcp) Dial(address string) (net.Conn, error) {
-	conn, err := net.DialTimeout("tcp", address, 3*time.Second)
+	conn, err := t.options.dial(address, 3*time.Second)
 	if err != nil {
 		return nil, err
 	}
@@ -49,3 +51,10 @@ func (t tcp) Port(address net.Addr) uint16 {
 func NewTCP() tcp {
 	return tcp{}
 }
+
+// WithSocketOptions returns a tcp instance which listens and dials through sockets tuned by a set of
+// options.
+func (t tcp) WithSocketOptions(options SocketOptions) tcp {
+	t.options = options
+	return t
+}
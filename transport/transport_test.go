@@ -2,8 +2,12 @@ package transport
 
 import (
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
 	"net"
+	"os"
 	"sync"
 	"testing"
 	"time"
@@ -110,3 +114,208 @@ func TestTCP(t *testing.T) {
 	testBadHost(t, layer)
 	testPortZero(t, layer)
 }
+
+func TestTCPSocketOptions(t *testing.T) {
+	layer := NewTCP().WithSocketOptions(SocketOptions{
+		Nagle:           true,
+		KeepAlive:       -1,
+		ReadBufferSize:  64 * 1024,
+		WriteBufferSize: 64 * 1024,
+	})
+
+	testTransport(t, layer, "127.0.0.1", 8930)
+
+	// Listeners which reuse their port may share it with one another.
+	reusing := NewTCP().WithSocketOptions(SocketOptions{ReusePort: true})
+
+	first, err := reusing.Listen("127.0.0.1", 8931)
+	if errors.Cause(err) == ErrUnsupportedOption {
+		t.Skip("SO_REUSEPORT is not supported on this platform")
+	}
+	assert.NoError(t, err)
+	defer first.Close()
+
+	second, err := reusing.Listen("127.0.0.1", 8931)
+	assert.NoError(t, err)
+	defer second.Close()
+
+	_, err = NewTCP().Listen("127.0.0.1", 8931)
+	assert.Error(t, err)
+}
+
+func TestWebSocket(t *testing.T) {
+	layer := NewWebSocket()
+	var wg sync.WaitGroup
+
+	assert.Equal(t, "ws", layer.String())
+
+	// run the test over several ports
+	for i := 8910; i < 8920; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			testTransport(t, layer, "127.0.0.1", uint16(i))
+		}(i)
+	}
+	wg.Wait()
+
+	testBadHost(t, layer)
+	testPortZero(t, layer)
+}
+
+func TestUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "noise")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	layer := NewUnix(dir)
+	var wg sync.WaitGroup
+
+	assert.Equal(t, "unix", layer.String())
+
+	// run the test over several ports
+	for i := 8900; i < 8910; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			testTransport(t, layer, "127.0.0.1", uint16(i))
+		}(i)
+	}
+	wg.Wait()
+
+	testBadHost(t, layer)
+	testPortZero(t, layer)
+
+	// a stale socket file left behind should not prevent listening
+	stale, err := os.Create(layer.Path("127.0.0.1", 8920))
+	assert.NoError(t, err)
+	stale.Close()
+
+	lis, err := layer.Listen("127.0.0.1", 8920)
+	assert.NoError(t, err)
+
+	// but a socket that is being listened on should
+	_, err = layer.Listen("127.0.0.1", 8920)
+	assert.Error(t, err)
+
+	lis.Close()
+}
+
+func TestInProcess(t *testing.T) {
+	layer := NewInProcess()
+	var wg sync.WaitGroup
+
+	assert.Equal(t, "inproc", layer.String())
+
+	// run the test over several ports
+	for i := 8900; i < 8910; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			testTransport(t, layer, "127.0.0.1", uint16(i))
+		}(i)
+	}
+	wg.Wait()
+
+	testBadHost(t, layer)
+	testPortZero(t, layer)
+
+	// reads should respect deadlines
+	lis, err := layer.Listen("127.0.0.1", 8920)
+	assert.NoError(t, err)
+
+	go func() {
+		_, _ = layer.Dial("127.0.0.1:8920")
+	}()
+
+	conn, err := lis.Accept()
+	assert.NoError(t, err)
+	assert.True(t, IsInProcess(conn))
+
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+
+	_, err = conn.Read(make([]byte, 1))
+	if assert.Error(t, err) {
+		assert.True(t, err.(net.Error).Timeout())
+	}
+
+	lis.Close()
+
+	_, err = layer.Dial("127.0.0.1:8920")
+	assert.Error(t, err)
+}
+
+func TestInProcessBackpressure(t *testing.T) {
+	layer := NewInProcess()
+
+	lis, err := layer.Listen("127.0.0.1", 8921)
+	assert.NoError(t, err)
+	defer lis.Close()
+
+	dialed := make(chan net.Conn, 1)
+
+	go func() {
+		conn, err := layer.Dial("127.0.0.1:8921")
+		assert.NoError(t, err)
+		dialed <- conn
+	}()
+
+	reader, err := lis.Accept()
+	assert.NoError(t, err)
+
+	writer := <-dialed
+
+	// writes should block, and respect deadlines, once the buffer is full
+	assert.NoError(t, writer.SetWriteDeadline(time.Now().Add(10*time.Millisecond)))
+
+	n, err := writer.Write(make([]byte, pipeBufferSize+1))
+	assert.Equal(t, pipeBufferSize, n)
+	if assert.Error(t, err) {
+		assert.True(t, err.(net.Error).Timeout())
+	}
+
+	// writes should resume once the other end reads
+	assert.NoError(t, writer.SetWriteDeadline(time.Time{}))
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := writer.Write([]byte("hello"))
+		done <- err
+	}()
+
+	_, err = io.ReadFull(reader, make([]byte, pipeBufferSize))
+	assert.NoError(t, err)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("write did not resume after the other end read")
+	}
+
+	buf := make([]byte, 5)
+
+	_, err = io.ReadFull(reader, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	// blocked writes should fail once the other end closes
+	_, err = writer.Write(make([]byte, pipeBufferSize))
+	assert.NoError(t, err)
+
+	go func() {
+		_, err := writer.Write([]byte("blocked"))
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, reader.Close())
+
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("write did not fail after the other end closed")
+	}
+}
@@ -0,0 +1,121 @@
+package transport
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ Layer = (*Unix)(nil)
+
+// Unix is a transport layer which connects nodes living on the same machine through unix domain
+// sockets, such that sidecar services may use the same API as they would with remote peers while
+// bypassing the network stack. The handshake and all messages of the protocol a node enforces
+// still take place over the socket.
+//
+// A node listening on host:port listens on the socket file host-port.sock in the transports
+// directory, and dialing host:port connects to said socket file.
+type Unix struct {
+	dir string
+}
+
+// NewUnix returns a unix domain socket transport layer whose socket files are placed in a
+// specified directory. Keep in mind that socket paths are limited to around 100 characters.
+func NewUnix(dir string) *Unix {
+	return &Unix{dir: dir}
+}
+
+func (t *Unix) String() string {
+	return "unix"
+}
+
+// Path returns the path of the socket file a node listening on a specified host and port
+// listens on.
+func (t *Unix) Path(host string, port uint16) string {
+	return filepath.Join(t.dir, fmt.Sprintf("%s-%d.sock", host, port))
+}
+
+func (t *Unix) Listen(host string, port uint16) (net.Listener, error) {
+	if net.ParseIP(host) == nil {
+		return nil, errors.Errorf("unable to parse host as IP: %s", host)
+	}
+
+	if port == 0 {
+		port = uint16(rand.Intn(50000) + 10000)
+	}
+
+	path := t.Path(host, port)
+
+	// Remove any stale socket file left behind by a node that did not shut down cleanly, so long
+	// as no node is listening on it.
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, 100*time.Millisecond); err == nil {
+			conn.Close()
+			return nil, errors.Errorf("address %s:%d is already in use", host, port)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, errors.Wrapf(err, "failed to remove stale socket %s", path)
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+func (t *Unix) Dial(address string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid port in address %s", address)
+	}
+
+	return net.Dial("unix", t.Path(host, uint16(port)))
+}
+
+// IP returns the host encoded in the name of a socket file. Sockets of dialing nodes are unnamed,
+// and are reported to be on the loopback address.
+func (t *Unix) IP(address net.Addr) net.IP {
+	host, _, ok := parseSocketName(address)
+	if !ok {
+		return net.IPv4(127, 0, 0, 1)
+	}
+
+	return net.ParseIP(host)
+}
+
+// Port returns the port encoded in the name of a socket file. Sockets of dialing nodes are
+// unnamed, and are reported to be on port 0.
+func (t *Unix) Port(address net.Addr) uint16 {
+	_, port, ok := parseSocketName(address)
+	if !ok {
+		return 0
+	}
+
+	return port
+}
+
+func parseSocketName(address net.Addr) (string, uint16, bool) {
+	name := strings.TrimSuffix(filepath.Base(address.String()), ".sock")
+
+	idx := strings.LastIndex(name, "-")
+	if idx < 0 {
+		return "", 0, false
+	}
+
+	port, err := strconv.ParseUint(name[idx+1:], 10, 16)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return name[:idx], uint16(port), true
+}
@@ -0,0 +1,248 @@
+package transport
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"github.com/perlin-network/noise/internal/supervisor"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWebSocketPath is the HTTP path nodes upgrade connections to WebSockets on.
+	DefaultWebSocketPath = "/noise"
+
+	// WebSocketSubprotocol is the WebSocket subprotocol negotiated by nodes.
+	WebSocketSubprotocol = "noise"
+
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var (
+	_ Layer        = (*WebSocket)(nil)
+	_ net.Listener = (*Upgrader)(nil)
+	_ http.Handler = (*Upgrader)(nil)
+)
+
+// WebSocket is a transport layer which tunnels connections inside WebSockets, established
+// through a HTTP/1.1 Upgrade request. Nodes behind firewalls, proxies or CDNs which only pass
+// HTTP traffic may then still connect to and be connected to by other nodes. The handshake and
+// all messages of the protocol a node enforces take place within the WebSocket.
+type WebSocket struct {
+	path    string
+	timeout time.Duration
+	options SocketOptions
+}
+
+// NewWebSocket returns a WebSocket transport layer which upgrades connections on
+// DefaultWebSocketPath.
+func NewWebSocket() *WebSocket {
+	return &WebSocket{path: DefaultWebSocketPath, timeout: 3 * time.Second}
+}
+
+// WithPath sets the HTTP path connections are upgraded to WebSockets on.
+func (t *WebSocket) WithPath(path string) *WebSocket {
+	t.path = path
+	return t
+}
+
+// WithTimeout sets how long dialing and upgrading a connection may take.
+func (t *WebSocket) WithTimeout(timeout time.Duration) *WebSocket {
+	t.timeout = timeout
+	return t
+}
+
+// WithSocketOptions sets the options the TCP sockets WebSockets are tunneled through are tuned by.
+// Options are ignored by browsers.
+func (t *WebSocket) WithSocketOptions(options SocketOptions) *WebSocket {
+	t.options = options
+	return t
+}
+
+func (t *WebSocket) String() string {
+	return "ws"
+}
+
+// Listen serves HTTP on a specified port, upgrading requests made to the transports path into
+// WebSocket connections accepted by the returned listener.
+func (t *WebSocket) Listen(host string, port uint16) (net.Listener, error) {
+	if net.ParseIP(host) == nil {
+		return nil, errors.Errorf("unable to parse host as IP: %s", host)
+	}
+
+	listener, err := t.options.listen(":" + strconv.Itoa(int(port)))
+	if err != nil {
+		return nil, err
+	}
+
+	upgrader := NewUpgrader(listener.Addr())
+
+	mux := http.NewServeMux()
+	mux.Handle(t.path, upgrader)
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: t.timeout}
+
+	// The goroutine serving HTTP is waited on once the upgrader is closed.
+	group := supervisor.New(nil)
+
+	upgrader.onClose = func() error {
+		err := server.Close()
+		_ = group.Wait()
+
+		return err
+	}
+
+	group.Go(func(context.Context) error {
+		upgrader.shutdown(server.Serve(listener))
+		return nil
+	})
+
+	return upgrader, nil
+}
+
+func (t *WebSocket) IP(address net.Addr) net.IP {
+	return address.(*net.TCPAddr).IP
+}
+
+func (t *WebSocket) Port(address net.Addr) uint16 {
+	return uint16(address.(*net.TCPAddr).Port)
+}
+
+// Upgrader is a HTTP handler which upgrades requests into WebSocket connections, and is a
+// listener which accepts said connections. It may be mounted onto an existing HTTP server, such
+// that a node may share a port with a HTTP service.
+type Upgrader struct {
+	addr net.Addr
+
+	conns chan net.Conn
+
+	once    sync.Once
+	done    chan struct{}
+	err     error
+	onClose func() error
+}
+
+// NewUpgrader returns an upgrader whose listener reports a specified address.
+func NewUpgrader(addr net.Addr) *Upgrader {
+	return &Upgrader{
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (u *Upgrader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected websocket upgrade", http.StatusUpgradeRequired)
+		return
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusBadRequest)
+		return
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing websocket key", http.StatusBadRequest)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket upgrade unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n"
+
+	if headerContains(r.Header, "Sec-WebSocket-Protocol", WebSocketSubprotocol) {
+		response += "Sec-WebSocket-Protocol: " + WebSocketSubprotocol + "\r\n"
+	}
+
+	if _, err := io.WriteString(conn, response+"\r\n"); err != nil {
+		conn.Close()
+		return
+	}
+
+	// The deadline for reading request headers set by the HTTP server must be cleared.
+	_ = conn.SetDeadline(time.Time{})
+
+	select {
+	case u.conns <- newWSConn(conn, rw.Reader, false):
+	case <-u.done:
+		conn.Close()
+	}
+}
+
+func (u *Upgrader) Accept() (net.Conn, error) {
+	select {
+	case conn := <-u.conns:
+		return conn, nil
+	case <-u.done:
+		return nil, u.err
+	}
+}
+
+func (u *Upgrader) Close() error {
+	u.shutdown(nil)
+
+	if u.onClose != nil {
+		return u.onClose()
+	}
+
+	return nil
+}
+
+func (u *Upgrader) Addr() net.Addr {
+	return u.addr
+}
+
+func (u *Upgrader) shutdown(err error) {
+	u.once.Do(func() {
+		if err == nil || err == http.ErrServerClosed {
+			err = errors.New("websocket: listener closed")
+		}
+
+		u.err = err
+		close(u.done)
+	})
+}
+
+func wsAccept(key string) string {
+	digest := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
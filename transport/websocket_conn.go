@@ -0,0 +1,250 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	wsMaxControlPayload = 125
+)
+
+var _ net.Conn = (*wsConn)(nil)
+
+// wsConn exposes the payloads of binary WebSocket frames sent over a connection as a byte stream.
+// Every write is sent as a single binary frame, which is masked should we be the client, as
+// mandated by RFC 6455.
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	client bool
+
+	readMu    sync.Mutex
+	remaining uint64
+	mask      [4]byte
+	masked    bool
+	maskPos   int
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+func newWSConn(conn net.Conn, reader *bufio.Reader, client bool) *wsConn {
+	return &wsConn{conn: conn, reader: reader, client: client}
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for c.remaining == 0 {
+		if err := c.nextDataFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if uint64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+
+	n, err := c.reader.Read(b)
+
+	if c.masked {
+		for i := 0; i < n; i++ {
+			b[i] ^= c.mask[c.maskPos%4]
+			c.maskPos++
+		}
+	}
+
+	c.remaining -= uint64(n)
+
+	return n, err
+}
+
+// nextDataFrame reads frame headers until the header of a data frame is read, responding to any
+// control frames read along the way.
+func (c *wsConn) nextDataFrame() error {
+	for {
+		opcode, length, err := c.readHeader()
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case wsOpContinuation, wsOpText, wsOpBinary:
+			c.remaining = length
+			return nil
+		case wsOpClose, wsOpPing, wsOpPong:
+			if length > wsMaxControlPayload {
+				return errors.New("websocket: control frame payload too large")
+			}
+
+			payload := make([]byte, length)
+
+			if _, err := io.ReadFull(c.reader, payload); err != nil {
+				return err
+			}
+
+			if c.masked {
+				for i := range payload {
+					payload[i] ^= c.mask[i%4]
+				}
+			}
+
+			switch opcode {
+			case wsOpClose:
+				_ = c.writeFrame(wsOpClose, payload)
+				return io.EOF
+			case wsOpPing:
+				if err := c.writeFrame(wsOpPong, payload); err != nil {
+					return err
+				}
+			}
+		default:
+			return errors.Errorf("websocket: unknown opcode %d", opcode)
+		}
+	}
+}
+
+func (c *wsConn) readHeader() (byte, uint64, error) {
+	var header [2]byte
+
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return 0, 0, err
+	}
+
+	opcode := header[0] & 0x0F
+	c.masked = header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	// Clients must mask all frames they send, and servers must not mask any frames they send.
+	if c.masked == c.client {
+		return 0, 0, errors.New("websocket: frame masking violates protocol")
+	}
+
+	switch length {
+	case 126:
+		var buf [2]byte
+		if _, err := io.ReadFull(c.reader, buf[:]); err != nil {
+			return 0, 0, err
+		}
+		length = uint64(binary.BigEndian.Uint16(buf[:]))
+	case 127:
+		var buf [8]byte
+		if _, err := io.ReadFull(c.reader, buf[:]); err != nil {
+			return 0, 0, err
+		}
+		length = binary.BigEndian.Uint64(buf[:])
+	}
+
+	if c.masked {
+		if _, err := io.ReadFull(c.reader, c.mask[:]); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	c.maskPos = 0
+
+	return opcode, length, nil
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.writeFrame(wsOpBinary, b); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return errors.New("websocket: connection closed")
+	}
+
+	buf := make([]byte, 0, 14+len(payload))
+	buf = append(buf, 0x80|opcode)
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+
+	switch length := len(payload); {
+	case length <= 125:
+		buf = append(buf, maskBit|byte(length))
+	case length <= 0xFFFF:
+		buf = append(buf, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(buf[len(buf)-2:], uint16(length))
+	default:
+		buf = append(buf, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(buf[len(buf)-8:], uint64(length))
+	}
+
+	if c.client {
+		var mask [4]byte
+
+		if _, err := io.ReadFull(rand.Reader, mask[:]); err != nil {
+			return errors.Wrap(err, "websocket: failed to generate frame mask")
+		}
+
+		buf = append(buf, mask[:]...)
+
+		for i, x := range payload {
+			buf = append(buf, x^mask[i%4])
+		}
+	} else {
+		buf = append(buf, payload...)
+	}
+
+	if opcode == wsOpClose {
+		c.closed = true
+	}
+
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// Close sends a close frame on a best-effort basis, and closes the underlying connection.
+func (c *wsConn) Close() error {
+	_ = c.conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	_ = c.writeFrame(wsOpClose, nil)
+
+	return c.conn.Close()
+}
+
+func (c *wsConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *wsConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
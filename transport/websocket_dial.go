@@ -0,0 +1,78 @@
+//go:build !js
+// +build !js
+
+package transport
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Dial connects to a node at a specified address, and upgrades the connection to a WebSocket.
+func (t *WebSocket) Dial(address string) (net.Conn, error) {
+	conn, err := t.options.dial(address, t.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := upgradeClient(conn, address, t.path, t.timeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+func upgradeClient(conn net.Conn, address, path string, timeout time.Duration) (net.Conn, error) {
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	var nonce [16]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, errors.Wrap(err, "websocket: failed to generate key")
+	}
+
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req := fmt.Sprintf("GET %s HTTP/1.1\r\n"+
+		"Host: %s\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\n"+
+		"Sec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Protocol: %s\r\n\r\n", path, address, key, WebSocketSubprotocol)
+
+	if _, err := io.WriteString(conn, req); err != nil {
+		return nil, errors.Wrap(err, "websocket: failed to send upgrade request")
+	}
+
+	reader := bufio.NewReader(conn)
+
+	res, err := http.ReadResponse(reader, &http.Request{Method: http.MethodGet})
+	if err != nil {
+		return nil, errors.Wrap(err, "websocket: failed to read upgrade response")
+	}
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		return nil, errors.Errorf("websocket: expected upgrade, but got status %q", res.Status)
+	}
+
+	if res.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		return nil, errors.New("websocket: server sent an invalid accept key")
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	return newWSConn(conn, reader, true), nil
+}
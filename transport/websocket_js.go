@@ -0,0 +1,57 @@
+//go:build js && wasm
+// +build js,wasm
+
+package transport
+
+import (
+	"github.com/perlin-network/noise/internal/jsconn"
+	"github.com/pkg/errors"
+	"net"
+	"net/url"
+	"strconv"
+	"syscall/js"
+	"time"
+)
+
+// Dial connects to a node at a specified address through the browsers WebSocket API, as browsers
+// do not expose raw sockets.
+func (t *WebSocket) Dial(address string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "websocket: invalid address %q", address)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "websocket: invalid port in address %q", address)
+	}
+
+	target := url.URL{Scheme: "ws", Host: address, Path: t.path}
+
+	ws := js.Global().Get("WebSocket").New(target.String(), WebSocketSubprotocol)
+	conn := jsconn.New(ws, &net.TCPAddr{IP: net.IPv4zero}, &net.TCPAddr{IP: net.ParseIP(host), Port: port})
+
+	opened := make(chan struct{})
+
+	onOpen := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		close(opened)
+		return nil
+	})
+
+	ws.Set("onopen", onOpen)
+
+	defer func() {
+		ws.Set("onopen", js.Null())
+		onOpen.Release()
+	}()
+
+	select {
+	case <-opened:
+		return conn, nil
+	case <-conn.Done():
+		return nil, errors.Errorf("websocket: failed to connect to %s", target.String())
+	case <-time.After(t.timeout):
+		conn.Close()
+		return nil, errors.Errorf("websocket: timed out connecting to %s", target.String())
+	}
+}
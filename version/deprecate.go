@@ -0,0 +1,253 @@
+package version
+
+import (
+	"fmt"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeprecatedVersionError is returned by the block should a peer only speak legacy versions of the
+// protocol our node stopped speaking at their cutoff. It matches ErrIncompatibleVersion.
+type DeprecatedVersionError struct {
+	Version Version
+	Cutoff  time.Time
+}
+
+func (e DeprecatedVersionError) Error() string {
+	return fmt.Sprintf("%s; peer only speaks %s, which we stopped speaking on %s", ErrIncompatibleVersion, e.Version, e.Cutoff.Format(time.RFC3339))
+}
+
+// Cause returns ErrIncompatibleVersion such that callers using `errors.Cause` may match against it.
+func (e DeprecatedVersionError) Cause() error {
+	return ErrIncompatibleVersion
+}
+
+func (e DeprecatedVersionError) Is(target error) bool {
+	return target == ErrIncompatibleVersion
+}
+
+// DisconnectReason has the protocol announce to the peer that it speaks an incompatible version
+// when disconnecting it.
+func (e DeprecatedVersionError) DisconnectReason() noise.DisconnectReason {
+	return noise.ReasonIncompatibleVersion
+}
+
+// legacy is a version of the protocol our node still speaks besides its own, until a cutoff.
+type legacy struct {
+	version Version
+	cutoff  time.Time
+}
+
+// WithLegacy has our node still speak a legacy version of the protocol alongside its own, such that
+// the network may be upgraded to a new version one node at a time. Peers which only speak the legacy
+// version negotiate it with us, yet are logged and counted as deprecated. Should cutoff not be zero,
+// our node stops speaking the legacy version at the cutoff, and disconnects peers speaking it.
+//
+// Peers which speak both our version and a legacy version negotiate the highest version both ends
+// speak. Which version was negotiated with a peer is reported by Negotiated.
+func (b *block) WithLegacy(version Version, cutoff time.Time) *block {
+	b.legacy = append(b.legacy, legacy{version: version, cutoff: cutoff})
+
+	sort.SliceStable(b.legacy, func(i, j int) bool {
+		return b.legacy[j].version.less(b.legacy[i].version)
+	})
+
+	if len(b.legacy) > maxAlso {
+		panic(fmt.Sprintf("version: cannot speak more than %d legacy versions", maxAlso))
+	}
+
+	return b
+}
+
+// speaking returns the legacy versions our node still speaks as of a time, from highest to lowest.
+func (b *block) speaking(now time.Time) []Version {
+	var versions []Version
+
+	for _, l := range b.legacy {
+		if l.cutoff.IsZero() || now.Before(l.cutoff) {
+			versions = append(versions, l.version)
+		}
+	}
+
+	return versions
+}
+
+// negotiate picks the highest version we speak which is compatible with any version our peer
+// speaks, alongside the highest version our peer speaks compatible with it. It reports false
+// should we speak no version in common.
+func (b *block) negotiate(now time.Time, hello Hello) (ours, theirs Version, ok bool) {
+	candidates := append([]Version{hello.Version}, hello.Also...)
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[j].less(candidates[i])
+	})
+
+	for _, ours := range append([]Version{b.version}, b.speaking(now)...) {
+		for _, theirs := range candidates {
+			if b.compatible(ours, theirs) {
+				return ours, theirs, true
+			}
+		}
+	}
+
+	return Version{}, Version{}, false
+}
+
+// cutOff returns the legacy version past its cutoff that our peer would have negotiated with us,
+// should there be one.
+func (b *block) cutOff(now time.Time, hello Hello) (legacy, bool) {
+	for _, l := range b.legacy {
+		if l.cutoff.IsZero() || now.Before(l.cutoff) {
+			continue
+		}
+
+		for _, theirs := range append([]Version{hello.Version}, hello.Also...) {
+			if b.compatible(l.version, theirs) {
+				return l, true
+			}
+		}
+	}
+
+	return legacy{}, false
+}
+
+// deprecate warns of a peer which negotiated a legacy version with us, and disconnects the peer at
+// the cutoff of the version.
+func (b *block) deprecate(peer *noise.Peer, now time.Time, version Version) {
+	var cutoff time.Time
+
+	for _, l := range b.legacy {
+		if l.version == version {
+			cutoff = l.cutoff
+		}
+	}
+
+	log.Warn().
+		Str("address", peer.RemoteIP().String()).
+		Str("version", version.String()).
+		Time("cutoff", cutoff).
+		Msg("Peer speaks a deprecated version of the protocol.")
+
+	if cutoff.IsZero() {
+		return
+	}
+
+	timer := peer.Node().Clock().AfterFunc(cutoff.Sub(now), func() {
+		peer.DisconnectWithReason(noise.ReasonIncompatibleVersion)
+	})
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		timer.Stop()
+		return nil
+	})
+}
+
+// Negotiated returns the version of the protocol we speak to a peer, which is a legacy version
+// of ours should the peer only speak that. It reports false should the peer not have completed the
+// block.
+func Negotiated(peer *noise.Peer) (Version, bool) {
+	v, ok := peer.Get(keyNegotiated).(Version)
+	return v, ok
+}
+
+// Usage counts which versions of the protocol peers negotiated with our node, as a measure of how
+// much of the network has yet to upgrade off of legacy versions.
+type Usage struct {
+	// Sessions counts the peers which negotiated each version, keyed by the version.
+	Sessions map[string]uint64 `json:"sessions"`
+
+	// Deprecated counts the peers which negotiated a legacy version.
+	Deprecated uint64 `json:"deprecated"`
+
+	// Refused counts the peers which spoke no version in common with our node.
+	Refused uint64 `json:"refused"`
+}
+
+type usage struct {
+	sync.Mutex
+
+	sessions   map[Version]uint64
+	deprecated uint64
+	refused    uint64
+}
+
+func (u *usage) record(version Version, deprecated bool) {
+	u.Lock()
+	defer u.Unlock()
+
+	u.sessions[version]++
+
+	if deprecated {
+		u.deprecated++
+	}
+}
+
+func (u *usage) refuse() {
+	u.Lock()
+	defer u.Unlock()
+
+	u.refused++
+}
+
+// Usage returns how many peers negotiated each version of the protocol with our node so far.
+func (b *block) Usage() Usage {
+	b.usage.Lock()
+	defer b.usage.Unlock()
+
+	out := Usage{Sessions: make(map[string]uint64, len(b.usage.sessions)), Deprecated: b.usage.deprecated, Refused: b.usage.refused}
+
+	for version, count := range b.usage.sessions {
+		out.Sessions[version.String()] = count
+	}
+
+	return out
+}
+
+// Router dispatches messages to handlers registered per version of the protocol, by the version
+// negotiated with the peer which sent them, such that messages of the same type may be handled as
+// each version calls for.
+type Router struct {
+	routes []route
+}
+
+type route struct {
+	version Version
+	handler noise.OnMessageReceivedCallback
+}
+
+// NewRouter returns a router without any handler.
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle registers a handler for messages from peers which negotiated a version compatible with a
+// version under semantic versioning rules, as reported by Compatible.
+func (r *Router) Handle(version Version, handler noise.OnMessageReceivedCallback) *Router {
+	r.routes = append(r.routes, route{version: version, handler: handler})
+	return r
+}
+
+// Callback returns a callback to be registered through `OnMessageReceived`, which dispatches
+// messages to the first handler registered for the version negotiated with their peer. Messages
+// from peers for whose version no handler is registered are dropped.
+func (r *Router) Callback() noise.OnMessageReceivedCallback {
+	return func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		negotiated, ok := Negotiated(peer)
+		if !ok {
+			return nil
+		}
+
+		for _, route := range r.routes {
+			if Compatible(route.version, negotiated) {
+				return route.handler(node, opcode, peer, message)
+			}
+		}
+
+		log.Debug().Str("version", negotiated.String()).Msg("Dropped a message, as no handler is registered for the version negotiated with its peer.")
+
+		return nil
+	}
+}
@@ -0,0 +1,141 @@
+// Package version has peers advertise the version of the protocol they speak to one another, and
+// disconnects peers whose versions are incompatible with ours.
+package version
+
+import (
+	"fmt"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	keyVersion    = "version.version"
+	keyNegotiated = "version.negotiated"
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrIncompatibleVersion = errors.New("version: peer speaks an incompatible version of the protocol")
+)
+
+// IncompatibleVersionError is returned by the block should a peer speak a version of the protocol
+// incompatible with ours. It matches ErrIncompatibleVersion.
+type IncompatibleVersionError struct {
+	Ours, Theirs Version
+}
+
+func (e IncompatibleVersionError) Error() string {
+	return fmt.Sprintf("%s; we speak %s, they speak %s", ErrIncompatibleVersion, e.Ours, e.Theirs)
+}
+
+// Cause returns ErrIncompatibleVersion such that callers using `errors.Cause` may match against it.
+func (e IncompatibleVersionError) Cause() error {
+	return ErrIncompatibleVersion
+}
+
+func (e IncompatibleVersionError) Is(target error) bool {
+	return target == ErrIncompatibleVersion
+}
+
+// DisconnectReason has the protocol announce to the peer that it speaks an incompatible version
+// when disconnecting it.
+func (e IncompatibleVersionError) DisconnectReason() noise.DisconnectReason {
+	return noise.ReasonIncompatibleVersion
+}
+
+type block struct {
+	opcodeHello noise.Opcode
+
+	version Version
+	legacy  []legacy
+
+	timeoutDuration time.Duration
+
+	compatible func(ours, theirs Version) bool
+
+	usage usage
+}
+
+// New returns a block which has every pair of peers advertise the version of the protocol they
+// speak, and which disconnects peers whose versions are incompatible with ours. By default,
+// versions are compatible under semantic versioning rules as reported by Compatible, and peers
+// that do not advertise their version within 10 seconds are disconnected.
+func New(version Version) *block {
+	return &block{version: version, timeoutDuration: 10 * time.Second, compatible: Compatible, usage: usage{sessions: make(map[Version]uint64)}}
+}
+
+func (b *block) TimeoutAfter(timeoutDuration time.Duration) *block {
+	b.timeoutDuration = timeoutDuration
+	return b
+}
+
+// WithCompatibility overrides the rules deciding which versions of the protocol peers may speak
+// for us to talk to them.
+func (b *block) WithCompatibility(compatible func(ours, theirs Version) bool) *block {
+	if compatible == nil {
+		panic("version: cannot have a nil compatibility fn")
+	}
+
+	b.compatible = compatible
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeHello = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Hello)(nil))
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	locker := peer.LockOnReceive(b.opcodeHello)
+	defer locker.Unlock()
+
+	now := peer.Node().Clock().Now()
+
+	if err := peer.SendMessage(Hello{Version: b.version, Also: b.speaking(now)}); err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "version: failed to advertise our version")
+	}
+
+	var hello Hello
+
+	select {
+	case <-peer.Node().Clock().After(b.timeoutDuration):
+		return errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeTimeout), "version: timed out waiting for peer to advertise its version")
+	case msg := <-peer.Receive(b.opcodeHello):
+		hello = msg.(Hello)
+	}
+
+	ours, theirs, ok := b.negotiate(now, hello)
+	if !ok {
+		b.usage.refuse()
+
+		if l, cut := b.cutOff(now, hello); cut {
+			return protocol.DisconnectWith(DeprecatedVersionError{Version: l.version, Cutoff: l.cutoff})
+		}
+
+		return protocol.DisconnectWith(IncompatibleVersionError{Ours: b.version, Theirs: hello.Version})
+	}
+
+	peer.Set(keyVersion, theirs)
+	peer.Set(keyNegotiated, ours)
+
+	b.usage.record(ours, ours != b.version)
+
+	if ours != b.version {
+		b.deprecate(peer, now, ours)
+	}
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Of returns the version of the protocol a peer speaks to us, which is a legacy version of the peer
+// should we only speak it that. It reports false should the peer not have completed the block.
+func Of(peer *noise.Peer) (Version, bool) {
+	v, ok := peer.Get(keyVersion).(Version)
+	return v, ok
+}
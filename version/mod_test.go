@@ -0,0 +1,242 @@
+package version
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	v, err := Parse("v1.2.3")
+	assert.NoError(t, err)
+	assert.Equal(t, Version{Major: 1, Minor: 2, Patch: 3}, v)
+	assert.Equal(t, "1.2.3", v.String())
+
+	v, err = Parse("2")
+	assert.NoError(t, err)
+	assert.Equal(t, Version{Major: 2}, v)
+
+	for _, s := range []string{"", "1.2.3.4", "1.x", "-1.0.0"} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	assert.True(t, Compatible(MustParse("1.2.3"), MustParse("1.9.0")))
+	assert.False(t, Compatible(MustParse("1.2.3"), MustParse("2.0.0")))
+
+	// Prior to 1.0.0, every minor version may break compatibility.
+	assert.True(t, Compatible(MustParse("0.3.1"), MustParse("0.3.7")))
+	assert.False(t, Compatible(MustParse("0.3.1"), MustParse("0.4.0")))
+}
+
+func dial(t *testing.T, ours, theirs *block) (*noise.Node, *noise.Node, *noise.Peer) {
+	layer := transport.NewBuffered()
+
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	alice, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	bob, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	protocol.New().Register(ours).Enforce(alice)
+	protocol.New().Register(theirs).Enforce(bob)
+
+	go alice.Listen()
+	go bob.Listen()
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	return alice, bob, peer
+}
+
+func TestVersion(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	alice, bob, peer := dial(t, New(MustParse("1.2.0")), New(MustParse("1.4.1")))
+
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	v, ok := Of(peer)
+	assert.True(t, ok)
+	assert.Equal(t, MustParse("1.4.1"), v)
+
+	alice.Kill()
+	bob.Kill()
+
+	// Peers speaking incompatible versions are disconnected with both versions reported.
+	alice, bob, peer = dial(t, New(MustParse("1.2.0")), New(MustParse("2.0.0")))
+
+	err := protocol.WaitUntilEstablished(peer)
+	assert.True(t, errors.Is(err, ErrIncompatibleVersion))
+
+	var incompatible IncompatibleVersionError
+	assert.True(t, errors.As(err, &incompatible))
+	assert.Equal(t, MustParse("1.2.0"), incompatible.Ours)
+	assert.Equal(t, MustParse("2.0.0"), incompatible.Theirs)
+
+	alice.Kill()
+	bob.Kill()
+
+	// Custom rules may override which versions are compatible.
+	exact := func(ours, theirs Version) bool { return ours == theirs }
+
+	alice, bob, peer = dial(t, New(MustParse("1.2.0")).WithCompatibility(exact), New(MustParse("1.2.1")))
+
+	assert.True(t, errors.Is(protocol.WaitUntilEstablished(peer), ErrIncompatibleVersion))
+
+	alice.Kill()
+	bob.Kill()
+
+	// Peers are told they were disconnected for speaking an incompatible version.
+	lenient := func(ours, theirs Version) bool { return true }
+
+	alice, bob, peer = dial(t, New(MustParse("1.2.0")).WithCompatibility(lenient), New(MustParse("2.0.0")))
+
+	disconnected := make(chan struct{})
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob never disconnected alice")
+	}
+
+	reason, announced := peer.RemoteDisconnectReason()
+	assert.True(t, announced)
+	assert.Equal(t, noise.ReasonIncompatibleVersion, reason)
+
+	alice.Kill()
+	bob.Kill()
+}
+
+func TestHello(t *testing.T) {
+	// Peers which only speak a single version exchange the same bytes as before.
+	buf := Hello{Version: MustParse("1.2.3")}.Write()
+	assert.Len(t, buf, 12)
+
+	msg, err := Hello{}.Read(payload.NewReader(buf))
+	assert.NoError(t, err)
+	assert.Equal(t, Hello{Version: MustParse("1.2.3")}, msg)
+
+	hello := Hello{Version: MustParse("2.0.0"), Also: []Version{MustParse("1.4.0"), MustParse("0.9.0")}}
+
+	msg, err = Hello{}.Read(payload.NewReader(hello.Write()))
+	assert.NoError(t, err)
+	assert.Equal(t, hello, msg)
+}
+
+func TestLegacy(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	// Peers which only speak a legacy version of ours negotiate it with us.
+	ours := New(MustParse("2.0.0")).WithLegacy(MustParse("1.0.0"), time.Time{})
+	alice, bob, peer := dial(t, ours, New(MustParse("1.3.0")))
+
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	v, ok := Negotiated(peer)
+	assert.True(t, ok)
+	assert.Equal(t, MustParse("1.0.0"), v)
+
+	v, ok = Of(peer)
+	assert.True(t, ok)
+	assert.Equal(t, MustParse("1.3.0"), v)
+
+	assert.Equal(t, Usage{Sessions: map[string]uint64{"1.0.0": 1}, Deprecated: 1}, ours.Usage())
+
+	// Messages are routed by the version negotiated with their peer.
+	var routed []string
+
+	route := func(name string) noise.OnMessageReceivedCallback {
+		return func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+			routed = append(routed, name)
+			return nil
+		}
+	}
+
+	callback := NewRouter().
+		Handle(MustParse("2.0.0"), route("v2")).
+		Handle(MustParse("1.0.0"), route("v1")).
+		Callback()
+
+	assert.NoError(t, callback(alice, noise.OpcodeNil, peer, nil))
+	assert.Equal(t, []string{"v1"}, routed)
+
+	alice.Kill()
+	bob.Kill()
+
+	// Peers which speak both our version and a legacy version negotiate the highest version.
+	ours = New(MustParse("2.0.0")).WithLegacy(MustParse("1.0.0"), time.Time{})
+	alice, bob, peer = dial(t, ours, New(MustParse("2.1.0")).WithLegacy(MustParse("1.3.0"), time.Time{}))
+
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	v, _ = Negotiated(peer)
+	assert.Equal(t, MustParse("2.0.0"), v)
+
+	v, _ = Of(peer)
+	assert.Equal(t, MustParse("2.1.0"), v)
+
+	assert.Equal(t, Usage{Sessions: map[string]uint64{"2.0.0": 1}}, ours.Usage())
+
+	alice.Kill()
+	bob.Kill()
+
+	// Peers which only speak a legacy version past its cutoff are refused.
+	cutoff := time.Now().Add(-time.Hour)
+
+	ours = New(MustParse("2.0.0")).WithLegacy(MustParse("1.0.0"), cutoff)
+	alice, bob, peer = dial(t, ours, New(MustParse("1.3.0")))
+
+	err := protocol.WaitUntilEstablished(peer)
+	assert.True(t, errors.Is(err, ErrIncompatibleVersion))
+
+	var deprecated DeprecatedVersionError
+	assert.True(t, errors.As(err, &deprecated))
+	assert.Equal(t, MustParse("1.0.0"), deprecated.Version)
+	assert.True(t, cutoff.Equal(deprecated.Cutoff))
+
+	assert.Equal(t, uint64(1), ours.Usage().Refused)
+
+	alice.Kill()
+	bob.Kill()
+
+	// Peers speaking a legacy version are disconnected at its cutoff.
+	alice, bob, peer = dial(t, New(MustParse("2.0.0")).WithLegacy(MustParse("1.0.0"), time.Now().Add(500*time.Millisecond)), New(MustParse("1.3.0")))
+
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	disconnected := make(chan struct{})
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("alice never disconnected bob at the cutoff")
+	}
+
+	alice.Kill()
+	bob.Kill()
+}
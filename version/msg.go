@@ -0,0 +1,86 @@
+package version
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
+
+var _ noise.Message = (*Hello)(nil)
+
+// maxAlso is the number of versions a peer may advertise speaking besides its own.
+const maxAlso = 16
+
+// Hello advertises the version of the protocol its sender speaks, alongside the legacy versions it
+// still speaks. Legacy versions are appended after the version of the sender only should there be
+// any, such that peers which only speak a single version exchange the same bytes as before.
+type Hello struct {
+	Version Version
+	Also    []Version
+}
+
+func (Hello) Read(reader payload.Reader) (noise.Message, error) {
+	v, err := readVersion(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := Hello{Version: v}
+
+	if reader.Len() == 0 {
+		return msg, nil
+	}
+
+	count, err := reader.ReadUint32()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read number of legacy versions")
+	}
+
+	if count > maxAlso {
+		return nil, errors.Errorf("got %d legacy versions, when at most %d are allowed", count, maxAlso)
+	}
+
+	for i := 0; i < int(count); i++ {
+		v, err := readVersion(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		msg.Also = append(msg.Also, v)
+	}
+
+	return msg, nil
+}
+
+func (m Hello) Write() []byte {
+	writer := writeVersion(payload.NewWriter(nil), m.Version)
+
+	if len(m.Also) > 0 {
+		writer.WriteUint32(uint32(len(m.Also)))
+
+		for _, v := range m.Also {
+			writeVersion(writer, v)
+		}
+	}
+
+	return writer.Bytes()
+}
+
+func readVersion(reader payload.Reader) (Version, error) {
+	var components [3]uint32
+
+	for i := range components {
+		n, err := reader.ReadUint32()
+		if err != nil {
+			return Version{}, errors.Wrap(err, "failed to read version")
+		}
+
+		components[i] = n
+	}
+
+	return Version{Major: components[0], Minor: components[1], Patch: components[2]}, nil
+}
+
+func writeVersion(writer payload.Writer, v Version) payload.Writer {
+	return writer.WriteUint32(v.Major).WriteUint32(v.Minor).WriteUint32(v.Patch)
+}
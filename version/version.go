@@ -0,0 +1,78 @@
+package version
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version of the protocol a node speaks.
+type Version struct {
+	Major, Minor, Patch uint32
+}
+
+// Parse parses a version of the form MAJOR.MINOR.PATCH, optionally prefixed with a v. Minor and
+// patch versions may be omitted, in which case they are zero.
+func Parse(s string) (Version, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+
+	if len(parts) > 3 {
+		return Version{}, errors.Errorf("version: %q has more than three components", s)
+	}
+
+	var components [3]uint32
+
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return Version{}, errors.Wrapf(err, "version: failed to parse %q", s)
+		}
+
+		components[i] = uint32(n)
+	}
+
+	return Version{Major: components[0], Minor: components[1], Patch: components[2]}, nil
+}
+
+// MustParse parses a version, and panics should it be malformed.
+func MustParse(s string) Version {
+	v, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compatible reports whether peers speaking two versions may talk to one another under semantic
+// versioning rules: versions must share their major version, and versions prior to 1.0.0 must
+// share their minor version as well.
+func Compatible(ours, theirs Version) bool {
+	if ours.Major != theirs.Major {
+		return false
+	}
+
+	if ours.Major == 0 {
+		return ours.Minor == theirs.Minor
+	}
+
+	return true
+}
+
+// less reports whether v precedes other.
+func (v Version) less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+
+	return v.Patch < other.Patch
+}
@@ -0,0 +1,42 @@
+package webrtc
+
+import (
+	"net"
+	"time"
+)
+
+// Engine negotiates WebRTC peer connections. Within browsers, NewBrowserEngine negotiates peer
+// connections through the browsers own WebRTC API. No engine is provided for native nodes, which
+// must implement one using a native WebRTC library.
+type Engine interface {
+	NewSession() (Session, error)
+}
+
+// Session is a single WebRTC peer connection carrying one reliable, ordered data channel.
+// Session descriptions and ICE candidates are opaque to the signaling protocol, and are relayed
+// between sessions as-is.
+type Session interface {
+	// Offer creates a session description offer, and sets it as the sessions local description.
+	// The data channel of the session is created by the offering side.
+	Offer() ([]byte, error)
+
+	// Answer sets an offer as the sessions remote description, and creates an answer which is
+	// set as the sessions local description.
+	Answer(offer []byte) ([]byte, error)
+
+	// Accept sets an answer as the sessions remote description.
+	Accept(answer []byte) error
+
+	// AddCandidate adds an ICE candidate gathered by the remote session. It is only called after
+	// the sessions remote description has been set.
+	AddCandidate(candidate []byte) error
+
+	// OnCandidate registers a callback which is called for every local ICE candidate gathered by
+	// the session. It is called before Offer or Answer are called.
+	OnCandidate(fn func(candidate []byte))
+
+	// Conn blocks until the sessions data channel opens, or until a timeout elapses.
+	Conn(timeout time.Duration) (net.Conn, error)
+
+	Close() error
+}
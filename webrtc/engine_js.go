@@ -0,0 +1,246 @@
+//go:build js && wasm
+// +build js,wasm
+
+package webrtc
+
+import (
+	"github.com/perlin-network/noise/internal/jsconn"
+	"github.com/pkg/errors"
+	"net"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+var _ Engine = (*browserEngine)(nil)
+
+type browserEngine struct {
+	iceServers []string
+}
+
+// NewBrowserEngine returns an engine which negotiates peer connections through the browsers
+// RTCPeerConnection API. Should no ICE servers be specified, only host candidates and candidates
+// reflected by the browser are gathered.
+func NewBrowserEngine(iceServers ...string) Engine {
+	return &browserEngine{iceServers: iceServers}
+}
+
+func (e *browserEngine) NewSession() (Session, error) {
+	urls := make([]interface{}, 0, len(e.iceServers))
+	for _, server := range e.iceServers {
+		urls = append(urls, server)
+	}
+
+	config := map[string]interface{}{}
+
+	if len(urls) > 0 {
+		config["iceServers"] = []interface{}{map[string]interface{}{"urls": urls}}
+	}
+
+	constructor := js.Global().Get("RTCPeerConnection")
+	if constructor.IsUndefined() {
+		return nil, errors.New("webrtc: browser does not support RTCPeerConnection")
+	}
+
+	s := &browserSession{
+		pc:     constructor.New(config),
+		opened: make(chan struct{}),
+	}
+
+	s.onDataChannel = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		s.setChannel(args[0].Get("channel"))
+		return nil
+	})
+
+	s.pc.Set("ondatachannel", s.onDataChannel)
+
+	return s, nil
+}
+
+type browserSession struct {
+	pc js.Value
+
+	mu      sync.Mutex
+	channel js.Value
+	conn    *jsconn.Conn
+
+	onDataChannel, onCandidate, onOpen js.Func
+	hasCandidate, hasOpen              bool
+
+	opened chan struct{}
+	once   sync.Once
+}
+
+func (s *browserSession) setChannel(channel js.Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.channel.IsUndefined() {
+		return
+	}
+
+	s.channel = channel
+	s.conn = jsconn.New(channel, &net.TCPAddr{}, &net.TCPAddr{})
+
+	s.onOpen = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		s.once.Do(func() { close(s.opened) })
+		return nil
+	})
+
+	s.hasOpen = true
+
+	channel.Set("onopen", s.onOpen)
+
+	if channel.Get("readyState").String() == "open" {
+		s.once.Do(func() { close(s.opened) })
+	}
+}
+
+func (s *browserSession) Offer() ([]byte, error) {
+	s.setChannel(s.pc.Call("createDataChannel", "noise", map[string]interface{}{"ordered": true}))
+
+	offer, err := await(s.pc.Call("createOffer"))
+	if err != nil {
+		return nil, errors.Wrap(err, "webrtc: failed to create offer")
+	}
+
+	if _, err := await(s.pc.Call("setLocalDescription", offer)); err != nil {
+		return nil, errors.Wrap(err, "webrtc: failed to set local description")
+	}
+
+	return stringify(s.pc.Get("localDescription")), nil
+}
+
+func (s *browserSession) Answer(offer []byte) ([]byte, error) {
+	if _, err := await(s.pc.Call("setRemoteDescription", parse(offer))); err != nil {
+		return nil, errors.Wrap(err, "webrtc: failed to set remote description")
+	}
+
+	answer, err := await(s.pc.Call("createAnswer"))
+	if err != nil {
+		return nil, errors.Wrap(err, "webrtc: failed to create answer")
+	}
+
+	if _, err := await(s.pc.Call("setLocalDescription", answer)); err != nil {
+		return nil, errors.Wrap(err, "webrtc: failed to set local description")
+	}
+
+	return stringify(s.pc.Get("localDescription")), nil
+}
+
+func (s *browserSession) Accept(answer []byte) error {
+	if _, err := await(s.pc.Call("setRemoteDescription", parse(answer))); err != nil {
+		return errors.Wrap(err, "webrtc: failed to set remote description")
+	}
+
+	return nil
+}
+
+func (s *browserSession) AddCandidate(candidate []byte) error {
+	if _, err := await(s.pc.Call("addIceCandidate", parse(candidate))); err != nil {
+		return errors.Wrap(err, "webrtc: failed to add ice candidate")
+	}
+
+	return nil
+}
+
+func (s *browserSession) OnCandidate(fn func(candidate []byte)) {
+	s.onCandidate = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		candidate := args[0].Get("candidate")
+
+		if !candidate.IsNull() && !candidate.IsUndefined() {
+			// Callbacks from the browser must never block.
+			go fn(stringify(candidate))
+		}
+
+		return nil
+	})
+
+	s.hasCandidate = true
+
+	s.pc.Set("onicecandidate", s.onCandidate)
+}
+
+func (s *browserSession) Conn(timeout time.Duration) (net.Conn, error) {
+	select {
+	case <-s.opened:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		return s.conn, nil
+	case <-time.After(timeout):
+		return nil, errors.New("webrtc: timed out waiting for data channel to open")
+	}
+}
+
+func (s *browserSession) Close() error {
+	s.pc.Call("close")
+
+	s.pc.Set("ondatachannel", js.Null())
+	s.pc.Set("onicecandidate", js.Null())
+
+	s.onDataChannel.Release()
+
+	if s.hasCandidate {
+		s.onCandidate.Release()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hasOpen {
+		s.channel.Set("onopen", js.Null())
+		s.onOpen.Release()
+	}
+
+	if s.conn != nil {
+		s.conn.Close()
+	}
+
+	return nil
+}
+
+// await blocks until a promise settles, and returns the value it resolves to.
+func await(promise js.Value) (js.Value, error) {
+	results := make(chan js.Value, 1)
+	failures := make(chan js.Value, 1)
+
+	onResolve := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var result js.Value
+		if len(args) > 0 {
+			result = args[0]
+		}
+
+		results <- result
+		return nil
+	})
+	defer onResolve.Release()
+
+	onReject := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var reason js.Value
+		if len(args) > 0 {
+			reason = args[0]
+		}
+
+		failures <- reason
+		return nil
+	})
+	defer onReject.Release()
+
+	promise.Call("then", onResolve, onReject)
+
+	select {
+	case result := <-results:
+		return result, nil
+	case reason := <-failures:
+		return js.Value{}, errors.New(js.Global().Get("String").Invoke(reason).String())
+	}
+}
+
+func stringify(value js.Value) []byte {
+	return []byte(js.Global().Get("JSON").Call("stringify", value).String())
+}
+
+func parse(buf []byte) js.Value {
+	return js.Global().Get("JSON").Call("parse", string(buf))
+}
@@ -0,0 +1,468 @@
+package webrtc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/pkg/errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	keyState   = "webrtc.state"
+	keyAddress = "webrtc.address"
+)
+
+var (
+	_ protocol.Block = (*block)(nil)
+
+	ErrRelayRejected    = errors.New("webrtc: relay rejected signal")
+	ErrAddressAnnounced = errors.New("webrtc: address is already announced by another peer")
+)
+
+type block struct {
+	opcodeAnnounce noise.Opcode
+	opcodeSignal   noise.Opcode
+
+	engine Engine
+
+	timeoutDuration    time.Duration
+	negotiationTimeout time.Duration
+}
+
+// New returns a block which negotiates WebRTC data channels between peers, with session
+// descriptions and ICE candidates exchanged through an already-connected relay peer. Two nodes
+// behind NATs, or two browsers, may then connect to one another directly without
+// dedicated signaling infrastructure. Noise only provides an engine for browsers; native nodes must
+// provide their own implementation of Engine.
+//
+// Every peer which completes the block announces its address to us, and we relay any signals
+// addressed to it on behalf of other peers. Peers announcing an address already announced by
+// another connected peer are disconnected, and signals we relay are marked as sent from the
+// address their sender announced. To connect to a peer through a relay, call Connect.
+//
+// By default, peers that do not announce their address within 10 seconds are disconnected, and
+// negotiating a data channel times out after 30 seconds.
+func New(engine Engine) *block {
+	return &block{engine: engine, timeoutDuration: 10 * time.Second, negotiationTimeout: 30 * time.Second}
+}
+
+func (b *block) TimeoutAfter(timeoutDuration time.Duration) *block {
+	b.timeoutDuration = timeoutDuration
+	return b
+}
+
+// WithNegotiationTimeout sets how long negotiating a data channel with a peer may take.
+func (b *block) WithNegotiationTimeout(timeout time.Duration) *block {
+	b.negotiationTimeout = timeout
+	return b
+}
+
+func (b *block) OnRegister(p *protocol.Protocol, node *noise.Node) {
+	b.opcodeAnnounce = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Announce)(nil))
+	b.opcodeSignal = noise.RegisterMessage(noise.NextAvailableOpcode(), (*Signal)(nil))
+
+	s := &state{block: b, node: node, peers: make(map[string]*noise.Peer)}
+	node.Set(keyState, s)
+
+	node.OnMessageReceived(b.opcodeSignal, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		s.handleSignal(peer, message.(Signal))
+		return nil
+	})
+}
+
+func (b *block) OnBegin(p *protocol.Protocol, peer *noise.Peer) error {
+	s := peer.Node().Get(keyState).(*state)
+
+	if err := peer.SendMessage(Announce{Address: peer.Node().ExternalAddress()}); err != nil {
+		return errors.Wrap(protocol.DisconnectWith(err), "webrtc: failed to announce address")
+	}
+
+	select {
+	case <-peer.Node().Clock().After(b.timeoutDuration):
+		return errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeTimeout), "webrtc: timed out waiting for peer to announce its address")
+	case msg := <-peer.Receive(b.opcodeAnnounce):
+		address := msg.(Announce).Address
+
+		if address == "" {
+			return errors.Wrap(protocol.DisconnectWith(noise.ErrHandshakeFailed), "webrtc: peer announced an empty address")
+		}
+
+		if !s.announce(address, peer) {
+			return errors.Wrapf(protocol.DisconnectWith(ErrAddressAnnounced), "webrtc: peer announced %s", address)
+		}
+
+		peer.Set(keyAddress, address)
+
+		peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+			s.release(address, peer)
+			return nil
+		})
+	}
+
+	return nil
+}
+
+func (b *block) OnEnd(p *protocol.Protocol, peer *noise.Peer) error {
+	return nil
+}
+
+// Connect negotiates a WebRTC data channel to the peer at a specified address, with signals
+// routed through a relay peer both our node and the target peer are connected to. The peer
+// connected to through the data channel is returned as though it were dialed by our node.
+func Connect(node *noise.Node, relay *noise.Peer, address string) (*noise.Peer, error) {
+	s, ok := node.Get(keyState).(*state)
+	if !ok {
+		return nil, errors.New("webrtc: block is not registered to the nodes protocol")
+	}
+
+	return s.connect(relay, address)
+}
+
+type state struct {
+	block *block
+	node  *noise.Node
+
+	// peers maps announced addresses to peers we may relay signals to.
+	peersLock sync.Mutex
+	peers     map[string]*noise.Peer
+
+	// sessions maps a remote address and session ID to data channels being negotiated.
+	sessions sync.Map
+}
+
+type session struct {
+	sync.Mutex
+
+	Session
+
+	remoteSet bool
+	pending   [][]byte
+
+	described bool
+	outgoing  [][]byte
+	send      func(candidate []byte)
+
+	answers chan []byte
+	rejects chan string
+}
+
+func newSession() *session {
+	return &session{answers: make(chan []byte, 1), rejects: make(chan string, 1)}
+}
+
+// addCandidate adds a remote ICE candidate to a session, or queues it up should the sessions
+// remote description not yet be set.
+func (s *session) addCandidate(candidate []byte) {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.remoteSet {
+		s.pending = append(s.pending, candidate)
+		return
+	}
+
+	if err := s.AddCandidate(candidate); err != nil {
+		log.Warn().Err(err).Msg("Failed to add a remote ICE candidate.")
+	}
+}
+
+// setRemote marks the remote description of a session as set, and adds all queued up remote
+// ICE candidates to the session.
+func (s *session) setRemote() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.remoteSet = true
+
+	for _, candidate := range s.pending {
+		if err := s.AddCandidate(candidate); err != nil {
+			log.Warn().Err(err).Msg("Failed to add a remote ICE candidate.")
+		}
+	}
+
+	s.pending = nil
+}
+
+// gathered sends a local ICE candidate to the remote session, or queues it up should our local
+// description not yet be sent, as the remote session would otherwise not yet exist.
+func (s *session) gathered(candidate []byte) {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.described {
+		s.outgoing = append(s.outgoing, candidate)
+		return
+	}
+
+	s.send(candidate)
+}
+
+// setDescribed marks our local description as sent, and sends all queued up local ICE
+// candidates to the remote session.
+func (s *session) setDescribed() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.described = true
+
+	for _, candidate := range s.outgoing {
+		s.send(candidate)
+	}
+
+	s.outgoing = nil
+}
+
+func sessionKey(address string, id uint64) string {
+	return address + "/" + strconv.FormatUint(id, 10)
+}
+
+// announce maps an address to the peer that announced it, unless the address is already announced
+// by another peer.
+func (s *state) announce(address string, peer *noise.Peer) bool {
+	s.peersLock.Lock()
+	defer s.peersLock.Unlock()
+
+	if existing, exists := s.peers[address]; exists && existing != peer {
+		return false
+	}
+
+	s.peers[address] = peer
+
+	return true
+}
+
+// release unmaps an address, should it still be mapped to the peer that announced it.
+func (s *state) release(address string, peer *noise.Peer) {
+	s.peersLock.Lock()
+	defer s.peersLock.Unlock()
+
+	if s.peers[address] == peer {
+		delete(s.peers, address)
+	}
+}
+
+func (s *state) lookup(address string) (*noise.Peer, bool) {
+	s.peersLock.Lock()
+	defer s.peersLock.Unlock()
+
+	peer, exists := s.peers[address]
+	return peer, exists
+}
+
+func (s *state) connect(relay *noise.Peer, address string) (*noise.Peer, error) {
+	var buf [8]byte
+
+	if _, err := rand.Read(buf[:]); err != nil {
+		return nil, errors.Wrap(err, "webrtc: failed to generate session id")
+	}
+
+	id := binary.LittleEndian.Uint64(buf[:])
+	self := s.node.ExternalAddress()
+
+	sess := newSession()
+
+	key := sessionKey(address, id)
+	s.sessions.Store(key, sess)
+	defer s.sessions.Delete(key)
+
+	engineSession, err := s.block.engine.NewSession()
+	if err != nil {
+		return nil, errors.Wrap(err, "webrtc: failed to create session")
+	}
+
+	sess.Session = engineSession
+	sess.send = func(candidate []byte) {
+		relay.SendMessageAsync(Signal{Kind: SignalCandidate, Session: id, From: self, To: address, Payload: candidate})
+	}
+
+	engineSession.OnCandidate(sess.gathered)
+
+	offer, err := engineSession.Offer()
+	if err != nil {
+		engineSession.Close()
+		return nil, errors.Wrap(err, "webrtc: failed to create offer")
+	}
+
+	if err := relay.SendMessage(Signal{Kind: SignalOffer, Session: id, From: self, To: address, Payload: offer}); err != nil {
+		engineSession.Close()
+		return nil, errors.Wrap(err, "webrtc: failed to send offer to relay")
+	}
+
+	sess.setDescribed()
+
+	timeout := s.block.negotiationTimeout
+	deadline := time.Now().Add(timeout)
+
+	select {
+	case answer := <-sess.answers:
+		if err := engineSession.Accept(answer); err != nil {
+			engineSession.Close()
+			return nil, errors.Wrap(err, "webrtc: failed to accept answer")
+		}
+
+		sess.setRemote()
+	case reason := <-sess.rejects:
+		engineSession.Close()
+		return nil, errors.Wrap(ErrRelayRejected, reason)
+	case <-time.After(timeout):
+		engineSession.Close()
+		return nil, errors.Wrapf(noise.ErrHandshakeTimeout, "webrtc: timed out waiting for %s to answer", address)
+	}
+
+	conn, err := engineSession.Conn(time.Until(deadline))
+	if err != nil {
+		engineSession.Close()
+		return nil, errors.Wrapf(err, "webrtc: failed to open data channel to %s", address)
+	}
+
+	return s.node.DialConn(withAddresses(conn, self, address)), nil
+}
+
+func (s *state) answer(relay *noise.Peer, sess *session, offer Signal) {
+	key := sessionKey(offer.From, offer.Session)
+	defer s.sessions.Delete(key)
+
+	self := s.node.ExternalAddress()
+
+	reject := func(err error) {
+		log.Warn().Err(err).Str("peer", offer.From).Msg("Failed to answer a WebRTC offer.")
+		relay.SendMessageAsync(Signal{Kind: SignalReject, Session: offer.Session, From: self, To: offer.From, Payload: []byte(err.Error())})
+	}
+
+	engineSession, err := s.block.engine.NewSession()
+	if err != nil {
+		reject(errors.Wrap(err, "failed to create session"))
+		return
+	}
+
+	sess.Lock()
+	sess.Session = engineSession
+	sess.send = func(candidate []byte) {
+		relay.SendMessageAsync(Signal{Kind: SignalCandidate, Session: offer.Session, From: self, To: offer.From, Payload: candidate})
+	}
+	sess.Unlock()
+
+	engineSession.OnCandidate(sess.gathered)
+
+	answer, err := engineSession.Answer(offer.Payload)
+	if err != nil {
+		engineSession.Close()
+		reject(errors.Wrap(err, "failed to create answer"))
+		return
+	}
+
+	sess.setRemote()
+
+	if err := relay.SendMessage(Signal{Kind: SignalAnswer, Session: offer.Session, From: self, To: offer.From, Payload: answer}); err != nil {
+		engineSession.Close()
+		return
+	}
+
+	sess.setDescribed()
+
+	conn, err := engineSession.Conn(s.block.negotiationTimeout)
+	if err != nil {
+		engineSession.Close()
+		log.Warn().Err(err).Str("peer", offer.From).Msg("Failed to open a WebRTC data channel.")
+		return
+	}
+
+	s.node.AcceptConn(withAddresses(conn, self, offer.From))
+}
+
+func (s *state) handleSignal(peer *noise.Peer, sig Signal) {
+	self := s.node.ExternalAddress()
+
+	// Relay signals which are not addressed to us, marked as sent from the address the sender
+	// announced such that peers may not impersonate one another.
+	if sig.To != self {
+		from, ok := peer.Get(keyAddress).(string)
+		if !ok {
+			return
+		}
+
+		sig.From = from
+
+		if dst, ok := s.lookup(sig.To); ok {
+			dst.SendMessageAsync(sig)
+			return
+		}
+
+		if sig.Kind != SignalReject {
+			peer.SendMessageAsync(Signal{Kind: SignalReject, Session: sig.Session, From: sig.To, To: sig.From, Payload: []byte("peer " + sig.To + " is not connected to relay")})
+		}
+
+		return
+	}
+
+	key := sessionKey(sig.From, sig.Session)
+
+	switch sig.Kind {
+	case SignalOffer:
+		sess := newSession()
+
+		if _, exists := s.sessions.LoadOrStore(key, sess); exists {
+			return
+		}
+
+		s.node.Go(func(ctx context.Context) error {
+			s.answer(peer, sess, sig)
+			return nil
+		})
+	case SignalAnswer:
+		if sess, ok := s.sessions.Load(key); ok {
+			select {
+			case sess.(*session).answers <- sig.Payload:
+			default:
+			}
+		}
+	case SignalCandidate:
+		if sess, ok := s.sessions.Load(key); ok {
+			sess.(*session).addCandidate(sig.Payload)
+		}
+	case SignalReject:
+		if sess, ok := s.sessions.Load(key); ok {
+			select {
+			case sess.(*session).rejects <- string(sig.Payload):
+			default:
+			}
+		}
+	}
+}
+
+// addrConn reports the announced addresses of both ends of a data channel, rather than the
+// addresses reported by the WebRTC engine.
+type addrConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func withAddresses(conn net.Conn, local, remote string) net.Conn {
+	return &addrConn{Conn: conn, local: tcpAddr(local), remote: tcpAddr(remote)}
+}
+
+func (c *addrConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func tcpAddr(address string) *net.TCPAddr {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+
+	port, _ := strconv.Atoi(portStr)
+
+	return &net.TCPAddr{IP: net.ParseIP(host), Port: port}
+}
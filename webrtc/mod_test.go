@@ -0,0 +1,308 @@
+package webrtc
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pipeEngine negotiates in-memory data channels, where offers and answers carry the ID of a
+// pipe registered to the engine.
+type pipeEngine struct {
+	sync.Mutex
+
+	next  uint64
+	pipes map[string]chan net.Conn
+
+	candidates uint32
+}
+
+func newPipeEngine() *pipeEngine {
+	return &pipeEngine{pipes: make(map[string]chan net.Conn)}
+}
+
+func (e *pipeEngine) NewSession() (Session, error) {
+	return &pipeSession{engine: e, added: make(chan struct{})}, nil
+}
+
+type pipeSession struct {
+	engine *pipeEngine
+
+	id          string
+	onCandidate func([]byte)
+	conn        net.Conn
+
+	// added is closed once a remote candidate is added, as a data channel may only be opened
+	// once connectivity to the remote session has been established.
+	once  sync.Once
+	added chan struct{}
+}
+
+func (s *pipeSession) Offer() ([]byte, error) {
+	s.engine.Lock()
+	s.engine.next++
+	s.id = strconv.FormatUint(s.engine.next, 10)
+	s.engine.pipes[s.id] = make(chan net.Conn, 1)
+	s.engine.Unlock()
+
+	s.onCandidate([]byte("offer candidate"))
+
+	return []byte(s.id), nil
+}
+
+func (s *pipeSession) Answer(offer []byte) ([]byte, error) {
+	s.engine.Lock()
+	pipe, exists := s.engine.pipes[string(offer)]
+	s.engine.Unlock()
+
+	if !exists {
+		return nil, errors.New("unknown offer")
+	}
+
+	a, b := net.Pipe()
+	pipe <- a
+	s.conn = b
+
+	s.onCandidate([]byte("answer candidate"))
+
+	return offer, nil
+}
+
+func (s *pipeSession) Accept(answer []byte) error {
+	if string(answer) != s.id {
+		return errors.New("answer does not match offer")
+	}
+
+	return nil
+}
+
+func (s *pipeSession) AddCandidate(candidate []byte) error {
+	atomic.AddUint32(&s.engine.candidates, 1)
+	s.once.Do(func() { close(s.added) })
+
+	return nil
+}
+
+func (s *pipeSession) OnCandidate(fn func(candidate []byte)) {
+	s.onCandidate = fn
+}
+
+func (s *pipeSession) Conn(timeout time.Duration) (net.Conn, error) {
+	select {
+	case <-s.added:
+	case <-time.After(timeout):
+		return nil, errors.New("timed out")
+	}
+
+	if s.conn != nil {
+		return s.conn, nil
+	}
+
+	s.engine.Lock()
+	pipe := s.engine.pipes[s.id]
+	s.engine.Unlock()
+
+	select {
+	case conn := <-pipe:
+		return conn, nil
+	case <-time.After(timeout):
+		return nil, errors.New("timed out")
+	}
+}
+
+func (s *pipeSession) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+
+	return nil
+}
+
+type testMessage struct {
+	text string
+}
+
+func (testMessage) Read(reader payload.Reader) (noise.Message, error) {
+	text, err := reader.ReadString()
+	if err != nil {
+		return nil, err
+	}
+
+	return testMessage{text: text}, nil
+}
+
+func (m testMessage) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.text).Bytes()
+}
+
+func newNode(t *testing.T, layer transport.Layer, engine Engine) *noise.Node {
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	protocol.New().Register(New(engine).WithNegotiationTimeout(3 * time.Second)).Enforce(node)
+
+	go node.Listen()
+
+	return node
+}
+
+func TestConnectThroughRelay(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+	engine := newPipeEngine()
+
+	opcodeTest := noise.RegisterMessage(noise.NextAvailableOpcode(), (*testMessage)(nil))
+
+	node := func() *noise.Node { return newNode(t, layer, engine) }
+
+	alice, relay, bob := node(), node(), node()
+
+	defer alice.Kill()
+	defer relay.Kill()
+	defer bob.Kill()
+
+	received := make(chan string, 1)
+
+	bob.OnPeerConnected(func(node *noise.Node, peer *noise.Peer) error {
+		go func() {
+			received <- (<-peer.Receive(opcodeTest)).(testMessage).text
+		}()
+
+		return nil
+	})
+
+	aliceRelay, err := alice.Dial(relay.ExternalAddress())
+	assert.NoError(t, err)
+
+	bobRelay, err := bob.Dial(relay.ExternalAddress())
+	assert.NoError(t, err)
+
+	protocol.WaitUntilEstablished(aliceRelay)
+	protocol.WaitUntilEstablished(bobRelay)
+
+	// The relay must know of Bob before it may relay signals to him.
+	time.Sleep(50 * time.Millisecond)
+
+	peer, err := Connect(alice, aliceRelay, bob.ExternalAddress())
+	assert.NoError(t, err)
+
+	assert.Equal(t, bob.ExternalAddress(), peer.RemoteIP().String()+":"+strconv.Itoa(int(peer.RemotePort())))
+
+	protocol.WaitUntilEstablished(peer)
+	assert.NoError(t, peer.SendMessage(testMessage{text: "hello over webrtc"}))
+
+	select {
+	case text := <-received:
+		assert.Equal(t, "hello over webrtc", text)
+	case <-time.After(3 * time.Second):
+		t.Fatal("bob never received a message over the data channel")
+	}
+
+	// Both the offering and answering sessions must have received each others candidates.
+	assert.EqualValues(t, 2, atomic.LoadUint32(&engine.candidates))
+
+	// Relaying to a peer not connected to the relay is rejected.
+	_, err = Connect(alice, aliceRelay, "127.0.0.1:1")
+	assert.True(t, errors.Cause(err) == ErrRelayRejected)
+}
+
+func TestRelayRejectsImpersonation(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+	engine := newPipeEngine()
+
+	relay, bob, mallory := newNode(t, layer, engine), newNode(t, layer, engine), newNode(t, layer, engine)
+
+	defer relay.Kill()
+	defer bob.Kill()
+	defer mallory.Kill()
+
+	opcodeSignal, err := noise.OpcodeFromMessage((*Signal)(nil))
+	assert.NoError(t, err)
+
+	signals := make(chan Signal, 1)
+
+	bob.OnMessageReceived(opcodeSignal, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		signals <- message.(Signal)
+		return nil
+	})
+
+	bobRelay, err := bob.Dial(relay.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(bobRelay))
+
+	malloryRelay, err := mallory.Dial(relay.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(malloryRelay))
+
+	// The relay must know of Bob and Mallory before it may relay signals to them.
+	time.Sleep(50 * time.Millisecond)
+
+	// Signals relayed to Bob are marked as sent from the address Mallory announced, rather
+	// than the address Mallory claims to be.
+	assert.NoError(t, malloryRelay.SendMessage(Signal{Kind: SignalCandidate, Session: 1, From: "127.0.0.1:1", To: bob.ExternalAddress()}))
+
+	select {
+	case sig := <-signals:
+		assert.Equal(t, mallory.ExternalAddress(), sig.From)
+	case <-time.After(3 * time.Second):
+		t.Fatal("relay did not relay mallory's signal to bob")
+	}
+
+	// Announcing an address already announced by another peer has the relay disconnect us.
+	disconnected := make(chan struct{})
+
+	eve := newNode(t, layer, engine)
+	defer eve.Kill()
+
+	eve.SetExternalAddress(bob.ExternalAddress())
+
+	eve.OnPeerDisconnected(func(node *noise.Node, peer *noise.Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	_, err = eve.Dial(relay.ExternalAddress())
+	assert.NoError(t, err)
+
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("relay did not disconnect a peer announcing an address already announced")
+	}
+
+	// Bob's announcement remains intact.
+	dst, ok := relay.Get(keyState).(*state).lookup(bob.ExternalAddress())
+	assert.True(t, ok)
+	assert.Equal(t, bob.ExternalAddress(), dst.Get(keyAddress))
+
+	// Bob's address is released once Bob disconnects from the relay.
+	bobRelay.Disconnect()
+
+	for i := 0; i < 300; i++ {
+		if _, ok = relay.Get(keyState).(*state).lookup(bob.ExternalAddress()); !ok {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.False(t, ok)
+}
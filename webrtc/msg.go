@@ -0,0 +1,89 @@
+package webrtc
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ noise.Message = (*Announce)(nil)
+	_ noise.Message = (*Signal)(nil)
+)
+
+// Announce advertises the address a peer is known by, such that a relay may route signals to it.
+type Announce struct {
+	Address string
+}
+
+func (Announce) Read(reader payload.Reader) (noise.Message, error) {
+	address, err := reader.ReadString()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read announced address")
+	}
+
+	return Announce{Address: address}, nil
+}
+
+func (m Announce) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.Address).Bytes()
+}
+
+const (
+	SignalOffer byte = iota
+	SignalAnswer
+	SignalCandidate
+	SignalReject
+)
+
+// Signal carries a session description or ICE candidate between two peers, routed through a
+// relay peer both are connected to.
+type Signal struct {
+	Kind    byte
+	Session uint64
+
+	From, To string
+
+	Payload []byte
+}
+
+func (Signal) Read(reader payload.Reader) (noise.Message, error) {
+	var msg Signal
+	var err error
+
+	if msg.Kind, err = reader.ReadByte(); err != nil {
+		return nil, errors.Wrap(err, "failed to read signal kind")
+	}
+
+	if msg.Kind > SignalReject {
+		return nil, errors.Errorf("unknown signal kind %d", msg.Kind)
+	}
+
+	if msg.Session, err = reader.ReadUint64(); err != nil {
+		return nil, errors.Wrap(err, "failed to read signal session")
+	}
+
+	if msg.From, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read signal sender")
+	}
+
+	if msg.To, err = reader.ReadString(); err != nil {
+		return nil, errors.Wrap(err, "failed to read signal recipient")
+	}
+
+	if msg.Payload, err = reader.ReadBytes(); err != nil {
+		return nil, errors.Wrap(err, "failed to read signal payload")
+	}
+
+	return msg, nil
+}
+
+func (m Signal) Write() []byte {
+	return payload.NewWriter(nil).
+		WriteByte(m.Kind).
+		WriteUint64(m.Session).
+		WriteString(m.From).
+		WriteString(m.To).
+		WriteBytes(m.Payload).
+		Bytes()
+}
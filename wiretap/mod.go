@@ -0,0 +1,328 @@
+// Package wiretap records the frames a node exchanges with its peers, and replays recorded
+// sessions back into a node, such that bugs within protocols may be reproduced deterministically.
+//
+// Frames are tapped beneath every protocol block, such that frames are recorded as they were
+// before being encrypted, and after being decrypted, by blocks such as AEAD.
+package wiretap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/payload"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const magic = "noise-wiretap/1\n"
+
+// maxRecordSize caps how large a single record within a recording may be.
+const maxRecordSize = 64 * 1024 * 1024
+
+var ErrMalformed = errors.New("wiretap: recording is malformed")
+
+// Direction is whether a frame was received from, or sent to, a peer.
+type Direction byte
+
+const (
+	Inbound Direction = iota
+	Outbound
+)
+
+func (d Direction) String() string {
+	if d == Outbound {
+		return "outbound"
+	}
+
+	return "inbound"
+}
+
+// Frame is a single message exchanged with a peer, including any headers and footers, yet without
+// its length prefix.
+type Frame struct {
+	Time      time.Time
+	Peer      string
+	Direction Direction
+	Data      []byte
+}
+
+// Opcode returns the opcode of the message within a frame, assuming the frame carries no headers.
+func (f Frame) Opcode() noise.Opcode {
+	if len(f.Data) == 0 {
+		return noise.OpcodeNil
+	}
+
+	return noise.Opcode(f.Data[0])
+}
+
+// Recorder writes the frames a node exchanges with its peers to a writer.
+type Recorder struct {
+	sync.Mutex
+
+	writer  io.Writer
+	err     error
+	stopped bool
+}
+
+// Record starts recording the frames our node exchanges with every peer it connects to from then
+// on. For frames to be recorded before being encrypted, Record must be called before any protocol
+// is enforced on our node.
+//
+// Recording stops at the first error writing to the writer, which is reported through Err.
+// Failing to record a frame never affects the peer it was exchanged with.
+func Record(node *noise.Node, w io.Writer) *Recorder {
+	r := &Recorder{writer: w}
+
+	if _, err := io.WriteString(w, magic); err != nil {
+		r.err = errors.Wrap(err, "wiretap: failed to write recording header")
+	}
+
+	node.OnPeerInit(func(node *noise.Node, peer *noise.Peer) error {
+		address := net.JoinHostPort(peer.RemoteIP().String(), strconv.FormatUint(uint64(peer.RemotePort()), 10))
+
+		// Callbacks registered before those of protocol blocks see messages before they are
+		// encrypted, and after they are decrypted.
+		peer.BeforeMessageSent(func(node *noise.Node, peer *noise.Peer, msg []byte) ([]byte, error) {
+			r.write(Frame{Time: time.Now(), Peer: address, Direction: Outbound, Data: msg})
+			return msg, nil
+		})
+
+		peer.BeforeMessageReceived(func(node *noise.Node, peer *noise.Peer, msg []byte) ([]byte, error) {
+			r.write(Frame{Time: time.Now(), Peer: address, Direction: Inbound, Data: msg})
+			return msg, nil
+		})
+
+		return nil
+	})
+
+	return r
+}
+
+// Stop stops recording frames.
+func (r *Recorder) Stop() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.stopped = true
+}
+
+// Err returns the error which stopped recording, if any.
+func (r *Recorder) Err() error {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.err
+}
+
+func (r *Recorder) write(frame Frame) {
+	record := payload.NewWriter(nil).
+		WriteUint64(uint64(frame.Time.UnixNano())).
+		WriteString(frame.Peer).
+		WriteByte(byte(frame.Direction)).
+		WriteBytes(frame.Data).
+		Bytes()
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.stopped || r.err != nil {
+		return
+	}
+
+	if _, err := r.writer.Write(payload.NewWriter(nil).WriteBytes(record).Bytes()); err != nil {
+		r.err = errors.Wrap(err, "wiretap: failed to write frame")
+	}
+}
+
+// Load reads every frame within a recording, in the order they were recorded.
+func Load(r io.Reader) ([]Frame, error) {
+	reader := bufio.NewReader(r)
+
+	header := make([]byte, len(magic))
+
+	if _, err := io.ReadFull(reader, header); err != nil || string(header) != magic {
+		return nil, errors.Wrap(ErrMalformed, "missing recording header")
+	}
+
+	var frames []Frame
+
+	for {
+		var size uint32
+
+		if err := binary.Read(reader, binary.LittleEndian, &size); err != nil {
+			if err == io.EOF {
+				return frames, nil
+			}
+
+			return frames, errors.Wrap(ErrMalformed, "truncated record length")
+		}
+
+		if size > maxRecordSize {
+			return frames, errors.Wrapf(ErrMalformed, "record is %d bytes long", size)
+		}
+
+		buf := make([]byte, size)
+
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return frames, errors.Wrap(ErrMalformed, "truncated record")
+		}
+
+		frame, err := readFrame(payload.NewReader(buf))
+		if err != nil {
+			return frames, errors.Wrap(ErrMalformed, err.Error())
+		}
+
+		frames = append(frames, frame)
+	}
+}
+
+func readFrame(reader payload.Reader) (Frame, error) {
+	var frame Frame
+
+	timestamp, err := reader.ReadUint64()
+	if err != nil {
+		return frame, errors.Wrap(err, "failed to read frame timestamp")
+	}
+
+	frame.Time = time.Unix(0, int64(timestamp))
+
+	if frame.Peer, err = reader.ReadString(); err != nil {
+		return frame, errors.Wrap(err, "failed to read frame peer")
+	}
+
+	direction, err := reader.ReadByte()
+	if err != nil {
+		return frame, errors.Wrap(err, "failed to read frame direction")
+	}
+
+	frame.Direction = Direction(direction)
+
+	if frame.Data, err = reader.ReadBytes(); err != nil {
+		return frame, errors.Wrap(err, "failed to read frame data")
+	}
+
+	return frame, nil
+}
+
+// Replay feeds the inbound frames of a recorded session into our node, as though they were sent by
+// a single peer over a fresh connection, and returns the frames our node sent back. Frames are fed
+// one at a time, with the next frame only being fed once our node has handled the last, such that
+// replaying the same frames into the same handlers handles them in the same order every time. Our
+// node is given at most timeout to handle every frame.
+//
+// Frames are fed beneath every protocol block enforced on our node. Should frames have been
+// recorded beneath a block which encrypts messages, replay them into a node which does not enforce
+// the block. Outbound frames passed to Replay are ignored.
+func Replay(node *noise.Node, frames []Frame, timeout time.Duration) ([]Frame, error) {
+	local, remote := net.Pipe()
+
+	peer := node.AcceptConn(&replayConn{Conn: local})
+
+	handled := make(chan struct{}, 1)
+	disconnected := make(chan struct{})
+
+	// Callbacks registered after those of protocol blocks see messages before they are decrypted.
+	// As frames are fed in the clear, frames are instead counted once they are fully handled.
+	peer.AfterMessageReceived(func(node *noise.Node, peer *noise.Peer) error {
+		handled <- struct{}{}
+		return nil
+	})
+
+	peer.OnDisconnect(func(node *noise.Node, peer *noise.Peer) error {
+		close(disconnected)
+		return nil
+	})
+
+	var outbound []Frame
+	var wait sync.WaitGroup
+
+	wait.Add(1)
+
+	node.Go(func(ctx context.Context) error {
+		defer wait.Done()
+
+		reader := bufio.NewReader(remote)
+
+		for {
+			size, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return nil
+			}
+
+			// Heartbeats are not frames.
+			if size == 0 {
+				continue
+			}
+
+			buf := make([]byte, size)
+
+			if _, err := io.ReadFull(reader, buf); err != nil {
+				return nil
+			}
+
+			outbound = append(outbound, Frame{Time: time.Now(), Peer: peerAddress, Direction: Outbound, Data: buf})
+		}
+	})
+
+	err := feed(remote, frames, handled, disconnected, timeout)
+
+	peer.Disconnect()
+	remote.Close()
+
+	wait.Wait()
+
+	return outbound, err
+}
+
+func feed(conn net.Conn, frames []Frame, handled, disconnected chan struct{}, timeout time.Duration) error {
+	var fed int
+
+	for _, frame := range frames {
+		if frame.Direction != Inbound {
+			continue
+		}
+
+		buf := make([]byte, binary.MaxVarintLen64)
+		buf = append(buf[:binary.PutUvarint(buf, uint64(len(frame.Data)))], frame.Data...)
+
+		if _, err := io.Copy(conn, bytes.NewReader(buf)); err != nil {
+			return errors.Wrapf(err, "wiretap: failed to feed frame %d", fed)
+		}
+
+		select {
+		case <-handled:
+		case <-disconnected:
+			return errors.Errorf("wiretap: our node disconnected after being fed %d frame(s)", fed)
+		case <-time.After(timeout):
+			return errors.Errorf("wiretap: timed out waiting for frame %d to be handled", fed)
+		}
+
+		fed++
+	}
+
+	return nil
+}
+
+// peerAddress is the address replayed frames appear to be sent from.
+const peerAddress = "127.0.0.1:0"
+
+var replayAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+// replayConn reports TCP addresses, which every transport layer may parse.
+type replayConn struct {
+	net.Conn
+}
+
+func (c *replayConn) LocalAddr() net.Addr {
+	return replayAddr
+}
+
+func (c *replayConn) RemoteAddr() net.Addr {
+	return replayAddr
+}
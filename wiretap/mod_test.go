@@ -0,0 +1,153 @@
+package wiretap
+
+import (
+	"bytes"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/cipher/aead"
+	"github.com/perlin-network/noise/handshake/ecdh"
+	"github.com/perlin-network/noise/log"
+	"github.com/perlin-network/noise/payload"
+	"github.com/perlin-network/noise/protocol"
+	"github.com/perlin-network/noise/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type echo struct {
+	text string
+}
+
+func (echo) Read(reader payload.Reader) (noise.Message, error) {
+	text, err := reader.ReadString()
+	if err != nil {
+		return nil, err
+	}
+
+	return echo{text: text}, nil
+}
+
+func (m echo) Write() []byte {
+	return payload.NewWriter(nil).WriteString(m.text).Bytes()
+}
+
+var opcodeEcho = noise.RegisterMessage(noise.NextAvailableOpcode(), (*echo)(nil))
+
+func newNode(t *testing.T, layer transport.Layer) *noise.Node {
+	params := noise.DefaultParams()
+	params.Transport = layer
+
+	node, err := noise.NewNode(params)
+	assert.NoError(t, err)
+
+	go node.Listen()
+
+	return node
+}
+
+// handle has our node echo back every message in upper case.
+func handle(node *noise.Node) {
+	node.OnMessageReceived(opcodeEcho, func(node *noise.Node, opcode noise.Opcode, peer *noise.Peer, message noise.Message) error {
+		return peer.SendMessage(echo{text: string(bytes.ToUpper([]byte(message.(echo).text)))})
+	})
+}
+
+func TestRecordReplay(t *testing.T) {
+	log.Disable()
+	defer log.Enable()
+
+	layer := transport.NewBuffered()
+
+	alice, bob := newNode(t, layer), newNode(t, layer)
+	defer alice.Kill()
+	defer bob.Kill()
+
+	var recording bytes.Buffer
+	recorder := Record(bob, &recording)
+
+	for _, node := range []*noise.Node{alice, bob} {
+		protocol.New().Register(ecdh.New()).Register(aead.New()).Enforce(node)
+	}
+
+	handle(bob)
+
+	peer, err := alice.Dial(bob.ExternalAddress())
+	assert.NoError(t, err)
+	assert.NoError(t, protocol.WaitUntilEstablished(peer))
+
+	for _, text := range []string{"hello", "world"} {
+		assert.NoError(t, peer.SendMessage(echo{text: text}))
+
+		select {
+		case msg := <-peer.Receive(opcodeEcho):
+			assert.Equal(t, string(bytes.ToUpper([]byte(text))), msg.(echo).text)
+		case <-time.After(3 * time.Second):
+			t.Fatal("bob never echoed back")
+		}
+	}
+
+	recorder.Stop()
+	assert.NoError(t, recorder.Err())
+
+	frames, err := Load(&recording)
+	assert.NoError(t, err)
+
+	// Frames are recorded after being decrypted, and before being encrypted.
+	var inbound, outbound []Frame
+
+	for _, frame := range frames {
+		if frame.Opcode() != opcodeEcho {
+			continue
+		}
+
+		if frame.Direction == Inbound {
+			inbound = append(inbound, frame)
+		} else {
+			outbound = append(outbound, frame)
+		}
+	}
+
+	if assert.Len(t, inbound, 2) && assert.Len(t, outbound, 2) {
+		msg, err := echo{}.Read(payload.NewReader(inbound[0].Data[1:]))
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", msg.(echo).text)
+	}
+
+	// Replaying the session into a fresh node, without the blocks which encrypted it, reproduces
+	// the frames bob sent back.
+	carol := newNode(t, layer)
+	defer carol.Kill()
+
+	handle(carol)
+
+	replayed, err := Replay(carol, inbound, 3*time.Second)
+	assert.NoError(t, err)
+
+	if assert.Len(t, replayed, 2) {
+		for i := range replayed {
+			assert.Equal(t, outbound[i].Data, replayed[i].Data)
+			assert.Equal(t, Outbound, replayed[i].Direction)
+		}
+	}
+}
+
+func TestLoadMalformed(t *testing.T) {
+	_, err := Load(bytes.NewReader([]byte("not a recording")))
+	assert.True(t, errors.Is(err, ErrMalformed))
+
+	var recording bytes.Buffer
+	recorder := &Recorder{writer: &recording}
+
+	recording.WriteString(magic)
+	recorder.write(Frame{Time: time.Now(), Peer: "127.0.0.1:3000", Direction: Outbound, Data: []byte{1, 2, 3}})
+
+	frames, err := Load(bytes.NewReader(recording.Bytes()))
+	assert.NoError(t, err)
+	assert.Len(t, frames, 1)
+
+	// Recordings cut short keep the frames which were read in full.
+	frames, err = Load(bytes.NewReader(recording.Bytes()[:recording.Len()-1]))
+	assert.True(t, errors.Is(err, ErrMalformed))
+	assert.Empty(t, frames)
+}